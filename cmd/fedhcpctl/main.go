@@ -0,0 +1,161 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// fedhcpctl runs maintenance commands for a FeDHCP deployment. The report
+// command cross-checks metal configs against the IPAM IPs and the Endpoints of
+// the cluster, or fetches the report of a running instance from its admin API.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/ironcore-dev/fedhcp/plugins/metal"
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: fedhcpctl [flags] <command> [command flags]
+
+Commands:
+  report   cross-check metal configs against the IPAM IPs and the Endpoints
+
+Flags:
+`)
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch command := flag.Arg(0); command {
+	case "report":
+		err = report(flag.Args()[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "fedhcpctl: unknown command %q\n", command)
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fedhcpctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// report builds the inventory report of the metal configs, or fetches the one
+// of a running instance, and writes it to stdout.
+func report(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	var configs string
+	var adminAddress string
+	var output string
+	var timeout time.Duration
+	fs.StringVar(&configs, "configs", "", "comma separated metal config files to cross-check")
+	fs.StringVar(&adminAddress, "admin-address", "",
+		"admin API address of a running instance to fetch the report from, including the hosts never seen, instead")
+	fs.StringVar(&output, "output", "text", "output format: text or json")
+	fs.DurationVar(&timeout, "timeout", time.Minute, "time the report may take")
+	_ = fs.Parse(args)
+
+	if output != "text" && output != "json" {
+		return fmt.Errorf("invalid output %q, should be text or json", output)
+	}
+	var paths []string
+	for _, path := range strings.Split(configs, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	if (len(paths) == 0) == (adminAddress == "") {
+		return fmt.Errorf("either --configs or --admin-address must be given")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var r *metal.InventoryReport
+	var err error
+	if adminAddress != "" {
+		r, err = fetchReport(ctx, adminAddress)
+	} else {
+		if err := kubernetes.InitClient(); err != nil {
+			return err
+		}
+		r, err = metal.BuildReport(ctx, kubernetes.GetClient(), paths...)
+	}
+	if err != nil {
+		return err
+	}
+
+	if output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	}
+	return writeReport(os.Stdout, r)
+}
+
+// fetchReport fetches the report of the instance serving the admin API at the
+// address, given as host:port or URL.
+func fetchReport(ctx context.Context, address string) (*metal.InventoryReport, error) {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(address, "/")+"/metal/report", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch report: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("failed to fetch report: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	r := &metal.InventoryReport{}
+	if err := json.NewDecoder(resp.Body).Decode(r); err != nil {
+		return nil, fmt.Errorf("invalid report: %w", err)
+	}
+	return r, nil
+}
+
+// writeReport writes the findings of the report as a table, followed by their
+// counts.
+func writeReport(w io.Writer, r *metal.InventoryReport) error {
+	if len(r.Findings) == 0 {
+		_, err := fmt.Fprintln(w, "No inconsistencies found.")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "KIND\tINVENTORY\tENTRY\tENDPOINT\tIP")
+	for _, f := range r.Findings {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", f.Kind, orNone(f.Inventory), orNone(f.Entry), orNone(f.Endpoint), orNone(f.IP))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%d inconsistencies found: %v\n", len(r.Findings), r.Counts)
+	return err
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
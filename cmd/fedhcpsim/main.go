@@ -0,0 +1,157 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// fedhcpsim simulates a DHCP exchange of a synthetic client through the plugin
+// chain of a FeDHCP configuration, printing the decision of each plugin entry
+// and the final packets, without binding sockets or writing to kubernetes.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/coredhcp/coredhcp/config"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/ironcore-dev/fedhcp/internal/chain"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes/fake"
+	"github.com/ironcore-dev/fedhcp/internal/registry"
+	"github.com/ironcore-dev/fedhcp/internal/requested"
+	"github.com/ironcore-dev/fedhcp/internal/response"
+	"github.com/ironcore-dev/fedhcp/internal/route"
+	"github.com/ironcore-dev/fedhcp/internal/simulate"
+	"github.com/ironcore-dev/fedhcp/internal/standalone"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func main() {
+	var configFile string
+	var standaloneFile string
+	var mac string
+	var family string
+	var relay string
+	var vendorClass string
+	var hostname string
+	var skip string
+	var offline bool
+	var routesFile string
+
+	flag.StringVar(&configFile, "config", "", "config file")
+	flag.StringVar(&standaloneFile, "standalone", "", "standalone file, used instead of the config file")
+	flag.StringVar(&mac, "mac", "", "MAC address of the client")
+	flag.StringVar(&family, "family", "", "simulate DHCPv4 (4) or DHCPv6 (6) only, both configured ones if empty")
+	flag.StringVar(&relay, "relay", "", "relay agent address the messages are forwarded by, sent directly if empty")
+	flag.StringVar(&vendorClass, "vendor-class", "", "vendor class the client sends")
+	flag.StringVar(&hostname, "hostname", "", "hostname (DHCPv4) or FQDN (DHCPv6) the client sends")
+	flag.StringVar(&skip, "skip", "bootp,capture,syslog",
+		"comma separated plugins whose entries pass the messages on without being run")
+	flag.BoolVar(&offline, "offline", false, "use an empty in-memory kubernetes cluster instead of the configured one")
+	flag.StringVar(&routesFile, "routes", "", "route table file of the plugin entries with a route argument")
+	flag.Parse()
+
+	if err := run(configFile, standaloneFile, mac, family, relay, vendorClass, hostname, skip, routesFile, offline); err != nil {
+		fmt.Fprintf(os.Stderr, "fedhcpsim: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(configFile, standaloneFile, mac, family, relay, vendorClass, hostname, skip, routesFile string, offline bool) error {
+	hwAddr, err := net.ParseMAC(mac)
+	if err != nil {
+		return fmt.Errorf("invalid MAC address %q: %w", mac, err)
+	}
+	cl := simulate.Client{MAC: hwAddr, VendorClass: vendorClass, Hostname: hostname}
+	if relay != "" {
+		if cl.Relay = net.ParseIP(relay); cl.Relay == nil {
+			return fmt.Errorf("invalid relay address %s", relay)
+		}
+	}
+	if family != "" && family != "4" && family != "6" {
+		return fmt.Errorf("invalid family %s, should be 4 or 6", family)
+	}
+
+	var cfg *config.Config
+	if standaloneFile != "" {
+		cfg, err = standalone.Load(standaloneFile)
+	} else {
+		cfg, err = config.Load(configFile)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	var routes *route.Table
+	if routesFile != "" {
+		if routes, err = route.Load(routesFile); err != nil {
+			return fmt.Errorf("failed to load routes: %w", err)
+		}
+	}
+
+	if registry.RequiresKubernetes(cfg) || routes.RequiresKubernetes() {
+		if offline {
+			var fakeClient client.Client = fake.NewClient()
+			kubernetes.SetClient(&fakeClient)
+		} else if err := kubernetes.InitDryRunClient(); err != nil {
+			return fmt.Errorf("failed to initialize kubernetes client: %w", err)
+		}
+	}
+
+	wrapped := make([]*plugins.Plugin, 0, len(registry.Plugins))
+	for _, p := range registry.Plugins {
+		wrapped = append(wrapped, routes.Wrap(chain.Wrap(requested.Wrap(response.Wrap(p)))))
+	}
+	skipped := sets.New[string]()
+	for _, name := range strings.Split(skip, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			skipped.Insert(name)
+		}
+	}
+	c, err := simulate.Load(cfg, wrapped, skipped)
+	if err != nil {
+		return fmt.Errorf("failed to load plugins: %w", err)
+	}
+
+	completed := true
+	if c.Has4() && family != "6" {
+		exchanges, err := c.Exchange4(cl)
+		completed = report(exchanges, 2) && completed
+		if err != nil {
+			return err
+		}
+	}
+	if c.Has6() && family != "4" {
+		exchanges, err := c.Exchange6(cl)
+		completed = report(exchanges, 2) && completed
+		if err != nil {
+			return err
+		}
+	}
+	if !completed {
+		return fmt.Errorf("exchange did not complete")
+	}
+	return nil
+}
+
+// report writes the exchanges to stdout and reports whether all of the expected
+// ones got a response.
+func report(exchanges []simulate.Exchange, expected int) bool {
+	for _, x := range exchanges {
+		fmt.Println(x.Request)
+		for i, step := range x.Steps {
+			fmt.Printf("[%d] %s: %s\n", i+1, step.Plugin, step.Outcome)
+			for _, change := range step.Changes {
+				fmt.Printf("      %s\n", change)
+			}
+		}
+		if x.Response == "" {
+			fmt.Printf("=> dropped\n\n")
+			return false
+		}
+		fmt.Printf("=> %s\n\n", x.Response)
+	}
+	return len(exchanges) == expected
+}
@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/ironcore-dev/fedhcp/internal/api"
+)
+
+const configUsage = `usage:
+  fedhcp config init [-dir <dir>] [<plugin>...]
+        write a sample config file per plugin, of all plugins if none given
+  fedhcp config check <plugin> <file>
+        validate the config file of a plugin`
+
+// runConfig runs the config subcommand with its arguments.
+func runConfig(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(configUsage)
+	}
+	switch args[0] {
+	case "init":
+		return configInit(args[1:], stdout)
+	case "check":
+		return configCheck(args[1:], stdout)
+	default:
+		return fmt.Errorf("unknown config command %s\n%s", args[0], configUsage)
+	}
+}
+
+// configInit writes a sample config file per plugin into a directory. Existing
+// files are left alone.
+func configInit(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("config init", flag.ContinueOnError)
+	dir := flags.String("dir", ".", "directory the config files are written to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	kinds := flags.Args()
+	if len(kinds) == 0 {
+		kinds = api.Kinds()
+	}
+	for _, kind := range kinds {
+		config, err := api.New(kind)
+		if err != nil {
+			return err
+		}
+		sample, err := api.Sample(config)
+		if err != nil {
+			return fmt.Errorf("failed to generate %s config: %w", kind, err)
+		}
+
+		path := filepath.Join(*dir, kind+"_config.yaml")
+		header := fmt.Sprintf("# Sample %s config, all fields hold their zero value.\n# Check it with: fedhcp config check %s %s\n", kind, kind, path)
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("%s exists already", path)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = f.WriteString(header + string(sample))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		_, _ = fmt.Fprintf(stdout, "Wrote %s\n", path)
+	}
+	return nil
+}
+
+// configCheck validates the config file of a plugin: its syntax, field names
+// and types, and its apiVersion. The checks depending on the values run on
+// startup only.
+func configCheck(args []string, stdout io.Writer) error {
+	if len(args) != 2 {
+		return errors.New(configUsage)
+	}
+	kind, path := args[0], args[1]
+	config, err := api.New(kind)
+	if err != nil {
+		return err
+	}
+	if err := api.Check(path, config); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	_, _ = fmt.Fprintf(stdout, "%s is a valid %s config\n", path, kind)
+	return nil
+}
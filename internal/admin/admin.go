@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package admin serves the administrative HTTP API. Plugins register their
+// endpoints with Handle, the listener is started by main if an admin address
+// is configured.
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sync"
+	"time"
+)
+
+var mux = http.NewServeMux()
+
+var (
+	stateMu sync.Mutex
+	// states maps names, usually plugin instances, to their state providers
+	states    = make(map[string]func() any)
+	debugOnce sync.Once
+)
+
+// Handle registers the handler for the given pattern on the admin API.
+func Handle(pattern string, handler http.Handler) {
+	mux.Handle(pattern, handler)
+}
+
+// State registers a provider of the internal state of name, e.g. the sizes of
+// its caches. The state is dumped as JSON under /debug/state, if debugging is
+// enabled. A provider registered again under the same name replaces the previous one.
+func State(name string, provider func() any) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	states[name] = provider
+}
+
+// EnableDebug serves the Go profiler under /debug/pprof/ and the internal
+// state under /debug/state.
+func EnableDebug() {
+	debugOnce.Do(func() {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		mux.HandleFunc("/debug/state", serveState)
+	})
+}
+
+type runtimeState struct {
+	Goroutines  int    `json:"goroutines"`
+	HeapAlloc   uint64 `json:"heapAlloc"`
+	HeapObjects uint64 `json:"heapObjects"`
+	NumGC       uint32 `json:"numGC"`
+}
+
+func serveState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	dump := map[string]any{
+		"runtime": runtimeState{
+			Goroutines:  runtime.NumGoroutine(),
+			HeapAlloc:   memStats.HeapAlloc,
+			HeapObjects: memStats.HeapObjects,
+			NumGC:       memStats.NumGC,
+		},
+	}
+
+	stateMu.Lock()
+	providers := make(map[string]func() any, len(states))
+	for name, provider := range states {
+		providers[name] = provider
+	}
+	stateMu.Unlock()
+	// providers take their own locks, so they are called without holding stateMu
+	for name, provider := range providers {
+		dump[name] = provider()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(dump)
+}
+
+// ListenAndServe serves the admin API on addr. It blocks until the listener fails.
+func ListenAndServe(addr string) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return server.ListenAndServe()
+}
@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func get(path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestDebugDisabled(t *testing.T) {
+	if rec := get("/debug/state"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected /debug/state to be unavailable before debugging is enabled, got %d", rec.Code)
+	}
+}
+
+func TestState(t *testing.T) {
+	State("test/v4#1", func() any { return map[string]int{"responseCache": 3} })
+	EnableDebug()
+	EnableDebug()
+
+	rec := get("/debug/state")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	var dump map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &dump); err != nil {
+		t.Fatal(err)
+	}
+	if string(dump["test/v4#1"]) == "" {
+		t.Fatalf("expected state of test/v4#1, got %s", rec.Body.String())
+	}
+	var state map[string]int
+	if err := json.Unmarshal(dump["test/v4#1"], &state); err != nil || state["responseCache"] != 3 {
+		t.Errorf("unexpected state %s", dump["test/v4#1"])
+	}
+	if _, ok := dump["runtime"]; !ok {
+		t.Error("expected the runtime state")
+	}
+
+	if rec := get("/debug/pprof/"); rec.Code != http.StatusOK {
+		t.Errorf("expected pprof index, got %d", rec.Code)
+	}
+}
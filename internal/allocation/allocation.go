@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package allocation measures how long machines wait for an address: the time
+// from the first DHCPDISCOVER or SOLICIT of a MAC address to the first response
+// carrying an address for it, per subnet, so that provisioning SLOs can be
+// monitored. Retransmissions and retries in between are part of the wait.
+package allocation
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ironcore-dev/fedhcp/internal/admin"
+	"github.com/ironcore-dev/fedhcp/internal/cache"
+	"github.com/ironcore-dev/fedhcp/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var latency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: metrics.Namespace,
+	Subsystem: "allocation",
+	Name:      "latency_seconds",
+	Help:      "Time from the first DHCPDISCOVER or SOLICIT of a machine to the first response carrying an address, per subnet.",
+	Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1800},
+}, []string{"subnet"})
+
+const (
+	// maxPending bounds the number of machines waiting for an address, the
+	// least recently started are forgotten first.
+	maxPending = 100000
+	// pendingTTL is the time after which a machine still waiting is forgotten,
+	// so a machine powered off in between is measured afresh
+	pendingTTL = time.Hour
+)
+
+var (
+	once sync.Once
+	mu   sync.Mutex
+	// pending holds the time of the first request per MAC address
+	pending = cache.New[string, time.Time]("allocation/pending", maxPending, pendingTTL)
+	// now is replaced in tests
+	now = time.Now
+)
+
+func register() {
+	once.Do(func() {
+		metrics.Register(latency)
+		admin.State("allocation", func() any { return map[string]int{"pending": pending.Len()} })
+	})
+}
+
+// Start notes that the machine asked for an address. Only the first request
+// counts, later ones until the machine got an address are ignored.
+func Start(mac net.HardwareAddr) {
+	if len(mac) == 0 {
+		return
+	}
+	register()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	key := mac.String()
+	if _, ok := pending.Get(key); !ok {
+		pending.Put(key, now())
+	}
+}
+
+// Done observes the time the machine waited for an address in the subnet and
+// stops measuring it. Machines not started, e.g. those renewing their lease,
+// are ignored.
+func Done(mac net.HardwareAddr, subnet string) {
+	if len(mac) == 0 {
+		return
+	}
+	register()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	key := mac.String()
+	started, ok := pending.Get(key)
+	if !ok {
+		return
+	}
+	pending.Delete(key)
+	latency.WithLabelValues(subnet).Observe(now().Sub(started).Seconds())
+}
@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package allocation
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLatency(t *testing.T) {
+	clock := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+	t.Cleanup(func() { now = time.Now })
+
+	mac := net.HardwareAddr{0x00, 0x1a, 0x2b, 0x00, 0x00, 0x01}
+	// renewals without a DHCPDISCOVER or SOLICIT are not measured
+	Done(mac, "oob-v4")
+
+	Start(mac)
+	clock = clock.Add(4 * time.Second)
+	// retransmissions don't restart the measurement
+	Start(mac)
+	clock = clock.Add(3 * time.Second)
+	Done(mac, "oob-v4")
+	// the response to the following DHCPREQUEST isn't measured again
+	Done(mac, "oob-v4")
+
+	if pending.Len() != 0 {
+		t.Errorf("expected no pending machine, got %d", pending.Len())
+	}
+
+	expected := `
+# HELP fedhcp_allocation_latency_seconds Time from the first DHCPDISCOVER or SOLICIT of a machine to the first response carrying an address, per subnet.
+# TYPE fedhcp_allocation_latency_seconds histogram
+fedhcp_allocation_latency_seconds_bucket{subnet="oob-v4",le="0.05"} 0
+fedhcp_allocation_latency_seconds_bucket{subnet="oob-v4",le="0.1"} 0
+fedhcp_allocation_latency_seconds_bucket{subnet="oob-v4",le="0.25"} 0
+fedhcp_allocation_latency_seconds_bucket{subnet="oob-v4",le="0.5"} 0
+fedhcp_allocation_latency_seconds_bucket{subnet="oob-v4",le="1"} 0
+fedhcp_allocation_latency_seconds_bucket{subnet="oob-v4",le="2.5"} 0
+fedhcp_allocation_latency_seconds_bucket{subnet="oob-v4",le="5"} 0
+fedhcp_allocation_latency_seconds_bucket{subnet="oob-v4",le="10"} 1
+fedhcp_allocation_latency_seconds_bucket{subnet="oob-v4",le="30"} 1
+fedhcp_allocation_latency_seconds_bucket{subnet="oob-v4",le="60"} 1
+fedhcp_allocation_latency_seconds_bucket{subnet="oob-v4",le="120"} 1
+fedhcp_allocation_latency_seconds_bucket{subnet="oob-v4",le="300"} 1
+fedhcp_allocation_latency_seconds_bucket{subnet="oob-v4",le="600"} 1
+fedhcp_allocation_latency_seconds_bucket{subnet="oob-v4",le="1800"} 1
+fedhcp_allocation_latency_seconds_bucket{subnet="oob-v4",le="+Inf"} 1
+fedhcp_allocation_latency_seconds_sum{subnet="oob-v4"} 7
+fedhcp_allocation_latency_seconds_count{subnet="oob-v4"} 1
+`
+	if err := testutil.CollectAndCompare(latency, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,203 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package announce publishes the addresses and capabilities of a running FeDHCP
+// instance as an annotation on a kubernetes Service, so that relay configuration
+// automation can discover the active instances instead of hardcoding addresses.
+//
+// Every instance writes its own annotation and refreshes it periodically, and
+// removes it on shutdown. Announcements not refreshed for StaleIntervals
+// intervals, e.g. of crashed instances or of pods replaced under a new name,
+// are removed by the other instances when they refresh theirs.
+package announce
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coredhcp/coredhcp/config"
+	"github.com/coredhcp/coredhcp/logger"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// AnnotationPrefix is followed by the instance name in the annotation key.
+const AnnotationPrefix = "announce.fedhcp.ironcore.dev/"
+
+// StaleIntervals is the number of refresh intervals after which an announcement
+// not refreshed is removed.
+const StaleIntervals = 5
+
+var log = logger.GetLogger("announce")
+
+// Announcement describes how to reach an instance and what it serves.
+type Announcement struct {
+	// Addresses are the UDP addresses the instance is reachable at, e.g. "[2001:db8::1]:547"
+	Addresses []string `json:"addresses"`
+	// Protocols are "dhcpv4" and "dhcpv6"
+	Protocols []string `json:"protocols"`
+	// Plugins are the names of the configured plugins
+	Plugins   []string  `json:"plugins"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// New builds the announcement of a server configuration. Listen addresses without
+// a unicast IP, i.e. the unspecified or a multicast address, are announced with
+// the given addresses of the matching family.
+func New(cfg *config.Config, addresses []net.IP) *Announcement {
+	a := &Announcement{}
+	addrs := sets.New[string]()
+	plugins := sets.New[string]()
+
+	collect := func(protocol string, server *config.ServerConfig, is6 bool) {
+		if server == nil {
+			return
+		}
+		a.Protocols = append(a.Protocols, protocol)
+		for _, plugin := range server.Plugins {
+			plugins.Insert(plugin.Name)
+		}
+		for _, listen := range server.Addresses {
+			port := strconv.Itoa(listen.Port)
+			if listen.IP != nil && !listen.IP.IsUnspecified() && !listen.IP.IsMulticast() {
+				addrs.Insert(net.JoinHostPort(listen.IP.String(), port))
+				continue
+			}
+			for _, ip := range addresses {
+				if (ip.To4() == nil) == is6 {
+					addrs.Insert(net.JoinHostPort(ip.String(), port))
+				}
+			}
+		}
+	}
+	collect("dhcpv4", cfg.Server4, false)
+	collect("dhcpv6", cfg.Server6, true)
+
+	a.Addresses = sets.List(addrs)
+	a.Plugins = sets.List(plugins)
+	sort.Strings(a.Protocols)
+	return a
+}
+
+// ParseService splits a "namespace/name" reference to a Service.
+func ParseService(ref string) (client.ObjectKey, error) {
+	namespace, name, ok := strings.Cut(ref, "/")
+	if !ok || namespace == "" || name == "" {
+		return client.ObjectKey{}, fmt.Errorf("invalid service %q, should be namespace/name", ref)
+	}
+	return client.ObjectKey{Namespace: namespace, Name: name}, nil
+}
+
+// Publish writes the announcement to the annotation of the instance on the
+// Service. With staleAfter set, the announcements of other instances not
+// updated within it, or unreadable, are removed. The Service is patched
+// with optimistic locking then, so that an announcement refreshed meanwhile is
+// kept.
+func (a *Announcement) Publish(ctx context.Context, cl client.Client, service client.ObjectKey, instance string,
+	staleAfter time.Duration) error {
+	a.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	value, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("failed to marshal announcement: %w", err)
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		svc := &corev1.Service{}
+		if err := cl.Get(ctx, service, svc); err != nil {
+			return fmt.Errorf("failed to get service %s: %w", service, err)
+		}
+		base := svc.DeepCopy()
+		if svc.Annotations == nil {
+			svc.Annotations = map[string]string{}
+		}
+		svc.Annotations[AnnotationPrefix+instance] = string(value)
+
+		var opts []client.MergeFromOption
+		if staleAfter > 0 {
+			if pruned := prune(svc.Annotations, instance, a.UpdatedAt.Add(-staleAfter)); len(pruned) > 0 {
+				log.Infof("Removing stale announcements of %s from service %s", strings.Join(pruned, ", "), service)
+				opts = append(opts, client.MergeFromWithOptimisticLock{})
+			}
+		}
+		if err := cl.Patch(ctx, svc, client.MergeFromWithOptions(base, opts...)); err != nil {
+			return fmt.Errorf("failed to patch service %s: %w", service, err)
+		}
+		return nil
+	})
+}
+
+// prune deletes the announcements of instances other than instance updated
+// before the deadline, and returns the instances deleted.
+func prune(annotations map[string]string, instance string, deadline time.Time) []string {
+	var pruned []string
+	for key, value := range annotations {
+		name, ok := strings.CutPrefix(key, AnnotationPrefix)
+		if !ok || name == instance {
+			continue
+		}
+		other := &Announcement{}
+		if err := json.Unmarshal([]byte(value), other); err == nil && !other.UpdatedAt.Before(deadline) {
+			continue
+		}
+		delete(annotations, key)
+		pruned = append(pruned, name)
+	}
+	sort.Strings(pruned)
+	return pruned
+}
+
+// Withdraw removes the annotation of the instance from the Service, e.g. on
+// shutdown.
+func Withdraw(ctx context.Context, cl client.Client, service client.ObjectKey, instance string) error {
+	svc := &corev1.Service{}
+	if err := cl.Get(ctx, service, svc); err != nil {
+		return fmt.Errorf("failed to get service %s: %w", service, err)
+	}
+	if _, ok := svc.Annotations[AnnotationPrefix+instance]; !ok {
+		return nil
+	}
+	base := svc.DeepCopy()
+	delete(svc.Annotations, AnnotationPrefix+instance)
+	if err := cl.Patch(ctx, svc, client.MergeFrom(base)); err != nil {
+		return fmt.Errorf("failed to patch service %s: %w", service, err)
+	}
+	return nil
+}
+
+// Run publishes the announcement and refreshes it every interval until the
+// context is done, pruning the announcements not refreshed for StaleIntervals
+// intervals. Only the first publication fails Run, later failures are logged
+// and retried at the next interval. The announcement is left in place, see
+// Withdraw.
+func (a *Announcement) Run(ctx context.Context, cl client.Client, service client.ObjectKey, instance string,
+	interval time.Duration) error {
+	staleAfter := StaleIntervals * interval
+	if err := a.Publish(ctx, cl, service, instance, staleAfter); err != nil {
+		return err
+	}
+	log.Infof("Announced %s on service %s", strings.Join(a.Addresses, ", "), service)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := a.Publish(ctx, cl, service, instance, staleAfter); err != nil {
+					log.Errorf("Failed to refresh announcement: %v", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
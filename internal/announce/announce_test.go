@@ -0,0 +1,146 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package announce
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/coredhcp/coredhcp/config"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes/fake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var testConfig = &config.Config{
+	Server4: &config.ServerConfig{
+		Addresses: []net.UDPAddr{{IP: net.ParseIP("192.168.0.1"), Port: 67}},
+		Plugins:   []config.PluginConfig{{Name: "oob"}},
+	},
+	Server6: &config.ServerConfig{
+		Addresses: []net.UDPAddr{{IP: net.IPv6unspecified, Port: 547}},
+		Plugins:   []config.PluginConfig{{Name: "pxeboot"}, {Name: "httpboot"}, {Name: "pxeboot"}},
+	},
+}
+
+func TestNew(t *testing.T) {
+	a := New(testConfig, []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("2001:db8::1")})
+
+	if expected := []string{"192.168.0.1:67", "[2001:db8::1]:547"}; !reflect.DeepEqual(a.Addresses, expected) {
+		t.Errorf("expected addresses %v, got %v", expected, a.Addresses)
+	}
+	if expected := []string{"dhcpv4", "dhcpv6"}; !reflect.DeepEqual(a.Protocols, expected) {
+		t.Errorf("expected protocols %v, got %v", expected, a.Protocols)
+	}
+	if expected := []string{"httpboot", "oob", "pxeboot"}; !reflect.DeepEqual(a.Plugins, expected) {
+		t.Errorf("expected plugins %v, got %v", expected, a.Plugins)
+	}
+}
+
+func TestParseService(t *testing.T) {
+	key, err := ParseService("fedhcp/dhcpv6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Namespace != "fedhcp" || key.Name != "dhcpv6" {
+		t.Errorf("unexpected service %s", key)
+	}
+	for _, ref := range []string{"dhcpv6", "/dhcpv6", "fedhcp/"} {
+		if _, err := ParseService(ref); err == nil {
+			t.Errorf("expected an error for %q", ref)
+		}
+	}
+}
+
+type services []client.Object
+
+func (s services) Objects() []client.Object { return s }
+
+func TestPublish(t *testing.T) {
+	cl := fake.NewClient(services{&corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "fedhcp",
+			Name:        "dhcpv6",
+			Annotations: map[string]string{"unrelated": "kept"},
+		},
+	}})
+	key := client.ObjectKey{Namespace: "fedhcp", Name: "dhcpv6"}
+	ctx := context.Background()
+
+	a := New(testConfig, []net.IP{net.ParseIP("2001:db8::1")})
+	if err := a.Publish(ctx, cl, key, "fedhcp-0", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := &corev1.Service{}
+	if err := cl.Get(ctx, key, svc); err != nil {
+		t.Fatal(err)
+	}
+	if svc.Annotations["unrelated"] != "kept" {
+		t.Error("expected other annotations to be kept")
+	}
+	published := &Announcement{}
+	if err := json.Unmarshal([]byte(svc.Annotations[AnnotationPrefix+"fedhcp-0"]), published); err != nil {
+		t.Fatalf("invalid announcement: %v", err)
+	}
+	if !reflect.DeepEqual(published.Addresses, a.Addresses) || published.UpdatedAt.IsZero() {
+		t.Errorf("unexpected announcement %+v", published)
+	}
+
+	if err := a.Publish(ctx, cl, client.ObjectKey{Namespace: "fedhcp", Name: "missing"}, "fedhcp-0", 0); err == nil {
+		t.Error("expected an error for a missing service")
+	}
+}
+
+func TestPruneAndWithdraw(t *testing.T) {
+	stale, _ := json.Marshal(Announcement{UpdatedAt: time.Now().Add(-time.Hour)})
+	fresh, _ := json.Marshal(Announcement{UpdatedAt: time.Now()})
+	cl := fake.NewClient(services{&corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "fedhcp",
+			Name:      "dhcpv6",
+			Annotations: map[string]string{
+				"unrelated":                   "kept",
+				AnnotationPrefix + "crashed":  string(stale),
+				AnnotationPrefix + "broken":   "{",
+				AnnotationPrefix + "fedhcp-1": string(fresh),
+			},
+		},
+	}})
+	key := client.ObjectKey{Namespace: "fedhcp", Name: "dhcpv6"}
+	ctx := context.Background()
+
+	a := New(testConfig, []net.IP{net.ParseIP("2001:db8::1")})
+	if err := a.Publish(ctx, cl, key, "fedhcp-0", StaleIntervals*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	svc := &corev1.Service{}
+	if err := cl.Get(ctx, key, svc); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for k := range svc.Annotations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if expected := []string{AnnotationPrefix + "fedhcp-0", AnnotationPrefix + "fedhcp-1", "unrelated"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected the stale and unreadable announcements to be removed, got %v", keys)
+	}
+
+	if err := Withdraw(ctx, cl, key, "fedhcp-0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cl.Get(ctx, key, svc); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := svc.Annotations[AnnotationPrefix+"fedhcp-0"]; ok || svc.Annotations[AnnotationPrefix+"fedhcp-1"] == "" {
+		t.Errorf("expected only the own announcement to be withdrawn, got %v", svc.Annotations)
+	}
+}
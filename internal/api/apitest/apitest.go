@@ -0,0 +1,24 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package apitest provides the plugin configs to the tests of the plugins.
+package apitest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ironcore-dev/fedhcp/internal/api"
+)
+
+// WriteConfig writes a plugin config into a temporary file of the test and
+// returns its path.
+func WriteConfig(t testing.TB, config any) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := api.WriteFile(path, config); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
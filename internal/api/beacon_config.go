@@ -0,0 +1,27 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+type BeaconRule struct {
+	Name string `yaml:"name"`
+	// Subnets are CIDRs, one of them has to contain the leased address or, if none is leased, the relay address
+	Subnets []string `yaml:"subnets,omitempty"`
+	// Classes are fingerprint classes, e.g. "server-nic", one of them has to be the client's
+	Classes []string `yaml:"classes,omitempty"`
+	// Value is the identifier sent to matching clients
+	Value string `yaml:"value"`
+}
+
+type BeaconConfig struct {
+	TypeMeta `yaml:",inline"`
+
+	// Option4 is the DHCPv4 option code the identifier is sent in, a site-specific one (224-254); 224 if 0
+	Option4 uint16 `yaml:"option4,omitempty"`
+	// Option6 is the DHCPv6 option code the identifier is sent in, required for DHCPv6
+	Option6 uint16 `yaml:"option6,omitempty"`
+	// Default is sent to the clients no rule matches, nothing if empty
+	Default string `yaml:"default,omitempty"`
+	// Rules are matched in order, the first matching rule applies
+	Rules []BeaconRule `yaml:"rules"`
+}
@@ -4,5 +4,7 @@
 package api
 
 type BluefieldConfig struct {
+	TypeMeta `yaml:",inline"`
+
 	BulefieldIP string `yaml:"bulefieldIP"`
 }
@@ -0,0 +1,24 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+type BootpReservation struct {
+	MACAddress string `yaml:"macAddress"`
+	// Address is the client's address with the prefix length of its subnet, e.g. 10.0.0.5/24
+	Address  string   `yaml:"address"`
+	Router   string   `yaml:"router,omitempty"`
+	DNS      []string `yaml:"dns,omitempty"`
+	Hostname string   `yaml:"hostname,omitempty"`
+	// NextServer is the boot server, defaults to the address of the interface
+	NextServer string `yaml:"nextServer,omitempty"`
+	Bootfile   string `yaml:"bootfile,omitempty"`
+}
+
+type BootpConfig struct {
+	TypeMeta `yaml:",inline"`
+
+	// Interfaces are the interfaces BOOTP requests are answered on
+	Interfaces   []string           `yaml:"interfaces"`
+	Reservations []BootpReservation `yaml:"reservations"`
+}
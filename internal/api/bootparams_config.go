@@ -0,0 +1,14 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+type BootParamsConfig struct {
+	TypeMeta `yaml:",inline"`
+
+	// Namespace holds the machines' ConfigMaps, labeled with fedhcp.ironcore.dev/mac
+	Namespace string `yaml:"namespace"`
+	// CmdLine is the Go template of the kernel command line, see docs/plugins.md for
+	// the functions looking up the machine's resources
+	CmdLine string `yaml:"cmdline"`
+}
@@ -0,0 +1,27 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+type BootServer struct {
+	// Type is the PXE boot server type, 0 is the PXE bootstrap server
+	Type        uint16   `yaml:"type"`
+	Description string   `yaml:"description"`
+	Addresses   []string `yaml:"addresses"`
+}
+
+type BootServerArchitecture struct {
+	// Arch is the client system architecture (option 93), e.g. 7 for EFI x64 or 16 for EFI x64 HTTP
+	Arch uint16 `yaml:"arch"`
+	// DiscoveryControl are the PXE discovery control bits (sub-option 6)
+	DiscoveryControl uint8        `yaml:"discoveryControl"`
+	MenuPrompt       string       `yaml:"menuPrompt,omitempty"`
+	MenuTimeout      uint8        `yaml:"menuTimeout,omitempty"`
+	Servers          []BootServer `yaml:"servers"`
+}
+
+type BootServersConfig struct {
+	TypeMeta `yaml:",inline"`
+
+	Architectures []BootServerArchitecture `yaml:"architectures"`
+}
@@ -0,0 +1,24 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+type CaptivePortalRule struct {
+	Name string `yaml:"name"`
+	// Subnets are CIDRs, one of them has to contain the leased address or, if none is leased, the relay address
+	Subnets []string `yaml:"subnets,omitempty"`
+	// Classes are fingerprint classes, e.g. "laptop", one of them has to be the client's
+	Classes []string `yaml:"classes,omitempty"`
+	// URL is the captive portal API URI (RFC 8908) sent to matching clients, or
+	// urn:ietf:params:capport:unrestricted if there is no captive portal
+	URL string `yaml:"url"`
+}
+
+type CaptivePortalConfig struct {
+	TypeMeta `yaml:",inline"`
+
+	// Default is sent to the clients no rule matches, nothing if empty
+	Default string `yaml:"default,omitempty"`
+	// Rules are matched in order, the first matching rule applies
+	Rules []CaptivePortalRule `yaml:"rules"`
+}
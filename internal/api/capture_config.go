@@ -0,0 +1,15 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+type CaptureConfig struct {
+	TypeMeta `yaml:",inline"`
+
+	// Directory is the directory the fixtures are written to, it has to exist
+	Directory string `yaml:"directory"`
+	// Percent is the share of requests captured, from 0 to 100
+	Percent float64 `yaml:"percent"`
+	// MaxFixtures bounds the number of fixtures written, defaults to 1000
+	MaxFixtures int `yaml:"maxFixtures,omitempty"`
+}
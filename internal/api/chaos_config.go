@@ -0,0 +1,14 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+import "time"
+
+type ChaosConfig struct {
+	TypeMeta `yaml:",inline"`
+
+	DropPercent   int           `yaml:"dropPercent"`
+	K8sDelay      time.Duration `yaml:"k8sDelay"`
+	CorruptOption uint16        `yaml:"corruptOption"`
+}
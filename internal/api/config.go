@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package api holds the configuration of the plugins. All plugin configs are
+// YAML files decoded with gopkg.in/yaml.v3 by Load and Unmarshal, so that map
+// keys, durations and error messages are handled alike by every plugin. The
+// layout of a config is versioned by its apiVersion, see Version.
+package api
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Load reads the config file at path into config, a pointer to a plugin
+// config.
+func Load(path string, config any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	return Unmarshal(data, config)
+}
+
+// Unmarshal decodes the YAML config data into config, a pointer to a plugin
+// config. Configs of older layouts are converted to the current one.
+func Unmarshal(data []byte, config any) error {
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return fmt.Errorf("failed to parse config file: %v", err)
+	}
+	return checkVersion(config)
+}
+
+// Marshal encodes a plugin config as YAML, which Unmarshal decodes into the
+// same config.
+func Marshal(config any) ([]byte, error) {
+	return yaml.Marshal(config)
+}
+
+// WriteFile writes a plugin config as YAML to the file at path.
+func WriteFile(path string, config any) error {
+	data, err := Marshal(config)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
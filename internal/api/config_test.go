@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoundTrip(t *testing.T) {
+	authoritative := false
+	for _, config := range []any{
+		&LeaseTimeConfig{
+			Default: LeaseTimes{LeaseTime: 10 * time.Minute},
+			Rules: []LeaseTimeRule{{
+				Name:       "onboarded",
+				Subnets:    []string{"10.0.0.0/16"},
+				LeaseTimes: LeaseTimes{LeaseTime: 24 * time.Hour, T1: 12 * time.Hour},
+			}},
+		},
+		&MetalConfig{
+			Inventories:     []Inventory{{Name: "compute-1", MacAddress: "aa:bb:cc:dd:ee:01"}},
+			AuthoritativeIP: &authoritative,
+		},
+		&PacingConfig{Window: time.Minute},
+	} {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := WriteFile(path, config); err != nil {
+			t.Fatal(err)
+		}
+		loaded := reflect.New(reflect.TypeOf(config).Elem()).Interface()
+		if err := Load(path, loaded); err != nil {
+			t.Fatal(err)
+		}
+		// empty maps and slices are loaded for nil ones, so the YAML is compared
+		expected, _ := Marshal(config)
+		actual, _ := Marshal(loaded)
+		if string(expected) != string(actual) {
+			t.Errorf("expected %s after a round trip, got %s", expected, actual)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	if err := Load(filepath.Join(t.TempDir(), "missing.yaml"), &PacingConfig{}); err == nil || !strings.HasPrefix(err.Error(), "failed to read config file") {
+		t.Errorf("expected a read error, got %v", err)
+	}
+	if err := Unmarshal([]byte("window: [1"), &PacingConfig{}); err == nil || !strings.HasPrefix(err.Error(), "failed to parse config file") {
+		t.Errorf("expected a parse error, got %v", err)
+	}
+}
+
+func TestVersions(t *testing.T) {
+	for _, tc := range []struct {
+		data     string
+		expected map[string]string
+	}{
+		// configs without apiVersion are of the first layout
+		{data: "subnetLabel: subnet=dhcp", expected: map[string]string{"subnet": "dhcp"}},
+		{data: "apiVersion: fedhcp.ironcore.dev/v1alpha1\nsubnetLabel: subnet=dhcp\nsubnetLabels:\n  site: a",
+			expected: map[string]string{"subnet": "dhcp", "site": "a"}},
+		{data: "apiVersion: fedhcp.ironcore.dev/v1alpha2\nsubnetLabels:\n  subnet: dhcp", expected: map[string]string{"subnet": "dhcp"}},
+	} {
+		config := &OOBConfig{}
+		if err := Unmarshal([]byte(tc.data), config); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(config.SubnetLabels, tc.expected) || config.SubnetLabel != "" {
+			t.Errorf("expected subnet labels %v for %q, got %v and %q", tc.expected, tc.data, config.SubnetLabels, config.SubnetLabel)
+		}
+	}
+
+	for _, data := range []string{
+		"apiVersion: fedhcp.ironcore.dev/v1\nsubnetLabels:\n  subnet: dhcp",
+		"apiVersion: fedhcp.ironcore.dev/v1alpha2\nsubnetLabel: subnet=dhcp",
+		"subnetLabel: subnet",
+		"subnetLabel: subnet=dhcp\nsubnetLabels:\n  subnet: inband",
+	} {
+		if err := Unmarshal([]byte(data), &OOBConfig{}); err == nil {
+			t.Errorf("no error occurred for config %q, but it should have", data)
+		}
+	}
+	if err := Unmarshal([]byte("apiVersion: fedhcp.ironcore.dev/v1\nwindow: 1m"), &PacingConfig{}); err == nil {
+		t.Error("no error occurred for an unsupported apiVersion, but it should have")
+	}
+}
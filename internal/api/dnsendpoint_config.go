@@ -0,0 +1,29 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+import "time"
+
+type DNSEndpointConfig struct {
+	TypeMeta `yaml:",inline"`
+
+	// Namespace the DNSEndpoints are created in
+	Namespace string `yaml:"namespace"`
+	// Domain qualifies the client names, names of other domains are moved into it
+	Domain string `yaml:"domain"`
+	// Reverse additionally publishes PTR records of the addresses
+	Reverse bool `yaml:"reverse,omitempty"`
+	// MACNames names clients without a hostname after their MAC address, e.g. 001a2b3c4d5e
+	MACNames bool `yaml:"macNames,omitempty"`
+	// TTL of the records, defaults to 5m
+	TTL time.Duration `yaml:"ttl,omitempty"`
+	// Owner labels the DNSEndpoints, only the ones of the owner are updated
+	// and cleaned up, defaults to fedhcp
+	Owner string `yaml:"owner,omitempty"`
+	// ExpireAfter deletes DNSEndpoints not refreshed for this long, they are
+	// kept until the client releases its address if not set
+	ExpireAfter time.Duration `yaml:"expireAfter,omitempty"`
+	// Labels are added to the DNSEndpoints, e.g. for the label filter of external-dns
+	Labels map[string]string `yaml:"labels,omitempty"`
+}
@@ -0,0 +1,20 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+type ForeignDomainPolicy string
+
+const (
+	ForeignDomainReplace ForeignDomainPolicy = "replace"
+	ForeignDomainKeep    ForeignDomainPolicy = "keep"
+	ForeignDomainReject  ForeignDomainPolicy = "reject"
+)
+
+type FQDNConfig struct {
+	TypeMeta `yaml:",inline"`
+
+	Domain         string              `yaml:"domain"`
+	ForeignDomains ForeignDomainPolicy `yaml:"foreignDomains,omitempty"`
+	ServerUpdates  bool                `yaml:"serverUpdates,omitempty"`
+}
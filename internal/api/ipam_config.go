@@ -3,7 +3,16 @@
 
 package api
 
+import "time"
+
 type IPAMConfig struct {
+	TypeMeta `yaml:",inline"`
+
 	Namespace string   `yaml:"namespace"`
-	Subnets   []string `yaml:"subnets"`
+	Subnets   []string `yaml:"subnets,omitempty"`
+	// SubnetLabel selects the subnets by label, e.g. "subnet=inband", together
+	// with Subnets only the named subnets carrying the labels
+	SubnetLabel string `yaml:"subnetLabel,omitempty"`
+	// Timeout bounds the kubernetes calls of a request, defaults to 15s
+	Timeout time.Duration `yaml:"timeout,omitempty"`
 }
@@ -0,0 +1,35 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+import "time"
+
+type LeaseTimes struct {
+	// LeaseTime is the DHCPv4 lease time and the DHCPv6 valid lifetime
+	LeaseTime time.Duration `yaml:"leaseTime"`
+	// PreferredLifetime is the DHCPv6 preferred lifetime, defaults to LeaseTime
+	PreferredLifetime time.Duration `yaml:"preferredLifetime,omitempty"`
+	// T1 is the renewal time, defaults to half of the preferred lifetime in DHCPv6
+	T1 time.Duration `yaml:"t1,omitempty"`
+	// T2 is the rebinding time, defaults to 0.8 of the preferred lifetime in DHCPv6
+	T2 time.Duration `yaml:"t2,omitempty"`
+}
+
+type LeaseTimeRule struct {
+	Name string `yaml:"name"`
+	// VendorClasses are vendor class prefixes, one of them has to match the client's vendor class
+	VendorClasses []string `yaml:"vendorClasses,omitempty"`
+	// Subnets are CIDRs, one of them has to contain the leased address
+	Subnets    []string `yaml:"subnets,omitempty"`
+	LeaseTimes `yaml:",inline"`
+}
+
+type LeaseTimeConfig struct {
+	TypeMeta `yaml:",inline"`
+
+	// Default applies to clients no rule matches
+	Default LeaseTimes `yaml:"default"`
+	// Rules are matched in order, the first matching rule applies
+	Rules []LeaseTimeRule `yaml:"rules,omitempty"`
+}
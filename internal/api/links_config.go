@@ -0,0 +1,22 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+const (
+	// LinkOwnerNone links the IPs and the Endpoint by the correlation label only
+	LinkOwnerNone = "None"
+	// LinkOwnerEndpoint makes the Endpoint own the IPs of its MAC address
+	LinkOwnerEndpoint = "Endpoint"
+	// LinkOwnerIP would make the IPs own the Endpoint, which kubernetes does
+	// not support, as a cluster-scoped Endpoint cannot have namespaced owners
+	LinkOwnerIP = "IP"
+)
+
+// Links relates the IPAM IPs and the Endpoint of a MAC address.
+type Links struct {
+	// Enabled sets the correlation label on the IPs and the Endpoint
+	Enabled bool `yaml:"enabled"`
+	// Owner is the object owning the others by owner references, defaults to None
+	Owner string `yaml:"owner,omitempty"`
+}
@@ -3,17 +3,78 @@
 
 package api
 
+import "time"
+
 type Inventory struct {
 	Name       string `yaml:"name"`
 	MacAddress string `yaml:"macAddress"`
+	// DUID matches clients presenting a stable DUID but randomized MAC addresses, in hex
+	DUID string `yaml:"duid,omitempty"`
+	// Type and Rack are passed to the Endpoint as labels
+	Type        string            `yaml:"type,omitempty"`
+	Rack        string            `yaml:"rack,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+	// Family restricts onboarding to requests of one address family, IPv4 or IPv6, defaults to both
+	Family string `yaml:"family,omitempty"`
 }
 
 type Filter struct {
 	MacPrefix []string `yaml:"macPrefix"`
+	// Family restricts onboarding to requests of one address family, IPv4 or IPv6, defaults to both
+	Family string `yaml:"family,omitempty"`
+}
+
+// InventorySource is an inventory besides the hosts and filter of the config,
+// e.g. owned by another team. Exactly one of File, URL and Servers is set.
+type InventorySource struct {
+	// Name identifies the source in the logs, state and metrics
+	Name string `yaml:"name"`
+	// File is a YAML file holding hosts like the config
+	File string `yaml:"file,omitempty"`
+	// URL is an HTTP endpoint returning hosts like the config, in YAML or JSON
+	URL string `yaml:"url,omitempty"`
+	// Servers looks the clients up in the metal-operator Servers, by the MAC
+	// addresses of their network interfaces
+	Servers *ServerSource `yaml:"servers,omitempty"`
+	// Interval is the interval the hosts of a file or URL are reloaded at, defaults to 1m
+	Interval time.Duration `yaml:"interval,omitempty"`
+	// Timeout bounds a reload or lookup, defaults to 10s
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// ServerSource selects the Servers of an inventory source.
+type ServerSource struct {
+	// LabelSelector restricts the Servers, e.g. "team=b", all if empty
+	LabelSelector string `yaml:"labelSelector,omitempty"`
 }
 
 type MetalConfig struct {
-	NamePrefix  string      `yaml:"namePrefix"`
-	Inventories []Inventory `yaml:"hosts"`
-	Filter      Filter      `yaml:"filter"`
+	TypeMeta `yaml:",inline"`
+
+	NamePrefix string `yaml:"namePrefix"`
+	// NameTemplate defines the names of dynamically onboarded Endpoints, e.g. "compute-{mac-nosep}"
+	NameTemplate string      `yaml:"nameTemplate,omitempty"`
+	Inventories  []Inventory `yaml:"hosts"`
+	Filter       Filter      `yaml:"filter"`
+	// AuthoritativeIP defines whether the IP address of an existing Endpoint is
+	// overwritten with the one from IPAM, defaults to true
+	AuthoritativeIP *bool `yaml:"authoritativeIP,omitempty"`
+	// DeviceClassLabels labels Endpoints with the device class detected by DHCP fingerprinting
+	DeviceClassLabels bool `yaml:"deviceClassLabels,omitempty"`
+	// ObserveUntil makes the plugin only record the Endpoints it would apply until then
+	ObserveUntil *time.Time `yaml:"observeUntil,omitempty"`
+	// FamilyPrecedence is the address family, IPv4 or IPv6, whose address an existing
+	// Endpoint keeps when a request of the other family comes in
+	FamilyPrecedence string `yaml:"familyPrecedence,omitempty"`
+	// ReportInterval is the interval of the inventory report, which cross-checks
+	// the config against IPAM and the Endpoints; 0 disables the periodic report
+	ReportInterval time.Duration `yaml:"reportInterval,omitempty"`
+	// Links relates the Endpoints to the IPAM IPs of their MAC address
+	Links Links `yaml:"links,omitempty"`
+	// Sources are looked up in order for clients matching neither a host nor the filter
+	Sources []InventorySource `yaml:"sources,omitempty"`
+	// RetryFile persists the Endpoint applies waiting for a retry, so they
+	// survive a restart; they are kept in memory only if empty
+	RetryFile string `yaml:"retryFile,omitempty"`
 }
@@ -0,0 +1,21 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+type ONIEModel struct {
+	// Platform is the ONIE platform string the switch model reports in its vendor
+	// class, e.g. x86_64-accton_as7712_32x-r0
+	Platform string `yaml:"platform"`
+	// URL is the installer URL served to switches of the model
+	URL string `yaml:"url"`
+}
+
+type ONIEConfig struct {
+	TypeMeta `yaml:",inline"`
+
+	// DefaultURL is the installer URL served to switches of models not listed,
+	// those are not answered if it is empty
+	DefaultURL string      `yaml:"defaultURL,omitempty"`
+	Models     []ONIEModel `yaml:"models,omitempty"`
+}
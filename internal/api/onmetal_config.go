@@ -3,10 +3,27 @@
 
 package api
 
+import "time"
+
 type PrefixDelegation struct {
 	Length int `yaml:"length"`
+	// ExcludeLength is the length of the prefix around the client's address,
+	// e.g. of its link, excluded from the delegated prefix (RFC 6603), 0 disables exclusion
+	ExcludeLength int `yaml:"excludeLength,omitempty"`
 }
 
 type OnMetalConfig struct {
-	PrefixDelegation PrefixDelegation `yaml:"prefixDelegation"`
+	TypeMeta `yaml:",inline"`
+
+	PrefixDelegation   PrefixDelegation   `yaml:"prefixDelegation"`
+	TemporaryAddresses TemporaryAddresses `yaml:"temporaryAddresses,omitempty"`
+}
+
+type TemporaryAddresses struct {
+	Enabled           bool          `yaml:"enabled"`
+	PreferredLifetime time.Duration `yaml:"preferredLifetime,omitempty"`
+	ValidLifetime     time.Duration `yaml:"validLifetime,omitempty"`
+	// Persist reserves temporary addresses in IPAM, flagged as temporary.
+	// Only honored by plugins backed by IPAM.
+	Persist bool `yaml:"persist,omitempty"`
 }
@@ -3,7 +3,122 @@
 
 package api
 
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// OOBDNS are the DNS options of the subnets carrying all of the labels.
+type OOBDNS struct {
+	// SubnetLabels select the subnets, empty matches all
+	SubnetLabels map[string]string `yaml:"subnetLabels,omitempty"`
+	// Servers are the recursive DNS servers (DHCPv6 option 23)
+	Servers []string `yaml:"servers,omitempty"`
+	// SearchList is the domain search list (DHCPv6 option 24)
+	SearchList []string `yaml:"searchList,omitempty"`
+}
+
+// LabelSelector selects objects by their labels with the semantics of a
+// kubernetes label selector: all of MatchLabels and MatchExpressions must match.
+type LabelSelector struct {
+	MatchLabels      map[string]string          `yaml:"matchLabels,omitempty"`
+	MatchExpressions []LabelSelectorRequirement `yaml:"matchExpressions,omitempty"`
+}
+
+// LabelSelectorRequirement matches the value of a label against a set of values.
+type LabelSelectorRequirement struct {
+	Key string `yaml:"key"`
+	// Operator is one of In, NotIn, Exists and DoesNotExist
+	Operator string `yaml:"operator"`
+	// Values must be empty for Exists and DoesNotExist, and not empty otherwise
+	Values []string `yaml:"values,omitempty"`
+}
+
+// OOBReservation is a critical client, e.g. a BMC, whose addresses are reserved
+// on startup.
+type OOBReservation struct {
+	// MAC is the MAC address of the client
+	MAC string `yaml:"mac"`
+	// IPv4 is the IPv4 address to reserve, a free one of the first subnet if empty
+	IPv4 string `yaml:"ipv4,omitempty"`
+	// IPv6 is the IPv6 address to reserve, a free one of the first subnet if empty
+	IPv6 string `yaml:"ipv6,omitempty"`
+}
+
+// OOBReservations reserve the addresses of critical clients before any DHCP
+// traffic and watch them for drift.
+type OOBReservations struct {
+	Clients []OOBReservation `yaml:"clients,omitempty"`
+	// Interval is the interval the reservations are checked for drift at, defaults to 5m
+	Interval time.Duration `yaml:"interval,omitempty"`
+}
+
+// OOBMessageTypes restrict the DHCPv4 message types the plugin leases for,
+// e.g. "DISCOVER" or "INFORM". Messages of other types are passed on to the
+// next plugins.
+type OOBMessageTypes struct {
+	// Allocate are the message types an address is leased for, defaults to
+	// DISCOVER and REQUEST
+	Allocate []string `yaml:"allocate,omitempty"`
+	// Ignore are the message types dropped without a response
+	Ignore []string `yaml:"ignore,omitempty"`
+}
+
 type OOBConfig struct {
-	Namespace   string `yaml:"namespace"`
-	SubnetLabel string `yaml:"subnetLabel"`
+	TypeMeta `yaml:",inline"`
+
+	Namespace string `yaml:"namespace"`
+	// SubnetLabel selects the subnets by a single label, e.g. "subnet=dhcp".
+	//
+	// Deprecated: dropped in V1Alpha2, converted to SubnetLabels before.
+	SubnetLabel string `yaml:"subnetLabel,omitempty" deprecated:"true"`
+	// SubnetLabels select the subnets carrying all of the labels, the IPs
+	// created are labeled alike
+	SubnetLabels map[string]string `yaml:"subnetLabels,omitempty"`
+	// SubnetSelector additionally selects the subnets by set-based
+	// expressions, the IPs created are labeled with its matchLabels
+	SubnetSelector     *LabelSelector     `yaml:"subnetSelector,omitempty"`
+	Interface          string             `yaml:"interface,omitempty"`
+	TemporaryAddresses TemporaryAddresses `yaml:"temporaryAddresses,omitempty"`
+	// Authoritative makes the plugin NAK DHCPv4 Requests of addresses it does not recognize
+	Authoritative bool `yaml:"authoritative,omitempty"`
+	// DNS are matched in order against the labels of the subnet leased from, the first match applies
+	DNS []OOBDNS `yaml:"dns,omitempty"`
+	// LeaseTimes are the defaults for subnets without lease time annotations
+	LeaseTimes *LeaseTimes `yaml:"leaseTimes,omitempty"`
+	// Links relates the IPs to the Endpoint of their MAC address
+	Links Links `yaml:"links,omitempty"`
+	// Timeout bounds the kubernetes calls of a request, including the waits for IPAM, defaults to 15s
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// ServerUnicast is the address DHCPv6 clients may send Requests, Renews and
+	// Releases to directly instead of through the relay, advertised in the
+	// Server Unicast option, disabled if empty
+	ServerUnicast string `yaml:"serverUnicast,omitempty"`
+	// Reservations are the critical clients whose addresses are reserved on startup
+	Reservations OOBReservations `yaml:"reservations,omitempty"`
+	// MessageTypes restrict the DHCPv4 message types leased for
+	MessageTypes OOBMessageTypes `yaml:"messageTypes,omitempty"`
+}
+
+func (c *OOBConfig) convert(version string) error {
+	if c.SubnetLabel == "" {
+		return nil
+	}
+	if !before(version, V1Alpha2) {
+		return fmt.Errorf("subnetLabel was dropped in %s, use subnetLabels", V1Alpha2)
+	}
+	key, value, ok := strings.Cut(c.SubnetLabel, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("invalid subnet label: %s, should be 'key=value'", c.SubnetLabel)
+	}
+	if other, ok := c.SubnetLabels[key]; ok && other != value {
+		return fmt.Errorf("subnet label %s conflicts with subnetLabels %s=%s", c.SubnetLabel, key, other)
+	}
+	if c.SubnetLabels == nil {
+		c.SubnetLabels = make(map[string]string, 1)
+	}
+	c.SubnetLabels[key] = value
+	c.SubnetLabel = ""
+	return nil
 }
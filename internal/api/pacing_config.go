@@ -0,0 +1,15 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+import "time"
+
+type PacingConfig struct {
+	TypeMeta `yaml:",inline"`
+
+	// Window is the maximum delay of a boot response, responses are spread evenly over it
+	Window time.Duration `yaml:"window"`
+	// Threshold is the number of boot responses within a window above which pacing starts, 0 paces always
+	Threshold int `yaml:"threshold,omitempty"`
+}
@@ -0,0 +1,30 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+import "time"
+
+type RadiusFailurePolicy string
+
+const (
+	// RadiusFailClosed drops messages if no RADIUS server answers
+	RadiusFailClosed RadiusFailurePolicy = "closed"
+	// RadiusFailOpen serves messages if no RADIUS server answers
+	RadiusFailOpen RadiusFailurePolicy = "open"
+)
+
+type RadiusConfig struct {
+	TypeMeta `yaml:",inline"`
+
+	// Servers are tried in order, the port defaults to 1812
+	Servers []string `yaml:"servers"`
+	// SecretFile holds the shared secret, a trailing newline is ignored
+	SecretFile string `yaml:"secretFile"`
+	// Timeout is the time to wait for a single server, defaults to 2s
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// FailurePolicy defines what happens if no server answers, defaults to closed
+	FailurePolicy RadiusFailurePolicy `yaml:"failurePolicy,omitempty"`
+	// NASIdentifier identifies FeDHCP to the RADIUS servers, defaults to fedhcp
+	NASIdentifier string `yaml:"nasIdentifier,omitempty"`
+}
@@ -0,0 +1,20 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+type RawOption struct {
+	Code uint16 `yaml:"code"`
+	// Hex is the payload as hex encoded bytes, Base64 as base64 encoded ones; exactly one of them shall be set
+	Hex    string `yaml:"hex,omitempty"`
+	Base64 string `yaml:"base64,omitempty"`
+	// WhenPresent restricts the option to requests carrying the option of this code
+	WhenPresent uint16 `yaml:"whenPresent,omitempty"`
+}
+
+type RawOptsConfig struct {
+	TypeMeta `yaml:",inline"`
+
+	// Options are added to all responses, in their order
+	Options []RawOption `yaml:"options"`
+}
@@ -0,0 +1,15 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+type RecorderConfig struct {
+	TypeMeta `yaml:",inline"`
+
+	// Namespace holds the subnets, the recorded IPs are created there
+	Namespace string `yaml:"namespace"`
+	// Subnets are the IPAM subnets addresses are recorded in, others are ignored
+	Subnets []string `yaml:"subnets"`
+	// Labels are added to the recorded IPs
+	Labels map[string]string `yaml:"labels,omitempty"`
+}
@@ -0,0 +1,13 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+type RelayFilterConfig struct {
+	TypeMeta `yaml:",inline"`
+
+	// Relays are the addresses or prefixes of the relay agents accepted, e.g. "10.0.0.0/8"
+	Relays []string `yaml:"relays"`
+	// Direct accepts messages from directly attached clients, i.e. non-relayed ones
+	Direct bool `yaml:"direct,omitempty"`
+}
@@ -0,0 +1,35 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+type Route struct {
+	Name string `yaml:"name"`
+	// OUIs are the MAC address prefixes of the route's clients, e.g. "52:54:00"
+	OUIs []string `yaml:"ouis,omitempty"`
+	// Classes are the fingerprint classes of the route's clients, e.g. "server-nic"
+	Classes []string `yaml:"classes,omitempty"`
+	// Racks are the racks of the metal-operator Servers of the route's clients
+	Racks []string `yaml:"racks,omitempty"`
+	// Pools are the pools of the metal-operator Servers of the route's clients
+	Pools []string `yaml:"pools,omitempty"`
+}
+
+type PlacementConfig struct {
+	// RackLabel is the Server label holding the rack, "rack" if empty
+	RackLabel string `yaml:"rackLabel,omitempty"`
+	// PoolLabel is the Server label holding the pool, "pool" if empty
+	PoolLabel string `yaml:"poolLabel,omitempty"`
+}
+
+type RouteConfig struct {
+	TypeMeta `yaml:",inline"`
+
+	// Routes are matched in order, the first one matching a client's OUI, class,
+	// rack or pool wins
+	Routes []Route `yaml:"routes"`
+	// Default is the route of the clients matching none, none if empty
+	Default string `yaml:"default,omitempty"`
+	// Placement configures how the racks and pools of the clients are looked up
+	Placement PlacementConfig `yaml:"placement,omitempty"`
+}
@@ -0,0 +1,210 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configs returns a new config per config file, named after the plugin, the
+// plugin argument or the flag reading it.
+var configs = map[string]func() any{
+	"beacon":        func() any { return &BeaconConfig{} },
+	"bluefield":     func() any { return &BluefieldConfig{} },
+	"bootp":         func() any { return &BootpConfig{} },
+	"bootparams":    func() any { return &BootParamsConfig{} },
+	"bootservers":   func() any { return &BootServersConfig{} },
+	"captiveportal": func() any { return &CaptivePortalConfig{} },
+	"capture":       func() any { return &CaptureConfig{} },
+	"chaos":         func() any { return &ChaosConfig{} },
+	"dnsendpoint":   func() any { return &DNSEndpointConfig{} },
+	"fqdn":          func() any { return &FQDNConfig{} },
+	"ipam":          func() any { return &IPAMConfig{} },
+	"leasetime":     func() any { return &LeaseTimeConfig{} },
+	"metal":         func() any { return &MetalConfig{} },
+	"onie":          func() any { return &ONIEConfig{} },
+	"onmetal":       func() any { return &OnMetalConfig{} },
+	"oob":           func() any { return &OOBConfig{} },
+	"pacing":        func() any { return &PacingConfig{} },
+	"radius":        func() any { return &RadiusConfig{} },
+	"rawopts":       func() any { return &RawOptsConfig{} },
+	"recorder":      func() any { return &RecorderConfig{} },
+	"relayfilter":   func() any { return &RelayFilterConfig{} },
+	"route":         func() any { return &RouteConfig{} },
+	"serverduid":    func() any { return &ServerDUIDConfig{} },
+	"standalone":    func() any { return &StandaloneConfig{} },
+	"syslog":        func() any { return &SyslogConfig{} },
+	"tenant":        func() any { return &TenantConfig{} },
+	"vendorclass":   func() any { return &VendorClassConfig{} },
+	"vendoropts":    func() any { return &VendorOptsConfig{} },
+	"ztp":           func() any { return &ZTPConfig{} },
+}
+
+// Kinds returns the names of the config files, sorted.
+func Kinds() []string {
+	kinds := make([]string, 0, len(configs))
+	for kind := range configs {
+		kinds = append(kinds, kind)
+	}
+	slices.Sort(kinds)
+	return kinds
+}
+
+// New returns a new config of the kind, a pointer to a plugin config.
+func New(kind string) (any, error) {
+	newConfig, ok := configs[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown config %s, should be one of %v", kind, Kinds())
+	}
+	return newConfig(), nil
+}
+
+// Check reads the config file at path into config like Load, but rejects
+// unknown fields, so that typos are not silently ignored.
+func Check(path string, config any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil {
+		return fmt.Errorf("failed to parse config file: %v", err)
+	}
+	return checkVersion(config)
+}
+
+var (
+	durationType = reflect.TypeFor[time.Duration]()
+	timeType     = reflect.TypeFor[time.Time]()
+)
+
+// Sample returns a sample of the config as YAML, holding every field of the
+// current layout with its zero value, one element per list and map, and a
+// comment describing its type. Fields tagged `deprecated:"true"` are left out.
+func Sample(config any) ([]byte, error) {
+	node := sampleNode(reflect.TypeOf(config))
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// describe returns the comment of a field of the type.
+func describe(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == durationType:
+		return "duration, e.g. 30s"
+	case t == timeType:
+		return "RFC 3339 time"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice:
+		return "list of " + describe(t.Elem())
+	case reflect.Map:
+		return "map of " + describe(t.Elem())
+	default:
+		return "object"
+	}
+}
+
+func scalar(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+}
+
+// sampleNode returns the sample of a value of the type.
+func sampleNode(t reflect.Type) *yaml.Node {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == durationType:
+		return scalar("0s")
+	case t == timeType:
+		return scalar(time.Time{}.Format(time.RFC3339))
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "", Style: yaml.DoubleQuotedStyle}
+	case reflect.Bool:
+		return scalar("false")
+	case reflect.Float32, reflect.Float64:
+		return scalar("0.0")
+	case reflect.Slice:
+		return &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{sampleNode(t.Elem())}}
+	case reflect.Map:
+		return &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{scalar("key"), sampleNode(t.Elem())}}
+	case reflect.Struct:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		sampleFields(t, node)
+		return node
+	default:
+		return scalar("0")
+	}
+}
+
+// sampleFields adds the samples of the fields of the struct type to the
+// mapping node, inline structs are flattened into it.
+func sampleFields(t reflect.Type, node *yaml.Node) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() || field.Tag.Get("deprecated") == "true" {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if slices.Contains(strings.Split(options, ","), "inline") {
+			sampleFields(field.Type, node)
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		key := scalar(name)
+		value := sampleNode(field.Type)
+		comment := describe(field.Type)
+		if slices.Contains(strings.Split(options, ","), "omitempty") {
+			comment += ", optional"
+		}
+		if t == reflect.TypeFor[TypeMeta]() && name == "apiVersion" {
+			value = scalar(Version)
+			comment = "layout of the config"
+		}
+		if value.Kind == yaml.ScalarNode {
+			value.LineComment = comment
+		} else {
+			key.LineComment = comment
+		}
+		node.Content = append(node.Content, key, value)
+	}
+}
@@ -0,0 +1,63 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSample(t *testing.T) {
+	for _, kind := range Kinds() {
+		config, err := New(kind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sample, err := Sample(config)
+		if err != nil {
+			t.Fatalf("%s: %v", kind, err)
+		}
+		if !strings.HasPrefix(string(sample), "apiVersion: "+Version) {
+			t.Errorf("%s: expected the sample to start with the current apiVersion, got %s", kind, sample)
+		}
+
+		// samples pass the check of their own kind
+		path := filepath.Join(t.TempDir(), kind+"_config.yaml")
+		if err := os.WriteFile(path, sample, 0644); err != nil {
+			t.Fatal(err)
+		}
+		config, _ = New(kind)
+		if err := Check(path, config); err != nil {
+			t.Errorf("%s: sample failed the check: %v\n%s", kind, err, sample)
+		}
+	}
+
+	if _, err := New("toaster"); err == nil {
+		t.Error("no error occurred for an unknown config, but it should have")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pacing_config.yaml")
+	if err := os.WriteFile(path, []byte("windw: 1m\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Load(path, &PacingConfig{}); err != nil {
+		t.Errorf("unexpected error loading a config with an unknown field: %v", err)
+	}
+	if err := Check(path, &PacingConfig{}); err == nil || !strings.Contains(err.Error(), "windw") {
+		t.Errorf("expected an error naming the unknown field, got %v", err)
+	}
+}
+
+func TestExamples(t *testing.T) {
+	for _, kind := range Kinds() {
+		config, _ := New(kind)
+		if err := Check(filepath.Join("..", "..", "example", kind+"_config.yaml"), config); err != nil {
+			t.Errorf("%s: example failed the check: %v", kind, err)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+type DUIDType string
+
+const (
+	DUIDTypeLL   DUIDType = "ll"
+	DUIDTypeUUID DUIDType = "uuid"
+)
+
+type DUIDStoreType string
+
+const (
+	DUIDStoreFile      DUIDStoreType = "file"
+	DUIDStoreConfigMap DUIDStoreType = "configmap"
+)
+
+type ServerDUIDConfig struct {
+	TypeMeta `yaml:",inline"`
+
+	Type      DUIDType      `yaml:"type"`
+	Interface string        `yaml:"interface,omitempty"`
+	Store     DUIDStoreType `yaml:"store"`
+	Path      string        `yaml:"path,omitempty"`
+	Namespace string        `yaml:"namespace,omitempty"`
+	Name      string        `yaml:"name,omitempty"`
+}
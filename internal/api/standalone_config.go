@@ -0,0 +1,23 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+// StandalonePlugin is a plugin entry of the standalone mode.
+type StandalonePlugin struct {
+	// Name is the name of the plugin, e.g. "oob"
+	Name string `yaml:"name"`
+	// Args are the arguments of the plugin, e.g. the path of its config file
+	Args []string `yaml:"args,omitempty"`
+	// Family restricts the entry to DHCPv4 (4) or DHCPv6 (6), both if 0
+	Family int `yaml:"family,omitempty"`
+}
+
+type StandaloneConfig struct {
+	TypeMeta `yaml:",inline"`
+
+	// Interfaces are the interfaces the clients are served on
+	Interfaces []string `yaml:"interfaces"`
+	// Plugins are run in order, a family is served if an entry is run for it
+	Plugins []StandalonePlugin `yaml:"plugins"`
+}
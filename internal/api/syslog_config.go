@@ -0,0 +1,17 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+type SyslogConfig struct {
+	TypeMeta `yaml:",inline"`
+
+	// Address of the collector, e.g. "siem.example.org:514"
+	Address string `yaml:"address"`
+	// Protocol is udp (default) or tcp
+	Protocol string `yaml:"protocol,omitempty"`
+	// Facility is one of kern, user, daemon, auth, authpriv or local0 to local7, defaults to local0
+	Facility string `yaml:"facility,omitempty"`
+	// AppName is the APP-NAME of the messages, defaults to fedhcp
+	AppName string `yaml:"appName,omitempty"`
+}
@@ -0,0 +1,27 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+// Tenant is an isolated environment served by its own plugin chain.
+type Tenant struct {
+	Name string `yaml:"name"`
+	// Relays are the addresses or prefixes of the relay agents of the tenant's
+	// networks, matched against the link address of the relay closest to a
+	// DHCPv6 client and the relay agent address of a DHCPv4 client
+	Relays []string `yaml:"relays,omitempty"`
+	// Direct assigns the directly attached, i.e. non-relayed, clients to the tenant
+	Direct bool `yaml:"direct,omitempty"`
+	// Namespace is the kubernetes namespace of the tenant, the namespaced
+	// plugins of its chain must use no other
+	Namespace string `yaml:"namespace"`
+	// Config is the path to the coredhcp config of the tenant's plugin chain
+	Config string `yaml:"config"`
+}
+
+type TenantConfig struct {
+	TypeMeta `yaml:",inline"`
+
+	// Tenants must not share relays, namespaces or the directly attached clients
+	Tenants []Tenant `yaml:"tenants"`
+}
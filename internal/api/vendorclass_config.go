@@ -0,0 +1,15 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+type VendorClassConfig struct {
+	TypeMeta `yaml:",inline"`
+
+	// Allow is a list of vendor class prefixes to serve, all others are dropped
+	Allow []string `yaml:"allow"`
+	// Deny is a list of vendor class prefixes to drop, it has precedence over Allow
+	Deny []string `yaml:"deny"`
+	// AllowUnclassified serves clients which do not send a vendor class at all
+	AllowUnclassified bool `yaml:"allowUnclassified"`
+}
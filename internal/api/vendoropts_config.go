@@ -0,0 +1,28 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+type VendorSubOption struct {
+	Code uint16 `yaml:"code"`
+	// Value is the suboption as text, Hex as hex encoded bytes; exactly one of them shall be set
+	Value string `yaml:"value,omitempty"`
+	Hex   string `yaml:"hex,omitempty"`
+}
+
+type VendorEnterprise struct {
+	// EnterpriseNumber is the IANA private enterprise number of the vendor
+	EnterpriseNumber uint32 `yaml:"enterpriseNumber"`
+	// VendorClasses are vendor class prefixes, one of them has to match the client's
+	// vendor class of the enterprise or, in DHCPv4, its class identifier (option 60);
+	// if empty, all clients identifying with the enterprise match
+	VendorClasses []string `yaml:"vendorClasses,omitempty"`
+	// Options are the vendor-specific suboptions sent to matching clients
+	Options []VendorSubOption `yaml:"options"`
+}
+
+type VendorOptsConfig struct {
+	TypeMeta `yaml:",inline"`
+
+	Enterprises []VendorEnterprise `yaml:"enterprises"`
+}
@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+import (
+	"fmt"
+	"slices"
+)
+
+// The layouts of the plugin configs, named by their apiVersion. A config
+// without apiVersion is of the first layout, so the configs written before the
+// layouts were versioned keep working.
+const (
+	Group = "fedhcp.ironcore.dev"
+	// V1Alpha1 is the first layout. Its deprecated fields are converted to
+	// the ones replacing them on load.
+	V1Alpha1 = Group + "/v1alpha1"
+	// V1Alpha2 drops the deprecated fields of V1Alpha1:
+	//   - oob: subnetLabel "key=value", replaced by the subnetLabels map
+	V1Alpha2 = Group + "/v1alpha2"
+	// Version is the current layout.
+	Version = V1Alpha2
+)
+
+// versions are the layouts this version of FeDHCP reads, oldest first.
+var versions = []string{V1Alpha1, V1Alpha2}
+
+// TypeMeta names the layout of a plugin config, every plugin config embeds it.
+type TypeMeta struct {
+	// APIVersion is the layout of the config, V1Alpha1 if empty
+	APIVersion string `yaml:"apiVersion,omitempty"`
+}
+
+func (m *TypeMeta) version() string {
+	if m.APIVersion == "" {
+		return V1Alpha1
+	}
+	return m.APIVersion
+}
+
+type versioned interface {
+	version() string
+}
+
+// converter is implemented by the configs whose layout changed. convert moves
+// the fields of an older layout to the ones replacing them, and rejects the
+// fields dropped by the layout of the config.
+type converter interface {
+	convert(version string) error
+}
+
+// checkVersion rejects configs of unknown layouts, e.g. of a newer FeDHCP
+// after a downgrade, and converts the supported ones to the current layout.
+func checkVersion(config any) error {
+	v, ok := config.(versioned)
+	if !ok {
+		return nil
+	}
+	version := v.version()
+	if !slices.Contains(versions, version) {
+		return fmt.Errorf("unsupported apiVersion %s, should be one of %v", version, versions)
+	}
+	if c, ok := config.(converter); ok {
+		if err := c.convert(version); err != nil {
+			return fmt.Errorf("invalid config of apiVersion %s: %w", version, err)
+		}
+	}
+	return nil
+}
+
+// before reports whether version is an older layout than other.
+func before(version, other string) bool {
+	return slices.Index(versions, version) < slices.Index(versions, other)
+}
@@ -0,0 +1,29 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package api
+
+type ZTPSwitch struct {
+	Name       string `yaml:"name,omitempty"`
+	MACAddress string `yaml:"macAddress"`
+	// Mode is the provisioning flow of the switch's NOS, "sonic", "onie" or
+	// "script" for a ZTP reading the TFTP server name and boot file only
+	Mode string `yaml:"mode"`
+	// URL is the ZTP JSON URL in SONiC mode, the installer URL in ONIE mode and
+	// the provisioning script URL in script mode
+	URL string `yaml:"url"`
+	// GraphURL is the URL of the graph service (minigraph) or config DB the switch
+	// loads its configuration from, SONiC mode only
+	GraphURL string `yaml:"graphURL,omitempty"`
+	// BootstrapServers are the HTTPS URIs of the SZTP bootstrap servers (RFC 8572)
+	BootstrapServers []string `yaml:"bootstrapServers,omitempty"`
+}
+
+type ZTPConfig struct {
+	TypeMeta `yaml:",inline"`
+
+	Switches []ZTPSwitch `yaml:"switches,omitempty"`
+	// Namespace holds the ConfigMaps of further switches, labeled with
+	// fedhcp.ironcore.dev/mac, see docs/plugins.md for their keys
+	Namespace string `yaml:"namespace,omitempty"`
+}
@@ -0,0 +1,240 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package bootoperator looks up the boot configurations the IronCore
+// boot-operator renders per machine, so that the boot plugins serve the image
+// URLs the operator intends instead of selecting images themselves.
+//
+// The operator derives an HTTPBootConfig and an IPXEBootConfig from each
+// ServerBootConfiguration, listing the machine's IP and MAC addresses as
+// identifiers. Appending "bootoperator=<namespace>" to the arguments of a boot
+// plugin entry makes it look up the ready configuration of a client in that
+// namespace. The CRDs are handled unstructured to not depend on boot-operator.
+package bootoperator
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/ironcore-dev/fedhcp/internal/relay"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ArgPrefix is the prefix of the plugin argument enabling the lookup.
+const ArgPrefix = "bootoperator="
+
+const stateReady = "Ready"
+
+// IdentifierField indexes the boot configurations by their normalized
+// identifiers.
+const IdentifierField = "spec.identifiers"
+
+var (
+	httpBootConfigListGVK = schema.GroupVersionKind{Group: "boot.ironcore.dev", Version: "v1alpha1", Kind: "HTTPBootConfigList"}
+	ipxeBootConfigListGVK = schema.GroupVersionKind{Group: "boot.ironcore.dev", Version: "v1alpha1", Kind: "IPXEBootConfigList"}
+)
+
+// Lookup finds the boot configurations of machines in a namespace.
+type Lookup struct {
+	namespace string
+}
+
+// ParseArgs extracts the boot-operator lookup from the plugin arguments and
+// returns the remaining ones, which are passed to the plugin. The lookup is nil
+// if it is not configured.
+func ParseArgs(args ...string) (*Lookup, []string, error) {
+	var lookup *Lookup
+	var rest []string
+	for _, arg := range args {
+		namespace, ok := strings.CutPrefix(arg, ArgPrefix)
+		if !ok {
+			rest = append(rest, arg)
+			continue
+		}
+		if lookup != nil {
+			return nil, nil, fmt.Errorf("boot-operator namespace given more than once")
+		}
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return nil, nil, fmt.Errorf("invalid boot-operator namespace %q: %s", namespace, strings.Join(errs, ", "))
+		}
+		lookup = &Lookup{namespace: namespace}
+	}
+	return lookup, rest, nil
+}
+
+// Namespace returns the namespace the boot configurations are looked up in.
+func (l *Lookup) Namespace() string { return l.namespace }
+
+// UKIURL returns the UKI URL of the ready HTTPBootConfig of the machine with
+// one of the identifiers, the empty string if there is none.
+func (l *Lookup) UKIURL(identifiers ...string) (string, error) {
+	return l.find(httpBootConfigListGVK, "ukiURL", identifiers)
+}
+
+// IPXEURL returns the iPXE server URL of the ready IPXEBootConfig of the machine
+// with one of the identifiers, the empty string if there is none.
+func (l *Lookup) IPXEURL(identifiers ...string) (string, error) {
+	return l.find(ipxeBootConfigListGVK, "ipxeServerURL", identifiers)
+}
+
+func (l *Lookup) find(gvk schema.GroupVersionKind, field string, identifiers []string) (string, error) {
+	wanted := make(map[string]bool, len(identifiers))
+	for _, id := range identifiers {
+		if id = normalize(id); id != "" {
+			wanted[id] = true
+		}
+	}
+	if len(wanted) == 0 {
+		return "", nil
+	}
+
+	items, err := l.list(gvk, wanted)
+	if err != nil {
+		return "", err
+	}
+	for _, item := range items {
+		if state, _, _ := unstructured.NestedString(item.Object, "status", "state"); state != stateReady {
+			continue
+		}
+		if !matches(item, wanted) {
+			continue
+		}
+		url, _, err := unstructured.NestedString(item.Object, "spec", field)
+		if err != nil || url == "" {
+			return "", fmt.Errorf("%s %s has no %s", itemGVK(gvk).Kind, item.GetName(), field)
+		}
+		return url, nil
+	}
+	return "", nil
+}
+
+// list returns the boot configurations of the list kind having one of the
+// wanted identifiers, looked up in the informer cache by identifier. Without a
+// cache, all configurations of the namespace are listed.
+func (l *Lookup) list(gvk schema.GroupVersionKind, wanted map[string]bool) ([]unstructured.Unstructured, error) {
+	ctx := context.Background()
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(itemGVK(gvk))
+
+	var items []unstructured.Unstructured
+	for _, id := range slices.Sorted(maps.Keys(wanted)) {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk)
+		cached, err := kubernetes.ListIndexed(ctx, obj, list, l.namespace, IdentifierField, id, identifiers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up %s: %w", gvk.Kind, err)
+		}
+		if !cached {
+			if err := kubernetes.GetClient().List(ctx, list, client.InNamespace(l.namespace)); err != nil {
+				return nil, fmt.Errorf("failed to list %s: %w", gvk.Kind, err)
+			}
+			return list.Items, nil
+		}
+		items = append(items, list.Items...)
+	}
+	return items, nil
+}
+
+// OnUKIChange calls f whenever an HTTPBootConfig changes, so that responses
+// holding a UKI URL can be invalidated.
+func (l *Lookup) OnUKIChange(f func()) error {
+	return l.onChange(httpBootConfigListGVK, f)
+}
+
+// OnIPXEChange calls f whenever an IPXEBootConfig changes, so that responses
+// holding an iPXE URL can be invalidated.
+func (l *Lookup) OnIPXEChange(f func()) error {
+	return l.onChange(ipxeBootConfigListGVK, f)
+}
+
+func (l *Lookup) onChange(gvk schema.GroupVersionKind, f func()) error {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(itemGVK(gvk))
+	if err := kubernetes.OnChange(kubernetes.Context(), obj, f); err != nil {
+		return fmt.Errorf("failed to watch %s: %w", obj.GetKind(), err)
+	}
+	return nil
+}
+
+// itemGVK returns the kind of the items of a list kind.
+func itemGVK(gvk schema.GroupVersionKind) schema.GroupVersionKind {
+	return gvk.GroupVersion().WithKind(strings.TrimSuffix(gvk.Kind, "List"))
+}
+
+// identifiers returns the normalized identifiers of a boot configuration, the
+// values of its index.
+func identifiers(obj client.Object) []string {
+	item, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil
+	}
+	var ids []string
+	for _, field := range []string{"systemIPs", "networkIdentifiers"} {
+		values, _, _ := unstructured.NestedStringSlice(item.Object, "spec", field)
+		for _, id := range values {
+			if id = normalize(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// matches reports whether one of the identifiers of a boot configuration is
+// wanted. Older boot-operator versions list them as systemIPs, newer ones as
+// networkIdentifiers.
+func matches(item unstructured.Unstructured, wanted map[string]bool) bool {
+	return slices.ContainsFunc(identifiers(&item), func(id string) bool { return wanted[id] })
+}
+
+// normalize returns the canonical form of an IP or MAC address identifier.
+func normalize(id string) string {
+	id = strings.TrimSpace(id)
+	if ip := net.ParseIP(id); ip != nil {
+		if ip.IsUnspecified() {
+			return ""
+		}
+		return ip.String()
+	}
+	if mac, err := net.ParseMAC(id); err == nil {
+		return mac.String()
+	}
+	return strings.ToLower(id)
+}
+
+// Identifiers4 returns the identifiers of a DHCPv4 client: its MAC address, its
+// current address and the address offered to it.
+func Identifiers4(req, resp *dhcpv4.DHCPv4) []string {
+	ids := []string{req.ClientHWAddr.String(), req.ClientIPAddr.String()}
+	if resp != nil {
+		ids = append(ids, resp.YourIPAddr.String())
+	}
+	return ids
+}
+
+// Identifiers6 returns the identifiers of a DHCPv6 client: its MAC address, if
+// the request is relayed, and the addresses offered to it.
+func Identifiers6(req, resp dhcpv6.DHCPv6) []string {
+	var ids []string
+	if mac, err := relay.ClientMAC(req); err == nil {
+		ids = append(ids, mac.String())
+	}
+	if reply, ok := resp.(*dhcpv6.Message); ok {
+		for _, iana := range reply.Options.IANA() {
+			for _, addr := range iana.Options.Addresses() {
+				ids = append(ids, addr.IPv6Addr.String())
+			}
+		}
+	}
+	return ids
+}
@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package bootoperator
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes/fake"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const namespace = "boot"
+
+// bootConfig returns a boot configuration of the kind with the spec and state.
+func bootConfig(kind, name, state string, spec map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec":   spec,
+		"status": map[string]interface{}{"state": state},
+	}}
+	obj.SetGroupVersionKind(httpBootConfigListGVK.GroupVersion().WithKind(kind))
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+func Init(t *testing.T, objects ...*unstructured.Unstructured) {
+	var cl client.Client = fake.NewClient()
+	for _, obj := range objects {
+		if err := cl.Create(context.Background(), obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	kubernetes.SetClient(&cl)
+	t.Cleanup(func() { kubernetes.SetClient(new(client.Client)) })
+}
+
+func TestParseArgs(t *testing.T) {
+	lookup, rest, err := ParseArgs("https://[2001:db8::1]/boot.uki", "bootoperator=boot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lookup == nil || lookup.Namespace() != namespace || len(rest) != 1 {
+		t.Errorf("expected a lookup in %s and one remaining argument, got %v and %v", namespace, lookup, rest)
+	}
+
+	if lookup, _, _ := ParseArgs("https://[2001:db8::1]/boot.uki"); lookup != nil {
+		t.Error("expected no lookup without argument")
+	}
+
+	for _, args := range [][]string{{"bootoperator=Boot"}, {"bootoperator="}, {"bootoperator=a", "bootoperator=b"}} {
+		if _, _, err := ParseArgs(args...); err == nil {
+			t.Errorf("no error occurred for %v, but it should have", args)
+		}
+	}
+}
+
+func TestUKIURL(t *testing.T) {
+	Init(t,
+		bootConfig("HTTPBootConfig", "server1", stateReady, map[string]interface{}{
+			"systemIPs": []interface{}{"2001:db8::100", "00:1A:2B:3C:4D:5E"},
+			"ukiURL":    "https://boot.example.org/server1.uki",
+		}),
+		bootConfig("HTTPBootConfig", "server2", stateReady, map[string]interface{}{
+			"networkIdentifiers": []interface{}{"192.168.2.100"},
+			"ukiURL":             "https://boot.example.org/server2.uki",
+		}),
+		bootConfig("HTTPBootConfig", "server3", "Pending", map[string]interface{}{
+			"systemIPs": []interface{}{"192.168.2.101"},
+			"ukiURL":    "https://boot.example.org/server3.uki",
+		}),
+	)
+	lookup := &Lookup{namespace: namespace}
+
+	for ids, expected := range map[[2]string]string{
+		{"00:1a:2b:3c:4d:5e", ""}:         "https://boot.example.org/server1.uki",
+		{"2001:0db8::0100", ""}:           "https://boot.example.org/server1.uki",
+		{"0.0.0.0", "192.168.2.100"}:      "https://boot.example.org/server2.uki",
+		{"192.168.2.101", ""}:             "",
+		{"00:1a:2b:3c:4d:5f", "10.0.0.1"}: "",
+	} {
+		url, err := lookup.UKIURL(ids[:]...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if url != expected {
+			t.Errorf("expected UKI URL %q for %v, got %q", expected, ids, url)
+		}
+	}
+}
+
+func TestIPXEURL(t *testing.T) {
+	Init(t, bootConfig("IPXEBootConfig", "server1", stateReady, map[string]interface{}{
+		"systemIPs":     []interface{}{"192.168.2.100"},
+		"ipxeServerURL": "http://boot.example.org/ipxe",
+	}))
+	lookup := &Lookup{namespace: namespace}
+
+	req, _ := dhcpv4.NewDiscovery(net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e})
+	resp, _ := dhcpv4.NewReplyFromRequest(req, dhcpv4.WithYourIP(net.IPv4(192, 168, 2, 100)))
+	url, err := lookup.IPXEURL(Identifiers4(req, resp)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "http://boot.example.org/ipxe" {
+		t.Errorf("expected the iPXE URL of the offered address, got %q", url)
+	}
+}
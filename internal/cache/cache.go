@@ -0,0 +1,198 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package cache provides a memory-bounded key/value store for per-client state.
+// Entries are evicted least recently used first once the capacity is reached,
+// and optionally expire a fixed time after they were stored. Evictions and
+// sizes are exposed as metrics labeled with the cache name.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/ironcore-dev/fedhcp/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	reasonCapacity = "capacity"
+	reasonExpired  = "expired"
+)
+
+var (
+	evictions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "cache",
+		Name:      "evictions_total",
+		Help:      "Number of entries evicted from a cache, by reason.",
+	}, []string{"cache", "reason"})
+	entries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "cache",
+		Name:      "entries",
+		Help:      "Number of entries of a cache.",
+	}, []string{"cache"})
+	once sync.Once
+)
+
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// Cache is a concurrency-safe LRU cache with an optional TTL per entry.
+type Cache[K comparable, V any] struct {
+	name     string
+	capacity int
+	ttl      time.Duration
+	onEvict  func(K, V)
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[K]*list.Element
+	now   func() time.Time
+}
+
+// New returns an empty cache holding at most capacity entries, which expire
+// ttl after they were stored; a ttl of 0 disables expiry. The name labels the
+// metrics, it shall be unique, e.g. the plugin instance.
+func New[K comparable, V any](name string, capacity int, ttl time.Duration) *Cache[K, V] {
+	if capacity <= 0 {
+		panic("cache capacity must be positive")
+	}
+	once.Do(func() {
+		metrics.Register(evictions, entries)
+	})
+	return &Cache[K, V]{
+		name:     name,
+		capacity: capacity,
+		ttl:      ttl,
+		ll:       list.New(),
+		items:    make(map[K]*list.Element),
+		now:      time.Now,
+	}
+}
+
+// OnEvict sets a function called for each entry evicted due to capacity or
+// expiry, but not for deleted or replaced ones. It is called with the cache
+// locked, so it must not use the cache.
+func (c *Cache[K, V]) OnEvict(f func(K, V)) *Cache[K, V] {
+	c.onEvict = f
+	return c
+}
+
+func (c *Cache[K, V]) expired(e *entry[K, V], now time.Time) bool {
+	return c.ttl > 0 && now.After(e.expires)
+}
+
+// remove removes the element, c.mu must be held.
+func (c *Cache[K, V]) remove(elem *list.Element, reason string) {
+	e := c.ll.Remove(elem).(*entry[K, V])
+	delete(c.items, e.key)
+	if reason != "" {
+		evictions.WithLabelValues(c.name, reason).Inc()
+		if c.onEvict != nil {
+			c.onEvict(e.key, e.value)
+		}
+	}
+	entries.WithLabelValues(c.name).Set(float64(len(c.items)))
+}
+
+// Get returns the value for key, if present and not expired, and marks it as
+// recently used.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	elem, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+	e := elem.Value.(*entry[K, V])
+	if c.expired(e, c.now()) {
+		c.remove(elem, reasonExpired)
+		return zero, false
+	}
+	c.ll.MoveToFront(elem)
+	return e.value, true
+}
+
+// Put stores the value for key, replacing any previous entry. If the cache
+// is full, expired entries and then the least recently used one are evicted.
+func (c *Cache[K, V]) Put(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if elem, ok := c.items[key]; ok {
+		e := elem.Value.(*entry[K, V])
+		e.value, e.expires = value, now.Add(c.ttl)
+		c.ll.MoveToFront(elem)
+		return
+	}
+
+	if len(c.items) >= c.capacity {
+		for elem := c.ll.Back(); elem != nil; {
+			prev := elem.Prev()
+			if c.expired(elem.Value.(*entry[K, V]), now) {
+				c.remove(elem, reasonExpired)
+			}
+			elem = prev
+		}
+	}
+	if len(c.items) >= c.capacity {
+		c.remove(c.ll.Back(), reasonCapacity)
+	}
+
+	c.items[key] = c.ll.PushFront(&entry[K, V]{key: key, value: value, expires: now.Add(c.ttl)})
+	entries.WithLabelValues(c.name).Set(float64(len(c.items)))
+}
+
+// Delete removes the entry for key, if present.
+func (c *Cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.remove(elem, "")
+	}
+}
+
+// Clear removes all entries.
+func (c *Cache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for elem := c.ll.Front(); elem != nil; elem = c.ll.Front() {
+		c.remove(elem, "")
+	}
+}
+
+// Len returns the number of entries, including expired ones not evicted yet.
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items)
+}
+
+// Range calls f for each entry not expired, most recently used first, until f
+// returns false. It is called with the cache locked, so f must not use the cache.
+func (c *Cache[K, V]) Range(f func(K, V) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for elem := c.ll.Front(); elem != nil; elem = elem.Next() {
+		e := elem.Value.(*entry[K, V])
+		if c.expired(e, now) {
+			continue
+		}
+		if !f(e.key, e.value) {
+			return
+		}
+	}
+}
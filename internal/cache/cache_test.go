@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLRU(t *testing.T) {
+	var evicted []string
+	c := New[string, int]("test-lru", 2, 0).OnEvict(func(k string, _ int) {
+		evicted = append(evicted, k)
+	})
+
+	c.Put("a", 1)
+	c.Put("b", 2)
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("expected a to be cached")
+	}
+	// b is the least recently used entry now
+	c.Put("c", 3)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Errorf("expected a=1, got %d (%t)", v, ok)
+	}
+	if c.Len() != 2 {
+		t.Errorf("expected 2 entries, got %d", c.Len())
+	}
+	if len(evicted) != 1 || evicted[0] != "b" {
+		t.Errorf("expected b to be evicted, got %v", evicted)
+	}
+	if n := testutil.ToFloat64(evictions.WithLabelValues("test-lru", reasonCapacity)); n != 1 {
+		t.Errorf("expected 1 capacity eviction, got %v", n)
+	}
+	if n := testutil.ToFloat64(entries.WithLabelValues("test-lru")); n != 2 {
+		t.Errorf("expected 2 entries, got %v", n)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	c := New[string, int]("test-ttl", 2, time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.Put("a", 1)
+	now = now.Add(30 * time.Second)
+	c.Put("b", 2)
+	now = now.Add(45 * time.Second)
+
+	if _, ok := c.Get("a"); ok {
+		t.Error("expected a to be expired")
+	}
+	var keys []string
+	c.Range(func(k string, _ int) bool {
+		keys = append(keys, k)
+		return true
+	})
+	if len(keys) != 1 || keys[0] != "b" {
+		t.Errorf("expected only b, got %v", keys)
+	}
+
+	// b is expired by now, so it is evicted instead of c
+	now = now.Add(time.Minute)
+	c.Put("c", 3)
+	c.Put("d", 4)
+	if _, ok := c.Get("c"); !ok {
+		t.Error("expected c to be cached")
+	}
+	if n := testutil.ToFloat64(evictions.WithLabelValues("test-ttl", reasonExpired)); n != 2 {
+		t.Errorf("expected 2 expired evictions, got %v", n)
+	}
+}
+
+func TestReplaceDeleteAndClear(t *testing.T) {
+	evicted := 0
+	c := New[string, int]("test-delete", 2, 0).OnEvict(func(string, int) { evicted++ })
+
+	c.Put("a", 1)
+	c.Put("a", 2)
+	if v, _ := c.Get("a"); v != 2 {
+		t.Errorf("expected a=2, got %d", v)
+	}
+	c.Delete("a")
+	if c.Len() != 0 {
+		t.Errorf("expected no entries, got %d", c.Len())
+	}
+	c.Put("a", 1)
+	c.Put("b", 2)
+	c.Clear()
+	if _, ok := c.Get("b"); ok || c.Len() != 0 {
+		t.Errorf("expected no entries after clearing, got %d", c.Len())
+	}
+	if evicted != 0 {
+		t.Errorf("replaced, deleted and cleared entries must not count as evicted, got %d", evicted)
+	}
+}
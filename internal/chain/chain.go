@@ -0,0 +1,127 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package chain controls whether a plugin entry breaks the plugin chain.
+//
+// By convention a plugin returns (resp, false) when it has handled a message,
+// so the following plugins may add their options, and (nil, true) when it
+// drops the message. Appending "chain=stop" to the arguments of a plugin entry
+// makes it break the chain after handling a message, "chain=continue" makes it
+// pass the message on even if the plugin itself would stop. Dropped messages
+// always break the chain.
+package chain
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+const argPrefix = "chain="
+
+// Mode is the chain behavior of a plugin entry.
+type Mode string
+
+const (
+	// Default keeps the behavior of the plugin.
+	Default  Mode = ""
+	Stop     Mode = "stop"
+	Continue Mode = "continue"
+)
+
+// ParseArgs extracts the chain mode from the plugin arguments and returns the
+// remaining ones, which are passed to the plugin.
+func ParseArgs(args ...string) (Mode, []string, error) {
+	mode := Default
+	var rest []string
+	for _, arg := range args {
+		value, ok := strings.CutPrefix(arg, argPrefix)
+		if !ok {
+			rest = append(rest, arg)
+			continue
+		}
+		if mode != Default {
+			return Default, nil, fmt.Errorf("chain mode given more than once")
+		}
+		switch Mode(value) {
+		case Stop, Continue:
+			mode = Mode(value)
+		default:
+			return Default, nil, fmt.Errorf("unknown chain mode %s, should be %s or %s", value, Stop, Continue)
+		}
+	}
+	return mode, rest, nil
+}
+
+// stop returns the stop flag of a handled message.
+func (m Mode) stop(handled bool, stop bool) bool {
+	if !handled {
+		return true
+	}
+	switch m {
+	case Stop:
+		return true
+	case Continue:
+		return false
+	default:
+		return stop
+	}
+}
+
+// Wrap4 applies the chain mode to a DHCPv4 handler.
+func (m Mode) Wrap4(h handler.Handler4) handler.Handler4 {
+	if m == Default {
+		return h
+	}
+	return func(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+		resp, stop := h(req, resp)
+		return resp, m.stop(resp != nil, stop)
+	}
+}
+
+// Wrap6 applies the chain mode to a DHCPv6 handler.
+func (m Mode) Wrap6(h handler.Handler6) handler.Handler6 {
+	if m == Default {
+		return h
+	}
+	return func(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+		resp, stop := h(req, resp)
+		return resp, m.stop(resp != nil, stop)
+	}
+}
+
+// Wrap returns a copy of the plugin, whose entries accept a chain mode argument.
+func Wrap(p *plugins.Plugin) *plugins.Plugin {
+	wrapped := &plugins.Plugin{Name: p.Name}
+	if p.Setup4 != nil {
+		wrapped.Setup4 = func(args ...string) (handler.Handler4, error) {
+			mode, rest, err := ParseArgs(args...)
+			if err != nil {
+				return nil, fmt.Errorf("plugin %s: %w", p.Name, err)
+			}
+			h, err := p.Setup4(rest...)
+			if err != nil {
+				return nil, err
+			}
+			return mode.Wrap4(h), nil
+		}
+	}
+	if p.Setup6 != nil {
+		wrapped.Setup6 = func(args ...string) (handler.Handler6, error) {
+			mode, rest, err := ParseArgs(args...)
+			if err != nil {
+				return nil, fmt.Errorf("plugin %s: %w", p.Name, err)
+			}
+			h, err := p.Setup6(rest...)
+			if err != nil {
+				return nil, err
+			}
+			return mode.Wrap6(h), nil
+		}
+	}
+	return wrapped
+}
@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package chain
+
+import (
+	"testing"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+// testPlugin handles a message, returning the given stop flag, or drops it
+// if the first argument is "drop".
+var testPlugin = plugins.Plugin{
+	Name: "test",
+	Setup4: func(args ...string) (handler.Handler4, error) {
+		return func(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+			if len(args) > 0 && args[0] == "drop" {
+				return nil, true
+			}
+			return resp, len(args) > 0 && args[0] == "stop"
+		}, nil
+	},
+	Setup6: func(args ...string) (handler.Handler6, error) {
+		return func(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+			if len(args) > 0 && args[0] == "drop" {
+				return nil, true
+			}
+			return resp, len(args) > 0 && args[0] == "stop"
+		}, nil
+	},
+}
+
+func TestWrongArgs(t *testing.T) {
+	for _, args := range [][]string{
+		{"chain=foo"},
+		{"chain=stop", "chain=continue"},
+		{"chain="},
+	} {
+		if _, _, err := ParseArgs(args...); err == nil {
+			t.Fatalf("no error occurred when parsing %v, but it should have", args)
+		}
+		if _, err := Wrap(&testPlugin).Setup4(args...); err == nil {
+			t.Fatalf("no error occurred when setting up a plugin with %v, but it should have", args)
+		}
+	}
+}
+
+func TestArgsPassed(t *testing.T) {
+	mode, rest, err := ParseArgs("foo", "chain=stop", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode != Stop {
+		t.Errorf("expected mode %s, got %s", Stop, mode)
+	}
+	if len(rest) != 2 || rest[0] != "foo" || rest[1] != "bar" {
+		t.Errorf("expected remaining args [foo bar], got %v", rest)
+	}
+}
+
+func TestChainSemantics(t *testing.T) {
+	for _, tc := range []struct {
+		args         []string
+		handled      bool
+		expectedStop bool
+	}{
+		{nil, true, false},
+		{[]string{"stop"}, true, true},
+		{[]string{"drop"}, false, true},
+		{[]string{"chain=stop"}, true, true},
+		{[]string{"stop", "chain=continue"}, true, false},
+		{[]string{"drop", "chain=continue"}, false, true},
+		{[]string{"chain=continue"}, true, false},
+	} {
+		p := Wrap(&testPlugin)
+
+		h4, err := p.Setup4(tc.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req4, err := dhcpv4.NewDiscovery(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp4, stop := h4(req4, req4)
+		if (resp4 != nil) != tc.handled || stop != tc.expectedStop {
+			t.Errorf("DHCPv4 %v: expected handled %t and stop %t, got %t and %t",
+				tc.args, tc.handled, tc.expectedStop, resp4 != nil, stop)
+		}
+
+		h6, err := p.Setup6(tc.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req6, err := dhcpv6.NewMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp6, stop := h6(req6, req6)
+		if (resp6 != nil) != tc.handled || stop != tc.expectedStop {
+			t.Errorf("DHCPv6 %v: expected handled %t and stop %t, got %t and %t",
+				tc.args, tc.handled, tc.expectedStop, resp6 != nil, stop)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package chaos holds the faults injected to test how clients and the
+// provisioning pipeline behave under degraded DHCP service. Faults are only
+// injected if the chaos plugin is configured, per instance of it; they can be
+// changed at runtime via the admin API.
+package chaos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ironcore-dev/fedhcp/internal/admin"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// Faults describes the faults to inject.
+type Faults struct {
+	// DropPercent is the percentage of responses to drop.
+	DropPercent int
+	// K8sDelay is the delay added to each kubernetes API call.
+	K8sDelay time.Duration
+	// CorruptOption is the code of the response option to corrupt, 0 disables corruption.
+	CorruptOption uint16
+}
+
+type faultsJSON struct {
+	DropPercent   int    `json:"dropPercent"`
+	K8sDelay      string `json:"k8sDelay"`
+	CorruptOption uint16 `json:"corruptOption"`
+}
+
+func (f Faults) MarshalJSON() ([]byte, error) {
+	return json.Marshal(faultsJSON{
+		DropPercent:   f.DropPercent,
+		K8sDelay:      f.K8sDelay.String(),
+		CorruptOption: f.CorruptOption,
+	})
+}
+
+func (f *Faults) UnmarshalJSON(data []byte) error {
+	var fj faultsJSON
+	if err := json.Unmarshal(data, &fj); err != nil {
+		return err
+	}
+
+	var delay time.Duration
+	if fj.K8sDelay != "" {
+		var err error
+		if delay, err = time.ParseDuration(fj.K8sDelay); err != nil {
+			return fmt.Errorf("invalid k8sDelay: %w", err)
+		}
+	}
+
+	*f = Faults{DropPercent: fj.DropPercent, K8sDelay: delay, CorruptOption: fj.CorruptOption}
+	return nil
+}
+
+// Validate checks the faults for sane values.
+func (f Faults) Validate() error {
+	if f.DropPercent < 0 || f.DropPercent > 100 {
+		return fmt.Errorf("drop percentage must be between 0 and 100, got %d", f.DropPercent)
+	}
+	if f.K8sDelay < 0 {
+		return fmt.Errorf("kubernetes delay must not be negative, got %s", f.K8sDelay)
+	}
+	return nil
+}
+
+// Injector injects the faults of a chaos plugin instance.
+type Injector struct {
+	name   string
+	mu     sync.RWMutex
+	faults Faults
+}
+
+var (
+	// mu guards injectors
+	mu        sync.RWMutex
+	injectors []*Injector
+	register  sync.Once
+)
+
+// New returns the injector of the named plugin instance with the given faults
+// and registers the chaos endpoint on the admin API.
+func New(name string, f Faults) (*Injector, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+
+	i := &Injector{name: name, faults: f}
+	mu.Lock()
+	injectors = append(injectors, i)
+	mu.Unlock()
+
+	register.Do(func() {
+		admin.Handle("/chaos", http.HandlerFunc(serveHTTP))
+	})
+	return i, nil
+}
+
+// Faults returns the faults currently injected by the instance.
+func (i *Injector) Faults() Faults {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.faults
+}
+
+func (i *Injector) set(f Faults) {
+	i.mu.Lock()
+	i.faults = f
+	i.mu.Unlock()
+}
+
+// ShouldDrop reports whether the current response shall be dropped.
+func (i *Injector) ShouldDrop() bool {
+	f := i.Faults()
+	return f.DropPercent > 0 && rand.IntN(100) < f.DropPercent
+}
+
+// CorruptData returns random bytes of the given length.
+func CorruptData(length int) []byte {
+	data := make([]byte, length)
+	for i := range data {
+		data[i] = byte(rand.UintN(256))
+	}
+	return data
+}
+
+// k8sDelay returns the kubernetes delay, the longest of all instances. The
+// calls of the plugins are not attributed to an instance, so one delay
+// applies to all of them.
+func k8sDelay() time.Duration {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	var delay time.Duration
+	for _, i := range injectors {
+		delay = max(delay, i.Faults().K8sDelay)
+	}
+	return delay
+}
+
+// Delay blocks for the kubernetes delay, if a chaos plugin is configured. It
+// is called by the lookups not served by a client of WrapClient, e.g. those
+// of the informer cache.
+func Delay(ctx context.Context) {
+	delay := k8sDelay()
+	if delay == 0 {
+		return
+	}
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+	}
+}
+
+// WrapClient returns a client delaying each call by the kubernetes delay. As
+// long as no chaos plugin is configured, calls are passed through.
+func WrapClient(c client.WithWatch) client.WithWatch {
+	return interceptor.NewClient(c, interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			Delay(ctx)
+			return c.Get(ctx, key, obj, opts...)
+		},
+		List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			Delay(ctx)
+			return c.List(ctx, list, opts...)
+		},
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			Delay(ctx)
+			return c.Create(ctx, obj, opts...)
+		},
+		Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+			Delay(ctx)
+			return c.Update(ctx, obj, opts...)
+		},
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			Delay(ctx)
+			return c.Patch(ctx, obj, patch, opts...)
+		},
+		Delete: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+			Delay(ctx)
+			return c.Delete(ctx, obj, opts...)
+		},
+	})
+}
+
+// selectInjectors returns the injectors the request is aimed at, all of them
+// unless an instance is given. mu must be held.
+func selectInjectors(r *http.Request) ([]*Injector, error) {
+	name := r.URL.Query().Get("instance")
+	if name == "" {
+		return injectors, nil
+	}
+	for _, i := range injectors {
+		if i.name == name {
+			return []*Injector{i}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown instance %s", name)
+}
+
+// serveHTTP returns the current faults of the instances on GET and replaces
+// them on PUT. With several instances running, a replacement must name its
+// instance.
+func serveHTTP(w http.ResponseWriter, r *http.Request) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	selected, err := selectInjectors(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		if len(selected) > 1 {
+			http.Error(w, fmt.Sprintf("%d instances are running, the instance to replace must be given", len(selected)), http.StatusBadRequest)
+			return
+		}
+		var f Faults
+		if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := f.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, i := range selected {
+			i.set(f)
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	faults := make(map[string]Faults, len(selected))
+	for _, i := range selected {
+		faults[i.name] = i.Faults()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(faults)
+}
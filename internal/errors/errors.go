@@ -0,0 +1,176 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package errors provides the error types shared by the plugins. They allow
+// handlers, logs and metrics to tell retryable infrastructure failures apart
+// from problems that persist until the configuration is changed.
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Kinds of errors as reported by Kind.
+const (
+	KindConfig              = "config"
+	KindK8sUnavailable      = "k8s_unavailable"
+	KindNoSubnetMatch       = "no_subnet_match"
+	KindAllocationExhausted = "allocation_exhausted"
+	KindReservationPending  = "reservation_pending"
+	KindUnknown             = "unknown"
+)
+
+// ConfigError is returned when a plugin configuration is missing or invalid.
+// It is terminal: retrying will not help until the configuration is fixed.
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid configuration: %v", e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// K8sUnavailable is returned when the kubernetes API cannot be reached or
+// fails to serve a request. It is retryable.
+type K8sUnavailable struct {
+	Err error
+}
+
+func (e *K8sUnavailable) Error() string {
+	return fmt.Sprintf("kubernetes API unavailable: %v", e.Err)
+}
+
+func (e *K8sUnavailable) Unwrap() error {
+	return e.Err
+}
+
+// NoSubnetMatch is returned when no configured subnet contains the address
+// used for subnet detection. It is terminal.
+type NoSubnetMatch struct {
+	IP net.IP
+}
+
+func (e *NoSubnetMatch) Error() string {
+	return fmt.Sprintf("no matching subnet found for IP %s", e.IP)
+}
+
+// AllocationExhausted is returned when a subnet has no address left to lease.
+// It is retryable, as addresses might be released in the meantime.
+type AllocationExhausted struct {
+	Subnet string
+	Err    error
+}
+
+func (e *AllocationExhausted) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("no address left to allocate in subnet %s", e.Subnet)
+	}
+	return fmt.Sprintf("no address left to allocate in subnet %s: %v", e.Subnet, e.Err)
+}
+
+func (e *AllocationExhausted) Unwrap() error {
+	return e.Err
+}
+
+// ReservationPending is returned when an IP exists but no address has been
+// reserved for it yet. It is retryable, as IPAM may reserve it in the meantime.
+type ReservationPending struct {
+	Subnet string
+	Name   string
+}
+
+func (e *ReservationPending) Error() string {
+	return fmt.Sprintf("no address reserved yet for IP %s in subnet %s", e.Name, e.Subnet)
+}
+
+// UpToDate is returned when an object to apply already holds the desired
+// state, so that nothing was written. It reports no failure.
+type UpToDate struct {
+	Kind string
+	Name string
+}
+
+func (e *UpToDate) Error() string {
+	return fmt.Sprintf("%s %s is up to date", e.Kind, e.Name)
+}
+
+// IsUpToDate reports whether err is caused by an object being up to date.
+func IsUpToDate(err error) bool {
+	var upToDate *UpToDate
+	return errors.As(err, &upToDate)
+}
+
+// FromK8s classifies an error returned by a kubernetes client. Errors caused
+// by an unreachable or overloaded API server are wrapped in K8sUnavailable,
+// all others are returned as is.
+func FromK8s(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var netErr net.Error
+	if apierrors.IsServerTimeout(err) ||
+		apierrors.IsTimeout(err) ||
+		apierrors.IsServiceUnavailable(err) ||
+		apierrors.IsTooManyRequests(err) ||
+		apierrors.IsInternalError(err) ||
+		apierrors.IsUnexpectedServerError(err) ||
+		errors.As(err, &netErr) {
+		return &K8sUnavailable{Err: err}
+	}
+	return err
+}
+
+// Kind returns the kind of the first typed error in err's chain, or KindUnknown.
+func Kind(err error) string {
+	var (
+		configErr    *ConfigError
+		k8sErr       *K8sUnavailable
+		noSubnetErr  *NoSubnetMatch
+		exhaustedErr *AllocationExhausted
+		pendingErr   *ReservationPending
+	)
+
+	switch {
+	case errors.As(err, &configErr):
+		return KindConfig
+	case errors.As(err, &k8sErr):
+		return KindK8sUnavailable
+	case errors.As(err, &noSubnetErr):
+		return KindNoSubnetMatch
+	case errors.As(err, &exhaustedErr):
+		return KindAllocationExhausted
+	case errors.As(err, &pendingErr):
+		return KindReservationPending
+	default:
+		return KindUnknown
+	}
+}
+
+// IsRetryable reports whether err is caused by a transient failure, so that a
+// retransmission of the same request may succeed.
+func IsRetryable(err error) bool {
+	switch Kind(err) {
+	case KindK8sUnavailable, KindAllocationExhausted, KindReservationPending:
+		return true
+	default:
+		return false
+	}
+}
+
+// Fields returns the log fields describing err's classification.
+func Fields(err error) logrus.Fields {
+	return logrus.Fields{
+		"errorKind": Kind(err),
+		"retryable": IsRetryable(err),
+	}
+}
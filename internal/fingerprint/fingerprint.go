@@ -0,0 +1,129 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package fingerprint classifies DHCP clients by the options they request and
+// the vendor class they send. The classification is matched against a bundled
+// fingerprint database.
+package fingerprint
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"gopkg.in/yaml.v3"
+)
+
+type Class string
+
+const (
+	ClassBMC       Class = "bmc"
+	ClassSwitch    Class = "switch"
+	ClassServerNIC Class = "server-nic"
+	ClassLaptop    Class = "laptop"
+	ClassUnknown   Class = "unknown"
+)
+
+// Classes are all classes a client can be classified as.
+var Classes = []Class{ClassBMC, ClassSwitch, ClassServerNIC, ClassLaptop, ClassUnknown}
+
+// Result is the outcome of a classification. Hash identifies the fingerprint,
+// it is short enough to be used as a label value.
+type Result struct {
+	Class Class
+	Hash  string
+}
+
+type entry struct {
+	Class               Class    `yaml:"class"`
+	VendorClassPrefixes []string `yaml:"vendorClassPrefixes"`
+	RequestedOptions    []string `yaml:"requestedOptions"`
+}
+
+type database struct {
+	Fingerprints []entry `yaml:"fingerprints"`
+}
+
+//go:embed fingerprints.yaml
+var bundled []byte
+
+var db = mustLoad(bundled)
+
+func mustLoad(data []byte) database {
+	var d database
+	if err := yaml.Unmarshal(data, &d); err != nil {
+		panic(fmt.Sprintf("invalid bundled fingerprint database: %v", err))
+	}
+	return d
+}
+
+// Classify4 classifies a DHCPv4 client by its parameter request list and class identifier.
+func Classify4(req *dhcpv4.DHCPv4) Result {
+	codes := make([]string, 0, len(req.ParameterRequestList()))
+	for _, code := range req.ParameterRequestList() {
+		codes = append(codes, strconv.Itoa(int(code.Code())))
+	}
+	return classify(strings.Join(codes, ","), []string{req.ClassIdentifier()})
+}
+
+// Classify6 classifies a (possibly relayed) DHCPv6 client by its option
+// request option and vendor class.
+func Classify6(req dhcpv6.DHCPv6) (Result, error) {
+	m, err := req.GetInnerMessage()
+	if err != nil {
+		return Result{}, fmt.Errorf("could not decapsulate request: %w", err)
+	}
+
+	codes := make([]string, 0, len(m.Options.RequestedOptions()))
+	for _, code := range m.Options.RequestedOptions() {
+		codes = append(codes, strconv.Itoa(int(code)))
+	}
+
+	var vendorClasses []string
+	for _, vc := range m.Options.VendorClasses() {
+		for _, data := range vc.Data {
+			vendorClasses = append(vendorClasses, string(data))
+		}
+	}
+	return classify(strings.Join(codes, ","), vendorClasses), nil
+}
+
+func classify(requestedOptions string, vendorClasses []string) Result {
+	sum := sha256.Sum256([]byte(requestedOptions + "|" + strings.Join(vendorClasses, ",")))
+	result := Result{Class: ClassUnknown, Hash: hex.EncodeToString(sum[:8])}
+
+	for _, e := range db.Fingerprints {
+		if e.matches(requestedOptions, vendorClasses) {
+			result.Class = e.Class
+			break
+		}
+	}
+	return result
+}
+
+func (e entry) matches(requestedOptions string, vendorClasses []string) bool {
+	for _, vc := range vendorClasses {
+		if vc == "" {
+			continue
+		}
+		for _, prefix := range e.VendorClassPrefixes {
+			if strings.HasPrefix(vc, prefix) {
+				return true
+			}
+		}
+	}
+	if requestedOptions == "" {
+		return false
+	}
+	for _, ro := range e.RequestedOptions {
+		if ro == requestedOptions {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package fingerprint
+
+import (
+	"net"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+var mac = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+
+func TestMatches(t *testing.T) {
+	e := entry{
+		Class:               ClassBMC,
+		VendorClassPrefixes: []string{"iDRAC", "iLO"},
+		RequestedOptions:    []string{"1,3,6,12,15,28,42"},
+	}
+
+	for _, tc := range []struct {
+		name             string
+		requestedOptions string
+		vendorClasses    []string
+		expected         bool
+	}{
+		{"requested options", "1,3,6,12,15,28,42", nil, true},
+		// the options are matched in the order the client requests them
+		{"requested options reordered", "1,3,6,12,15,42,28", nil, false},
+		{"requested options prefix", "1,3,6,12,15,28", nil, false},
+		{"vendor class prefix", "", []string{"iDRAC9"}, true},
+		{"vendor class prefix of another class", "", []string{"HPE iLO 5"}, false},
+		{"vendor class prefix after others", "", []string{"", "foo", "iLO 6"}, true},
+		{"vendor class containing prefix", "", []string{"Dell iDRAC"}, false},
+		{"empty vendor class", "", []string{""}, false},
+		{"empty lists", "", nil, false},
+	} {
+		if got := e.matches(tc.requestedOptions, tc.vendorClasses); got != tc.expected {
+			t.Errorf("%s: expected %t for %q and %q, got %t", tc.name, tc.expected, tc.requestedOptions, tc.vendorClasses, got)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		requestedOptions string
+		vendorClasses    []string
+		expected         Class
+	}{
+		{"switch vendor class", "", []string{"SONiC-ZTP"}, ClassSwitch},
+		{"bmc vendor class", "", []string{"iDRAC9"}, ClassBMC},
+		{"bmc requested options", "1,3,6,12,15,28,40,41,42", nil, ClassBMC},
+		{"laptop requested options", "1,121,3,6,15,119,252,95,44,46", nil, ClassLaptop},
+		{"laptop requested options reordered", "1,3,6,15,44,46,95,119,121,252", nil, ClassUnknown},
+		{"server vendor class", "1,3,6", []string{"PXEClient:Arch:00007:UNDI:003016"}, ClassServerNIC},
+		// the first matching entry wins, switches are listed before servers
+		{"vendor class before requested options", "1,121,3,6,15,119,252,95,44,46", []string{"onie_vendor:x86_64"}, ClassSwitch},
+		{"unknown vendor class", "1,3,6", []string{"foo"}, ClassUnknown},
+		{"empty lists", "", nil, ClassUnknown},
+	} {
+		if got := classify(tc.requestedOptions, tc.vendorClasses); got.Class != tc.expected {
+			t.Errorf("%s: expected class %s, got %s", tc.name, tc.expected, got.Class)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	first := classify("1,3,6", []string{"foo"})
+	if first.Hash != classify("1,3,6", []string{"foo"}).Hash {
+		t.Error("expected the same fingerprint to have the same hash")
+	}
+	if len(first.Hash) != 16 {
+		t.Errorf("expected a hash of 16 characters, got %q", first.Hash)
+	}
+	for _, other := range []Result{
+		classify("1,6,3", []string{"foo"}),
+		classify("1,3,6", []string{"bar"}),
+		classify("1,3,6", nil),
+	} {
+		if other.Hash == first.Hash {
+			t.Errorf("expected different fingerprints to have different hashes, got %s", first.Hash)
+		}
+	}
+}
+
+/* IPv4 */
+func TestClassify4(t *testing.T) {
+	req, err := dhcpv4.NewDiscovery(mac,
+		dhcpv4.WithRequestedOptions(dhcpv4.OptionSubnetMask, dhcpv4.OptionRouter, dhcpv4.OptionDomainNameServer),
+		dhcpv4.WithOption(dhcpv4.OptClassIdentifier("Arista;DCS-7050")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Classify4(req); got.Class != ClassSwitch {
+		t.Errorf("expected class %s, got %s", ClassSwitch, got.Class)
+	}
+}
+
+/* IPv6 */
+func TestClassify6(t *testing.T) {
+	req, err := dhcpv6.NewSolicit(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.UpdateOption(&dhcpv6.OptVendorClass{EnterpriseNumber: 343, Data: [][]byte{[]byte("HTTPClient:Arch:00016")}})
+	relayed, err := dhcpv6.EncapsulateRelay(req, dhcpv6.MessageTypeRelayForward, net.ParseIP("2001:db8::1"), net.ParseIP("fe80::1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range []dhcpv6.DHCPv6{req, relayed} {
+		got, err := Classify6(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Class != ClassServerNIC {
+			t.Errorf("expected class %s, got %s", ClassServerNIC, got.Class)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package fixture converts captured requests into sanitized test fixtures.
+// A fixture lists the parsed options for reading and holds the sanitized
+// packet, which tests decode into the request again. Client identities are
+// replaced consistently within a capture, keeping the vendor part of MAC
+// addresses, so e.g. the requests of a client can still be related.
+package fixture
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	FamilyV4 = "v4"
+	FamilyV6 = "v6"
+)
+
+// Option is a parsed option of the request.
+type Option struct {
+	Code  uint16 `yaml:"code"`
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+// Fixture is a sanitized request.
+type Fixture struct {
+	Family      string    `yaml:"family"`
+	MessageType string    `yaml:"messageType"`
+	Captured    time.Time `yaml:"captured"`
+	// Relayed is the number of relay hops of a DHCPv6 request, or 1 for a
+	// DHCPv4 request with a gateway address
+	Relayed int `yaml:"relayed,omitempty"`
+	// Options are the options of the client's message
+	Options []Option `yaml:"options"`
+	// Packet is the hex encoded request, including relay encapsulation
+	Packet string `yaml:"packet"`
+}
+
+// Sanitizer replaces client identities, the same identity is replaced by the
+// same value. The replacement is salted, so it can't be reversed by trying
+// all addresses of a vendor.
+type Sanitizer struct {
+	salt []byte
+}
+
+// NewSanitizer returns a sanitizer with a random salt.
+func NewSanitizer() *Sanitizer {
+	salt := make([]byte, 16)
+	_, _ = rand.Read(salt)
+	return &Sanitizer{salt: salt}
+}
+
+func (s *Sanitizer) hash(data []byte) []byte {
+	h := sha256.New()
+	h.Write(s.salt)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// MAC replaces the device part of a MAC address, the vendor part is kept.
+func (s *Sanitizer) MAC(mac net.HardwareAddr) net.HardwareAddr {
+	if len(mac) < 6 {
+		return mac
+	}
+	sanitized := append(net.HardwareAddr(nil), mac...)
+	copy(sanitized[3:], s.hash(mac))
+	return sanitized
+}
+
+// Name replaces a hostname or other free-form identity.
+func (s *Sanitizer) Name(name string) string {
+	return "host-" + hex.EncodeToString(s.hash([]byte(name))[:4])
+}
+
+// linkLocal replaces a link-local address, which is usually derived from the MAC address.
+func (s *Sanitizer) linkLocal(ip net.IP) net.IP {
+	sanitized := make(net.IP, net.IPv6len)
+	copy(sanitized, net.ParseIP("fe80::"))
+	copy(sanitized[8:], s.hash(ip))
+	return sanitized
+}
+
+// options4 returns the parsed options, ordered by code.
+func options4(options dhcpv4.Options) []Option {
+	codes := make([]int, 0, len(options))
+	for code := range options {
+		codes = append(codes, int(code))
+	}
+	sort.Ints(codes)
+
+	parsed := make([]Option, 0, len(codes))
+	for _, code := range codes {
+		single := dhcpv4.Options{uint8(code): options[uint8(code)]}
+		name, value, _ := strings.Cut(strings.TrimSpace(single.String()), ": ")
+		parsed = append(parsed, Option{Code: uint16(code), Name: name, Value: value})
+	}
+	return parsed
+}
+
+// options6 returns the parsed options in the order of the message.
+func options6(options dhcpv6.Options) []Option {
+	parsed := make([]Option, 0, len(options))
+	for _, o := range options {
+		_, value, _ := strings.Cut(o.String(), ": ")
+		parsed = append(parsed, Option{Code: uint16(o.Code()), Name: o.Code().String(), Value: value})
+	}
+	return parsed
+}
+
+// New4 returns the fixture of a DHCPv4 request. The client hardware address,
+// hostname and client identifier are replaced, the FQDN and relay agent
+// information are removed.
+func New4(req *dhcpv4.DHCPv4, s *Sanitizer) (*Fixture, error) {
+	m, err := dhcpv4.FromBytes(req.ToBytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy request: %w", err)
+	}
+
+	m.ClientHWAddr = s.MAC(m.ClientHWAddr)
+	if hostname := m.HostName(); hostname != "" {
+		m.UpdateOption(dhcpv4.OptHostName(s.Name(hostname)))
+	}
+	if m.Options.Has(dhcpv4.OptionClientIdentifier) {
+		m.UpdateOption(dhcpv4.OptClientIdentifier(append([]byte{byte(iana.HWTypeEthernet)}, m.ClientHWAddr...)))
+	}
+	m.Options.Del(dhcpv4.OptionFQDN)
+	m.Options.Del(dhcpv4.OptionRelayAgentInformation)
+
+	f := &Fixture{
+		Family:      FamilyV4,
+		MessageType: m.MessageType().String(),
+		Captured:    time.Now().UTC().Truncate(time.Second),
+		Options:     options4(m.Options),
+		Packet:      hex.EncodeToString(m.ToBytes()),
+	}
+	if !m.GatewayIPAddr.IsUnspecified() {
+		f.Relayed = 1
+	}
+	return f, nil
+}
+
+// sanitize6 sanitizes a DHCPv6 message in place. The client ID is replaced by
+// a DUID-LL, link-local peer addresses and client link-layer addresses are
+// replaced, and the FQDN as well as the relay agents' interface, remote and
+// subscriber IDs are removed.
+func sanitize6(msg dhcpv6.DHCPv6, s *Sanitizer) (*dhcpv6.Message, int, error) {
+	switch m := msg.(type) {
+	case *dhcpv6.RelayMessage:
+		if m.PeerAddr.IsLinkLocalUnicast() {
+			m.PeerAddr = s.linkLocal(m.PeerAddr)
+		}
+		if htype, mac := m.Options.ClientLinkLayerAddress(); mac != nil {
+			m.Options.Update(dhcpv6.OptClientLinkLayerAddress(htype, s.MAC(mac)))
+		}
+		m.Options.Del(dhcpv6.OptionInterfaceID)
+		m.Options.Del(dhcpv6.OptionRemoteID)
+		m.Options.Del(dhcpv6.OptionRelayAgentSubscriberID)
+
+		inner := m.Options.RelayMessage()
+		if inner == nil {
+			return nil, 0, fmt.Errorf("relay message without encapsulated message")
+		}
+		client, hops, err := sanitize6(inner, s)
+		if err != nil {
+			return nil, 0, err
+		}
+		m.Options.Update(dhcpv6.OptRelayMessage(inner))
+		return client, hops + 1, nil
+	case *dhcpv6.Message:
+		if duid := m.Options.ClientID(); duid != nil {
+			mac, err := dhcpv6.ExtractMAC(m)
+			if err != nil {
+				mac = s.hash(duid.ToBytes())[:6]
+			}
+			m.Options.Update(dhcpv6.OptClientID(&dhcpv6.DUIDLL{HWType: iana.HWTypeEthernet, LinkLayerAddr: s.MAC(mac)}))
+		}
+		m.Options.Del(dhcpv6.OptionFQDN)
+		return m, 0, nil
+	default:
+		return nil, 0, fmt.Errorf("unexpected message type %T", msg)
+	}
+}
+
+// New6 returns the fixture of a DHCPv6 request, see sanitize6 for the
+// identities replaced.
+func New6(req dhcpv6.DHCPv6, s *Sanitizer) (*Fixture, error) {
+	msg, err := dhcpv6.FromBytes(req.ToBytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy request: %w", err)
+	}
+	client, hops, err := sanitize6(msg, s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Fixture{
+		Family:      FamilyV6,
+		MessageType: client.MessageType.String(),
+		Captured:    time.Now().UTC().Truncate(time.Second),
+		Relayed:     hops,
+		Options:     options6(client.Options.Options),
+		Packet:      hex.EncodeToString(msg.ToBytes()),
+	}, nil
+}
+
+// Write writes the fixture as YAML file into the directory and returns its path.
+// The file is named after the family, message type and capture time.
+func (f *Fixture) Write(dir string) (string, error) {
+	data, err := yaml.Marshal(f)
+	if err != nil {
+		return "", err
+	}
+	name := strings.ToLower(strings.ReplaceAll(f.MessageType, " ", "-"))
+	file, err := os.CreateTemp(dir, fmt.Sprintf("%s-%s-%s-*.yaml", f.Family, name, f.Captured.Format("20060102T150405")))
+	if err != nil {
+		return "", fmt.Errorf("failed to create fixture: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+	if _, err := file.Write(data); err != nil {
+		return "", fmt.Errorf("failed to write fixture: %w", err)
+	}
+	return filepath.Clean(file.Name()), nil
+}
+
+// Load reads a fixture, e.g. from a test's testdata directory.
+func Load(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &Fixture{}
+	if err := yaml.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture %s: %w", path, err)
+	}
+	return f, nil
+}
+
+func (f *Fixture) packet(family string) ([]byte, error) {
+	if f.Family != family {
+		return nil, fmt.Errorf("fixture is a %s request, not %s", f.Family, family)
+	}
+	return hex.DecodeString(f.Packet)
+}
+
+// DHCPv4 returns the request of a DHCPv4 fixture.
+func (f *Fixture) DHCPv4() (*dhcpv4.DHCPv4, error) {
+	data, err := f.packet(FamilyV4)
+	if err != nil {
+		return nil, err
+	}
+	return dhcpv4.FromBytes(data)
+}
+
+// DHCPv6 returns the request of a DHCPv6 fixture, including relay encapsulation.
+func (f *Fixture) DHCPv6() (dhcpv6.DHCPv6, error) {
+	data, err := f.packet(FamilyV6)
+	if err != nil {
+		return nil, err
+	}
+	return dhcpv6.FromBytes(data)
+}
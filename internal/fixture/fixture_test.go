@@ -0,0 +1,135 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package fixture
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+)
+
+var mac = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+
+func TestSanitizeMAC(t *testing.T) {
+	s := NewSanitizer()
+	sanitized := s.MAC(mac)
+	if !bytes.Equal(sanitized[:3], mac[:3]) {
+		t.Errorf("expected the vendor part %s to be kept, got %s", mac[:3], sanitized)
+	}
+	if bytes.Equal(sanitized, mac) {
+		t.Error("expected the device part to be replaced")
+	}
+	if !bytes.Equal(s.MAC(mac), sanitized) {
+		t.Error("expected the same replacement for the same MAC address")
+	}
+	if bytes.Equal(NewSanitizer().MAC(mac), sanitized) {
+		t.Error("expected another replacement with another salt")
+	}
+}
+
+/* IPv4 */
+func TestFixture4(t *testing.T) {
+	req, _ := dhcpv4.NewDiscovery(mac,
+		dhcpv4.WithOption(dhcpv4.OptHostName("rack1-bmc")),
+		dhcpv4.WithOption(dhcpv4.OptClassIdentifier("PXEClient")),
+		dhcpv4.WithOption(dhcpv4.OptRelayAgentInfo(dhcpv4.OptGeneric(dhcpv4.AgentCircuitIDSubOption, []byte("eth1")))),
+	)
+
+	s := NewSanitizer()
+	f, err := New4(req, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := f.Write(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Family != FamilyV4 || loaded.MessageType != "DISCOVER" {
+		t.Errorf("unexpected fixture %+v", loaded)
+	}
+
+	captured, err := loaded.DHCPv4()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if captured.ClientHWAddr.String() != s.MAC(mac).String() {
+		t.Errorf("expected MAC address %s, got %s", s.MAC(mac), captured.ClientHWAddr)
+	}
+	if captured.HostName() == "rack1-bmc" {
+		t.Error("expected the hostname to be replaced")
+	}
+	if captured.Options.Has(dhcpv4.OptionRelayAgentInformation) {
+		t.Error("expected the relay agent information to be removed")
+	}
+	if captured.ClassIdentifier() != "PXEClient" {
+		t.Errorf("expected the vendor class to be kept, got %q", captured.ClassIdentifier())
+	}
+
+	if _, err := loaded.DHCPv6(); err == nil {
+		t.Error("no error occurred decoding a DHCPv4 fixture as DHCPv6, but it should have")
+	}
+}
+
+/* IPv6 */
+func TestFixture6(t *testing.T) {
+	solicit, _ := dhcpv6.NewSolicit(mac)
+	relayed, _ := dhcpv6.EncapsulateRelay(solicit, dhcpv6.MessageTypeRelayForward,
+		net.ParseIP("2001:db8::1"), net.ParseIP("fe80::21a:2bff:fe3c:4d5e"))
+	relayed.AddOption(dhcpv6.OptClientLinkLayerAddress(iana.HWTypeEthernet, mac))
+	relayed.AddOption(&dhcpv6.OptRemoteID{EnterpriseNumber: 4413, RemoteID: []byte("port-7")})
+
+	s := NewSanitizer()
+	f, err := New6(relayed, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Relayed != 1 || f.MessageType != dhcpv6.MessageTypeSolicit.String() {
+		t.Errorf("unexpected fixture %+v", f)
+	}
+
+	captured, err := f.DHCPv6()
+	if err != nil {
+		t.Fatal(err)
+	}
+	relay := captured.(*dhcpv6.RelayMessage)
+	if relay.PeerAddr.Equal(net.ParseIP("fe80::21a:2bff:fe3c:4d5e")) {
+		t.Error("expected the peer address to be replaced")
+	}
+	if _, lladdr := relay.Options.ClientLinkLayerAddress(); lladdr.String() != s.MAC(mac).String() {
+		t.Errorf("expected client link-layer address %s, got %s", s.MAC(mac), lladdr)
+	}
+	if relay.Options.GetOne(dhcpv6.OptionRemoteID) != nil {
+		t.Error("expected the remote ID to be removed")
+	}
+	inner, _ := captured.GetInnerMessage()
+	clientMAC, err := dhcpv6.ExtractMAC(inner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clientMAC.String() != s.MAC(mac).String() {
+		t.Errorf("expected client ID with MAC address %s, got %s", s.MAC(mac), clientMAC)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	f, err := Load("testdata/v4-discover.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := f.DHCPv4()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.MessageType() != dhcpv4.MessageTypeDiscover || req.ClassIdentifier() != "PXEClient:Arch:00007:UNDI:003016" {
+		t.Errorf("unexpected request %s", req.Summary())
+	}
+}
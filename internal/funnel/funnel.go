@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package funnel tracks how far machines get in the onboarding pipeline:
+// discovered, filtered, IP allocated, endpoint created and boot option served.
+// Plugins record the stages they complete per MAC address; the metrics are
+// labeled with the MAC prefix (OUI), so operators can see per vendor where
+// machines get stuck.
+package funnel
+
+import (
+	"net"
+	"sync"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/admin"
+	"github.com/ironcore-dev/fedhcp/internal/cache"
+	"github.com/ironcore-dev/fedhcp/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Stage is a step of the onboarding pipeline.
+type Stage int
+
+const (
+	// Discovered machines have sent a request to a plugin of the pipeline
+	Discovered Stage = iota
+	// Filtered machines have passed the MAC address filter of the inventory
+	Filtered
+	// IPAllocated machines have an IP address in IPAM
+	IPAllocated
+	// EndpointCreated machines have an Endpoint
+	EndpointCreated
+	// BootServed machines have been sent a boot option
+	BootServed
+)
+
+var stageNames = []string{"discovered", "filtered", "ip_allocated", "endpoint_created", "boot_served"}
+
+func (s Stage) String() string {
+	return stageNames[s]
+}
+
+var (
+	events = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "onboarding_funnel",
+		Name:      "events_total",
+		Help:      "Number of times a stage of the onboarding pipeline has been completed, per MAC prefix.",
+	}, []string{"stage", "mac_prefix"})
+	reached = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "onboarding_funnel",
+		Name:      "machines",
+		Help:      "Number of machines which have reached a stage of the onboarding pipeline, per MAC prefix.",
+	}, []string{"stage", "mac_prefix"})
+	furthest = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "onboarding_funnel",
+		Name:      "current_machines",
+		Help:      "Number of machines whose furthest stage of the onboarding pipeline is the given one, per MAC prefix.",
+	}, []string{"stage", "mac_prefix"})
+)
+
+// maxMachines bounds the number of tracked machines, the least recently
+// recorded are forgotten first.
+const maxMachines = 100000
+
+var (
+	once sync.Once
+	mu   sync.Mutex
+	// machines holds the furthest stage per MAC address
+	machines = newMachines(maxMachines)
+)
+
+func newMachines(capacity int) *cache.Cache[string, Stage] {
+	return cache.New[string, Stage]("funnel/machines", capacity, 0).OnEvict(forget)
+}
+
+// forget removes an evicted machine from the machine gauges.
+func forget(mac string, stage Stage) {
+	prefix := mac[:len("00:00:00")]
+	for s := Discovered; s <= stage; s++ {
+		reached.WithLabelValues(s.String(), prefix).Dec()
+	}
+	furthest.WithLabelValues(stage.String(), prefix).Dec()
+}
+
+// Record notes that the machine completed the stage. Completing a stage implies
+// the ones before, so a machine which is seen at a later stage first, e.g.
+// because it was discovered before a restart, is counted for all of them.
+func Record(stage Stage, mac net.HardwareAddr) {
+	if len(mac) < 3 {
+		return
+	}
+	once.Do(func() {
+		metrics.Register(events, reached, furthest)
+		admin.State("funnel", state)
+	})
+
+	prefix := mac[:3].String()
+	events.WithLabelValues(stage.String(), prefix).Inc()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	key := mac.String()
+	previous, known := machines.Get(key)
+	if known && previous >= stage {
+		return
+	}
+	machines.Put(key, stage)
+
+	first := Discovered
+	if known {
+		first = previous + 1
+		furthest.WithLabelValues(previous.String(), prefix).Dec()
+	}
+	for s := first; s <= stage; s++ {
+		reached.WithLabelValues(s.String(), prefix).Inc()
+	}
+	furthest.WithLabelValues(stage.String(), prefix).Inc()
+}
+
+// state returns the number of tracked machines per furthest stage, see admin.State.
+func state() any {
+	mu.Lock()
+	defer mu.Unlock()
+
+	machinesPerStage := make(map[string]int, len(stageNames))
+	machines.Range(func(_ string, stage Stage) bool {
+		machinesPerStage[stage.String()]++
+		return true
+	})
+	return map[string]any{
+		"machines":         machines.Len(),
+		"machinesPerStage": machinesPerStage,
+	}
+}
+
+// Events returns the counter of the stage for the MAC prefix of the machine,
+// e.g. to verify in the tests of a plugin that it records the stage.
+func Events(stage Stage, mac net.HardwareAddr) prometheus.Counter {
+	return events.WithLabelValues(stage.String(), mac[:3].String())
+}
+
+// Record6 notes that the machine sending the DHCPv6 request completed the stage.
+// Requests the MAC address can't be extracted from are ignored.
+func Record6(stage Stage, req dhcpv6.DHCPv6) {
+	if mac, err := dhcpv6.ExtractMAC(req); err == nil {
+		Record(stage, mac)
+	}
+}
@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package funnel
+
+import (
+	"net"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRecord(t *testing.T) {
+	first := net.HardwareAddr{0x00, 0x1a, 0x2b, 0x00, 0x00, 0x01}
+	second := net.HardwareAddr{0x00, 0x1a, 0x2b, 0x00, 0x00, 0x02}
+	const prefix = "00:1a:2b"
+
+	Record(Discovered, first)
+	Record(Discovered, first)
+	Record(IPAllocated, first)
+	// seen late, e.g. after a restart
+	Record(BootServed, second)
+	// going back does not change the furthest stage
+	Record(Filtered, second)
+
+	for stage, expected := range map[Stage]float64{
+		Discovered:      2,
+		Filtered:        2,
+		IPAllocated:     2,
+		EndpointCreated: 1,
+		BootServed:      1,
+	} {
+		if got := testutil.ToFloat64(reached.WithLabelValues(stage.String(), prefix)); got != expected {
+			t.Errorf("expected %v machines to have reached %s, got %v", expected, stage, got)
+		}
+	}
+
+	for stage, expected := range map[Stage]float64{
+		Discovered:  0,
+		IPAllocated: 1,
+		BootServed:  1,
+	} {
+		if got := testutil.ToFloat64(furthest.WithLabelValues(stage.String(), prefix)); got != expected {
+			t.Errorf("expected %v machines to be at %s, got %v", expected, stage, got)
+		}
+	}
+
+	if got := testutil.ToFloat64(events.WithLabelValues(Discovered.String(), prefix)); got != 2 {
+		t.Errorf("expected 2 discovered events, got %v", got)
+	}
+}
+
+func TestForget(t *testing.T) {
+	previous := machines
+	machines = newMachines(1)
+	t.Cleanup(func() { machines = previous })
+
+	first := net.HardwareAddr{0x00, 0x1a, 0x2c, 0x00, 0x00, 0x01}
+	second := net.HardwareAddr{0x00, 0x1a, 0x2c, 0x00, 0x00, 0x02}
+	const prefix = "00:1a:2c"
+
+	Record(Filtered, first)
+	// the first machine is forgotten to make room for the second
+	Record(Discovered, second)
+
+	if got := testutil.ToFloat64(reached.WithLabelValues(Discovered.String(), prefix)); got != 1 {
+		t.Errorf("expected 1 tracked machine to have been discovered, got %v", got)
+	}
+	if got := testutil.ToFloat64(furthest.WithLabelValues(Filtered.String(), prefix)); got != 0 {
+		t.Errorf("expected the forgotten machine to be removed from the filtered stage, got %v", got)
+	}
+}
@@ -0,0 +1,35 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package instance hands out identifiers for plugin instances, so several
+// instances of the same plugin (e.g. two httpboot entries with different
+// URLs) can be told apart in logs.
+package instance
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	mu       sync.Mutex
+	counters = make(map[string]int)
+)
+
+// Next returns a new identifier for an instance of the given plugin, like
+// "httpboot/v6#2". Identifiers are counted per name, starting at 1.
+func Next(name string) string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	counters[name]++
+	return fmt.Sprintf("%s#%d", name, counters[name])
+}
+
+// Logger returns a logger for a new instance of the given plugin, which
+// carries the instance identifier as a field.
+func Logger(log *logrus.Entry, name string) *logrus.Entry {
+	return log.WithField("instance", Next(name))
+}
@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package instance
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestNext(t *testing.T) {
+	for _, expected := range []string{"test/v6#1", "test/v6#2", "test/v6#3"} {
+		if name := Next("test/v6"); name != expected {
+			t.Errorf("expected %s, got %s", expected, name)
+		}
+	}
+	// identifiers are counted per name
+	if name := Next("test/v4"); name != "test/v4#1" {
+		t.Errorf("expected test/v4#1, got %s", name)
+	}
+}
+
+func TestNextConcurrent(t *testing.T) {
+	const n = 100
+	names := make(chan string, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			names <- Next("concurrent")
+		}()
+	}
+	wg.Wait()
+	close(names)
+
+	seen := make(map[string]bool, n)
+	for name := range names {
+		if seen[name] {
+			t.Errorf("identifier %s handed out twice", name)
+		}
+		seen[name] = true
+	}
+	if len(seen) != n {
+		t.Errorf("expected %d identifiers, got %d", n, len(seen))
+	}
+}
+
+func TestLogger(t *testing.T) {
+	entry := Logger(logrus.NewEntry(logrus.New()), "logger/v6")
+	if name := entry.Data["instance"]; name != "logger/v6#1" {
+		t.Errorf("expected the instance field logger/v6#1, got %v", name)
+	}
+}
@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package journal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// KeyEnv is the environment variable holding the journal key, if no key file
+// is given.
+const KeyEnv = "FEDHCP_JOURNAL_KEY"
+
+// ParseKey decodes a base64 encoded AES key of 16, 24 or 32 bytes, surrounding
+// whitespace, e.g. the trailing newline of a file, is ignored.
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("invalid journal key: %w", err)
+	}
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("invalid journal key: must be 16, 24 or 32 bytes, got %d", len(key))
+	}
+}
+
+// sealer encrypts the lines of the journal with AES-GCM. Each line is the
+// base64 encoded nonce followed by the sealed entry, so a line torn by a crash
+// fails to open like an unparsable one. A nil sealer keeps lines in plain text.
+type sealer struct {
+	aead cipher.AEAD
+}
+
+func newSealer(key []byte) (*sealer, error) {
+	if len(key) == 0 {
+		return nil, nil
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid journal key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &sealer{aead: aead}, nil
+}
+
+func (s *sealer) seal(line []byte) ([]byte, error) {
+	if s == nil {
+		return line, nil
+	}
+	nonce := make([]byte, s.aead.NonceSize(), s.aead.NonceSize()+len(line)+s.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := s.aead.Seal(nonce, nonce, line, nil)
+	return base64.StdEncoding.AppendEncode(nil, sealed), nil
+}
+
+// open returns the entry of a line. Lines in plain text, written before the
+// journal was encrypted, are read as they are.
+func (s *sealer) open(line []byte) ([]byte, error) {
+	plain := len(line) == 0 || line[0] == '{'
+	switch {
+	case s == nil && !plain:
+		return nil, errEncrypted
+	case s == nil || plain:
+		return line, nil
+	}
+	sealed, err := base64.StdEncoding.AppendDecode(nil, line)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < s.aead.NonceSize() {
+		return nil, errors.New("sealed entry too short")
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	return s.aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// errEncrypted is returned for an encrypted line read without a key.
+var errEncrypted = errors.New("journal is encrypted, a key is needed")
@@ -0,0 +1,446 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package journal records the kubernetes writes of plugins as transactions in
+// an append-only file. Objects created within a transaction carry its ID as a
+// label. A transaction begun but never ended was interrupted by a crash; on
+// startup, the objects it created are deleted instead of being left orphaned.
+// Journaling is only enabled if a journal is opened. The entries may be
+// encrypted with AES-GCM, so that the file does not disclose the inventory.
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/ironcore-dev/fedhcp/internal/admin"
+	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// TransactionLabel holds the ID of the transaction an object was created in.
+const TransactionLabel = "fedhcp.ironcore.dev/transaction"
+
+// compactAfter is the number of ended transactions after which the file is compacted.
+const compactAfter = 1000
+
+// Kind is the kind of objects a transaction creates.
+type Kind string
+
+const (
+	KindIP Kind = "IP"
+)
+
+type op string
+
+const (
+	opBegin op = "begin"
+	opEnd   op = "end"
+)
+
+// Entry is a line of the journal.
+type Entry struct {
+	Op        op        `json:"op"`
+	ID        string    `json:"id"`
+	Kind      Kind      `json:"kind,omitempty"`
+	Namespace string    `json:"namespace,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// Journal is an append-only file of transactions.
+type Journal struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	open    map[string]Entry
+	ended   int
+	pending []Entry
+	// sealer encrypts the entries, nil if they are kept in plain text
+	sealer *sealer
+}
+
+var (
+	log = logger.GetLogger("journal")
+
+	mu      sync.RWMutex
+	journal *Journal
+)
+
+// Open opens the journal at path, creating it if needed, and enables journaling.
+// Transactions left open in the file are pending until reconciled.
+func Open(path string) (*Journal, error) {
+	return OpenEncrypted(path, nil)
+}
+
+// OpenEncrypted opens the journal at path like Open, encrypting its entries
+// with the AES key, see ParseKey. The entries of a journal written in plain
+// text before are read and encrypted on the next compaction, an encrypted
+// journal can't be opened without the key.
+func OpenEncrypted(path string, key []byte) (*Journal, error) {
+	s, err := newSealer(key)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{path: path, open: make(map[string]Entry), sealer: s}
+
+	f, err := os.Open(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	default:
+		pending, err := readPending(f, s)
+		_ = f.Close()
+		if err != nil {
+			return nil, err
+		}
+		j.pending = pending
+	}
+
+	if err := j.compact(); err != nil {
+		return nil, err
+	}
+	if len(j.pending) > 0 {
+		log.Warningf("Journal %s holds %d interrupted transactions", path, len(j.pending))
+	}
+
+	mu.Lock()
+	journal = j
+	mu.Unlock()
+	admin.State("journal", j.state)
+	return j, nil
+}
+
+// readPending returns the transactions begun but not ended in the journal.
+// Only a final line without newline may be torn by a crash and is skipped, any
+// other line failing to read, e.g. as the key does not match, is an error, so
+// that the journal is not compacted without it.
+func readPending(f *os.File, s *sealer) ([]Entry, error) {
+	open := make(map[string]Entry)
+	var order []string
+	reader := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to read journal: %w", err)
+		}
+		torn := err != nil
+		data = bytes.TrimSuffix(data, []byte("\n"))
+		if len(data) == 0 {
+			if torn {
+				break
+			}
+			continue
+		}
+
+		entry, readErr := readEntry(data, s)
+		switch {
+		case errors.Is(readErr, errEncrypted):
+			return nil, fmt.Errorf("failed to read journal: %w", readErr)
+		case readErr != nil && torn:
+			log.Warningf("Skipping torn journal entry on line %d: %v", n, readErr)
+		case readErr != nil:
+			return nil, fmt.Errorf("failed to read journal entry on line %d: %w", n, readErr)
+		case entry.Op == opBegin:
+			open[entry.ID] = entry
+			order = append(order, entry.ID)
+		case entry.Op == opEnd:
+			delete(open, entry.ID)
+		}
+		if torn {
+			break
+		}
+	}
+
+	var pending []Entry
+	for _, id := range order {
+		if entry, ok := open[id]; ok {
+			pending = append(pending, entry)
+		}
+	}
+	return pending, nil
+}
+
+// readEntry decrypts and parses a line of the journal.
+func readEntry(data []byte, s *sealer) (Entry, error) {
+	var entry Entry
+	line, err := s.open(data)
+	if err != nil {
+		return entry, err
+	}
+	err = json.Unmarshal(line, &entry)
+	return entry, err
+}
+
+// compact rewrites the journal with the pending and open transactions only.
+// j.mu must be held or the journal not yet in use.
+func (j *Journal) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to compact journal: %w", err)
+	}
+	var lines []byte
+	for _, entry := range j.pending {
+		line, err := j.line(entry)
+		if err != nil {
+			_ = tmp.Close()
+			return fmt.Errorf("failed to compact journal: %w", err)
+		}
+		lines = append(lines, line...)
+	}
+	for _, entry := range j.open {
+		line, err := j.line(entry)
+		if err != nil {
+			_ = tmp.Close()
+			return fmt.Errorf("failed to compact journal: %w", err)
+		}
+		lines = append(lines, line...)
+	}
+	if _, err := tmp.Write(lines); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to compact journal: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to compact journal: %w", err)
+	}
+	_ = tmp.Close()
+	if err := os.Rename(tmp.Name(), j.path); err != nil {
+		return fmt.Errorf("failed to compact journal: %w", err)
+	}
+
+	file, err := os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open journal: %w", err)
+	}
+	if j.file != nil {
+		_ = j.file.Close()
+	}
+	j.file = file
+	j.ended = 0
+	return nil
+}
+
+// line returns the entry as a line of the journal, encrypted if configured.
+func (j *Journal) line(entry Entry) ([]byte, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	data, err = j.sealer.seal(data)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func (j *Journal) write(entry Entry, sync bool) error {
+	line, err := j.line(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(line); err != nil {
+		return err
+	}
+	if sync {
+		return j.file.Sync()
+	}
+	return nil
+}
+
+func (j *Journal) state() any {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return map[string]int{"open": len(j.open), "pending": len(j.pending)}
+}
+
+// Pending returns the transactions interrupted before the journal was opened.
+func (j *Journal) Pending() []Entry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]Entry(nil), j.pending...)
+}
+
+// Reconcile deletes the objects created by the interrupted transactions and
+// ends them. Transactions failing to reconcile stay pending.
+func (j *Journal) Reconcile(ctx context.Context, cl client.Client) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var errs []error
+	var remaining []Entry
+	for _, entry := range j.pending {
+		if err := deleteCreated(ctx, cl, entry); err != nil {
+			errs = append(errs, fmt.Errorf("transaction %s: %w", entry.ID, err))
+			remaining = append(remaining, entry)
+			continue
+		}
+		log.Infof("Reconciled interrupted transaction %s of %s", entry.ID, entry.Time.Format(time.RFC3339))
+		if err := j.write(Entry{Op: opEnd, ID: entry.ID, Time: time.Now()}, false); err != nil {
+			errs = append(errs, fmt.Errorf("transaction %s: %w", entry.ID, err))
+		}
+	}
+	j.pending = remaining
+	return errors.Join(errs...)
+}
+
+// deleteCreated deletes the objects still carrying the label of the
+// transaction. Objects adopted since, see Adopt, or owned by another object,
+// e.g. the IPs linked to an Endpoint, are in use and kept. The deletion is
+// conditional on the object being unchanged since listed, so that an object
+// adopted concurrently, e.g. by another replica, is kept as well.
+func deleteCreated(ctx context.Context, cl client.Client, entry Entry) error {
+	var list client.ObjectList
+	switch entry.Kind {
+	case KindIP:
+		list = &ipamv1alpha1.IPList{}
+	default:
+		return fmt.Errorf("unknown kind %q", entry.Kind)
+	}
+
+	if err := cl.List(ctx, list, client.InNamespace(entry.Namespace),
+		client.MatchingLabels{TransactionLabel: entry.ID}); err != nil {
+		return fmt.Errorf("failed to list %s objects: %w", entry.Kind, err)
+	}
+	return meta.EachListItem(list, func(o runtime.Object) error {
+		obj := o.(client.Object)
+		if len(obj.GetOwnerReferences()) > 0 || obj.GetDeletionTimestamp() != nil {
+			log.Infof("Keeping %s %s/%s of transaction %s, it is owned or being deleted", entry.Kind,
+				obj.GetNamespace(), obj.GetName(), entry.ID)
+			return nil
+		}
+		uid, resourceVersion := obj.GetUID(), obj.GetResourceVersion()
+		err := cl.Delete(ctx, obj, client.Preconditions{UID: &uid, ResourceVersion: &resourceVersion})
+		switch {
+		case apierrors.IsNotFound(err):
+		case apierrors.IsConflict(err):
+			log.Infof("Keeping %s %s/%s of transaction %s, it changed since", entry.Kind,
+				obj.GetNamespace(), obj.GetName(), entry.ID)
+		case err != nil:
+			return fmt.Errorf("failed to delete %s %s/%s: %w", entry.Kind, obj.GetNamespace(), obj.GetName(), err)
+		default:
+			log.Infof("Deleted %s %s/%s of transaction %s", entry.Kind, obj.GetNamespace(), obj.GetName(), entry.ID)
+		}
+		return nil
+	})
+}
+
+// Adopt takes over an existing object for a later request, e.g. an IP created
+// by an earlier attempt or another replica and handed out again. It removes the
+// transaction label, so that reconciling the transaction that created the
+// object, should it have been interrupted, keeps it. Adopting is independent of
+// journaling being enabled, as the creator may journal while the adopter does
+// not.
+func Adopt(ctx context.Context, cl client.Client, obj client.Object) error {
+	if _, ok := obj.GetLabels()[TransactionLabel]; !ok {
+		return nil
+	}
+	patch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+	labels := obj.GetLabels()
+	delete(labels, TransactionLabel)
+	obj.SetLabels(labels)
+	if err := cl.Patch(ctx, obj, patch); err != nil {
+		return fmt.Errorf("failed to adopt %s/%s: %w", obj.GetNamespace(), obj.GetName(), err)
+	}
+	return nil
+}
+
+// Close disables journaling and closes the file.
+func (j *Journal) Close() error {
+	mu.Lock()
+	if journal == j {
+		journal = nil
+	}
+	mu.Unlock()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.file.Close()
+}
+
+// Transaction is a journaled kubernetes write. A nil transaction, returned if
+// journaling is disabled, does nothing.
+type Transaction struct {
+	journal *Journal
+	id      string
+}
+
+// Begin records the begin of a transaction creating objects of the kind in the
+// namespace. It is written to disk before returning, so it survives a crash.
+func Begin(kind Kind, namespace string) *Transaction {
+	mu.RLock()
+	j := journal
+	mu.RUnlock()
+	if j == nil {
+		return nil
+	}
+
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	entry := Entry{Op: opBegin, ID: hex.EncodeToString(id), Kind: kind, Namespace: namespace, Time: time.Now()}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.write(entry, true); err != nil {
+		log.Errorf("Could not journal transaction, continuing without: %v", err)
+		return nil
+	}
+	j.open[entry.ID] = entry
+	return &Transaction{journal: j, id: entry.ID}
+}
+
+// Label marks the object as created within the transaction.
+func (t *Transaction) Label(obj metav1.Object) {
+	if t == nil {
+		return
+	}
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[TransactionLabel] = t.id
+	obj.SetLabels(labels)
+}
+
+// End records the end of the transaction, the objects it created are kept. The
+// end is written to disk before returning, as a lost end would delete objects
+// already handed out on the next startup.
+func (t *Transaction) End() {
+	if t == nil {
+		return
+	}
+	j := t.journal
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, ok := j.open[t.id]; !ok {
+		return
+	}
+	delete(j.open, t.id)
+	if err := j.write(Entry{Op: opEnd, ID: t.id, Time: time.Now()}, true); err != nil {
+		log.Errorf("Could not journal end of transaction %s: %v", t.id, err)
+	}
+
+	j.ended++
+	if j.ended >= compactAfter {
+		if err := j.compact(); err != nil {
+			log.Errorf("Could not compact journal: %v", err)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package journal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes/fake"
+	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const namespace = "default"
+
+func createIP(t *testing.T, cl client.Client, tx *Transaction) *ipamv1alpha1.IP {
+	ip := &ipamv1alpha1.IP{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "001a2b3c4d5e-fedhcp-",
+			Namespace:    namespace,
+			Labels:       map[string]string{"mac": "001a2b3c4d5e"},
+		},
+	}
+	tx.Label(ip)
+	if err := cl.Create(context.Background(), ip); err != nil {
+		t.Fatal(err)
+	}
+	return ip
+}
+
+func countIPs(t *testing.T, cl client.Client) int {
+	ips := &ipamv1alpha1.IPList{}
+	if err := cl.List(context.Background(), ips, client.InNamespace(namespace)); err != nil {
+		t.Fatal(err)
+	}
+	return len(ips.Items)
+}
+
+func TestDisabled(t *testing.T) {
+	tx := Begin(KindIP, namespace)
+	if tx != nil {
+		t.Fatal("no transaction must be begun without a journal")
+	}
+
+	ip := &ipamv1alpha1.IP{}
+	tx.Label(ip)
+	tx.End()
+	if len(ip.Labels) != 0 {
+		t.Errorf("unexpected labels %v", ip.Labels)
+	}
+}
+
+func TestReconcileInterrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	cl := fake.NewClient()
+
+	j, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ended := Begin(KindIP, namespace)
+	createIP(t, cl, ended)
+	ended.End()
+	// the instance crashes before ending the second transaction
+	createIP(t, cl, Begin(KindIP, namespace))
+	_ = j.Close()
+
+	j, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = j.Close() })
+	if pending := j.Pending(); len(pending) != 1 || pending[0].Kind != KindIP {
+		t.Fatalf("expected one pending IP transaction, got %+v", pending)
+	}
+
+	if err := j.Reconcile(context.Background(), cl); err != nil {
+		t.Fatal(err)
+	}
+	if n := countIPs(t, cl); n != 1 {
+		t.Errorf("expected the IP of the interrupted transaction to be deleted, %d IPs left", n)
+	}
+	if pending := j.Pending(); len(pending) != 0 {
+		t.Errorf("expected no pending transactions after reconciling, got %+v", pending)
+	}
+
+	// the reconciled transaction is not pending after the next start either
+	_ = j.Close()
+	j, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending := j.Pending(); len(pending) != 0 {
+		t.Errorf("expected no pending transactions after reopening, got %+v", pending)
+	}
+}
+
+func TestReconcileKeepsAdopted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	cl := fake.NewClient()
+	ctx := context.Background()
+
+	j, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the instance crashes after creating three IPs in a transaction: the
+	// first is handed out again by another replica, the second is linked to
+	// an Endpoint, the third is not used
+	tx := Begin(KindIP, namespace)
+	adopted, owned, orphaned := createIP(t, cl, tx), createIP(t, cl, tx), createIP(t, cl, tx)
+	_ = j.Close()
+
+	if err := Adopt(ctx, cl, adopted); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := adopted.Labels[TransactionLabel]; ok || adopted.Labels["mac"] == "" {
+		t.Errorf("expected only the transaction label to be removed, got %v", adopted.Labels)
+	}
+	owned.OwnerReferences = []metav1.OwnerReference{{APIVersion: "metal.ironcore.dev/v1alpha1", Kind: "Endpoint", Name: "compute-1", UID: "1"}}
+	if err := cl.Update(ctx, owned); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = j.Close() })
+	if err := j.Reconcile(ctx, cl); err != nil {
+		t.Fatal(err)
+	}
+	for _, ip := range []*ipamv1alpha1.IP{adopted, owned} {
+		if err := cl.Get(ctx, client.ObjectKeyFromObject(ip), &ipamv1alpha1.IP{}); err != nil {
+			t.Errorf("expected IP %s to be kept: %v", ip.Name, err)
+		}
+	}
+	if err := cl.Get(ctx, client.ObjectKeyFromObject(orphaned), &ipamv1alpha1.IP{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected IP %s to be deleted, got %v", orphaned.Name, err)
+	}
+}
+
+func TestTornEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+
+	j, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Begin(KindIP, namespace)
+	_ = j.Close()
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"op":"end","id":`)
+	_ = f.Close()
+
+	j, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = j.Close() })
+	if pending := j.Pending(); len(pending) != 1 {
+		t.Errorf("expected one pending transaction, got %+v", pending)
+	}
+}
+
+func TestUnreadableEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+
+	j, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Begin(KindIP, namespace)
+	_ = j.Close()
+
+	// only the final line may be torn, a complete line failing to read is kept
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString("{\"op\":\"end\",\"id\":\n")
+	_ = f.Close()
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(path); err == nil {
+		t.Fatal("expected a journal with an unreadable entry not to open")
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(before) {
+		t.Errorf("expected the journal to be left as it is, got %q", after)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+
+	j, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = j.Close() })
+
+	open := Begin(KindIP, namespace)
+	for range compactAfter {
+		Begin(KindIP, namespace).End()
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], open.id) {
+		t.Errorf("expected only the open transaction after compaction, got %d lines", len(lines))
+	}
+}
+
+func TestEncrypted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	key, err := ParseKey("MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a journal written in plain text before is taken over
+	j, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := Begin(KindIP, namespace)
+	_ = j.Close()
+
+	j, err = OpenEncrypted(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := Begin(KindIP, namespace)
+	_ = j.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{plain.id, encrypted.id} {
+		if strings.Contains(string(data), id) || strings.Contains(string(data), namespace) {
+			t.Errorf("expected the journal to be encrypted, found transaction %s", id)
+		}
+	}
+
+	j, err = OpenEncrypted(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending := j.Pending(); len(pending) != 2 || pending[0].ID != plain.id || pending[1].ID != encrypted.id {
+		t.Errorf("expected both transactions pending, got %+v", pending)
+	}
+	_ = j.Close()
+
+	if _, err := Open(path); err == nil {
+		t.Error("expected an encrypted journal not to open without key")
+	}
+	other, _ := ParseKey("ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA=")
+	if _, err := OpenEncrypted(path, other); err == nil {
+		t.Error("expected an encrypted journal not to open with another key")
+	}
+}
+
+func TestWrongKey(t *testing.T) {
+	key, _ := ParseKey("MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	other, _ := ParseKey("ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA=")
+
+	for name, plain := range map[string]bool{"single entry": false, "mixed with plain text": true} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "journal")
+			if plain {
+				j, err := Open(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				Begin(KindIP, namespace)
+				_ = j.Close()
+				// appended to the plain text journal, as by a write before compaction
+				f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				s, _ := newSealer(key)
+				line, _ := (&Journal{sealer: s}).line(Entry{Op: opBegin, ID: "0123456789abcdef", Kind: KindIP, Namespace: namespace})
+				_, _ = f.Write(line)
+				_ = f.Close()
+			} else {
+				j, err := OpenEncrypted(path, key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				Begin(KindIP, namespace)
+				_ = j.Close()
+			}
+			before, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := OpenEncrypted(path, other); err == nil {
+				t.Fatal("expected the journal not to open with another key")
+			}
+			if after, _ := os.ReadFile(path); string(after) != string(before) {
+				t.Error("expected the journal to be left as it is")
+			}
+		})
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	for _, invalid := range []string{"", "not base64", "c2hvcnQ="} {
+		if _, err := ParseKey(invalid); err == nil {
+			t.Errorf("expected an error for key %q", invalid)
+		}
+	}
+}
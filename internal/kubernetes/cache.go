@@ -0,0 +1,258 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/ironcore-dev/fedhcp/internal/chaos"
+	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
+	metalv1alpha1 "github.com/ironcore-dev/metal-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// EndpointMACField indexes the Endpoints by their lowercase MAC address.
+	EndpointMACField = "spec.macAddress"
+	// IPMACField indexes the IPAM IPs by their mac label.
+	IPMACField = "metadata.labels.mac"
+	// ServerMACField indexes the Servers by the lowercase MAC addresses of their
+	// network interfaces.
+	ServerMACField = "status.networkInterfaces.macAddress"
+	// ConfigMapMACField indexes the ConfigMaps by their correlation label.
+	ConfigMapMACField = "metadata.labels." + MACLabel
+	// MACLabel is the correlation label of the objects of a MAC address, its
+	// value is the MAC address without separators.
+	MACLabel = "fedhcp.ironcore.dev/mac"
+)
+
+var log = logger.GetLogger("kubernetes")
+
+var (
+	// cacheMu guards objectCache and indexed
+	cacheMu     sync.Mutex
+	objectCache cache.Cache
+	// indexed holds the fields whose index has been registered
+	indexed = make(map[string]bool)
+)
+
+// InitCache starts the shared cache the lookups by MAC address read from, it
+// runs until ctx is cancelled. An informer is only started for the types
+// looked up, on the first lookup, which waits for it to be synced. Without a
+// cache, the lookups list the objects from the API server. Cached lookups are
+// delayed by the kubernetes delay of the chaos plugin like the API calls.
+func InitCache(ctx context.Context) error {
+	c, err := cache.New(cfg, cache.Options{Scheme: scheme})
+	if err != nil {
+		return fmt.Errorf("failed to create cache: %w", err)
+	}
+	go func() {
+		if err := c.Start(ctx); err != nil {
+			log.Errorf("Cache stopped: %v", err)
+		}
+	}()
+
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	objectCache = c
+	indexed = make(map[string]bool)
+	return nil
+}
+
+// indexedCache returns the cache with the field index registered, or nil if
+// no cache has been initialized.
+func indexedCache(ctx context.Context, obj client.Object, field string, extract client.IndexerFunc) (cache.Cache, error) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	if objectCache == nil {
+		return nil, nil
+	}
+	// unstructured objects of different kinds share their Go type
+	key := fmt.Sprintf("%T/%s/%s", obj, obj.GetObjectKind().GroupVersionKind().Kind, field)
+	if !indexed[key] {
+		if err := objectCache.IndexField(ctx, obj, field, extract); err != nil {
+			return nil, fmt.Errorf("failed to index %s: %w", field, err)
+		}
+		indexed[key] = true
+	}
+	return objectCache, nil
+}
+
+// ListIndexed lists the objects of the kind of obj in the namespace whose
+// field, indexed by extract, has the value from the cache. It reports false if
+// no cache has been initialized, the caller lists from the API server then.
+func ListIndexed(ctx context.Context, obj client.Object, list client.ObjectList, namespace, field, value string, extract client.IndexerFunc) (bool, error) {
+	c, err := indexedCache(ctx, obj, field, extract)
+	if err != nil || c == nil {
+		return false, err
+	}
+	chaos.Delay(ctx)
+	return true, c.List(ctx, list, client.InNamespace(namespace), client.MatchingFields{field: value})
+}
+
+// OnChange calls f whenever an object of the kind of obj is added, updated or
+// deleted in the cache, e.g. to invalidate responses derived from it. Without
+// a cache, f is never called.
+func OnChange(ctx context.Context, obj client.Object, f func()) error {
+	cacheMu.Lock()
+	c := objectCache
+	cacheMu.Unlock()
+	if c == nil {
+		return nil
+	}
+
+	informer, err := c.GetInformer(ctx, obj, cache.BlockUntilSynced(false))
+	if err != nil {
+		return fmt.Errorf("failed to get informer: %w", err)
+	}
+	_, err = informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    func(any) { f() },
+		UpdateFunc: func(any, any) { f() },
+		DeleteFunc: func(any) { f() },
+	})
+	return err
+}
+
+func endpointMAC(obj client.Object) []string {
+	return []string{strings.ToLower(obj.(*metalv1alpha1.Endpoint).Spec.MACAddress)}
+}
+
+func serverMACs(obj client.Object) []string {
+	var macs []string
+	for _, nic := range obj.(*metalv1alpha1.Server).Status.NetworkInterfaces {
+		macs = append(macs, strings.ToLower(nic.MACAddress))
+	}
+	return macs
+}
+
+func configMapMAC(obj client.Object) []string {
+	if mac := obj.GetLabels()[MACLabel]; mac != "" {
+		return []string{mac}
+	}
+	return nil
+}
+
+func ipMAC(obj client.Object) []string {
+	if mac := obj.GetLabels()["mac"]; mac != "" {
+		return []string{mac}
+	}
+	return nil
+}
+
+// EndpointsForMAC returns the Endpoints of the MAC address.
+func EndpointsForMAC(ctx context.Context, mac net.HardwareAddr) ([]metalv1alpha1.Endpoint, error) {
+	c, err := indexedCache(ctx, &metalv1alpha1.Endpoint{}, EndpointMACField, endpointMAC)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := &metalv1alpha1.EndpointList{}
+	if c != nil {
+		chaos.Delay(ctx)
+		if err := c.List(ctx, endpoints, client.MatchingFields{EndpointMACField: mac.String()}); err != nil {
+			return nil, err
+		}
+		return endpoints.Items, nil
+	}
+
+	// the Endpoint fields are not selectable, so all of them are listed
+	if err := kubeClient.List(ctx, endpoints); err != nil {
+		return nil, err
+	}
+	var matching []metalv1alpha1.Endpoint
+	for _, endpoint := range endpoints.Items {
+		if strings.EqualFold(endpoint.Spec.MACAddress, mac.String()) {
+			matching = append(matching, endpoint)
+		}
+	}
+	return matching, nil
+}
+
+// IPsForMAC returns the IPAM IPs of the namespace labeled with the MAC
+// address, of all namespaces if namespace is empty.
+func IPsForMAC(ctx context.Context, namespace string, mac net.HardwareAddr) ([]ipamv1alpha1.IP, error) {
+	key := strings.ReplaceAll(mac.String(), ":", "")
+	c, err := indexedCache(ctx, &ipamv1alpha1.IP{}, IPMACField, ipMAC)
+	if err != nil {
+		return nil, err
+	}
+
+	ips := &ipamv1alpha1.IPList{}
+	if c != nil {
+		chaos.Delay(ctx)
+		if err := c.List(ctx, ips, client.InNamespace(namespace), client.MatchingFields{IPMACField: key}); err != nil {
+			return nil, err
+		}
+		return ips.Items, nil
+	}
+
+	if err := kubeClient.List(ctx, ips, client.InNamespace(namespace), client.MatchingLabels{"mac": key}); err != nil {
+		return nil, err
+	}
+	return ips.Items, nil
+}
+
+// ServersForMAC returns the Servers having a network interface with the MAC
+// address.
+func ServersForMAC(ctx context.Context, mac net.HardwareAddr) ([]metalv1alpha1.Server, error) {
+	c, err := indexedCache(ctx, &metalv1alpha1.Server{}, ServerMACField, serverMACs)
+	if err != nil {
+		return nil, err
+	}
+
+	servers := &metalv1alpha1.ServerList{}
+	if c != nil {
+		chaos.Delay(ctx)
+		if err := c.List(ctx, servers, client.MatchingFields{ServerMACField: mac.String()}); err != nil {
+			return nil, err
+		}
+		return servers.Items, nil
+	}
+
+	// the Server status is not selectable, so all of them are listed
+	if err := kubeClient.List(ctx, servers); err != nil {
+		return nil, err
+	}
+	var matching []metalv1alpha1.Server
+	for _, server := range servers.Items {
+		if slices.Contains(serverMACs(&server), mac.String()) {
+			matching = append(matching, server)
+		}
+	}
+	return matching, nil
+}
+
+// ConfigMapsForMAC returns the ConfigMaps of the namespace carrying the
+// correlation label of the MAC address.
+func ConfigMapsForMAC(ctx context.Context, namespace string, mac net.HardwareAddr) ([]corev1.ConfigMap, error) {
+	key := strings.ReplaceAll(mac.String(), ":", "")
+	c, err := indexedCache(ctx, &corev1.ConfigMap{}, ConfigMapMACField, configMapMAC)
+	if err != nil {
+		return nil, err
+	}
+
+	configMaps := &corev1.ConfigMapList{}
+	if c != nil {
+		chaos.Delay(ctx)
+		if err := c.List(ctx, configMaps, client.InNamespace(namespace), client.MatchingFields{ConfigMapMACField: key}); err != nil {
+			return nil, err
+		}
+		return configMaps.Items, nil
+	}
+
+	if err := kubeClient.List(ctx, configMaps, client.InNamespace(namespace), client.MatchingLabels{MACLabel: key}); err != nil {
+		return nil, err
+	}
+	return configMaps.Items, nil
+}
@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package kubernetes_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes/fake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	mac   = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+	other = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5f}
+)
+
+// the lookups without a cache, as used by fedhcpsim and the plugin tests
+func TestLookupsWithoutCache(t *testing.T) {
+	var cl client.Client = fake.NewClient(
+		fake.NewIPAM("oob").WithIP("oob", "192.168.1.10", mac).WithIP("oob", "192.168.1.11", other),
+		fake.NewIPAM("inband").WithIP("inband", "2001:db8::10", mac),
+		fake.NewEndpoints().WithEndpoint("compute-1", mac, "2001:db8::10").WithEndpoint("compute-2", other, "2001:db8::11"),
+		fake.NewServers().WithServer("server-1", nil, other, mac).WithServer("server-2", nil, other),
+	)
+	for _, configMap := range []*corev1.ConfigMap{
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "metal", Name: "server-1", Labels: map[string]string{kubernetes.MACLabel: "001a2b3c4d5e"}}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "metal", Name: "server-2", Labels: map[string]string{kubernetes.MACLabel: "001a2b3c4d5f"}}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "server-1", Labels: map[string]string{kubernetes.MACLabel: "001a2b3c4d5e"}}},
+	} {
+		if err := cl.Create(context.Background(), configMap); err != nil {
+			t.Fatal(err)
+		}
+	}
+	kubernetes.SetClient(&cl)
+
+	endpoints, err := kubernetes.EndpointsForMAC(context.Background(), mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 1 || endpoints[0].Name != "compute-1" {
+		t.Errorf("expected endpoint compute-1, got %v", endpoints)
+	}
+
+	ips, err := kubernetes.IPsForMAC(context.Background(), "oob", mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ips) != 1 || ips[0].Spec.IP.String() != "192.168.1.10" {
+		t.Errorf("expected IP 192.168.1.10 of namespace oob, got %v", ips)
+	}
+
+	ips, err = kubernetes.IPsForMAC(context.Background(), "", mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ips) != 2 {
+		t.Errorf("expected the IPs of all namespaces, got %v", ips)
+	}
+
+	servers, err := kubernetes.ServersForMAC(context.Background(), mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 1 || servers[0].Name != "server-1" {
+		t.Errorf("expected server server-1, got %v", servers)
+	}
+
+	configMaps, err := kubernetes.ConfigMapsForMAC(context.Background(), "metal", mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configMaps) != 1 || configMaps[0].Name != "server-1" || configMaps[0].Namespace != "metal" {
+		t.Errorf("expected config map metal/server-1, got %v", configMaps)
+	}
+}
@@ -4,43 +4,123 @@
 package kubernetes
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"time"
 
+	"github.com/ironcore-dev/fedhcp/internal/chaos"
 	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
 	metalv1alpha1 "github.com/ironcore-dev/metal-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 )
 
+// DefaultTimeout bounds the kubernetes calls of a request, including the waits
+// for IPAM, unless configured otherwise.
+const DefaultTimeout = 15 * time.Second
+
 var (
 	scheme     = runtime.NewScheme()
 	kubeClient client.Client
-	cfg        *rest.Config
+	// watchClient watches the objects kubeClient writes, it is kubeClient
+	// unless writes are dry-run
+	watchClient client.WithWatch
+	// recordEvents is set if events are written to the cluster, not for
+	// dry-run or in-memory clients
+	recordEvents bool
+	cfg          *rest.Config
+	// ctx is cancelled on server shutdown
+	ctx = context.Background()
 )
 
 func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(ipamv1alpha1.AddToScheme(scheme))
 	utilruntime.Must(metalv1alpha1.AddToScheme(scheme))
 }
 
 func InitClient() error {
 	cfg = config.GetConfigOrDie()
-	var err error
-	kubeClient, err = client.New(cfg, client.Options{Scheme: scheme})
+	cl, err := client.NewWithWatch(cfg, client.Options{Scheme: scheme})
 	if err != nil {
 		return fmt.Errorf("failed to create controller runtime client: %w", err)
 	}
+	wrapped := chaos.WrapClient(cl)
+	kubeClient, watchClient, recordEvents = wrapped, wrapped, true
+
+	return nil
+}
+
+// InitDryRunClient initializes a client whose writes are validated by the API
+// server but never persisted.
+func InitDryRunClient() error {
+	if err := InitClient(); err != nil {
+		return err
+	}
+	kubeClient, recordEvents = client.NewDryRunClient(kubeClient), false
 
 	return nil
 }
 
-func SetClient(client *client.Client) {
-	kubeClient = *client
+// SetClient sets the client of the plugins, e.g. an in-memory one. Watches
+// are served by it if it supports them, events are not recorded. A client
+// supporting watches is wrapped for fault injection like the one of
+// InitClient.
+func SetClient(c *client.Client) {
+	kubeClient, watchClient, recordEvents = *c, nil, false
+	if w, ok := (*c).(client.WithWatch); ok {
+		watchClient = chaos.WrapClient(w)
+		kubeClient = watchClient
+	}
 }
 
 func GetClient() client.Client { return kubeClient }
 
+// GetWatchClient returns the client watching the objects written by the
+// client of GetClient.
+func GetWatchClient() client.WithWatch { return watchClient }
+
+// NewEventRecorder returns a recorder of events on the objects written by the
+// plugins, named after the host. The events are only written to the cluster
+// by the client initialized by InitClient, they are discarded otherwise.
+func NewEventRecorder() (record.EventRecorder, error) {
+	if !recordEvents {
+		return &record.FakeRecorder{}, nil
+	}
+	corev1Client, err := corev1client.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create core client: %w", err)
+	}
+	// Leader id, needs to be unique
+	id, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %w", err)
+	}
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&corev1client.EventSinkImpl{Interface: corev1Client.Events("")})
+	return broadcaster.NewRecorder(scheme, corev1.EventSource{Component: id}), nil
+}
+
+// SetContext sets the context cancelled on server shutdown. It shall be set
+// before the plugins are set up.
+func SetContext(c context.Context) {
+	ctx = c
+}
+
+// Context returns the context cancelled on server shutdown, the kubernetes
+// calls of a request derive their context from it, so that shutdown
+// interrupts them.
+func Context() context.Context { return ctx }
+
 func GetConfig() *rest.Config { return cfg }
+
+// GetScheme returns the scheme holding all types FeDHCP works with.
+func GetScheme() *runtime.Scheme { return scheme }
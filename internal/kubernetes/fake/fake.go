@@ -0,0 +1,175 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package fake provides an in-memory kubernetes client and builders for the
+// IPAM and metal objects FeDHCP works with, so that plugins can be unit tested
+// without a control plane. Integration tests keep using envtest.
+package fake
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
+	metalv1alpha1 "github.com/ironcore-dev/metal-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// ObjectSource provides objects the fake client is seeded with.
+type ObjectSource interface {
+	Objects() []client.Object
+}
+
+// NewClient returns a fake client holding the objects of the given sources. Status
+// subresources behave as on a real API server, so plugins updating them are covered.
+func NewClient(sources ...ObjectSource) client.WithWatch {
+	builder := fake.NewClientBuilder().
+		WithScheme(kubernetes.GetScheme()).
+		WithStatusSubresource(&ipamv1alpha1.IP{}, &ipamv1alpha1.Subnet{}, &metalv1alpha1.Endpoint{}, &metalv1alpha1.Server{})
+	for _, source := range sources {
+		builder = builder.WithObjects(source.Objects()...)
+	}
+	return builder.Build()
+}
+
+// IPAM builds the subnets and IPs of a namespace.
+type IPAM struct {
+	namespace string
+	objects   []client.Object
+}
+
+// NewIPAM returns an empty IPAM builder for the namespace.
+func NewIPAM(namespace string) *IPAM {
+	return &IPAM{namespace: namespace}
+}
+
+// WithSubnet adds a reserved subnet with the given CIDR and labels.
+func (i *IPAM) WithSubnet(name, cidr string, labels map[string]string) *IPAM {
+	reserved, err := ipamv1alpha1.CIDRFromString(cidr)
+	if err != nil {
+		panic(fmt.Sprintf("invalid CIDR %s: %v", cidr, err))
+	}
+	subnetType := ipamv1alpha1.CIPv4SubnetType
+	if reserved.Net.Addr().Is6() {
+		subnetType = ipamv1alpha1.CIPv6SubnetType
+	}
+
+	i.objects = append(i.objects, &ipamv1alpha1.Subnet{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: i.namespace,
+			Name:      name,
+			Labels:    labels,
+		},
+		Spec: ipamv1alpha1.SubnetSpec{
+			CIDR: reserved,
+		},
+		Status: ipamv1alpha1.SubnetStatus{
+			Type:     subnetType,
+			Reserved: reserved,
+			State:    ipamv1alpha1.CFinishedSubnetState,
+		},
+	})
+	return i
+}
+
+// WithIP adds an IP reserved for the MAC address in the given subnet, labeled
+// the way the oob and ipam plugins label the IPs they create.
+func (i *IPAM) WithIP(subnet, address string, mac net.HardwareAddr) *IPAM {
+	reserved, err := ipamv1alpha1.IPAddrFromString(address)
+	if err != nil {
+		panic(fmt.Sprintf("invalid IP address %s: %v", address, err))
+	}
+	macKey := strings.ReplaceAll(mac.String(), ":", "")
+
+	i.objects = append(i.objects, &ipamv1alpha1.IP{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: i.namespace,
+			Name:      macKey + "-" + strings.NewReplacer(".", "-", ":", "-").Replace(address),
+			Labels: map[string]string{
+				"mac": macKey,
+			},
+		},
+		Spec: ipamv1alpha1.IPSpec{
+			Subnet: corev1.LocalObjectReference{Name: subnet},
+			IP:     reserved,
+		},
+		Status: ipamv1alpha1.IPStatus{
+			State:    ipamv1alpha1.CFinishedIPState,
+			Reserved: reserved,
+		},
+	})
+	return i
+}
+
+// Objects returns the subnets and IPs added so far.
+func (i *IPAM) Objects() []client.Object {
+	return i.objects
+}
+
+// Endpoints builds metal endpoints.
+type Endpoints struct {
+	objects []client.Object
+}
+
+// NewEndpoints returns an empty endpoint builder.
+func NewEndpoints() *Endpoints {
+	return &Endpoints{}
+}
+
+// WithEndpoint adds an endpoint for the MAC address with the given IP address.
+func (e *Endpoints) WithEndpoint(name string, mac net.HardwareAddr, ip string) *Endpoints {
+	e.objects = append(e.objects, &metalv1alpha1.Endpoint{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: metalv1alpha1.EndpointSpec{
+			MACAddress: mac.String(),
+			IP:         metalv1alpha1.MustParseIP(ip),
+		},
+	})
+	return e
+}
+
+// Objects returns the endpoints added so far.
+func (e *Endpoints) Objects() []client.Object {
+	return e.objects
+}
+
+// Servers builds metal servers.
+type Servers struct {
+	objects []client.Object
+}
+
+// NewServers returns an empty server builder.
+func NewServers() *Servers {
+	return &Servers{}
+}
+
+// WithServer adds a server with the labels and a network interface per MAC
+// address.
+func (s *Servers) WithServer(name string, labels map[string]string, macs ...net.HardwareAddr) *Servers {
+	server := &metalv1alpha1.Server{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+	}
+	for i, mac := range macs {
+		server.Status.NetworkInterfaces = append(server.Status.NetworkInterfaces, metalv1alpha1.NetworkInterface{
+			Name:       fmt.Sprintf("eth%d", i),
+			MACAddress: mac.String(),
+		})
+	}
+	s.objects = append(s.objects, server)
+	return s
+}
+
+// Objects returns the servers added so far.
+func (s *Servers) Objects() []client.Object {
+	return s.objects
+}
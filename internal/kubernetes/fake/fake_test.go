@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package fake
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
+	metalv1alpha1 "github.com/ironcore-dev/metal-operator/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var mac = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+
+func TestNewClient(t *testing.T) {
+	cl := NewClient(
+		NewIPAM("default").
+			WithSubnet("oob", "192.168.0.0/24", map[string]string{"role": "oob"}).
+			WithIP("oob", "192.168.0.10", mac),
+		NewEndpoints().
+			WithEndpoint("compute-1", mac, "10.0.0.1"),
+	)
+	ctx := context.Background()
+
+	subnets := &ipamv1alpha1.SubnetList{}
+	if err := cl.List(ctx, subnets, client.InNamespace("default"), client.MatchingLabels{"role": "oob"}); err != nil {
+		t.Fatalf("listing subnets: %v", err)
+	}
+	if len(subnets.Items) != 1 || subnets.Items[0].Status.Type != ipamv1alpha1.CIPv4SubnetType {
+		t.Errorf("expected one IPv4 subnet, got %+v", subnets.Items)
+	}
+
+	ips := &ipamv1alpha1.IPList{}
+	if err := cl.List(ctx, ips, client.MatchingLabels{"mac": "001a2b3c4d5e"}); err != nil {
+		t.Fatalf("listing IPs: %v", err)
+	}
+	if len(ips.Items) != 1 || ips.Items[0].Status.Reserved.String() != "192.168.0.10" {
+		t.Errorf("expected IP 192.168.0.10, got %+v", ips.Items)
+	}
+
+	endpoint := &metalv1alpha1.Endpoint{}
+	if err := cl.Get(ctx, client.ObjectKey{Name: "compute-1"}, endpoint); err != nil {
+		t.Fatalf("getting endpoint: %v", err)
+	}
+	if endpoint.Spec.MACAddress != mac.String() {
+		t.Errorf("expected MAC address %s, got %s", mac, endpoint.Spec.MACAddress)
+	}
+}
+
+func TestInvalidCIDR(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for an invalid CIDR")
+		}
+	}()
+	NewIPAM("default").WithSubnet("broken", "not-a-cidr", nil)
+}
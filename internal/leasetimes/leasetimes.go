@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package leasetimes validates lease times and applies them to replies, with
+// the DHCPv6 defaults recommended by RFC 8415.
+package leasetimes
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+)
+
+// Validate checks the times are consistent, i.e. T1 <= T2 <= preferred <= valid lifetime.
+func Validate(times api.LeaseTimes) error {
+	if times.LeaseTime <= 0 {
+		return fmt.Errorf("leaseTime must be positive")
+	}
+	preferred := times.PreferredLifetime
+	if preferred == 0 {
+		preferred = times.LeaseTime
+	}
+	if preferred > times.LeaseTime {
+		return fmt.Errorf("preferredLifetime %s exceeds leaseTime %s", preferred, times.LeaseTime)
+	}
+	if times.T1 != 0 && times.T2 != 0 && times.T1 > times.T2 {
+		return fmt.Errorf("t1 %s exceeds t2 %s", times.T1, times.T2)
+	}
+	if times.T2 > preferred || times.T1 > preferred {
+		return fmt.Errorf("t1 and t2 must not exceed the preferred lifetime %s", preferred)
+	}
+	return nil
+}
+
+// DHCPv6 returns the valid and preferred lifetimes and T1 and T2 of the
+// times, with the defaults recommended by RFC 8415.
+func DHCPv6(times api.LeaseTimes) (valid, preferred, t1, t2 time.Duration) {
+	valid, preferred, t1, t2 = times.LeaseTime, times.PreferredLifetime, times.T1, times.T2
+	if preferred == 0 {
+		preferred = valid
+	}
+	if t1 == 0 {
+		t1 = preferred / 2
+	}
+	if t2 == 0 {
+		t2 = preferred * 4 / 5
+	}
+	return valid, preferred, t1, t2
+}
+
+// Apply4 sets the lease time of a DHCPv4 reply, and T1 and T2 if configured.
+func Apply4(resp *dhcpv4.DHCPv4, times api.LeaseTimes) {
+	resp.UpdateOption(dhcpv4.OptIPAddressLeaseTime(times.LeaseTime))
+	if times.T1 != 0 {
+		resp.UpdateOption(dhcpv4.OptRenewTimeValue(times.T1))
+	}
+	if times.T2 != 0 {
+		resp.UpdateOption(dhcpv4.OptRebindingTimeValue(times.T2))
+	}
+}
+
+// Apply6 sets T1 and T2 of the IA_NAs and IA_PDs of a DHCPv6 reply and the
+// lifetimes of their addresses and prefixes.
+func Apply6(reply *dhcpv6.Message, times api.LeaseTimes) {
+	valid, preferred, t1, t2 := DHCPv6(times)
+	for _, iana := range reply.Options.IANA() {
+		iana.T1, iana.T2 = t1, t2
+		for _, ia := range iana.Options.Addresses() {
+			ia.ValidLifetime, ia.PreferredLifetime = valid, preferred
+		}
+	}
+	for _, iapd := range reply.Options.IAPD() {
+		iapd.T1, iapd.T2 = t1, t2
+		for _, prefix := range iapd.Options.Prefixes() {
+			prefix.ValidLifetime, prefix.PreferredLifetime = valid, preferred
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package links relates the IPAM IPs and the Endpoint of a MAC address by a
+// shared correlation label and, optionally, owner references, so that garbage
+// collection and UI tooling show which objects belong together.
+package links
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
+	metalv1alpha1 "github.com/ironcore-dev/metal-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Label is the correlation label of the IPs and the Endpoint, its value is
+// the MAC address without separators, like the mac label of the IPs.
+const Label = "fedhcp.ironcore.dev/mac"
+
+// Linker links the objects of a MAC address.
+type Linker struct {
+	// endpointOwnsIPs sets an owner reference to the Endpoint on the IPs
+	endpointOwnsIPs bool
+}
+
+// New returns the linker of the config, or nil if linking is disabled.
+func New(config api.Links) (*Linker, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	switch config.Owner {
+	case "", api.LinkOwnerNone:
+		return &Linker{}, nil
+	case api.LinkOwnerEndpoint:
+		return &Linker{endpointOwnsIPs: true}, nil
+	case api.LinkOwnerIP:
+		return nil, fmt.Errorf("owner %s is not supported: a cluster-scoped Endpoint cannot be owned by a namespaced IP", config.Owner)
+	default:
+		return nil, fmt.Errorf("unknown owner %s, must be %s or %s", config.Owner, api.LinkOwnerNone, api.LinkOwnerEndpoint)
+	}
+}
+
+// String describes the linker for config diffs.
+func (l *Linker) String() string {
+	switch {
+	case l == nil:
+		return "disabled"
+	case l.endpointOwnsIPs:
+		return "owner " + api.LinkOwnerEndpoint
+	default:
+		return "label"
+	}
+}
+
+// Link labels the IPs and the Endpoint of the MAC address and, if configured,
+// makes the Endpoint own the IPs. Nothing is done unless both exist, so it is
+// called again once the other object has been created.
+func (l *Linker) Link(ctx context.Context, cl client.Client, mac net.HardwareAddr) error {
+	if l == nil {
+		return nil
+	}
+	value := strings.ReplaceAll(strings.ToLower(mac.String()), ":", "")
+
+	ips := &ipamv1alpha1.IPList{}
+	if err := cl.List(ctx, ips, client.MatchingLabels{"mac": value}); err != nil {
+		return fmt.Errorf("failed to list IPs: %w", fedhcperrors.FromK8s(err))
+	}
+	endpoints := &metalv1alpha1.EndpointList{}
+	if err := cl.List(ctx, endpoints); err != nil {
+		return fmt.Errorf("failed to list Endpoints: %w", fedhcperrors.FromK8s(err))
+	}
+	var endpoint *metalv1alpha1.Endpoint
+	for i := range endpoints.Items {
+		if strings.EqualFold(endpoints.Items[i].Spec.MACAddress, mac.String()) {
+			endpoint = &endpoints.Items[i]
+			break
+		}
+	}
+	if endpoint == nil || len(ips.Items) == 0 {
+		return nil
+	}
+
+	if endpoint.Labels[Label] != value {
+		base := endpoint.DeepCopy()
+		if endpoint.Labels == nil {
+			endpoint.Labels = make(map[string]string)
+		}
+		endpoint.Labels[Label] = value
+		if err := cl.Patch(ctx, endpoint, client.MergeFrom(base)); err != nil {
+			return fmt.Errorf("failed to label Endpoint %s: %w", endpoint.Name, fedhcperrors.FromK8s(err))
+		}
+	}
+
+	owner := metav1.OwnerReference{
+		APIVersion: metalv1alpha1.GroupVersion.String(),
+		Kind:       "Endpoint",
+		Name:       endpoint.Name,
+		UID:        endpoint.UID,
+	}
+	for i := range ips.Items {
+		ip := &ips.Items[i]
+		base := ip.DeepCopy()
+		// the IPs carry the mac label they are listed by
+		ip.Labels[Label] = value
+		if l.endpointOwnsIPs && !ownedBy(ip, owner) {
+			ip.OwnerReferences = append(ip.OwnerReferences, owner)
+		}
+		if ip.Labels[Label] == base.Labels[Label] && len(ip.OwnerReferences) == len(base.OwnerReferences) {
+			continue
+		}
+		if err := cl.Patch(ctx, ip, client.MergeFrom(base)); err != nil {
+			return fmt.Errorf("failed to link IP %s/%s: %w", ip.Namespace, ip.Name, fedhcperrors.FromK8s(err))
+		}
+	}
+	return nil
+}
+
+func ownedBy(obj metav1.Object, owner metav1.OwnerReference) bool {
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.Kind == owner.Kind && ref.Name == owner.Name && ref.UID == owner.UID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package links
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes/fake"
+	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
+	metalv1alpha1 "github.com/ironcore-dev/metal-operator/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	mac   = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+	other = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5f}
+)
+
+func TestNew(t *testing.T) {
+	if l, err := New(api.Links{Owner: api.LinkOwnerEndpoint}); l != nil || err != nil {
+		t.Errorf("expected no linker when disabled, got %v, %v", l, err)
+	}
+	for _, owner := range []string{api.LinkOwnerIP, "foo"} {
+		if _, err := New(api.Links{Enabled: true, Owner: owner}); err == nil {
+			t.Errorf("no error occurred when providing owner %s, but it should have", owner)
+		}
+	}
+}
+
+func TestLink(t *testing.T) {
+	for _, tc := range []struct {
+		owner       string
+		expectOwned bool
+	}{
+		{"", false},
+		{api.LinkOwnerEndpoint, true},
+	} {
+		cl := fake.NewClient(
+			fake.NewIPAM("ipam").WithIP("oob", "2001:db8::10", mac).WithIP("oob", "2001:db8::11", other),
+			fake.NewEndpoints().WithEndpoint("compute-1", mac, "2001:db8::10"),
+		)
+		l, err := New(api.Links{Enabled: true, Owner: tc.owner})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// linking twice must not add a second owner reference
+		for range 2 {
+			if err := l.Link(context.Background(), cl, mac); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		endpoint := &metalv1alpha1.Endpoint{}
+		if err := cl.Get(context.Background(), client.ObjectKey{Name: "compute-1"}, endpoint); err != nil {
+			t.Fatal(err)
+		}
+		if endpoint.Labels[Label] != "001a2b3c4d5e" {
+			t.Errorf("owner %q: expected the endpoint to be labeled, got %v", tc.owner, endpoint.Labels)
+		}
+
+		ips := &ipamv1alpha1.IPList{}
+		if err := cl.List(context.Background(), ips); err != nil {
+			t.Fatal(err)
+		}
+		for _, ip := range ips.Items {
+			linked := ip.Labels["mac"] == "001a2b3c4d5e"
+			if (ip.Labels[Label] != "") != linked {
+				t.Errorf("owner %q: expected IP %s to be labeled: %t, got %v", tc.owner, ip.Name, linked, ip.Labels)
+			}
+			owned := len(ip.OwnerReferences) == 1 && ip.OwnerReferences[0].Name == "compute-1"
+			if owned != (linked && tc.expectOwned) || len(ip.OwnerReferences) > 1 {
+				t.Errorf("owner %q: unexpected owner references of IP %s: %v", tc.owner, ip.Name, ip.OwnerReferences)
+			}
+		}
+	}
+}
+
+func TestLinkWithoutEndpoint(t *testing.T) {
+	cl := fake.NewClient(fake.NewIPAM("ipam").WithIP("oob", "2001:db8::10", mac))
+	l, _ := New(api.Links{Enabled: true, Owner: api.LinkOwnerEndpoint})
+	if err := l.Link(context.Background(), cl, mac); err != nil {
+		t.Fatal(err)
+	}
+
+	ip := &ipamv1alpha1.IP{}
+	if err := cl.Get(context.Background(), client.ObjectKey{Namespace: "ipam", Name: "001a2b3c4d5e-2001-db8--10"}, ip); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ip.Labels[Label]; ok || len(ip.OwnerReferences) > 0 {
+		t.Errorf("expected the IP to be left alone without an endpoint, got %v", ip.ObjectMeta)
+	}
+}
@@ -0,0 +1,38 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package metrics holds the Prometheus registry of FeDHCP. Collectors are
+// registered with Register, they are exposed under /metrics on the admin API.
+package metrics
+
+import (
+	"sync"
+
+	"github.com/ironcore-dev/fedhcp/internal/admin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace prefixes all FeDHCP metric names.
+const Namespace = "fedhcp"
+
+var (
+	registry = prometheus.NewRegistry()
+	once     sync.Once
+)
+
+// Register registers the collectors and exposes the registry on the admin API.
+// Collectors already registered are skipped, so plugins with several instances
+// may register the same collectors repeatedly.
+func Register(collectors ...prometheus.Collector) {
+	once.Do(func() {
+		admin.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	})
+	for _, c := range collectors {
+		if err := registry.Register(c); err != nil {
+			if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+				panic(err)
+			}
+		}
+	}
+}
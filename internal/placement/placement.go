@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package placement looks up the physical placement of a client, the rack and
+// pool of the metal-operator Server owning its MAC address, so that responses
+// can vary by placement without configuring each machine. The rack and pool
+// are read from labels of the Server.
+package placement
+
+import (
+	"context"
+	"net"
+
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+)
+
+const (
+	// DefaultRackLabel is the Server label holding the rack, unless configured otherwise.
+	DefaultRackLabel = "rack"
+	// DefaultPoolLabel is the Server label holding the pool, unless configured otherwise.
+	DefaultPoolLabel = "pool"
+)
+
+// Placement is the physical placement of a client, its fields are empty if
+// unknown.
+type Placement struct {
+	Rack string
+	Pool string
+}
+
+// Resolver looks up placements by the labels of the Servers.
+type Resolver struct {
+	rackLabel string
+	poolLabel string
+}
+
+// New returns a resolver reading the rack and pool from the given Server
+// labels, empty ones fall back to the defaults.
+func New(rackLabel, poolLabel string) *Resolver {
+	if rackLabel == "" {
+		rackLabel = DefaultRackLabel
+	}
+	if poolLabel == "" {
+		poolLabel = DefaultPoolLabel
+	}
+	return &Resolver{rackLabel: rackLabel, poolLabel: poolLabel}
+}
+
+// Of returns the placement of the client with the MAC address, which is empty
+// if no Server has a network interface with it. If several Servers have, the
+// first labeled one wins.
+func (r *Resolver) Of(mac net.HardwareAddr) (Placement, error) {
+	if len(mac) == 0 {
+		return Placement{}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(kubernetes.Context(), kubernetes.DefaultTimeout)
+	defer cancel()
+	servers, err := kubernetes.ServersForMAC(ctx, mac)
+	if err != nil {
+		return Placement{}, err
+	}
+
+	var p Placement
+	for _, server := range servers {
+		if p.Rack == "" {
+			p.Rack = server.Labels[r.rackLabel]
+		}
+		if p.Pool == "" {
+			p.Pool = server.Labels[r.poolLabel]
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package placement
+
+import (
+	"net"
+	"testing"
+
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	mac      = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+	bmcMAC   = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5f}
+	otherMAC = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x60}
+)
+
+func TestOf(t *testing.T) {
+	var cl client.Client = fake.NewClient(fake.NewServers().
+		WithServer("compute-1", map[string]string{"rack": "r12", "pool": "compute"}, mac).
+		WithServer("compute-2", map[string]string{"example.com/rack": "r13"}, bmcMAC))
+	kubernetes.SetClient(&cl)
+
+	for _, tc := range []struct {
+		resolver *Resolver
+		mac      net.HardwareAddr
+		expected Placement
+	}{
+		{New("", ""), mac, Placement{Rack: "r12", Pool: "compute"}},
+		{New("", ""), bmcMAC, Placement{}},
+		{New("example.com/rack", ""), bmcMAC, Placement{Rack: "r13"}},
+		{New("", ""), otherMAC, Placement{}},
+		{New("", ""), nil, Placement{}},
+	} {
+		p, err := tc.resolver.Of(tc.mac)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p != tc.expected {
+			t.Errorf("expected placement %+v of %s, got %+v", tc.expected, tc.mac, p)
+		}
+	}
+}
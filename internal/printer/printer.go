@@ -0,0 +1,142 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package printer logs the summaries of requests and responses at debug
+// level. Complete summaries of every message are enormous under load, so they
+// can be sampled by transaction, limited per client and truncated.
+package printer
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/cache"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// window is the period the summaries per client are limited in
+	window = time.Minute
+	// maxClients bounds the clients whose summaries are counted
+	maxClients = 100000
+)
+
+// Config throttles the summaries, the zero value logs all of them in full.
+type Config struct {
+	// Every logs the summaries of every Nth transaction only, all if 0 or 1
+	Every uint32
+	// PerMAC limits the summaries logged per client MAC address and minute, unlimited if 0
+	PerMAC int
+	// MaxLength truncates summaries longer than this, unlimited if 0
+	MaxLength int
+}
+
+type summarizer interface {
+	Summary() string
+}
+
+var (
+	// mu guards config and counts
+	mu     sync.RWMutex
+	config Config
+	// counts holds the summaries logged per client within the window
+	counts *cache.Cache[string, *atomic.Int32]
+)
+
+// Configure sets how the summaries are throttled, for all plugins.
+func Configure(c Config) {
+	mu.Lock()
+	defer mu.Unlock()
+	config = c
+	counts = nil
+	if c.PerMAC > 0 {
+		counts = cache.New[string, *atomic.Int32]("printer", maxClients, window)
+	}
+}
+
+// sampled reports whether the transaction is sampled. Sampling by transaction
+// keeps the request and response summaries of a transaction together.
+func sampled(xid uint32, every uint32) bool {
+	return every <= 1 || xid%every == 0
+}
+
+// admit reports whether another summary of the client may be logged.
+func admit(mac net.HardwareAddr, perMAC int, counts *cache.Cache[string, *atomic.Int32]) bool {
+	if counts == nil {
+		return true
+	}
+	key := mac.String()
+	count, ok := counts.Get(key)
+	if !ok {
+		count = &atomic.Int32{}
+		counts.Put(key, count)
+	}
+	return int(count.Add(1)) <= perMAC
+}
+
+// truncate cuts a summary to maxLength.
+func truncate(summary string, maxLength int) string {
+	if maxLength <= 0 || len(summary) <= maxLength {
+		return summary
+	}
+	return fmt.Sprintf("%s... (%d bytes truncated)", summary[:maxLength], len(summary)-maxLength)
+}
+
+// transaction returns the transaction ID and client MAC address of a request.
+func transaction(req summarizer) (uint32, net.HardwareAddr) {
+	switch req := req.(type) {
+	case *dhcpv4.DHCPv4:
+		xid := req.TransactionID
+		return uint32(xid[0])<<24 | uint32(xid[1])<<16 | uint32(xid[2])<<8 | uint32(xid[3]), req.ClientHWAddr
+	case dhcpv6.DHCPv6:
+		mac, _ := dhcpv6.ExtractMAC(req)
+		m, err := req.GetInnerMessage()
+		if err != nil {
+			return 0, mac
+		}
+		xid := m.TransactionID
+		return uint32(xid[0])<<16 | uint32(xid[1])<<8 | uint32(xid[2]), mac
+	default:
+		return 0, nil
+	}
+}
+
+// Verbose logs the summary of msg, a request or the response to req, with a
+// format holding a single %s, if the transaction of req is sampled and the
+// limit of its client is not exceeded.
+func Verbose(log *logrus.Entry, req summarizer, format string, msg summarizer) {
+	if !log.Logger.IsLevelEnabled(logrus.DebugLevel) {
+		return
+	}
+	mu.RLock()
+	c, counts := config, counts
+	mu.RUnlock()
+
+	xid, mac := transaction(req)
+	if !sampled(xid, c.Every) || !admit(mac, c.PerMAC, counts) {
+		return
+	}
+	log.Debugf(format, truncate(msg.Summary(), c.MaxLength))
+}
+
+func family(msg summarizer) string {
+	if _, ok := msg.(*dhcpv4.DHCPv4); ok {
+		return "DHCPv4"
+	}
+	return "DHCPv6"
+}
+
+// VerboseRequest logs the summary of a request, see Verbose.
+func VerboseRequest(log *logrus.Entry, req summarizer) {
+	Verbose(log, req, "Received "+family(req)+" request: %s", req)
+}
+
+// VerboseResponse logs the summary of the response to a request, see Verbose.
+func VerboseResponse(log *logrus.Entry, req, resp summarizer) {
+	Verbose(log, req, "Sent "+family(req)+" response: %s", resp)
+}
@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package printer
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+var mac = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+
+func newLogger() (*logrus.Entry, *test.Hook) {
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	return logrus.NewEntry(logger), hook
+}
+
+func newRequest4(t *testing.T, xid byte) *dhcpv4.DHCPv4 {
+	req, err := dhcpv4.NewDiscovery(mac, dhcpv4.WithTransactionID(dhcpv4.TransactionID{0, 0, 0, xid}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestUnthrottled(t *testing.T) {
+	Configure(Config{})
+	log, hook := newLogger()
+
+	req := newRequest4(t, 1)
+	VerboseRequest(log, req)
+	VerboseResponse(log, req, req)
+	if len(hook.AllEntries()) != 2 {
+		t.Fatalf("expected 2 summaries, got %d", len(hook.AllEntries()))
+	}
+	if msg := hook.AllEntries()[0].Message; !strings.HasPrefix(msg, "Received DHCPv4 request: ") || !strings.HasSuffix(msg, req.Summary()) {
+		t.Errorf("unexpected summary %q", msg)
+	}
+
+	log.Logger.SetLevel(logrus.InfoLevel)
+	VerboseRequest(log, req)
+	if len(hook.AllEntries()) != 2 {
+		t.Error("expected no summaries above debug level")
+	}
+}
+
+func TestSampled(t *testing.T) {
+	Configure(Config{Every: 4})
+	log, hook := newLogger()
+
+	for xid := byte(0); xid < 8; xid++ {
+		req := newRequest4(t, xid)
+		VerboseRequest(log, req)
+		VerboseResponse(log, req, req)
+	}
+	// the request and response of transactions 0 and 4
+	if len(hook.AllEntries()) != 4 {
+		t.Errorf("expected 4 summaries, got %d", len(hook.AllEntries()))
+	}
+
+	req, err := dhcpv6.NewSolicit(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.TransactionID = dhcpv6.TransactionID{0, 0, 5}
+	VerboseRequest(log, req)
+	req.TransactionID = dhcpv6.TransactionID{0, 0, 8}
+	VerboseRequest(log, req)
+	if len(hook.AllEntries()) != 5 || !strings.HasPrefix(hook.LastEntry().Message, "Received DHCPv6 request: ") {
+		t.Errorf("expected only DHCPv6 transaction 8 to be sampled, got %d summaries", len(hook.AllEntries()))
+	}
+}
+
+func TestPerMAC(t *testing.T) {
+	Configure(Config{PerMAC: 3})
+	log, hook := newLogger()
+
+	for xid := byte(0); xid < 5; xid++ {
+		VerboseRequest(log, newRequest4(t, xid))
+	}
+	other := newRequest4(t, 0)
+	other.ClientHWAddr = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5f}
+	VerboseRequest(log, other)
+
+	if len(hook.AllEntries()) != 4 {
+		t.Errorf("expected 3 summaries of the first and 1 of the other client, got %d", len(hook.AllEntries()))
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	Configure(Config{MaxLength: 10})
+	log, hook := newLogger()
+
+	req := newRequest4(t, 1)
+	VerboseRequest(log, req)
+	expected := "Received DHCPv4 request: " + req.Summary()[:10] + "... ("
+	if msg := hook.LastEntry().Message; !strings.HasPrefix(msg, expected) || !strings.HasSuffix(msg, " bytes truncated)") {
+		t.Errorf("expected truncated summary, got %q", msg)
+	}
+}
@@ -0,0 +1,142 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package rawopts gives plugins access to options as they are on the wire: to
+// inspect the options of a request the dhcp library does not know, e.g. those
+// of a vendor, and to add options to a response from their code and payload,
+// e.g. as given in a config, without an option type of their own.
+package rawopts
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+// MaxCode4 is the highest DHCPv4 option code carrying a payload, 255 ends the
+// options.
+const MaxCode4 = 254
+
+// Option is an option as on the wire.
+type Option struct {
+	Code uint16
+	Data []byte
+}
+
+func (o Option) String() string {
+	return fmt.Sprintf("%d: %x", o.Code, o.Data)
+}
+
+// known4 holds the DHCPv4 option codes the dhcp library has a name for.
+var known4 = func() [256]bool {
+	var known [256]bool
+	for code := dhcpv4.OptionPad; ; code++ {
+		known[code.Code()] = !strings.HasPrefix(code.String(), "unknown")
+		if code == dhcpv4.OptionEnd {
+			return known
+		}
+	}
+}()
+
+// Unknown4 returns the options of a DHCPv4 message the dhcp library does not
+// know, ordered by code.
+func Unknown4(m *dhcpv4.DHCPv4) []Option {
+	var unknown []Option
+	for code, data := range m.Options {
+		if !known4[code] {
+			unknown = append(unknown, Option{Code: uint16(code), Data: data})
+		}
+	}
+	slices.SortFunc(unknown, func(a, b Option) int {
+		return int(a.Code) - int(b.Code)
+	})
+	return unknown
+}
+
+// Unknown6 returns the options of a DHCPv6 message the dhcp library does not
+// know, i.e. those it could not parse into an option type, in their order.
+func Unknown6(m *dhcpv6.Message) []Option {
+	var unknown []Option
+	for _, o := range m.Options.Options {
+		if generic, ok := o.(*dhcpv6.OptionGeneric); ok {
+			unknown = append(unknown, Option{Code: uint16(generic.OptionCode), Data: generic.OptionData})
+		}
+	}
+	return unknown
+}
+
+// Has4 reports whether a DHCPv4 message carries the option.
+func Has4(m *dhcpv4.DHCPv4, code uint16) bool {
+	return code <= MaxCode4 && m.Options.Has(dhcpv4.GenericOptionCode(code))
+}
+
+// Has6 reports whether a DHCPv6 message carries the option.
+func Has6(m *dhcpv6.Message, code uint16) bool {
+	return m.Options.GetOne(dhcpv6.OptionCode(code)) != nil
+}
+
+// Get4 returns the payload of a DHCPv4 option, or nil if the message does not
+// carry it.
+func Get4(m *dhcpv4.DHCPv4, code uint16) []byte {
+	if code > MaxCode4 {
+		return nil
+	}
+	return m.Options.Get(dhcpv4.GenericOptionCode(code))
+}
+
+// Get6 returns the payloads of all DHCPv6 options of the code a message
+// carries, whether the dhcp library knows them or not.
+func Get6(m *dhcpv6.Message, code uint16) [][]byte {
+	var data [][]byte
+	for _, o := range m.Options.Get(dhcpv6.OptionCode(code)) {
+		data = append(data, o.ToBytes())
+	}
+	return data
+}
+
+// Add4 adds an option to a DHCPv4 message, replacing the option of the same
+// code as DHCPv4 carries each option once.
+func Add4(m *dhcpv4.DHCPv4, o Option) error {
+	if o.Code == 0 || o.Code > MaxCode4 {
+		return fmt.Errorf("invalid DHCPv4 option code %d", o.Code)
+	}
+	m.UpdateOption(dhcpv4.OptGeneric(dhcpv4.GenericOptionCode(o.Code), o.Data))
+	return nil
+}
+
+// Add6 appends an option to a DHCPv6 message.
+func Add6(m dhcpv6.DHCPv6, o Option) error {
+	if o.Code == 0 {
+		return fmt.Errorf("invalid DHCPv6 option code %d", o.Code)
+	}
+	m.AddOption(&dhcpv6.OptionGeneric{OptionCode: dhcpv6.OptionCode(o.Code), OptionData: o.Data})
+	return nil
+}
+
+// Decode decodes a payload given as hex or base64 encoded bytes; exactly one
+// of them shall be set.
+func Decode(hexData, base64Data string) ([]byte, error) {
+	switch {
+	case hexData != "" && base64Data != "":
+		return nil, fmt.Errorf("payload must be either hex or base64, not both")
+	case hexData != "":
+		data, err := hex.DecodeString(hexData)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex payload: %w", err)
+		}
+		return data, nil
+	case base64Data != "":
+		data, err := base64.StdEncoding.DecodeString(base64Data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 payload: %w", err)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("payload must be given as hex or base64")
+	}
+}
@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package rawopts
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+var mac = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+
+func TestUnknown4(t *testing.T) {
+	req, err := dhcpv4.NewDiscovery(mac,
+		dhcpv4.WithGeneric(dhcpv4.GenericOptionCode(230), []byte{0x02}),
+		dhcpv4.WithGeneric(dhcpv4.GenericOptionCode(224), []byte{0x01}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unknown := Unknown4(req)
+	if len(unknown) != 2 || unknown[0].Code != 224 || unknown[1].Code != 230 {
+		t.Fatalf("expected unknown options 224 and 230, got %v", unknown)
+	}
+	if !Has4(req, 224) || !bytes.Equal(Get4(req, 224), []byte{0x01}) {
+		t.Errorf("expected option 224 with payload 01, got %x", Get4(req, 224))
+	}
+	if Has4(req, 225) || Get4(req, 300) != nil {
+		t.Error("expected no options 225 and 300")
+	}
+}
+
+func TestUnknown6(t *testing.T) {
+	req, err := dhcpv6.NewSolicit(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.AddOption(&dhcpv6.OptionGeneric{OptionCode: 65000, OptionData: []byte{0x01, 0x02}})
+	// parse the message, as a server does, for the known options to be typed
+	m, err := dhcpv6.MessageFromBytes(req.ToBytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unknown := Unknown6(m)
+	if len(unknown) != 1 || unknown[0].Code != 65000 || !bytes.Equal(unknown[0].Data, []byte{0x01, 0x02}) {
+		t.Fatalf("expected unknown option 65000, got %v", unknown)
+	}
+	if !Has6(m, uint16(dhcpv6.OptionClientID)) || len(Get6(m, uint16(dhcpv6.OptionClientID))) != 1 {
+		t.Error("expected the known client ID option to be found by its code")
+	}
+}
+
+func TestAdd(t *testing.T) {
+	resp4, err := dhcpv4.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Add4(resp4, Option{Code: 224, Data: []byte{0x01}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Add4(resp4, Option{Code: 224, Data: []byte{0x02}}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(Get4(resp4, 224), []byte{0x02}) {
+		t.Errorf("expected option 224 to be replaced, got %x", Get4(resp4, 224))
+	}
+	if err := Add4(resp4, Option{Code: 255}); err == nil {
+		t.Error("no error occurred when adding DHCPv4 option 255, but it should have")
+	}
+
+	resp6, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range [][]byte{{0x01}, {0x02}} {
+		if err := Add6(resp6, Option{Code: 65000, Data: data}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := Get6(resp6, 65000); len(got) != 2 {
+		t.Errorf("expected both options 65000, got %x", got)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	for _, tc := range []struct {
+		hex, base64 string
+		expected    []byte
+	}{
+		{hex: "0a0b", expected: []byte{0x0a, 0x0b}},
+		{base64: "Cgs=", expected: []byte{0x0a, 0x0b}},
+	} {
+		data, err := Decode(tc.hex, tc.base64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, tc.expected) {
+			t.Errorf("expected %x, got %x", tc.expected, data)
+		}
+	}
+
+	for _, tc := range [][2]string{{"", ""}, {"0a", "Cg=="}, {"0x0a", ""}, {"", "not base64"}} {
+		if _, err := Decode(tc[0], tc[1]); err == nil {
+			t.Errorf("no error occurred for payload %q, but it should have", tc)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package recovery keeps a panicking plugin from taking down the server. A
+// panic in a handler is logged with its stack trace and counted, the message
+// is dropped, and the server goes on serving all other clients.
+package recovery
+
+import (
+	"runtime/debug"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var log = logger.GetLogger("recovery")
+
+var panics = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metrics.Namespace,
+	Name:      "handler_panics_total",
+	Help:      "Number of messages dropped due to a panic in a plugin handler, per plugin.",
+}, []string{"plugin"})
+
+// recovered logs and counts a recovered panic of the plugin.
+func recovered(name string, r any, summary string) {
+	panics.WithLabelValues(name).Inc()
+	log.WithField("plugin", name).Errorf("Recovered from panic, dropping message: %v\n%s\nMessage: %s", r, debug.Stack(), summary)
+}
+
+// Wrap4 recovers from panics of a DHCPv4 handler, dropping the message.
+func Wrap4(name string, h handler.Handler4) handler.Handler4 {
+	return func(req, resp *dhcpv4.DHCPv4) (reply *dhcpv4.DHCPv4, stop bool) {
+		defer func() {
+			if r := recover(); r != nil {
+				recovered(name, r, req.Summary())
+				reply, stop = nil, true
+			}
+		}()
+		return h(req, resp)
+	}
+}
+
+// Wrap6 recovers from panics of a DHCPv6 handler, dropping the message.
+func Wrap6(name string, h handler.Handler6) handler.Handler6 {
+	return func(req, resp dhcpv6.DHCPv6) (reply dhcpv6.DHCPv6, stop bool) {
+		defer func() {
+			if r := recover(); r != nil {
+				recovered(name, r, req.Summary())
+				reply, stop = nil, true
+			}
+		}()
+		return h(req, resp)
+	}
+}
+
+// Wrap returns a copy of the plugin whose handlers recover from panics.
+func Wrap(p *plugins.Plugin) *plugins.Plugin {
+	wrapped := &plugins.Plugin{Name: p.Name}
+	if p.Setup4 != nil {
+		wrapped.Setup4 = func(args ...string) (handler.Handler4, error) {
+			h, err := p.Setup4(args...)
+			if err != nil {
+				return nil, err
+			}
+			metrics.Register(panics)
+			return Wrap4(p.Name, h), nil
+		}
+	}
+	if p.Setup6 != nil {
+		wrapped.Setup6 = func(args ...string) (handler.Handler6, error) {
+			h, err := p.Setup6(args...)
+			if err != nil {
+				return nil, err
+			}
+			metrics.Register(panics)
+			return Wrap6(p.Name, h), nil
+		}
+	}
+	return wrapped
+}
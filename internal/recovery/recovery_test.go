@@ -0,0 +1,59 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package recovery
+
+import (
+	"net"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestWrap4(t *testing.T) {
+	req, err := dhcpv4.NewDiscovery(net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := testutil.ToFloat64(panics.WithLabelValues("panic4"))
+	h := Wrap4("panic4", func(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+		var ip net.IP
+		_ = ip[15]
+		return resp, false
+	})
+
+	resp, stop := h(req, req)
+	if resp != nil || !stop {
+		t.Errorf("expected the message to be dropped, got %v, %t", resp, stop)
+	}
+	if after := testutil.ToFloat64(panics.WithLabelValues("panic4")); after != before+1 {
+		t.Errorf("expected the panic to be counted, got %v", after-before)
+	}
+
+	h = Wrap4("ok4", func(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+		return resp, false
+	})
+	if resp, stop := h(req, req); resp != req || stop {
+		t.Errorf("expected the response to be passed on, got %v, %t", resp, stop)
+	}
+}
+
+func TestWrap6(t *testing.T) {
+	req, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := Wrap6("panic6", func(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+		panic("bad input")
+	})
+
+	resp, stop := h(req, req)
+	if resp != nil || !stop {
+		t.Errorf("expected the message to be dropped, got %v, %t", resp, stop)
+	}
+	if count := testutil.ToFloat64(panics.WithLabelValues("panic6")); count != 1 {
+		t.Errorf("expected the panic to be counted, got %v", count)
+	}
+}
@@ -0,0 +1,174 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package registry lists the plugins FeDHCP is built with, so that the server
+// and the tooling around it load the same plugins.
+package registry
+
+import (
+	"strings"
+
+	"github.com/coredhcp/coredhcp/config"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/coredhcp/coredhcp/plugins/autoconfigure"
+	"github.com/coredhcp/coredhcp/plugins/dns"
+	"github.com/coredhcp/coredhcp/plugins/example"
+	"github.com/coredhcp/coredhcp/plugins/file"
+	"github.com/coredhcp/coredhcp/plugins/leasetime"
+	"github.com/coredhcp/coredhcp/plugins/mtu"
+	"github.com/coredhcp/coredhcp/plugins/nbp"
+	"github.com/coredhcp/coredhcp/plugins/netmask"
+	"github.com/coredhcp/coredhcp/plugins/prefix"
+	rangeplugin "github.com/coredhcp/coredhcp/plugins/range"
+	"github.com/coredhcp/coredhcp/plugins/router"
+	"github.com/coredhcp/coredhcp/plugins/searchdomains"
+	"github.com/coredhcp/coredhcp/plugins/serverid"
+	"github.com/coredhcp/coredhcp/plugins/sleep"
+	"github.com/coredhcp/coredhcp/plugins/staticroute"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/bootoperator"
+	"github.com/ironcore-dev/fedhcp/plugins/beacon"
+	"github.com/ironcore-dev/fedhcp/plugins/bluefield"
+	"github.com/ironcore-dev/fedhcp/plugins/bootp"
+	"github.com/ironcore-dev/fedhcp/plugins/bootparams"
+	"github.com/ironcore-dev/fedhcp/plugins/bootservers"
+	"github.com/ironcore-dev/fedhcp/plugins/canary"
+	"github.com/ironcore-dev/fedhcp/plugins/captiveportal"
+	"github.com/ironcore-dev/fedhcp/plugins/capture"
+	"github.com/ironcore-dev/fedhcp/plugins/chaos"
+	"github.com/ironcore-dev/fedhcp/plugins/dnsendpoint"
+	"github.com/ironcore-dev/fedhcp/plugins/fqdn"
+	"github.com/ironcore-dev/fedhcp/plugins/httpboot"
+	"github.com/ironcore-dev/fedhcp/plugins/ipam"
+	fedhcpleasetime "github.com/ironcore-dev/fedhcp/plugins/leasetime"
+	"github.com/ironcore-dev/fedhcp/plugins/linklayer"
+	"github.com/ironcore-dev/fedhcp/plugins/metal"
+	"github.com/ironcore-dev/fedhcp/plugins/onmetal"
+	"github.com/ironcore-dev/fedhcp/plugins/oob"
+	"github.com/ironcore-dev/fedhcp/plugins/pacing"
+	"github.com/ironcore-dev/fedhcp/plugins/pxeboot"
+	"github.com/ironcore-dev/fedhcp/plugins/radius"
+	"github.com/ironcore-dev/fedhcp/plugins/rawopts"
+	"github.com/ironcore-dev/fedhcp/plugins/recorder"
+	"github.com/ironcore-dev/fedhcp/plugins/refreshtime"
+	"github.com/ironcore-dev/fedhcp/plugins/relayfilter"
+	"github.com/ironcore-dev/fedhcp/plugins/script"
+	"github.com/ironcore-dev/fedhcp/plugins/serverduid"
+	"github.com/ironcore-dev/fedhcp/plugins/syslog"
+	"github.com/ironcore-dev/fedhcp/plugins/tenant"
+	"github.com/ironcore-dev/fedhcp/plugins/vendorclass"
+	"github.com/ironcore-dev/fedhcp/plugins/vendoropts"
+	"github.com/ironcore-dev/fedhcp/plugins/ztp"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// Plugins are the plugins FeDHCP is built with.
+var Plugins = []*plugins.Plugin{
+	&autoconfigure.Plugin,
+	&dns.Plugin,
+	&example.Plugin,
+	&file.Plugin,
+	&leasetime.Plugin,
+	&mtu.Plugin,
+	&nbp.Plugin,
+	&netmask.Plugin,
+	&prefix.Plugin,
+	&rangeplugin.Plugin,
+	&router.Plugin,
+	&searchdomains.Plugin,
+	&serverid.Plugin,
+	&sleep.Plugin,
+	&staticroute.Plugin,
+	&bluefield.Plugin,
+	&ipam.Plugin,
+	&onmetal.Plugin,
+	&oob.Plugin,
+	&pxeboot.Plugin,
+	&httpboot.Plugin,
+	&metal.Plugin,
+	&vendorclass.Plugin,
+	&fqdn.Plugin,
+	&chaos.Plugin,
+	&serverduid.Plugin,
+	&pacing.Plugin,
+	&bootservers.Plugin,
+	&canary.Plugin,
+	&radius.Plugin,
+	&syslog.Plugin,
+	&linklayer.Plugin,
+	&recorder.Plugin,
+	&fedhcpleasetime.Plugin,
+	&bootp.Plugin,
+	&vendoropts.Plugin,
+	&capture.Plugin,
+	&dnsendpoint.Plugin,
+	&bootparams.Plugin,
+	&refreshtime.Plugin,
+	&relayfilter.Plugin,
+	&rawopts.Plugin,
+	&script.Plugin,
+	&beacon.Plugin,
+	&ztp.Plugin,
+	&captiveportal.Plugin,
+	&tenant.Plugin,
+}
+
+var requiringKubernetes = sets.New[string]("oob", "ipam", "metal", "recorder", "dnsendpoint", "bootparams")
+
+// RequiresKubernetes reports whether a plugin entry of the configuration, or of
+// the chain of a tenant, needs the kubernetes client, either by plugin or for a
+// boot-operator lookup.
+func RequiresKubernetes(cfg *config.Config) bool {
+	var entries []config.PluginConfig
+	if cfg.Server4 != nil {
+		entries = append(entries, cfg.Server4.Plugins...)
+	}
+	if cfg.Server6 != nil {
+		entries = append(entries, cfg.Server6.Plugins...)
+	}
+
+	for _, entry := range entries {
+		if requiringKubernetes.Has(entry.Name) {
+			return true
+		}
+		if entry.Name == "tenant" && len(entry.Args) > 0 && tenantsRequireKubernetes(entry.Args[0]) {
+			return true
+		}
+		if entry.Name == "serverduid" && len(entry.Args) > 0 && serverDUIDRequiresKubernetes(entry.Args[0]) {
+			return true
+		}
+		for _, arg := range entry.Args {
+			if strings.HasPrefix(arg, bootoperator.ArgPrefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tenantsRequireKubernetes reports whether the chain of a tenant of the tenant
+// config needs the kubernetes client. Configs failing to load are reported by
+// the tenant plugin.
+func tenantsRequireKubernetes(path string) bool {
+	tenants := &api.TenantConfig{}
+	if err := api.Load(path, tenants); err != nil {
+		return false
+	}
+	for _, t := range tenants.Tenants {
+		if cfg, err := config.Load(t.Config); err == nil && RequiresKubernetes(cfg) {
+			return true
+		}
+	}
+	return false
+}
+
+// serverDUIDRequiresKubernetes reports whether the serverduid config stores
+// the DUID in a ConfigMap. Configs failing to load are reported by the
+// serverduid plugin.
+func serverDUIDRequiresKubernetes(path string) bool {
+	duid := &api.ServerDUIDConfig{}
+	if err := api.Load(path, duid); err != nil {
+		return false
+	}
+	return duid.Store == api.DUIDStoreConfigMap
+}
@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package relay provides helpers for relayed DHCPv6 messages, centered on the
+// client link-layer address (option 79, RFC 6939).
+package relay
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+)
+
+// ClientLinkLayer returns the link-layer type and address of the client of a
+// relayed request. It is taken from the client link-layer address option of
+// the relay closest to the client, or derived from that relay's peer address
+// if it is an EUI-64 address.
+func ClientLinkLayer(req dhcpv6.DHCPv6) (iana.HWType, net.HardwareAddr, error) {
+	if !req.IsRelay() {
+		return 0, nil, fmt.Errorf("not a relayed message")
+	}
+	inner, err := dhcpv6.DecapsulateRelayIndex(req, -1)
+	if err != nil {
+		return 0, nil, fmt.Errorf("could not decapsulate relay message: %w", err)
+	}
+	relayMsg := inner.(*dhcpv6.RelayMessage)
+
+	if hwType, lla := relayMsg.Options.ClientLinkLayerAddress(); lla != nil {
+		return hwType, lla, nil
+	}
+	mac, err := dhcpv6.GetMacAddressFromEUI64(relayMsg.PeerAddr)
+	if err != nil {
+		return 0, nil, fmt.Errorf("no client link-layer address option and peer address %s is not EUI-64: %w",
+			relayMsg.PeerAddr, err)
+	}
+	return iana.HWTypeEthernet, mac, nil
+}
+
+// ClientMAC returns the MAC address of the client of a relayed request, see ClientLinkLayer.
+func ClientMAC(req dhcpv6.DHCPv6) (net.HardwareAddr, error) {
+	_, mac, err := ClientLinkLayer(req)
+	return mac, err
+}
+
+// Reply encapsulates the response into Relay-Reply messages matching the relay
+// chain of the request, like the server does, and adds the client link-layer
+// address option to every one of them, so tooling between the relays sees the
+// client's MAC address.
+func Reply(req dhcpv6.DHCPv6, resp *dhcpv6.Message) (dhcpv6.DHCPv6, error) {
+	relayMsg, ok := req.(*dhcpv6.RelayMessage)
+	if !ok {
+		return nil, fmt.Errorf("not a relayed message")
+	}
+	hwType, lla, err := ClientLinkLayer(req)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := dhcpv6.NewRelayReplFromRelayForw(relayMsg, resp)
+	if err != nil {
+		return nil, fmt.Errorf("could not create relay-reply: %w", err)
+	}
+	for msg := reply; msg.IsRelay(); {
+		replyMsg := msg.(*dhcpv6.RelayMessage)
+		replyMsg.Options.Add(dhcpv6.OptClientLinkLayerAddress(hwType, lla))
+		msg = replyMsg.Options.RelayMessage()
+		if msg == nil {
+			break
+		}
+	}
+	return reply, nil
+}
@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package relay
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+)
+
+var mac = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+
+func TestClientMACNestedRelays(t *testing.T) {
+	msg, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the relay closest to the client knows the link-layer address, the outer one does not
+	inner, err := dhcpv6.EncapsulateRelay(msg, dhcpv6.MessageTypeRelayForward,
+		net.ParseIP("2001:db8:1::1"), net.ParseIP("2001:db8:1::10"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner.AddOption(dhcpv6.OptClientLinkLayerAddress(iana.HWTypeEthernet, mac))
+	outer, err := dhcpv6.EncapsulateRelay(inner, dhcpv6.MessageTypeRelayForward,
+		net.ParseIP("2001:db8:2::1"), net.ParseIP("2001:db8:1::1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ClientMAC(outer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, mac) {
+		t.Errorf("expected %s, got %s", mac, got)
+	}
+
+	if _, err := ClientMAC(msg); err == nil {
+		t.Error("expected an error for a message which is not relayed")
+	}
+}
@@ -0,0 +1,214 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package requested trims the options a plugin entry adds to those the client
+// asked for, in the DHCPv4 Parameter Request List (option 55) or the DHCPv6
+// Option Request Option (option 6).
+//
+// Appending "options=requested" to the arguments of a plugin entry removes the
+// options it added which the client did not list, unless the client sent no
+// list at all. "options=strict" removes them in any case. Options the entry
+// modified rather than added, and options which are never requested, like the
+// DHCPv4 message type or the DHCPv6 server ID, are kept.
+package requested
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const argPrefix = "options="
+
+// Mode is the option filtering of a plugin entry.
+type Mode string
+
+const (
+	// All keeps every option the plugin adds.
+	All       Mode = ""
+	Requested Mode = "requested"
+	Strict    Mode = "strict"
+)
+
+var (
+	// unrequested4 are DHCPv4 options no client lists but every reply needs.
+	unrequested4 = sets.New[uint8](
+		dhcpv4.OptionDHCPMessageType.Code(),
+		dhcpv4.OptionServerIdentifier.Code(),
+		dhcpv4.OptionIPAddressLeaseTime.Code(),
+		dhcpv4.OptionMessage.Code(),
+		dhcpv4.OptionRelayAgentInformation.Code(),
+		dhcpv4.OptionEnd.Code(),
+	)
+	// unrequested6 are DHCPv6 options RFC 8415 does not allow in an ORO.
+	unrequested6 = sets.New[dhcpv6.OptionCode](
+		dhcpv6.OptionClientID,
+		dhcpv6.OptionServerID,
+		dhcpv6.OptionIANA,
+		dhcpv6.OptionIATA,
+		dhcpv6.OptionIAAddr,
+		dhcpv6.OptionORO,
+		dhcpv6.OptionPreference,
+		dhcpv6.OptionElapsedTime,
+		dhcpv6.OptionRelayMsg,
+		dhcpv6.OptionAuth,
+		dhcpv6.OptionUnicast,
+		dhcpv6.OptionStatusCode,
+		dhcpv6.OptionRapidCommit,
+		dhcpv6.OptionUserClass,
+		dhcpv6.OptionVendorClass,
+		dhcpv6.OptionInterfaceID,
+		dhcpv6.OptionReconfMessage,
+		dhcpv6.OptionReconfAccept,
+		dhcpv6.OptionIAPD,
+		dhcpv6.OptionIAPrefix,
+	)
+)
+
+// ParseArgs extracts the filtering mode from the plugin arguments and returns
+// the remaining ones, which are passed to the plugin.
+func ParseArgs(args ...string) (Mode, []string, error) {
+	mode := All
+	var rest []string
+	for _, arg := range args {
+		value, ok := strings.CutPrefix(arg, argPrefix)
+		if !ok {
+			rest = append(rest, arg)
+			continue
+		}
+		if mode != All {
+			return All, nil, fmt.Errorf("options mode given more than once")
+		}
+		switch Mode(value) {
+		case Requested, Strict:
+			mode = Mode(value)
+		default:
+			return All, nil, fmt.Errorf("unknown options mode %s, should be %s or %s", value, Requested, Strict)
+		}
+	}
+	return mode, rest, nil
+}
+
+// keep reports whether an added option is kept, given whether the client sent
+// a list and listed it.
+func (m Mode) keep(listed, requested bool) bool {
+	switch m {
+	case Requested:
+		return requested || !listed
+	case Strict:
+		return requested
+	default:
+		return true
+	}
+}
+
+// Wrap4 applies the filtering mode to a DHCPv4 handler.
+func (m Mode) Wrap4(h handler.Handler4) handler.Handler4 {
+	if m == All {
+		return h
+	}
+	return func(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+		var present sets.Set[uint8]
+		if resp != nil {
+			present = sets.KeySet(resp.Options)
+		}
+		resp, stop := h(req, resp)
+		if resp == nil {
+			return resp, stop
+		}
+
+		listed := req.Options.Has(dhcpv4.OptionParameterRequestList)
+		// the codes of the list are compared by value, their types differ
+		prl := sets.New[uint8]()
+		for _, code := range req.ParameterRequestList() {
+			prl.Insert(code.Code())
+		}
+		for code := range resp.Options {
+			if present.Has(code) || unrequested4.Has(code) {
+				continue
+			}
+			if !m.keep(listed, prl.Has(code)) {
+				resp.Options.Del(dhcpv4.GenericOptionCode(code))
+			}
+		}
+		return resp, stop
+	}
+}
+
+// Wrap6 applies the filtering mode to a DHCPv6 handler.
+func (m Mode) Wrap6(h handler.Handler6) handler.Handler6 {
+	if m == All {
+		return h
+	}
+	return func(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+		present := sets.New[dhcpv6.OptionCode]()
+		if reply, ok := resp.(*dhcpv6.Message); ok {
+			for _, opt := range reply.Options.Options {
+				present.Insert(opt.Code())
+			}
+		}
+		resp, stop := h(req, resp)
+		reply, ok := resp.(*dhcpv6.Message)
+		if !ok {
+			return resp, stop
+		}
+		msg, err := req.GetInnerMessage()
+		if err != nil {
+			return resp, stop
+		}
+
+		listed := msg.Options.GetOne(dhcpv6.OptionORO) != nil
+		oro := msg.Options.RequestedOptions()
+		added := sets.New[dhcpv6.OptionCode]()
+		for _, opt := range reply.Options.Options {
+			if !present.Has(opt.Code()) && !unrequested6.Has(opt.Code()) {
+				added.Insert(opt.Code())
+			}
+		}
+		for code := range added {
+			if !m.keep(listed, slices.Contains(oro, code)) {
+				reply.Options.Del(code)
+			}
+		}
+		return resp, stop
+	}
+}
+
+// Wrap returns a copy of the plugin, whose entries accept an options mode
+// argument.
+func Wrap(p *plugins.Plugin) *plugins.Plugin {
+	wrapped := &plugins.Plugin{Name: p.Name}
+	if p.Setup4 != nil {
+		wrapped.Setup4 = func(args ...string) (handler.Handler4, error) {
+			mode, rest, err := ParseArgs(args...)
+			if err != nil {
+				return nil, fmt.Errorf("plugin %s: %w", p.Name, err)
+			}
+			h, err := p.Setup4(rest...)
+			if err != nil {
+				return nil, err
+			}
+			return mode.Wrap4(h), nil
+		}
+	}
+	if p.Setup6 != nil {
+		wrapped.Setup6 = func(args ...string) (handler.Handler6, error) {
+			mode, rest, err := ParseArgs(args...)
+			if err != nil {
+				return nil, fmt.Errorf("plugin %s: %w", p.Name, err)
+			}
+			h, err := p.Setup6(rest...)
+			if err != nil {
+				return nil, err
+			}
+			return mode.Wrap6(h), nil
+		}
+	}
+	return wrapped
+}
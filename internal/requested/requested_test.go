@@ -0,0 +1,165 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package requested
+
+import (
+	"net"
+	"testing"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+var mac = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+
+// testPlugin adds a router, DNS servers and a lease time, respectively DNS
+// servers, a domain search list and a server ID.
+var testPlugin = plugins.Plugin{
+	Name: "test",
+	Setup4: func(args ...string) (handler.Handler4, error) {
+		return func(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+			resp.UpdateOption(dhcpv4.OptRouter(net.IPv4(192, 168, 0, 1)))
+			resp.UpdateOption(dhcpv4.OptDNS(net.IPv4(192, 168, 0, 53)))
+			resp.UpdateOption(dhcpv4.OptIPAddressLeaseTime(3600))
+			return resp, false
+		}, nil
+	},
+	Setup6: func(args ...string) (handler.Handler6, error) {
+		return func(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+			resp.UpdateOption(dhcpv6.OptDNS(net.ParseIP("2001:db8::53")))
+			resp.UpdateOption(dhcpv6.OptDomainSearchList(nil))
+			resp.UpdateOption(dhcpv6.OptServerID(&dhcpv6.DUIDLL{HWType: 1, LinkLayerAddr: mac}))
+			return resp, false
+		}, nil
+	},
+}
+
+func TestWrongArgs(t *testing.T) {
+	for _, args := range [][]string{
+		{"options=foo"},
+		{"options=requested", "options=strict"},
+		{"options="},
+	} {
+		if _, _, err := ParseArgs(args...); err == nil {
+			t.Fatalf("no error occurred when parsing %v, but it should have", args)
+		}
+		if _, err := Wrap(&testPlugin).Setup6(args...); err == nil {
+			t.Fatalf("no error occurred when setting up a plugin with %v, but it should have", args)
+		}
+	}
+}
+
+/* IPv6 */
+func TestOptions6(t *testing.T) {
+	for _, tc := range []struct {
+		args     []string
+		oro      []dhcpv6.OptionCode
+		expected []dhcpv6.OptionCode
+		removed  []dhcpv6.OptionCode
+	}{
+		{nil, []dhcpv6.OptionCode{dhcpv6.OptionDNSRecursiveNameServer},
+			[]dhcpv6.OptionCode{dhcpv6.OptionDNSRecursiveNameServer, dhcpv6.OptionDomainSearchList}, nil},
+		{[]string{"options=requested"}, []dhcpv6.OptionCode{dhcpv6.OptionDNSRecursiveNameServer},
+			[]dhcpv6.OptionCode{dhcpv6.OptionDNSRecursiveNameServer, dhcpv6.OptionServerID},
+			[]dhcpv6.OptionCode{dhcpv6.OptionDomainSearchList}},
+		{[]string{"options=requested"}, nil,
+			[]dhcpv6.OptionCode{dhcpv6.OptionDNSRecursiveNameServer, dhcpv6.OptionDomainSearchList}, nil},
+		{[]string{"options=strict"}, nil,
+			[]dhcpv6.OptionCode{dhcpv6.OptionServerID},
+			[]dhcpv6.OptionCode{dhcpv6.OptionDNSRecursiveNameServer, dhcpv6.OptionDomainSearchList}},
+	} {
+		h, err := Wrap(&testPlugin).Setup6(tc.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, _ := dhcpv6.NewSolicit(mac)
+		req.Options.Del(dhcpv6.OptionORO)
+		if tc.oro != nil {
+			req.UpdateOption(dhcpv6.OptRequestedOption(tc.oro...))
+		}
+		stub, _ := dhcpv6.NewAdvertiseFromSolicit(req)
+
+		resp, _ := h(req, stub)
+		for _, code := range tc.expected {
+			if resp.GetOneOption(code) == nil {
+				t.Errorf("%v with ORO %v: expected option %s, but it is missing", tc.args, tc.oro, code)
+			}
+		}
+		for _, code := range tc.removed {
+			if resp.GetOneOption(code) != nil {
+				t.Errorf("%v with ORO %v: expected option %s to be removed, but it is present", tc.args, tc.oro, code)
+			}
+		}
+	}
+}
+
+func TestRelayedOptions6(t *testing.T) {
+	h, _ := Wrap(&testPlugin).Setup6("options=requested")
+	solicit, _ := dhcpv6.NewSolicit(mac)
+	solicit.UpdateOption(dhcpv6.OptRequestedOption(dhcpv6.OptionDomainSearchList))
+	stub, _ := dhcpv6.NewAdvertiseFromSolicit(solicit)
+	req, _ := dhcpv6.EncapsulateRelay(solicit, dhcpv6.MessageTypeRelayForward, net.ParseIP("2001:db8::1"), net.ParseIP("fe80::1"))
+
+	resp, _ := h(req, stub)
+	if resp.GetOneOption(dhcpv6.OptionDomainSearchList) == nil || resp.GetOneOption(dhcpv6.OptionDNSRecursiveNameServer) != nil {
+		t.Errorf("expected the options requested in the relayed message, got %s", resp.Summary())
+	}
+}
+
+/* IPv4 */
+func TestOptions4(t *testing.T) {
+	for _, tc := range []struct {
+		args     []string
+		prl      []dhcpv4.OptionCode
+		expected []dhcpv4.OptionCode
+		removed  []dhcpv4.OptionCode
+	}{
+		{nil, []dhcpv4.OptionCode{dhcpv4.OptionRouter},
+			[]dhcpv4.OptionCode{dhcpv4.OptionRouter, dhcpv4.OptionDomainNameServer}, nil},
+		{[]string{"options=requested"}, []dhcpv4.OptionCode{dhcpv4.OptionRouter},
+			[]dhcpv4.OptionCode{dhcpv4.OptionRouter, dhcpv4.OptionIPAddressLeaseTime},
+			[]dhcpv4.OptionCode{dhcpv4.OptionDomainNameServer}},
+		{[]string{"options=requested"}, nil,
+			[]dhcpv4.OptionCode{dhcpv4.OptionRouter, dhcpv4.OptionDomainNameServer}, nil},
+		{[]string{"options=strict"}, nil,
+			[]dhcpv4.OptionCode{dhcpv4.OptionIPAddressLeaseTime},
+			[]dhcpv4.OptionCode{dhcpv4.OptionRouter, dhcpv4.OptionDomainNameServer}},
+	} {
+		h, err := Wrap(&testPlugin).Setup4(tc.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, _ := dhcpv4.NewDiscovery(mac)
+		req.Options.Del(dhcpv4.OptionParameterRequestList)
+		if tc.prl != nil {
+			req.UpdateOption(dhcpv4.OptParameterRequestList(tc.prl...))
+		}
+		stub, _ := dhcpv4.NewReplyFromRequest(req)
+
+		resp, _ := h(req, stub)
+		for _, code := range tc.expected {
+			if !resp.Options.Has(code) {
+				t.Errorf("%v with PRL %v: expected option %s, but it is missing", tc.args, tc.prl, code)
+			}
+		}
+		for _, code := range tc.removed {
+			if resp.Options.Has(code) {
+				t.Errorf("%v with PRL %v: expected option %s to be removed, but it is present", tc.args, tc.prl, code)
+			}
+		}
+	}
+}
+
+func TestModifiedOptions4(t *testing.T) {
+	h, _ := Wrap(&testPlugin).Setup4("options=strict")
+	req, _ := dhcpv4.NewDiscovery(mac, dhcpv4.WithRequestedOptions(dhcpv4.OptionSubnetMask))
+	stub, _ := dhcpv4.NewReplyFromRequest(req, dhcpv4.WithOption(dhcpv4.OptRouter(net.IPv4(192, 168, 0, 254))))
+
+	resp, _ := h(req, stub)
+	if !resp.Options.Has(dhcpv4.OptionRouter) {
+		t.Error("expected the router modified rather than added to be kept")
+	}
+}
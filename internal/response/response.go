@@ -0,0 +1,129 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package response builds the DHCPv6 stub replies the plugins of a chain add
+// their options to, and keeps the replies of the plugins protocol-valid.
+//
+// RFC 8415 requires a reply to carry the transaction ID and the Client
+// Identifier of the client message and, once the client addressed a server,
+// its Server Identifier. A plugin building its reply from scratch, or the first
+// plugin of a chain without a server ID plugin, would otherwise send replies
+// the client discards. The mandatory fields missing after a plugin ran are
+// restored from the client message and counted, so the plugin can be fixed.
+package response
+
+import (
+	"fmt"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var log = logger.GetLogger("response")
+
+var repairs = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metrics.Namespace,
+	Name:      "response_repairs_total",
+	Help:      "Number of DHCPv6 replies a mandatory field was restored in after a plugin ran, per plugin and field.",
+}, []string{"plugin", "field"})
+
+// The mandatory fields of a reply.
+const (
+	fieldTransactionID = "transaction_id"
+	fieldClientID      = "client_id"
+	fieldServerID      = "server_id"
+)
+
+// Stub6 returns the reply a chain starts from for a client message, the same
+// way the server builds it: an Advertise for a Solicit, a Reply for a Solicit
+// with Rapid Commit and for the other client messages. Besides the
+// transaction ID and the client ID, it carries the server ID the client
+// addressed, if any.
+func Stub6(msg *dhcpv6.Message) (*dhcpv6.Message, error) {
+	var resp *dhcpv6.Message
+	var err error
+	switch msg.Type() {
+	case dhcpv6.MessageTypeSolicit:
+		if msg.GetOneOption(dhcpv6.OptionRapidCommit) != nil {
+			resp, err = dhcpv6.NewReplyFromMessage(msg)
+		} else {
+			resp, err = dhcpv6.NewAdvertiseFromSolicit(msg)
+		}
+	case dhcpv6.MessageTypeRequest, dhcpv6.MessageTypeConfirm, dhcpv6.MessageTypeRenew,
+		dhcpv6.MessageTypeRebind, dhcpv6.MessageTypeRelease, dhcpv6.MessageTypeInformationRequest:
+		resp, err = dhcpv6.NewReplyFromMessage(msg)
+	default:
+		err = fmt.Errorf("message type %d not supported", msg.Type())
+	}
+	if err != nil {
+		return nil, err
+	}
+	Complete6(msg, resp)
+	return resp, nil
+}
+
+// Complete6 restores the mandatory fields of the reply to a client message
+// and returns the names of the fields restored: the transaction ID, the
+// client ID if the client sent one and the server ID if the client addressed
+// a server. Fields the reply already carries are kept.
+func Complete6(msg, reply *dhcpv6.Message) []string {
+	var restored []string
+	if reply.TransactionID != msg.TransactionID {
+		reply.TransactionID = msg.TransactionID
+		restored = append(restored, fieldTransactionID)
+	}
+	if clientID := msg.Options.ClientID(); clientID != nil && reply.Options.ClientID() == nil {
+		reply.AddOption(dhcpv6.OptClientID(clientID))
+		restored = append(restored, fieldClientID)
+	}
+	if serverID := msg.Options.ServerID(); serverID != nil && reply.Options.ServerID() == nil {
+		reply.AddOption(dhcpv6.OptServerID(serverID))
+		restored = append(restored, fieldServerID)
+	}
+	return restored
+}
+
+// Wrap6 completes the replies of a DHCPv6 handler. The reply passed in is
+// completed first, so the stub of the server carries the server ID the client
+// addressed, then the fields the handler dropped are restored and counted.
+// Replies the handler encapsulated in a relay message are left alone.
+func Wrap6(name string, h handler.Handler6) handler.Handler6 {
+	return func(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+		msg, err := req.GetInnerMessage()
+		if err != nil {
+			return h(req, resp)
+		}
+		if reply, ok := resp.(*dhcpv6.Message); ok && reply != nil {
+			Complete6(msg, reply)
+		}
+
+		resp, stop := h(req, resp)
+		if reply, ok := resp.(*dhcpv6.Message); ok && reply != nil {
+			for _, field := range Complete6(msg, reply) {
+				repairs.WithLabelValues(name, field).Inc()
+				log.WithField("plugin", name).Debugf("Restored the %s of the reply to %s", field, msg.Type())
+			}
+		}
+		return resp, stop
+	}
+}
+
+// Wrap returns a copy of the plugin whose DHCPv6 replies are completed.
+func Wrap(p *plugins.Plugin) *plugins.Plugin {
+	wrapped := &plugins.Plugin{Name: p.Name, Setup4: p.Setup4}
+	if p.Setup6 != nil {
+		wrapped.Setup6 = func(args ...string) (handler.Handler6, error) {
+			h, err := p.Setup6(args...)
+			if err != nil {
+				return nil, err
+			}
+			metrics.Register(repairs)
+			return Wrap6(p.Name, h), nil
+		}
+	}
+	return wrapped
+}
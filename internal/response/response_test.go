@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package response
+
+import (
+	"net"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var (
+	clientID = &dhcpv6.DUIDLL{HWType: iana.HWTypeEthernet, LinkLayerAddr: net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}}
+	serverID = &dhcpv6.DUIDLL{HWType: iana.HWTypeEthernet, LinkLayerAddr: net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}}
+)
+
+func newMessage(t *testing.T, messageType dhcpv6.MessageType, opts ...dhcpv6.Option) *dhcpv6.Message {
+	msg, err := dhcpv6.NewMessage(dhcpv6.WithClientID(clientID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.MessageType = messageType
+	for _, opt := range opts {
+		msg.AddOption(opt)
+	}
+	return msg
+}
+
+func ensureComplete(t *testing.T, msg, reply *dhcpv6.Message, withServerID bool) {
+	t.Helper()
+	if reply.TransactionID != msg.TransactionID {
+		t.Errorf("expected transaction ID %s, got %s", msg.TransactionID, reply.TransactionID)
+	}
+	if id := reply.Options.ClientID(); id == nil || !id.Equal(clientID) {
+		t.Errorf("expected client ID %s, got %v", clientID, id)
+	}
+	if id := reply.Options.ServerID(); withServerID != (id != nil) || id != nil && !id.Equal(serverID) {
+		t.Errorf("expected server ID %t, got %v", withServerID, id)
+	}
+}
+
+func TestStub6(t *testing.T) {
+	for _, tc := range []struct {
+		msg      *dhcpv6.Message
+		expected dhcpv6.MessageType
+		serverID bool
+	}{
+		{newMessage(t, dhcpv6.MessageTypeSolicit), dhcpv6.MessageTypeAdvertise, false},
+		{newMessage(t, dhcpv6.MessageTypeSolicit, &dhcpv6.OptionGeneric{OptionCode: dhcpv6.OptionRapidCommit}), dhcpv6.MessageTypeReply, false},
+		{newMessage(t, dhcpv6.MessageTypeRequest, dhcpv6.OptServerID(serverID)), dhcpv6.MessageTypeReply, true},
+		{newMessage(t, dhcpv6.MessageTypeRenew, dhcpv6.OptServerID(serverID)), dhcpv6.MessageTypeReply, true},
+		{newMessage(t, dhcpv6.MessageTypeRebind), dhcpv6.MessageTypeReply, false},
+	} {
+		stub, err := Stub6(tc.msg)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %v", tc.msg.Type(), err)
+		}
+		if stub.Type() != tc.expected {
+			t.Errorf("expected %s for %s, got %s", tc.expected, tc.msg.Type(), stub.Type())
+		}
+		ensureComplete(t, tc.msg, stub, tc.serverID)
+	}
+
+	if _, err := Stub6(newMessage(t, dhcpv6.MessageTypeReply)); err == nil {
+		t.Error("expected an error for a server message")
+	}
+}
+
+func TestWrap6(t *testing.T) {
+	req := newMessage(t, dhcpv6.MessageTypeRequest, dhcpv6.OptServerID(serverID))
+	// the stub of the server lacks the server ID
+	stub, err := dhcpv6.NewReplyFromMessage(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var seen *dhcpv6.Message
+	h := Wrap6("first", func(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+		seen = resp.(*dhcpv6.Message)
+		return resp, false
+	})
+	resp, stop := h(req, stub)
+	if stop || resp != stub {
+		t.Fatalf("expected the reply to be passed on, got %v, %t", resp, stop)
+	}
+	if seen.Options.ServerID() == nil {
+		t.Error("expected the handler to see the server ID in the stub")
+	}
+	ensureComplete(t, req, stub, true)
+	if repaired := testutil.ToFloat64(repairs.WithLabelValues("first", fieldServerID)); repaired != 0 {
+		t.Errorf("expected the completed stub not to be counted, got %v", repaired)
+	}
+
+	// a reply built from scratch is completed and counted
+	h = Wrap6("scratch", func(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+		reply, _ := dhcpv6.NewMessage()
+		reply.MessageType = dhcpv6.MessageTypeReply
+		return reply, false
+	})
+	resp, _ = h(req, stub)
+	ensureComplete(t, req, resp.(*dhcpv6.Message), true)
+	for _, field := range []string{fieldTransactionID, fieldClientID, fieldServerID} {
+		if repaired := testutil.ToFloat64(repairs.WithLabelValues("scratch", field)); repaired != 1 {
+			t.Errorf("expected the %s to be restored once, got %v", field, repaired)
+		}
+	}
+
+	// dropped messages stay dropped
+	h = Wrap6("drop", func(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+		return nil, true
+	})
+	if resp, stop := h(req, stub); resp != nil || !stop {
+		t.Errorf("expected the message to be dropped, got %v, %t", resp, stop)
+	}
+}
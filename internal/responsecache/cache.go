@@ -0,0 +1,154 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package responsecache caches the options a stateless plugin contributes to a
+// response. Clients tend to retransmit the very same request several times in a
+// row, so keeping the assembled options for a short time avoids rebuilding them
+// and, more importantly, avoids repeating outbound calls (e.g. to a boot service).
+package responsecache
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/cache"
+)
+
+// DefaultTTL is the time a cached response is considered valid. It is meant
+// to cover retransmissions of a single exchange only.
+const DefaultTTL = 5 * time.Second
+
+// maxEntries bounds the number of cached responses, the least recently used
+// are evicted first.
+const maxEntries = 4096
+
+// Cache is a concurrency-safe key/value store with a fixed TTL per entry.
+type Cache[T any] struct {
+	entries *cache.Cache[string, T]
+	// copy returns a copy of a value sharing no mutable state with it, nil if
+	// the values are not modified by the plugins
+	copy func(T) (T, error)
+}
+
+// New returns an empty cache whose entries expire after ttl. The name labels
+// the cache metrics, e.g. the plugin instance.
+func New[T any](name string, ttl time.Duration) *Cache[T] {
+	return &Cache[T]{entries: cache.New[string, T](name+"/responses", maxEntries, ttl)}
+}
+
+// NewOptions6 returns an empty cache of DHCPv6 options, see New. The options
+// are pointers the later plugins of a chain may modify in the response, so
+// they are deep-copied when stored and loaded.
+func NewOptions6(name string, ttl time.Duration) *Cache[[]dhcpv6.Option] {
+	c := New[[]dhcpv6.Option](name, ttl)
+	c.copy = copyOptions6
+	return c
+}
+
+// copyOptions6 copies the options by encoding and parsing them.
+func copyOptions6(opts []dhcpv6.Option) ([]dhcpv6.Option, error) {
+	if opts == nil {
+		return nil, nil
+	}
+	copied := dhcpv6.Options{}
+	if err := copied.FromBytes(dhcpv6.Options(opts).ToBytes()); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
+
+// Get returns the cached value for key, if present and not yet expired. A
+// value failing to be copied is reported as absent.
+func (c *Cache[T]) Get(key string) (T, bool) {
+	value, ok := c.entries.Get(key)
+	if !ok || c.copy == nil {
+		return value, ok
+	}
+	copied, err := c.copy(value)
+	if err != nil {
+		var zero T
+		return zero, false
+	}
+	return copied, true
+}
+
+// Put stores value for key, replacing any previous entry. A value failing to
+// be copied is not stored.
+func (c *Cache[T]) Put(key string, value T) {
+	if c.copy != nil {
+		var err error
+		if value, err = c.copy(value); err != nil {
+			return
+		}
+	}
+	c.entries.Put(key, value)
+}
+
+// Clear removes all entries, e.g. once the data the responses are derived from
+// changed.
+func (c *Cache[T]) Clear() {
+	c.entries.Clear()
+}
+
+// Len returns the number of entries, including expired ones not evicted yet.
+func (c *Cache[T]) Len() int {
+	return c.entries.Len()
+}
+
+// Key4 derives a cache key from a DHCPv4 request. It covers the client MAC,
+// the client's current address, the relay, the message type, the parameter
+// request list and the class options boot plugins use to classify clients.
+func Key4(req *dhcpv4.DHCPv4) string {
+	return strings.Join([]string{
+		req.ClientHWAddr.String(),
+		req.ClientIPAddr.String(),
+		req.GatewayIPAddr.String(),
+		req.MessageType().String(),
+		req.ParameterRequestList().String(),
+		hex.EncodeToString(req.GetOneOption(dhcpv4.OptionClassIdentifier)),
+		hex.EncodeToString(req.GetOneOption(dhcpv4.OptionUserClassInformation)),
+	}, "|")
+}
+
+// Key6 derives a cache key from a (possibly relayed) DHCPv6 request. It covers
+// the client identity (DUID and, if relayed, link/peer address and client
+// link-layer address), the message type, the option request option and the
+// class options boot plugins use to classify clients.
+func Key6(req dhcpv6.DHCPv6) (string, error) {
+	m, err := req.GetInnerMessage()
+	if err != nil {
+		return "", fmt.Errorf("could not decapsulate request: %w", err)
+	}
+
+	var parts []string
+	if req.IsRelay() {
+		relayMsg, ok := req.(*dhcpv6.RelayMessage)
+		if !ok {
+			return "", fmt.Errorf("failed to cast the DHCPv6 request to a RelayMessage")
+		}
+		parts = append(parts, relayMsg.LinkAddr.String(), relayMsg.PeerAddr.String())
+		if _, lla := relayMsg.Options.ClientLinkLayerAddress(); lla != nil {
+			parts = append(parts, lla.String())
+		}
+	}
+
+	if duid := m.Options.ClientID(); duid != nil {
+		parts = append(parts, hex.EncodeToString(duid.ToBytes()))
+	}
+	parts = append(parts, m.Type().String(), m.Options.RequestedOptions().String())
+	for _, code := range []dhcpv6.OptionCode{
+		dhcpv6.OptionVendorClass,
+		dhcpv6.OptionUserClass,
+		dhcpv6.OptionClientArchType,
+	} {
+		if opt := m.GetOneOption(code); opt != nil {
+			parts = append(parts, hex.EncodeToString(opt.ToBytes()))
+		}
+	}
+
+	return strings.Join(parts, "|"), nil
+}
@@ -0,0 +1,139 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package responsecache
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+)
+
+var clientMAC = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+
+func TestKey4(t *testing.T) {
+	req, err := dhcpv4.NewDiscovery(clientMAC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := req.ToBytes()
+	key := Key4(req)
+
+	for name, modify := range map[string]func(*dhcpv4.DHCPv4){
+		"ciaddr":       func(r *dhcpv4.DHCPv4) { r.ClientIPAddr = net.IPv4(10, 0, 0, 2) },
+		"relay":        func(r *dhcpv4.DHCPv4) { r.GatewayIPAddr = net.IPv4(10, 0, 0, 1) },
+		"message type": func(r *dhcpv4.DHCPv4) { r.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeRequest)) },
+		"class":        func(r *dhcpv4.DHCPv4) { r.UpdateOption(dhcpv4.OptClassIdentifier("PXEClient")) },
+	} {
+		other, err := dhcpv4.FromBytes(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		modify(other)
+		if Key4(other) == key {
+			t.Errorf("expected requests differing by %s to have different keys", name)
+		}
+	}
+
+	same, err := dhcpv4.FromBytes(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	same.TransactionID = dhcpv4.TransactionID{1, 2, 3, 4}
+	if Key4(same) != key {
+		t.Error("expected retransmissions to have the same key")
+	}
+}
+
+func newSolicit(t *testing.T, mac net.HardwareAddr) *dhcpv6.Message {
+	req, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.MessageType = dhcpv6.MessageTypeSolicit
+	req.AddOption(dhcpv6.OptClientID(&dhcpv6.DUIDLL{HWType: iana.HWTypeEthernet, LinkLayerAddr: mac}))
+	return req
+}
+
+func TestKey6(t *testing.T) {
+	msg := newSolicit(t, clientMAC)
+	key, err := Key6(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := Key6(newSolicit(t, net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5f}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == key {
+		t.Error("expected requests of different clients to have different keys")
+	}
+
+	relayed, err := dhcpv6.EncapsulateRelay(msg, dhcpv6.MessageTypeRelayForward, net.ParseIP("2001:db8::1"), net.ParseIP("fe80::1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	relayKey, err := Key6(relayed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if relayKey == key {
+		t.Error("expected a relayed request to have another key than a direct one")
+	}
+
+	retransmit := newSolicit(t, clientMAC)
+	retransmit.TransactionID = dhcpv6.TransactionID{1, 2, 3}
+	if same, err := Key6(retransmit); err != nil || same != key {
+		t.Errorf("expected retransmissions to have the same key, got %q (%v)", same, err)
+	}
+}
+
+func TestPutGetAndClear(t *testing.T) {
+	c := New[string]("test-put-get", time.Minute)
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("expected an empty cache")
+	}
+	c.Put("a", "value")
+	if v, ok := c.Get("a"); !ok || v != "value" {
+		t.Errorf("expected a=value, got %q (%t)", v, ok)
+	}
+	c.Clear()
+	if _, ok := c.Get("a"); ok || c.Len() != 0 {
+		t.Errorf("expected no entries after clearing, got %d", c.Len())
+	}
+}
+
+func TestOptions6AreCopied(t *testing.T) {
+	c := NewOptions6("test-options6", time.Minute)
+
+	stored := &dhcpv6.OptIANA{IaId: [4]byte{0, 0, 0, 1}}
+	c.Put("a", []dhcpv6.Option{stored, dhcpv6.OptBootFileURL("http://boot.example.org/ipxe")})
+	// modifying the stored options must not modify the cached ones
+	stored.IaId = [4]byte{0, 0, 0, 2}
+
+	loaded, ok := c.Get("a")
+	if !ok || len(loaded) != 2 {
+		t.Fatalf("expected 2 cached options, got %v (%t)", loaded, ok)
+	}
+	ia, ok := loaded[0].(*dhcpv6.OptIANA)
+	if !ok || ia.IaId != [4]byte{0, 0, 0, 1} {
+		t.Fatalf("expected the IA_NA as stored, got %v", loaded[0])
+	}
+	// neither must modifying the loaded ones
+	ia.IaId = [4]byte{0, 0, 0, 3}
+
+	reloaded, _ := c.Get("a")
+	if ia := reloaded[0].(*dhcpv6.OptIANA); ia.IaId != [4]byte{0, 0, 0, 1} {
+		t.Errorf("expected the IA_NA as stored, got %v", ia)
+	}
+
+	c.Put("none", nil)
+	if opts, ok := c.Get("none"); !ok || opts != nil {
+		t.Errorf("expected no options cached, got %v (%t)", opts, ok)
+	}
+}
@@ -0,0 +1,285 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package route routes clients to plugin entries by tenant, so that e.g.
+// virtual machines and physical hosts sharing a network are onboarded with
+// different configurations, like different IPAM namespaces.
+//
+// A route table names the routes of the clients by their MAC address prefix
+// (OUI), fingerprint class or physical placement, the rack and pool of the
+// metal-operator Server owning their MAC address. Appending "route=<name>" to the arguments of a
+// plugin entry makes it handle the messages of the clients of that route only
+// and pass all others on unchanged.
+package route
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/fingerprint"
+	"github.com/ironcore-dev/fedhcp/internal/placement"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+var log = logger.GetLogger("route")
+
+const argPrefix = "route="
+
+// classes are the fingerprint classes routes can match.
+var classes = sets.New(fingerprint.Classes...)
+
+type route struct {
+	name    string
+	ouis    [][]byte
+	classes sets.Set[fingerprint.Class]
+	racks   sets.Set[string]
+	pools   sets.Set[string]
+}
+
+// Table holds the routes of the clients. A nil table has no routes.
+type Table struct {
+	routes []route
+	// fallback is the route of the clients matching none
+	fallback string
+	// classify is set if a route matches classes, the clients are only
+	// classified then
+	classify bool
+	// locate looks up the placement of a client, it is only set if a route
+	// matches racks or pools
+	locate func(mac net.HardwareAddr) (placement.Placement, error)
+}
+
+// Load reads a route table from a config file.
+func Load(path string) (*Table, error) {
+	config := &api.RouteConfig{}
+	if err := api.Load(path, config); err != nil {
+		return nil, err
+	}
+	return New(config)
+}
+
+// parseOUI parses a MAC address prefix of whole bytes, e.g. 52:54:00.
+func parseOUI(oui string) ([]byte, error) {
+	prefix, err := hex.DecodeString(strings.NewReplacer(":", "", "-", "").Replace(oui))
+	if err != nil || len(prefix) == 0 || len(prefix) > 6 {
+		return nil, fmt.Errorf("invalid OUI %s", oui)
+	}
+	return prefix, nil
+}
+
+// New returns the route table of the config.
+func New(config *api.RouteConfig) (*Table, error) {
+	t := &Table{fallback: config.Default}
+	names := sets.New[string]()
+	for _, rc := range config.Routes {
+		if rc.Name == "" {
+			return nil, fmt.Errorf("route name must be configured")
+		}
+		if names.Has(rc.Name) {
+			return nil, fmt.Errorf("route %s configured more than once", rc.Name)
+		}
+		names.Insert(rc.Name)
+		if len(rc.OUIs) == 0 && len(rc.Classes) == 0 && len(rc.Racks) == 0 && len(rc.Pools) == 0 {
+			return nil, fmt.Errorf("route %s: at least one OUI, class, rack or pool must be configured", rc.Name)
+		}
+		if slices.Contains(rc.Racks, "") || slices.Contains(rc.Pools, "") {
+			return nil, fmt.Errorf("route %s: racks and pools must not be empty", rc.Name)
+		}
+
+		r := route{
+			name:    rc.Name,
+			classes: sets.New[fingerprint.Class](),
+			racks:   sets.New(rc.Racks...),
+			pools:   sets.New(rc.Pools...),
+		}
+		for _, oui := range rc.OUIs {
+			prefix, err := parseOUI(oui)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: %w", rc.Name, err)
+			}
+			r.ouis = append(r.ouis, prefix)
+		}
+		for _, class := range rc.Classes {
+			if !classes.Has(fingerprint.Class(class)) {
+				return nil, fmt.Errorf("route %s: unknown class %s, should be one of %v",
+					rc.Name, class, sets.List(classes))
+			}
+			r.classes.Insert(fingerprint.Class(class))
+			t.classify = true
+		}
+		if r.racks.Len() > 0 || r.pools.Len() > 0 {
+			t.locate = placement.New(config.Placement.RackLabel, config.Placement.PoolLabel).Of
+		}
+		t.routes = append(t.routes, r)
+	}
+	return t, nil
+}
+
+// Has reports whether the route is in the table, as route or as default.
+func (t *Table) Has(name string) bool {
+	if t == nil {
+		return false
+	}
+	return name == t.fallback || slices.ContainsFunc(t.routes, func(r route) bool {
+		return r.name == name
+	})
+}
+
+// RequiresKubernetes reports whether the table looks up the placement of the
+// clients, which needs the kubernetes client.
+func (t *Table) RequiresKubernetes() bool {
+	return t != nil && t.locate != nil
+}
+
+// of returns the route of a client by its MAC address, which may be nil, and
+// its class, which is only computed if needed. The placement is looked up
+// once a route matching racks or pools is reached, clients whose lookup fails
+// match none of them.
+func (t *Table) of(mac net.HardwareAddr, class func() fingerprint.Class) string {
+	var c fingerprint.Class
+	if t.classify {
+		c = class()
+	}
+	var p *placement.Placement
+	for _, r := range t.routes {
+		if r.classes.Has(c) || slices.ContainsFunc(r.ouis, func(prefix []byte) bool {
+			return strings.HasPrefix(string(mac), string(prefix))
+		}) {
+			return r.name
+		}
+		if r.racks.Len() == 0 && r.pools.Len() == 0 {
+			continue
+		}
+		if p == nil {
+			located, err := t.locate(mac)
+			if err != nil {
+				log.Errorf("Failed to look up the placement of %s: %v", mac, err)
+			}
+			p = &located
+		}
+		if r.racks.Has(p.Rack) || r.pools.Has(p.Pool) {
+			return r.name
+		}
+	}
+	return t.fallback
+}
+
+// Of4 returns the route of a DHCPv4 client, empty if none.
+func (t *Table) Of4(req *dhcpv4.DHCPv4) string {
+	return t.of(req.ClientHWAddr, func() fingerprint.Class {
+		return fingerprint.Classify4(req).Class
+	})
+}
+
+// Of6 returns the route of a DHCPv6 client, empty if none. The MAC address is
+// taken from the relay or the client's DUID.
+func (t *Table) Of6(req dhcpv6.DHCPv6) string {
+	mac, _ := dhcpv6.ExtractMAC(req)
+	return t.of(mac, func() fingerprint.Class {
+		result, err := fingerprint.Classify6(req)
+		if err != nil {
+			return fingerprint.ClassUnknown
+		}
+		return result.Class
+	})
+}
+
+// ParseArgs extracts the route from the plugin arguments and returns the
+// remaining ones, which are passed to the plugin.
+func ParseArgs(args ...string) (string, []string, error) {
+	var name string
+	var rest []string
+	for _, arg := range args {
+		value, ok := strings.CutPrefix(arg, argPrefix)
+		if !ok {
+			rest = append(rest, arg)
+			continue
+		}
+		if name != "" {
+			return "", nil, fmt.Errorf("route given more than once")
+		}
+		if value == "" {
+			return "", nil, fmt.Errorf("route must not be empty")
+		}
+		name = value
+	}
+	return name, rest, nil
+}
+
+// Wrap4 makes a DHCPv4 handler handle the messages of the route's clients only.
+func (t *Table) Wrap4(name string, h handler.Handler4) handler.Handler4 {
+	return func(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+		if t.Of4(req) != name {
+			return resp, false
+		}
+		return h(req, resp)
+	}
+}
+
+// Wrap6 makes a DHCPv6 handler handle the messages of the route's clients only.
+func (t *Table) Wrap6(name string, h handler.Handler6) handler.Handler6 {
+	return func(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+		if t.Of6(req) != name {
+			return resp, false
+		}
+		return h(req, resp)
+	}
+}
+
+// check returns an error if the route is not in the table.
+func (t *Table) check(name string) error {
+	if t == nil {
+		return fmt.Errorf("route %s given, but no routes are configured", name)
+	}
+	if !t.Has(name) {
+		return fmt.Errorf("unknown route %s", name)
+	}
+	return nil
+}
+
+// Wrap returns a copy of the plugin, whose entries accept a route argument.
+func (t *Table) Wrap(p *plugins.Plugin) *plugins.Plugin {
+	wrapped := &plugins.Plugin{Name: p.Name}
+	if p.Setup4 != nil {
+		wrapped.Setup4 = func(args ...string) (handler.Handler4, error) {
+			name, rest, err := ParseArgs(args...)
+			if err == nil && name != "" {
+				err = t.check(name)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("plugin %s: %w", p.Name, err)
+			}
+			h, err := p.Setup4(rest...)
+			if err != nil || name == "" {
+				return h, err
+			}
+			return t.Wrap4(name, h), nil
+		}
+	}
+	if p.Setup6 != nil {
+		wrapped.Setup6 = func(args ...string) (handler.Handler6, error) {
+			name, rest, err := ParseArgs(args...)
+			if err == nil && name != "" {
+				err = t.check(name)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("plugin %s: %w", p.Name, err)
+			}
+			h, err := p.Setup6(rest...)
+			if err != nil || name == "" {
+				return h, err
+			}
+			return t.Wrap6(name, h), nil
+		}
+	}
+	return wrapped
+}
@@ -0,0 +1,207 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package route
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/api/apitest"
+	"github.com/ironcore-dev/fedhcp/internal/placement"
+)
+
+var (
+	vmMAC   = net.HardwareAddr{0x52, 0x54, 0x00, 0x12, 0x34, 0x56}
+	hostMAC = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+
+	storageMAC = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5f}
+	failingMAC = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x60}
+)
+
+var config = api.RouteConfig{
+	Routes: []api.Route{
+		{Name: "vms", OUIs: []string{"52:54:00"}},
+		{Name: "switches", Classes: []string{"switch"}},
+	},
+	Default: "hosts",
+}
+
+// testPlugin handles every message by setting the hostname option to its
+// argument.
+var testPlugin = plugins.Plugin{
+	Name: "test",
+	Setup4: func(args ...string) (handler.Handler4, error) {
+		return func(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+			resp.UpdateOption(dhcpv4.OptHostName(args[0]))
+			return resp, false
+		}, nil
+	},
+	Setup6: func(args ...string) (handler.Handler6, error) {
+		return func(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+			resp.AddOption(dhcpv6.OptBootFileURL(args[0]))
+			return resp, false
+		}, nil
+	},
+}
+
+func newTable(t *testing.T) *Table {
+	table, err := Load(apitest.WriteConfig(t, config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return table
+}
+
+func TestWrongConfig(t *testing.T) {
+	for _, config := range []api.RouteConfig{
+		{Routes: []api.Route{{OUIs: []string{"52:54:00"}}}},
+		{Routes: []api.Route{{Name: "vms"}}},
+		{Routes: []api.Route{{Name: "vms", OUIs: []string{"52:54:0"}}}},
+		{Routes: []api.Route{{Name: "vms", OUIs: []string{"00:00:00:00:00:00:00"}}}},
+		{Routes: []api.Route{{Name: "vms", Classes: []string{"toaster"}}}},
+		{Routes: []api.Route{{Name: "vms", OUIs: []string{"52:54:00"}}, {Name: "vms", OUIs: []string{"02:00"}}}},
+		{Routes: []api.Route{{Name: "edge", Racks: []string{""}}}},
+	} {
+		if _, err := New(&config); err == nil {
+			t.Errorf("no error occurred for invalid config %+v, but it should have", config)
+		}
+	}
+}
+
+func TestWrongArgs(t *testing.T) {
+	table := newTable(t)
+	for _, args := range [][]string{
+		{"foo", "route=vms", "route=hosts"},
+		{"foo", "route="},
+		{"foo", "route=tenants"},
+	} {
+		if _, err := table.Wrap(&testPlugin).Setup4(args...); err == nil {
+			t.Errorf("no error occurred when setting up a plugin with %v, but it should have", args)
+		}
+	}
+
+	var none *Table
+	if _, err := none.Wrap(&testPlugin).Setup6("foo", "route=vms"); err == nil {
+		t.Error("no error occurred when setting up a plugin with a route but no routes, but it should have")
+	}
+	if _, err := none.Wrap(&testPlugin).Setup6("foo"); err != nil {
+		t.Errorf("unexpected error setting up a plugin without route: %v", err)
+	}
+}
+
+func TestRoute4(t *testing.T) {
+	table := newTable(t)
+	var handlers []handler.Handler4
+	for _, args := range [][]string{{"vm", "route=vms"}, {"host", "route=hosts"}, {"switch", "route=switches"}} {
+		h, err := table.Wrap(&testPlugin).Setup4(args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handlers = append(handlers, h)
+	}
+
+	for _, tc := range []struct {
+		mac      net.HardwareAddr
+		class    string
+		expected string
+	}{
+		{mac: vmMAC, expected: "vm"},
+		{mac: hostMAC, expected: "host"},
+		{mac: hostMAC, class: "SONiC-ZTP", expected: "switch"},
+		// OUIs and classes are matched in the order of the routes
+		{mac: vmMAC, class: "SONiC-ZTP", expected: "vm"},
+	} {
+		req, _ := dhcpv4.NewDiscovery(tc.mac)
+		if tc.class != "" {
+			req.UpdateOption(dhcpv4.OptClassIdentifier(tc.class))
+		}
+		resp, _ := dhcpv4.NewReplyFromRequest(req)
+		for _, h := range handlers {
+			resp, _ = h(req, resp)
+		}
+		if resp.HostName() != tc.expected {
+			t.Errorf("expected %s with class %q to be routed to %s, got %s", tc.mac, tc.class, tc.expected, resp.HostName())
+		}
+	}
+}
+
+func TestRoute6(t *testing.T) {
+	table := newTable(t)
+	h, err := table.Wrap(&testPlugin).Setup6("vm", "route=vms")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for mac, routed := range map[string]bool{vmMAC.String(): true, hostMAC.String(): false} {
+		hwAddr, _ := net.ParseMAC(mac)
+		req, _ := dhcpv6.NewSolicit(hwAddr)
+		resp, _ := dhcpv6.NewAdvertiseFromSolicit(req)
+		resp6, _ := h(req, resp)
+		if got := resp6.(*dhcpv6.Message).Options.BootFileURL() == "vm"; got != routed {
+			t.Errorf("expected %s to be routed %t, got %t", mac, routed, got)
+		}
+	}
+}
+
+func TestPlacement(t *testing.T) {
+	table, err := New(&api.RouteConfig{
+		Routes: []api.Route{
+			{Name: "vms", OUIs: []string{"52:54:00"}},
+			{Name: "edge", Racks: []string{"r12", "r13"}},
+			{Name: "storage", Pools: []string{"storage"}},
+		},
+		Default: "hosts",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !table.RequiresKubernetes() {
+		t.Error("expected a table matching racks to require kubernetes")
+	}
+
+	lookups := 0
+	placements := map[string]placement.Placement{
+		hostMAC.String():    {Rack: "r12", Pool: "compute"},
+		storageMAC.String(): {Rack: "r20", Pool: "storage"},
+	}
+	table.locate = func(mac net.HardwareAddr) (placement.Placement, error) {
+		lookups++
+		if mac.String() == failingMAC.String() {
+			return placement.Placement{}, errors.New("unavailable")
+		}
+		return placements[mac.String()], nil
+	}
+
+	for _, tc := range []struct {
+		mac      net.HardwareAddr
+		expected string
+		lookups  int
+	}{
+		// routes before the first one matching racks or pools need no lookup
+		{mac: vmMAC, expected: "vms", lookups: 0},
+		{mac: hostMAC, expected: "edge", lookups: 1},
+		// the placement is looked up once per message
+		{mac: storageMAC, expected: "storage", lookups: 1},
+		{mac: failingMAC, expected: "hosts", lookups: 1},
+	} {
+		lookups = 0
+		req, _ := dhcpv4.NewDiscovery(tc.mac)
+		if route := table.Of4(req); route != tc.expected {
+			t.Errorf("expected %s to be routed to %s, got %s", tc.mac, tc.expected, route)
+		}
+		if lookups != tc.lookups {
+			t.Errorf("expected %d placement lookups for %s, got %d", tc.lookups, tc.mac, lookups)
+		}
+	}
+
+	if newTable(t).RequiresKubernetes() {
+		t.Error("expected a table without racks and pools not to require kubernetes")
+	}
+}
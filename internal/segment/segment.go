@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package segment limits the concurrent kubernetes writes per network segment,
+// i.e. per relay, so that a mass power-on of one rack cannot consume the whole
+// API budget of all others. The limit applies process-wide, to all plugins
+// writing IPAM IPs or Endpoints.
+package segment
+
+import (
+	"context"
+	"sync"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Direct is the segment of clients which are not relayed.
+const Direct = "direct"
+
+var (
+	queueLength = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "segment",
+		Name:      "write_queue_length",
+		Help:      "Number of kubernetes writes waiting for a slot, per segment.",
+	}, []string{"segment"})
+	inFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "segment",
+		Name:      "writes_in_flight",
+		Help:      "Number of kubernetes writes in progress, per segment.",
+	}, []string{"segment"})
+)
+
+// slots is the semaphore of a segment, it is dropped once unused.
+type slots struct {
+	sem chan struct{}
+	// users counts the writes holding or waiting for a slot
+	users int
+}
+
+var (
+	// mu guards limit and segments
+	mu       sync.Mutex
+	limit    int
+	segments = make(map[string]*slots)
+)
+
+// SetLimit sets the maximum number of concurrent writes per segment, 0
+// disables the limit. Writes in progress keep the limit they started with.
+func SetLimit(n int) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if n > 0 {
+		metrics.Register(queueLength, inFlight)
+	}
+	limit = n
+	segments = make(map[string]*slots)
+}
+
+// Of6 returns the segment of a DHCPv6 request, the link address of the relay
+// closest to the client.
+func Of6(req dhcpv6.DHCPv6) string {
+	if !req.IsRelay() {
+		return Direct
+	}
+	inner, err := dhcpv6.DecapsulateRelayIndex(req, -1)
+	if err != nil {
+		return Direct
+	}
+	return inner.(*dhcpv6.RelayMessage).LinkAddr.String()
+}
+
+// Of4 returns the segment of a DHCPv4 request, the relay agent address.
+func Of4(req *dhcpv4.DHCPv4) string {
+	if req.GatewayIPAddr == nil || req.GatewayIPAddr.IsUnspecified() {
+		return Direct
+	}
+	return req.GatewayIPAddr.String()
+}
+
+// Acquire waits for a write slot of the segment. The returned function
+// releases it and must be called once the writes are done.
+func Acquire(ctx context.Context, segment string) (func(), error) {
+	mu.Lock()
+	if limit <= 0 {
+		mu.Unlock()
+		return func() {}, nil
+	}
+	s, ok := segments[segment]
+	if !ok {
+		s = &slots{sem: make(chan struct{}, limit)}
+		segments[segment] = s
+	}
+	s.users++
+	mu.Unlock()
+
+	queueLength.WithLabelValues(segment).Inc()
+	select {
+	case s.sem <- struct{}{}:
+		queueLength.WithLabelValues(segment).Dec()
+	case <-ctx.Done():
+		queueLength.WithLabelValues(segment).Dec()
+		done(segment, s)
+		return nil, ctx.Err()
+	}
+
+	inFlight.WithLabelValues(segment).Inc()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			inFlight.WithLabelValues(segment).Dec()
+			<-s.sem
+			done(segment, s)
+		})
+	}, nil
+}
+
+// done drops the semaphore of the segment once it has no users left.
+func done(segment string, s *slots) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	s.users--
+	if s.users == 0 && segments[segment] == s {
+		delete(segments, segment)
+	}
+}
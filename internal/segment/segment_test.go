@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package segment
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+func TestAcquire(t *testing.T) {
+	SetLimit(1)
+	defer SetLimit(0)
+
+	release, err := Acquire(context.Background(), "2001:db8::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another segment is not limited by the first one
+	other, err := Acquire(context.Background(), "2001:db8::2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := Acquire(ctx, "2001:db8::1"); err == nil {
+		t.Error("no error occurred when acquiring a second slot of a segment with limit 1, but it should have")
+	}
+
+	release()
+	// releasing twice must not free a slot held by another write
+	release()
+	second, err := Acquire(context.Background(), "2001:db8::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	third := make(chan struct{})
+	go func() {
+		r, _ := Acquire(context.Background(), "2001:db8::1")
+		close(third)
+		r()
+	}()
+	select {
+	case <-third:
+		t.Error("expected the third write to wait for the second one")
+	case <-time.After(10 * time.Millisecond):
+	}
+	second()
+	<-third
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(segments) != 0 {
+		t.Errorf("expected unused segments to be dropped, got %v", segments)
+	}
+}
+
+func TestAcquireUnlimited(t *testing.T) {
+	for range 3 {
+		if _, err := Acquire(context.Background(), Direct); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestOf(t *testing.T) {
+	req, _ := dhcpv6.NewMessage()
+	if s := Of6(req); s != Direct {
+		t.Errorf("expected segment %s for a non-relayed message, got %s", Direct, s)
+	}
+	relayed, _ := dhcpv6.EncapsulateRelay(req, dhcpv6.MessageTypeRelayForward, net.ParseIP("2001:db8:1::1"), net.ParseIP("fe80::1"))
+	relayed, _ = dhcpv6.EncapsulateRelay(relayed, dhcpv6.MessageTypeRelayForward, net.ParseIP("2001:db8:2::1"), net.ParseIP("fe80::2"))
+	if s := Of6(relayed); s != "2001:db8:1::1" {
+		t.Errorf("expected the link address of the relay closest to the client, got %s", s)
+	}
+
+	req4, _ := dhcpv4.NewDiscovery(net.HardwareAddr{0, 1, 2, 3, 4, 5})
+	if s := Of4(req4); s != Direct {
+		t.Errorf("expected segment %s for a non-relayed message, got %s", Direct, s)
+	}
+	req4.GatewayIPAddr = net.IPv4(192, 168, 1, 1)
+	if s := Of4(req4); s != "192.168.1.1" {
+		t.Errorf("expected the relay agent address, got %s", s)
+	}
+}
@@ -0,0 +1,292 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package selftest probes a started server through its sockets. A DHCPv4
+// DISCOVER is sent as relayed from a loopback address, so the reply is unicast
+// back to it, and a DHCPv6 SOLICIT is sent directly, the reply going back to
+// its source. A probe passes if the reply carries the expected options. The
+// plugins acting beyond their response, e.g. by creating IPs or Endpoints, pass
+// the messages of the self-test client on untouched, see Wrap.
+package selftest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/coredhcp/coredhcp/config"
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv4/server4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/sideeffects"
+)
+
+// DefaultRelay4 is the relay agent address DHCPv4 probes are sent from. It is
+// on loopback but differs from 127.0.0.1, so the relay socket and a server
+// listening on all addresses do not receive each other's packets.
+var DefaultRelay4 = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: dhcpv4.ServerPort}
+
+// Probe is a self-test of the listeners of a configuration.
+type Probe struct {
+	// MAC is the hardware address of the synthetic client
+	MAC net.HardwareAddr
+	// Options4 and Options6 must all be present in the replies
+	Options4 []dhcpv4.OptionCode
+	Options6 []dhcpv6.OptionCode
+	// Timeout bounds the wait for each reply
+	Timeout time.Duration
+	// Relay4 is the relay agent address of DHCPv4 probes, DefaultRelay4 if nil
+	Relay4 *net.UDPAddr
+}
+
+// ParseOptions4 parses comma separated DHCPv4 option codes.
+func ParseOptions4(s string) ([]dhcpv4.OptionCode, error) {
+	var codes []dhcpv4.OptionCode
+	for _, field := range fields(s) {
+		code, err := strconv.ParseUint(field, 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DHCPv4 option code %q", field)
+		}
+		codes = append(codes, dhcpv4.GenericOptionCode(code))
+	}
+	return codes, nil
+}
+
+// ParseOptions6 parses comma separated DHCPv6 option codes.
+func ParseOptions6(s string) ([]dhcpv6.OptionCode, error) {
+	var codes []dhcpv6.OptionCode
+	for _, field := range fields(s) {
+		code, err := strconv.ParseUint(field, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DHCPv6 option code %q", field)
+		}
+		codes = append(codes, dhcpv6.OptionCode(code))
+	}
+	return codes, nil
+}
+
+func fields(s string) []string {
+	var fields []string
+	for _, field := range strings.Split(s, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// Target4 returns the address a DHCPv4 probe of the listener is sent to,
+// 127.0.0.1 for a listener on all addresses.
+func Target4(listen net.UDPAddr) *net.UDPAddr {
+	target := &net.UDPAddr{IP: listen.IP, Port: listen.Port}
+	if listen.IP == nil || listen.IP.IsUnspecified() || listen.IP.Equal(net.IPv4bcast) {
+		target.IP = net.IPv4(127, 0, 0, 1)
+	}
+	return target
+}
+
+// Target6 returns the address a DHCPv6 probe of the listener is sent to, ::1
+// for a listener on all addresses. Multicast and link-local addresses are
+// reached on the listener's interface.
+func Target6(listen net.UDPAddr) *net.UDPAddr {
+	target := &net.UDPAddr{IP: listen.IP, Port: listen.Port}
+	switch {
+	case listen.IP == nil || listen.IP.IsUnspecified():
+		target.IP = net.IPv6loopback
+	case listen.IP.IsMulticast() || listen.IP.IsLinkLocalUnicast():
+		target.Zone = listen.Zone
+	}
+	return target
+}
+
+// Run probes every listener of the configuration and returns the failures.
+func (p Probe) Run(cfg *config.Config) error {
+	var errs []error
+	if cfg.Server4 != nil {
+		for _, listen := range cfg.Server4.Addresses {
+			if err := p.Probe4(Target4(listen)); err != nil {
+				errs = append(errs, fmt.Errorf("DHCPv4 listener %s: %w", listen.String(), err))
+			}
+		}
+	}
+	if cfg.Server6 != nil {
+		for _, listen := range cfg.Server6.Addresses {
+			if err := p.Probe6(Target6(listen)); err != nil {
+				errs = append(errs, fmt.Errorf("DHCPv6 listener %s: %w", listen.String(), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Probe4 sends a relayed DISCOVER to the target and checks the reply.
+func (p Probe) Probe4(target *net.UDPAddr) error {
+	relay := p.Relay4
+	if relay == nil {
+		relay = DefaultRelay4
+	}
+	conn, err := server4.NewIPv4UDPConn("", relay)
+	if err != nil {
+		return fmt.Errorf("failed to listen on relay address %s: %w", relay, err)
+	}
+	defer conn.Close()
+
+	req, err := dhcpv4.NewDiscovery(p.MAC, dhcpv4.WithGatewayIP(relay.IP))
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(p.Timeout)); err != nil {
+		return err
+	}
+	if _, err := conn.WriteTo(req.ToBytes(), target); err != nil {
+		return fmt.Errorf("failed to send DISCOVER: %w", err)
+	}
+
+	buf := make([]byte, 4096)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return fmt.Errorf("no reply to DISCOVER: %w", err)
+		}
+		resp, err := dhcpv4.FromBytes(buf[:n])
+		if err != nil || resp.OpCode != dhcpv4.OpcodeBootReply || resp.TransactionID != req.TransactionID {
+			continue
+		}
+		var missing []string
+		for _, code := range p.Options4 {
+			if !resp.Options.Has(code) {
+				missing = append(missing, code.String())
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("%s lacks options %s", resp.MessageType(), strings.Join(missing, ", "))
+		}
+		return nil
+	}
+}
+
+// Probe6 sends a SOLICIT to the target and checks the reply.
+func (p Probe) Probe6(target *net.UDPAddr) error {
+	conn, err := net.ListenUDP("udp6", nil)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	defer conn.Close()
+
+	req, err := dhcpv6.NewSolicit(p.MAC)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(p.Timeout)); err != nil {
+		return err
+	}
+	if _, err := conn.WriteTo(req.ToBytes(), target); err != nil {
+		return fmt.Errorf("failed to send SOLICIT: %w", err)
+	}
+
+	buf := make([]byte, 4096)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return fmt.Errorf("no reply to SOLICIT: %w", err)
+		}
+		msg, err := dhcpv6.MessageFromBytes(buf[:n])
+		if err != nil || msg.TransactionID != req.TransactionID {
+			continue
+		}
+		var missing []string
+		for _, code := range p.Options6 {
+			if msg.GetOneOption(code) == nil {
+				missing = append(missing, code.String())
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("%s lacks options %s", msg.MessageType, strings.Join(missing, ", "))
+		}
+		return nil
+	}
+}
+
+// passed tells whether the self-test has passed.
+var passed atomic.Bool
+
+// Pass records that the self-test passed.
+func Pass() {
+	passed.Store(true)
+}
+
+// Handler serves 200 once the self-test passed and 503 before, for a startup
+// probe.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if !passed.Load() {
+			http.Error(w, "self-test pending", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = fmt.Fprintln(w, "self-test passed")
+	})
+}
+
+// client is the MAC address of the self-test client, nil without self-test.
+var client atomic.Pointer[net.HardwareAddr]
+
+// SetClient sets the MAC address of the self-test client, whose messages the
+// plugins wrapped by Wrap pass on untouched.
+func SetClient(mac net.HardwareAddr) {
+	client.Store(&mac)
+}
+
+// isClient tells whether the MAC address is the one of the self-test client.
+func isClient(mac net.HardwareAddr) bool {
+	c := client.Load()
+	return c != nil && bytes.Equal(*c, mac)
+}
+
+// Wrap returns the plugin with handlers passing the messages of the self-test
+// client on untouched if its handlers have side effects, see
+// sideeffects.InHandler, so that the self-test neither writes to kubernetes or
+// other services nor fails on the synthetic client, e.g. for lack of an IPAM
+// subnet of its loopback relay. Other plugins are returned as they are.
+func Wrap(p *plugins.Plugin) *plugins.Plugin {
+	if !sideeffects.InHandler(p.Name) {
+		return p
+	}
+	wrapped := &plugins.Plugin{Name: p.Name}
+	if p.Setup4 != nil {
+		wrapped.Setup4 = func(args ...string) (handler.Handler4, error) {
+			h, err := p.Setup4(args...)
+			if err != nil {
+				return nil, err
+			}
+			return func(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+				if isClient(req.ClientHWAddr) {
+					return resp, false
+				}
+				return h(req, resp)
+			}, nil
+		}
+	}
+	if p.Setup6 != nil {
+		wrapped.Setup6 = func(args ...string) (handler.Handler6, error) {
+			h, err := p.Setup6(args...)
+			if err != nil {
+				return nil, err
+			}
+			return func(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+				if mac, err := dhcpv6.ExtractMAC(req); err == nil && isClient(mac) {
+					return resp, false
+				}
+				return h(req, resp)
+			}, nil
+		}
+	}
+	return wrapped
+}
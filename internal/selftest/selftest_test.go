@@ -0,0 +1,200 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package selftest
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+var mac = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+
+// serve answers the requests received on conn with the reply built by respond.
+func serve(t *testing.T, network, address string, respond func([]byte) []byte) *net.UDPAddr {
+	conn, err := net.ListenPacket(network, address)
+	if err != nil {
+		t.Skipf("cannot listen on %s: %v", address, err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, peer, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if reply := respond(buf[:n]); reply != nil {
+				_, _ = conn.WriteTo(reply, peer)
+			}
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr)
+}
+
+func TestParseOptions(t *testing.T) {
+	codes4, err := ParseOptions4("54, 3,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes4) != 2 || codes4[0].Code() != 54 || codes4[1].Code() != 3 {
+		t.Errorf("expected DHCPv4 options 54 and 3, got %v", codes4)
+	}
+	if _, err := ParseOptions4("256"); err == nil {
+		t.Error("no error occurred for DHCPv4 option 256, but it should have")
+	}
+
+	codes6, err := ParseOptions6("2,23")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes6) != 2 || codes6[0] != dhcpv6.OptionServerID || codes6[1] != dhcpv6.OptionDNSRecursiveNameServer {
+		t.Errorf("expected DHCPv6 options 2 and 23, got %v", codes6)
+	}
+	if _, err := ParseOptions6("dns"); err == nil {
+		t.Error("no error occurred for DHCPv6 option dns, but it should have")
+	}
+}
+
+func TestTargets(t *testing.T) {
+	if target := Target4(net.UDPAddr{IP: net.IPv4zero, Port: 67}); !target.IP.Equal(net.IPv4(127, 0, 0, 1)) || target.Port != 67 {
+		t.Errorf("expected loopback target for a wildcard listener, got %s", target)
+	}
+	if target := Target4(net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 67}); !target.IP.Equal(net.IPv4(192, 168, 0, 1)) {
+		t.Errorf("expected the listen address as target, got %s", target)
+	}
+	if target := Target6(net.UDPAddr{IP: net.IPv6unspecified, Port: 547}); !target.IP.Equal(net.IPv6loopback) {
+		t.Errorf("expected loopback target for a wildcard listener, got %s", target)
+	}
+	if target := Target6(net.UDPAddr{IP: net.ParseIP("ff02::1:2"), Port: 547, Zone: "eth0"}); target.Zone != "eth0" {
+		t.Errorf("expected the multicast target on the listener's interface, got %s", target)
+	}
+}
+
+/* IPv4 */
+func TestProbe4(t *testing.T) {
+	target := serve(t, "udp4", "127.0.0.1:0", func(b []byte) []byte {
+		req, err := dhcpv4.FromBytes(b)
+		if err != nil {
+			return nil
+		}
+		resp, _ := dhcpv4.NewReplyFromRequest(req,
+			dhcpv4.WithMessageType(dhcpv4.MessageTypeOffer),
+			dhcpv4.WithServerIP(net.IPv4(127, 0, 0, 1)),
+			dhcpv4.WithOption(dhcpv4.OptServerIdentifier(net.IPv4(127, 0, 0, 1))))
+		return resp.ToBytes()
+	})
+
+	p := Probe{MAC: mac, Timeout: time.Second, Relay4: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2)}}
+	p.Options4 = []dhcpv4.OptionCode{dhcpv4.OptionServerIdentifier}
+	if err := p.Probe4(target); err != nil {
+		t.Errorf("probe failed: %v", err)
+	}
+
+	p.Options4 = []dhcpv4.OptionCode{dhcpv4.OptionServerIdentifier, dhcpv4.OptionRouter}
+	if err := p.Probe4(target); err == nil {
+		t.Error("probe passed without option router, but it shouldn't have")
+	}
+}
+
+/* IPv6 */
+func TestProbe6(t *testing.T) {
+	target := serve(t, "udp6", "[::1]:0", func(b []byte) []byte {
+		req, err := dhcpv6.MessageFromBytes(b)
+		if err != nil {
+			return nil
+		}
+		resp, _ := dhcpv6.NewAdvertiseFromSolicit(req,
+			dhcpv6.WithServerID(&dhcpv6.DUIDLL{HWType: 1, LinkLayerAddr: mac}))
+		return resp.ToBytes()
+	})
+
+	p := Probe{MAC: mac, Timeout: time.Second, Options6: []dhcpv6.OptionCode{dhcpv6.OptionServerID}}
+	if err := p.Probe6(target); err != nil {
+		t.Errorf("probe failed: %v", err)
+	}
+
+	p.Options6 = append(p.Options6, dhcpv6.OptionDNSRecursiveNameServer)
+	if err := p.Probe6(target); err == nil {
+		t.Error("probe passed without DNS servers, but it shouldn't have")
+	}
+
+	p.Timeout = 100 * time.Millisecond
+	if err := p.Probe6(&net.UDPAddr{IP: net.IPv6loopback, Port: 9}); err == nil {
+		t.Error("probe passed without a server, but it shouldn't have")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/self-test", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503 before the self-test passed, got %d", rec.Code)
+	}
+
+	Pass()
+	rec = httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/self-test", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status 200 after the self-test passed, got %d", rec.Code)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	SetClient(mac)
+	t.Cleanup(func() { client.Store(nil) })
+
+	var handled int
+	newPlugin := func(name string) *plugins.Plugin {
+		return &plugins.Plugin{
+			Name: name,
+			Setup4: func(...string) (handler.Handler4, error) {
+				return func(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+					handled++
+					return nil, true
+				}, nil
+			},
+			Setup6: func(...string) (handler.Handler6, error) {
+				return func(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+					handled++
+					return nil, true
+				}, nil
+			},
+		}
+	}
+	if p := newPlugin("server_id"); Wrap(p) != p {
+		t.Error("expected a plugin without side effects not to be wrapped")
+	}
+
+	wrapped := Wrap(newPlugin("oob"))
+	h4, _ := wrapped.Setup4()
+	h6, _ := wrapped.Setup6()
+	other := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+	for _, m := range []net.HardwareAddr{mac, other} {
+		req4, _ := dhcpv4.NewDiscovery(m)
+		resp4, _ := dhcpv4.NewReplyFromRequest(req4)
+		req6, _ := dhcpv6.NewSolicit(m)
+		resp6, _ := dhcpv6.NewAdvertiseFromSolicit(req6)
+
+		reply4, stop4 := h4(req4, resp4)
+		reply6, stop6 := h6(req6, resp6)
+		skipped := m.String() == mac.String()
+		if skipped && (stop4 || stop6 || reply4 != resp4 || reply6 != resp6) {
+			t.Errorf("expected the messages of the self-test client to be passed on untouched")
+		}
+		if !skipped && (!stop4 || !stop6) {
+			t.Errorf("expected the messages of %s to be handled", m)
+		}
+	}
+	if handled != 2 {
+		t.Errorf("expected the messages of other clients only to be handled, got %d", handled)
+	}
+}
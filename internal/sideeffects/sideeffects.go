@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package sideeffects lists the plugins acting beyond their response: they
+// create, update or delete kubernetes objects, write files or send messages to
+// other services. Chains run besides the serving one, e.g. the candidate chain
+// of the canary plugin, must not contain them, or they act twice.
+package sideeffects
+
+import (
+	"slices"
+
+	"github.com/coredhcp/coredhcp/config"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// plugins are the plugins with side effects.
+var plugins = sets.New("oob", "ipam", "metal", "recorder", "dnsendpoint", "serverduid", "syslog", "capture")
+
+// setupOnly are the plugins with side effects at setup only, e.g. persisting
+// state their handlers then only read.
+var setupOnly = sets.New("serverduid")
+
+// Has reports whether the plugin has side effects.
+func Has(name string) bool {
+	return plugins.Has(name)
+}
+
+// InHandler reports whether the handlers of the plugin have side effects, i.e.
+// whether handling a message acts beyond the response.
+func InHandler(name string) bool {
+	return plugins.Has(name) && !setupOnly.Has(name)
+}
+
+// Of returns the sorted names of the plugins of the configuration, and of the
+// chains of its tenants, with side effects. Tenant configs failing to load are
+// reported by the tenant plugin.
+func Of(cfg *config.Config) []string {
+	found := sets.New[string]()
+	for _, server := range []*config.ServerConfig{cfg.Server4, cfg.Server6} {
+		if server == nil {
+			continue
+		}
+		for _, entry := range server.Plugins {
+			if plugins.Has(entry.Name) {
+				found.Insert(entry.Name)
+			}
+			if entry.Name == "tenant" && len(entry.Args) > 0 {
+				found.Insert(ofTenants(entry.Args[0])...)
+			}
+		}
+	}
+	names := found.UnsortedList()
+	slices.Sort(names)
+	return names
+}
+
+// ofTenants returns the plugins of the chains of the tenant config with side
+// effects.
+func ofTenants(path string) []string {
+	tenants := &api.TenantConfig{}
+	if err := api.Load(path, tenants); err != nil {
+		return nil
+	}
+	var names []string
+	for _, t := range tenants.Tenants {
+		if cfg, err := config.Load(t.Config); err == nil {
+			names = append(names, Of(cfg)...)
+		}
+	}
+	return names
+}
@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package sideeffects
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/coredhcp/coredhcp/config"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+)
+
+func writeFile(t *testing.T, name, data string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOf(t *testing.T) {
+	chain := writeFile(t, "chain.yaml", "server6:\n  plugins:\n    - recorder: recorder_config.yaml\n")
+	tenants := filepath.Join(t.TempDir(), "tenant_config.yaml")
+	if err := api.WriteFile(tenants, &api.TenantConfig{Tenants: []api.Tenant{
+		{Name: "lab", Direct: true, Namespace: "lab", Config: chain},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		conf     string
+		expected []string
+	}{
+		{"server4:\n  plugins:\n    - server_id: 10.0.0.1\n    - file: leases.txt\n", nil},
+		{"server4:\n  plugins:\n    - oob: oob_config.yaml\n    - metal: metal_config.yaml\n" +
+			"server6:\n  plugins:\n    - oob: oob_config.yaml\n", []string{"metal", "oob"}},
+		{"server6:\n  plugins:\n    - tenant: " + tenants + "\n", []string{"recorder"}},
+	} {
+		cfg, err := config.Load(writeFile(t, "config.yaml", tc.conf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found := Of(cfg); !slices.Equal(found, tc.expected) {
+			t.Errorf("expected %v, got %v", tc.expected, found)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package simulate
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+)
+
+// Client is a synthetic DHCP client.
+type Client struct {
+	MAC net.HardwareAddr
+	// Relay is the relay agent the messages are forwarded by: the gateway IP
+	// address of DHCPv4 messages, the link address of DHCPv6 messages. Messages
+	// are sent directly if it is nil.
+	Relay       net.IP
+	VendorClass string
+	Hostname    string
+}
+
+func (cl Client) modifiers4() []dhcpv4.Modifier {
+	var modifiers []dhcpv4.Modifier
+	if cl.Relay != nil {
+		modifiers = append(modifiers, dhcpv4.WithRelay(cl.Relay))
+	}
+	if cl.VendorClass != "" {
+		modifiers = append(modifiers, dhcpv4.WithOption(dhcpv4.OptClassIdentifier(cl.VendorClass)))
+	}
+	if cl.Hostname != "" {
+		modifiers = append(modifiers, dhcpv4.WithOption(dhcpv4.OptHostName(cl.Hostname)))
+	}
+	return modifiers
+}
+
+// Exchange4 simulates a DHCPv4 DISCOVER and, if an address is offered, the
+// REQUEST of the offered address. It returns the exchanges up to the first
+// message dropped.
+func (c *Chain) Exchange4(cl Client) ([]Exchange, error) {
+	discover, err := dhcpv4.NewDiscovery(cl.MAC, cl.modifiers4()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build DISCOVER: %w", err)
+	}
+	offer, x, err := c.Handle4(discover)
+	exchanges := []Exchange{x}
+	if err != nil || offer == nil || offer.YourIPAddr.IsUnspecified() {
+		return exchanges, err
+	}
+
+	request, err := dhcpv4.NewRequestFromOffer(offer, cl.modifiers4()...)
+	if err != nil {
+		return exchanges, fmt.Errorf("failed to build REQUEST: %w", err)
+	}
+	_, x, err = c.Handle4(request)
+	return append(exchanges, x), err
+}
+
+func (cl Client) modifiers6() []dhcpv6.Modifier {
+	var modifiers []dhcpv6.Modifier
+	if cl.VendorClass != "" {
+		modifiers = append(modifiers, dhcpv6.WithOption(&dhcpv6.OptVendorClass{Data: [][]byte{[]byte(cl.VendorClass)}}))
+	}
+	if cl.Hostname != "" {
+		modifiers = append(modifiers, dhcpv6.WithFQDN(0, cl.Hostname))
+	}
+	return modifiers
+}
+
+// relay encapsulates a message the way a relay agent forwards it, with the
+// client's link-local address as peer address.
+func (cl Client) relay(msg *dhcpv6.Message) (dhcpv6.DHCPv6, error) {
+	if cl.Relay == nil {
+		return msg, nil
+	}
+	relay, err := dhcpv6.EncapsulateRelay(msg, dhcpv6.MessageTypeRelayForward, cl.Relay, linkLocal(cl.MAC))
+	if err != nil {
+		return nil, err
+	}
+	relay.AddOption(dhcpv6.OptClientLinkLayerAddress(iana.HWTypeEthernet, cl.MAC))
+	return relay, nil
+}
+
+// linkLocal returns the EUI-64 link-local address of a MAC address.
+func linkLocal(mac net.HardwareAddr) net.IP {
+	ip := make(net.IP, net.IPv6len)
+	ip[0], ip[1] = 0xfe, 0x80
+	if len(mac) == 6 {
+		copy(ip[8:11], mac[0:3])
+		ip[8] ^= 0x02
+		ip[11], ip[12] = 0xff, 0xfe
+		copy(ip[13:16], mac[3:6])
+	}
+	return ip
+}
+
+// Exchange6 simulates a DHCPv6 SOLICIT and, if it is advertised, the REQUEST of
+// the advertised addresses. It returns the exchanges up to the first message
+// dropped.
+func (c *Chain) Exchange6(cl Client) ([]Exchange, error) {
+	solicit, err := dhcpv6.NewSolicit(cl.MAC, cl.modifiers6()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build SOLICIT: %w", err)
+	}
+	d, err := cl.relay(solicit)
+	if err != nil {
+		return nil, err
+	}
+	advertise, x, err := c.Handle6(d)
+	exchanges := []Exchange{x}
+	if err != nil || advertise == nil || advertise.MessageType != dhcpv6.MessageTypeAdvertise {
+		return exchanges, err
+	}
+
+	// the REQUEST is built from the SOLICIT, so that it carries the same client
+	// options, and the server ID and IAs of the ADVERTISE
+	request, err := dhcpv6.NewMessage(cl.modifiers6()...)
+	if err != nil {
+		return exchanges, fmt.Errorf("failed to build REQUEST: %w", err)
+	}
+	request.MessageType = dhcpv6.MessageTypeRequest
+	request.AddOption(solicit.GetOneOption(dhcpv6.OptionClientID))
+	for _, code := range []dhcpv6.OptionCode{dhcpv6.OptionServerID, dhcpv6.OptionIANA, dhcpv6.OptionIAPD} {
+		for _, opt := range advertise.GetOption(code) {
+			request.AddOption(opt)
+		}
+	}
+	if d, err = cl.relay(request); err != nil {
+		return exchanges, err
+	}
+	_, x, err = c.Handle6(d)
+	return append(exchanges, x), err
+}
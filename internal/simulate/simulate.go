@@ -0,0 +1,273 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package simulate runs synthetic DHCP exchanges through the plugin chain of a
+// configuration without binding sockets, recording the decision of each plugin
+// entry. The reply is built and the chain is run exactly as the coredhcp server
+// does.
+package simulate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coredhcp/coredhcp/config"
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/response"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// Outcome is what a plugin entry did with a message.
+type Outcome string
+
+const (
+	// Continued passes the response on to the next entry.
+	Continued Outcome = "continued"
+	// Stopped breaks the chain with the response.
+	Stopped Outcome = "stopped"
+	// Dropped drops the message.
+	Dropped Outcome = "dropped"
+	// Skipped is an entry which is not run in simulations.
+	Skipped Outcome = "skipped"
+)
+
+// Step is the decision of a plugin entry on a message.
+type Step struct {
+	Plugin  string
+	Outcome Outcome
+	// Changes are the lines of the response summary the entry removed, prefixed
+	// with "-", and added, prefixed with "+".
+	Changes []string
+}
+
+// Exchange is a message, the decisions of the plugin chain on it and the
+// resulting response, which is empty if the message was dropped.
+type Exchange struct {
+	Request  string
+	Steps    []Step
+	Response string
+}
+
+type entry4 struct {
+	name    string
+	handler handler.Handler4
+}
+
+type entry6 struct {
+	name    string
+	handler handler.Handler6
+}
+
+// Chain holds the plugin entries of a configuration.
+type Chain struct {
+	entries4 []entry4
+	entries6 []entry6
+}
+
+// Load sets up the plugin entries of the configuration, looking up the plugins
+// by name in registered. The entries of the plugins in skip are not set up and
+// pass messages on unchanged.
+func Load(cfg *config.Config, registered []*plugins.Plugin, skip sets.Set[string]) (*Chain, error) {
+	byName := make(map[string]*plugins.Plugin, len(registered))
+	for _, p := range registered {
+		byName[p.Name] = p
+	}
+	lookup := func(family string, name string) (*plugins.Plugin, error) {
+		p, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown plugin %s", family, name)
+		}
+		return p, nil
+	}
+
+	c := &Chain{}
+	if cfg.Server4 != nil {
+		for _, pc := range cfg.Server4.Plugins {
+			p, err := lookup("DHCPv4", pc.Name)
+			if err != nil {
+				return nil, err
+			}
+			if p.Setup4 == nil {
+				continue
+			}
+			e := entry4{name: pc.Name}
+			if !skip.Has(pc.Name) {
+				if e.handler, err = p.Setup4(pc.Args...); err != nil {
+					return nil, fmt.Errorf("DHCPv4: plugin %s: %w", pc.Name, err)
+				}
+			}
+			c.entries4 = append(c.entries4, e)
+		}
+	}
+	if cfg.Server6 != nil {
+		for _, pc := range cfg.Server6.Plugins {
+			p, err := lookup("DHCPv6", pc.Name)
+			if err != nil {
+				return nil, err
+			}
+			if p.Setup6 == nil {
+				continue
+			}
+			e := entry6{name: pc.Name}
+			if !skip.Has(pc.Name) {
+				if e.handler, err = p.Setup6(pc.Args...); err != nil {
+					return nil, fmt.Errorf("DHCPv6: plugin %s: %w", pc.Name, err)
+				}
+			}
+			c.entries6 = append(c.entries6, e)
+		}
+	}
+	return c, nil
+}
+
+// Has4 reports whether the configuration has a DHCPv4 server.
+func (c *Chain) Has4() bool { return len(c.entries4) > 0 }
+
+// Has6 reports whether the configuration has a DHCPv6 server.
+func (c *Chain) Has6() bool { return len(c.entries6) > 0 }
+
+// Handle4 runs a DHCPv4 request through the chain and returns the response, nil
+// if it was dropped.
+func (c *Chain) Handle4(req *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, Exchange, error) {
+	x := Exchange{Request: req.Summary()}
+	resp, err := dhcpv4.NewReplyFromRequest(req)
+	if err != nil {
+		return nil, x, fmt.Errorf("failed to build reply: %w", err)
+	}
+	switch mt := req.MessageType(); mt {
+	case dhcpv4.MessageTypeDiscover:
+		resp.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeOffer))
+	case dhcpv4.MessageTypeRequest:
+		resp.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeAck))
+	default:
+		return nil, x, fmt.Errorf("unhandled message type %v", mt)
+	}
+
+	for _, e := range c.entries4 {
+		if e.handler == nil {
+			x.Steps = append(x.Steps, Step{Plugin: e.name, Outcome: Skipped})
+			continue
+		}
+		before := summary4(resp)
+		var stop bool
+		resp, stop = e.handler(req, resp)
+		x.Steps = append(x.Steps, Step{Plugin: e.name, Outcome: outcome(resp == nil, stop), Changes: diff(before, summary4(resp))})
+		if stop {
+			break
+		}
+	}
+	if resp != nil {
+		x.Response = resp.Summary()
+	}
+	return resp, x, nil
+}
+
+// Handle6 runs a DHCPv6 message, which may be relayed, through the chain and
+// returns the reply to the client, nil if it was dropped. The summary of the
+// exchange holds the reply as sent, i.e. encapsulated for relayed messages.
+func (c *Chain) Handle6(d dhcpv6.DHCPv6) (*dhcpv6.Message, Exchange, error) {
+	x := Exchange{Request: d.Summary()}
+	msg, err := d.GetInnerMessage()
+	if err != nil {
+		return nil, x, fmt.Errorf("cannot get inner message: %w", err)
+	}
+
+	stub, err := response.Stub6(msg)
+	if err != nil {
+		return nil, x, fmt.Errorf("failed to build reply: %w", err)
+	}
+	var resp dhcpv6.DHCPv6 = stub
+
+	for _, e := range c.entries6 {
+		if e.handler == nil {
+			x.Steps = append(x.Steps, Step{Plugin: e.name, Outcome: Skipped})
+			continue
+		}
+		before := summary6(resp)
+		var stop bool
+		resp, stop = e.handler(d, resp)
+		x.Steps = append(x.Steps, Step{Plugin: e.name, Outcome: outcome(resp == nil, stop), Changes: diff(before, summary6(resp))})
+		if stop {
+			break
+		}
+	}
+	if resp == nil {
+		return nil, x, nil
+	}
+	reply, ok := resp.(*dhcpv6.Message)
+	if !ok {
+		return nil, x, fmt.Errorf("response is a %s, not a message", resp.Type())
+	}
+
+	x.Response = reply.Summary()
+	if d.IsRelay() {
+		relayRepl, err := dhcpv6.NewRelayReplFromRelayForw(d.(*dhcpv6.RelayMessage), reply)
+		if err != nil {
+			return nil, x, fmt.Errorf("cannot create relay-repl from relay-forw: %w", err)
+		}
+		x.Response = relayRepl.Summary()
+	}
+	return reply, x, nil
+}
+
+func outcome(dropped, stop bool) Outcome {
+	switch {
+	case dropped:
+		return Dropped
+	case stop:
+		return Stopped
+	default:
+		return Continued
+	}
+}
+
+func summary4(resp *dhcpv4.DHCPv4) []string {
+	if resp == nil {
+		return nil
+	}
+	return lines(resp.Summary())
+}
+
+func summary6(resp dhcpv6.DHCPv6) []string {
+	if resp == nil {
+		return nil
+	}
+	return lines(resp.Summary())
+}
+
+func lines(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// diff returns the lines removed from before and added in after.
+func diff(before, after []string) []string {
+	count := make(map[string]int, len(before))
+	for _, line := range before {
+		count[line]++
+	}
+	var added []string
+	for _, line := range after {
+		if count[line] > 0 {
+			count[line]--
+			continue
+		}
+		added = append(added, "+ "+line)
+	}
+	var changes []string
+	for _, line := range before {
+		if count[line] > 0 {
+			count[line]--
+			changes = append(changes, "- "+line)
+		}
+	}
+	return append(changes, added...)
+}
@@ -0,0 +1,139 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package simulate
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/coredhcp/coredhcp/config"
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+var mac = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+
+// address offers 192.168.2.100, respectively adds the server ID.
+var address = &plugins.Plugin{
+	Name: "address",
+	Setup4: func(args ...string) (handler.Handler4, error) {
+		return func(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+			resp.YourIPAddr = net.IPv4(192, 168, 2, 100)
+			resp.UpdateOption(dhcpv4.OptServerIdentifier(net.IPv4(192, 168, 2, 1)))
+			return resp, false
+		}, nil
+	},
+	Setup6: func(args ...string) (handler.Handler6, error) {
+		return func(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+			resp.AddOption(dhcpv6.OptServerID(&dhcpv6.DUIDLL{HWType: iana.HWTypeEthernet, LinkLayerAddr: mac}))
+			return resp, false
+		}, nil
+	},
+}
+
+// drop drops every message.
+var drop = &plugins.Plugin{
+	Name: "drop",
+	Setup4: func(args ...string) (handler.Handler4, error) {
+		return func(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) { return nil, true }, nil
+	},
+	Setup6: func(args ...string) (handler.Handler6, error) {
+		return func(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) { return nil, true }, nil
+	},
+}
+
+func load(t *testing.T, skip sets.Set[string], names ...string) *Chain {
+	var entries []config.PluginConfig
+	for _, name := range names {
+		entries = append(entries, config.PluginConfig{Name: name})
+	}
+	cfg := &config.Config{
+		Server4: &config.ServerConfig{Plugins: entries},
+		Server6: &config.ServerConfig{Plugins: entries},
+	}
+	c, err := Load(cfg, []*plugins.Plugin{address, drop}, skip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestUnknownPlugin(t *testing.T) {
+	cfg := &config.Config{Server4: &config.ServerConfig{Plugins: []config.PluginConfig{{Name: "unknown"}}}}
+	if _, err := Load(cfg, []*plugins.Plugin{address}, nil); err == nil {
+		t.Fatal("no error occurred for an unknown plugin, but it should have")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	changes := diff([]string{"a", "b", "b"}, []string{"b", "c"})
+	if strings.Join(changes, ",") != "- a,- b,+ c" {
+		t.Errorf("unexpected changes %v", changes)
+	}
+}
+
+/* IPv6 */
+func TestExchange6(t *testing.T) {
+	c := load(t, nil, "address")
+
+	exchanges, err := c.Exchange6(Client{MAC: mac, Relay: net.ParseIP("2001:db8::1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exchanges) != 2 {
+		t.Fatalf("expected SOLICIT and REQUEST, got %d exchanges", len(exchanges))
+	}
+	for _, x := range exchanges {
+		if !strings.Contains(x.Response, "RELAY-REPL") {
+			t.Errorf("expected the relayed reply to be encapsulated, got %s", x.Response)
+		}
+	}
+	if !strings.Contains(exchanges[1].Request, "Server ID") {
+		t.Errorf("expected the REQUEST to carry the advertised server ID, got %s", exchanges[1].Request)
+	}
+}
+
+/* IPv4 */
+func TestExchange4(t *testing.T) {
+	c := load(t, nil, "address")
+
+	exchanges, err := c.Exchange4(Client{MAC: mac, Relay: net.IPv4(192, 168, 2, 1), VendorClass: "PXEClient"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exchanges) != 2 {
+		t.Fatalf("expected DISCOVER and REQUEST, got %d exchanges", len(exchanges))
+	}
+	step := exchanges[0].Steps[0]
+	if step.Plugin != "address" || step.Outcome != Continued {
+		t.Errorf("unexpected step %+v", step)
+	}
+	if !strings.Contains(strings.Join(step.Changes, "\n"), "+ your IP: 192.168.2.100") {
+		t.Errorf("expected the offered address in the changes, got %v", step.Changes)
+	}
+	if !strings.Contains(exchanges[1].Response, "ACK") {
+		t.Errorf("expected an ACK, got %s", exchanges[1].Response)
+	}
+}
+
+func TestDrop4(t *testing.T) {
+	c := load(t, sets.New("address"), "address", "drop")
+
+	exchanges, err := c.Exchange4(Client{MAC: mac})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exchanges) != 1 || exchanges[0].Response != "" {
+		t.Fatalf("expected the DISCOVER to be dropped, got %+v", exchanges)
+	}
+	steps := exchanges[0].Steps
+	if len(steps) != 2 || steps[0].Outcome != Skipped || steps[1].Outcome != Dropped {
+		t.Errorf("expected a skipped and a dropping step, got %+v", steps)
+	}
+}
@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package socketmode
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/ironcore-dev/fedhcp/internal/subnetmatch"
+)
+
+// Broadcast holds the networks on which DHCPv4 replies to clients without an
+// address are always broadcast, for firmware dropping unicast offers.
+//
+// The plugins don't know the interface a request was received on, so a
+// directly attached client is taken to be on the interface whose network
+// contains the address offered to it.
+type Broadcast []netip.Prefix
+
+// BroadcastOn returns the networks of the IPv4 addresses of the interfaces.
+// The addresses are read once, so interfaces shall be configured beforehand.
+func BroadcastOn(interfaces []string) (Broadcast, error) {
+	var b Broadcast
+	for _, name := range interfaces {
+		ifi, err := net.InterfaceByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get interface %s: %w", name, err)
+		}
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get addresses of interface %s: %w", name, err)
+		}
+		n := len(b)
+		for _, addr := range addrs {
+			prefix, err := netip.ParsePrefix(addr.String())
+			if err != nil || !prefix.Addr().Is4() {
+				continue
+			}
+			b = append(b, prefix.Masked())
+		}
+		if len(b) == n {
+			return nil, fmt.Errorf("interface %s has no IPv4 address", name)
+		}
+	}
+	return b, nil
+}
+
+func (b Broadcast) contains(ip net.IP) bool {
+	for _, prefix := range b {
+		if subnetmatch.Contains(prefix, ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Wrap4 makes a DHCPv4 handler flag requests as broadcast once the address
+// offered is on one of the networks. The server decides on broadcasting after
+// the plugin chain ran, so the last handler setting the address wins.
+func (b Broadcast) Wrap4(h handler.Handler4) handler.Handler4 {
+	if len(b) == 0 {
+		return h
+	}
+	return func(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+		resp, stop := h(req, resp)
+		if resp != nil && req.GatewayIPAddr.IsUnspecified() && b.contains(resp.YourIPAddr) {
+			req.SetBroadcast()
+			resp.SetBroadcast()
+		}
+		return resp, stop
+	}
+}
+
+// Wrap returns a copy of the plugin, whose DHCPv4 handlers force broadcast
+// replies on the networks.
+func (b Broadcast) Wrap(p *plugins.Plugin) *plugins.Plugin {
+	if len(b) == 0 || p.Setup4 == nil {
+		return p
+	}
+	wrapped := *p
+	wrapped.Setup4 = func(args ...string) (handler.Handler4, error) {
+		h, err := p.Setup4(args...)
+		if err != nil {
+			return nil, err
+		}
+		return b.Wrap4(h), nil
+	}
+	return &wrapped
+}
@@ -0,0 +1,19 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+
+package socketmode
+
+import "syscall"
+
+// rawAvailable reports whether an AF_PACKET socket can be opened, which fails
+// without CAP_NET_RAW, e.g. in unprivileged containers.
+func rawAvailable() bool {
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, 0)
+	if err != nil {
+		return false
+	}
+	_ = syscall.Close(fd)
+	return true
+}
@@ -0,0 +1,12 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+//go:build !linux
+
+package socketmode
+
+// rawAvailable reports whether raw sockets can be used, the server only sends
+// layer 2 frames on Linux.
+func rawAvailable() bool {
+	return false
+}
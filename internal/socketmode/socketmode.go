@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package socketmode selects how DHCPv4 replies reach clients without an address.
+//
+// The server unicasts such replies as layer 2 frames through an AF_PACKET raw
+// socket, which only exists on Linux and requires CAP_NET_RAW. In UDP mode the
+// requests are flagged as broadcast before the plugin chain runs, so every reply
+// leaves through the regular UDP socket, either broadcast or to the relay.
+// Clients accept broadcast replies as described in RFC 2131, section 4.1.
+package socketmode
+
+import (
+	"fmt"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+// Mode is the way replies are sent.
+type Mode string
+
+const (
+	// Auto picks Raw if raw sockets are available, UDP otherwise.
+	Auto Mode = "auto"
+	Raw  Mode = "raw"
+	UDP  Mode = "udp"
+)
+
+// Parse returns the mode of a flag value.
+func Parse(value string) (Mode, error) {
+	switch Mode(value) {
+	case Auto, Raw, UDP:
+		return Mode(value), nil
+	default:
+		return "", fmt.Errorf("unknown socket mode %s, should be %s, %s or %s", value, Auto, Raw, UDP)
+	}
+}
+
+// Resolve returns the mode to serve with, probing for raw socket support in Auto mode.
+func (m Mode) Resolve() Mode {
+	if m != Auto {
+		return m
+	}
+	if rawAvailable() {
+		return Raw
+	}
+	return UDP
+}
+
+// Wrap4 makes a DHCPv4 handler flag requests as broadcast in UDP mode.
+func (m Mode) Wrap4(h handler.Handler4) handler.Handler4 {
+	if m != UDP {
+		return h
+	}
+	return func(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+		req.SetBroadcast()
+		return h(req, resp)
+	}
+}
+
+// Wrap returns a copy of the plugin, whose DHCPv4 handlers apply the mode.
+func (m Mode) Wrap(p *plugins.Plugin) *plugins.Plugin {
+	if m != UDP || p.Setup4 == nil {
+		return p
+	}
+	wrapped := *p
+	wrapped.Setup4 = func(args ...string) (handler.Handler4, error) {
+		h, err := p.Setup4(args...)
+		if err != nil {
+			return nil, err
+		}
+		return m.Wrap4(h), nil
+	}
+	return &wrapped
+}
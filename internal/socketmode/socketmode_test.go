@@ -0,0 +1,143 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package socketmode
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+func TestParse(t *testing.T) {
+	for _, value := range []string{"auto", "raw", "udp"} {
+		if _, err := Parse(value); err != nil {
+			t.Errorf("expected %s to be valid: %v", value, err)
+		}
+	}
+	if _, err := Parse("packet"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	if Raw.Resolve() != Raw || UDP.Resolve() != UDP {
+		t.Error("expected explicit modes to be kept")
+	}
+	if mode := Auto.Resolve(); mode != Raw && mode != UDP {
+		t.Errorf("expected auto to resolve to raw or udp, got %s", mode)
+	}
+}
+
+func testPlugin() *plugins.Plugin {
+	return &plugins.Plugin{
+		Name: "test",
+		Setup4: func(args ...string) (handler.Handler4, error) {
+			return func(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+				return resp, false
+			}, nil
+		},
+	}
+}
+
+func discover(t *testing.T) (*dhcpv4.DHCPv4, *dhcpv4.DHCPv4) {
+	req, err := dhcpv4.NewDiscovery(net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetUnicast()
+	resp, err := dhcpv4.NewReplyFromRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req, resp
+}
+
+func TestWrapUDP(t *testing.T) {
+	h, err := UDP.Wrap(testPlugin()).Setup4()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, resp := discover(t)
+	if _, stop := h(req, resp); stop {
+		t.Error("expected the chain to continue")
+	}
+	if !req.IsBroadcast() {
+		t.Error("expected the request to be flagged as broadcast")
+	}
+}
+
+func TestWrapRaw(t *testing.T) {
+	h, err := Raw.Wrap(testPlugin()).Setup4()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, resp := discover(t)
+	h(req, resp)
+	if req.IsBroadcast() {
+		t.Error("expected the request to be left unicast")
+	}
+}
+
+func TestBroadcastOn(t *testing.T) {
+	b, err := BroadcastOn([]string{"lo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.contains(net.IPv4(127, 0, 0, 2)) {
+		t.Errorf("expected the loopback network in %v", b)
+	}
+	if _, err := BroadcastOn([]string{"does-not-exist"}); err == nil {
+		t.Error("expected an error for an unknown interface")
+	}
+}
+
+func TestWrapBroadcast(t *testing.T) {
+	b := Broadcast{netip.MustParsePrefix("10.0.0.0/24")}
+	allocate := func(ip net.IP) *plugins.Plugin {
+		return &plugins.Plugin{
+			Name: "test",
+			Setup4: func(args ...string) (handler.Handler4, error) {
+				return func(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+					resp.YourIPAddr = ip
+					return resp, false
+				}, nil
+			},
+		}
+	}
+
+	h, err := b.Wrap(allocate(net.IPv4(10, 0, 0, 5))).Setup4()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, resp := discover(t)
+	resp, _ = h(req, resp)
+	if !req.IsBroadcast() || !resp.IsBroadcast() {
+		t.Error("expected the reply to be broadcast on the network")
+	}
+
+	h, err = b.Wrap(allocate(net.IPv4(10, 0, 1, 5))).Setup4()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, resp = discover(t)
+	h(req, resp)
+	if req.IsBroadcast() {
+		t.Error("expected the reply to be left unicast on another network")
+	}
+
+	// relay agents deliver replies according to their own configuration
+	h, _ = b.Wrap(allocate(net.IPv4(10, 0, 0, 5))).Setup4()
+	req, resp = discover(t)
+	req.GatewayIPAddr = net.IPv4(10, 0, 0, 1)
+	h(req, resp)
+	if req.IsBroadcast() {
+		t.Error("expected relayed requests to be left unicast")
+	}
+}
@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package standalone translates the single file of the standalone mode, the
+// interfaces served and a list of plugin entries, into the coredhcp
+// configuration, for deployments not needing the server4 and server6 sections
+// of coredhcp, e.g. at the edge.
+//
+// DHCPv4 is served on 0.0.0.0:67 and DHCPv6 on ff02::1:2 of each interface,
+// so directly attached clients and relays on the link are served. A family is
+// only served if an entry is run for it.
+package standalone
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/coredhcp/coredhcp/config"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+)
+
+// Load reads the standalone file at path and returns the coredhcp
+// configuration it translates into.
+func Load(path string) (*config.Config, error) {
+	c := &api.StandaloneConfig{}
+	if err := api.Load(path, c); err != nil {
+		return nil, err
+	}
+	return Translate(c)
+}
+
+// Translate returns the coredhcp configuration of the standalone config.
+func Translate(c *api.StandaloneConfig) (*config.Config, error) {
+	if len(c.Interfaces) == 0 {
+		return nil, fmt.Errorf("at least one interface must be configured")
+	}
+	if len(c.Plugins) == 0 {
+		return nil, fmt.Errorf("at least one plugin must be configured")
+	}
+
+	var plugins4, plugins6 []config.PluginConfig
+	for i, p := range c.Plugins {
+		if p.Name == "" {
+			return nil, fmt.Errorf("plugin %d: name must be configured", i)
+		}
+		entry := config.PluginConfig{Name: p.Name, Args: p.Args}
+		switch p.Family {
+		case 0:
+			plugins4 = append(plugins4, entry)
+			plugins6 = append(plugins6, entry)
+		case 4:
+			plugins4 = append(plugins4, entry)
+		case 6:
+			plugins6 = append(plugins6, entry)
+		default:
+			return nil, fmt.Errorf("plugin %s: invalid family %d, should be 4, 6 or 0 for both", p.Name, p.Family)
+		}
+	}
+
+	cfg := config.New()
+	if len(plugins4) > 0 {
+		cfg.Server4 = &config.ServerConfig{Plugins: plugins4}
+	}
+	if len(plugins6) > 0 {
+		cfg.Server6 = &config.ServerConfig{Plugins: plugins6}
+	}
+	for _, iface := range c.Interfaces {
+		if iface == "" {
+			return nil, fmt.Errorf("interface must not be empty")
+		}
+		if cfg.Server4 != nil {
+			cfg.Server4.Addresses = append(cfg.Server4.Addresses,
+				net.UDPAddr{IP: net.IPv4zero, Port: dhcpv4.ServerPort, Zone: iface})
+		}
+		if cfg.Server6 != nil {
+			cfg.Server6.Addresses = append(cfg.Server6.Addresses,
+				net.UDPAddr{IP: dhcpv6.AllDHCPRelayAgentsAndServers, Port: dhcpv6.DefaultServerPort, Zone: iface})
+		}
+	}
+	return cfg, nil
+}
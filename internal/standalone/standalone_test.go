@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package standalone
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/coredhcp/coredhcp/config"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/api/apitest"
+)
+
+func TestLoad(t *testing.T) {
+	cfg, err := Load(apitest.WriteConfig(t, api.StandaloneConfig{
+		Interfaces: []string{"eth1", "eth2"},
+		Plugins: []api.StandalonePlugin{
+			{Name: "serverduid", Args: []string{"serverduid_config.yaml"}, Family: 6},
+			{Name: "oob", Args: []string{"oob_config.yaml"}},
+			{Name: "router", Args: []string{"10.0.0.1"}, Family: 4},
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected4 := &config.ServerConfig{
+		Addresses: []net.UDPAddr{{IP: net.IPv4zero, Port: 67, Zone: "eth1"}, {IP: net.IPv4zero, Port: 67, Zone: "eth2"}},
+		Plugins: []config.PluginConfig{
+			{Name: "oob", Args: []string{"oob_config.yaml"}},
+			{Name: "router", Args: []string{"10.0.0.1"}},
+		},
+	}
+	if !reflect.DeepEqual(cfg.Server4, expected4) {
+		t.Errorf("expected DHCPv4 config %+v, got %+v", expected4, cfg.Server4)
+	}
+
+	expected6 := &config.ServerConfig{
+		Addresses: []net.UDPAddr{
+			{IP: dhcpv6.AllDHCPRelayAgentsAndServers, Port: 547, Zone: "eth1"},
+			{IP: dhcpv6.AllDHCPRelayAgentsAndServers, Port: 547, Zone: "eth2"},
+		},
+		Plugins: []config.PluginConfig{
+			{Name: "serverduid", Args: []string{"serverduid_config.yaml"}},
+			{Name: "oob", Args: []string{"oob_config.yaml"}},
+		},
+	}
+	if !reflect.DeepEqual(cfg.Server6, expected6) {
+		t.Errorf("expected DHCPv6 config %+v, got %+v", expected6, cfg.Server6)
+	}
+}
+
+func TestSingleFamily(t *testing.T) {
+	cfg, err := Translate(&api.StandaloneConfig{
+		Interfaces: []string{"eth1"},
+		Plugins:    []api.StandalonePlugin{{Name: "bootp", Args: []string{"bootp_config.yaml"}, Family: 4}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server4 == nil || cfg.Server6 != nil {
+		t.Errorf("expected DHCPv4 to be served only, got %+v and %+v", cfg.Server4, cfg.Server6)
+	}
+}
+
+func TestWrongConfig(t *testing.T) {
+	for _, c := range []api.StandaloneConfig{
+		{Plugins: []api.StandalonePlugin{{Name: "oob"}}},
+		{Interfaces: []string{"eth1"}},
+		{Interfaces: []string{""}, Plugins: []api.StandalonePlugin{{Name: "oob"}}},
+		{Interfaces: []string{"eth1"}, Plugins: []api.StandalonePlugin{{Args: []string{"oob_config.yaml"}}}},
+		{Interfaces: []string{"eth1"}, Plugins: []api.StandalonePlugin{{Name: "oob", Family: 5}}},
+	} {
+		if _, err := Translate(&c); err == nil {
+			t.Errorf("no error occurred for invalid config %+v, but it should have", c)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package subnetmatch decides which subnet an address belongs to, the same way
+// for all plugins. IPv4-mapped IPv6 addresses and subnets are treated as IPv4,
+// all addresses of a subnet match including the network and broadcast
+// addresses, so /31 and /127 point-to-point networks hold both of their
+// addresses.
+package subnetmatch
+
+import (
+	"net"
+	"net/netip"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
+)
+
+// Addr converts the address, unmapping IPv4-mapped IPv6 addresses.
+func Addr(ip net.IP) (netip.Addr, bool) {
+	addr, ok := netip.AddrFromSlice(ip)
+	return addr.Unmap(), ok
+}
+
+// Prefix returns the subnet in its canonical form: masked and, for an
+// IPv4-mapped IPv6 subnet, as IPv4 subnet.
+func Prefix(prefix netip.Prefix) netip.Prefix {
+	if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+	return prefix.Masked()
+}
+
+// ParsePrefix parses a subnet in CIDR notation into its canonical form.
+func ParsePrefix(cidr string) (netip.Prefix, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return Prefix(prefix), nil
+}
+
+// Contains reports whether the subnet contains the address.
+func Contains(prefix netip.Prefix, ip net.IP) bool {
+	addr, ok := Addr(ip)
+	return ok && Prefix(prefix).Contains(addr)
+}
+
+// Subnet reports whether the reserved CIDR of an IPAM subnet contains the
+// address. A subnet not reserved yet contains no address.
+func Subnet(subnet *ipamv1alpha1.Subnet, ip net.IP) bool {
+	if subnet.Status.Reserved == nil {
+		return false
+	}
+	return Contains(subnet.Status.Reserved.Net, ip)
+}
+
+// Leased6 returns the first leased address or delegated prefix of a reply.
+func Leased6(reply *dhcpv6.Message) net.IP {
+	for _, iana := range reply.Options.IANA() {
+		if addrs := iana.Options.Addresses(); len(addrs) > 0 {
+			return addrs[0].IPv6Addr
+		}
+	}
+	for _, iapd := range reply.Options.IAPD() {
+		if prefixes := iapd.Options.Prefixes(); len(prefixes) > 0 && prefixes[0].Prefix != nil {
+			return prefixes[0].Prefix.IP
+		}
+	}
+	return nil
+}
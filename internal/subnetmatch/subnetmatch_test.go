@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package subnetmatch
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
+)
+
+func TestParsePrefix(t *testing.T) {
+	for cidr, expected := range map[string]string{
+		"192.168.0.1/24":         "192.168.0.0/24",
+		"::ffff:192.168.0.0/120": "192.168.0.0/24",
+		"::ffff:0:0/96":          "0.0.0.0/0",
+		"::/64":                  "::/64",
+		"2001:db8::1/127":        "2001:db8::/127",
+	} {
+		prefix, err := ParsePrefix(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prefix.String() != expected {
+			t.Errorf("expected subnet %s for %s, got %s", expected, cidr, prefix)
+		}
+	}
+
+	for _, cidr := range []string{"", "192.168.0.0", "192.168.0.0/33", "2001:db8::/129"} {
+		if _, err := ParsePrefix(cidr); err == nil {
+			t.Errorf("no error occurred for %q, but it should have", cidr)
+		}
+	}
+}
+
+func TestContains(t *testing.T) {
+	for _, tc := range []struct {
+		cidr     string
+		ip       net.IP
+		expected bool
+	}{
+		{"192.168.0.0/24", net.ParseIP("192.168.0.1"), true},
+		{"192.168.0.0/24", net.IPv4(192, 168, 0, 255).To4(), true},
+		{"192.168.0.0/24", net.ParseIP("192.168.1.1"), false},
+		{"192.168.0.0/24", net.ParseIP("::ffff:192.168.0.1"), true},
+		{"::ffff:192.168.0.0/120", net.ParseIP("192.168.0.1"), true},
+		{"192.168.0.0/31", net.ParseIP("192.168.0.0"), true},
+		{"192.168.0.0/31", net.ParseIP("192.168.0.1"), true},
+		{"192.168.0.0/31", net.ParseIP("192.168.0.2"), false},
+		{"2001:db8::/127", net.ParseIP("2001:db8::"), true},
+		{"2001:db8::/127", net.ParseIP("2001:db8::1"), true},
+		{"2001:db8::/127", net.ParseIP("2001:db8::2"), false},
+		{"2001:db8::/64", net.ParseIP("192.168.0.1"), false},
+		{"0.0.0.0/0", net.ParseIP("2001:db8::1"), false},
+		{"::/0", net.ParseIP("192.168.0.1"), false},
+		{"192.168.0.0/24", nil, false},
+		{"192.168.0.0/24", net.IP{192, 168, 0}, false},
+	} {
+		if got := Contains(netip.MustParsePrefix(tc.cidr), tc.ip); got != tc.expected {
+			t.Errorf("expected %s containing %v to be %t, got %t", tc.cidr, tc.ip, tc.expected, got)
+		}
+	}
+}
+
+func TestSubnet(t *testing.T) {
+	reserved, _ := ipamv1alpha1.CIDRFromString("2001:db8::/127")
+	for _, tc := range []struct {
+		subnet   *ipamv1alpha1.Subnet
+		ip       net.IP
+		expected bool
+	}{
+		{&ipamv1alpha1.Subnet{Status: ipamv1alpha1.SubnetStatus{Reserved: reserved}}, net.ParseIP("2001:db8::1"), true},
+		{&ipamv1alpha1.Subnet{Status: ipamv1alpha1.SubnetStatus{Reserved: reserved}}, net.ParseIP("2001:db8::2"), false},
+		{&ipamv1alpha1.Subnet{}, net.ParseIP("2001:db8::1"), false},
+		{&ipamv1alpha1.Subnet{Status: ipamv1alpha1.SubnetStatus{Reserved: reserved}}, net.IPv6unspecified, false},
+	} {
+		if got := Subnet(tc.subnet, tc.ip); got != tc.expected {
+			t.Errorf("expected subnet %v matching %v to be %t, got %t", tc.subnet.Status.Reserved, tc.ip, tc.expected, got)
+		}
+	}
+}
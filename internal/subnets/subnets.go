@@ -0,0 +1,117 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package subnets discovers the IPAM subnets a plugin leases from, selected by
+// name, by label or both. The subnets are cached for a short time, so that a
+// burst of requests does not list them from the API server for every client.
+package subnets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ironcore-dev/fedhcp/internal/cache"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/ironcore-dev/fedhcp/internal/subnetmatch"
+	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultTTL is how long a listing of subnets is reused.
+const DefaultTTL = 10 * time.Second
+
+// Selector selects the subnets of a namespace.
+type Selector struct {
+	namespace string
+	names     []string
+	labels    labels.Selector
+	subnets   *cache.Cache[struct{}, []ipamv1alpha1.Subnet]
+}
+
+// New returns a selector of the subnets in the namespace having one of the
+// names and matching the label selector, e.g. "oob=true". At least one of the
+// two must be given. The name labels the cache metrics.
+func New(name, namespace string, names []string, labelSelector string) (*Selector, error) {
+	if len(names) == 0 && labelSelector == "" {
+		return nil, errors.New("subnet names or a subnet label selector must be configured")
+	}
+	selector, err := labels.Parse(labelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subnet label selector %q: %w", labelSelector, err)
+	}
+	return &Selector{
+		namespace: namespace,
+		names:     names,
+		labels:    selector,
+		subnets:   cache.New[struct{}, []ipamv1alpha1.Subnet](name+"/subnets", 1, DefaultTTL),
+	}, nil
+}
+
+// Namespace returns the namespace of the subnets.
+func (s *Selector) Namespace() string {
+	return s.namespace
+}
+
+// List returns the selected subnets, in the order of the configured names or,
+// without names, ordered by name. The subnets are shared and must not be
+// modified.
+func (s *Selector) List(ctx context.Context) ([]ipamv1alpha1.Subnet, error) {
+	if subnets, ok := s.subnets.Get(struct{}{}); ok {
+		return subnets, nil
+	}
+
+	subnetList := &ipamv1alpha1.SubnetList{}
+	if err := kubernetes.GetClient().List(ctx, subnetList,
+		client.InNamespace(s.namespace), client.MatchingLabelsSelector{Selector: s.labels}); err != nil {
+		return nil, fmt.Errorf("error listing subnets: %w", fedhcperrors.FromK8s(err))
+	}
+
+	subnets := subnetList.Items
+	if len(s.names) > 0 {
+		subnets = nil
+		for _, name := range s.names {
+			i := slices.IndexFunc(subnetList.Items, func(subnet ipamv1alpha1.Subnet) bool { return subnet.Name == name })
+			if i < 0 {
+				continue
+			}
+			subnets = append(subnets, subnetList.Items[i])
+		}
+	} else {
+		slices.SortFunc(subnets, func(a, b ipamv1alpha1.Subnet) int { return strings.Compare(a.Name, b.Name) })
+	}
+
+	s.subnets.Put(struct{}{}, subnets)
+	return subnets, nil
+}
+
+// Match returns the first selected subnet of the address type containing the
+// address, or nil if there is none.
+func (s *Selector) Match(ctx context.Context, ip net.IP, subnetType ipamv1alpha1.SubnetAddressType) (*ipamv1alpha1.Subnet, error) {
+	return s.find(ctx, subnetType, func(subnet *ipamv1alpha1.Subnet) bool { return subnetmatch.Subnet(subnet, ip) })
+}
+
+// First returns the first selected subnet of the address type, or nil if there
+// is none.
+func (s *Selector) First(ctx context.Context, subnetType ipamv1alpha1.SubnetAddressType) (*ipamv1alpha1.Subnet, error) {
+	return s.find(ctx, subnetType, func(*ipamv1alpha1.Subnet) bool { return true })
+}
+
+func (s *Selector) find(ctx context.Context, subnetType ipamv1alpha1.SubnetAddressType, match func(*ipamv1alpha1.Subnet) bool) (*ipamv1alpha1.Subnet, error) {
+	subnets, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range subnets {
+		if subnets[i].Status.Type == subnetType && match(&subnets[i]) {
+			return &subnets[i], nil
+		}
+	}
+	return nil, nil
+}
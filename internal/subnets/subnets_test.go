@@ -0,0 +1,140 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package subnets
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes/fake"
+	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const namespace = "ipam"
+
+func Init(t *testing.T) {
+	var cl client.Client = fake.NewClient(fake.NewIPAM(namespace).
+		WithSubnet("subnet-b", "2001:db8:b::/64", map[string]string{"subnet": "inband"}).
+		WithSubnet("subnet-a", "2001:db8:a::/64", map[string]string{"subnet": "inband"}).
+		WithSubnet("subnet-c", "2001:db8:c::/64", nil).
+		WithSubnet("subnet-d", "192.168.0.0/24", map[string]string{"subnet": "inband"}))
+	kubernetes.SetClient(&cl)
+	t.Cleanup(func() { kubernetes.SetClient(new(client.Client)) })
+}
+
+func names(subnets []ipamv1alpha1.Subnet) []string {
+	var names []string
+	for _, subnet := range subnets {
+		names = append(names, subnet.Name)
+	}
+	return names
+}
+
+func TestNew(t *testing.T) {
+	for _, tc := range []struct {
+		names         []string
+		labelSelector string
+	}{
+		{},
+		{labelSelector: "subnet in ("},
+	} {
+		if _, err := New("subnets/test", namespace, tc.names, tc.labelSelector); err == nil {
+			t.Errorf("no error occurred for names %v and label selector %q, but it should have", tc.names, tc.labelSelector)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	Init(t)
+
+	for _, tc := range []struct {
+		names         []string
+		labelSelector string
+		expected      []string
+	}{
+		{names: []string{"subnet-c", "subnet-x", "subnet-a"}, expected: []string{"subnet-c", "subnet-a"}},
+		{labelSelector: "subnet=inband", expected: []string{"subnet-a", "subnet-b", "subnet-d"}},
+		{names: []string{"subnet-c", "subnet-b"}, labelSelector: "subnet=inband", expected: []string{"subnet-b"}},
+	} {
+		s, err := New("subnets/test", namespace, tc.names, tc.labelSelector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		subnets, err := s.List(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := names(subnets); !slices.Equal(got, tc.expected) {
+			t.Errorf("expected subnets %v for names %v and label selector %q, got %v", tc.expected, tc.names, tc.labelSelector, got)
+		}
+	}
+}
+
+func TestListCached(t *testing.T) {
+	Init(t)
+
+	s, _ := New("subnets/test", namespace, nil, "subnet=inband")
+	if _, err := s.List(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	kubernetes.SetClient(new(client.Client))
+	subnets, err := s.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subnets) != 3 {
+		t.Errorf("expected the 3 cached subnets, got %v", names(subnets))
+	}
+}
+
+func TestMatch(t *testing.T) {
+	Init(t)
+
+	s, _ := New("subnets/test", namespace, nil, "subnet=inband")
+	for ip, expected := range map[string]string{
+		"2001:db8:b::1": "subnet-b",
+		"2001:db8:c::1": "",
+		"192.168.0.1":   "subnet-d",
+		"10.0.0.1":      "",
+	} {
+		subnetType := ipamv1alpha1.CIPv6SubnetType
+		if net.ParseIP(ip).To4() != nil {
+			subnetType = ipamv1alpha1.CIPv4SubnetType
+		}
+		subnet, err := s.Match(context.Background(), net.ParseIP(ip), subnetType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if subnet != nil {
+			got = subnet.Name
+		}
+		if got != expected {
+			t.Errorf("expected subnet %q for %s, got %q", expected, ip, got)
+		}
+	}
+}
+
+func TestFirst(t *testing.T) {
+	Init(t)
+
+	s, _ := New("subnets/test", namespace, []string{"subnet-c", "subnet-d", "subnet-a"}, "")
+	for subnetType, expected := range map[ipamv1alpha1.SubnetAddressType]string{
+		ipamv1alpha1.CIPv6SubnetType: "subnet-c",
+		ipamv1alpha1.CIPv4SubnetType: "subnet-d",
+	} {
+		subnet, err := s.First(context.Background(), subnetType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if subnet == nil || subnet.Name != expected {
+			t.Errorf("expected subnet %s for %s, got %v", expected, subnetType, subnet)
+		}
+	}
+}
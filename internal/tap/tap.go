@@ -0,0 +1,297 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package tap follows single clients through the plugin chain. While a MAC
+// address is followed, every plugin entry logs the request and response
+// summaries of the client's messages, whether it continued, stopped or dropped
+// them, and which options it added, modified or removed. The lines are logged
+// at info level, so one misbehaving client can be debugged without enabling
+// debug logging for all of them. Following ends after a limited duration.
+package tap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+// DefaultDuration is how long a client is followed if no duration is given.
+const DefaultDuration = 15 * time.Minute
+
+var log = logger.GetLogger("tap")
+
+var (
+	mu sync.RWMutex
+	// followed maps MAC addresses to the end of their following
+	followed = make(map[string]time.Time)
+	now      = time.Now
+)
+
+// Follow starts following the client for the given duration, a client
+// followed already is followed until the new end.
+func Follow(mac net.HardwareAddr, d time.Duration) time.Time {
+	until := now().Add(d)
+	mu.Lock()
+	defer mu.Unlock()
+	followed[mac.String()] = until
+	return until
+}
+
+// Unfollow stops following the client.
+func Unfollow(mac net.HardwareAddr) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(followed, mac.String())
+}
+
+// Followed returns the followed clients and the ends of their following.
+func Followed() map[string]time.Time {
+	mu.Lock()
+	defer mu.Unlock()
+	t := now()
+	clients := make(map[string]time.Time, len(followed))
+	for mac, until := range followed {
+		if !t.Before(until) {
+			delete(followed, mac)
+			continue
+		}
+		clients[mac] = until
+	}
+	return clients
+}
+
+// isFollowed reports whether the client with the MAC address is followed.
+func isFollowed(mac net.HardwareAddr) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	if len(followed) == 0 || mac == nil {
+		return false
+	}
+	until, ok := followed[mac.String()]
+	return ok && now().Before(until)
+}
+
+// decision describes what a plugin entry did with a message.
+func decision(handled, stop bool) string {
+	switch {
+	case !handled:
+		return "dropped"
+	case stop:
+		return "stopped"
+	default:
+		return "continued"
+	}
+}
+
+// option is the snapshot of an option, options of the same DHCPv6 code are
+// combined.
+type option struct {
+	data []byte
+	desc string
+}
+
+// diff describes the options added, modified and removed between two snapshots.
+func diff[K comparable](before, after map[K]option) string {
+	var added, modified, removed []string
+	for code, opt := range after {
+		old, ok := before[code]
+		switch {
+		case !ok:
+			added = append(added, opt.desc)
+		case !bytes.Equal(old.data, opt.data):
+			modified = append(modified, opt.desc)
+		}
+	}
+	for code, opt := range before {
+		if _, ok := after[code]; !ok {
+			removed = append(removed, opt.desc)
+		}
+	}
+	var parts []string
+	for _, part := range []struct {
+		what  string
+		descs []string
+	}{{"added", added}, {"modified", modified}, {"removed", removed}} {
+		if len(part.descs) > 0 {
+			slices.Sort(part.descs)
+			parts = append(parts, fmt.Sprintf("%s %s", part.what, strings.Join(part.descs, ", ")))
+		}
+	}
+	if len(parts) == 0 {
+		return "no options changed"
+	}
+	return strings.Join(parts, "; ")
+}
+
+func options4(msg *dhcpv4.DHCPv4) map[uint8]option {
+	if msg == nil {
+		return nil
+	}
+	snapshot := make(map[uint8]option, len(msg.Options))
+	for code, value := range msg.Options {
+		snapshot[code] = option{
+			data: slices.Clone(value),
+			desc: strings.TrimSpace(dhcpv4.Options{code: value}.String()),
+		}
+	}
+	return snapshot
+}
+
+func options6(msg dhcpv6.DHCPv6) map[dhcpv6.OptionCode]option {
+	reply, ok := msg.(*dhcpv6.Message)
+	if !ok {
+		return nil
+	}
+	snapshot := make(map[dhcpv6.OptionCode]option)
+	for _, opt := range reply.Options.Options {
+		combined := snapshot[opt.Code()]
+		combined.data = append(combined.data, opt.ToBytes()...)
+		if combined.desc != "" {
+			combined.desc += ", "
+		}
+		combined.desc += opt.String()
+		snapshot[opt.Code()] = combined
+	}
+	return snapshot
+}
+
+func summary(msg interface{ Summary() string }, ok bool) string {
+	if !ok {
+		return "none"
+	}
+	return msg.Summary()
+}
+
+// Wrap4 logs what a DHCPv4 handler does with the messages of followed clients.
+func Wrap4(entry string, h handler.Handler4) handler.Handler4 {
+	return func(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+		if !isFollowed(req.ClientHWAddr) {
+			return h(req, resp)
+		}
+		before := options4(resp)
+		resp, stop := h(req, resp)
+		log.WithField("mac", req.ClientHWAddr.String()).Infof("%s: %s %s, %s\nrequest: %s\nresponse: %s",
+			entry, req.MessageType(), decision(resp != nil, stop),
+			diff(before, options4(resp)),
+			req.Summary(), summary(resp, resp != nil))
+		return resp, stop
+	}
+}
+
+// Wrap6 logs what a DHCPv6 handler does with the messages of followed clients.
+func Wrap6(entry string, h handler.Handler6) handler.Handler6 {
+	return func(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+		mac, err := dhcpv6.ExtractMAC(req)
+		if err != nil || !isFollowed(mac) {
+			return h(req, resp)
+		}
+		msgType := "message"
+		if msg, err := req.GetInnerMessage(); err == nil {
+			msgType = msg.MessageType.String()
+		}
+		before := options6(resp)
+		resp, stop := h(req, resp)
+		log.WithField("mac", mac.String()).Infof("%s: %s %s, %s\nrequest: %s\nresponse: %s",
+			entry, msgType, decision(resp != nil, stop),
+			diff(before, options6(resp)),
+			req.Summary(), summary(resp, resp != nil))
+		return resp, stop
+	}
+}
+
+// entryName names a plugin entry by the plugin and its arguments.
+func entryName(name string, args []string) string {
+	if len(args) == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s(%s)", name, strings.Join(args, " "))
+}
+
+// Wrap returns a copy of the plugin, whose entries log what they do with the
+// messages of followed clients.
+func Wrap(p *plugins.Plugin) *plugins.Plugin {
+	wrapped := &plugins.Plugin{Name: p.Name}
+	if p.Setup4 != nil {
+		wrapped.Setup4 = func(args ...string) (handler.Handler4, error) {
+			h, err := p.Setup4(args...)
+			if err != nil {
+				return nil, err
+			}
+			return Wrap4(entryName(p.Name+"/v4", args), h), nil
+		}
+	}
+	if p.Setup6 != nil {
+		wrapped.Setup6 = func(args ...string) (handler.Handler6, error) {
+			h, err := p.Setup6(args...)
+			if err != nil {
+				return nil, err
+			}
+			return Wrap6(entryName(p.Name+"/v6", args), h), nil
+		}
+	}
+	return wrapped
+}
+
+// request is the body of a PUT on the tap endpoint.
+type request struct {
+	MAC      string `json:"mac"`
+	Duration string `json:"duration"`
+}
+
+// Handler serves the followed clients on GET, starts following a client on
+// PUT, e.g. {"mac": "00:1a:2b:3c:4d:5e", "duration": "10m"}, and stops
+// following the client of the mac query parameter on DELETE.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var req request
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			mac, err := net.ParseMAC(req.MAC)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			d := DefaultDuration
+			if req.Duration != "" {
+				if d, err = time.ParseDuration(req.Duration); err != nil || d <= 0 {
+					http.Error(w, fmt.Sprintf("invalid duration %q", req.Duration), http.StatusBadRequest)
+					return
+				}
+			}
+			until := Follow(mac, d)
+			log.WithField("mac", mac.String()).Infof("Following client until %s", until.Format(time.RFC3339))
+		case http.MethodDelete:
+			mac, err := net.ParseMAC(r.URL.Query().Get("mac"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			Unfollow(mac)
+			log.WithField("mac", mac.String()).Info("Stopped following client")
+		default:
+			w.Header().Set("Allow", "GET, PUT, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(Followed())
+	})
+}
@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package tap
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+var (
+	mac   = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+	other = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5f}
+)
+
+// capture returns the buffer the log is written to until the test ends.
+func capture(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	out := log.Logger.Out
+	log.Logger.SetOutput(&buf)
+	t.Cleanup(func() {
+		log.Logger.SetOutput(out)
+		Unfollow(mac)
+		Unfollow(other)
+	})
+	return &buf
+}
+
+func TestFollow(t *testing.T) {
+	capture(t)
+	start := time.Now()
+	now = func() time.Time { return start }
+	defer func() { now = time.Now }()
+
+	Follow(mac, time.Minute)
+	Follow(other, time.Hour)
+	if !isFollowed(mac) || !isFollowed(other) {
+		t.Fatal("expected both clients to be followed")
+	}
+
+	now = func() time.Time { return start.Add(2 * time.Minute) }
+	if isFollowed(mac) {
+		t.Error("expected the following to end after its duration")
+	}
+	if clients := Followed(); len(clients) != 1 || !clients[other.String()].Equal(start.Add(time.Hour)) {
+		t.Errorf("expected only %s to be followed, got %v", other, clients)
+	}
+
+	Unfollow(other)
+	if isFollowed(other) {
+		t.Error("expected the following to end when unfollowed")
+	}
+}
+
+/* IPv4 */
+func TestWrap4(t *testing.T) {
+	buf := capture(t)
+	h := Wrap4("test/v4", func(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+		resp.UpdateOption(dhcpv4.OptRouter(net.IPv4(192, 168, 0, 1)))
+		resp.Options.Del(dhcpv4.OptionDomainNameServer)
+		return resp, true
+	})
+	Follow(mac, time.Minute)
+
+	req, _ := dhcpv4.NewDiscovery(other)
+	resp, _ := dhcpv4.NewReplyFromRequest(req)
+	h(req, resp)
+	if buf.Len() != 0 {
+		t.Fatalf("expected nothing logged for a client not followed, got %s", buf.String())
+	}
+
+	req, _ = dhcpv4.NewDiscovery(mac)
+	resp, _ = dhcpv4.NewReplyFromRequest(req, dhcpv4.WithOption(dhcpv4.OptDNS(net.IPv4(192, 168, 0, 53))))
+	h(req, resp)
+	for _, expected := range []string{"test/v4: DISCOVER stopped", "added Router", "removed Domain Name Server"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected %q in the log, got %s", expected, buf.String())
+		}
+	}
+}
+
+/* IPv6 */
+func TestWrap6(t *testing.T) {
+	buf := capture(t)
+	h := Wrap6("test/v6", func(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+		return nil, true
+	})
+	Follow(mac, time.Minute)
+
+	solicit, _ := dhcpv6.NewSolicit(mac)
+	resp, _ := dhcpv6.NewAdvertiseFromSolicit(solicit)
+	req, _ := dhcpv6.EncapsulateRelay(solicit, dhcpv6.MessageTypeRelayForward, net.ParseIP("2001:db8::1"), net.ParseIP("fe80::1"))
+	h(req, resp)
+	for _, expected := range []string{"test/v6: SOLICIT dropped", "response: none"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected %q in the log, got %s", expected, buf.String())
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	capture(t)
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		Handler().ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := serve(http.MethodPut, "/tap", `{"mac": "00:1a:2b:3c:4d:5e", "duration": "10m"}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !isFollowed(mac) {
+		t.Error("expected the client to be followed")
+	}
+	if rec := serve(http.MethodGet, "/tap", ""); !strings.Contains(rec.Body.String(), mac.String()) {
+		t.Errorf("expected the client to be listed, got %s", rec.Body.String())
+	}
+	for _, body := range []string{`{"mac": "foo"}`, `{"mac": "00:1a:2b:3c:4d:5e", "duration": "-1m"}`} {
+		if rec := serve(http.MethodPut, "/tap", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400 for %s, got %d", body, rec.Code)
+		}
+	}
+
+	if rec := serve(http.MethodDelete, "/tap?mac=00:1a:2b:3c:4d:5e", ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if isFollowed(mac) {
+		t.Error("expected the client not to be followed anymore")
+	}
+}
@@ -0,0 +1,141 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package tempaddr answers requests for temporary addresses (IA_TA). The
+// addresses are built from the /64 prefix of the client's link and a random
+// interface identifier, as described in RFC 8981.
+package tempaddr
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+)
+
+const (
+	DefaultPreferredLifetime = 1 * time.Hour
+	DefaultValidLifetime     = 2 * time.Hour
+
+	prefixLength = 64
+)
+
+// Lifetimes returns the configured lifetimes of temporary addresses, falling
+// back to the defaults for unset values.
+func Lifetimes(config api.TemporaryAddresses) (time.Duration, time.Duration, error) {
+	preferred, valid := config.PreferredLifetime, config.ValidLifetime
+	if preferred == 0 {
+		preferred = DefaultPreferredLifetime
+	}
+	if valid == 0 {
+		valid = DefaultValidLifetime
+	}
+	if preferred > valid {
+		return 0, 0, fmt.Errorf("preferred lifetime %s of temporary addresses exceeds valid lifetime %s",
+			preferred, valid)
+	}
+	return preferred, valid, nil
+}
+
+// Address returns the temporary address for an IA_TA on the link ip belongs to.
+// An address the client asks for is kept as long as it is on that link and
+// handedOut confirms it was handed out to the client before, so the address
+// advertised in a Solicit is confirmed in the following Request. A nil
+// handedOut keeps any address on the link. Other addresses are replaced by a
+// new one.
+func Address(iata *dhcpv6.OptIATA, ip net.IP, handedOut func(net.IP) bool) (net.IP, error) {
+	mask := net.CIDRMask(prefixLength, 128)
+	prefix := ip.Mask(mask)
+	if prefix == nil {
+		return nil, fmt.Errorf("invalid IPv6 address %s", ip)
+	}
+
+	for _, opt := range iata.Options.Get(dhcpv6.OptionIAAddr) {
+		if requested, ok := opt.(*dhcpv6.OptIAAddress); ok && requested.IPv6Addr.Mask(mask).Equal(prefix) &&
+			(handedOut == nil || handedOut(requested.IPv6Addr)) {
+			return requested.IPv6Addr, nil
+		}
+	}
+
+	addr := make(net.IP, net.IPv6len)
+	copy(addr, prefix)
+	if _, err := rand.Read(addr[prefixLength/8:]); err != nil {
+		return nil, fmt.Errorf("failed to generate interface identifier: %w", err)
+	}
+	return addr, nil
+}
+
+// Option returns the IA_TA option leasing addr.
+func Option(iata *dhcpv6.OptIATA, addr net.IP, preferred, valid time.Duration) *dhcpv6.OptIATA {
+	return &dhcpv6.OptIATA{
+		IaId: iata.IaId,
+		Options: dhcpv6.IdentityOptions{Options: []dhcpv6.Option{
+			&dhcpv6.OptIAAddress{
+				IPv6Addr:          addr,
+				PreferredLifetime: preferred,
+				ValidLifetime:     valid,
+			},
+		}},
+	}
+}
+
+// Leases remembers the temporary addresses handed out to the clients until
+// their valid lifetime ends, for plugins not reserving them elsewhere.
+type Leases struct {
+	mu sync.Mutex
+	// expires holds the end of the valid lifetime per client and address
+	expires map[string]map[string]time.Time
+	// swept is the time the expired addresses of all clients were last removed
+	swept time.Time
+}
+
+// NewLeases returns an empty set of temporary addresses.
+func NewLeases() *Leases {
+	return &Leases{expires: make(map[string]map[string]time.Time)}
+}
+
+// Add records addr as handed out to the client until expires. The expired
+// addresses of all clients are removed once their valid lifetime passed.
+func (l *Leases) Add(client string, addr net.IP, expires, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.swept) > DefaultValidLifetime {
+		for c, addrs := range l.expires {
+			for a, e := range addrs {
+				if !now.Before(e) {
+					delete(addrs, a)
+				}
+			}
+			if len(addrs) == 0 {
+				delete(l.expires, c)
+			}
+		}
+		l.swept = now
+	}
+	if l.expires[client] == nil {
+		l.expires[client] = make(map[string]time.Time)
+	}
+	l.expires[client][addr.String()] = expires
+}
+
+// Has returns whether addr was handed out to the client and is still valid.
+func (l *Leases) Has(client string, addr net.IP, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	expires, ok := l.expires[client][addr.String()]
+	return ok && now.Before(expires)
+}
+
+// Remove forgets addr of the client, after it was released or declined.
+func (l *Leases) Remove(client string, addr net.IP) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.expires[client], addr.String())
+	if len(l.expires[client]) == 0 {
+		delete(l.expires, client)
+	}
+}
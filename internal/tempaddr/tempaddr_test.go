@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package tempaddr
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+var (
+	linkAddr = net.ParseIP("2001:db8:1::1")
+	onLink   = net.ParseIP("2001:db8:1::dead")
+	offLink  = net.ParseIP("2001:db8:2::dead")
+)
+
+func TestAddress(t *testing.T) {
+	for _, tc := range []struct {
+		requested net.IP
+		handedOut func(net.IP) bool
+		kept      bool
+	}{
+		{onLink, nil, true},
+		{onLink, func(net.IP) bool { return true }, true},
+		{onLink, func(net.IP) bool { return false }, false},
+		{offLink, nil, false},
+	} {
+		iata := &dhcpv6.OptIATA{}
+		iata.Options.Add(&dhcpv6.OptIAAddress{IPv6Addr: tc.requested})
+		addr, err := Address(iata, linkAddr, tc.handedOut)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr.Equal(tc.requested) != tc.kept {
+			t.Errorf("expected %s kept %t, got %s", tc.requested, tc.kept, addr)
+		}
+		if !addr.Mask(net.CIDRMask(prefixLength, 128)).Equal(linkAddr.Mask(net.CIDRMask(prefixLength, 128))) {
+			t.Errorf("expected an address on the link of %s, got %s", linkAddr, addr)
+		}
+	}
+}
+
+func TestLeases(t *testing.T) {
+	now := time.Now()
+	l := NewLeases()
+	l.Add("client", onLink, now.Add(time.Hour), now)
+
+	if !l.Has("client", onLink, now) {
+		t.Errorf("expected %s to be handed out to the client", onLink)
+	}
+	if l.Has("other", onLink, now) {
+		t.Errorf("expected %s not to be handed out to another client", onLink)
+	}
+	if l.Has("client", onLink, now.Add(time.Hour)) {
+		t.Errorf("expected %s to expire", onLink)
+	}
+
+	l.Remove("client", onLink)
+	if l.Has("client", onLink, now) {
+		t.Errorf("expected %s to be released", onLink)
+	}
+
+	// expired addresses are swept on the next addition
+	l.Add("client", onLink, now.Add(time.Hour), now)
+	l.Add("other", offLink, now.Add(4*time.Hour), now.Add(3*time.Hour))
+	if _, ok := l.expires["client"]; ok {
+		t.Errorf("expected the expired addresses to be removed, got %v", l.expires)
+	}
+}
@@ -0,0 +1,154 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package testenv bootstraps the kubernetes API of Ginkgo plugin suites. With
+// the control plane binaries of envtest, i.e. KUBEBUILDER_ASSETS set by
+// "make test", the suites run against a real API server with the CRDs of the
+// configured modules installed, otherwise, e.g. with plain "go test", against
+// the fake client.
+package testenv
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/ironcore-dev/controller-utils/modutils"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes/fake"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/controller-runtime/pkg/envtest/komega"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+const (
+	// K8sVersion is the version of the envtest control plane binaries.
+	K8sVersion = "1.30.0"
+
+	PollingInterval      = 50 * time.Millisecond
+	EventuallyTimeout    = 3 * time.Second
+	ConsistentlyDuration = 1 * time.Second
+)
+
+// Modules whose CRDs are commonly installed.
+const (
+	IPAM          = "github.com/ironcore-dev/ipam"
+	MetalOperator = "github.com/ironcore-dev/metal-operator"
+)
+
+// Options configures the test environment of a suite.
+type Options struct {
+	// CRDModules are the modules whose config/crd/bases are installed into
+	// the envtest API server.
+	CRDModules []string
+	// AddToScheme registers types beyond those of kubernetes.GetScheme.
+	AddToScheme []func(*k8sruntime.Scheme) error
+	// Objects are created in the fake client, they are ignored with envtest.
+	Objects []fake.ObjectSource
+}
+
+// Run sets the default intervals and timeouts and runs the suite's specs.
+func Run(t GinkgoTestingT, description string) {
+	SetDefaultConsistentlyPollingInterval(PollingInterval)
+	SetDefaultEventuallyPollingInterval(PollingInterval)
+	SetDefaultEventuallyTimeout(EventuallyTimeout)
+	SetDefaultConsistentlyDuration(ConsistentlyDuration)
+	RegisterFailHandler(Fail)
+
+	RunSpecs(t, description)
+}
+
+// Start bootstraps the kubernetes API, to be called in BeforeSuite. It sets
+// the client of komega and of the plugins and returns it.
+func Start(opts Options) client.Client {
+	logf.SetLogger(zap.New(zap.WriteTo(GinkgoWriter), zap.UseDevMode(true)))
+
+	for _, addToScheme := range opts.AddToScheme {
+		Expect(addToScheme(kubernetes.GetScheme())).To(Succeed())
+	}
+
+	var cl client.Client
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		By("bootstrapping fake client")
+		cl = fake.NewClient(opts.Objects...)
+	} else {
+		By("bootstrapping test environment")
+		cl = startEnvTest(opts)
+	}
+
+	komega.SetClient(cl)
+	kubernetes.SetClient(&cl)
+	return cl
+}
+
+func startEnvTest(opts Options) client.Client {
+	var crdPaths []string
+	for _, module := range opts.CRDModules {
+		crdPaths = append(crdPaths, modutils.Dir(module, "config", "crd", "bases"))
+	}
+	testEnv := &envtest.Environment{
+		CRDDirectoryPaths:     crdPaths,
+		ErrorIfCRDPathMissing: true,
+		// the binaries "make test" installs, used when running the tests
+		// directly with KUBEBUILDER_ASSETS set
+		BinaryAssetsDirectory: filepath.Join(moduleRoot(), "bin", "k8s",
+			fmt.Sprintf("%s-%s-%s", K8sVersion, runtime.GOOS, runtime.GOARCH)),
+	}
+
+	cfg, err := testEnv.Start()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(cfg).NotTo(BeNil())
+	DeferCleanup(testEnv.Stop)
+
+	cl, err := client.New(cfg, client.Options{Scheme: kubernetes.GetScheme()})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(cl).NotTo(BeNil())
+	return cl
+}
+
+// moduleRoot returns the root directory of this module.
+func moduleRoot() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..")
+}
+
+// SetupNamespace creates a namespace for each spec of the container it is
+// called in and deletes it afterwards, using the client set by Start.
+func SetupNamespace() *corev1.Namespace {
+	ns := &corev1.Namespace{}
+
+	BeforeEach(func(ctx SpecContext) {
+		*ns = corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: "test-",
+			},
+		}
+		cl := kubernetes.GetClient()
+		Expect(cl.Create(ctx, ns)).To(Succeed(), "failed to create test namespace")
+		DeferCleanup(cl.Delete, ns)
+	})
+
+	return ns
+}
+
+// WriteConfig writes the plugin configuration as YAML into a temporary file
+// of the current spec and returns its path.
+func WriteConfig(config any) string {
+	data, err := api.Marshal(config)
+	Expect(err).NotTo(HaveOccurred())
+
+	file := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+	Expect(os.WriteFile(file, data, 0644)).To(Succeed())
+	return file
+}
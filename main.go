@@ -6,75 +6,97 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/coredhcp/coredhcp/config"
-	"github.com/coredhcp/coredhcp/plugins"
-	"github.com/coredhcp/coredhcp/plugins/autoconfigure"
-	"github.com/coredhcp/coredhcp/plugins/dns"
-	"github.com/coredhcp/coredhcp/plugins/example"
-	"github.com/coredhcp/coredhcp/plugins/file"
-	"github.com/coredhcp/coredhcp/plugins/leasetime"
-	"github.com/coredhcp/coredhcp/plugins/mtu"
-	"github.com/coredhcp/coredhcp/plugins/nbp"
-	"github.com/coredhcp/coredhcp/plugins/netmask"
-	"github.com/coredhcp/coredhcp/plugins/prefix"
-	rangeplugin "github.com/coredhcp/coredhcp/plugins/range"
-	"github.com/coredhcp/coredhcp/plugins/router"
-	"github.com/coredhcp/coredhcp/plugins/searchdomains"
-	"github.com/coredhcp/coredhcp/plugins/serverid"
-	"github.com/coredhcp/coredhcp/plugins/sleep"
-	"github.com/coredhcp/coredhcp/plugins/staticroute"
-	"github.com/coredhcp/coredhcp/server"
-	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
-	"github.com/ironcore-dev/fedhcp/plugins/bluefield"
-	"github.com/ironcore-dev/fedhcp/plugins/httpboot"
-	"github.com/ironcore-dev/fedhcp/plugins/ipam"
-	"github.com/ironcore-dev/fedhcp/plugins/metal"
-	"github.com/ironcore-dev/fedhcp/plugins/onmetal"
-	"github.com/ironcore-dev/fedhcp/plugins/oob"
-	"github.com/ironcore-dev/fedhcp/plugins/pxeboot"
-	"k8s.io/apimachinery/pkg/util/sets"
+	"github.com/ironcore-dev/fedhcp/internal/journal"
+	"github.com/ironcore-dev/fedhcp/internal/registry"
+	"github.com/ironcore-dev/fedhcp/internal/selftest"
+	"github.com/ironcore-dev/fedhcp/internal/socketmode"
+	"github.com/ironcore-dev/fedhcp/internal/standalone"
+	"github.com/ironcore-dev/fedhcp/internal/tap"
+	"github.com/ironcore-dev/fedhcp/pkg/server"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
 
-var desiredPlugins = []*plugins.Plugin{
-	&autoconfigure.Plugin,
-	&dns.Plugin,
-	&example.Plugin,
-	&file.Plugin,
-	&leasetime.Plugin,
-	&mtu.Plugin,
-	&nbp.Plugin,
-	&netmask.Plugin,
-	&prefix.Plugin,
-	&rangeplugin.Plugin,
-	&router.Plugin,
-	&searchdomains.Plugin,
-	&serverid.Plugin,
-	&sleep.Plugin,
-	&staticroute.Plugin,
-	&bluefield.Plugin,
-	&ipam.Plugin,
-	&onmetal.Plugin,
-	&oob.Plugin,
-	&pxeboot.Plugin,
-	&httpboot.Plugin,
-	&metal.Plugin,
-}
-
-var (
-	setupLog                   = ctrl.Log.WithName("setup")
-	pluginsRequiringKubernetes = sets.New[string]("oob", "ipam", "metal")
-)
+var setupLog = ctrl.Log.WithName("setup")
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := runConfig(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "fedhcp: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	var configFile string
+	var standaloneFile string
 	var listPlugins bool
+	var adminAddress string
+	var socketMode string
+	var broadcastInterfaces string
+	var announceService string
+	var announceAddresses string
+	var announceInterval time.Duration
+	var journalPath string
+	var journalKeyFile string
+	var adminDebug bool
+	var selfTest bool
+	var selfTestMAC string
+	var selfTestOptions4 string
+	var selfTestOptions6 string
+	var selfTestTimeout time.Duration
+	var tapMACs string
+	var tapDuration time.Duration
+	var segmentWrites int
+	var routesFile string
+	var summaryEvery uint
+	var summaryPerMAC int
+	var summaryMaxLength int
 
 	flag.StringVar(&configFile, "config", "", "config file")
+	flag.StringVar(&standaloneFile, "standalone", "",
+		"standalone file of the interfaces and plugin entries, used instead of the config file")
 	flag.BoolVar(&listPlugins, "list-plugins", false, "list plugins")
+	flag.StringVar(&adminAddress, "admin-address", "", "address the admin API listens on, disabled if empty")
+	flag.BoolVar(&adminDebug, "admin-debug", false, "serve pprof and the internal state under /debug on the admin API")
+	flag.StringVar(&socketMode, "socket-mode", string(socketmode.Auto),
+		"how DHCPv4 replies are sent to clients without an address: raw, udp or auto")
+	flag.StringVar(&broadcastInterfaces, "broadcast-interfaces", "",
+		"comma separated interfaces DHCPv4 replies to clients without an address are always broadcast on")
+	flag.StringVar(&announceService, "announce-service", "",
+		"service (namespace/name) the instance announces itself on, disabled if empty")
+	flag.StringVar(&announceAddresses, "announce-addresses", os.Getenv("POD_IPS"),
+		"comma separated IP addresses announced for wildcard and multicast listen addresses")
+	flag.DurationVar(&announceInterval, "announce-interval", time.Minute, "interval the announcement is refreshed at")
+	flag.StringVar(&journalPath, "journal", "",
+		"file the kubernetes writes are journaled in for crash recovery, disabled if empty")
+	flag.StringVar(&journalKeyFile, "journal-key-file", "",
+		"file holding the base64 encoded AES key the journal is encrypted with, $"+journal.KeyEnv+" is used if empty")
+	flag.BoolVar(&selfTest, "self-test", false,
+		"probe the listeners over loopback after startup and exit non-zero if a reply lacks the expected options")
+	flag.StringVar(&selfTestMAC, "self-test-mac", "02:00:00:00:00:01", "MAC address of the self-test client")
+	flag.StringVar(&selfTestOptions4, "self-test-options4", "54", "comma separated DHCPv4 options the self-test expects")
+	flag.StringVar(&selfTestOptions6, "self-test-options6", "2", "comma separated DHCPv6 options the self-test expects")
+	flag.DurationVar(&selfTestTimeout, "self-test-timeout", 5*time.Second, "time the self-test waits for each reply")
+	flag.StringVar(&tapMACs, "tap-macs", "",
+		"comma separated MAC addresses of clients whose messages are logged through the plugin chain after startup")
+	flag.DurationVar(&tapDuration, "tap-duration", tap.DefaultDuration, "time the clients of --tap-macs are followed for")
+	flag.IntVar(&segmentWrites, "segment-writes", 0,
+		"maximum number of concurrent kubernetes writes per relay segment, unlimited if 0")
+	flag.StringVar(&routesFile, "routes", "",
+		"route table file, plugin entries with a route argument handle the clients of that route only")
+	flag.UintVar(&summaryEvery, "summary-every", 0,
+		"log the debug summaries of requests and responses of every nth transaction only, all if 0")
+	flag.IntVar(&summaryPerMAC, "summary-per-mac", 0,
+		"maximum number of debug summaries logged per client and minute, unlimited if 0")
+	flag.IntVar(&summaryMaxLength, "summary-max-length", 0,
+		"length debug summaries are truncated to, unlimited if 0")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -84,61 +106,138 @@ func main() {
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
 	if listPlugins {
-		for _, p := range desiredPlugins {
+		for _, p := range registry.Plugins {
 			fmt.Println(p.Name)
 		}
 		os.Exit(0)
 	}
 
-	cfg, err := config.Load(configFile)
+	cfg, err := loadConfig(configFile, standaloneFile)
 	if err != nil {
-		setupLog.Error(err, "Failed to load configuration", "ConfigFile", configFile)
+		setupLog.Error(err, "Failed to load configuration", "ConfigFile", configFile, "StandaloneFile", standaloneFile)
 		os.Exit(1)
 	}
 
-	// register plugins
-	for _, plugin := range desiredPlugins {
-		if err := plugins.RegisterPlugin(plugin); err != nil {
-			setupLog.Error(err, "Failed to register plugin", "Plugin", plugin.Name)
+	options := server.Options{
+		SocketMode:       socketMode,
+		RoutesFile:       routesFile,
+		AdminAddress:     adminAddress,
+		AdminDebug:       adminDebug,
+		JournalPath:      journalPath,
+		AnnounceService:  announceService,
+		AnnounceInterval: announceInterval,
+		TapDuration:      tapDuration,
+		SegmentWrites:    segmentWrites,
+		SummaryEvery:     summaryEvery,
+		SummaryPerMAC:    summaryPerMAC,
+		SummaryMaxLength: summaryMaxLength,
+	}
+	if broadcastInterfaces != "" {
+		options.BroadcastInterfaces = strings.Split(broadcastInterfaces, ",")
+	}
+	if selfTest {
+		options.SelfTest, err = newSelfTest(selfTestMAC, selfTestOptions4, selfTestOptions6, selfTestTimeout)
+		if err != nil {
+			setupLog.Error(err, "Invalid self-test")
 			os.Exit(1)
 		}
 	}
-
-	// initialize kubernetes client, if needed
-	if shouldSetupKubeClient(cfg) {
-		if err := kubernetes.InitClient(); err != nil {
-			setupLog.Error(err, "Failed to initialize kubernetes client")
+	for _, mac := range strings.Split(tapMACs, ",") {
+		if mac = strings.TrimSpace(mac); mac == "" {
+			continue
+		}
+		hwAddr, err := net.ParseMAC(mac)
+		if err != nil {
+			setupLog.Error(err, "Invalid tap MAC address", "MAC", mac)
+			os.Exit(1)
+		}
+		options.TapMACs = append(options.TapMACs, hwAddr)
+	}
+	if journalPath != "" {
+		options.JournalKey, err = readJournalKey(journalKeyFile)
+		if err != nil {
+			setupLog.Error(err, "Invalid journal key", "KeyFile", journalKeyFile)
+			os.Exit(1)
+		}
+	}
+	if announceService != "" {
+		options.AnnounceAddresses, err = parseAddresses(announceAddresses)
+		if err != nil {
+			setupLog.Error(err, "Invalid announce addresses")
 			os.Exit(1)
 		}
 	}
 
-	// start server
-	srv, err := server.Start(cfg)
+	srv, err := server.NewServer(cfg, server.DefaultPlugins()...)
 	if err != nil {
-		setupLog.Error(err, "Failed to start server")
+		setupLog.Error(err, "Failed to create server")
 		os.Exit(1)
 	}
-	if err := srv.Wait(); err != nil {
-		setupLog.Error(err, "Failed to wait server")
+	srv.Options = options
+	if err := srv.Run(ctrl.SetupSignalHandler()); err != nil {
+		setupLog.Error(err, "Failed to run server")
+		os.Exit(1)
 	}
 }
 
-func shouldSetupKubeClient(cfg *config.Config) bool {
-	configuredPlugins := sets.Set[string]{}
-	if cfg.Server4 != nil {
-		for _, plugin := range cfg.Server4.Plugins {
-			configuredPlugins.Insert(plugin.Name)
-		}
+// loadConfig loads the coredhcp config file or translates the standalone file,
+// only one of them may be given.
+func loadConfig(configFile, standaloneFile string) (*config.Config, error) {
+	if standaloneFile == "" {
+		return config.Load(configFile)
 	}
-	if cfg.Server6 != nil {
-		for _, plugin := range cfg.Server6.Plugins {
-			configuredPlugins.Insert(plugin.Name)
+	if configFile != "" {
+		return nil, fmt.Errorf("--config and --standalone are mutually exclusive")
+	}
+	return standalone.Load(standaloneFile)
+}
+
+// readJournalKey reads the journal key from the file, or from the environment
+// if no file is given. It returns nil if neither holds a key, the journal is
+// then kept in plain text.
+func readJournalKey(file string) ([]byte, error) {
+	encoded := os.Getenv(journal.KeyEnv)
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
 		}
+		encoded = string(data)
+	}
+	if encoded == "" {
+		return nil, nil
 	}
+	return journal.ParseKey(encoded)
+}
 
-	if configuredPlugins.HasAny(pluginsRequiringKubernetes.UnsortedList()...) {
-		return true
+func newSelfTest(mac, options4, options6 string, timeout time.Duration) (*server.SelfTest, error) {
+	hwAddr, err := net.ParseMAC(mac)
+	if err != nil {
+		return nil, fmt.Errorf("invalid self-test MAC address %s: %w", mac, err)
 	}
+	codes4, err := selftest.ParseOptions4(options4)
+	if err != nil {
+		return nil, err
+	}
+	codes6, err := selftest.ParseOptions6(options6)
+	if err != nil {
+		return nil, err
+	}
+	return &server.SelfTest{MAC: hwAddr, Options4: codes4, Options6: codes6, Timeout: timeout}, nil
+}
 
-	return false
+// parseAddresses parses comma separated IP addresses.
+func parseAddresses(addresses string) ([]net.IP, error) {
+	var ips []net.IP
+	for _, address := range strings.Split(addresses, ",") {
+		if address == "" {
+			continue
+		}
+		ip := net.ParseIP(strings.TrimSpace(address))
+		if ip == nil {
+			return nil, fmt.Errorf("invalid announce address %s", address)
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
 }
@@ -0,0 +1,345 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package server runs FeDHCP, so that other components, e.g. a binary
+// combining several boot services, can embed it with their own set of plugins
+// instead of running the fedhcp binary:
+//
+//	srv, err := server.NewServer(cfg, append(server.DefaultPlugins(), &myplugin.Plugin)...)
+//	if err != nil {
+//		return err
+//	}
+//	srv.Options.AdminAddress = ":8081"
+//	return srv.Run(ctx)
+//
+// The plugins are registered with coredhcp, whose plugin registry is global,
+// so a process runs a single server.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"time"
+
+	"github.com/coredhcp/coredhcp/config"
+	"github.com/coredhcp/coredhcp/plugins"
+	coredhcpserver "github.com/coredhcp/coredhcp/server"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/admin"
+	"github.com/ironcore-dev/fedhcp/internal/announce"
+	"github.com/ironcore-dev/fedhcp/internal/chain"
+	"github.com/ironcore-dev/fedhcp/internal/journal"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/ironcore-dev/fedhcp/internal/printer"
+	"github.com/ironcore-dev/fedhcp/internal/recovery"
+	"github.com/ironcore-dev/fedhcp/internal/registry"
+	"github.com/ironcore-dev/fedhcp/internal/requested"
+	"github.com/ironcore-dev/fedhcp/internal/response"
+	"github.com/ironcore-dev/fedhcp/internal/route"
+	"github.com/ironcore-dev/fedhcp/internal/segment"
+	"github.com/ironcore-dev/fedhcp/internal/selftest"
+	"github.com/ironcore-dev/fedhcp/internal/socketmode"
+	"github.com/ironcore-dev/fedhcp/internal/tap"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+var setupLog = ctrl.Log.WithName("setup")
+
+// Options configure the optional features of a server, the zero value
+// disables all of them.
+type Options struct {
+	// SocketMode is how DHCPv4 replies are sent to clients without an
+	// address: raw, udp or auto, the default
+	SocketMode string
+	// BroadcastInterfaces are the interfaces DHCPv4 replies to clients without
+	// an address are always broadcast on
+	BroadcastInterfaces []string
+	// RoutesFile is the route table file, plugin entries with a route argument
+	// handle the clients of that route only
+	RoutesFile string
+	// AdminAddress is the address the admin API listens on, disabled if empty
+	AdminAddress string
+	// AdminDebug serves pprof and the internal state under /debug on the admin API
+	AdminDebug bool
+	// JournalPath is the file the kubernetes writes are journaled in for
+	// crash recovery, disabled if empty
+	JournalPath string
+	// JournalKey is the AES key the journal entries are encrypted with, see
+	// journal.ParseKey; they are kept in plain text if nil
+	JournalKey []byte
+	// AnnounceService is the service (namespace/name) the instance announces
+	// itself on, disabled if empty
+	AnnounceService string
+	// AnnounceAddresses are announced for wildcard and multicast listen addresses
+	AnnounceAddresses []net.IP
+	// AnnounceInterval is the interval the announcement is refreshed at, a
+	// minute if 0
+	AnnounceInterval time.Duration
+	// SelfTest probes the listeners over loopback after startup, disabled if nil
+	SelfTest *SelfTest
+	// TapMACs are the clients whose messages are logged through the plugin
+	// chain after startup
+	TapMACs []net.HardwareAddr
+	// TapDuration is the time the clients of TapMACs are followed for, the
+	// tap default if 0
+	TapDuration time.Duration
+	// SegmentWrites is the maximum number of concurrent kubernetes writes per
+	// relay segment, unlimited if 0
+	SegmentWrites int
+	// SummaryEvery logs the debug summaries of every nth transaction only, all if 0
+	SummaryEvery uint
+	// SummaryPerMAC is the maximum number of debug summaries logged per client
+	// and minute, unlimited if 0
+	SummaryPerMAC int
+	// SummaryMaxLength is the length debug summaries are truncated to,
+	// unlimited if 0
+	SummaryMaxLength int
+}
+
+// SelfTest configures the probe of the listeners after startup.
+type SelfTest struct {
+	// MAC is the MAC address of the self-test client
+	MAC net.HardwareAddr
+	// Options4 are the DHCPv4 options the self-test expects
+	Options4 []dhcpv4.OptionCode
+	// Options6 are the DHCPv6 options the self-test expects
+	Options6 []dhcpv6.OptionCode
+	// Timeout is the time the self-test waits for each reply
+	Timeout time.Duration
+}
+
+// Server runs the plugin chain of a coredhcp configuration.
+type Server struct {
+	// Options configure the optional features, they are read by Run
+	Options Options
+
+	cfg     *config.Config
+	plugins []*plugins.Plugin
+}
+
+// DefaultPlugins returns the plugins the fedhcp binary is built with, callers
+// may add their own.
+func DefaultPlugins() []*plugins.Plugin {
+	return append([]*plugins.Plugin(nil), registry.Plugins...)
+}
+
+// NewServer returns a server running the plugin chain of the configuration
+// with the plugins, the default ones if none are given.
+func NewServer(cfg *config.Config, plugins ...*plugins.Plugin) (*Server, error) {
+	if cfg == nil {
+		return nil, errors.New("configuration must not be nil")
+	}
+	if len(plugins) == 0 {
+		plugins = DefaultPlugins()
+	}
+	return &Server{cfg: cfg, plugins: plugins}, nil
+}
+
+// validate checks the options for sane values.
+func (o *Options) validate() error {
+	if o.SegmentWrites < 0 {
+		return fmt.Errorf("invalid segment writes: must not be negative, got %d", o.SegmentWrites)
+	}
+	if o.SummaryEvery > math.MaxUint32 || o.SummaryPerMAC < 0 || o.SummaryMaxLength < 0 {
+		return fmt.Errorf("invalid summary throttling: must not be negative, nor every exceed %d", uint32(math.MaxUint32))
+	}
+	return nil
+}
+
+// Run registers the plugins, sets up kubernetes, the admin API and the
+// announcement as configured and serves until ctx is cancelled or a listener
+// fails. Kubernetes calls of pending requests are interrupted when ctx is
+// cancelled.
+func (s *Server) Run(ctx context.Context) error {
+	o := s.Options
+	if err := o.validate(); err != nil {
+		return err
+	}
+
+	mode := socketmode.Auto
+	if o.SocketMode != "" {
+		var err error
+		if mode, err = socketmode.Parse(o.SocketMode); err != nil {
+			return fmt.Errorf("invalid socket mode: %w", err)
+		}
+	}
+	mode = mode.Resolve()
+	setupLog.Info("Using socket mode", "SocketMode", mode)
+
+	var broadcast socketmode.Broadcast
+	if len(o.BroadcastInterfaces) > 0 {
+		var err error
+		if broadcast, err = socketmode.BroadcastOn(o.BroadcastInterfaces); err != nil {
+			return fmt.Errorf("invalid broadcast interfaces: %w", err)
+		}
+		setupLog.Info("Forcing broadcast replies", "Networks", broadcast)
+	}
+
+	var probe *selftest.Probe
+	if o.SelfTest != nil {
+		probe = &selftest.Probe{
+			MAC:      o.SelfTest.MAC,
+			Options4: o.SelfTest.Options4,
+			Options6: o.SelfTest.Options6,
+			Timeout:  o.SelfTest.Timeout,
+		}
+		selftest.SetClient(o.SelfTest.MAC)
+	}
+
+	// follow clients, if configured
+	tapDuration := o.TapDuration
+	if tapDuration == 0 {
+		tapDuration = tap.DefaultDuration
+	}
+	for _, mac := range o.TapMACs {
+		until := tap.Follow(mac, tapDuration)
+		setupLog.Info("Following client", "MAC", mac.String(), "Until", until)
+	}
+
+	segment.SetLimit(o.SegmentWrites)
+	printer.Configure(printer.Config{
+		Every:     uint32(o.SummaryEvery),
+		PerMAC:    o.SummaryPerMAC,
+		MaxLength: o.SummaryMaxLength,
+	})
+
+	var routes *route.Table
+	if o.RoutesFile != "" {
+		var err error
+		if routes, err = route.Load(o.RoutesFile); err != nil {
+			return fmt.Errorf("failed to load routes from %s: %w", o.RoutesFile, err)
+		}
+	}
+
+	// register plugins
+	for _, plugin := range s.plugins {
+		if err := plugins.RegisterPlugin(broadcast.Wrap(mode.Wrap(routes.Wrap(tap.Wrap(chain.Wrap(requested.Wrap(response.Wrap(recovery.Wrap(selftest.Wrap(plugin)))))))))); err != nil {
+			return fmt.Errorf("failed to register plugin %s: %w", plugin.Name, err)
+		}
+	}
+
+	// interrupt the kubernetes calls of pending requests on shutdown
+	kubernetes.SetContext(ctx)
+
+	// initialize kubernetes client, if needed
+	if registry.RequiresKubernetes(s.cfg) || routes.RequiresKubernetes() || o.AnnounceService != "" || o.JournalPath != "" {
+		if err := kubernetes.InitClient(); err != nil {
+			return fmt.Errorf("failed to initialize kubernetes client: %w", err)
+		}
+	}
+	// the plugins look up IPs, Endpoints, Servers and ConfigMaps, the routes Servers, by MAC address in the cache
+	if registry.RequiresKubernetes(s.cfg) || routes.RequiresKubernetes() {
+		if err := kubernetes.InitCache(ctx); err != nil {
+			return fmt.Errorf("failed to initialize kubernetes cache: %w", err)
+		}
+	}
+
+	// open journal and reconcile interrupted transactions, if configured
+	if o.JournalPath != "" {
+		j, err := journal.OpenEncrypted(o.JournalPath, o.JournalKey)
+		if err != nil {
+			return fmt.Errorf("failed to open journal %s: %w", o.JournalPath, err)
+		}
+		if err := j.Reconcile(context.Background(), kubernetes.GetClient()); err != nil {
+			setupLog.Error(err, "Failed to reconcile interrupted transactions", "Journal", o.JournalPath)
+		}
+	}
+
+	// start admin API, if configured
+	failed := make(chan error, 1)
+	if o.AdminAddress != "" {
+		if o.AdminDebug {
+			admin.EnableDebug()
+		}
+		if probe != nil {
+			admin.Handle("/self-test", selftest.Handler())
+		}
+		admin.Handle("/tap", tap.Handler())
+		go func() {
+			if err := admin.ListenAndServe(o.AdminAddress); err != nil {
+				failed <- fmt.Errorf("failed to serve admin API on %s: %w", o.AdminAddress, err)
+			}
+		}()
+	}
+
+	// announce instance, if configured
+	if o.AnnounceService != "" {
+		withdraw, err := s.announce(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to announce instance on %s: %w", o.AnnounceService, err)
+		}
+		defer withdraw()
+	}
+
+	// start server
+	srv, err := coredhcpserver.Start(s.cfg)
+	if err != nil {
+		return fmt.Errorf("failed to start server: %w", err)
+	}
+	defer srv.Close()
+	go func() {
+		select {
+		case <-ctx.Done():
+			setupLog.Info("Shutting down server")
+		case err := <-failed:
+			setupLog.Error(err, "Shutting down server")
+			failed <- err
+		}
+		srv.Close()
+	}()
+
+	// probe the listeners, if configured
+	if probe != nil {
+		if err := probe.Run(s.cfg); err != nil {
+			return fmt.Errorf("self-test failed: %w", err)
+		}
+		selftest.Pass()
+		setupLog.Info("Self-test passed")
+	}
+
+	err = srv.Wait()
+	select {
+	case failure := <-failed:
+		return failure
+	default:
+	}
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("failed to wait server: %w", err)
+	}
+	return nil
+}
+
+// announce publishes the announcement of the instance and returns the function
+// withdrawing it on shutdown.
+func (s *Server) announce(ctx context.Context) (func(), error) {
+	key, err := announce.ParseService(s.Options.AnnounceService)
+	if err != nil {
+		return nil, err
+	}
+	interval := s.Options.AnnounceInterval
+	if interval == 0 {
+		interval = time.Minute
+	}
+	instance, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %w", err)
+	}
+
+	cl := kubernetes.GetClient()
+	if err := announce.New(s.cfg, s.Options.AnnounceAddresses).Run(ctx, cl, key, instance, interval); err != nil {
+		return nil, err
+	}
+	return func() {
+		// the context is cancelled on shutdown, the withdrawal gets one of its own
+		withdrawCtx, cancel := context.WithTimeout(context.Background(), kubernetes.DefaultTimeout)
+		defer cancel()
+		if err := announce.Withdraw(withdrawCtx, cl, key, instance); err != nil {
+			setupLog.Error(err, "Failed to withdraw announcement", "Service", key.String())
+		}
+	}, nil
+}
@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coredhcp/coredhcp/config"
+	"github.com/ironcore-dev/fedhcp/internal/registry"
+)
+
+func TestNewServer(t *testing.T) {
+	if _, err := NewServer(nil); err == nil {
+		t.Error("no error occurred without configuration, but it should have")
+	}
+
+	srv, err := NewServer(&config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.plugins) != len(registry.Plugins) {
+		t.Errorf("expected the %d default plugins, got %d", len(registry.Plugins), len(srv.plugins))
+	}
+
+	// the default plugins are a copy, so embedders can append their own
+	plugins := DefaultPlugins()
+	plugins[0] = nil
+	if registry.Plugins[0] == nil {
+		t.Error("expected DefaultPlugins to return a copy")
+	}
+}
+
+func TestInvalidOptions(t *testing.T) {
+	for _, options := range []Options{
+		{SegmentWrites: -1},
+		{SummaryPerMAC: -1},
+		{SocketMode: "tcp"},
+		{BroadcastInterfaces: []string{"does-not-exist0"}},
+	} {
+		srv, err := NewServer(&config.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.Options = options
+		if err := srv.Run(context.Background()); err == nil {
+			t.Errorf("no error occurred for options %+v, but it should have", options)
+		}
+	}
+}
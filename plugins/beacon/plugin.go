@@ -0,0 +1,238 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package beacon
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/fingerprint"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/ironcore-dev/fedhcp/internal/rawopts"
+	"github.com/ironcore-dev/fedhcp/internal/subnetmatch"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logger.GetLogger("plugins/beacon")
+
+var Plugin = plugins.Plugin{
+	Name:   "beacon",
+	Setup4: setup4,
+	Setup6: setup6,
+}
+
+const (
+	// defaultOption4 is the first site-specific DHCPv4 option, RFC 2132 section 2
+	defaultOption4 = 224
+	maxOption4     = 254
+)
+
+// rule is a parsed beacon rule.
+type rule struct {
+	name    string
+	subnets []netip.Prefix
+	classes []fingerprint.Class
+	value   []byte
+}
+
+// plugin holds the state of a single beacon plugin instance. It is built once
+// in setup and never modified afterwards.
+type plugin struct {
+	option   uint16
+	defaults *rule
+	rules    []rule
+	// classify is set if a rule matches classes, the clients are only
+	// classified then
+	classify bool
+	log      *logrus.Entry
+}
+
+// args[0] = path to config file
+func parseArgs(args ...string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("exactly one argument must be passed to the beacon plugin, got %d", len(args))
+	}
+	return args[0], nil
+}
+
+func loadConfig(args ...string) (*api.BeaconConfig, error) {
+	path, err := parseArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	log.Debugf("Reading config file %s", path)
+	config := &api.BeaconConfig{}
+	if err := api.Load(path, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func newPlugin(name string, config *api.BeaconConfig) (*plugin, error) {
+	if len(config.Rules) == 0 && config.Default == "" {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("at least one rule or a default must be configured")}
+	}
+	p := &plugin{log: instance.Logger(log, name)}
+	if config.Default != "" {
+		p.defaults = &rule{name: "default", value: []byte(config.Default)}
+	}
+
+	for i, r := range config.Rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i)
+		}
+		if len(r.Subnets) == 0 && len(r.Classes) == 0 {
+			return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("%s: at least one subnet or class must be configured", r.Name)}
+		}
+		if r.Value == "" {
+			return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("%s: value must be configured", r.Name)}
+		}
+
+		parsed := rule{name: r.Name, value: []byte(r.Value)}
+		for _, subnet := range r.Subnets {
+			prefix, err := subnetmatch.ParsePrefix(subnet)
+			if err != nil {
+				return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("%s: invalid subnet %s: %w", r.Name, subnet, err)}
+			}
+			parsed.subnets = append(parsed.subnets, prefix)
+		}
+		for _, class := range r.Classes {
+			if !slices.Contains(fingerprint.Classes, fingerprint.Class(class)) {
+				return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("%s: unknown class %s, should be one of %v", r.Name, class, fingerprint.Classes)}
+			}
+			parsed.classes = append(parsed.classes, fingerprint.Class(class))
+			p.classify = true
+		}
+		p.rules = append(p.rules, parsed)
+	}
+	return p, nil
+}
+
+func setup6(args ...string) (handler.Handler6, error) {
+	config, err := loadConfig(args...)
+	if err != nil {
+		return nil, err
+	}
+	if config.Option6 == 0 {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("option6 must be configured")}
+	}
+	p, err := newPlugin("beacon/v6", config)
+	if err != nil {
+		return nil, err
+	}
+	p.option = config.Option6
+	p.log.Printf("Loaded beacon plugin for DHCPv6 with option %d and %d rules.", p.option, len(p.rules))
+	return p.handler6, nil
+}
+
+func setup4(args ...string) (handler.Handler4, error) {
+	config, err := loadConfig(args...)
+	if err != nil {
+		return nil, err
+	}
+	option := config.Option4
+	if option == 0 {
+		option = defaultOption4
+	}
+	if option < defaultOption4 || option > maxOption4 {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("option4 %d must be a site-specific option, %d-%d", option, defaultOption4, maxOption4)}
+	}
+	p, err := newPlugin("beacon/v4", config)
+	if err != nil {
+		return nil, err
+	}
+	p.option = option
+	p.log.Printf("Loaded beacon plugin for DHCPv4 with option %d and %d rules.", p.option, len(p.rules))
+	return p.handler4, nil
+}
+
+func (r *rule) matches(addr net.IP, class fingerprint.Class) bool {
+	if len(r.classes) > 0 && !slices.Contains(r.classes, class) {
+		return false
+	}
+	if len(r.subnets) > 0 {
+		return slices.ContainsFunc(r.subnets, func(subnet netip.Prefix) bool {
+			return subnetmatch.Contains(subnet, addr)
+		})
+	}
+	return true
+}
+
+// match returns the first rule matching the client, or the defaults, which
+// may be nil. The class is only computed if needed.
+func (p *plugin) match(addr net.IP, class func() fingerprint.Class) *rule {
+	var c fingerprint.Class
+	if p.classify {
+		c = class()
+	}
+	for i := range p.rules {
+		if p.rules[i].matches(addr, c) {
+			return &p.rules[i]
+		}
+	}
+	return p.defaults
+}
+
+func (p *plugin) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	reply, ok := resp.(*dhcpv6.Message)
+	if !ok {
+		p.log.Errorf("Unexpected response type %T", resp)
+		return resp, false
+	}
+
+	addr := subnetmatch.Leased6(reply)
+	if addr == nil && req.IsRelay() {
+		if inner, err := dhcpv6.DecapsulateRelayIndex(req, -1); err == nil {
+			addr = inner.(*dhcpv6.RelayMessage).LinkAddr
+		}
+	}
+	r := p.match(addr, func() fingerprint.Class {
+		result, err := fingerprint.Classify6(req)
+		if err != nil {
+			return fingerprint.ClassUnknown
+		}
+		return result.Class
+	})
+	if r == nil {
+		return resp, false
+	}
+
+	reply.Options.Del(dhcpv6.OptionCode(p.option))
+	if err := rawopts.Add6(reply, rawopts.Option{Code: p.option, Data: r.value}); err != nil {
+		p.log.Errorf("Could not add beacon option: %v", err)
+		return resp, false
+	}
+	p.log.Debugf("Added beacon of %s for %s", r.name, req.Summary())
+	return resp, false
+}
+
+func (p *plugin) handler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	addr := resp.YourIPAddr
+	if addr == nil || addr.IsUnspecified() {
+		addr = req.GatewayIPAddr
+	}
+	r := p.match(addr, func() fingerprint.Class {
+		return fingerprint.Classify4(req).Class
+	})
+	if r == nil {
+		return resp, false
+	}
+
+	if err := rawopts.Add4(resp, rawopts.Option{Code: p.option, Data: r.value}); err != nil {
+		p.log.Errorf("Could not add beacon option: %v", err)
+		return resp, false
+	}
+	p.log.Debugf("Added beacon of %s for %s", r.name, req.ClientHWAddr)
+	return resp, false
+}
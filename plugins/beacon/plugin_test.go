@@ -0,0 +1,181 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package beacon
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/api/apitest"
+	"github.com/ironcore-dev/fedhcp/internal/rawopts"
+)
+
+var (
+	mac = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+
+	config = api.BeaconConfig{
+		Option6: 65224,
+		Default: "site=unknown",
+		Rules: []api.BeaconRule{
+			{
+				Name:    "fra1",
+				Subnets: []string{"10.1.0.0/16", "2001:db8:1::/48"},
+				Value:   "site=fra1",
+			},
+			{
+				Name:    "switches",
+				Classes: []string{"switch"},
+				Value:   "site=global",
+			},
+		},
+	}
+)
+
+func TestWrongNumberArgs(t *testing.T) {
+	_, err := setup4()
+	if err == nil {
+		t.Fatal("no error occurred when not providing a configuration file path, but it should have")
+	}
+
+	_, err = setup6("foo", "bar")
+	if err == nil {
+		t.Fatal("no error occurred when providing wrong number of args (2), but it should have")
+	}
+}
+
+func TestWrongArgs(t *testing.T) {
+	for _, config := range []api.BeaconConfig{
+		{},
+		{Option4: 67, Default: "site=fra1"},
+		{Option4: 255, Default: "site=fra1"},
+		{Rules: []api.BeaconRule{{Name: "any", Value: "site=fra1"}}},
+		{Rules: []api.BeaconRule{{Subnets: []string{"10.0.0.0/33"}, Value: "site=fra1"}}},
+		{Rules: []api.BeaconRule{{Classes: []string{"toaster"}, Value: "site=fra1"}}},
+		{Rules: []api.BeaconRule{{Subnets: []string{"10.0.0.0/8"}}}},
+	} {
+		if _, err := setup4(apitest.WriteConfig(t, config)); err == nil {
+			t.Fatalf("no error occurred when providing config %+v, but it should have", config)
+		}
+	}
+
+	if _, err := setup6(apitest.WriteConfig(t, api.BeaconConfig{Default: "site=fra1"})); err == nil {
+		t.Fatal("no error occurred when not providing a DHCPv6 option, but it should have")
+	}
+}
+
+/* IPv6 */
+func newReply6(t *testing.T, vendorClass string, addr string) (*dhcpv6.Message, *dhcpv6.Message) {
+	req, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.MessageType = dhcpv6.MessageTypeRequest
+	req.AddOption(dhcpv6.OptClientID(&dhcpv6.DUIDLL{HWType: 1, LinkLayerAddr: mac}))
+	if vendorClass != "" {
+		req.AddOption(&dhcpv6.OptVendorClass{EnterpriseNumber: 343, Data: [][]byte{[]byte(vendorClass)}})
+	}
+	resp, err := dhcpv6.NewReplyFromMessage(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.AddOption(&dhcpv6.OptIANA{
+		IaId: [4]byte{0, 0, 0, 1},
+		Options: dhcpv6.IdentityOptions{Options: dhcpv6.Options{
+			&dhcpv6.OptIAAddress{IPv6Addr: net.ParseIP(addr), ValidLifetime: time.Hour, PreferredLifetime: time.Hour},
+		}},
+	})
+	return req, resp
+}
+
+func TestBeacon6(t *testing.T) {
+	handler, err := setup6(apitest.WriteConfig(t, config))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		vendorClass, addr, expected string
+	}{
+		{"", "2001:db8:1::10", "site=fra1"},
+		{"SONiC-ZTP", "2001:db8:2::10", "site=global"},
+		{"", "2001:db8:2::10", "site=unknown"},
+	} {
+		req, resp := newReply6(t, tc.vendorClass, tc.addr)
+		result, stop := handler(req, resp)
+		if stop {
+			t.Fatal("beacon must not stop the chain")
+		}
+
+		values := rawopts.Get6(result.(*dhcpv6.Message), config.Option6)
+		if len(values) != 1 || string(values[0]) != tc.expected {
+			t.Errorf("expected beacon %s for %s, got %q", tc.expected, tc.addr, values)
+		}
+	}
+}
+
+/* IPv4 */
+func newReply4(t *testing.T, vendorClass string, addr string) (*dhcpv4.DHCPv4, *dhcpv4.DHCPv4) {
+	req, err := dhcpv4.NewDiscovery(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vendorClass != "" {
+		req.UpdateOption(dhcpv4.OptClassIdentifier(vendorClass))
+	}
+	resp, err := dhcpv4.NewReplyFromRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.YourIPAddr = net.ParseIP(addr)
+	return req, resp
+}
+
+func TestBeacon4(t *testing.T) {
+	handler, err := setup4(apitest.WriteConfig(t, config))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		vendorClass, addr, expected string
+	}{
+		{"", "10.1.2.3", "site=fra1"},
+		{"Arista", "10.2.2.3", "site=global"},
+		{"", "10.2.2.3", "site=unknown"},
+	} {
+		req, resp := newReply4(t, tc.vendorClass, tc.addr)
+		result, stop := handler(req, resp)
+		if stop {
+			t.Fatal("beacon must not stop the chain")
+		}
+
+		if value := rawopts.Get4(result, defaultOption4); string(value) != tc.expected {
+			t.Errorf("expected beacon %s for %s, got %q", tc.expected, tc.addr, value)
+		}
+	}
+}
+
+func TestRelayAddress4(t *testing.T) {
+	handler, err := setup4(apitest.WriteConfig(t, api.BeaconConfig{Rules: config.Rules}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, resp := newReply4(t, "", "0.0.0.0")
+	req.GatewayIPAddr = net.ParseIP("10.1.0.1")
+	result, _ := handler(req, resp)
+	if value := rawopts.Get4(result, defaultOption4); string(value) != "site=fra1" {
+		t.Errorf("expected beacon site=fra1 by relay address, got %q", value)
+	}
+
+	req, resp = newReply4(t, "", "10.9.0.1")
+	result, _ = handler(req, resp)
+	if rawopts.Has4(result, defaultOption4) {
+		t.Error("expected no beacon without a matching rule or default")
+	}
+}
@@ -6,7 +6,7 @@ package bluefield
 import (
 	"fmt"
 	"net"
-	"os"
+	"strings"
 	"time"
 
 	"github.com/coredhcp/coredhcp/handler"
@@ -14,8 +14,12 @@ import (
 	"github.com/coredhcp/coredhcp/plugins"
 	"github.com/insomniacslk/dhcp/dhcpv6"
 	"github.com/insomniacslk/dhcp/iana"
+	"github.com/ironcore-dev/fedhcp/internal/admin"
 	"github.com/ironcore-dev/fedhcp/internal/api"
-	"gopkg.in/yaml.v2"
+	"github.com/ironcore-dev/fedhcp/internal/cache"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/sirupsen/logrus"
 )
 
 var log = logger.GetLogger("plugins/bluefield")
@@ -24,7 +28,30 @@ var Plugin = plugins.Plugin{
 	Name:   "bluefield",
 	Setup6: setupPlugin,
 }
-var ipaddr net.IP
+
+const (
+	// maxAssignments bounds the remembered assignments, which are forgotten
+	// once the valid lifetime of the address has passed
+	maxAssignments = 1024
+	validLifetime  = 48 * time.Hour
+)
+
+// plugin holds the state of a single bluefield plugin instance. Apart from the
+// assignments it is built once in setupPlugin and never modified afterwards.
+type plugin struct {
+	ipaddr net.IP
+	log    *logrus.Entry
+
+	// assignments maps the clients the address was assigned to, see client,
+	// to their assignment
+	assignments *cache.Cache[string, assignment]
+}
+
+// assignment is an address assigned to a client, see admin.State.
+type assignment struct {
+	Address  string    `json:"address"`
+	Assigned time.Time `json:"assigned"`
+}
 
 // args[0] = path to config file
 func parseArgs(args ...string) (string, error) {
@@ -37,36 +64,86 @@ func parseArgs(args ...string) (string, error) {
 func loadConfig(args ...string) (*api.BluefieldConfig, error) {
 	path, err := parseArgs(args...)
 	if err != nil {
-		return nil, fmt.Errorf("invalid configuration: %v", err)
+		return nil, &fedhcperrors.ConfigError{Err: err}
 	}
 
 	log.Debugf("Reading bluefield config file %s", path)
-	configData, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %v", err)
-	}
 	config := &api.BluefieldConfig{}
-	if err = yaml.Unmarshal(configData, config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %v", err)
+	if err := api.Load(path, config); err != nil {
+		return nil, err
 	}
 	return config, nil
 }
 
-// setupPlugin initializes the plugin with given bluefield config.
-func setupPlugin(args ...string) (handler.Handler6, error) {
+func newPlugin(args ...string) (*plugin, error) {
 	bluefieldIPConfig, err := loadConfig(args...)
 	if err != nil {
 		return nil, err
 	}
-	ipaddr = net.ParseIP(bluefieldIPConfig.BulefieldIP)
+	ipaddr := net.ParseIP(bluefieldIPConfig.BulefieldIP)
 	if ipaddr == nil {
 		return nil, fmt.Errorf("invalid IPv6 address: %s", args[0])
 	}
-	log.Infof("Parsed IP %s", ipaddr)
-	return handleDHCPv6, nil
+	name := instance.Next("bluefield/v6")
+	p := &plugin{
+		ipaddr:      ipaddr,
+		log:         log.WithField("instance", name),
+		assignments: cache.New[string, assignment](name+"/assignments", maxAssignments, validLifetime),
+	}
+	admin.State(name, p.state)
+	p.log.Infof("Parsed IP %s", ipaddr)
+	return p, nil
+}
+
+// setupPlugin initializes the plugin with given bluefield config.
+func setupPlugin(args ...string) (handler.Handler6, error) {
+	p, err := newPlugin(args...)
+	if err != nil {
+		return nil, err
+	}
+	return p.handleDHCPv6, nil
+}
+
+func (p *plugin) state() any {
+	assignments := make(map[string]assignment)
+	p.assignments.Range(func(client string, a assignment) bool {
+		assignments[client] = a
+		return true
+	})
+	return map[string]any{"assignments": assignments}
+}
+
+// client identifies the client of a request by its MAC address or, if there is
+// none, its DUID.
+func client(req dhcpv6.DHCPv6, m *dhcpv6.Message) string {
+	if mac, err := dhcpv6.ExtractMAC(req); err == nil {
+		return mac.String()
+	}
+	if duid := m.Options.ClientID(); duid != nil {
+		return duid.String()
+	}
+	return "unknown"
+}
+
+// record remembers the assignment of the address to the client and warns if it
+// is assigned to another client as well, since the plugin leases the same
+// address to every client.
+func (p *plugin) record(client string) {
+	address := p.ipaddr.String()
+	var holders []string
+	p.assignments.Range(func(other string, a assignment) bool {
+		if other != client && a.Address == address {
+			holders = append(holders, other)
+		}
+		return true
+	})
+	if len(holders) > 0 {
+		p.log.Warnf("Assigned IP %s to %s, but it is assigned to %s as well", address, client, strings.Join(holders, ", "))
+	}
+	p.assignments.Put(client, assignment{Address: address, Assigned: time.Now()})
 }
 
-func handleDHCPv6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) { //nolint:staticcheck
+func (p *plugin) handleDHCPv6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) { //nolint:staticcheck
 	m, err := req.GetInnerMessage()
 	if err != nil {
 		return nil, true
@@ -86,11 +163,11 @@ func handleDHCPv6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) { //nolint:stat
 	case dhcpv6.MessageTypeSolicit:
 		resp, err := dhcpv6.NewAdvertiseFromSolicit(m)
 		if err != nil {
-			log.Errorf("Failed to create DHCPv6 advertise: %v", err)
+			p.log.Errorf("Failed to create DHCPv6 advertise: %v", err)
 			return nil, true
 		}
 
-		log.Infof("IP: %s", ipaddr)
+		p.log.Infof("IP: %s", p.ipaddr)
 
 		resp.AddOption(&dhcpv6.OptIANA{
 			IaId: m.Options.OneIANA().IaId,
@@ -98,9 +175,9 @@ func handleDHCPv6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) { //nolint:stat
 			T2:   2 * time.Hour,
 			Options: dhcpv6.IdentityOptions{Options: []dhcpv6.Option{
 				&dhcpv6.OptIAAddress{
-					IPv6Addr:          ipaddr,
+					IPv6Addr:          p.ipaddr,
 					PreferredLifetime: 24 * time.Hour,
-					ValidLifetime:     48 * time.Hour,
+					ValidLifetime:     validLifetime,
 				},
 			}},
 		})
@@ -111,8 +188,8 @@ func handleDHCPv6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) { //nolint:stat
 	case dhcpv6.MessageTypeRequest:
 		resp, err = dhcpv6.NewReplyFromMessage(m) //nolint:staticcheck
 		if err != nil {
-			log.Errorf("Failed to create DHCPv6 reply: %v", err)
-			return nil, false
+			p.log.Errorf("Failed to create DHCPv6 reply: %v", err)
+			return nil, true
 		}
 
 		resp.AddOption(&dhcpv6.OptIANA{
@@ -121,15 +198,16 @@ func handleDHCPv6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) { //nolint:stat
 			T2:   2 * time.Hour,
 			Options: dhcpv6.IdentityOptions{Options: []dhcpv6.Option{
 				&dhcpv6.OptIAAddress{
-					IPv6Addr:          ipaddr,
+					IPv6Addr:          p.ipaddr,
 					PreferredLifetime: 24 * time.Hour,
-					ValidLifetime:     48 * time.Hour,
+					ValidLifetime:     validLifetime,
 				},
 			}},
 		})
 
 		dhcpv6.WithServerID(v6ServerID)(resp)
-		return resp, true
+		p.record(client(req, m))
+		return resp, false
 	}
-	return nil, false
+	return nil, true
 }
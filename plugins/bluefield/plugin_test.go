@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package bluefield
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+const bootFileURL = "http://[2001:db8::1]/boot.uki"
+
+func Init(t *testing.T) *plugin {
+	config := filepath.Join(t.TempDir(), "bluefield_config.yaml")
+	if err := os.WriteFile(config, []byte("bulefieldIP: 2001:db8::1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := newPlugin(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func request(t *testing.T, mac net.HardwareAddr, msgType dhcpv6.MessageType) *dhcpv6.Message {
+	req, err := dhcpv6.NewMessage(dhcpv6.WithIAID([4]byte{1, 2, 3, 4}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.MessageType = msgType
+	req.AddOption(dhcpv6.OptClientID(&dhcpv6.DUIDLL{HWType: 1, LinkLayerAddr: mac}))
+	return req
+}
+
+func TestWrongArgs(t *testing.T) {
+	if _, err := setupPlugin(); err == nil {
+		t.Fatal("no error occurred when not providing a config file, but it should have")
+	}
+}
+
+func TestAssignments(t *testing.T) {
+	p := Init(t)
+	first := net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+	second := net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5f}
+
+	if resp, _ := p.handleDHCPv6(request(t, first, dhcpv6.MessageTypeSolicit), nil); resp == nil {
+		t.Fatal("no ADVERTISE returned")
+	}
+	if p.assignments.Len() != 0 {
+		t.Error("expected no assignment for an ADVERTISE")
+	}
+
+	for _, mac := range []net.HardwareAddr{first, second} {
+		if resp, _ := p.handleDHCPv6(request(t, mac, dhcpv6.MessageTypeRequest), nil); resp == nil {
+			t.Fatalf("no REPLY returned for %s", mac)
+		}
+	}
+	assignments := p.state().(map[string]any)["assignments"].(map[string]assignment)
+	if len(assignments) != 2 {
+		t.Fatalf("expected two assignments, got %v", assignments)
+	}
+	for _, mac := range []net.HardwareAddr{first, second} {
+		if assignments[mac.String()].Address != "2001:db8::1" {
+			t.Errorf("expected 2001:db8::1 assigned to %s, got %v", mac, assignments[mac.String()])
+		}
+	}
+}
+
+// runChain runs the handlers like coredhcp until one stops the chain and
+// returns the response and the number of handlers run.
+func runChain(req dhcpv6.DHCPv6, handlers ...handler.Handler6) (dhcpv6.DHCPv6, int) {
+	var resp dhcpv6.DHCPv6
+	for i, h := range handlers {
+		var stop bool
+		if resp, stop = h(req, resp); stop {
+			return resp, i + 1
+		}
+	}
+	return resp, len(handlers)
+}
+
+// addBootFile adds a boot file URL like a boot plugin placed after bluefield.
+func addBootFile(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	if resp != nil {
+		resp.AddOption(dhcpv6.OptBootFileURL(bootFileURL))
+	}
+	return resp, false
+}
+
+func TestStop(t *testing.T) {
+	p := Init(t)
+	mac := net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+
+	// the ADVERTISE and the REPLY continue the chain, so that later plugins add
+	// their options
+	for _, msgType := range []dhcpv6.MessageType{dhcpv6.MessageTypeSolicit, dhcpv6.MessageTypeRequest} {
+		resp, run := runChain(request(t, mac, msgType), p.handleDHCPv6, addBootFile)
+		if run != 2 {
+			t.Errorf("expected %s to continue the chain, ran %d handlers", msgType, run)
+		}
+		if resp == nil {
+			t.Fatalf("no response returned for %s", msgType)
+		}
+		if iana := resp.(*dhcpv6.Message).Options.OneIANA(); iana == nil || iana.Options.OneAddress() == nil {
+			t.Errorf("expected the address of bluefield in the response to %s, got %v", msgType, resp)
+		}
+		if url := resp.(*dhcpv6.Message).Options.BootFileURL(); url != bootFileURL {
+			t.Errorf("expected the boot file URL of the next plugin in the response to %s, got %q", msgType, url)
+		}
+	}
+
+	// other messages are dropped and the chain stops
+	resp, run := runChain(request(t, mac, dhcpv6.MessageTypeRenew), p.handleDHCPv6, addBootFile)
+	if resp != nil || run != 1 {
+		t.Errorf("expected a RENEW to be dropped and the chain to stop, got %v after %d handlers", resp, run)
+	}
+}
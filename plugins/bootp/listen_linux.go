@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+
+package bootp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/sys/unix"
+)
+
+// listen opens a socket receiving the broadcasts to the server port on the
+// interface. It is bound to the broadcast address, so it shares the port with
+// the server's socket without taking over unicast requests, which the kernel
+// would otherwise balance between both.
+func listen(ifname string) (*ipv4.PacketConn, *net.Interface, error) {
+	ifi, err := net.InterfaceByName(ifname)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lc := net.ListenConfig{
+		Control: func(_, _ string, c syscall.RawConn) error {
+			var sockErr error
+			err := c.Control(func(fd uintptr) {
+				for _, opt := range []int{unix.SO_REUSEADDR, unix.SO_REUSEPORT, unix.SO_BROADCAST} {
+					if sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, opt, 1); sockErr != nil {
+						return
+					}
+				}
+				sockErr = unix.BindToDevice(int(fd), ifname)
+			})
+			if err != nil {
+				return err
+			}
+			return sockErr
+		},
+	}
+	conn, err := lc.ListenPacket(context.Background(), "udp4", fmt.Sprintf("%s:%d", net.IPv4bcast, dhcpv4.ServerPort))
+	if err != nil {
+		return nil, nil, err
+	}
+	return ipv4.NewPacketConn(conn), ifi, nil
+}
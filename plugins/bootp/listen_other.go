@@ -0,0 +1,18 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+//go:build !linux
+
+package bootp
+
+import (
+	"errors"
+	"net"
+
+	"golang.org/x/net/ipv4"
+)
+
+// listen fails, binding to an interface is only supported on Linux.
+func listen(string) (*ipv4.PacketConn, *net.Interface, error) {
+	return nil, nil, errors.New("BOOTP compatibility mode is only supported on Linux")
+}
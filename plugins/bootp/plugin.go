@@ -0,0 +1,275 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package bootp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/ipv4"
+)
+
+var log = logger.GetLogger("plugins/bootp")
+
+var Plugin = plugins.Plugin{
+	Name:   "bootp",
+	Setup4: setup4,
+}
+
+const (
+	// headerLen is the length of the fixed BOOTP header preceding the vendor area
+	headerLen = 236
+	// maxDatagram is the largest request read, BOOTP messages are 300 bytes
+	maxDatagram = 1 << 12
+)
+
+// magicCookie starts the vendor area of DHCP and RFC 1497 BOOTP messages.
+var magicCookie = []byte{99, 130, 83, 99}
+
+// reservation is a parsed static reservation.
+type reservation struct {
+	address    netip.Prefix
+	router     net.IP
+	dns        []net.IP
+	hostname   string
+	nextServer net.IP
+	bootfile   string
+}
+
+// plugin holds the state of a single bootp plugin instance. It is built once
+// in setup and never modified afterwards.
+type plugin struct {
+	interfaces   []string
+	reservations map[string]reservation
+	log          *logrus.Entry
+}
+
+// args[0] = path to config file
+func parseArgs(args ...string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("exactly one argument must be passed to the bootp plugin, got %d", len(args))
+	}
+	return args[0], nil
+}
+
+func loadConfig(args ...string) (*api.BootpConfig, error) {
+	path, err := parseArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	log.Debugf("Reading config file %s", path)
+	config := &api.BootpConfig{}
+	if err := api.Load(path, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func parseIPv4(field, value string) (net.IP, error) {
+	if value == "" {
+		return nil, nil
+	}
+	ip := net.ParseIP(value).To4()
+	if ip == nil {
+		return nil, fmt.Errorf("invalid %s %s, must be an IPv4 address", field, value)
+	}
+	return ip, nil
+}
+
+func parseReservation(config api.BootpReservation) (reservation, error) {
+	var r reservation
+	var err error
+	r.address, err = netip.ParsePrefix(config.Address)
+	if err != nil || !r.address.Addr().Is4() {
+		return r, fmt.Errorf("invalid address %s, must be an IPv4 address with prefix length", config.Address)
+	}
+	if r.router, err = parseIPv4("router", config.Router); err != nil {
+		return r, err
+	}
+	if r.nextServer, err = parseIPv4("nextServer", config.NextServer); err != nil {
+		return r, err
+	}
+	for _, server := range config.DNS {
+		ip, err := parseIPv4("DNS server", server)
+		if err != nil {
+			return r, err
+		}
+		r.dns = append(r.dns, ip)
+	}
+	r.hostname = config.Hostname
+	r.bootfile = config.Bootfile
+	return r, nil
+}
+
+func newPlugin(name string, args ...string) (*plugin, error) {
+	config, err := loadConfig(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(config.Interfaces) == 0 {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("at least one interface must be configured")}
+	}
+	p := &plugin{
+		interfaces:   config.Interfaces,
+		reservations: make(map[string]reservation, len(config.Reservations)),
+		log:          instance.Logger(log, name),
+	}
+	for _, config := range config.Reservations {
+		mac, err := net.ParseMAC(config.MACAddress)
+		if err != nil {
+			return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("invalid MAC address %s: %w", config.MACAddress, err)}
+		}
+		if _, ok := p.reservations[mac.String()]; ok {
+			return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("duplicate reservation for MAC address %s", mac)}
+		}
+		r, err := parseReservation(config)
+		if err != nil {
+			return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("reservation for %s: %w", mac, err)}
+		}
+		p.reservations[mac.String()] = r
+	}
+	return p, nil
+}
+
+func setup4(args ...string) (handler.Handler4, error) {
+	p, err := newPlugin("bootp/v4", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ifname := range p.interfaces {
+		conn, ifi, err := listen(ifname)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen for BOOTP requests on %s: %w", ifname, err)
+		}
+		go p.serve(conn, ifi)
+	}
+	p.log.Printf("Loaded bootp plugin for DHCPv4 answering %d reservations on %s.",
+		len(p.reservations), strings.Join(p.interfaces, ", "))
+	return p.handler4, nil
+}
+
+// handler4 passes DHCP requests on. BOOTP requests, which carry no DHCP
+// message type, are dropped by the server before the plugins run, so they are
+// answered by the listeners started in setup instead.
+func (p *plugin) handler4(_, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	return resp, false
+}
+
+// serve answers the BOOTP requests received on the interface until the
+// connection fails.
+func (p *plugin) serve(conn *ipv4.PacketConn, ifi *net.Interface) {
+	buf := make([]byte, maxDatagram)
+	for {
+		n, _, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			p.log.Errorf("Stopped answering BOOTP requests on %s: %v", ifi.Name, err)
+			return
+		}
+		req, err := parseRequest(buf[:n])
+		if err != nil {
+			p.log.Debugf("Ignoring malformed request on %s: %v", ifi.Name, err)
+			continue
+		}
+
+		resp := p.reply(req)
+		if resp == nil {
+			continue
+		}
+		server, err := interfaceAddress(ifi)
+		if err != nil {
+			p.log.Errorf("Could not answer BOOTP request on %s: %v", ifi.Name, err)
+			continue
+		}
+		if resp.ServerIPAddr.IsUnspecified() {
+			resp.ServerIPAddr = server
+		}
+		// the client has no address yet and may not answer ARP, RFC 951, section 4
+		dst := &net.UDPAddr{IP: net.IPv4bcast, Port: dhcpv4.ClientPort}
+		if _, err := conn.WriteTo(resp.ToBytes(), &ipv4.ControlMessage{Src: server, IfIndex: ifi.Index}, dst); err != nil {
+			p.log.Errorf("Could not send BOOTP reply to %s on %s: %v", req.ClientHWAddr, ifi.Name, err)
+			continue
+		}
+		p.log.Infof("Answered BOOTP request of %s on %s with %s", req.ClientHWAddr, ifi.Name, resp.YourIPAddr)
+	}
+}
+
+// parseRequest parses a BOOTP request. Unlike DHCP messages, plain RFC 951
+// requests lack the magic cookie, their vendor area is ignored.
+func parseRequest(data []byte) (*dhcpv4.DHCPv4, error) {
+	if len(data) < headerLen {
+		return nil, fmt.Errorf("request of %d bytes is shorter than the BOOTP header", len(data))
+	}
+	if len(data) < headerLen+len(magicCookie) || !bytes.Equal(data[headerLen:headerLen+len(magicCookie)], magicCookie) {
+		data = append(append(data[:headerLen:headerLen], magicCookie...), byte(dhcpv4.OptionEnd.Code()))
+	}
+	return dhcpv4.FromBytes(data)
+}
+
+// interfaceAddress returns the first IPv4 address of the interface, which
+// replies are sent from.
+func interfaceAddress(ifi *net.Interface) (net.IP, error) {
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+			return ipnet.IP.To4(), nil
+		}
+	}
+	return nil, errors.New("interface has no IPv4 address")
+}
+
+// reply returns the BOOTREPLY to a BOOTP request of a client with a reservation,
+// nil for DHCP requests and unknown clients. The next server is left unset
+// unless configured.
+func (p *plugin) reply(req *dhcpv4.DHCPv4) *dhcpv4.DHCPv4 {
+	if req.OpCode != dhcpv4.OpcodeBootRequest || req.Options.Has(dhcpv4.OptionDHCPMessageType) {
+		return nil
+	}
+	r, ok := p.reservations[req.ClientHWAddr.String()]
+	if !ok {
+		p.log.Debugf("No reservation for BOOTP client %s", req.ClientHWAddr)
+		return nil
+	}
+
+	resp, err := dhcpv4.NewReplyFromRequest(req)
+	if err != nil {
+		p.log.Errorf("Could not create BOOTP reply: %v", err)
+		return nil
+	}
+	resp.YourIPAddr = r.address.Addr().AsSlice()
+	if r.nextServer != nil {
+		resp.ServerIPAddr = r.nextServer
+	}
+	resp.BootFileName = r.bootfile
+
+	// RFC 1497 vendor extensions, clients not using them ignore the vendor area
+	resp.UpdateOption(dhcpv4.OptSubnetMask(net.CIDRMask(r.address.Bits(), 32)))
+	if r.router != nil {
+		resp.UpdateOption(dhcpv4.OptRouter(r.router))
+	}
+	if len(r.dns) > 0 {
+		resp.UpdateOption(dhcpv4.OptDNS(r.dns...))
+	}
+	if r.hostname != "" {
+		resp.UpdateOption(dhcpv4.OptHostName(r.hostname))
+	}
+	return resp
+}
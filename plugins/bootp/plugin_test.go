@@ -0,0 +1,157 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package bootp
+
+import (
+	"net"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/api/apitest"
+)
+
+var (
+	mac        = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+	unknownMac = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5f}
+
+	config = api.BootpConfig{
+		Interfaces: []string{"eth0"},
+		Reservations: []api.BootpReservation{
+			{
+				MACAddress: mac.String(),
+				Address:    "10.0.0.5/24",
+				Router:     "10.0.0.1",
+				DNS:        []string{"10.0.0.53"},
+				Hostname:   "bmc-1",
+				Bootfile:   "firmware.bin",
+			},
+		},
+	}
+)
+
+func Init(t *testing.T) *plugin {
+	p, err := newPlugin("bootp/test", apitest.WriteConfig(t, config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// bootpRequest returns a plain RFC 951 request without magic cookie.
+func bootpRequest(mac net.HardwareAddr) []byte {
+	req, _ := dhcpv4.New(dhcpv4.WithHwAddr(mac))
+	data := req.ToBytes()[:headerLen]
+	// pad the vendor area with zeroes as BOOTP clients do
+	return append(data, make([]byte, 64)...)
+}
+
+func TestWrongNumberArgs(t *testing.T) {
+	_, err := setup4()
+	if err == nil {
+		t.Fatal("no error occurred when not providing a configuration file path, but it should have")
+	}
+
+	_, err = setup4("foo", "bar")
+	if err == nil {
+		t.Fatal("no error occurred when providing wrong number of args (2), but it should have")
+	}
+}
+
+func TestWrongArgs(t *testing.T) {
+	reservation := config.Reservations[0]
+	withReservation := func(modify func(r *api.BootpReservation)) api.BootpConfig {
+		r := reservation
+		modify(&r)
+		return api.BootpConfig{Interfaces: []string{"eth0"}, Reservations: []api.BootpReservation{r}}
+	}
+
+	for _, config := range []api.BootpConfig{
+		{Reservations: []api.BootpReservation{reservation}},
+		withReservation(func(r *api.BootpReservation) { r.MACAddress = "foo" }),
+		withReservation(func(r *api.BootpReservation) { r.Address = "10.0.0.5" }),
+		withReservation(func(r *api.BootpReservation) { r.Address = "2001:db8::5/64" }),
+		withReservation(func(r *api.BootpReservation) { r.Router = "2001:db8::1" }),
+		withReservation(func(r *api.BootpReservation) { r.DNS = []string{"foo"} }),
+		{Interfaces: []string{"eth0"}, Reservations: []api.BootpReservation{reservation, reservation}},
+	} {
+		if _, err := newPlugin("bootp/test", apitest.WriteConfig(t, config)); err == nil {
+			t.Errorf("no error occurred for invalid config %+v, but it should have", config)
+		}
+	}
+}
+
+func TestParseRequest(t *testing.T) {
+	req, err := parseRequest(bootpRequest(mac))
+	if err != nil {
+		t.Fatalf("failed to parse BOOTP request without magic cookie: %v", err)
+	}
+	if req.OpCode != dhcpv4.OpcodeBootRequest || req.ClientHWAddr.String() != mac.String() {
+		t.Errorf("unexpected request %s", req.Summary())
+	}
+	if len(req.Options) != 0 {
+		t.Errorf("expected the vendor area to be ignored, got options %v", req.Options)
+	}
+
+	discover, _ := dhcpv4.NewDiscovery(mac)
+	req, err = parseRequest(discover.ToBytes())
+	if err != nil {
+		t.Fatalf("failed to parse DHCP request: %v", err)
+	}
+	if req.MessageType() != dhcpv4.MessageTypeDiscover {
+		t.Errorf("expected the options of a DHCP request to be kept, got message type %s", req.MessageType())
+	}
+
+	if _, err := parseRequest(make([]byte, headerLen-1)); err == nil {
+		t.Error("no error occurred for a truncated request, but it should have")
+	}
+}
+
+func TestReply(t *testing.T) {
+	p := Init(t)
+
+	req, _ := parseRequest(bootpRequest(mac))
+	resp := p.reply(req)
+	if resp == nil {
+		t.Fatal("expected a reply for a client with a reservation")
+	}
+	if resp.OpCode != dhcpv4.OpcodeBootReply || resp.TransactionID != req.TransactionID {
+		t.Errorf("unexpected reply %s", resp.Summary())
+	}
+	if resp.Options.Has(dhcpv4.OptionDHCPMessageType) {
+		t.Error("BOOTP reply must not carry a DHCP message type")
+	}
+	if !resp.YourIPAddr.Equal(net.IPv4(10, 0, 0, 5)) {
+		t.Errorf("expected address 10.0.0.5, got %s", resp.YourIPAddr)
+	}
+	if mask := resp.SubnetMask(); mask.String() != net.CIDRMask(24, 32).String() {
+		t.Errorf("expected subnet mask /24, got %s", mask)
+	}
+	if routers := resp.Router(); len(routers) != 1 || !routers[0].Equal(net.IPv4(10, 0, 0, 1)) {
+		t.Errorf("expected router 10.0.0.1, got %v", routers)
+	}
+	if dns := resp.DNS(); len(dns) != 1 || !dns[0].Equal(net.IPv4(10, 0, 0, 53)) {
+		t.Errorf("expected DNS server 10.0.0.53, got %v", dns)
+	}
+	if resp.HostName() != "bmc-1" || resp.BootFileName != "firmware.bin" {
+		t.Errorf("unexpected hostname %q or bootfile %q", resp.HostName(), resp.BootFileName)
+	}
+	if !resp.ServerIPAddr.IsUnspecified() {
+		t.Errorf("expected the next server to be left to the interface address, got %s", resp.ServerIPAddr)
+	}
+}
+
+func TestNoReply(t *testing.T) {
+	p := Init(t)
+
+	req, _ := parseRequest(bootpRequest(unknownMac))
+	if resp := p.reply(req); resp != nil {
+		t.Errorf("expected no reply for a client without reservation, got %s", resp.Summary())
+	}
+
+	discover, _ := dhcpv4.NewDiscovery(mac)
+	if resp := p.reply(discover); resp != nil {
+		t.Errorf("expected DHCP requests to be left to the server, got %s", resp.Summary())
+	}
+}
@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package bootparams
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"text/template"
+
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// macLabel selects the ConfigMap of a machine, its value is the MAC address in
+// lower case without separators, e.g. 001a2b3c4d5e
+const macLabel = "fedhcp.ironcore.dev/mac"
+
+func macKey(mac net.HardwareAddr) string {
+	return strings.ReplaceAll(strings.ToLower(mac.String()), ":", "")
+}
+
+// machine looks up the resources of a machine for the command line template.
+// Each resource is fetched at most once per request, and only if the template
+// refers to it.
+type machine struct {
+	namespace string
+	mac       net.HardwareAddr
+	server    map[string]interface{}
+	configMap *corev1.ConfigMap
+}
+
+// funcs returns the template functions of the machine.
+func (m *machine) funcs() template.FuncMap {
+	return template.FuncMap{
+		"mac":       func() string { return m.mac.String() },
+		"server":    m.serverField,
+		"configMap": m.configMapKey,
+	}
+}
+
+// serverField returns the field at the dot separated path of the metal-operator
+// Server having a network interface with the machine's MAC address.
+func (m *machine) serverField(path string) (string, error) {
+	if m.server == nil {
+		servers, err := kubernetes.ServersForMAC(context.Background(), m.mac)
+		if err != nil {
+			return "", fmt.Errorf("failed to look up servers: %w", err)
+		}
+		if len(servers) == 0 {
+			return "", fmt.Errorf("no server with MAC address %s", m.mac)
+		}
+		server, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&servers[0])
+		if err != nil {
+			return "", fmt.Errorf("failed to convert server %s: %w", servers[0].Name, err)
+		}
+		m.server = server
+	}
+
+	value, found, err := unstructured.NestedFieldNoCopy(m.server, strings.Split(path, ".")...)
+	if err != nil || !found {
+		return "", fmt.Errorf("server has no field %s", path)
+	}
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		return "", fmt.Errorf("server field %s is not a scalar", path)
+	}
+	return fmt.Sprint(value), nil
+}
+
+// configMapKey returns the value of a key of the machine's ConfigMap.
+func (m *machine) configMapKey(key string) (string, error) {
+	if m.configMap == nil {
+		configMaps, err := kubernetes.ConfigMapsForMAC(context.Background(), m.namespace, m.mac)
+		if err != nil {
+			return "", fmt.Errorf("failed to look up config maps: %w", err)
+		}
+		switch len(configMaps) {
+		case 0:
+			return "", fmt.Errorf("no config map labeled %s=%s", macLabel, macKey(m.mac))
+		case 1:
+			m.configMap = &configMaps[0]
+		default:
+			return "", fmt.Errorf("%d config maps labeled %s=%s", len(configMaps), macLabel, macKey(m.mac))
+		}
+	}
+
+	value, ok := m.configMap.Data[key]
+	if !ok {
+		return "", fmt.Errorf("config map %s has no key %s", m.configMap.Name, key)
+	}
+	return value, nil
+}
+
+// parseCmdLine parses the command line template, the functions are bound per
+// machine in cmdline.
+func parseCmdLine(text string) (*template.Template, error) {
+	return template.New("cmdline").Option("missingkey=error").Funcs((&machine{}).funcs()).Parse(text)
+}
+
+// cmdline renders the command line of the machine with the MAC address and
+// returns its parameters.
+func (p *plugin) cmdline(mac net.HardwareAddr) ([]string, error) {
+	tmpl, err := p.template.Clone()
+	if err != nil {
+		return nil, err
+	}
+	m := &machine{namespace: p.namespace, mac: mac}
+	var b strings.Builder
+	if err := tmpl.Funcs(m.funcs()).Execute(&b, nil); err != nil {
+		return nil, err
+	}
+	return strings.Fields(b.String()), nil
+}
@@ -0,0 +1,172 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package bootparams
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/admin"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/ironcore-dev/fedhcp/internal/responsecache"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var log = logger.GetLogger("plugins/bootparams")
+
+var Plugin = plugins.Plugin{
+	Name:   "bootparams",
+	Setup4: setup4,
+	Setup6: setup6,
+}
+
+// paramQuery is the query parameter of a DHCPv4 boot file URL carrying the
+// command line, as coredhcp's nbp plugin does
+const paramQuery = "param"
+
+// plugin holds the state of a single bootparams plugin instance.
+type plugin struct {
+	namespace     string
+	template      *template.Template
+	responseCache *responsecache.Cache[[]string]
+	log           *logrus.Entry
+}
+
+// args[0] = path to config file
+func parseArgs(args ...string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("exactly one argument must be passed to the bootparams plugin, got %d", len(args))
+	}
+	return args[0], nil
+}
+
+func loadConfig(args ...string) (*api.BootParamsConfig, error) {
+	path, err := parseArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	log.Debugf("Reading config file %s", path)
+	config := &api.BootParamsConfig{}
+	if err := api.Load(path, config); err != nil {
+		return nil, err
+	}
+
+	if errs := validation.IsDNS1123Label(config.Namespace); len(errs) > 0 {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("invalid namespace %q: %s", config.Namespace, strings.Join(errs, ", "))}
+	}
+	if strings.TrimSpace(config.CmdLine) == "" {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("cmdline must be configured")}
+	}
+	return config, nil
+}
+
+func newPlugin(name string, args ...string) (*plugin, error) {
+	config, err := loadConfig(args...)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := parseCmdLine(config.CmdLine)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("invalid cmdline template: %w", err)}
+	}
+
+	name = instance.Next(name)
+	p := &plugin{
+		namespace:     config.Namespace,
+		template:      tmpl,
+		responseCache: responsecache.New[[]string](name, responsecache.DefaultTTL),
+		log:           log.WithField("instance", name),
+	}
+	admin.State(name, func() any { return map[string]int{"responseCache": p.responseCache.Len()} })
+	return p, nil
+}
+
+func setup6(args ...string) (handler.Handler6, error) {
+	p, err := newPlugin("bootparams/v6", args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded bootparams plugin for DHCPv6 reading machines of %s.", p.namespace)
+	return p.handler6, nil
+}
+
+func setup4(args ...string) (handler.Handler4, error) {
+	p, err := newPlugin("bootparams/v4", args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded bootparams plugin for DHCPv4 reading machines of %s.", p.namespace)
+	return p.handler4, nil
+}
+
+func (p *plugin) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	reply, ok := resp.(*dhcpv6.Message)
+	if !ok || reply.Options.BootFileURL() == "" {
+		return resp, false
+	}
+
+	key, err := responsecache.Key6(req)
+	if err != nil {
+		p.log.Errorf("Could not derive cache key: %v", err)
+		return resp, false
+	}
+	params, ok := p.responseCache.Get(key)
+	if !ok {
+		mac, err := dhcpv6.ExtractMAC(req)
+		if err != nil {
+			p.log.Errorf("Could not determine MAC address of %s: %v", req.Summary(), err)
+			return resp, false
+		}
+		if params, err = p.cmdline(mac); err != nil {
+			p.log.Warningf("No boot file parameters for %s: %v", mac, err)
+		}
+		p.responseCache.Put(key, params)
+	}
+
+	if len(params) > 0 {
+		reply.UpdateOption(dhcpv6.OptBootFileParam(params...))
+		p.log.Debugf("Added option BootFileParam %v", params)
+	}
+	return resp, false
+}
+
+func (p *plugin) handler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	if resp == nil {
+		return resp, false
+	}
+	bootFileURL, err := url.Parse(resp.BootFileNameOption())
+	if err != nil || (bootFileURL.Scheme != "http" && bootFileURL.Scheme != "https") {
+		// DHCPv4 has no boot file parameter option, TFTP boot files get none
+		return resp, false
+	}
+
+	key := responsecache.Key4(req)
+	params, ok := p.responseCache.Get(key)
+	if !ok {
+		if params, err = p.cmdline(req.ClientHWAddr); err != nil {
+			p.log.Warningf("No boot file parameters for %s: %v", req.ClientHWAddr, err)
+		}
+		p.responseCache.Put(key, params)
+	}
+
+	if len(params) > 0 {
+		query := bootFileURL.Query()
+		query.Set(paramQuery, strings.Join(params, " "))
+		bootFileURL.RawQuery = query.Encode()
+		resp.UpdateOption(dhcpv4.OptBootFileName(bootFileURL.String()))
+		p.log.Debugf("Added boot file parameters %v", params)
+	}
+	return resp, false
+}
@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package bootparams
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/api/apitest"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes/fake"
+	metalv1alpha1 "github.com/ironcore-dev/metal-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	namespace = "metal"
+	cmdline   = `console=ttyS0 ironcore.uuid={{ server "spec.uuid" }} {{ configMap "cmdline" }}`
+)
+
+var (
+	mac     = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+	unknown = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5f}
+)
+
+// Init returns a plugin reading a fake client holding a server and a config map
+// of the machine with the MAC address mac.
+func Init(t *testing.T) *plugin {
+	var cl client.Client = fake.NewClient()
+	for _, obj := range []client.Object{
+		&metalv1alpha1.Server{
+			ObjectMeta: metav1.ObjectMeta{Name: "server1"},
+			Spec:       metalv1alpha1.ServerSpec{UUID: "38947555-7742-3448-3784-823347823834"},
+			Status: metalv1alpha1.ServerStatus{NetworkInterfaces: []metalv1alpha1.NetworkInterface{
+				{Name: "eth0", MACAddress: "00:1A:2B:3C:4D:5E"},
+			}},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "server1", Labels: map[string]string{macLabel: "001a2b3c4d5e"}},
+			Data:       map[string]string{"cmdline": "ignition.firstboot=1"},
+		},
+	} {
+		if err := cl.Create(context.Background(), obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	kubernetes.SetClient(&cl)
+	t.Cleanup(func() { kubernetes.SetClient(new(client.Client)) })
+
+	p, err := newPlugin("bootparams/test", apitest.WriteConfig(t, api.BootParamsConfig{Namespace: namespace, CmdLine: cmdline}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestWrongNumberArgs(t *testing.T) {
+	_, err := setup4()
+	if err == nil {
+		t.Fatal("no error occurred when not providing a configuration file path, but it should have")
+	}
+
+	_, err = setup6("foo", "bar")
+	if err == nil {
+		t.Fatal("no error occurred when providing wrong number of args (2), but it should have")
+	}
+}
+
+func TestWrongArgs(t *testing.T) {
+	for _, config := range []api.BootParamsConfig{
+		{CmdLine: cmdline},
+		{Namespace: namespace},
+		{Namespace: namespace, CmdLine: `{{ server "spec.uuid" `},
+		{Namespace: namespace, CmdLine: `{{ unknown "spec.uuid" }}`},
+	} {
+		if _, err := newPlugin("bootparams/test", apitest.WriteConfig(t, config)); err == nil {
+			t.Errorf("no error occurred for invalid config %+v, but it should have", config)
+		}
+	}
+}
+
+func TestCmdLine(t *testing.T) {
+	p := Init(t)
+
+	params, err := p.cmdline(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"console=ttyS0", "ironcore.uuid=38947555-7742-3448-3784-823347823834", "ignition.firstboot=1"}
+	if len(params) != len(expected) {
+		t.Fatalf("expected parameters %v, got %v", expected, params)
+	}
+	for i := range expected {
+		if params[i] != expected[i] {
+			t.Errorf("expected parameter %s, got %s", expected[i], params[i])
+		}
+	}
+
+	if _, err := p.cmdline(unknown); err == nil {
+		t.Error("no error occurred for a machine without resources, but it should have")
+	}
+}
+
+/* IPv6 */
+func TestBootFileParam6(t *testing.T) {
+	p := Init(t)
+
+	req, _ := dhcpv6.NewSolicit(mac)
+	resp, _ := dhcpv6.NewAdvertiseFromSolicit(req)
+	p.handler6(req, resp)
+	if params := resp.Options.BootFileParam(); len(params) != 0 {
+		t.Errorf("expected no parameters without boot file URL, got %v", params)
+	}
+
+	resp.AddOption(dhcpv6.OptBootFileURL("https://boot.example.org/boot.uki"))
+	p.handler6(req, resp)
+	if params := resp.Options.BootFileParam(); len(params) != 3 || params[2] != "ignition.firstboot=1" {
+		t.Errorf("expected the parameters of the machine, got %v", params)
+	}
+}
+
+/* IPv4 */
+func TestBootFileName4(t *testing.T) {
+	p := Init(t)
+
+	for hwAddr, expected := range map[string]string{
+		mac.String():     "console=ttyS0 ironcore.uuid=38947555-7742-3448-3784-823347823834 ignition.firstboot=1",
+		unknown.String(): "",
+	} {
+		hw, _ := net.ParseMAC(hwAddr)
+		req, _ := dhcpv4.NewDiscovery(hw)
+		resp, _ := dhcpv4.NewReplyFromRequest(req, dhcpv4.WithOption(dhcpv4.OptBootFileName("http://boot.example.org/ipxe")))
+		if _, stop := p.handler4(req, resp); stop {
+			t.Error("plugin must not break the chain")
+		}
+
+		bootFileURL, err := url.Parse(resp.BootFileNameOption())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if param := bootFileURL.Query().Get(paramQuery); param != expected {
+			t.Errorf("expected the parameters %q for %s, got %q", expected, hwAddr, param)
+		}
+	}
+}
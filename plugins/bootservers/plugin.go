@@ -0,0 +1,198 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package bootservers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/funnel"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logger.GetLogger("plugins/bootservers")
+
+var Plugin = plugins.Plugin{
+	Name:   "bootservers",
+	Setup4: setup4,
+}
+
+// PXE vendor options, see PXE specification 2.1, section 2.4.
+const (
+	subOptionDiscoveryControl = 6
+	subOptionBootServers      = 8
+	subOptionBootMenu         = 9
+	subOptionMenuPrompt       = 10
+	subOptionEnd              = 255
+
+	pxeClient  = "PXEClient"
+	httpClient = "HTTPClient"
+)
+
+// plugin holds the state of a single bootservers plugin instance. It is built
+// once in setup4 and never modified afterwards.
+type plugin struct {
+	// vendorOptions holds the encoded option 43 per client architecture
+	vendorOptions map[iana.Arch][]byte
+	log           *logrus.Entry
+}
+
+// args[0] = path to config file
+func parseArgs(args ...string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("exactly one argument must be passed to the bootservers plugin, got %d", len(args))
+	}
+	return args[0], nil
+}
+
+func loadConfig(args ...string) (*api.BootServersConfig, error) {
+	path, err := parseArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	log.Debugf("Reading config file %s", path)
+	config := &api.BootServersConfig{}
+	if err := api.Load(path, config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func setup4(args ...string) (handler.Handler4, error) {
+	config, err := loadConfig(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(config.Architectures) == 0 {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("no architectures configured")}
+	}
+
+	vendorOptions := make(map[iana.Arch][]byte, len(config.Architectures))
+	for _, arch := range config.Architectures {
+		if _, ok := vendorOptions[iana.Arch(arch.Arch)]; ok {
+			return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("architecture %d configured more than once", arch.Arch)}
+		}
+		data, err := encodeVendorOptions(arch)
+		if err != nil {
+			return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("architecture %d: %w", arch.Arch, err)}
+		}
+		vendorOptions[iana.Arch(arch.Arch)] = data
+	}
+
+	p := &plugin{
+		vendorOptions: vendorOptions,
+		log:           instance.Logger(log, "bootservers/v4"),
+	}
+	p.log.Printf("Loaded bootservers plugin for DHCPv4 with %d architecture(s).", len(vendorOptions))
+	return p.handler4, nil
+}
+
+// encodeVendorOptions encodes the PXE sub-options of option 43 for an architecture.
+func encodeVendorOptions(arch api.BootServerArchitecture) ([]byte, error) {
+	var servers, menu bytes.Buffer
+	for _, server := range arch.Servers {
+		if len(server.Addresses) == 0 || len(server.Addresses) > 255 {
+			return nil, fmt.Errorf("boot server type %d must have between 1 and 255 addresses", server.Type)
+		}
+		if len(server.Description) > 255 {
+			return nil, fmt.Errorf("description of boot server type %d is too long", server.Type)
+		}
+
+		_ = binary.Write(&servers, binary.BigEndian, server.Type)
+		servers.WriteByte(byte(len(server.Addresses)))
+		for _, address := range server.Addresses {
+			ip := net.ParseIP(address).To4()
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IPv4 address %s of boot server type %d", address, server.Type)
+			}
+			servers.Write(ip)
+		}
+
+		_ = binary.Write(&menu, binary.BigEndian, server.Type)
+		menu.WriteByte(byte(len(server.Description)))
+		menu.WriteString(server.Description)
+	}
+
+	var data bytes.Buffer
+	writeSubOption := func(code byte, value []byte) error {
+		if len(value) > 255 {
+			return fmt.Errorf("PXE sub-option %d exceeds 255 bytes", code)
+		}
+		data.WriteByte(code)
+		data.WriteByte(byte(len(value)))
+		data.Write(value)
+		return nil
+	}
+
+	if err := writeSubOption(subOptionDiscoveryControl, []byte{arch.DiscoveryControl}); err != nil {
+		return nil, err
+	}
+	if servers.Len() > 0 {
+		if err := writeSubOption(subOptionBootServers, servers.Bytes()); err != nil {
+			return nil, err
+		}
+		if err := writeSubOption(subOptionBootMenu, menu.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	if arch.MenuPrompt != "" {
+		if err := writeSubOption(subOptionMenuPrompt, append([]byte{arch.MenuTimeout}, arch.MenuPrompt...)); err != nil {
+			return nil, err
+		}
+	}
+	data.WriteByte(subOptionEnd)
+
+	if data.Len() > 255 {
+		return nil, fmt.Errorf("PXE vendor options exceed 255 bytes")
+	}
+	return data.Bytes(), nil
+}
+
+// pxeClass returns the PXE class the client identifies with, or "" for non-PXE clients.
+func pxeClass(req *dhcpv4.DHCPv4) string {
+	classID := req.ClassIdentifier()
+	switch {
+	case len(classID) >= len(pxeClient) && classID[:len(pxeClient)] == pxeClient:
+		return pxeClient
+	case len(classID) >= len(httpClient) && classID[:len(httpClient)] == httpClient:
+		return httpClient
+	default:
+		return ""
+	}
+}
+
+func (p *plugin) handler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	class := pxeClass(req)
+	if class == "" {
+		return resp, false
+	}
+
+	for _, arch := range req.ClientArch() {
+		data, ok := p.vendorOptions[arch]
+		if !ok {
+			continue
+		}
+		resp.UpdateOption(dhcpv4.OptClassIdentifier(class))
+		resp.UpdateOption(dhcpv4.OptGeneric(dhcpv4.OptionVendorSpecificInformation, data))
+		p.log.Debugf("Added PXE boot server list for architecture %s", arch)
+		funnel.Record(funnel.BootServed, req.ClientHWAddr)
+		return resp, false
+	}
+
+	p.log.Debugf("No PXE boot server list configured for architectures %v", req.ClientArch())
+	return resp, false
+}
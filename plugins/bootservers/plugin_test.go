@@ -0,0 +1,128 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package bootservers
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/api/apitest"
+)
+
+var testConfig = api.BootServersConfig{
+	Architectures: []api.BootServerArchitecture{{
+		Arch:             uint16(iana.EFI_X86_64),
+		DiscoveryControl: 7,
+		MenuPrompt:       "boot",
+		MenuTimeout:      5,
+		Servers: []api.BootServer{{
+			Type:        0x8000,
+			Description: "IronCore",
+			Addresses:   []string{"10.0.0.10", "10.0.0.11"},
+		}},
+	}},
+}
+
+func Init4(t *testing.T, config api.BootServersConfig) handler.Handler4 {
+	h, err := setup4(apitest.WriteConfig(t, config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func request4(t *testing.T, h handler.Handler4, modifiers ...dhcpv4.Modifier) *dhcpv4.DHCPv4 {
+	req, err := dhcpv4.NewDiscovery(net.HardwareAddr{0, 1, 2, 3, 4, 5}, modifiers...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub, err := dhcpv4.NewReplyFromRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, stop := h(req, stub)
+	if resp == nil {
+		t.Fatal("plugin did not return a message")
+	}
+	if stop {
+		t.Error("plugin interrupted processing, but it shouldn't have")
+	}
+	return resp
+}
+
+func TestWrongNumberArgs(t *testing.T) {
+	_, err := setup4()
+	if err == nil {
+		t.Fatal("no error occurred when not providing a configuration file path, but it should have")
+	}
+
+	_, err = setup4("foo", "bar")
+	if err == nil {
+		t.Fatal("no error occurred when providing wrong number of args (2), but it should have")
+	}
+}
+
+func TestWrongArgs(t *testing.T) {
+	for _, config := range []api.BootServersConfig{
+		{},
+		{Architectures: []api.BootServerArchitecture{{Arch: 7}, {Arch: 7}}},
+		{Architectures: []api.BootServerArchitecture{{Servers: []api.BootServer{{Type: 1}}}}},
+		{Architectures: []api.BootServerArchitecture{{Servers: []api.BootServer{{Type: 1, Addresses: []string{"2001:db8::1"}}}}}},
+	} {
+		if _, err := setup4(apitest.WriteConfig(t, config)); err == nil {
+			t.Fatalf("no error occurred for invalid config %+v, but it should have", config)
+		}
+	}
+}
+
+/* IPv4 */
+func TestBootServersAdded4(t *testing.T) {
+	h := Init4(t, testConfig)
+
+	resp := request4(t, h,
+		dhcpv4.WithOption(dhcpv4.OptClassIdentifier("PXEClient:Arch:00007:UNDI:003016")),
+		dhcpv4.WithOption(dhcpv4.OptClientArch(iana.EFI_X86_64)))
+
+	if class := resp.ClassIdentifier(); class != pxeClient {
+		t.Errorf("expected class identifier %s, got %s", pxeClient, class)
+	}
+	expected := []byte{
+		6, 1, 7, // discovery control
+		8, 11, 0x80, 0x00, 2, 10, 0, 0, 10, 10, 0, 0, 11, // boot servers
+		9, 11, 0x80, 0x00, 8, 'I', 'r', 'o', 'n', 'C', 'o', 'r', 'e', // boot menu
+		10, 5, 5, 'b', 'o', 'o', 't', // menu prompt
+		255,
+	}
+	if data := resp.Options.Get(dhcpv4.OptionVendorSpecificInformation); !bytes.Equal(data, expected) {
+		t.Errorf("expected vendor options %v, got %v", expected, data)
+	}
+}
+
+func TestOtherArchitecture4(t *testing.T) {
+	h := Init4(t, testConfig)
+
+	resp := request4(t, h,
+		dhcpv4.WithOption(dhcpv4.OptClassIdentifier("PXEClient:Arch:00000:UNDI:002001")),
+		dhcpv4.WithOption(dhcpv4.OptClientArch(iana.INTEL_X86PC)))
+
+	if data := resp.Options.Get(dhcpv4.OptionVendorSpecificInformation); data != nil {
+		t.Errorf("expected no vendor options, got %v", data)
+	}
+}
+
+func TestNonPXEClient4(t *testing.T) {
+	h := Init4(t, testConfig)
+
+	resp := request4(t, h, dhcpv4.WithOption(dhcpv4.OptClientArch(iana.EFI_X86_64)))
+
+	if data := resp.Options.Get(dhcpv4.OptionVendorSpecificInformation); data != nil {
+		t.Errorf("expected no vendor options, got %v", data)
+	}
+}
@@ -0,0 +1,356 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package canary
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+
+	"github.com/coredhcp/coredhcp/config"
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/ironcore-dev/fedhcp/internal/metrics"
+	"github.com/ironcore-dev/fedhcp/internal/response"
+	"github.com/ironcore-dev/fedhcp/internal/sideeffects"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logger.GetLogger("plugins/canary")
+
+const pluginName = "canary"
+
+var Plugin = plugins.Plugin{
+	Name:   pluginName,
+	Setup4: setup4,
+	Setup6: setup6,
+}
+
+const (
+	resultMatch    = "match"
+	resultMismatch = "mismatch"
+	// resultSkipped counts the responses not compared, as maxComparisons
+	// comparisons were running already
+	resultSkipped = "skipped"
+)
+
+// maxComparisons bounds the comparisons running at once per plugin instance.
+const maxComparisons = 16
+
+var (
+	comparisons = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "canary",
+		Name:      "comparisons_total",
+		Help:      "Number of responses compared with the candidate chain, by result (match, mismatch, skipped).",
+	}, []string{"instance", "result"})
+	differences = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "canary",
+		Name:      "differences_total",
+		Help:      "Number of differences between the active and the candidate chain, by response field or option.",
+	}, []string{"instance", "field"})
+)
+
+// plugin6 holds the candidate DHCPv6 chain of a canary plugin instance. It is
+// built once in setup6 and never modified afterwards.
+type plugin6 struct {
+	name     string
+	handlers []handler.Handler6
+	// slots bounds the comparisons running at once
+	slots chan struct{}
+	log   *logrus.Entry
+}
+
+// plugin4 holds the candidate DHCPv4 chain of a canary plugin instance. It is
+// built once in setup4 and never modified afterwards.
+type plugin4 struct {
+	name     string
+	handlers []handler.Handler4
+	// slots bounds the comparisons running at once
+	slots chan struct{}
+	log   *logrus.Entry
+}
+
+// args[0] = path to the candidate coredhcp config file
+func parseArgs(args ...string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("exactly one argument must be passed to the canary plugin, got %d", len(args))
+	}
+	return args[0], nil
+}
+
+func loadConfig(args ...string) (*config.Config, error) {
+	path, err := parseArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	log.Debugf("Reading candidate config file %s", path)
+	conf, err := config.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load candidate config: %w", err)
+	}
+
+	for _, server := range []*config.ServerConfig{conf.Server4, conf.Server6} {
+		if server == nil {
+			continue
+		}
+		for _, p := range server.Plugins {
+			if p.Name == pluginName {
+				return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("candidate config must not contain the canary plugin")}
+			}
+		}
+	}
+	// the candidate chain runs on live requests, its side effects would be real
+	if names := sideeffects.Of(conf); len(names) > 0 {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("candidate config must not contain plugins with side effects, got %v", names)}
+	}
+
+	metrics.Register(comparisons, differences)
+	return conf, nil
+}
+
+func setup6(args ...string) (handler.Handler6, error) {
+	conf, err := loadConfig(args...)
+	if err != nil {
+		return nil, err
+	}
+	if conf.Server6 == nil {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("candidate config has no DHCPv6 server")}
+	}
+
+	// load the DHCPv6 chain only
+	candidate := *conf
+	candidate.Server4 = nil
+	_, handlers, err := plugins.LoadPlugins(&candidate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load candidate DHCPv6 plugins: %w", err)
+	}
+
+	name := instance.Next("canary/v6")
+	p := &plugin6{
+		name:     name,
+		handlers: handlers,
+		slots:    make(chan struct{}, maxComparisons),
+		log:      log.WithField("instance", name),
+	}
+	p.log.Printf("Loaded canary plugin for DHCPv6 with %d candidate plugin(s).", len(handlers))
+	return p.handler6, nil
+}
+
+func setup4(args ...string) (handler.Handler4, error) {
+	conf, err := loadConfig(args...)
+	if err != nil {
+		return nil, err
+	}
+	if conf.Server4 == nil {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("candidate config has no DHCPv4 server")}
+	}
+
+	// load the DHCPv4 chain only
+	candidate := *conf
+	candidate.Server6 = nil
+	handlers, _, err := plugins.LoadPlugins(&candidate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load candidate DHCPv4 plugins: %w", err)
+	}
+
+	name := instance.Next("canary/v4")
+	p := &plugin4{
+		name:     name,
+		handlers: handlers,
+		slots:    make(chan struct{}, maxComparisons),
+		log:      log.WithField("instance", name),
+	}
+	p.log.Printf("Loaded canary plugin for DHCPv4 with %d candidate plugin(s).", len(handlers))
+	return p.handler4, nil
+}
+
+// compare runs the comparison in the background if a slot is free, and
+// counts it as skipped otherwise, so a slow candidate chain cannot pile up
+// goroutines.
+func compare(name string, slots chan struct{}, comparison func()) {
+	select {
+	case slots <- struct{}{}:
+	default:
+		comparisons.WithLabelValues(name, resultSkipped).Inc()
+		return
+	}
+	go func() {
+		defer func() { <-slots }()
+		comparison()
+	}()
+}
+
+// record counts and logs the differences of a comparison.
+func record(name string, l *logrus.Entry, diffs []string) {
+	if len(diffs) == 0 {
+		comparisons.WithLabelValues(name, resultMatch).Inc()
+		return
+	}
+	comparisons.WithLabelValues(name, resultMismatch).Inc()
+	for _, field := range diffs {
+		differences.WithLabelValues(name, field).Inc()
+	}
+	l.Infof("Candidate response differs in %v", diffs)
+}
+
+func (p *plugin6) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	msg, err := req.GetInnerMessage()
+	if err != nil {
+		p.log.Errorf("BUG: could not decapsulate: %v", err)
+		return resp, false
+	}
+
+	// the active response is sent once we return, so compare against a copy
+	var active *dhcpv6.Message
+	if resp != nil {
+		if active, err = dhcpv6.MessageFromBytes(resp.ToBytes()); err != nil {
+			p.log.Errorf("Could not copy response: %v", err)
+			return resp, false
+		}
+	}
+
+	compare(p.name, p.slots, func() {
+		record(p.name, p.log, compare6(active, p.run(req, msg)))
+	})
+	return resp, false
+}
+
+// run computes the response of the candidate chain, the same way the server does.
+func (p *plugin6) run(req dhcpv6.DHCPv6, msg *dhcpv6.Message) *dhcpv6.Message {
+	stub, err := response.Stub6(msg)
+	if err != nil {
+		return nil
+	}
+	var resp dhcpv6.DHCPv6 = stub
+
+	for _, h := range p.handlers {
+		var stop bool
+		if resp, stop = h(req, resp); stop {
+			break
+		}
+	}
+	if resp == nil {
+		return nil
+	}
+	m, _ := resp.(*dhcpv6.Message)
+	return m
+}
+
+func (p *plugin4) handler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	// the active response is sent once we return, so compare against a copy
+	var active *dhcpv4.DHCPv4
+	if resp != nil {
+		var err error
+		if active, err = dhcpv4.FromBytes(resp.ToBytes()); err != nil {
+			p.log.Errorf("Could not copy response: %v", err)
+			return resp, false
+		}
+	}
+
+	compare(p.name, p.slots, func() {
+		record(p.name, p.log, compare4(active, p.run(req)))
+	})
+	return resp, false
+}
+
+// run computes the response of the candidate chain, the same way the server does.
+func (p *plugin4) run(req *dhcpv4.DHCPv4) *dhcpv4.DHCPv4 {
+	resp, err := dhcpv4.NewReplyFromRequest(req)
+	if err != nil {
+		return nil
+	}
+	switch req.MessageType() {
+	case dhcpv4.MessageTypeDiscover:
+		resp.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeOffer))
+	case dhcpv4.MessageTypeRequest:
+		resp.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeAck))
+	default:
+		return nil
+	}
+
+	for _, h := range p.handlers {
+		var stop bool
+		if resp, stop = h(req, resp); stop {
+			break
+		}
+	}
+	return resp
+}
+
+// compare6 returns the fields in which the responses differ, "response" if
+// only one of them is dropped.
+func compare6(active, candidate *dhcpv6.Message) []string {
+	if active == nil || candidate == nil {
+		if active != candidate {
+			return []string{"response"}
+		}
+		return nil
+	}
+
+	var diffs []string
+	if active.MessageType != candidate.MessageType {
+		diffs = append(diffs, "messageType")
+	}
+	codes := make(map[dhcpv6.OptionCode]bool)
+	for _, opt := range active.Options.Options {
+		codes[opt.Code()] = true
+	}
+	for _, opt := range candidate.Options.Options {
+		codes[opt.Code()] = true
+	}
+	for code := range codes {
+		if !slices.EqualFunc(active.GetOption(code), candidate.GetOption(code), func(a, b dhcpv6.Option) bool {
+			return bytes.Equal(a.ToBytes(), b.ToBytes())
+		}) {
+			diffs = append(diffs, fmt.Sprintf("option-%d", code))
+		}
+	}
+	slices.Sort(diffs)
+	return diffs
+}
+
+// compare4 returns the fields in which the responses differ, "response" if
+// only one of them is dropped.
+func compare4(active, candidate *dhcpv4.DHCPv4) []string {
+	if active == nil || candidate == nil {
+		if active != candidate {
+			return []string{"response"}
+		}
+		return nil
+	}
+
+	var diffs []string
+	if !active.YourIPAddr.Equal(candidate.YourIPAddr) {
+		diffs = append(diffs, "yiaddr")
+	}
+	if !active.ServerIPAddr.Equal(candidate.ServerIPAddr) {
+		diffs = append(diffs, "siaddr")
+	}
+	if active.BootFileName != candidate.BootFileName {
+		diffs = append(diffs, "file")
+	}
+	codes := make(map[uint8]bool)
+	for code := range active.Options {
+		codes[code] = true
+	}
+	for code := range candidate.Options {
+		codes[code] = true
+	}
+	for code := range codes {
+		if !bytes.Equal(active.Options[code], candidate.Options[code]) {
+			diffs = append(diffs, fmt.Sprintf("option-%d", code))
+		}
+	}
+	slices.Sort(diffs)
+	return diffs
+}
@@ -0,0 +1,213 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package canary
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var (
+	activeIP    = net.IPv4(192, 168, 0, 1)
+	candidateIP = net.IPv4(192, 168, 0, 2)
+	bootURL     = "http://[2001:db8::1]/boot.efi"
+)
+
+// leasePlugin leases the address given as argument, or the boot file URL for DHCPv6.
+var leasePlugin = plugins.Plugin{
+	Name: "canarytest",
+	Setup4: func(args ...string) (handler.Handler4, error) {
+		ip := net.ParseIP(args[0])
+		return func(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+			resp.YourIPAddr = ip
+			return resp, false
+		}, nil
+	},
+	Setup6: func(args ...string) (handler.Handler6, error) {
+		return func(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+			resp.AddOption(dhcpv6.OptBootFileURL(args[0]))
+			return resp, false
+		}, nil
+	},
+}
+
+func init() {
+	_ = plugins.RegisterPlugin(&leasePlugin)
+}
+
+func writeConfig(t *testing.T, data string) string {
+	path := filepath.Join(t.TempDir(), "candidate.yaml")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func candidateConfig(t *testing.T) string {
+	return writeConfig(t, `
+server4:
+  plugins:
+    - canarytest: `+candidateIP.String()+`
+server6:
+  plugins:
+    - canarytest: `+bootURL+`
+`)
+}
+
+func TestWrongNumberArgs(t *testing.T) {
+	_, err := setup4()
+	if err == nil {
+		t.Fatal("no error occurred when not providing a configuration file path, but it should have")
+	}
+
+	_, err = setup6("foo", "bar")
+	if err == nil {
+		t.Fatal("no error occurred when providing wrong number of args (2), but it should have")
+	}
+}
+
+func TestWrongArgs(t *testing.T) {
+	recursive := writeConfig(t, `
+server4:
+  plugins:
+    - canary: foo
+`)
+	if _, err := setup4(recursive); err == nil {
+		t.Fatal("no error occurred for a candidate config containing the canary plugin, but it should have")
+	}
+	if _, err := setup6(recursive); err == nil {
+		t.Fatal("no error occurred for a candidate config without DHCPv6 server, but it should have")
+	}
+	if _, err := setup4("does-not-exist.yaml"); err == nil {
+		t.Fatal("no error occurred for a missing candidate config, but it should have")
+	}
+	writing := writeConfig(t, `
+server4:
+  plugins:
+    - oob: oob_config.yaml
+`)
+	if _, err := setup4(writing); err == nil {
+		t.Fatal("no error occurred for a candidate config with side effects, but it should have")
+	}
+}
+
+func TestComparisonsBounded(t *testing.T) {
+	slots := make(chan struct{}, 1)
+	block, done := make(chan struct{}), make(chan struct{})
+	compare("canary/bounded", slots, func() {
+		<-block
+		close(done)
+	})
+	compare("canary/bounded", slots, func() {
+		t.Error("comparison ran although no slot was free")
+	})
+	if skipped := testutil.ToFloat64(comparisons.WithLabelValues("canary/bounded", resultSkipped)); skipped != 1 {
+		t.Errorf("expected 1 skipped comparison, got %v", skipped)
+	}
+
+	close(block)
+	<-done
+	// the slot is freed once the comparison returned
+	for i := 0; i < 100 && len(slots) > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(slots) != 0 {
+		t.Error("expected the slot to be freed")
+	}
+}
+
+/* IPv6 */
+func TestCandidateCompared6(t *testing.T) {
+	h, err := setup6(candidateConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.MessageType = dhcpv6.MessageTypeRequest
+	req.AddOption(dhcpv6.OptClientID(&dhcpv6.DUIDLL{HWType: iana.HWTypeEthernet, LinkLayerAddr: net.HardwareAddr{0, 1, 2, 3, 4, 5}}))
+	stub, err := dhcpv6.NewReplyFromMessage(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, stop := h(req, stub)
+	if resp != stub || stop {
+		t.Fatal("plugin modified the active response or chain, but it shouldn't have")
+	}
+	if resp.GetOneOption(dhcpv6.OptionBootfileURL) != nil {
+		t.Error("candidate chain leaked into the active response")
+	}
+
+	active, _ := dhcpv6.MessageFromBytes(stub.ToBytes())
+	withBootFile, _ := dhcpv6.MessageFromBytes(stub.ToBytes())
+	withBootFile.AddOption(dhcpv6.OptBootFileURL(bootURL))
+	if diffs := compare6(active, withBootFile); !slices.Equal(diffs, []string{"option-59"}) {
+		t.Errorf("expected a difference in the boot file URL, got %v", diffs)
+	}
+	if diffs := compare6(withBootFile, withBootFile); len(diffs) != 0 {
+		t.Errorf("expected no differences, got %v", diffs)
+	}
+	if diffs := compare6(active, nil); !slices.Equal(diffs, []string{"response"}) {
+		t.Errorf("expected a dropped response, got %v", diffs)
+	}
+}
+
+/* IPv4 */
+func TestCandidateCompared4(t *testing.T) {
+	h, err := setup4(candidateConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := dhcpv4.NewDiscovery(net.HardwareAddr{0, 1, 2, 3, 4, 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub, err := dhcpv4.NewReplyFromRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeOffer))
+	stub.YourIPAddr = activeIP
+
+	resp, stop := h(req, stub)
+	if resp != stub || stop {
+		t.Fatal("plugin modified the active response or chain, but it shouldn't have")
+	}
+	if !resp.YourIPAddr.Equal(activeIP) {
+		t.Errorf("candidate chain leaked into the active response: %s", resp.YourIPAddr)
+	}
+
+	// the comparison runs in the background
+	mismatch := differences.WithLabelValues("canary/v4#1", "yiaddr")
+	for i := 0; i < 100 && testutil.ToFloat64(mismatch) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if testutil.ToFloat64(mismatch) != 1 {
+		t.Errorf("expected a difference in yiaddr to be counted, got %v", testutil.ToFloat64(mismatch))
+	}
+
+	candidate, _ := dhcpv4.FromBytes(stub.ToBytes())
+	if diffs := compare4(stub, candidate); len(diffs) != 0 {
+		t.Errorf("expected no differences, got %v", diffs)
+	}
+	candidate.UpdateOption(dhcpv4.OptBootFileName(bootURL))
+	if diffs := compare4(stub, candidate); !slices.Equal(diffs, []string{"option-67"}) {
+		t.Errorf("expected a difference in the boot file name, got %v", diffs)
+	}
+}
@@ -0,0 +1,232 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package captiveportal
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"slices"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/fingerprint"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/ironcore-dev/fedhcp/internal/subnetmatch"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logger.GetLogger("plugins/captiveportal")
+
+var Plugin = plugins.Plugin{
+	Name:   "captiveportal",
+	Setup4: setup4,
+	Setup6: setup6,
+}
+
+// unrestricted tells clients there is no captive portal, RFC 8910 section 2
+const unrestricted = "urn:ietf:params:capport:unrestricted"
+
+// rule is a parsed captive portal rule.
+type rule struct {
+	name    string
+	subnets []netip.Prefix
+	classes []fingerprint.Class
+	url     string
+}
+
+// plugin holds the state of a single captiveportal plugin instance. It is built
+// once in setup and never modified afterwards.
+type plugin struct {
+	defaults *rule
+	rules    []rule
+	// classify is set if a rule matches classes, the clients are only
+	// classified then
+	classify bool
+	log      *logrus.Entry
+}
+
+// args[0] = path to config file
+func parseArgs(args ...string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("exactly one argument must be passed to the captiveportal plugin, got %d", len(args))
+	}
+	return args[0], nil
+}
+
+func loadConfig(args ...string) (*api.CaptivePortalConfig, error) {
+	path, err := parseArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	log.Debugf("Reading config file %s", path)
+	config := &api.CaptivePortalConfig{}
+	if err := api.Load(path, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// parseURL validates a captive portal API URI, which has to be an HTTPS URL
+// (RFC 8908 section 2), or the URN telling there is none.
+func parseURL(value string) error {
+	if value == unrestricted {
+		return nil
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("invalid URL %s: %w", value, err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("invalid URL %s: should be an https URL or %s", value, unrestricted)
+	}
+	return nil
+}
+
+func newPlugin(name string, args ...string) (*plugin, error) {
+	config, err := loadConfig(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(config.Rules) == 0 && config.Default == "" {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("at least one rule or a default must be configured")}
+	}
+	p := &plugin{log: instance.Logger(log, name)}
+	if config.Default != "" {
+		if err := parseURL(config.Default); err != nil {
+			return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("default: %w", err)}
+		}
+		p.defaults = &rule{name: "default", url: config.Default}
+	}
+
+	for i, r := range config.Rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i)
+		}
+		if len(r.Subnets) == 0 && len(r.Classes) == 0 {
+			return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("%s: at least one subnet or class must be configured", r.Name)}
+		}
+		if err := parseURL(r.URL); err != nil {
+			return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("%s: %w", r.Name, err)}
+		}
+
+		parsed := rule{name: r.Name, url: r.URL}
+		for _, subnet := range r.Subnets {
+			prefix, err := subnetmatch.ParsePrefix(subnet)
+			if err != nil {
+				return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("%s: invalid subnet %s: %w", r.Name, subnet, err)}
+			}
+			parsed.subnets = append(parsed.subnets, prefix)
+		}
+		for _, class := range r.Classes {
+			if !slices.Contains(fingerprint.Classes, fingerprint.Class(class)) {
+				return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("%s: unknown class %s, should be one of %v", r.Name, class, fingerprint.Classes)}
+			}
+			parsed.classes = append(parsed.classes, fingerprint.Class(class))
+			p.classify = true
+		}
+		p.rules = append(p.rules, parsed)
+	}
+	return p, nil
+}
+
+func setup6(args ...string) (handler.Handler6, error) {
+	p, err := newPlugin("captiveportal/v6", args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded captiveportal plugin for DHCPv6 with %d rules.", len(p.rules))
+	return p.handler6, nil
+}
+
+func setup4(args ...string) (handler.Handler4, error) {
+	p, err := newPlugin("captiveportal/v4", args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded captiveportal plugin for DHCPv4 with %d rules.", len(p.rules))
+	return p.handler4, nil
+}
+
+func (r *rule) matches(addr net.IP, class fingerprint.Class) bool {
+	if len(r.classes) > 0 && !slices.Contains(r.classes, class) {
+		return false
+	}
+	if len(r.subnets) > 0 {
+		return slices.ContainsFunc(r.subnets, func(subnet netip.Prefix) bool {
+			return subnetmatch.Contains(subnet, addr)
+		})
+	}
+	return true
+}
+
+// match returns the first rule matching the client, or the defaults, which
+// may be nil. The class is only computed if needed.
+func (p *plugin) match(addr net.IP, class func() fingerprint.Class) *rule {
+	var c fingerprint.Class
+	if p.classify {
+		c = class()
+	}
+	for i := range p.rules {
+		if p.rules[i].matches(addr, c) {
+			return &p.rules[i]
+		}
+	}
+	return p.defaults
+}
+
+func (p *plugin) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	reply, ok := resp.(*dhcpv6.Message)
+	if !ok {
+		p.log.Errorf("Unexpected response type %T", resp)
+		return resp, false
+	}
+
+	addr := subnetmatch.Leased6(reply)
+	if addr == nil && req.IsRelay() {
+		if inner, err := dhcpv6.DecapsulateRelayIndex(req, -1); err == nil {
+			addr = inner.(*dhcpv6.RelayMessage).LinkAddr
+		}
+	}
+	r := p.match(addr, func() fingerprint.Class {
+		result, err := fingerprint.Classify6(req)
+		if err != nil {
+			return fingerprint.ClassUnknown
+		}
+		return result.Class
+	})
+	if r == nil {
+		return resp, false
+	}
+
+	reply.UpdateOption(&dhcpv6.OptionGeneric{OptionCode: dhcpv6.OptionCaptivePortal, OptionData: []byte(r.url)})
+	p.log.Debugf("Added captive portal URL of %s for %s", r.name, req.Summary())
+	return resp, false
+}
+
+func (p *plugin) handler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	addr := resp.YourIPAddr
+	if addr == nil || addr.IsUnspecified() {
+		addr = req.GatewayIPAddr
+	}
+	r := p.match(addr, func() fingerprint.Class {
+		return fingerprint.Classify4(req).Class
+	})
+	if r == nil {
+		return resp, false
+	}
+
+	// the dhcp library names option 114 after its obsoleted RFC 3679 use
+	resp.UpdateOption(dhcpv4.OptGeneric(dhcpv4.OptionURL, []byte(r.url)))
+	p.log.Debugf("Added captive portal URL of %s for %s", r.name, req.ClientHWAddr)
+	return resp, false
+}
@@ -0,0 +1,180 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package captiveportal
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/api/apitest"
+)
+
+const (
+	guestURL = "https://portal.guest.example.com/api/capport"
+	labURL   = "https://portal.lab.example.com/api/capport"
+)
+
+var (
+	mac = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+
+	config = api.CaptivePortalConfig{
+		Default: unrestricted,
+		Rules: []api.CaptivePortalRule{
+			{
+				Name:    "guests",
+				Subnets: []string{"10.20.0.0/16", "2001:db8:20::/48"},
+				URL:     guestURL,
+			},
+			{
+				Name:    "lab-switches",
+				Classes: []string{"switch"},
+				URL:     labURL,
+			},
+		},
+	}
+)
+
+func TestWrongNumberArgs(t *testing.T) {
+	_, err := setup4()
+	if err == nil {
+		t.Fatal("no error occurred when not providing a configuration file path, but it should have")
+	}
+
+	_, err = setup6("foo", "bar")
+	if err == nil {
+		t.Fatal("no error occurred when providing wrong number of args (2), but it should have")
+	}
+}
+
+func TestWrongArgs(t *testing.T) {
+	for _, config := range []api.CaptivePortalConfig{
+		{},
+		{Default: "http://portal.example.com/api"},
+		{Default: "https:///api"},
+		{Rules: []api.CaptivePortalRule{{Name: "any", URL: guestURL}}},
+		{Rules: []api.CaptivePortalRule{{Subnets: []string{"10.0.0.0/33"}, URL: guestURL}}},
+		{Rules: []api.CaptivePortalRule{{Classes: []string{"toaster"}, URL: guestURL}}},
+		{Rules: []api.CaptivePortalRule{{Subnets: []string{"10.0.0.0/8"}}}},
+	} {
+		if _, err := setup4(apitest.WriteConfig(t, config)); err == nil {
+			t.Fatalf("no error occurred when providing config %+v, but it should have", config)
+		}
+	}
+}
+
+/* IPv6 */
+func newReply6(t *testing.T, vendorClass string, addr string) (*dhcpv6.Message, *dhcpv6.Message) {
+	req, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.MessageType = dhcpv6.MessageTypeRequest
+	req.AddOption(dhcpv6.OptClientID(&dhcpv6.DUIDLL{HWType: 1, LinkLayerAddr: mac}))
+	if vendorClass != "" {
+		req.AddOption(&dhcpv6.OptVendorClass{EnterpriseNumber: 343, Data: [][]byte{[]byte(vendorClass)}})
+	}
+	resp, err := dhcpv6.NewReplyFromMessage(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.AddOption(&dhcpv6.OptIANA{
+		IaId: [4]byte{0, 0, 0, 1},
+		Options: dhcpv6.IdentityOptions{Options: dhcpv6.Options{
+			&dhcpv6.OptIAAddress{IPv6Addr: net.ParseIP(addr), ValidLifetime: time.Hour, PreferredLifetime: time.Hour},
+		}},
+	})
+	return req, resp
+}
+
+func TestCaptivePortal6(t *testing.T) {
+	handler, err := setup6(apitest.WriteConfig(t, config))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		vendorClass, addr, expected string
+	}{
+		{"", "2001:db8:20::10", guestURL},
+		{"SONiC-ZTP", "2001:db8:2::10", labURL},
+		{"", "2001:db8:2::10", unrestricted},
+	} {
+		req, resp := newReply6(t, tc.vendorClass, tc.addr)
+		result, stop := handler(req, resp)
+		if stop {
+			t.Fatal("captiveportal must not stop the chain")
+		}
+
+		opt := result.(*dhcpv6.Message).GetOneOption(dhcpv6.OptionCaptivePortal)
+		if opt == nil || string(opt.ToBytes()) != tc.expected {
+			t.Errorf("expected captive portal URL %s for %s, got %v", tc.expected, tc.addr, opt)
+		}
+	}
+}
+
+/* IPv4 */
+func newReply4(t *testing.T, vendorClass string, addr string) (*dhcpv4.DHCPv4, *dhcpv4.DHCPv4) {
+	req, err := dhcpv4.NewDiscovery(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vendorClass != "" {
+		req.UpdateOption(dhcpv4.OptClassIdentifier(vendorClass))
+	}
+	resp, err := dhcpv4.NewReplyFromRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.YourIPAddr = net.ParseIP(addr)
+	return req, resp
+}
+
+func TestCaptivePortal4(t *testing.T) {
+	handler, err := setup4(apitest.WriteConfig(t, config))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		vendorClass, addr, expected string
+	}{
+		{"", "10.20.2.3", guestURL},
+		{"Arista", "10.2.2.3", labURL},
+		{"", "10.2.2.3", unrestricted},
+	} {
+		req, resp := newReply4(t, tc.vendorClass, tc.addr)
+		result, stop := handler(req, resp)
+		if stop {
+			t.Fatal("captiveportal must not stop the chain")
+		}
+
+		if value := result.Options.Get(dhcpv4.OptionURL); string(value) != tc.expected {
+			t.Errorf("expected captive portal URL %s for %s, got %q", tc.expected, tc.addr, value)
+		}
+	}
+}
+
+func TestRelayAddress4(t *testing.T) {
+	handler, err := setup4(apitest.WriteConfig(t, api.CaptivePortalConfig{Rules: config.Rules}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, resp := newReply4(t, "", "0.0.0.0")
+	req.GatewayIPAddr = net.ParseIP("10.20.0.1")
+	result, _ := handler(req, resp)
+	if value := result.Options.Get(dhcpv4.OptionURL); string(value) != guestURL {
+		t.Errorf("expected captive portal URL %s by relay address, got %q", guestURL, value)
+	}
+
+	req, resp = newReply4(t, "", "10.9.0.1")
+	result, _ = handler(req, resp)
+	if result.Options.Has(dhcpv4.OptionURL) {
+		t.Error("expected no captive portal URL without a matching rule or default")
+	}
+}
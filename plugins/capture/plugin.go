@@ -0,0 +1,170 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package capture
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"sync/atomic"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/admin"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/fixture"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logger.GetLogger("plugins/capture")
+
+var Plugin = plugins.Plugin{
+	Name:   "capture",
+	Setup4: setup4,
+	Setup6: setup6,
+}
+
+const defaultMaxFixtures = 1000
+
+// plugin holds the state of a single capture plugin instance.
+type plugin struct {
+	directory   string
+	percent     float64
+	maxFixtures int64
+	sanitizer   *fixture.Sanitizer
+	log         *logrus.Entry
+	// run writes a fixture, in the background unless replaced in tests
+	run func(func())
+	// sample reports whether a request is captured, replaced in tests
+	sample func() bool
+
+	// captured counts the sampled requests, including those failing to be written
+	captured atomic.Int64
+}
+
+// args[0] = path to config file
+func parseArgs(args ...string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("exactly one argument must be passed to the capture plugin, got %d", len(args))
+	}
+	return args[0], nil
+}
+
+func loadConfig(args ...string) (*api.CaptureConfig, error) {
+	path, err := parseArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	log.Debugf("Reading config file %s", path)
+	config := &api.CaptureConfig{}
+	if err := api.Load(path, config); err != nil {
+		return nil, err
+	}
+
+	if config.Directory == "" {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("directory must be configured")}
+	}
+	if info, err := os.Stat(config.Directory); err != nil || !info.IsDir() {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("directory %s does not exist", config.Directory)}
+	}
+	if config.Percent <= 0 || config.Percent > 100 {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("percent must be greater than 0 and at most 100, got %v", config.Percent)}
+	}
+	if config.MaxFixtures < 0 {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("maxFixtures must not be negative")}
+	}
+	if config.MaxFixtures == 0 {
+		config.MaxFixtures = defaultMaxFixtures
+	}
+	return config, nil
+}
+
+func newPlugin(name string, args ...string) (*plugin, error) {
+	config, err := loadConfig(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	name = instance.Next(name)
+	p := &plugin{
+		directory:   config.Directory,
+		percent:     config.Percent,
+		maxFixtures: int64(config.MaxFixtures),
+		sanitizer:   fixture.NewSanitizer(),
+		log:         log.WithField("instance", name),
+		run:         func(f func()) { go f() },
+	}
+	p.sample = func() bool { return rand.Float64()*100 < p.percent }
+	admin.State(name, p.state)
+	return p, nil
+}
+
+func setup6(args ...string) (handler.Handler6, error) {
+	p, err := newPlugin("capture/v6", args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded capture plugin for DHCPv6 capturing %v%% of the requests to %s.", p.percent, p.directory)
+	return p.handler6, nil
+}
+
+func setup4(args ...string) (handler.Handler4, error) {
+	p, err := newPlugin("capture/v4", args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded capture plugin for DHCPv4 capturing %v%% of the requests to %s.", p.percent, p.directory)
+	return p.handler4, nil
+}
+
+func (p *plugin) state() any {
+	return map[string]int64{"captured": min(p.captured.Load(), p.maxFixtures)}
+}
+
+// capture reports whether a request is sampled and the limit not reached yet.
+func (p *plugin) capture() bool {
+	if !p.sample() {
+		return false
+	}
+	n := p.captured.Add(1)
+	if n == p.maxFixtures+1 {
+		p.log.Infof("Captured %d fixtures, not capturing any more", p.maxFixtures)
+	}
+	return n <= p.maxFixtures
+}
+
+func (p *plugin) write(f *fixture.Fixture, err error) {
+	if err != nil {
+		p.log.Warningf("Could not capture request: %v", err)
+		return
+	}
+	p.run(func() {
+		path, err := f.Write(p.directory)
+		if err != nil {
+			p.log.Errorf("Could not write fixture: %v", err)
+			return
+		}
+		p.log.Debugf("Captured %s %s request to %s", f.Family, f.MessageType, path)
+	})
+}
+
+func (p *plugin) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	if p.capture() {
+		p.write(fixture.New6(req, p.sanitizer))
+	}
+	return resp, false
+}
+
+func (p *plugin) handler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	if p.capture() {
+		p.write(fixture.New4(req, p.sanitizer))
+	}
+	return resp, false
+}
@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package capture
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/api/apitest"
+	"github.com/ironcore-dev/fedhcp/internal/fixture"
+)
+
+var mac = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+
+func Init(t *testing.T, maxFixtures int) (*plugin, string) {
+	dir := t.TempDir()
+	p, err := newPlugin("capture/test", apitest.WriteConfig(t, api.CaptureConfig{
+		Directory:   dir,
+		Percent:     100,
+		MaxFixtures: maxFixtures,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.run = func(f func()) { f() }
+	return p, dir
+}
+
+func fixtures(t *testing.T, dir string) []*fixture.Fixture {
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	var fixtures []*fixture.Fixture
+	for _, path := range paths {
+		f, err := fixture.Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fixtures = append(fixtures, f)
+	}
+	return fixtures
+}
+
+func TestWrongNumberArgs(t *testing.T) {
+	_, err := setup6()
+	if err == nil {
+		t.Fatal("no error occurred when not providing a configuration file path, but it should have")
+	}
+
+	_, err = setup4("foo", "bar")
+	if err == nil {
+		t.Fatal("no error occurred when providing wrong number of args (2), but it should have")
+	}
+}
+
+func TestWrongArgs(t *testing.T) {
+	dir := t.TempDir()
+	for _, config := range []api.CaptureConfig{
+		{Percent: 10},
+		{Directory: filepath.Join(dir, "missing"), Percent: 10},
+		{Directory: dir},
+		{Directory: dir, Percent: 101},
+		{Directory: dir, Percent: 10, MaxFixtures: -1},
+	} {
+		if _, err := newPlugin("capture/test", apitest.WriteConfig(t, config)); err == nil {
+			t.Errorf("no error occurred for invalid config %+v, but it should have", config)
+		}
+	}
+}
+
+func TestSampling(t *testing.T) {
+	p, dir := Init(t, 0)
+	p.sample = func() bool { return false }
+
+	req, _ := dhcpv4.NewDiscovery(mac)
+	resp, _ := dhcpv4.NewReplyFromRequest(req)
+	if _, stop := p.handler4(req, resp); stop {
+		t.Error("plugin must not break the chain")
+	}
+	if n := len(fixtures(t, dir)); n != 0 {
+		t.Errorf("expected no fixture for a request not sampled, got %d", n)
+	}
+}
+
+/* IPv6 */
+func TestCapture6(t *testing.T) {
+	p, dir := Init(t, 0)
+
+	req, _ := dhcpv6.NewSolicit(mac)
+	resp, _ := dhcpv6.NewAdvertiseFromSolicit(req)
+	p.handler6(req, resp)
+
+	captured := fixtures(t, dir)
+	if len(captured) != 1 || captured[0].Family != fixture.FamilyV6 {
+		t.Fatalf("expected one DHCPv6 fixture, got %+v", captured)
+	}
+	if _, err := captured[0].DHCPv6(); err != nil {
+		t.Errorf("expected the fixture to decode: %v", err)
+	}
+}
+
+/* IPv4 */
+func TestCapture4(t *testing.T) {
+	p, dir := Init(t, 2)
+
+	for i := 0; i < 3; i++ {
+		req, _ := dhcpv4.NewDiscovery(mac)
+		resp, _ := dhcpv4.NewReplyFromRequest(req)
+		p.handler4(req, resp)
+	}
+
+	captured := fixtures(t, dir)
+	if len(captured) != 2 {
+		t.Fatalf("expected the fixtures to be limited to 2, got %d", len(captured))
+	}
+	req, err := captured[0].DHCPv4()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.ClientHWAddr.String() == mac.String() {
+		t.Error("expected the MAC address to be sanitized")
+	}
+}
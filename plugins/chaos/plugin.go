@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package chaos
+
+import (
+	"fmt"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/chaos"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logger.GetLogger("plugins/chaos")
+
+var Plugin = plugins.Plugin{
+	Name:   "chaos",
+	Setup4: setup4,
+	Setup6: setup6,
+}
+
+// plugin injects the faults of its injector into responses.
+type plugin struct {
+	log      *logrus.Entry
+	injector *chaos.Injector
+}
+
+// args[0] = path to config file
+func parseArgs(args ...string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("exactly one argument must be passed to the chaos plugin, got %d", len(args))
+	}
+	return args[0], nil
+}
+
+func loadConfig(args ...string) (*api.ChaosConfig, error) {
+	path, err := parseArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	log.Debugf("Reading config file %s", path)
+	config := &api.ChaosConfig{}
+	if err := api.Load(path, config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func newPlugin(name string, args ...string) (*plugin, error) {
+	config, err := loadConfig(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	name = instance.Next(name)
+	injector, err := chaos.New(name, chaos.Faults{
+		DropPercent:   config.DropPercent,
+		K8sDelay:      config.K8sDelay,
+		CorruptOption: config.CorruptOption,
+	})
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+	return &plugin{log: log.WithField("instance", name), injector: injector}, nil
+}
+
+func setup6(args ...string) (handler.Handler6, error) {
+	p, err := newPlugin("chaos/v6", args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Warn("Loaded chaos plugin for DHCPv6, faults will be injected.")
+	return p.handler6, nil
+}
+
+func setup4(args ...string) (handler.Handler4, error) {
+	p, err := newPlugin("chaos/v4", args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Warn("Loaded chaos plugin for DHCPv4, faults will be injected.")
+	return p.handler4, nil
+}
+
+func (p *plugin) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	if p.injector.ShouldDrop() {
+		p.log.Infof("Dropping response to %s", req.Type())
+		return nil, true
+	}
+
+	code := dhcpv6.OptionCode(p.injector.Faults().CorruptOption)
+	if code == 0 {
+		return resp, false
+	}
+	if opt := resp.GetOneOption(code); opt != nil {
+		p.log.Infof("Corrupting option %s", code)
+		resp.UpdateOption(&dhcpv6.OptionGeneric{
+			OptionCode: code,
+			OptionData: chaos.CorruptData(len(opt.ToBytes())),
+		})
+	}
+
+	return resp, false
+}
+
+func (p *plugin) handler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	if p.injector.ShouldDrop() {
+		p.log.Infof("Dropping response to %s", req.MessageType())
+		return nil, true
+	}
+
+	corruptOption := p.injector.Faults().CorruptOption
+	if corruptOption == 0 || corruptOption > 255 {
+		return resp, false
+	}
+	code := dhcpv4.GenericOptionCode(corruptOption)
+	if data := resp.Options.Get(code); data != nil {
+		p.log.Infof("Corrupting option %s", code)
+		resp.UpdateOption(dhcpv4.OptGeneric(code, chaos.CorruptData(len(data))))
+	}
+
+	return resp, false
+}
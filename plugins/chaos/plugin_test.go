@@ -0,0 +1,176 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package chaos
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/api/apitest"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const bootFileURL = "http://[2001:db8::1]/boot.uki"
+
+func Init6(t *testing.T, config api.ChaosConfig) handler.Handler6 {
+	h, err := setup6(apitest.WriteConfig(t, config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func Init4(t *testing.T, config api.ChaosConfig) handler.Handler4 {
+	h, err := setup4(apitest.WriteConfig(t, config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func newExchange6(t *testing.T) (dhcpv6.DHCPv6, dhcpv6.DHCPv6) {
+	req, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.MessageType = dhcpv6.MessageTypeSolicit
+
+	stub, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.MessageType = dhcpv6.MessageTypeAdvertise
+	stub.AddOption(dhcpv6.OptBootFileURL(bootFileURL))
+	return req, stub
+}
+
+/* parametrization */
+func TestWrongArgs(t *testing.T) {
+	_, err := setup6()
+	if err == nil {
+		t.Fatal("no error occurred when not providing a configuration file path, but it should have")
+	}
+
+	_, err = setup6(apitest.WriteConfig(t, api.ChaosConfig{DropPercent: 101}))
+	if err == nil {
+		t.Fatal("no error occurred when providing a drop percentage above 100, but it should have")
+	}
+}
+
+func TestInstances(t *testing.T) {
+	dropping := Init6(t, api.ChaosConfig{DropPercent: 100})
+	passing := Init6(t, api.ChaosConfig{})
+
+	req, stub := newExchange6(t)
+	if resp, _ := dropping(req, stub); resp != nil {
+		t.Error("instance returned a message, but it should have dropped it")
+	}
+	req, stub = newExchange6(t)
+	if resp, _ := passing(req, stub); resp == nil {
+		t.Error("instance dropped the message with the faults of another one")
+	}
+}
+
+func TestK8sDelay(t *testing.T) {
+	var cl client.Client = fake.NewClientBuilder().WithScheme(kubernetes.GetScheme()).Build()
+	kubernetes.SetClient(&cl)
+	const delay = 50 * time.Millisecond
+	Init4(t, api.ChaosConfig{K8sDelay: delay})
+
+	start := time.Now()
+	err := kubernetes.GetClient().List(context.Background(), &corev1.ConfigMapList{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("expected the call of the plugin client to be delayed by %s, took %s", delay, elapsed)
+	}
+}
+
+/* IPv6 */
+func TestNoFaults6(t *testing.T) {
+	handler6 := Init6(t, api.ChaosConfig{})
+
+	req, stub := newExchange6(t)
+	resp, stop := handler6(req, stub)
+	if resp == nil {
+		t.Fatal("plugin did not return a message")
+	}
+	if stop {
+		t.Error("plugin interrupted processing, but it shouldn't have")
+	}
+	opt := resp.GetOneOption(dhcpv6.OptionBootfileURL)
+	if opt == nil || string(opt.ToBytes()) != bootFileURL {
+		t.Errorf("expected unmodified boot file URL %s, got %v", bootFileURL, opt)
+	}
+}
+
+func TestDropAll6(t *testing.T) {
+	handler6 := Init6(t, api.ChaosConfig{DropPercent: 100})
+
+	req, stub := newExchange6(t)
+	resp, stop := handler6(req, stub)
+	if resp != nil {
+		t.Error("plugin returned a message, but it should have dropped it")
+	}
+	if !stop {
+		t.Error("plugin did not interrupt processing, but it should have")
+	}
+}
+
+func TestCorruptOption6(t *testing.T) {
+	handler6 := Init6(t, api.ChaosConfig{CorruptOption: uint16(dhcpv6.OptionBootfileURL)})
+
+	req, stub := newExchange6(t)
+	resp, _ := handler6(req, stub)
+	if resp == nil {
+		t.Fatal("plugin did not return a message")
+	}
+	opt := resp.GetOneOption(dhcpv6.OptionBootfileURL)
+	if opt == nil {
+		t.Fatal("plugin removed the corrupted option, but it shouldn't have")
+	}
+	if len(opt.ToBytes()) != len(bootFileURL) {
+		t.Errorf("expected corrupted option of length %d, got %d", len(bootFileURL), len(opt.ToBytes()))
+	}
+}
+
+/* IPv4 */
+func TestCorruptOption4(t *testing.T) {
+	handler4 := Init4(t, api.ChaosConfig{CorruptOption: uint16(dhcpv4.OptionBootfileName)})
+
+	req, err := dhcpv4.NewDiscovery(net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub, err := dhcpv4.NewReplyFromRequest(req, dhcpv4.WithOption(dhcpv4.OptBootFileName("boot.efi")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, stop := handler4(req, stub)
+	if resp == nil {
+		t.Fatal("plugin did not return a message")
+	}
+	if stop {
+		t.Error("plugin interrupted processing, but it shouldn't have")
+	}
+	data := resp.Options.Get(dhcpv4.OptionBootfileName)
+	if len(data) != len("boot.efi") {
+		t.Errorf("expected corrupted option of length %d, got %d", len("boot.efi"), len(data))
+	}
+	if bytes.Equal(data, []byte("boot.efi")) {
+		t.Error("option was not corrupted")
+	}
+}
@@ -0,0 +1,376 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package dnsendpoint
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/admin"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/cache"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+var log = logger.GetLogger("plugins/dnsendpoint")
+
+var Plugin = plugins.Plugin{
+	Name:   "dnsendpoint",
+	Setup4: setup4,
+	Setup6: setup6,
+}
+
+const (
+	defaultOwner = "fedhcp"
+	defaultTTL   = 5 * time.Minute
+
+	// maxPublished bounds the remembered clients, refreshInterval makes the
+	// DNSEndpoints of clients renewing their lease get refreshed, see sweep
+	maxPublished    = 65536
+	refreshInterval = time.Hour
+	sweepInterval   = 10 * time.Minute
+)
+
+// plugin holds the state of a single dnsendpoint plugin instance.
+type plugin struct {
+	namespace   string
+	domain      string
+	owner       string
+	reverse     bool
+	macNames    bool
+	ttl         time.Duration
+	expireAfter time.Duration
+	labels      map[string]string
+	// family of the addresses published by the instance, ipv4 or ipv6
+	family string
+	log    *logrus.Entry
+	// run publishes the records of a response, in the background unless replaced in tests
+	run func(func())
+
+	// published holds the name and address last published per client, so
+	// renewals don't hit the kubernetes API
+	published *cache.Cache[string, string]
+}
+
+// args[0] = path to config file
+func parseArgs(args ...string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("exactly one argument must be passed to the dnsendpoint plugin, got %d", len(args))
+	}
+	return args[0], nil
+}
+
+func loadConfig(args ...string) (*api.DNSEndpointConfig, error) {
+	path, err := parseArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	log.Debugf("Reading config file %s", path)
+	config := &api.DNSEndpointConfig{}
+	if err := api.Load(path, config); err != nil {
+		return nil, err
+	}
+
+	if config.Namespace == "" {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("namespace must be configured")}
+	}
+	config.Domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(config.Domain)), ".")
+	if errs := validation.IsDNS1123Subdomain(config.Domain); len(errs) > 0 {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("invalid domain %q: %s", config.Domain, strings.Join(errs, ", "))}
+	}
+	if config.Owner == "" {
+		config.Owner = defaultOwner
+	}
+	if errs := validation.IsDNS1123Label(config.Owner); len(errs) > 0 {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("invalid owner %q: %s", config.Owner, strings.Join(errs, ", "))}
+	}
+	if config.TTL < 0 {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("ttl must not be negative")}
+	}
+	if config.TTL == 0 {
+		config.TTL = defaultTTL
+	}
+	if config.ExpireAfter != 0 && config.ExpireAfter < 2*refreshInterval {
+		return nil, &fedhcperrors.ConfigError{
+			Err: fmt.Errorf("expireAfter must be at least %s, the DNSEndpoints are refreshed every %s", 2*refreshInterval, refreshInterval),
+		}
+	}
+	return config, nil
+}
+
+func newPlugin(name, family string, args ...string) (*plugin, error) {
+	config, err := loadConfig(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	name = instance.Next(name)
+	p := &plugin{
+		namespace:   config.Namespace,
+		domain:      config.Domain,
+		owner:       config.Owner,
+		reverse:     config.Reverse,
+		macNames:    config.MACNames,
+		ttl:         config.TTL,
+		expireAfter: config.ExpireAfter,
+		labels:      config.Labels,
+		family:      family,
+		log:         log.WithField("instance", name),
+		run:         func(f func()) { go f() },
+		published:   cache.New[string, string](name+"/published", maxPublished, refreshInterval),
+	}
+	admin.State(name, p.state)
+	return p, nil
+}
+
+func setup6(args ...string) (handler.Handler6, error) {
+	p, err := newPlugin("dnsendpoint/v6", familyIPv6, args...)
+	if err != nil {
+		return nil, err
+	}
+	if p.expireAfter > 0 {
+		go p.expire()
+	}
+	p.log.Printf("Loaded dnsendpoint plugin for DHCPv6 publishing names of %s to %s.", p.domain, p.namespace)
+	return p.handler6, nil
+}
+
+func setup4(args ...string) (handler.Handler4, error) {
+	p, err := newPlugin("dnsendpoint/v4", familyIPv4, args...)
+	if err != nil {
+		return nil, err
+	}
+	if p.expireAfter > 0 {
+		go p.expire()
+	}
+	p.log.Printf("Loaded dnsendpoint plugin for DHCPv4 publishing names of %s to %s.", p.domain, p.namespace)
+	return p.handler4, nil
+}
+
+func (p *plugin) state() any {
+	return map[string]int{"published": p.published.Len()}
+}
+
+// objectName returns the name of the DNSEndpoint of a client, there is one per
+// owner, client and address family.
+func (p *plugin) objectName(mac net.HardwareAddr) string {
+	return p.owner + "-" + macKey(mac) + "-" + p.family
+}
+
+// publish creates or updates the DNSEndpoint of the client, unless the same
+// record has been published recently.
+func (p *plugin) publish(r record) error {
+	key := macKey(r.mac)
+	value := r.name + "/" + r.addr.String()
+	if published, ok := p.published.Get(key); ok && published == value {
+		return nil
+	}
+
+	cl := kubernetes.GetClient()
+	if cl == nil {
+		return &fedhcperrors.K8sUnavailable{Err: fmt.Errorf("kubernetes client not initialized")}
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(dnsEndpointGVK)
+	obj.SetNamespace(p.namespace)
+	obj.SetName(p.objectName(r.mac))
+	result, err := controllerutil.CreateOrUpdate(context.Background(), cl, obj, func() error {
+		if owner, ok := obj.GetLabels()[ownerLabel]; ok && owner != p.owner {
+			return fmt.Errorf("DNSEndpoint %s/%s is owned by %s", obj.GetNamespace(), obj.GetName(), owner)
+		}
+		labels := obj.GetLabels()
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		maps.Copy(labels, p.labels)
+		labels[ownerLabel] = p.owner
+		labels[macLabel] = key
+		labels[familyLabel] = p.family
+		obj.SetLabels(labels)
+		annotations := obj.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[refreshedAnnotation] = time.Now().UTC().Format(time.RFC3339)
+		obj.SetAnnotations(annotations)
+		return unstructured.SetNestedSlice(obj.Object, p.endpoints(r), "spec", "endpoints")
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply DNSEndpoint %s/%s: %w", p.namespace, obj.GetName(), fedhcperrors.FromK8s(err))
+	}
+	p.published.Put(key, value)
+	p.log.Debugf("Published %s (%s) for mac %s, DNSEndpoint %s/%s %s", r.name, r.addr, r.mac, p.namespace, obj.GetName(), result)
+	return nil
+}
+
+// unpublish deletes the DNSEndpoint of the client, if it exists and is owned by the plugin.
+func (p *plugin) unpublish(mac net.HardwareAddr) error {
+	p.published.Delete(macKey(mac))
+
+	cl := kubernetes.GetClient()
+	if cl == nil {
+		return &fedhcperrors.K8sUnavailable{Err: fmt.Errorf("kubernetes client not initialized")}
+	}
+	ctx := context.Background()
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(dnsEndpointGVK)
+	if err := cl.Get(ctx, client.ObjectKey{Namespace: p.namespace, Name: p.objectName(mac)}, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get DNSEndpoint: %w", fedhcperrors.FromK8s(err))
+	}
+	if obj.GetLabels()[ownerLabel] != p.owner {
+		return nil
+	}
+	if err := cl.Delete(ctx, obj); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete DNSEndpoint %s/%s: %w", p.namespace, obj.GetName(), fedhcperrors.FromK8s(err))
+	}
+	p.log.Infof("Deleted DNSEndpoint %s/%s of released mac %s", p.namespace, obj.GetName(), mac)
+	return nil
+}
+
+// sweep deletes the DNSEndpoints of the owner and family not refreshed within
+// expireAfter, i.e. of clients which did not renew their lease.
+func (p *plugin) sweep(now time.Time) error {
+	cl := kubernetes.GetClient()
+	if cl == nil {
+		return &fedhcperrors.K8sUnavailable{Err: fmt.Errorf("kubernetes client not initialized")}
+	}
+	ctx := context.Background()
+
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(dnsEndpointListGVK)
+	if err := cl.List(ctx, list, client.InNamespace(p.namespace),
+		client.MatchingLabels{ownerLabel: p.owner, familyLabel: p.family}); err != nil {
+		return fmt.Errorf("failed to list DNSEndpoints: %w", fedhcperrors.FromK8s(err))
+	}
+	for i := range list.Items {
+		obj := &list.Items[i]
+		refreshed, err := time.Parse(time.RFC3339, obj.GetAnnotations()[refreshedAnnotation])
+		if err == nil && now.Sub(refreshed) < p.expireAfter {
+			continue
+		}
+		if err := cl.Delete(ctx, obj); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete DNSEndpoint %s/%s: %w", p.namespace, obj.GetName(), fedhcperrors.FromK8s(err))
+		}
+		p.published.Delete(obj.GetLabels()[macLabel])
+		p.log.Infof("Deleted expired DNSEndpoint %s/%s", p.namespace, obj.GetName())
+	}
+	return nil
+}
+
+func (p *plugin) expire() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if err := p.sweep(now); err != nil {
+			p.log.WithFields(fedhcperrors.Fields(err)).Errorf("Could not delete expired DNSEndpoints: %s", err)
+		}
+	}
+}
+
+func (p *plugin) publishAsync(r record) {
+	p.run(func() {
+		if err := p.publish(r); err != nil {
+			p.log.WithFields(fedhcperrors.Fields(err)).Errorf("Could not publish %s for mac %s: %s", r.name, r.mac, err)
+		}
+	})
+}
+
+func (p *plugin) unpublishAsync(mac net.HardwareAddr) {
+	p.run(func() {
+		if err := p.unpublish(mac); err != nil {
+			p.log.WithFields(fedhcperrors.Fields(err)).Errorf("Could not unpublish mac %s: %s", mac, err)
+		}
+	})
+}
+
+func (p *plugin) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	m, err := req.GetInnerMessage()
+	if err != nil {
+		p.log.Errorf("Could not decapsulate request: %v", err)
+		return resp, false
+	}
+	if m.Type() == dhcpv6.MessageTypeRelease {
+		mac, err := dhcpv6.ExtractMAC(req)
+		if err != nil {
+			p.log.Errorf("Could not determine MAC address of %s, not unpublishing: %v", req.Summary(), err)
+			return resp, false
+		}
+		p.unpublishAsync(mac)
+		return resp, false
+	}
+
+	reply, ok := resp.(*dhcpv6.Message)
+	if !ok || reply.Type() != dhcpv6.MessageTypeReply {
+		return resp, false
+	}
+	// the name is published for the first leased address
+	var addr netip.Addr
+	for _, iana := range reply.Options.IANA() {
+		if addrs := iana.Options.Addresses(); !addr.IsValid() && len(addrs) > 0 {
+			addr, _ = netip.AddrFromSlice(addrs[0].IPv6Addr)
+		}
+	}
+	if !addr.IsValid() {
+		return resp, false
+	}
+
+	mac, err := dhcpv6.ExtractMAC(req)
+	if err != nil {
+		p.log.Errorf("Could not determine MAC address of %s, not publishing: %v", req.Summary(), err)
+		return resp, false
+	}
+	name := p.name(mac, clientName6(m, reply))
+	if name == "" {
+		p.log.Debugf("No name for mac %s, not publishing", mac)
+		return resp, false
+	}
+	p.publishAsync(record{mac: mac, name: name, addr: addr})
+	return resp, false
+}
+
+func (p *plugin) handler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	if req.MessageType() == dhcpv4.MessageTypeRelease {
+		p.unpublishAsync(req.ClientHWAddr)
+		return resp, false
+	}
+	if resp == nil || resp.MessageType() != dhcpv4.MessageTypeAck || resp.YourIPAddr.IsUnspecified() {
+		return resp, false
+	}
+	addr, ok := netip.AddrFromSlice(resp.YourIPAddr.To4())
+	if !ok {
+		return resp, false
+	}
+
+	name := p.name(req.ClientHWAddr, clientName4(req, resp))
+	if name == "" {
+		p.log.Debugf("No name for mac %s, not publishing", req.ClientHWAddr)
+		return resp, false
+	}
+	p.publishAsync(record{mac: req.ClientHWAddr, name: name, addr: addr})
+	return resp, false
+}
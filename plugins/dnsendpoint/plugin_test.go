@@ -0,0 +1,251 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package dnsendpoint
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/rfc1035label"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/api/apitest"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes/fake"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const namespace = "default"
+
+var mac = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+
+// Init returns a plugin publishing synchronously to an empty fake client.
+func Init(t *testing.T, family string, config api.DNSEndpointConfig) (*plugin, client.Client) {
+	var cl client.Client = fake.NewClient()
+	kubernetes.SetClient(&cl)
+	t.Cleanup(func() { kubernetes.SetClient(new(client.Client)) })
+
+	config.Namespace = namespace
+	config.Domain = "oob.example.org"
+	p, err := newPlugin("dnsendpoint/test", family, apitest.WriteConfig(t, config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.run = func(f func()) { f() }
+	return p, cl
+}
+
+func dnsEndpoints(t *testing.T, cl client.Client) []unstructured.Unstructured {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(dnsEndpointListGVK)
+	if err := cl.List(context.Background(), list, client.InNamespace(namespace)); err != nil {
+		t.Fatal(err)
+	}
+	return list.Items
+}
+
+// records returns the record types and targets by name of a DNSEndpoint.
+func records(t *testing.T, obj unstructured.Unstructured) map[string]string {
+	endpoints, _, err := unstructured.NestedSlice(obj.Object, "spec", "endpoints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := make(map[string]string)
+	for _, e := range endpoints {
+		endpoint := e.(map[string]interface{})
+		targets := endpoint["targets"].([]interface{})
+		records[endpoint["dnsName"].(string)] = endpoint["recordType"].(string) + " " + targets[0].(string)
+	}
+	return records
+}
+
+func TestWrongNumberArgs(t *testing.T) {
+	_, err := setup4()
+	if err == nil {
+		t.Fatal("no error occurred when not providing a configuration file path, but it should have")
+	}
+
+	_, err = setup6("foo", "bar")
+	if err == nil {
+		t.Fatal("no error occurred when providing wrong number of args (2), but it should have")
+	}
+}
+
+func TestWrongArgs(t *testing.T) {
+	for _, config := range []api.DNSEndpointConfig{
+		{Domain: "oob.example.org"},
+		{Namespace: namespace},
+		{Namespace: namespace, Domain: "oob_example.org"},
+		{Namespace: namespace, Domain: "oob.example.org", Owner: "FeDHCP"},
+		{Namespace: namespace, Domain: "oob.example.org", TTL: -time.Minute},
+		{Namespace: namespace, Domain: "oob.example.org", ExpireAfter: time.Hour},
+	} {
+		if _, err := newPlugin("dnsendpoint/test", familyIPv4, apitest.WriteConfig(t, config)); err == nil {
+			t.Errorf("no error occurred for invalid config %+v, but it should have", config)
+		}
+	}
+}
+
+func TestReverseName(t *testing.T) {
+	for addr, expected := range map[string]string{
+		"192.168.2.100": "100.2.168.192.in-addr.arpa",
+		"2001:db8::1":   "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa",
+	} {
+		if name := reverseName(netip.MustParseAddr(addr)); name != expected {
+			t.Errorf("expected reverse name %s of %s, got %s", expected, addr, name)
+		}
+	}
+}
+
+func TestName(t *testing.T) {
+	p, _ := Init(t, familyIPv4, api.DNSEndpointConfig{MACNames: true})
+	for clientName, expected := range map[string]string{
+		"rack1-bmc":                  "rack1-bmc.oob.example.org",
+		"Rack1-BMC.oob.example.org.": "rack1-bmc.oob.example.org",
+		"rack1-bmc.example.com":      "rack1-bmc.oob.example.org",
+		"":                           "001a2b3c4d5e.oob.example.org",
+		"rack 1":                     "001a2b3c4d5e.oob.example.org",
+	} {
+		if name := p.name(mac, clientName); name != expected {
+			t.Errorf("expected name %s for %q, got %s", expected, clientName, name)
+		}
+	}
+
+	p.macNames = false
+	if name := p.name(mac, ""); name != "" {
+		t.Errorf("expected no name without MAC names, got %s", name)
+	}
+}
+
+/* IPv6 */
+func TestPublish6(t *testing.T) {
+	p, cl := Init(t, familyIPv6, api.DNSEndpointConfig{})
+
+	req, _ := dhcpv6.NewMessage(dhcpv6.WithClientID(&dhcpv6.DUIDLL{HWType: 1, LinkLayerAddr: mac}))
+	req.MessageType = dhcpv6.MessageTypeRequest
+	req.AddOption(&dhcpv6.OptFQDN{DomainName: &rfc1035label.Labels{Labels: []string{"rack1-bmc"}}})
+	resp, _ := dhcpv6.NewReplyFromMessage(req)
+	resp.AddOption(&dhcpv6.OptIANA{Options: dhcpv6.IdentityOptions{Options: []dhcpv6.Option{
+		&dhcpv6.OptIAAddress{IPv6Addr: net.ParseIP("2001:db8::100")},
+	}}})
+	p.handler6(req, resp)
+
+	endpoints := dnsEndpoints(t, cl)
+	if len(endpoints) != 1 || endpoints[0].GetName() != "fedhcp-001a2b3c4d5e-ipv6" {
+		t.Fatalf("expected one DNSEndpoint fedhcp-001a2b3c4d5e-ipv6, got %v", endpoints)
+	}
+	if r := records(t, endpoints[0]); len(r) != 1 || r["rack1-bmc.oob.example.org"] != "AAAA 2001:db8::100" {
+		t.Errorf("expected the AAAA record of rack1-bmc.oob.example.org, got %v", r)
+	}
+
+	release, _ := dhcpv6.NewMessage(dhcpv6.WithClientID(&dhcpv6.DUIDLL{HWType: 1, LinkLayerAddr: mac}))
+	release.MessageType = dhcpv6.MessageTypeRelease
+	releaseResp, _ := dhcpv6.NewReplyFromMessage(release)
+	p.handler6(release, releaseResp)
+	if endpoints := dnsEndpoints(t, cl); len(endpoints) != 0 {
+		t.Errorf("expected the DNSEndpoint to be deleted on release, got %v", endpoints)
+	}
+}
+
+/* IPv4 */
+func newAck(t *testing.T, modifiers ...dhcpv4.Modifier) (*dhcpv4.DHCPv4, *dhcpv4.DHCPv4) {
+	req, err := dhcpv4.NewDiscovery(mac, modifiers...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeRequest))
+	resp, err := dhcpv4.NewReplyFromRequest(req,
+		dhcpv4.WithMessageType(dhcpv4.MessageTypeAck),
+		dhcpv4.WithYourIP(net.IPv4(192, 168, 2, 100)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req, resp
+}
+
+func TestPublish4(t *testing.T) {
+	p, cl := Init(t, familyIPv4, api.DNSEndpointConfig{Reverse: true, Labels: map[string]string{"zone": "oob"}})
+
+	req, resp := newAck(t, dhcpv4.WithOption(dhcpv4.OptHostName("rack1-bmc")))
+	if _, stop := p.handler4(req, resp); stop {
+		t.Error("plugin must not break the chain")
+	}
+
+	endpoints := dnsEndpoints(t, cl)
+	if len(endpoints) != 1 {
+		t.Fatalf("expected one DNSEndpoint, got %d", len(endpoints))
+	}
+	labels := endpoints[0].GetLabels()
+	if labels[ownerLabel] != defaultOwner || labels[macLabel] != "001a2b3c4d5e" || labels["zone"] != "oob" {
+		t.Errorf("unexpected labels %v", labels)
+	}
+	r := records(t, endpoints[0])
+	if r["rack1-bmc.oob.example.org"] != "A 192.168.2.100" ||
+		r["100.2.168.192.in-addr.arpa"] != "PTR rack1-bmc.oob.example.org" {
+		t.Errorf("expected the A and PTR records of rack1-bmc.oob.example.org, got %v", r)
+	}
+
+	// a renamed client gets its DNSEndpoint updated
+	req, resp = newAck(t, dhcpv4.WithOption(dhcpv4.OptHostName("rack2-bmc")))
+	p.handler4(req, resp)
+	endpoints = dnsEndpoints(t, cl)
+	if r := records(t, endpoints[0]); len(endpoints) != 1 || r["rack2-bmc.oob.example.org"] != "A 192.168.2.100" {
+		t.Errorf("expected the DNSEndpoint to be updated, got %v", endpoints)
+	}
+
+	release, _ := dhcpv4.NewDiscovery(mac, dhcpv4.WithMessageType(dhcpv4.MessageTypeRelease))
+	p.handler4(release, nil)
+	if endpoints := dnsEndpoints(t, cl); len(endpoints) != 0 {
+		t.Errorf("expected the DNSEndpoint to be deleted on release, got %v", endpoints)
+	}
+}
+
+func TestNoName4(t *testing.T) {
+	p, cl := Init(t, familyIPv4, api.DNSEndpointConfig{})
+
+	req, resp := newAck(t)
+	p.handler4(req, resp)
+	if endpoints := dnsEndpoints(t, cl); len(endpoints) != 0 {
+		t.Errorf("expected no DNSEndpoint for a client without name, got %v", endpoints)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	p, cl := Init(t, familyIPv4, api.DNSEndpointConfig{ExpireAfter: 24 * time.Hour})
+
+	req, resp := newAck(t, dhcpv4.WithOption(dhcpv4.OptHostName("rack1-bmc")))
+	p.handler4(req, resp)
+
+	foreign := &unstructured.Unstructured{}
+	foreign.SetGroupVersionKind(dnsEndpointGVK)
+	foreign.SetNamespace(namespace)
+	foreign.SetName("other-001a2b3c4d5e-ipv4")
+	foreign.SetLabels(map[string]string{ownerLabel: "other", familyLabel: familyIPv4})
+	if err := cl.Create(context.Background(), foreign); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.sweep(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(dnsEndpoints(t, cl)); n != 2 {
+		t.Fatalf("expected no DNSEndpoint to be deleted before expiry, got %d left", n)
+	}
+
+	if err := p.sweep(time.Now().Add(25 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	endpoints := dnsEndpoints(t, cl)
+	if len(endpoints) != 1 || endpoints[0].GetName() != foreign.GetName() {
+		t.Errorf("expected only the DNSEndpoint of the other owner to be kept, got %v", endpoints)
+	}
+	if p.published.Len() != 0 {
+		t.Error("expected the expired client to be forgotten")
+	}
+}
@@ -0,0 +1,161 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package dnsendpoint
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/rfc1035label"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// DNSEndpoint is the CRD of external-dns, it is handled unstructured to not
+// depend on external-dns.
+var (
+	dnsEndpointGVK     = schema.GroupVersionKind{Group: "externaldns.k8s.io", Version: "v1alpha1", Kind: "DNSEndpoint"}
+	dnsEndpointListGVK = dnsEndpointGVK.GroupVersion().WithKind("DNSEndpointList")
+)
+
+const (
+	ownerLabel  = "fedhcp.ironcore.dev/dns-owner"
+	macLabel    = "fedhcp.ironcore.dev/mac"
+	familyLabel = "fedhcp.ironcore.dev/family"
+	// refreshedAnnotation holds the time the DNSEndpoint was last published, see sweep
+	refreshedAnnotation = "fedhcp.ironcore.dev/refreshed"
+
+	familyIPv4 = "ipv4"
+	familyIPv6 = "ipv6"
+
+	// flagE4 is the DHCPv4 client FQDN flag for the canonical wire format encoding
+	flagE4 = 0x04
+)
+
+// record is the name and address published for a client.
+type record struct {
+	mac  net.HardwareAddr
+	name string
+	addr netip.Addr
+}
+
+func macKey(mac net.HardwareAddr) string {
+	return strings.ReplaceAll(strings.ToLower(mac.String()), ":", "")
+}
+
+// qualify returns the fully qualified name of a client name. Unqualified names
+// get the domain appended, names of other domains are moved into it. It returns
+// the empty string for invalid names.
+func (p *plugin) qualify(name string) string {
+	name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+	if strings.HasSuffix(name, "."+p.domain) {
+		if len(validation.IsDNS1123Subdomain(name)) > 0 {
+			return ""
+		}
+		return name
+	}
+	host, _, _ := strings.Cut(name, ".")
+	if len(validation.IsDNS1123Label(host)) > 0 {
+		return ""
+	}
+	return host + "." + p.domain
+}
+
+// name returns the name published for a client, derived from the name it got
+// or sent, or from its MAC address if MAC names are enabled.
+func (p *plugin) name(mac net.HardwareAddr, clientName string) string {
+	if name := p.qualify(clientName); name != "" {
+		return name
+	}
+	if p.macNames {
+		return macKey(mac) + "." + p.domain
+	}
+	return ""
+}
+
+// clientName4 returns the name of a DHCPv4 client: the FQDN of the response as
+// set by the fqdn plugin, the hostname or the FQDN the client sent.
+func clientName4(req, resp *dhcpv4.DHCPv4) string {
+	if name := fqdn4(resp.Options.Get(dhcpv4.OptionFQDN)); name != "" {
+		return name
+	}
+	if name := resp.HostName(); name != "" {
+		return name
+	}
+	if name := req.HostName(); name != "" {
+		return name
+	}
+	return fqdn4(req.Options.Get(dhcpv4.OptionFQDN))
+}
+
+func fqdn4(data []byte) string {
+	if len(data) < 3 {
+		return ""
+	}
+	if data[0]&flagE4 == 0 {
+		return string(data[3:])
+	}
+	labels, err := rfc1035label.FromBytes(data[3:])
+	if err != nil || len(labels.Labels) == 0 {
+		return ""
+	}
+	return labels.Labels[0]
+}
+
+// clientName6 returns the name of a DHCPv6 client: the FQDN of the reply as set
+// by the fqdn plugin or the FQDN the client sent.
+func clientName6(req, reply *dhcpv6.Message) string {
+	for _, fqdn := range []*dhcpv6.OptFQDN{reply.Options.FQDN(), req.Options.FQDN()} {
+		if fqdn != nil && fqdn.DomainName != nil && len(fqdn.DomainName.Labels) > 0 {
+			return fqdn.DomainName.Labels[0]
+		}
+	}
+	return ""
+}
+
+// reverseName returns the name of the PTR record of the address.
+func reverseName(addr netip.Addr) string {
+	if addr.Is4() {
+		a := addr.As4()
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", a[3], a[2], a[1], a[0])
+	}
+	a := addr.As16()
+	var b strings.Builder
+	for i := len(a) - 1; i >= 0; i-- {
+		fmt.Fprintf(&b, "%x.%x.", a[i]&0x0f, a[i]>>4)
+	}
+	b.WriteString("ip6.arpa")
+	return b.String()
+}
+
+// endpoints returns the external-dns endpoints of the record: the A or AAAA
+// record and, if enabled, the PTR record.
+func (p *plugin) endpoints(r record) []interface{} {
+	ttl := int64(p.ttl.Seconds())
+	recordType := "A"
+	if r.addr.Is6() {
+		recordType = "AAAA"
+	}
+	endpoints := []interface{}{
+		map[string]interface{}{
+			"dnsName":    r.name,
+			"recordType": recordType,
+			"recordTTL":  ttl,
+			"targets":    []interface{}{r.addr.String()},
+		},
+	}
+	if p.reverse {
+		endpoints = append(endpoints, map[string]interface{}{
+			"dnsName":    reverseName(r.addr),
+			"recordType": "PTR",
+			"recordTTL":  ttl,
+			"targets":    []interface{}{r.name},
+		})
+	}
+	return endpoints
+}
@@ -0,0 +1,251 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package fqdn
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/rfc1035label"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logger.GetLogger("plugins/fqdn")
+
+var Plugin = plugins.Plugin{
+	Name:   "fqdn",
+	Setup4: setup4,
+	Setup6: setup6,
+}
+
+// Client FQDN option flags, see RFC 4702 Section 2.1 and RFC 4704 Section 4.1.
+const (
+	flagS  = 0x01
+	flagO  = 0x02
+	flagE4 = 0x04
+	flagN  = 0x08
+
+	// rcode sent by servers in the deprecated RCODE fields of option 81
+	rcodeServer = 255
+)
+
+// plugin holds the state of a single fqdn plugin instance. It is built once
+// in setup and never modified afterwards.
+type plugin struct {
+	domain         string
+	foreignDomains api.ForeignDomainPolicy
+	serverUpdates  bool
+	log            *logrus.Entry
+}
+
+// args[0] = path to config file
+func parseArgs(args ...string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("exactly one argument must be passed to the fqdn plugin, got %d", len(args))
+	}
+	return args[0], nil
+}
+
+func loadConfig(args ...string) (*api.FQDNConfig, error) {
+	path, err := parseArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	log.Debugf("Reading config file %s", path)
+	config := &api.FQDNConfig{}
+	if err := api.Load(path, config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func newPlugin(name string, args ...string) (*plugin, error) {
+	config, err := loadConfig(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	domain := normalize(config.Domain)
+	if domain == "" {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("no domain configured")}
+	}
+
+	switch config.ForeignDomains {
+	case "":
+		config.ForeignDomains = api.ForeignDomainReplace
+	case api.ForeignDomainReplace, api.ForeignDomainKeep, api.ForeignDomainReject:
+	default:
+		return nil, &fedhcperrors.ConfigError{
+			Err: fmt.Errorf("unknown foreign domain policy %s", config.ForeignDomains),
+		}
+	}
+
+	return &plugin{
+		domain:         domain,
+		foreignDomains: config.ForeignDomains,
+		serverUpdates:  config.ServerUpdates,
+		log:            instance.Logger(log, name),
+	}, nil
+}
+
+func setup6(args ...string) (handler.Handler6, error) {
+	p, err := newPlugin("fqdn/v6", args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded fqdn plugin for DHCPv6 with domain %s.", p.domain)
+	return p.handler6, nil
+}
+
+func setup4(args ...string) (handler.Handler4, error) {
+	p, err := newPlugin("fqdn/v4", args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded fqdn plugin for DHCPv4 with domain %s.", p.domain)
+	return p.handler4, nil
+}
+
+func normalize(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
+
+// qualify applies the domain policy to a client-sent name. Unqualified names
+// get the domain appended, names in foreign domains are handled according to
+// the foreign domain policy. The second return value is false if the name is
+// rejected.
+func (p *plugin) qualify(name string) (string, bool) {
+	name = normalize(name)
+	if name == "" {
+		return "", false
+	}
+
+	if name == p.domain || strings.HasSuffix(name, "."+p.domain) {
+		return name, true
+	}
+
+	host, _, qualified := strings.Cut(name, ".")
+	if !qualified {
+		return host + "." + p.domain, true
+	}
+
+	switch p.foreignDomains {
+	case api.ForeignDomainKeep:
+		return name, true
+	case api.ForeignDomainReject:
+		return "", false
+	default:
+		return host + "." + p.domain, true
+	}
+}
+
+// fullName returns the name held by labels. Names are usually parsed into a
+// single entry, but names split by empty labels are joined, so that no label
+// is lost.
+func fullName(labels *rfc1035label.Labels) string {
+	var parts []string
+	for _, label := range labels.Labels {
+		if label != "" {
+			parts = append(parts, label)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// updateFlags returns the N, S and O flags of the response: N tells that the
+// server performs no DNS update at all, S whether the server performs the
+// forward DNS update, O whether the client's preference for S has been
+// overridden. A client setting N asks the server not to perform any update,
+// which is honored; S must not be set along with N then.
+func (p *plugin) updateFlags(clientFlags uint8) uint8 {
+	if clientFlags&flagN != 0 {
+		return flagN
+	}
+	clientS := clientFlags&flagS != 0
+	var flags uint8
+	if p.serverUpdates {
+		flags |= flagS
+	}
+	if clientS != p.serverUpdates {
+		flags |= flagO
+	}
+	return flags
+}
+
+func (p *plugin) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	m, err := req.GetInnerMessage()
+	if err != nil {
+		p.log.Errorf("BUG: could not decapsulate: %v", err)
+		return nil, true
+	}
+
+	opt := m.Options.FQDN()
+	if opt == nil || opt.DomainName == nil {
+		return resp, false
+	}
+
+	clientName := fullName(opt.DomainName)
+	name, ok := p.qualify(clientName)
+	if !ok {
+		p.log.Infof("Client FQDN %s rejected", clientName)
+		return resp, false
+	}
+
+	resp.UpdateOption(&dhcpv6.OptFQDN{
+		Flags:      p.updateFlags(opt.Flags),
+		DomainName: &rfc1035label.Labels{Labels: []string{name}},
+	})
+	p.log.Debugf("Added client FQDN %s", name)
+
+	return resp, false
+}
+
+func (p *plugin) handler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	data := req.Options.Get(dhcpv4.OptionFQDN)
+	if len(data) < 3 {
+		return resp, false
+	}
+
+	clientFlags := data[0]
+	var clientName string
+	if clientFlags&flagE4 != 0 {
+		labels, err := rfc1035label.FromBytes(data[3:])
+		if err != nil {
+			p.log.Infof("Could not parse client FQDN: %v", err)
+			return resp, false
+		}
+		clientName = fullName(labels)
+	} else {
+		clientName = string(data[3:])
+	}
+
+	name, ok := p.qualify(clientName)
+	if !ok {
+		p.log.Infof("Client FQDN %s rejected", clientName)
+		return resp, false
+	}
+
+	// the response uses the same encoding as the client
+	flags := p.updateFlags(clientFlags) | clientFlags&flagE4
+	encoded := []byte(name)
+	if clientFlags&flagE4 != 0 {
+		encoded = (&rfc1035label.Labels{Labels: []string{name}}).ToBytes()
+	}
+
+	value := append([]byte{flags, rcodeServer, rcodeServer}, encoded...)
+	resp.UpdateOption(dhcpv4.OptGeneric(dhcpv4.OptionFQDN, value))
+	p.log.Debugf("Added client FQDN %s", name)
+
+	return resp, false
+}
@@ -0,0 +1,234 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package fqdn
+
+import (
+	"net"
+	"testing"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/rfc1035label"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/api/apitest"
+)
+
+const domain = "oob.example.org"
+
+func Init6(t *testing.T, config api.FQDNConfig) handler.Handler6 {
+	h, err := setup6(apitest.WriteConfig(t, config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func Init4(t *testing.T, config api.FQDNConfig) handler.Handler4 {
+	h, err := setup4(apitest.WriteConfig(t, config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func request6(t *testing.T, h handler.Handler6, flags uint8, labels ...string) *dhcpv6.OptFQDN {
+	req, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.MessageType = dhcpv6.MessageTypeRequest
+	req.AddOption(&dhcpv6.OptFQDN{Flags: flags, DomainName: &rfc1035label.Labels{Labels: labels}})
+
+	relayedRequest, err := dhcpv6.EncapsulateRelay(req, dhcpv6.MessageTypeRelayForward, net.IPv6loopback, net.IPv6loopback)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stub, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.MessageType = dhcpv6.MessageTypeReply
+
+	resp, stop := h(relayedRequest, stub)
+	if resp == nil {
+		t.Fatal("plugin did not return a message")
+	}
+	if stop {
+		t.Error("plugin interrupted processing, but it shouldn't have")
+	}
+	return resp.(*dhcpv6.Message).Options.FQDN()
+}
+
+/* parametrization */
+func TestWrongArgs(t *testing.T) {
+	_, err := setup6()
+	if err == nil {
+		t.Fatal("no error occurred when not providing a configuration file path, but it should have")
+	}
+
+	_, err = setup6(apitest.WriteConfig(t, api.FQDNConfig{}))
+	if err == nil {
+		t.Fatal("no error occurred when not providing a domain, but it should have")
+	}
+
+	_, err = setup6(apitest.WriteConfig(t, api.FQDNConfig{Domain: domain, ForeignDomains: "ignore"}))
+	if err == nil {
+		t.Fatal("no error occurred when providing an unknown foreign domain policy, but it should have")
+	}
+}
+
+func TestQualify(t *testing.T) {
+	tests := []struct {
+		policy   api.ForeignDomainPolicy
+		name     string
+		expected string
+		ok       bool
+	}{
+		{api.ForeignDomainReplace, "server-01", "server-01." + domain, true},
+		{api.ForeignDomainReplace, "Server-01." + domain + ".", "server-01." + domain, true},
+		{api.ForeignDomainReplace, "server-01.example.com", "server-01." + domain, true},
+		{api.ForeignDomainKeep, "server-01.example.com", "server-01.example.com", true},
+		{api.ForeignDomainReject, "server-01.example.com", "", false},
+		{api.ForeignDomainReject, "server-01", "server-01." + domain, true},
+		{api.ForeignDomainReplace, "", "", false},
+	}
+
+	for _, test := range tests {
+		p := &plugin{domain: domain, foreignDomains: test.policy, log: log}
+		name, ok := p.qualify(test.name)
+		if name != test.expected || ok != test.ok {
+			t.Errorf("policy %s, name %q: expected (%q, %t), got (%q, %t)",
+				test.policy, test.name, test.expected, test.ok, name, ok)
+		}
+	}
+}
+
+/* IPv6 */
+func TestServerUpdates6(t *testing.T) {
+	handler6 := Init6(t, api.FQDNConfig{Domain: domain, ServerUpdates: true})
+
+	opt := request6(t, handler6, 0, "server-01")
+	if opt == nil {
+		t.Fatal("no FQDN option in response")
+	}
+	if opt.DomainName.Labels[0] != "server-01."+domain {
+		t.Errorf("expected FQDN server-01.%s, got %s", domain, opt.DomainName.Labels[0])
+	}
+	if opt.Flags != flagS|flagO {
+		t.Errorf("expected flags S and O to be set, got %#x", opt.Flags)
+	}
+
+	opt = request6(t, handler6, flagS, "server-01")
+	if opt.Flags != flagS {
+		t.Errorf("expected flag S to be set only, got %#x", opt.Flags)
+	}
+
+	// the client asking for no updates at all is honored
+	opt = request6(t, handler6, flagN, "server-01")
+	if opt.Flags != flagN {
+		t.Errorf("expected flag N to be set only, got %#x", opt.Flags)
+	}
+}
+
+func TestClientUpdates6(t *testing.T) {
+	handler6 := Init6(t, api.FQDNConfig{Domain: domain})
+
+	opt := request6(t, handler6, flagS, "server-01")
+	if opt == nil {
+		t.Fatal("no FQDN option in response")
+	}
+	if opt.Flags != flagO {
+		t.Errorf("expected flag O to be set only, got %#x", opt.Flags)
+	}
+
+	opt = request6(t, handler6, flagN, "server-01")
+	if opt.Flags != flagN {
+		t.Errorf("expected flag N to be set only, got %#x", opt.Flags)
+	}
+}
+
+func TestFullName6(t *testing.T) {
+	handler6 := Init6(t, api.FQDNConfig{Domain: domain, ForeignDomains: api.ForeignDomainKeep})
+
+	for _, labels := range [][]string{
+		{"server-01.rack-1.example.com"},
+		{"server-01", "rack-1.example.com"},
+		{"server-01", "", "rack-1.example.com"},
+	} {
+		opt := request6(t, handler6, 0, labels...)
+		if opt == nil {
+			t.Fatal("no FQDN option in response")
+		}
+		if name := fullName(opt.DomainName); name != "server-01.rack-1.example.com" {
+			t.Errorf("expected FQDN server-01.rack-1.example.com for %v, got %s", labels, name)
+		}
+	}
+}
+
+func TestRejectedDomain6(t *testing.T) {
+	handler6 := Init6(t, api.FQDNConfig{Domain: domain, ForeignDomains: api.ForeignDomainReject})
+
+	if opt := request6(t, handler6, 0, "server-01.example.com"); opt != nil {
+		t.Errorf("expected no FQDN option for rejected domain, got %s", opt)
+	}
+}
+
+/* IPv4 */
+func TestClientFQDN4(t *testing.T) {
+	handler4 := Init4(t, api.FQDNConfig{Domain: domain, ServerUpdates: true})
+
+	for _, encoded := range []bool{false, true} {
+		value := []byte{0, 0, 0}
+		if encoded {
+			value[0] = flagE4
+			value = append(value, (&rfc1035label.Labels{Labels: []string{"server-01"}}).ToBytes()...)
+		} else {
+			value = append(value, []byte("server-01")...)
+		}
+
+		req, err := dhcpv4.NewDiscovery(net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e},
+			dhcpv4.WithOption(dhcpv4.OptGeneric(dhcpv4.OptionFQDN, value)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		stub, err := dhcpv4.NewReplyFromRequest(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, stop := handler4(req, stub)
+		if resp == nil {
+			t.Fatal("plugin did not return a message")
+		}
+		if stop {
+			t.Error("plugin interrupted processing, but it shouldn't have")
+		}
+
+		data := resp.Options.Get(dhcpv4.OptionFQDN)
+		if len(data) < 3 {
+			t.Fatalf("expected FQDN option in response, got %v", data)
+		}
+		expectedFlags := uint8(flagS | flagO)
+		if encoded {
+			expectedFlags |= flagE4
+		}
+		if data[0] != expectedFlags || data[1] != rcodeServer || data[2] != rcodeServer {
+			t.Errorf("expected flags %#x and rcodes 255, got %v", expectedFlags, data[:3])
+		}
+
+		name := string(data[3:])
+		if encoded {
+			labels, err := rfc1035label.FromBytes(data[3:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			name = labels.Labels[0]
+		}
+		if name != "server-01."+domain {
+			t.Errorf("expected FQDN server-01.%s, got %s", domain, name)
+		}
+	}
+}
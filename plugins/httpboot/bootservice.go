@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package httpboot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ironcore-dev/fedhcp/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultMaxConnections = 64
+	bootServiceTimeout    = 10 * time.Second
+)
+
+var (
+	bootServiceRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "httpboot",
+		Name:      "bootservice_requests_total",
+		Help:      "Number of requests to the boot service by HTTP status code, \"error\" if no response was received.",
+	}, []string{"instance", "code"})
+	bootServiceDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "httpboot",
+		Name:      "bootservice_request_duration_seconds",
+		Help:      "Latency of requests to the boot service.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"instance"})
+)
+
+// bootService fetches client-specific UKI URLs. Its client is shared by all
+// requests of a plugin instance and keeps the connections to the boot service
+// alive, so that mass boot events don't open a new connection per client.
+type bootService struct {
+	url string
+	// instance labels the metrics
+	instance string
+	client   *http.Client
+}
+
+func newBootService(instance, url string, maxConnections int) *bootService {
+	metrics.Register(bootServiceRequests, bootServiceDuration)
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxConnsPerHost = maxConnections
+	transport.MaxIdleConns = maxConnections
+	transport.MaxIdleConnsPerHost = maxConnections
+	return &bootService{
+		url:      url,
+		instance: instance,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   bootServiceTimeout,
+		},
+	}
+}
+
+// parseMaxConnections parses the optional "maxConnections=<n>" argument.
+func parseMaxConnections(args ...string) (int, error) {
+	if len(args) < 2 {
+		return defaultMaxConnections, nil
+	}
+	value, ok := strings.CutPrefix(args[1], "maxConnections=")
+	if !ok {
+		return 0, fmt.Errorf("unknown httpboot parameter %s", args[1])
+	}
+	maxConnections, err := strconv.Atoi(value)
+	if err != nil || maxConnections < 1 {
+		return 0, fmt.Errorf("invalid maxConnections %s, should be a positive number", value)
+	}
+	return maxConnections, nil
+}
+
+func (b *bootService) fetchUKIURL(clientIPs []string) (string, error) {
+	req, err := http.NewRequest("GET", b.url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	xForwardedFor := strings.Join(clientIPs, ", ")
+	req.Header.Set("X-Forwarded-For", xForwardedFor)
+
+	start := time.Now()
+	resp, err := b.client.Do(req)
+	bootServiceDuration.WithLabelValues(b.instance).Observe(time.Since(start).Seconds())
+	if err != nil {
+		bootServiceRequests.WithLabelValues(b.instance, "error").Inc()
+		log.Errorf("HTTP request failed: %v", err)
+		return "", err
+	}
+	bootServiceRequests.WithLabelValues(b.instance, strconv.Itoa(resp.StatusCode)).Inc()
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	var data struct {
+		UKIURL string `json:"UKIURL"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return "", err
+	}
+
+	if data.UKIURL == "" {
+		return "", fmt.Errorf("received empty UKI URL")
+	}
+
+	return data.UKIURL, nil
+}
@@ -5,10 +5,7 @@ package httpboot
 
 import (
 	"encoding/binary"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"net/url"
 	"strings"
 
@@ -17,12 +14,16 @@ import (
 	"github.com/coredhcp/coredhcp/plugins"
 	"github.com/insomniacslk/dhcp/dhcpv4"
 	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/admin"
+	"github.com/ironcore-dev/fedhcp/internal/bootoperator"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/funnel"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/ironcore-dev/fedhcp/internal/printer"
+	"github.com/ironcore-dev/fedhcp/internal/responsecache"
+	"github.com/sirupsen/logrus"
 )
 
-var bootFile4 string
-var bootFile6 string
-var useBootService bool
-
 var log = logger.GetLogger("plugins/httpboot")
 
 var Plugin = plugins.Plugin{
@@ -33,9 +34,34 @@ var Plugin = plugins.Plugin{
 
 const httpClient = "HTTPClient"
 
+// config holds the configuration of a single httpboot plugin instance.
+type config struct {
+	bootFile       string
+	useBootService bool
+	bootService    *bootService
+	// bootOperator looks up client-specific UKIs rendered by boot-operator, nil if disabled
+	bootOperator *bootoperator.Lookup
+}
+
+// plugin4 holds the state of a DHCPv4 httpboot plugin instance. The config is
+// set once in setup4 and never modified afterwards.
+type plugin4 struct {
+	config
+	responseCache *responsecache.Cache[[]dhcpv4.Option]
+	log           *logrus.Entry
+}
+
+// plugin6 holds the state of a DHCPv6 httpboot plugin instance. The config is
+// set once in setup6 and never modified afterwards.
+type plugin6 struct {
+	config
+	responseCache *responsecache.Cache[[]dhcpv6.Option]
+	log           *logrus.Entry
+}
+
 func parseArgs(args ...string) (*url.URL, bool, error) {
-	if len(args) != 1 {
-		return nil, false, fmt.Errorf("exactly one argument must be passed to the httpboot plugin, got %d", len(args))
+	if len(args) < 1 || len(args) > 2 {
+		return nil, false, fmt.Errorf("one or two arguments must be passed to the httpboot plugin, got %d", len(args))
 	}
 	arg := args[0]
 	useBootService := strings.HasPrefix(arg, "bootservice:")
@@ -52,120 +78,233 @@ func parseArgs(args ...string) (*url.URL, bool, error) {
 	return parsedURL, useBootService, nil
 }
 
-func setup6(args ...string) (handler.Handler6, error) {
+// newConfig parses the arguments of the instance with the given name.
+func newConfig(name string, args ...string) (config, error) {
+	bootOperator, args, err := bootoperator.ParseArgs(args...)
+	if err != nil {
+		return config{}, &fedhcperrors.ConfigError{Err: err}
+	}
 	u, ubs, err := parseArgs(args...)
 	if err != nil {
-		return nil, fmt.Errorf("invalid configuration: %v", err)
+		return config{}, &fedhcperrors.ConfigError{Err: err}
+	}
+	maxConnections, err := parseMaxConnections(args...)
+	if err != nil {
+		return config{}, &fedhcperrors.ConfigError{Err: err}
+	}
+	c := config{bootFile: u.String(), useBootService: ubs, bootOperator: bootOperator}
+	if ubs {
+		c.bootService = newBootService(name, c.bootFile, maxConnections)
+	}
+	return c, nil
+}
+
+func setup6(args ...string) (handler.Handler6, error) {
+	name := instance.Next("httpboot/v6")
+	c, err := newConfig(name, args...)
+	if err != nil {
+		return nil, err
+	}
+	p := &plugin6{
+		config:        c,
+		responseCache: responsecache.NewOptions6(name, responsecache.DefaultTTL),
+		log:           log.WithField("instance", name),
+	}
+	// cached responses must not hold a UKI URL boot-operator has changed
+	if c.bootOperator != nil {
+		if err := c.bootOperator.OnUKIChange(p.responseCache.Clear); err != nil {
+			return nil, err
+		}
 	}
-	bootFile6 = u.String()
-	useBootService = ubs
-	log.Printf("Configured httpboot plugin with URL: %s, useBootService: %t", bootFile6, useBootService)
-	return handler6, nil
+	p.log.Printf("Configured httpboot plugin with URL: %s, useBootService: %t", p.bootFile, p.useBootService)
+	admin.State(name, func() any { return map[string]int{"responseCache": p.responseCache.Len()} })
+	return p.handler6, nil
 }
 
 func setup4(args ...string) (handler.Handler4, error) {
-	u, ubs, err := parseArgs(args...)
+	name := instance.Next("httpboot/v4")
+	c, err := newConfig(name, args...)
 	if err != nil {
-		return nil, fmt.Errorf("invalid configuration: %v", err)
+		return nil, err
+	}
+	p := &plugin4{
+		config:        c,
+		responseCache: responsecache.New[[]dhcpv4.Option](name, responsecache.DefaultTTL),
+		log:           log.WithField("instance", name),
 	}
-	bootFile4 = u.String()
-	useBootService = ubs
-	log.Printf("Configured httpboot plugin with URL: %s, useBootService: %t", bootFile4, useBootService)
-	return handler4, nil
+	// cached responses must not hold a UKI URL boot-operator has changed
+	if c.bootOperator != nil {
+		if err := c.bootOperator.OnUKIChange(p.responseCache.Clear); err != nil {
+			return nil, err
+		}
+	}
+	p.log.Printf("Configured httpboot plugin with URL: %s, useBootService: %t", p.bootFile, p.useBootService)
+	admin.State(name, func() any { return map[string]int{"responseCache": p.responseCache.Len()} })
+	return p.handler4, nil
 }
 
-func handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
-	log.Debugf("Received DHCPv6 request: %s", req.Summary())
+func (p *plugin6) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	printer.VerboseRequest(p.log, req)
 
-	var ukiURL string
-	if !useBootService {
-		ukiURL = bootFile6
-	} else {
-		clientIPs, err := extractClientIP6(req)
-		if err != nil {
-			log.Errorf("failed to extract ClientIP, Error: %v Request: %v ", err, req)
-			return resp, false
+	key, err := responsecache.Key6(req)
+	if err != nil {
+		p.log.Errorf("could not decapsulate request: %v", err)
+		return nil, true
+	}
+	if opts, ok := p.responseCache.Get(key); ok {
+		p.log.Debugf("Using %d cached option(s) for retransmitted request", len(opts))
+		for _, opt := range opts {
+			resp.AddOption(opt)
 		}
-		ukiURL, err = fetchUKIURL(bootFile6, clientIPs)
-		if err != nil {
-			log.Errorf("failed to fetch UKI URL: %v", err)
-			return resp, false
+		// the retransmission is served the boot file again
+		if len(opts) > 0 {
+			funnel.Record6(funnel.BootServed, req)
 		}
+		printer.VerboseResponse(p.log, req, resp)
+		return resp, false
 	}
 
 	decap, err := req.GetInnerMessage()
 	if err != nil {
-		log.Errorf("could not decapsulate request: %v", err)
+		p.log.Errorf("could not decapsulate request: %v", err)
 		return nil, true
 	}
 
-	if decap.GetOneOption(dhcpv6.OptionVendorClass) != nil {
-		optVendorClass := decap.GetOneOption(dhcpv6.OptionVendorClass)
-		log.Debugf("VendorClass: %s", optVendorClass.String())
-		vcc := optVendorClass.ToBytes()
-		if len(vcc) >= 16 && binary.BigEndian.Uint16(vcc[4:6]) >= 10 && string(vcc[6:16]) == httpClient {
-			bf := dhcpv6.OptBootFileURL(ukiURL)
-			resp.AddOption(bf)
-			log.Infof("Added option BootFileURL(%d): (%s)", dhcpv6.OptionBootfileURL, ukiURL)
-
-			buf := []byte(httpClient)
-			vc := &dhcpv6.OptVendorClass{
-				EnterpriseNumber: 0,
-				Data:             [][]byte{buf},
-			}
-			resp.AddOption(vc)
-			log.Infof("Added option VendorClass %s", vc.String())
-		} else {
-			log.Errorf("non HTTPClient VendorClass %s", optVendorClass.String())
+	optVendorClass := decap.GetOneOption(dhcpv6.OptionVendorClass)
+	if optVendorClass == nil {
+		p.responseCache.Put(key, nil)
+		printer.VerboseResponse(p.log, req, resp)
+		return resp, false
+	}
+
+	p.log.Debugf("VendorClass: %s", optVendorClass.String())
+	vcc := optVendorClass.ToBytes()
+	if len(vcc) < 16 || binary.BigEndian.Uint16(vcc[4:6]) < 10 || string(vcc[6:16]) != httpClient {
+		p.log.Errorf("non HTTPClient VendorClass %s", optVendorClass.String())
+		p.responseCache.Put(key, nil)
+		return resp, false
+	}
+
+	ukiURL := p.lookupUKIURL(p.log, bootoperator.Identifiers6(req, resp))
+	switch {
+	case ukiURL != "":
+		p.log.Debugf("Using UKI URL rendered by boot-operator")
+	case !p.useBootService:
+		ukiURL = p.bootFile
+	default:
+		clientIPs, err := extractClientIP6(req)
+		if err != nil {
+			p.log.Errorf("failed to extract ClientIP, Error: %v Request: %v ", err, req)
+			return resp, false
+		}
+		ukiURL, err = p.bootService.fetchUKIURL(clientIPs)
+		if err != nil {
+			p.log.Errorf("failed to fetch UKI URL: %v", err)
 			return resp, false
 		}
 	}
 
-	log.Debugf("Sent DHCPv6 response: %s", resp.Summary())
+	bf := dhcpv6.OptBootFileURL(ukiURL)
+	resp.AddOption(bf)
+	p.log.Infof("Added option BootFileURL(%d): (%s)", dhcpv6.OptionBootfileURL, ukiURL)
+	funnel.Record6(funnel.BootServed, req)
+
+	buf := []byte(httpClient)
+	vc := &dhcpv6.OptVendorClass{
+		EnterpriseNumber: 0,
+		Data:             [][]byte{buf},
+	}
+	resp.AddOption(vc)
+	p.log.Infof("Added option VendorClass %s", vc.String())
+
+	p.responseCache.Put(key, []dhcpv6.Option{bf, vc})
+
+	printer.VerboseResponse(p.log, req, resp)
 	return resp, false
 }
 
-func handler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
-	log.Debugf("Received DHCPv4 request: %s", req.Summary())
+func (p *plugin4) handler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	printer.VerboseRequest(p.log, req)
+
+	key := responsecache.Key4(req)
+	if opts, ok := p.responseCache.Get(key); ok {
+		p.log.Debugf("Using %d cached option(s) for retransmitted request", len(opts))
+		for _, opt := range opts {
+			resp.Options.Update(opt)
+		}
+		// the retransmission is served the boot file again
+		if len(opts) > 0 {
+			funnel.Record(funnel.BootServed, req.ClientHWAddr)
+		}
+		printer.VerboseResponse(p.log, req, resp)
+		return resp, false
+	}
+
+	cic := req.GetOneOption(dhcpv4.OptionClassIdentifier)
+	if cic == nil {
+		p.responseCache.Put(key, nil)
+		printer.VerboseResponse(p.log, req, resp)
+		return resp, false
+	}
 
-	var ukiURL string
+	p.log.Debugf("ClassIdentifier: %s (%s)", string(cic), cic)
+	if len(cic) < 10 || string(cic[0:10]) != httpClient {
+		p.log.Errorf("non HTTPClient ClassIdentifier %s", string(cic))
+		p.responseCache.Put(key, nil)
+		return resp, false
+	}
+
+	ukiURL := p.lookupUKIURL(p.log, bootoperator.Identifiers4(req, resp))
 	var err error
-	if !useBootService {
-		ukiURL = bootFile4
-	} else {
-		ukiURL, err = fetchUKIURL(bootFile4, []string{req.ClientIPAddr.String()})
+	switch {
+	case ukiURL != "":
+		p.log.Debugf("Using UKI URL rendered by boot-operator")
+	case !p.useBootService:
+		ukiURL = p.bootFile
+	default:
+		ukiURL, err = p.bootService.fetchUKIURL([]string{req.ClientIPAddr.String()})
 		if err != nil {
-			log.Errorf("failed to fetch UKI URL: %v", err)
+			p.log.Errorf("failed to fetch UKI URL: %v", err)
 			return resp, false
 		}
 	}
 
-	if req.GetOneOption(dhcpv4.OptionClassIdentifier) != nil {
-		cic := req.GetOneOption(dhcpv4.OptionClassIdentifier)
-		log.Debugf("ClassIdentifier: %s (%s)", string(cic), cic)
-		if len(cic) >= 10 && string(cic[0:10]) == httpClient {
-			bf := &dhcpv4.Option{
-				Code:  dhcpv4.OptionBootfileName,
-				Value: dhcpv4.String(ukiURL),
-			}
-			resp.Options.Update(*bf)
-			log.Infof("Added option BooFileName %s", bf.String())
-
-			ci := &dhcpv4.Option{
-				Code:  dhcpv4.OptionClassIdentifier,
-				Value: dhcpv4.String(httpClient),
-			}
-			resp.Options.Update(*ci)
-			log.Infof("Added option ClassIdentifier %s", ci.String())
-		} else {
-			log.Errorf("non HTTPClient ClassIdentifier %s", string(cic))
-			return resp, false
-		}
+	bf := dhcpv4.Option{
+		Code:  dhcpv4.OptionBootfileName,
+		Value: dhcpv4.String(ukiURL),
+	}
+	resp.Options.Update(bf)
+	p.log.Infof("Added option BooFileName %s", bf.String())
+	funnel.Record(funnel.BootServed, req.ClientHWAddr)
+
+	ci := dhcpv4.Option{
+		Code:  dhcpv4.OptionClassIdentifier,
+		Value: dhcpv4.String(httpClient),
 	}
-	log.Debugf("Sent DHCPv4 response: %s", resp.Summary())
+	resp.Options.Update(ci)
+	p.log.Infof("Added option ClassIdentifier %s", ci.String())
+
+	p.responseCache.Put(key, []dhcpv4.Option{bf, ci})
+
+	printer.VerboseResponse(p.log, req, resp)
 	return resp, false
 }
 
+// lookupUKIURL returns the UKI URL boot-operator rendered for the client, the
+// empty string if the lookup is disabled or the client has none, so that the
+// configured URL is served.
+func (c config) lookupUKIURL(l *logrus.Entry, identifiers []string) string {
+	if c.bootOperator == nil {
+		return ""
+	}
+	ukiURL, err := c.bootOperator.UKIURL(identifiers...)
+	if err != nil {
+		l.Errorf("failed to look up UKI URL in boot-operator namespace %s: %v", c.bootOperator.Namespace(), err)
+		return ""
+	}
+	return ukiURL
+}
+
 func extractClientIP6(req dhcpv6.DHCPv6) ([]string, error) {
 	if req.IsRelay() {
 		relayMsg, ok := req.(*dhcpv6.RelayMessage)
@@ -190,41 +329,3 @@ func extractClientIP6(req dhcpv6.DHCPv6) ([]string, error) {
 	}
 	return nil, fmt.Errorf("received non-relay DHCPv6 request, client IP cannot be extracted from non-relayed messages")
 }
-
-func fetchUKIURL(url string, clientIPs []string) (string, error) {
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", err
-	}
-
-	xForwardedFor := strings.Join(clientIPs, ", ")
-	req.Header.Set("X-Forwarded-For", xForwardedFor)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Errorf("HTTP request failed: %v", err)
-		return "", err
-	}
-	defer func() {
-		_ = resp.Body.Close()
-	}()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-
-	var data struct {
-		UKIURL string `json:"UKIURL"`
-	}
-	if err := json.Unmarshal(body, &data); err != nil {
-		return "", err
-	}
-
-	if data.UKIURL == "" {
-		return "", fmt.Errorf("received empty UKI URL")
-	}
-
-	return data.UKIURL, nil
-}
@@ -5,17 +5,28 @@ package httpboot
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/coredhcp/coredhcp/handler"
 	"github.com/insomniacslk/dhcp/dhcpv4"
 	"github.com/insomniacslk/dhcp/dhcpv6"
 	"github.com/insomniacslk/dhcp/iana"
+	"github.com/ironcore-dev/fedhcp/internal/funnel"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes/fake"
+	"github.com/ironcore-dev/fedhcp/internal/responsecache"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 const (
@@ -34,26 +45,28 @@ var (
 	expectedHTTPClient = []byte("HTTPClient")
 )
 
-func Init4(bootURL string) {
-	_, err := setup4(bootURL)
+func Init4(bootURL string) handler.Handler4 {
+	h, err := setup4(bootURL)
 	if err != nil {
 		log.Fatal(err)
 	}
+	return h
 }
 
-func Init6(bootURL string) {
-	_, err := setup6(bootURL)
+func Init6(bootURL string) handler.Handler6 {
+	h, err := setup6(bootURL)
 	if err != nil {
 		log.Fatal(err)
 	}
+	return h
 }
 
 /* parametrization */
 
 func TestWrongNumberArgs(t *testing.T) {
-	_, _, err := parseArgs("foo", "bar")
+	_, _, err := parseArgs("foo", "bar", "baz")
 	if err == nil {
-		t.Fatal("no error occurred when providing wrong number of args (2), but it should have")
+		t.Fatal("no error occurred when providing wrong number of args (3), but it should have")
 	}
 
 	_, _, err = parseArgs()
@@ -81,9 +94,70 @@ func TestWrongArgs(t *testing.T) {
 	}
 }
 
+func TestMaxConnections(t *testing.T) {
+	bootURL := fmt.Sprintf(bootServiceEndpoint, bootServicePort)
+	for _, wrongArg := range []string{"maxConnections=0", "maxConnections=foo", "foo=1"} {
+		if _, err := setup6(bootURL, wrongArg); err == nil {
+			t.Fatalf("no error occurred when parsing wrong param %s, but it should have", wrongArg)
+		}
+	}
+
+	c, err := newConfig("httpboot/test", bootURL, "maxConnections=8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := c.bootService.client.Transport.(*http.Transport)
+	if transport.MaxConnsPerHost != 8 || transport.MaxIdleConnsPerHost != 8 {
+		t.Errorf("expected 8 connections, got %d (%d idle)", transport.MaxConnsPerHost, transport.MaxIdleConnsPerHost)
+	}
+
+	c, err = newConfig("httpboot/test", expectedGenericBootURL, "maxConnections=8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.bootService != nil {
+		t.Error("boot service client created without boot service, but it shouldn't have")
+	}
+}
+
+func TestBootServiceMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Forwarded-For") != "2001:db8::1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"UKIURL": "` + expectedCustomBootURL + `"}`))
+	}))
+	defer server.Close()
+
+	b := newBootService("httpboot/test", server.URL, defaultMaxConnections)
+	ok := testutil.ToFloat64(bootServiceRequests.WithLabelValues("httpboot/test", "200"))
+	notFound := testutil.ToFloat64(bootServiceRequests.WithLabelValues("httpboot/test", "404"))
+
+	for i := 0; i < 3; i++ {
+		ukiURL, err := b.fetchUKIURL([]string{"2001:db8::1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ukiURL != expectedCustomBootURL {
+			t.Errorf("expected UKI URL %s, got %s", expectedCustomBootURL, ukiURL)
+		}
+	}
+	if _, err := b.fetchUKIURL([]string{"2001:db8::2"}); err == nil {
+		t.Error("no error occurred for an unknown client, but it should have")
+	}
+
+	if got := testutil.ToFloat64(bootServiceRequests.WithLabelValues("httpboot/test", "200")) - ok; got != 3 {
+		t.Errorf("expected 3 successful requests, got %v", got)
+	}
+	if got := testutil.ToFloat64(bootServiceRequests.WithLabelValues("httpboot/test", "404")) - notFound; got != 1 {
+		t.Errorf("expected 1 failed request, got %v", got)
+	}
+}
+
 /* IPv6 */
 func TestGenericHTTPBootRequested6(t *testing.T) {
-	Init6(expectedGenericBootURL)
+	handler6 := Init6(expectedGenericBootURL)
 
 	req, err := dhcpv6.NewMessage()
 	if err != nil {
@@ -141,7 +215,7 @@ func TestGenericHTTPBootRequested6(t *testing.T) {
 }
 
 func TestMalformedHTTPBootRequested6(t *testing.T) {
-	Init6(expectedGenericBootURL)
+	handler6 := Init6(expectedGenericBootURL)
 
 	req, err := dhcpv6.NewMessage()
 	if err != nil {
@@ -210,7 +284,7 @@ func TestMalformedHTTPBootRequested6(t *testing.T) {
 }
 
 func TestHTTPBootNotRequested6(t *testing.T) {
-	Init6(expectedGenericBootURL)
+	handler6 := Init6(expectedGenericBootURL)
 
 	req, err := dhcpv6.NewMessage()
 	if err != nil {
@@ -251,7 +325,7 @@ func TestHTTPBootNotRequested6(t *testing.T) {
 }
 
 func TestHTTPBootNotRelayedMsg6(t *testing.T) {
-	Init6(expectedGenericBootURL)
+	handler6 := Init6(expectedGenericBootURL)
 
 	req, err := dhcpv6.NewMessage()
 	if err != nil {
@@ -285,9 +359,87 @@ func TestHTTPBootNotRelayedMsg6(t *testing.T) {
 	}
 }
 
+func TestRetransmittedHTTPBootRequestCached6(t *testing.T) {
+	p := &plugin6{
+		config:        config{bootFile: expectedGenericBootURL},
+		responseCache: responsecache.New[[]dhcpv6.Option]("httpboot/test", responsecache.DefaultTTL),
+		log:           log,
+	}
+
+	req, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.MessageType = dhcpv6.MessageTypeRequest
+	req.AddOption(dhcpv6.OptRequestedOption(dhcpv6.OptionBootfileURL))
+	optVendorClass := dhcpv6.OptVendorClass{}
+	buf := []byte{
+		0, 0, 5, 57, // nice "random" enterprise number, can be ignored
+		0, 10, // length ot vendor class
+		'H', 'T', 'T', 'P', 'C', 'l', 'i', 'e', 'n', 't', // vendor class
+	}
+	_ = optVendorClass.FromBytes(buf)
+	req.UpdateOption(&optVendorClass)
+
+	for i := 0; i < 2; i++ {
+		stub, err := dhcpv6.NewMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stub.MessageType = dhcpv6.MessageTypeReply
+
+		resp, _ := p.handler6(req, stub)
+		if resp == nil {
+			t.Fatal("plugin did not return a message")
+		}
+
+		bootFileURL := resp.(*dhcpv6.Message).Options.BootFileURL()
+		if bootFileURL != expectedGenericBootURL {
+			t.Errorf("Found BootFileURL %s, expected %s", bootFileURL, expectedGenericBootURL)
+		}
+
+		// a retransmission must be answered from the cache, not from the (changed) configuration
+		p.bootFile = expectedDefaultCustomBootURL
+	}
+}
+
+func TestMultipleInstances6(t *testing.T) {
+	handlerGeneric := Init6(expectedGenericBootURL)
+	handlerDefault := Init6(expectedDefaultCustomBootURL)
+
+	for h, expectedBootURL := range map[*handler.Handler6]string{
+		&handlerGeneric: expectedGenericBootURL,
+		&handlerDefault: expectedDefaultCustomBootURL,
+	} {
+		req, err := dhcpv6.NewMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.MessageType = dhcpv6.MessageTypeRequest
+		req.AddOption(dhcpv6.OptRequestedOption(dhcpv6.OptionBootfileURL))
+		req.UpdateOption(&dhcpv6.OptVendorClass{EnterpriseNumber: 1337, Data: [][]byte{expectedHTTPClient}})
+
+		stub, err := dhcpv6.NewMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stub.MessageType = dhcpv6.MessageTypeReply
+
+		resp, _ := (*h)(req, stub)
+		if resp == nil {
+			t.Fatal("plugin did not return a message")
+		}
+
+		bootFileURL := resp.(*dhcpv6.Message).Options.BootFileURL()
+		if bootFileURL != expectedBootURL {
+			t.Errorf("Found BootFileURL %s, expected %s", bootFileURL, expectedBootURL)
+		}
+	}
+}
+
 /* IPv4 */
 func TestGenericHTTPBootRequested4(t *testing.T) {
-	Init4(expectedGenericBootURL)
+	handler4 := Init4(expectedGenericBootURL)
 
 	req, err := dhcpv4.NewDiscovery(net.HardwareAddr{
 		0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
@@ -324,8 +476,80 @@ func TestGenericHTTPBootRequested4(t *testing.T) {
 	}
 }
 
+func TestRetransmittedHTTPBootRequestRecorded4(t *testing.T) {
+	handler4 := Init4(expectedGenericBootURL)
+	mac := net.HardwareAddr{0xaa, 0xbb, 0x01, 0xdd, 0xee, 0xff}
+	served := funnel.Events(funnel.BootServed, mac)
+	before := testutil.ToFloat64(served)
+
+	req, err := dhcpv4.NewDiscovery(mac, dhcpv4.WithRequestedOptions(dhcpv4.OptionClassIdentifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.UpdateOption(dhcpv4.OptClassIdentifier("HTTPClient"))
+	for i := 0; i < 2; i++ {
+		stub, err := dhcpv4.NewReplyFromRequest(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp, _ := handler4(req, stub); dhcpv4.GetString(dhcpv4.OptionBootfileName, resp.Options) != expectedGenericBootURL {
+			t.Fatalf("expected boot file name %s in response %d", expectedGenericBootURL, i)
+		}
+	}
+
+	// the retransmission is answered from the cache and counted as well
+	if got := testutil.ToFloat64(served) - before; got != 2 {
+		t.Errorf("expected 2 boot served events, got %v", got)
+	}
+}
+
+func TestBootOperatorHTTPBootRequested4(t *testing.T) {
+	ukiConfig := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"systemIPs": []interface{}{"aa:bb:cc:dd:ee:ff"},
+			"ukiURL":    expectedCustomBootURL,
+		},
+		"status": map[string]interface{}{"state": "Ready"},
+	}}
+	ukiConfig.SetGroupVersionKind(schema.GroupVersionKind{Group: "boot.ironcore.dev", Version: "v1alpha1", Kind: "HTTPBootConfig"})
+	ukiConfig.SetNamespace("boot")
+	ukiConfig.SetName("server1")
+	var cl client.Client = fake.NewClient()
+	if err := cl.Create(context.Background(), ukiConfig); err != nil {
+		t.Fatal(err)
+	}
+	kubernetes.SetClient(&cl)
+	defer kubernetes.SetClient(new(client.Client))
+
+	handler4, err := setup4(expectedGenericBootURL, "bootoperator=boot")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for mac, expected := range map[string]string{
+		"aa:bb:cc:dd:ee:ff": expectedCustomBootURL,
+		"aa:bb:cc:dd:ee:00": expectedGenericBootURL,
+	} {
+		hwAddr, _ := net.ParseMAC(mac)
+		req, err := dhcpv4.NewDiscovery(hwAddr, dhcpv4.WithRequestedOptions(dhcpv4.OptionClassIdentifier))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.UpdateOption(dhcpv4.OptClassIdentifier("HTTPClient"))
+		stub, err := dhcpv4.NewReplyFromRequest(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, _ := handler4(req, stub)
+		if bootFileName := dhcpv4.GetString(dhcpv4.OptionBootfileName, resp.Options); bootFileName != expected {
+			t.Errorf("Found BootFileName %s for %s, expected %s", bootFileName, mac, expected)
+		}
+	}
+}
+
 func TestMalformedHTTPBootRequested4(t *testing.T) {
-	Init4(expectedGenericBootURL)
+	handler4 := Init4(expectedGenericBootURL)
 
 	req, err := dhcpv4.NewDiscovery(net.HardwareAddr{
 		0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
@@ -393,7 +617,7 @@ func TestMalformedHTTPBootRequested4(t *testing.T) {
 }
 
 func TestHTTPBootNotRequested4(t *testing.T) {
-	Init4(expectedGenericBootURL)
+	handler4 := Init4(expectedGenericBootURL)
 
 	req, err := dhcpv4.NewDiscovery(net.HardwareAddr{
 		0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
@@ -434,7 +658,7 @@ func TestCustomHTTPBootRequestedKnownIP(t *testing.T) {
 	go startBootServiceMock()
 	time.Sleep(time.Second * 1)
 
-	Init6(fmt.Sprintf(bootServiceEndpoint, bootServicePort))
+	handler6 := Init6(fmt.Sprintf(bootServiceEndpoint, bootServicePort))
 	req, err := dhcpv6.NewMessage()
 	if err != nil {
 		t.Fatal(err)
@@ -505,15 +729,15 @@ func TestCustomHTTPBootRequestedKnownMAC(t *testing.T) {
 	// known LinkLayerAddress
 	macAddress, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
 
-	err, relayedRequest := createHTTPBootRequest(t)
+	handler6, err, relayedRequest := createHTTPBootRequest(t)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	ensureBootURL(t, macAddress, relayedRequest, expectedCustomBootURL)
+	ensureBootURL(t, handler6, macAddress, relayedRequest, expectedCustomBootURL)
 }
 
-func ensureBootURL(t *testing.T, macAddress net.HardwareAddr, relayedRequest *dhcpv6.RelayMessage, expectedBootURL string) {
+func ensureBootURL(t *testing.T, handler6 handler.Handler6, macAddress net.HardwareAddr, relayedRequest *dhcpv6.RelayMessage, expectedBootURL string) {
 	opt := dhcpv6.OptClientLinkLayerAddress(iana.HWTypeEthernet, macAddress)
 	relayedRequest.AddOption(opt)
 
@@ -561,16 +785,16 @@ func TestCustomHTTPBootRequestedUnknownClient(t *testing.T) {
 	// not known LinkLayerAddress
 	macAddress, _ := net.ParseMAC("11:22:33:44:55:66")
 
-	err, relayedRequest := createHTTPBootRequest(t)
+	handler6, err, relayedRequest := createHTTPBootRequest(t)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	ensureBootURL(t, macAddress, relayedRequest, expectedDefaultCustomBootURL)
+	ensureBootURL(t, handler6, macAddress, relayedRequest, expectedDefaultCustomBootURL)
 }
 
-func createHTTPBootRequest(t *testing.T) (error, *dhcpv6.RelayMessage) {
-	Init6(fmt.Sprintf(bootServiceEndpoint, bootServicePort))
+func createHTTPBootRequest(t *testing.T) (handler.Handler6, error, *dhcpv6.RelayMessage) {
+	handler6 := Init6(fmt.Sprintf(bootServiceEndpoint, bootServicePort))
 	req, err := dhcpv6.NewMessage()
 	if err != nil {
 		t.Fatal(err)
@@ -592,11 +816,11 @@ func createHTTPBootRequest(t *testing.T) (error, *dhcpv6.RelayMessage) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	return err, relayedRequest
+	return handler6, err, relayedRequest
 }
 
 func TestNoRelayCustomHTTPBootRequested(t *testing.T) {
-	Init6(fmt.Sprintf(bootServiceEndpoint, bootServicePort))
+	handler6 := Init6(fmt.Sprintf(bootServiceEndpoint, bootServicePort))
 
 	req, err := dhcpv6.NewMessage()
 	if err != nil {
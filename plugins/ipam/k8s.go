@@ -9,20 +9,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
-	"os"
 	"reflect"
 	"strings"
 
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
 	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/ironcore-dev/fedhcp/internal/subnets"
 	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
-	ipam "github.com/ironcore-dev/ipam/clientgo/ipam"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/watch"
-	"k8s.io/client-go/kubernetes/scheme"
-	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -32,110 +30,57 @@ const (
 )
 
 type K8sClient struct {
-	Client        client.Client
-	Clientset     ipam.Clientset
-	Namespace     string
-	SubnetNames   []string
+	Client client.Client
+	// Watcher watches the IPs deleted by Client
+	Watcher   client.WithWatch
+	Namespace string
+	Subnets   *subnets.Selector
+	// Ctx is cancelled on server shutdown, the requests derive their contexts from it
 	Ctx           context.Context
 	EventRecorder record.EventRecorder
 }
 
-func NewK8sClient(namespace string, subnetNames []string) (*K8sClient, error) {
-	cfg := kubernetes.GetConfig()
-	cl := kubernetes.GetClient()
-
-	clientset, err := ipam.NewForConfig(cfg)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create IPAM clientset: %w", err)
-	}
-
-	corev1Client, err := corev1client.NewForConfig(cfg)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create core client: %w", err)
-	}
-
-	broadcaster := record.NewBroadcaster()
-
-	// Leader id, needs to be unique
-	id, err := os.Hostname()
+func NewK8sClient(selector *subnets.Selector) (*K8sClient, error) {
+	recorder, err := kubernetes.NewEventRecorder()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get hostname: %w", err)
+		return nil, err
 	}
-	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: id})
-	broadcaster.StartRecordingToSink(&corev1client.EventSinkImpl{Interface: corev1Client.Events("")})
 
 	k8sClient := K8sClient{
-		Client:        cl,
-		Clientset:     *clientset,
-		Namespace:     namespace,
-		SubnetNames:   subnetNames,
-		Ctx:           context.Background(),
+		Client:        kubernetes.GetClient(),
+		Watcher:       kubernetes.GetWatchClient(),
+		Namespace:     selector.Namespace(),
+		Subnets:       selector,
+		Ctx:           kubernetes.Context(),
 		EventRecorder: recorder,
 	}
 	return &k8sClient, nil
 }
 
-func (k K8sClient) createIpamIP(ipaddr net.IP, mac net.HardwareAddr) error {
-	// select the subnet matching the CIDR of the request
-	subnetMatch := false
-	for _, subnetName := range k.SubnetNames {
-		subnet, err := k.getMatchingSubnet(subnetName, ipaddr)
-		if err != nil {
-			return err
-		}
-		if subnet == nil {
-			continue
-		}
-		log.Debugf("Selecting subnet %s/%s", k.Namespace, subnetName)
-		subnetMatch = true
-
-		var ipamIP *ipamv1alpha1.IP
-		ipamIP, err = k.prepareCreateIpamIP(subnetName, ipaddr, mac)
-		if err != nil {
-			return err
-		}
-		if ipamIP != nil {
-			err = k.doCreateIpamIP(ipamIP)
-			if err != nil {
-				return err
-			}
-		}
-		// break at first subnet match, there can be only one
-		break
+func (k K8sClient) createIpamIP(ctx context.Context, ipaddr net.IP, mac net.HardwareAddr) error {
+	// select the first subnet matching the CIDR of the request, there can be only one
+	subnet, err := k.Subnets.Match(ctx, ipaddr, ipamv1alpha1.CIPv6SubnetType)
+	if err != nil {
+		return err
 	}
-
-	if !subnetMatch {
+	if subnet == nil {
 		log.Warningf("No matching subnet found for IP %s/%s", k.Namespace, ipaddr)
+		return nil
 	}
+	log.Debugf("Selecting subnet %s/%s", k.Namespace, subnet.Name)
 
-	return nil
-}
-
-func (k K8sClient) getMatchingSubnet(subnetName string, ipaddr net.IP) (*ipamv1alpha1.Subnet, error) {
-	subnet := &ipamv1alpha1.Subnet{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      subnetName,
-			Namespace: k.Namespace,
-		},
-	}
-	existingSubnet := subnet.DeepCopy()
-	err := k.Client.Get(k.Ctx, client.ObjectKeyFromObject(subnet), existingSubnet)
-	if err != nil && !apierrors.IsNotFound(err) {
-		return nil, fmt.Errorf("failed to get subnet %s/%s: %w", k.Namespace, subnetName, err)
-	}
-	if apierrors.IsNotFound(err) {
-		log.Debugf("Cannot select subnet %s/%s, does not exist", k.Namespace, subnetName)
-		return nil, nil
+	ipamIP, err := k.prepareCreateIpamIP(ctx, subnet.Name, ipaddr, mac)
+	if err != nil {
+		return err
 	}
-	if !checkIPv6InCIDR(ipaddr, existingSubnet.Status.Reserved.String()) {
-		log.Debugf("Cannot select subnet %s/%s, CIDR mismatch", k.Namespace, subnetName)
-		return nil, nil
+	if ipamIP != nil {
+		return k.doCreateIpamIP(ctx, ipamIP)
 	}
-
-	return subnet, nil
+	return nil
 }
 
 func (k K8sClient) prepareCreateIpamIP(
+	ctx context.Context,
 	subnetName string,
 	ipaddr net.IP,
 	mac net.HardwareAddr) (*ipamv1alpha1.IP, error) {
@@ -169,9 +114,10 @@ func (k K8sClient) prepareCreateIpamIP(
 	}
 
 	existingIpamIP := ipamIP.DeepCopy()
-	err = k.Client.Get(k.Ctx, client.ObjectKeyFromObject(ipamIP), existingIpamIP)
+	err = k.Client.Get(ctx, client.ObjectKeyFromObject(ipamIP), existingIpamIP)
 	if err != nil && !apierrors.IsNotFound(err) {
-		return nil, fmt.Errorf("failed to get IP %s/%s: %w", existingIpamIP.Namespace, existingIpamIP.Name, err)
+		return nil, fmt.Errorf("failed to get IP %s/%s: %w", existingIpamIP.Namespace, existingIpamIP.Name,
+			fedhcperrors.FromK8s(err))
 	}
 
 	// create IPAM IP if not exists or delete existing if ip differs
@@ -183,13 +129,13 @@ func (k K8sClient) prepareCreateIpamIP(
 				prettyFormat(ipamIP.Spec))
 			log.Infof("Deleting old IP %s/%s", existingIpamIP.Namespace, existingIpamIP.Name)
 			// delete old IP object
-			err = k.Client.Delete(k.Ctx, existingIpamIP)
+			err = k.Client.Delete(ctx, existingIpamIP)
 			if err != nil {
 				return nil, fmt.Errorf("failed to delete IP %s/%s: %w", existingIpamIP.Namespace,
-					existingIpamIP.Name, err)
+					existingIpamIP.Name, fedhcperrors.FromK8s(err))
 			}
 
-			err = k.waitForDeletion(existingIpamIP)
+			err = k.waitForDeletion(ctx, existingIpamIP)
 			if err != nil {
 				return nil, fmt.Errorf("failed to delete IP %s/%s: %w", existingIpamIP.Namespace,
 					existingIpamIP.Name, err)
@@ -208,39 +154,45 @@ func (k K8sClient) prepareCreateIpamIP(
 	return ipamIP, nil
 }
 
-func (k K8sClient) waitForDeletion(ipamIP *ipamv1alpha1.IP) error {
+func (k K8sClient) waitForDeletion(ctx context.Context, ipamIP *ipamv1alpha1.IP) error {
 	// Define the namespace and resource name (if you want to watch a specific resource)
 	namespace := ipamIP.Namespace
 	resourceName := ipamIP.Name
-	fieldSelector := "metadata.name=" + resourceName + ",metadata.namespace=" + namespace
 	timeout := int64(5)
 
 	// watch for deletion finished event
-	watcher, err := k.Clientset.IpamV1alpha1().IPs(namespace).Watch(context.TODO(), metav1.ListOptions{
-		FieldSelector:  fieldSelector,
-		TimeoutSeconds: &timeout,
-	})
+	watcher, err := k.Watcher.Watch(ctx, &ipamv1alpha1.IPList{}, client.InNamespace(namespace),
+		client.MatchingFields{"metadata.name": resourceName}, &client.ListOptions{Raw: &metav1.ListOptions{TimeoutSeconds: &timeout}})
 	if err != nil {
-		log.Errorf("Error watching for IP: %v", err)
+		return fmt.Errorf("error watching for IP: %w", fedhcperrors.FromK8s(err))
 	}
+	defer watcher.Stop()
 
 	log.Debugf("Watching for changes to IP %s/%s...", namespace, resourceName)
 
-	for event := range watcher.ResultChan() {
-		log.Debugf("Type: %s, Object: %v\n", event.Type, event.Object)
-		foundIpamIP := event.Object.(*ipamv1alpha1.IP)
-		if event.Type == watch.Deleted && reflect.DeepEqual(ipamIP.Spec, foundIpamIP.Spec) {
-			log.Infof("IP %s/%s deleted", foundIpamIP.Namespace, foundIpamIP.Name)
-			return nil
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("IP not deleted: %w", ctx.Err())
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return errors.New("timeout reached, IP not deleted")
+			}
+			log.Debugf("Type: %s, Object: %v\n", event.Type, event.Object)
+			foundIpamIP, ok := event.Object.(*ipamv1alpha1.IP)
+			if ok && event.Type == watch.Deleted && foundIpamIP.Name == resourceName &&
+				reflect.DeepEqual(ipamIP.Spec, foundIpamIP.Spec) {
+				log.Infof("IP %s/%s deleted", foundIpamIP.Namespace, foundIpamIP.Name)
+				return nil
+			}
 		}
 	}
-	return errors.New("timeout reached, IP not deleted")
 }
 
-func (k K8sClient) doCreateIpamIP(ipamIP *ipamv1alpha1.IP) error {
-	err := k.Client.Create(k.Ctx, ipamIP)
+func (k K8sClient) doCreateIpamIP(ctx context.Context, ipamIP *ipamv1alpha1.IP) error {
+	err := k.Client.Create(ctx, ipamIP)
 	if err != nil && !apierrors.IsAlreadyExists(err) {
-		return fmt.Errorf("failed to create IP %s/%s: %w", ipamIP.Namespace, ipamIP.Name, err)
+		return fmt.Errorf("failed to create IP %s/%s: %w", ipamIP.Namespace, ipamIP.Name, fedhcperrors.FromK8s(err))
 	}
 	if apierrors.IsAlreadyExists(err) {
 		// do not create IP, because the deletion is not yet ready
@@ -280,16 +232,4 @@ func prettyFormat(ipSpec ipamv1alpha1.IPSpec) string {
 	return string(jsonBytes)
 }
 
-func checkIPv6InCIDR(ip net.IP, cidrStr string) bool {
-	// Parse the CIDR string
-	_, cidrNet, err := net.ParseCIDR(cidrStr)
-	if err != nil {
-		log.Errorf("Error parsing CIDR: %v\n", err)
-		return false
-	}
-
-	// Check if the CIDR contains the IP
-	return cidrNet.Contains(ip)
-}
-
 func noop() {}
@@ -4,20 +4,26 @@
 package ipam
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/coredhcp/coredhcp/handler"
 	"github.com/coredhcp/coredhcp/logger"
 	"github.com/coredhcp/coredhcp/plugins"
 
 	"net"
-	"os"
 
 	"github.com/insomniacslk/dhcp/dhcpv6"
 	"github.com/ironcore-dev/fedhcp/internal/api"
-	"gopkg.in/yaml.v3"
-
-	"github.com/mdlayher/netx/eui64"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/ironcore-dev/fedhcp/internal/printer"
+	"github.com/ironcore-dev/fedhcp/internal/relay"
+	"github.com/ironcore-dev/fedhcp/internal/segment"
+	"github.com/ironcore-dev/fedhcp/internal/subnets"
+	"github.com/sirupsen/logrus"
 )
 
 var log = logger.GetLogger("plugins/ipam")
@@ -27,9 +33,13 @@ var Plugin = plugins.Plugin{
 	Setup6: setup6,
 }
 
-var (
+// plugin holds the state of a single ipam plugin instance. It is built once
+// in setup and never modified afterwards.
+type plugin struct {
 	k8sClient *K8sClient
-)
+	timeout   time.Duration
+	log       *logrus.Entry
+}
 
 // args[0] = path to config file
 func parseArgs(args ...string) (string, error) {
@@ -42,18 +52,19 @@ func parseArgs(args ...string) (string, error) {
 func loadConfig(args ...string) (*api.IPAMConfig, error) {
 	path, err := parseArgs(args...)
 	if err != nil {
-		return nil, fmt.Errorf("invalid configuration: %v", err)
+		return nil, &fedhcperrors.ConfigError{Err: err}
 	}
 
 	log.Debugf("Reading ipam config file %s", path)
-	configData, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %v", err)
-	}
-
 	config := &api.IPAMConfig{}
-	if err = yaml.Unmarshal(configData, config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %v", err)
+	if err := api.Load(path, config); err != nil {
+		return nil, err
+	}
+	if config.Timeout < 0 {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("timeout must not be negative, got %s", config.Timeout)}
+	}
+	if config.Timeout == 0 {
+		config.Timeout = kubernetes.DefaultTimeout
 	}
 	return config, nil
 }
@@ -64,29 +75,38 @@ func setup6(args ...string) (handler.Handler6, error) {
 		return nil, err
 	}
 
-	k8sClient, err = NewK8sClient(ipamConfig.Namespace, ipamConfig.Subnets)
+	name := instance.Next("ipam/v6")
+	selector, err := subnets.New(name, ipamConfig.Namespace, ipamConfig.Subnets, ipamConfig.SubnetLabel)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+	k8sClient, err := NewK8sClient(selector)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create k8s client: %w", err)
 	}
 
-	log.Printf("Loaded ipam plugin for DHCPv6.")
-	return handler6, nil
+	p := &plugin{
+		k8sClient: k8sClient,
+		timeout:   ipamConfig.Timeout,
+		log:       log.WithField("instance", name),
+	}
+	p.log.Printf("Loaded ipam plugin for DHCPv6.")
+	return p.handler6, nil
 }
 
-func handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
-	log.Debugf("received DHCPv6 packet: %s", req.Summary())
+func (p *plugin) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	printer.VerboseRequest(p.log, req)
 
 	if !req.IsRelay() {
-		log.Printf("Received non-relay DHCPv6 request. Dropping.")
+		p.log.Printf("Received non-relay DHCPv6 request. Dropping.")
 		return nil, true
 	}
 
 	relayMsg := req.(*dhcpv6.RelayMessage)
 
-	// Retrieve IPv6 prefix and MAC address from IPv6 address
-	_, mac, err := eui64.ParseIP(relayMsg.PeerAddr)
+	mac, err := relay.ClientMAC(req)
 	if err != nil {
-		log.Errorf("Could not parse peer address: %s", err)
+		p.log.Errorf("Could not determine client MAC address: %s", err)
 		return nil, true
 	}
 
@@ -94,10 +114,18 @@ func handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
 	copy(ipaddr, relayMsg.LinkAddr)
 	ipaddr[len(ipaddr)-1] += 1
 
-	log.Infof("Generated IP address %s for mac %s", ipaddr.String(), mac.String())
-	err = k8sClient.createIpamIP(ipaddr, mac)
+	p.log.Infof("Generated IP address %s for mac %s", ipaddr.String(), mac.String())
+	ctx, cancel := context.WithTimeout(p.k8sClient.Ctx, p.timeout)
+	defer cancel()
+	release, err := segment.Acquire(ctx, segment.Of6(req))
+	if err != nil {
+		p.log.Errorf("Could not acquire write slot: %s", err)
+		return nil, true
+	}
+	defer release()
+	err = p.k8sClient.createIpamIP(ctx, ipaddr, mac)
 	if err != nil {
-		log.Errorf("Could not create IPAM IP: %s", err)
+		p.log.WithFields(fedhcperrors.Fields(err)).Errorf("Could not create IPAM IP: %s", err)
 		return nil, true
 	}
 
@@ -0,0 +1,146 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package ipam
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/api/apitest"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes/fake"
+	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const namespace = "ipam"
+
+var (
+	clientMAC = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+	linkAddr  = net.ParseIP("2001:db8:1::1")
+	// the address the plugin derives from linkAddr
+	expectedIP = net.ParseIP("2001:db8:1::2")
+)
+
+// Init returns a handler creating IPs in the subnet of linkAddr, on a fake
+// client set as the client of the server.
+func Init(t *testing.T) (handler.Handler6, client.Client) {
+	var cl client.Client = fake.NewClient(fake.NewIPAM(namespace).
+		WithSubnet("inband", "2001:db8:1::/64", map[string]string{"subnet": "inband"}))
+	kubernetes.SetClient(&cl)
+	t.Cleanup(func() { kubernetes.SetClient(new(client.Client)) })
+
+	h, err := setup6(apitest.WriteConfig(t, api.IPAMConfig{Namespace: namespace, SubnetLabel: "subnet=inband"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h, cl
+}
+
+func newRequest(t *testing.T, link net.IP) (*dhcpv6.RelayMessage, *dhcpv6.Message) {
+	req, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.MessageType = dhcpv6.MessageTypeSolicit
+	req.AddOption(dhcpv6.OptClientID(&dhcpv6.DUIDLL{HWType: iana.HWTypeEthernet, LinkLayerAddr: clientMAC}))
+
+	relayedRequest, err := dhcpv6.EncapsulateRelay(req, dhcpv6.MessageTypeRelayForward, link, net.ParseIP("fe80::1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	relayedRequest.AddOption(dhcpv6.OptClientLinkLayerAddress(iana.HWTypeEthernet, clientMAC))
+
+	stub, err := dhcpv6.NewAdvertiseFromSolicit(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return relayedRequest, stub
+}
+
+func listIPs(t *testing.T, cl client.Client) []ipamv1alpha1.IP {
+	ips := &ipamv1alpha1.IPList{}
+	if err := cl.List(context.Background(), ips, client.InNamespace(namespace)); err != nil {
+		t.Fatal(err)
+	}
+	return ips.Items
+}
+
+func TestWrongArgs(t *testing.T) {
+	if _, err := setup6(); err == nil {
+		t.Fatal("no error occurred when not providing a configuration file path, but it should have")
+	}
+	if _, err := setup6("foo", "bar"); err == nil {
+		t.Fatal("no error occurred when providing wrong number of args (2), but it should have")
+	}
+	for _, config := range []api.IPAMConfig{
+		{Namespace: namespace},
+		{Namespace: namespace, Subnets: []string{"inband"}, Timeout: -1},
+	} {
+		if _, err := setup6(apitest.WriteConfig(t, config)); err == nil {
+			t.Errorf("no error occurred for invalid config %+v, but it should have", config)
+		}
+	}
+}
+
+func TestIPCreated(t *testing.T) {
+	h, cl := Init(t)
+
+	// a retransmission finds the IP created already
+	for i := 0; i < 2; i++ {
+		req, stub := newRequest(t, linkAddr)
+		resp, stop := h(req, stub)
+		if resp == nil || stop {
+			t.Fatalf("expected the chain to continue, got %v (stop %t)", resp, stop)
+		}
+	}
+
+	ips := listIPs(t, cl)
+	if len(ips) != 1 {
+		t.Fatalf("expected 1 IP, got %d", len(ips))
+	}
+	ip := ips[0]
+	if ip.Name != getLongIPv6(expectedIP)+"-"+origin {
+		t.Errorf("expected the IP named after %s, got %s", expectedIP, ip.Name)
+	}
+	if ip.Spec.Subnet.Name != "inband" || ip.Spec.IP == nil || !net.IP(ip.Spec.IP.Net.AsSlice()).Equal(expectedIP) {
+		t.Errorf("expected %s in subnet inband, got %s in %s", expectedIP, ip.Spec.IP, ip.Spec.Subnet.Name)
+	}
+	if ip.Labels["mac"] != "001a2b3c4d5e" || ip.Labels["origin"] != origin {
+		t.Errorf("expected the IP labeled with the client's MAC address, got %v", ip.Labels)
+	}
+}
+
+func TestNoMatchingSubnet(t *testing.T) {
+	h, cl := Init(t)
+
+	req, stub := newRequest(t, net.ParseIP("2001:db8:2::1"))
+	if resp, stop := h(req, stub); resp == nil || stop {
+		t.Fatalf("expected the chain to continue, got %v (stop %t)", resp, stop)
+	}
+	if ips := listIPs(t, cl); len(ips) != 0 {
+		t.Errorf("expected no IP outside of the subnets, got %d", len(ips))
+	}
+}
+
+func TestNonRelayDropped(t *testing.T) {
+	h, cl := Init(t)
+
+	req, stub := newRequest(t, linkAddr)
+	inner, err := req.GetInnerMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, stop := h(inner, stub); resp != nil || !stop {
+		t.Errorf("expected a direct request to be dropped, got %v (stop %t)", resp, stop)
+	}
+	if ips := listIPs(t, cl); len(ips) != 0 {
+		t.Errorf("expected no IP for a dropped request, got %d", len(ips))
+	}
+}
@@ -0,0 +1,218 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package leasetime
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/ironcore-dev/fedhcp/internal/leasetimes"
+	"github.com/ironcore-dev/fedhcp/internal/subnetmatch"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logger.GetLogger("plugins/leasetime")
+
+var Plugin = plugins.Plugin{
+	Name:   "leasetime",
+	Setup4: setup4,
+	Setup6: setup6,
+}
+
+// rule is a parsed lease time rule.
+type rule struct {
+	name          string
+	vendorClasses []string
+	subnets       []netip.Prefix
+	times         api.LeaseTimes
+}
+
+// plugin holds the state of a single leasetime plugin instance. It is built
+// once in setup and never modified afterwards.
+type plugin struct {
+	defaults rule
+	rules    []rule
+	log      *logrus.Entry
+}
+
+// args[0] = path to config file
+func parseArgs(args ...string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("exactly one argument must be passed to the leasetime plugin, got %d", len(args))
+	}
+	return args[0], nil
+}
+
+func loadConfig(args ...string) (*api.LeaseTimeConfig, error) {
+	path, err := parseArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	log.Debugf("Reading config file %s", path)
+	config := &api.LeaseTimeConfig{}
+	if err := api.Load(path, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func newPlugin(name string, args ...string) (*plugin, error) {
+	config, err := loadConfig(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := leasetimes.Validate(config.Default); err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("default: %w", err)}
+	}
+	p := &plugin{
+		defaults: rule{name: "default", times: config.Default},
+		log:      instance.Logger(log, name),
+	}
+
+	for i, r := range config.Rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i)
+		}
+		if len(r.VendorClasses) == 0 && len(r.Subnets) == 0 {
+			return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("%s: at least one vendor class or subnet must be configured", r.Name)}
+		}
+		if err := leasetimes.Validate(r.LeaseTimes); err != nil {
+			return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("%s: %w", r.Name, err)}
+		}
+
+		parsed := rule{name: r.Name, vendorClasses: r.VendorClasses, times: r.LeaseTimes}
+		for _, subnet := range r.Subnets {
+			prefix, err := subnetmatch.ParsePrefix(subnet)
+			if err != nil {
+				return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("%s: invalid subnet %s: %w", r.Name, subnet, err)}
+			}
+			parsed.subnets = append(parsed.subnets, prefix)
+		}
+		p.rules = append(p.rules, parsed)
+	}
+	return p, nil
+}
+
+func setup6(args ...string) (handler.Handler6, error) {
+	p, err := newPlugin("leasetime/v6", args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded leasetime plugin for DHCPv6 with %d rules.", len(p.rules))
+	return p.handler6, nil
+}
+
+func setup4(args ...string) (handler.Handler4, error) {
+	p, err := newPlugin("leasetime/v4", args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded leasetime plugin for DHCPv4 with %d rules.", len(p.rules))
+	return p.handler4, nil
+}
+
+func (r *rule) matches(classes []string, addr net.IP) bool {
+	if len(r.vendorClasses) > 0 && !matchesAnyClass(classes, r.vendorClasses) {
+		return false
+	}
+	if len(r.subnets) > 0 {
+		for _, subnet := range r.subnets {
+			if subnetmatch.Contains(subnet, addr) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchesAnyClass(classes, prefixes []string) bool {
+	for _, class := range classes {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(class, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// match returns the first rule matching the client, or the defaults.
+func (p *plugin) match(classes []string, addr net.IP) *rule {
+	for i := range p.rules {
+		if p.rules[i].matches(classes, addr) {
+			return &p.rules[i]
+		}
+	}
+	return &p.defaults
+}
+
+func (p *plugin) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	m, err := req.GetInnerMessage()
+	if err != nil {
+		p.log.Errorf("Could not decapsulate request: %v", err)
+		return resp, false
+	}
+	reply, ok := resp.(*dhcpv6.Message)
+	if !ok {
+		return resp, false
+	}
+
+	// the rule is matched against the first leased address or delegated prefix
+	var addr net.IP
+	ianas, iapds := reply.Options.IANA(), reply.Options.IAPD()
+	for _, iana := range ianas {
+		if addrs := iana.Options.Addresses(); addr == nil && len(addrs) > 0 {
+			addr = addrs[0].IPv6Addr
+		}
+	}
+	for _, iapd := range iapds {
+		if prefixes := iapd.Options.Prefixes(); addr == nil && len(prefixes) > 0 && prefixes[0].Prefix != nil {
+			addr = prefixes[0].Prefix.IP
+		}
+	}
+	if addr == nil {
+		return resp, false
+	}
+
+	var classes []string
+	for _, vc := range m.Options.VendorClasses() {
+		for _, data := range vc.Data {
+			classes = append(classes, string(data))
+		}
+	}
+	r := p.match(classes, addr)
+	valid, _, _, _ := leasetimes.DHCPv6(r.times)
+	p.log.Debugf("Applying lease times of %s (valid lifetime %s) to %s", r.name, valid, addr)
+	leasetimes.Apply6(reply, r.times)
+	return resp, false
+}
+
+func (p *plugin) handler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	if resp.YourIPAddr == nil || resp.YourIPAddr.IsUnspecified() {
+		return resp, false
+	}
+
+	var classes []string
+	if class := req.ClassIdentifier(); class != "" {
+		classes = append(classes, class)
+	}
+	r := p.match(classes, resp.YourIPAddr)
+	p.log.Debugf("Applying lease times of %s (lease time %s) to %s", r.name, r.times.LeaseTime, resp.YourIPAddr)
+
+	leasetimes.Apply4(resp, r.times)
+	return resp, false
+}
@@ -0,0 +1,184 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package leasetime
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/api/apitest"
+)
+
+var (
+	mac = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+
+	config = api.LeaseTimeConfig{
+		Default: api.LeaseTimes{LeaseTime: 10 * time.Minute},
+		Rules: []api.LeaseTimeRule{
+			{
+				Name:       "onboarded",
+				Subnets:    []string{"10.0.0.0/16", "2001:db8:1::/48"},
+				LeaseTimes: api.LeaseTimes{LeaseTime: 24 * time.Hour, T1: 12 * time.Hour, T2: 21 * time.Hour},
+			},
+			{
+				Name:          "pxe",
+				VendorClasses: []string{"PXEClient"},
+				LeaseTimes:    api.LeaseTimes{LeaseTime: 5 * time.Minute, PreferredLifetime: 4 * time.Minute},
+			},
+		},
+	}
+)
+
+func Init(t *testing.T) *plugin {
+	p, err := newPlugin("leasetime/test", apitest.WriteConfig(t, config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestWrongNumberArgs(t *testing.T) {
+	_, err := setup4()
+	if err == nil {
+		t.Fatal("no error occurred when not providing a configuration file path, but it should have")
+	}
+
+	_, err = setup6("foo", "bar")
+	if err == nil {
+		t.Fatal("no error occurred when providing wrong number of args (2), but it should have")
+	}
+}
+
+func TestWrongArgs(t *testing.T) {
+	for _, config := range []api.LeaseTimeConfig{
+		{},
+		{Default: api.LeaseTimes{LeaseTime: time.Hour, PreferredLifetime: 2 * time.Hour}},
+		{Default: api.LeaseTimes{LeaseTime: time.Hour, T1: 40 * time.Minute, T2: 30 * time.Minute}},
+		{Default: api.LeaseTimes{LeaseTime: time.Hour, T2: 2 * time.Hour}},
+		{
+			Default: api.LeaseTimes{LeaseTime: time.Hour},
+			Rules:   []api.LeaseTimeRule{{Name: "any", LeaseTimes: api.LeaseTimes{LeaseTime: time.Hour}}},
+		},
+		{
+			Default: api.LeaseTimes{LeaseTime: time.Hour},
+			Rules:   []api.LeaseTimeRule{{Subnets: []string{"10.0.0.0/33"}, LeaseTimes: api.LeaseTimes{LeaseTime: time.Hour}}},
+		},
+	} {
+		if _, err := setup4(apitest.WriteConfig(t, config)); err == nil {
+			t.Fatalf("no error occurred when providing config %+v, but it should have", config)
+		}
+	}
+}
+
+/* IPv6 */
+func newReply6(t *testing.T, vendorClass string, addr string) (*dhcpv6.Message, *dhcpv6.Message) {
+	req, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.MessageType = dhcpv6.MessageTypeRequest
+	req.AddOption(dhcpv6.OptClientID(&dhcpv6.DUIDLL{HWType: 1, LinkLayerAddr: mac}))
+	if vendorClass != "" {
+		req.AddOption(&dhcpv6.OptVendorClass{EnterpriseNumber: 343, Data: [][]byte{[]byte(vendorClass)}})
+	}
+	resp, err := dhcpv6.NewReplyFromMessage(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.AddOption(&dhcpv6.OptIANA{
+		IaId: [4]byte{0, 0, 0, 1},
+		Options: dhcpv6.IdentityOptions{Options: dhcpv6.Options{
+			&dhcpv6.OptIAAddress{IPv6Addr: net.ParseIP(addr), ValidLifetime: time.Hour, PreferredLifetime: time.Hour},
+		}},
+	})
+	return req, resp
+}
+
+func TestLifetimes6(t *testing.T) {
+	p := Init(t)
+
+	for _, tc := range []struct {
+		vendorClass, addr                    string
+		valid, preferred, expectT1, expectT2 time.Duration
+	}{
+		{"", "2001:db8:1::10", 24 * time.Hour, 24 * time.Hour, 12 * time.Hour, 21 * time.Hour},
+		{"PXEClient:Arch:00007", "2001:db8:2::10", 5 * time.Minute, 4 * time.Minute, 2 * time.Minute, 192 * time.Second},
+		{"", "2001:db8:2::10", 10 * time.Minute, 10 * time.Minute, 5 * time.Minute, 8 * time.Minute},
+	} {
+		req, resp := newReply6(t, tc.vendorClass, tc.addr)
+		result, stop := p.handler6(req, resp)
+		if stop {
+			t.Fatal("leasetime must not stop the chain")
+		}
+
+		iana := result.(*dhcpv6.Message).Options.OneIANA()
+		if iana.T1 != tc.expectT1 || iana.T2 != tc.expectT2 {
+			t.Errorf("%s: expected T1 %s and T2 %s, got %s and %s", tc.addr, tc.expectT1, tc.expectT2, iana.T1, iana.T2)
+		}
+		ia := iana.Options.OneAddress()
+		if ia.ValidLifetime != tc.valid || ia.PreferredLifetime != tc.preferred {
+			t.Errorf("%s: expected lifetimes %s/%s, got %s/%s", tc.addr, tc.valid, tc.preferred, ia.ValidLifetime, ia.PreferredLifetime)
+		}
+	}
+}
+
+/* IPv4 */
+func TestLeaseTime4(t *testing.T) {
+	p := Init(t)
+
+	for _, tc := range []struct {
+		vendorClass, addr string
+		leaseTime, t1     time.Duration
+	}{
+		{"", "10.0.1.1", 24 * time.Hour, 12 * time.Hour},
+		{"PXEClient:Arch:00007", "192.168.0.1", 5 * time.Minute, 0},
+		{"", "192.168.0.1", 10 * time.Minute, 0},
+	} {
+		req, err := dhcpv4.NewDiscovery(mac)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.vendorClass != "" {
+			req.UpdateOption(dhcpv4.OptClassIdentifier(tc.vendorClass))
+		}
+		resp, err := dhcpv4.NewReplyFromRequest(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.YourIPAddr = net.ParseIP(tc.addr)
+
+		result, stop := p.handler4(req, resp)
+		if stop {
+			t.Fatal("leasetime must not stop the chain")
+		}
+		if leaseTime := result.IPAddressLeaseTime(0); leaseTime != tc.leaseTime {
+			t.Errorf("%s: expected lease time %s, got %s", tc.addr, tc.leaseTime, leaseTime)
+		}
+		if t1 := result.IPAddressRenewalTime(0); t1 != tc.t1 {
+			t.Errorf("%s: expected T1 %s, got %s", tc.addr, tc.t1, t1)
+		}
+	}
+}
+
+func TestNoAddress4(t *testing.T) {
+	p := Init(t)
+
+	req, err := dhcpv4.NewInform(mac, net.ParseIP("10.0.1.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := dhcpv4.NewReplyFromRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, _ := p.handler4(req, resp)
+	if result.Options.Has(dhcpv4.OptionIPAddressLeaseTime) {
+		t.Error("lease time must not be set without a leased address")
+	}
+}
@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package linklayer
+
+import (
+	"fmt"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/ironcore-dev/fedhcp/internal/relay"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logger.GetLogger("plugins/linklayer")
+
+var Plugin = plugins.Plugin{
+	Name:   "linklayer",
+	Setup6: setup6,
+}
+
+type plugin struct {
+	log *logrus.Entry
+}
+
+func setup6(args ...string) (handler.Handler6, error) {
+	if len(args) != 0 {
+		return nil, &fedhcperrors.ConfigError{
+			Err: fmt.Errorf("no arguments must be passed to the linklayer plugin, got %d", len(args)),
+		}
+	}
+
+	p := &plugin{
+		log: instance.Logger(log, "linklayer/v6"),
+	}
+	p.log.Printf("Loaded linklayer plugin for DHCPv6.")
+	return p.handler6, nil
+}
+
+// handler6 encapsulates the response of a relayed request into Relay-Reply
+// messages carrying the client link-layer address and breaks the chain, as
+// the following plugins expect the bare response.
+func (p *plugin) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	if !req.IsRelay() {
+		return resp, false
+	}
+	msg, ok := resp.(*dhcpv6.Message)
+	if !ok {
+		p.log.Debugf("Response is already encapsulated: %s", resp.Summary())
+		return resp, false
+	}
+
+	reply, err := relay.Reply(req, msg)
+	if err != nil {
+		// leave the encapsulation to the server
+		p.log.Warningf("Could not encapsulate response with client link-layer address: %v", err)
+		return resp, false
+	}
+	return reply, true
+}
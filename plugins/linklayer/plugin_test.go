@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package linklayer
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/mdlayher/netx/eui64"
+)
+
+var (
+	mac      = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+	linkAddr = net.ParseIP("2001:db8::1")
+)
+
+func Init(t *testing.T) handler.Handler6 {
+	h, err := setup6()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func request(t *testing.T, peer net.IP, options ...dhcpv6.Option) (dhcpv6.DHCPv6, *dhcpv6.Message) {
+	msg, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.MessageType = dhcpv6.MessageTypeRequest
+	msg.AddOption(dhcpv6.OptClientID(&dhcpv6.DUIDLL{HWType: iana.HWTypeEthernet, LinkLayerAddr: mac}))
+	relayed, err := dhcpv6.EncapsulateRelay(msg, dhcpv6.MessageTypeRelayForward, linkAddr, peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, option := range options {
+		relayed.AddOption(option)
+	}
+	stub, err := dhcpv6.NewReplyFromMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return relayed, stub
+}
+
+func TestWrongNumberArgs(t *testing.T) {
+	if _, err := setup6("foo"); err == nil {
+		t.Fatal("no error occurred when providing wrong number of args (1), but it should have")
+	}
+}
+
+func linkLayerOf(t *testing.T, resp dhcpv6.DHCPv6) net.HardwareAddr {
+	reply, ok := resp.(*dhcpv6.RelayMessage)
+	if !ok || reply.Type() != dhcpv6.MessageTypeRelayReply {
+		t.Fatalf("expected a relay-reply, got %s", resp.Summary())
+	}
+	if !reply.LinkAddr.Equal(linkAddr) {
+		t.Errorf("expected link address %s, got %s", linkAddr, reply.LinkAddr)
+	}
+	_, lla := reply.Options.ClientLinkLayerAddress()
+	return lla
+}
+
+func TestEUI64PeerAddress(t *testing.T) {
+	handler6 := Init(t)
+	peer, _ := eui64.ParseMAC(net.ParseIP("fe80::"), mac)
+
+	resp, stop := handler6(request(t, peer))
+	if !stop {
+		t.Error("expected the chain to be broken")
+	}
+	if lla := linkLayerOf(t, resp); !bytes.Equal(lla, mac) {
+		t.Errorf("expected client link-layer address %s, got %s", mac, lla)
+	}
+}
+
+func TestClientLinkLayerOption(t *testing.T) {
+	handler6 := Init(t)
+
+	resp, _ := handler6(request(t, net.ParseIP("2001:db8::10"), dhcpv6.OptClientLinkLayerAddress(iana.HWTypeEthernet, mac)))
+	if lla := linkLayerOf(t, resp); !bytes.Equal(lla, mac) {
+		t.Errorf("expected client link-layer address %s, got %s", mac, lla)
+	}
+}
+
+func TestUnknownLinkLayer(t *testing.T) {
+	handler6 := Init(t)
+
+	req, stub := request(t, net.ParseIP("2001:db8::10"))
+	resp, stop := handler6(req, stub)
+	if resp != stub || stop {
+		t.Error("expected the response to be left to the server")
+	}
+}
+
+func TestNotRelayed(t *testing.T) {
+	handler6 := Init(t)
+
+	msg, _ := dhcpv6.NewMessage()
+	stub, _ := dhcpv6.NewAdvertiseFromSolicit(msg)
+	resp, stop := handler6(msg, stub)
+	if resp != stub || stop {
+		t.Error("expected the response to be passed on unchanged")
+	}
+}
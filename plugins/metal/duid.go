@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package metal
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+// duidPrefix tells the entries of DUIDs from those of MAC addresses
+const duidPrefix = "duid:"
+
+// rfc4361Type is the client identifier type of DHCPv4 clients sending a DUID, see RFC 4361
+const rfc4361Type = 0xff
+
+// parseDUID returns the entry key of a DUID given in hex, with or without
+// colon or dash separators, e.g. "00:04:8c:5a:..." for a DUID-UUID.
+func parseDUID(s string) (string, error) {
+	data, err := hex.DecodeString(strings.NewReplacer(":", "", "-", "").Replace(s))
+	if err != nil {
+		return "", fmt.Errorf("invalid DUID %s: %w", s, err)
+	}
+	if _, err := dhcpv6.DUIDFromBytes(data); err != nil {
+		return "", fmt.Errorf("invalid DUID %s: %w", s, err)
+	}
+	return duidKey(data), nil
+}
+
+func duidKey(data []byte) string {
+	return duidPrefix + hex.EncodeToString(data)
+}
+
+// duid6 returns the entry key of the DUID of a DHCPv6 request, or the empty
+// string if it has none.
+func duid6(req dhcpv6.DHCPv6) string {
+	msg, err := req.GetInnerMessage()
+	if err != nil {
+		return ""
+	}
+	duid := msg.Options.ClientID()
+	if duid == nil {
+		return ""
+	}
+	return duidKey(duid.ToBytes())
+}
+
+// duid4 returns the entry key of the DUID of a DHCPv4 request, if its client
+// identifier holds an IAID and a DUID, or the empty string otherwise.
+func duid4(req *dhcpv4.DHCPv4) string {
+	id := req.Options.Get(dhcpv4.OptionClientIdentifier)
+	// type, 4 bytes of IAID and at least the 2 bytes of the DUID type
+	if len(id) < 7 || id[0] != rfc4361Type {
+		return ""
+	}
+	return duidKey(id[5:])
+}
@@ -0,0 +1,382 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package metal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/admin"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/ironcore-dev/fedhcp/internal/metrics"
+	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
+	"github.com/sirupsen/logrus"
+)
+
+// liveInventory holds the inventory of a plugin instance, which can be
+// replaced at runtime via the admin API. The previous inventory is kept, so
+// that a replacement can be rolled back.
+type liveInventory struct {
+	name     string
+	log      *logrus.Entry
+	current  atomic.Pointer[Inventory]
+	data     []byte
+	previous *Inventory
+	prevData []byte
+	// retry re-applies failed endpoints with the current inventory
+	retry *retryQueue
+}
+
+var (
+	// liveMu guards the registry and the config data of all live inventories,
+	// so that a new config is applied to all instances atomically
+	liveMu       sync.Mutex
+	liveRegistry []*liveInventory
+	registerLive sync.Once
+)
+
+func setupLive(name string, args ...string) (*liveInventory, error) {
+	inventory, configData, err := readConfig(args...)
+	if err != nil {
+		return nil, err
+	}
+	if inventory.empty() {
+		return nil, nil
+	}
+
+	name = instance.Next(name)
+	live := &liveInventory{
+		name: name,
+		log:  log.WithField("instance", name),
+		data: configData,
+	}
+	live.retry = newRetryQueue(func(mac net.HardwareAddr, duid string, family ipamv1alpha1.SubnetAddressType, labels map[string]string) error {
+		return live.current.Load().applyEndpoint(mac, duid, family, labels)
+	}, live.log, retryPath(inventory.RetryFile, name))
+	inventory.log = live.log
+	inventory.setInstance(name)
+	inventory.retry = live.retry
+	inventory.unknown = newUnknownCache(name)
+	live.current.Store(inventory)
+
+	liveMu.Lock()
+	liveRegistry = append(liveRegistry, live)
+	liveMu.Unlock()
+	admin.State(name, live.state)
+	registerLive.Do(func() {
+		admin.Handle("/metal/config", http.HandlerFunc(serveConfig))
+		admin.Handle("/metal/config/rollback", http.HandlerFunc(serveRollback))
+		admin.Handle("/metal/observed", http.HandlerFunc(serveObservations))
+		admin.Handle("/metal/report", http.HandlerFunc(serveReport))
+		metrics.Register(observedOnboardings, observedMachines, reportFindings, sourceHealthy, sourceHosts)
+		admin.State("metal/observations", func() any {
+			return map[string]int{"machines": observations.Len()}
+		})
+		admin.State("metal/report", reportState)
+		go runReports()
+	})
+	return live, nil
+}
+
+func (live *liveInventory) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	return live.current.Load().handler6(req, resp)
+}
+
+func (live *liveInventory) handler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	return live.current.Load().handler4(req, resp)
+}
+
+// liveState is the internal state of a live inventory, see admin.State.
+type liveState struct {
+	Strategy    OnBoardingStrategy `json:"strategy"`
+	Entries     map[string]string  `json:"entries"`
+	Metadata    int                `json:"metadata"`
+	RetryQueue  int                `json:"retryQueue"`
+	HasPrevious bool               `json:"hasPrevious"`
+	Sources     []sourceState      `json:"sources,omitempty"`
+}
+
+func (live *liveInventory) state() any {
+	liveMu.Lock()
+	hasPrevious := live.previous != nil
+	liveMu.Unlock()
+
+	inventory := live.current.Load()
+	return liveState{
+		Strategy:    inventory.Strategy,
+		Entries:     inventory.Entries,
+		Metadata:    len(inventory.Metadata),
+		RetryQueue:  live.retry.len(),
+		HasPrevious: hasPrevious,
+		Sources:     inventory.sourceStates(),
+	}
+}
+
+// configDiff describes the changes of a new config against the running one.
+type configDiff struct {
+	Strategy string `json:"strategy,omitempty"`
+	// Added, Removed and Changed map MAC addresses (or prefixes) to inventory names
+	Added   map[string]string `json:"added,omitempty"`
+	Removed map[string]string `json:"removed,omitempty"`
+	Changed map[string]string `json:"changed,omitempty"`
+	// Metadata lists the MAC addresses whose endpoint labels or annotations change
+	Metadata []string `json:"metadata,omitempty"`
+	// Families maps MAC addresses (or prefixes) to the change of their address family
+	Families map[string]string `json:"families,omitempty"`
+	Settings []string          `json:"settings,omitempty"`
+}
+
+func change[T comparable](from, to T) string {
+	return fmt.Sprintf("%v -> %v", from, to)
+}
+
+func diffInventories(from, to *Inventory) configDiff {
+	diff := configDiff{
+		Added:    make(map[string]string),
+		Removed:  make(map[string]string),
+		Changed:  make(map[string]string),
+		Families: make(map[string]string),
+	}
+	if from.Strategy != to.Strategy {
+		diff.Strategy = change(from.Strategy, to.Strategy)
+	}
+
+	for mac, name := range to.Entries {
+		oldName, ok := from.Entries[mac]
+		switch {
+		case !ok:
+			diff.Added[mac] = name
+		case oldName != name:
+			diff.Changed[mac] = change(oldName, name)
+		}
+	}
+	for mac, name := range from.Entries {
+		if _, ok := to.Entries[mac]; !ok {
+			diff.Removed[mac] = name
+		}
+	}
+
+	for mac := range to.Entries {
+		oldMetadata, newMetadata := from.Metadata[mac], to.Metadata[mac]
+		if !maps.Equal(oldMetadata.Labels, newMetadata.Labels) ||
+			!maps.Equal(oldMetadata.Annotations, newMetadata.Annotations) {
+			diff.Metadata = append(diff.Metadata, mac)
+		}
+	}
+	slices.Sort(diff.Metadata)
+
+	for mac := range to.Entries {
+		if oldFamily, newFamily := from.Families[mac], to.Families[mac]; oldFamily != newFamily {
+			diff.Families[mac] = change(familyName(oldFamily), familyName(newFamily))
+		}
+	}
+
+	if from.NameTemplate != to.NameTemplate {
+		diff.Settings = append(diff.Settings, "nameTemplate: "+change(strconv.Quote(from.NameTemplate), strconv.Quote(to.NameTemplate)))
+	}
+	if from.AuthoritativeIP != to.AuthoritativeIP {
+		diff.Settings = append(diff.Settings, "authoritativeIP: "+change(from.AuthoritativeIP, to.AuthoritativeIP))
+	}
+	if !from.ObserveUntil.Equal(to.ObserveUntil) {
+		diff.Settings = append(diff.Settings, "observeUntil: "+change(formatTime(from.ObserveUntil), formatTime(to.ObserveUntil)))
+	}
+	if from.FamilyPrecedence != to.FamilyPrecedence {
+		diff.Settings = append(diff.Settings, "familyPrecedence: "+change(familyName(from.FamilyPrecedence), familyName(to.FamilyPrecedence)))
+	}
+	if from.DeviceClassLabels != to.DeviceClassLabels {
+		diff.Settings = append(diff.Settings, "deviceClassLabels: "+change(from.DeviceClassLabels, to.DeviceClassLabels))
+	}
+	if from.Links.String() != to.Links.String() {
+		diff.Settings = append(diff.Settings, "links: "+change(from.Links.String(), to.Links.String()))
+	}
+	if fromSources, toSources := sourceNames(from), sourceNames(to); !slices.Equal(fromSources, toSources) {
+		diff.Settings = append(diff.Settings, "sources: "+change(strings.Join(fromSources, ","), strings.Join(toSources, ",")))
+	}
+	if from.ReportInterval != to.ReportInterval {
+		diff.Settings = append(diff.Settings, "reportInterval: "+change(from.ReportInterval, to.ReportInterval))
+	}
+	if from.RetryFile != to.RetryFile {
+		// the retry queue of an instance is kept, so is its file
+		diff.Settings = append(diff.Settings, "retryFile: "+change(from.RetryFile, to.RetryFile)+" (applied on restart)")
+	}
+	return diff
+}
+
+// empty reports whether the inventory matches no client, i.e. it is nil or
+// has neither entries nor sources.
+func (inventory *Inventory) empty() bool {
+	return inventory == nil || len(inventory.Entries) == 0 && len(inventory.Sources) == 0
+}
+
+// setInstance sets the instance serving the inventory, which labels the
+// metrics of the inventory and its sources.
+func (inventory *Inventory) setInstance(name string) {
+	inventory.instance = name
+	for _, source := range inventory.Sources {
+		source.setInstance(name)
+	}
+}
+
+func sourceNames(inventory *Inventory) []string {
+	names := make([]string, 0, len(inventory.Sources))
+	for _, source := range inventory.Sources {
+		names = append(names, source.state().Name)
+	}
+	return names
+}
+
+func familyName(family ipamv1alpha1.SubnetAddressType) string {
+	if family == "" {
+		return "both"
+	}
+	return string(family)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+// selectLive returns the live inventories the request is aimed at, all of them
+// unless an instance is given. liveMu must be held.
+func selectLive(r *http.Request) ([]*liveInventory, error) {
+	name := r.URL.Query().Get("instance")
+	if name == "" {
+		return liveRegistry, nil
+	}
+	for _, live := range liveRegistry {
+		if live.name == name {
+			return []*liveInventory{live}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown instance %s", name)
+}
+
+// serveConfig returns the running config on GET. On PUT it replaces the config
+// by the one in the request body and returns the diff; with dryRun set, only
+// the diff is returned. With several instances running, a replacement must
+// name its instance, so that a config meant for one does not overwrite all.
+func serveConfig(w http.ResponseWriter, r *http.Request) {
+	liveMu.Lock()
+	defer liveMu.Unlock()
+
+	selected, err := selectLive(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		configs := make(map[string]string, len(selected))
+		for _, live := range selected {
+			configs[live.name] = string(live.data)
+		}
+		writeJSON(w, configs)
+	case http.MethodPut:
+		configData, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		inventory, err := parseConfig(configData)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if inventory.empty() {
+			http.Error(w, "config holds no inventories", http.StatusBadRequest)
+			return
+		}
+
+		dryRun := r.URL.Query().Get("dryRun") == "true"
+		if !dryRun && len(selected) > 1 {
+			http.Error(w, fmt.Sprintf("%d instances are running, the instance to replace must be given", len(selected)), http.StatusBadRequest)
+			return
+		}
+
+		diffs := make(map[string]configDiff, len(selected))
+		for _, live := range selected {
+			diffs[live.name] = diffInventories(live.current.Load(), inventory)
+		}
+		if !dryRun {
+			for _, live := range selected {
+				// each instance logs with its own logger
+				replacement := *inventory
+				replacement.log = live.log
+				replacement.setInstance(live.name)
+				replacement.retry = live.retry
+				replacement.unknown = newUnknownCache(live.name)
+				live.previous, live.prevData = live.current.Load(), live.data
+				live.current.Store(&replacement)
+				live.data = configData
+				live.log.Infof("Applied new config with %d inventories", len(replacement.Entries))
+			}
+		}
+		writeJSON(w, diffs)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveRollback restores the config replaced last and returns the diff. Like
+// a replacement, it must name its instance if several are running.
+func serveRollback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	liveMu.Lock()
+	defer liveMu.Unlock()
+
+	selected, err := selectLive(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if len(selected) > 1 {
+		http.Error(w, fmt.Sprintf("%d instances are running, the instance to roll back must be given", len(selected)), http.StatusBadRequest)
+		return
+	}
+	for _, live := range selected {
+		if live.previous == nil {
+			http.Error(w, fmt.Sprintf("no previous config of instance %s", live.name), http.StatusConflict)
+			return
+		}
+	}
+
+	diffs := make(map[string]configDiff, len(selected))
+	for _, live := range selected {
+		diffs[live.name] = diffInventories(live.current.Load(), live.previous)
+		live.current.Store(live.previous)
+		live.data = live.prevData
+		live.previous, live.prevData = nil, nil
+		live.log.Info("Rolled back to previous config")
+	}
+	writeJSON(w, diffs)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(v)
+}
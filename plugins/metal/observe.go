@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package metal
+
+import (
+	"cmp"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ironcore-dev/fedhcp/internal/cache"
+	"github.com/ironcore-dev/fedhcp/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// observation is an onboarding which would have happened outside of the
+// observation period.
+type observation struct {
+	MACAddress string    `json:"macAddress"`
+	Inventory  string    `json:"inventory"`
+	Endpoint   string    `json:"endpoint"`
+	IP         string    `json:"ip"`
+	FirstSeen  time.Time `json:"firstSeen"`
+	LastSeen   time.Time `json:"lastSeen"`
+	Count      int       `json:"count"`
+}
+
+// maxObservations bounds the observed machines, the least recently seen are
+// forgotten first.
+const maxObservations = 65536
+
+var (
+	// observations are kept across config changes, keyed by MAC address;
+	// observationsMu guards the observations themselves
+	observationsMu sync.Mutex
+	observations   = cache.New[string, *observation]("metal/observations", maxObservations, 0)
+
+	observedOnboardings = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "metal",
+		Name:      "observed_onboardings_total",
+		Help:      "Number of endpoint applies skipped during the observation period.",
+	}, []string{"instance"})
+	// observedMachines counts the observations shared by all instances
+	observedMachines = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "metal",
+		Name:      "observed_machines",
+		Help:      "Number of machines which would have been onboarded during the observation period, by all instances.",
+	})
+)
+
+// observing reports whether the inventory is in its observation period, in
+// which endpoints are not applied but recorded as observations.
+func (inventory *Inventory) observing() bool {
+	return time.Now().Before(inventory.ObserveUntil)
+}
+
+// observe records the endpoint which would have been applied with the
+// onboarding strategy for the MAC address.
+func (inventory *Inventory) observe(strategy OnBoardingStrategy, name string, mac net.HardwareAddr, ip *netip.Addr) {
+	endpointName := name
+	if strategy == OnboardingStrategyDynamic {
+		endpointName = inventory.dynamicEndpointName(name, mac)
+	}
+	inventory.log.Infof("Observing until %s, not applying endpoint %s for inventory %s (%s, %s)",
+		inventory.ObserveUntil.Format(time.RFC3339), endpointName, name, mac, ip)
+
+	now := time.Now()
+	observationsMu.Lock()
+	defer observationsMu.Unlock()
+	o, ok := observations.Get(mac.String())
+	if !ok {
+		o = &observation{MACAddress: mac.String(), FirstSeen: now}
+		observations.Put(mac.String(), o)
+		observedMachines.Set(float64(observations.Len()))
+	}
+	o.Inventory, o.Endpoint, o.IP = name, endpointName, ip.String()
+	o.LastSeen = now
+	o.Count++
+	observedOnboardings.WithLabelValues(inventory.instance).Inc()
+}
+
+// serveObservations returns the observed onboardings, ordered by MAC address.
+func serveObservations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	observationsMu.Lock()
+	report := make([]observation, 0, observations.Len())
+	observations.Range(func(_ string, o *observation) bool {
+		report = append(report, *o)
+		return true
+	})
+	observationsMu.Unlock()
+
+	slices.SortFunc(report, func(a, b observation) int { return cmp.Compare(a.MACAddress, b.MACAddress) })
+	writeJSON(w, report)
+}
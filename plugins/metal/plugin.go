@@ -5,14 +5,18 @@ package metal
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"maps"
 	"net"
 	"net/netip"
 	"os"
 	"strings"
+	"time"
 
 	"k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
 
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -24,11 +28,17 @@ import (
 	"github.com/insomniacslk/dhcp/dhcpv4"
 	"github.com/insomniacslk/dhcp/dhcpv6"
 	"github.com/ironcore-dev/fedhcp/internal/api"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/fingerprint"
+	"github.com/ironcore-dev/fedhcp/internal/funnel"
 	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/ironcore-dev/fedhcp/internal/links"
+	"github.com/ironcore-dev/fedhcp/internal/printer"
+	"github.com/ironcore-dev/fedhcp/internal/relay"
+	"github.com/ironcore-dev/fedhcp/internal/segment"
 	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
 	metalv1alpha1 "github.com/ironcore-dev/metal-operator/api/v1alpha1"
-	"github.com/mdlayher/netx/eui64"
-	"gopkg.in/yaml.v3"
+	"github.com/sirupsen/logrus"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -40,17 +50,62 @@ var Plugin = plugins.Plugin{
 	Setup4: setup4,
 }
 
-// map MAC address to inventory name
-var inventory *Inventory
-
+// Inventory maps MAC addresses (or MAC prefixes) to inventory names. It is
+// never modified once loaded; a new config replaces the whole inventory, see liveInventory.
 type Inventory struct {
 	Entries  map[string]string
 	Strategy OnBoardingStrategy
+	// Metadata maps MAC addresses of a static inventory to the endpoint metadata
+	Metadata map[string]EndpointMetadata
+	// NameTemplate defines the names of dynamically onboarded endpoints, see renderName
+	NameTemplate string
+	// AuthoritativeIP makes the IP address from IPAM override the one of an existing Endpoint
+	AuthoritativeIP bool
+	// DeviceClassLabels labels Endpoints with the fingerprinted device class
+	DeviceClassLabels bool
+	// ObserveUntil ends the observation period, in which endpoints are only recorded, see observe
+	ObserveUntil time.Time
+	// Families restricts the entries to the requests of one address family, see onboards
+	Families map[string]ipamv1alpha1.SubnetAddressType
+	// FamilyPrecedence is the family whose address an existing endpoint keeps, see reconcileEndpointIP
+	FamilyPrecedence ipamv1alpha1.SubnetAddressType
+	// ReportInterval is the interval of the periodic inventory report, see runReports
+	ReportInterval time.Duration
+	// Links relates the Endpoints to the IPAM IPs, nil if disabled
+	Links *links.Linker
+	// Sources are looked up in order for clients matching no entry, see lookupSources
+	Sources []inventorySource
+	// RetryFile persists the retry queue, see newRetryQueue
+	RetryFile string
+
+	log *logrus.Entry
+	// instance labels the metrics, see setInstance
+	instance string
+	// retry queues endpoint applies failing with a retryable error, if set
+	retry *retryQueue
+	// unknown remembers the clients matching no entry, if set
+	unknown *unknownCache
+}
+
+// EndpointMetadata holds the labels and annotations an inventory passes to its endpoint.
+type EndpointMetadata struct {
+	Labels      map[string]string
+	Annotations map[string]string
 }
 
 // default inventory name prefix
 const defaultNamePrefix = "compute-"
 
+// number of hex digits of the MAC address hash in dynamic endpoint names
+const endpointNameHashLength = 12
+
+const (
+	deviceClassLabel = "fedhcp.ironcore.dev/device-class"
+	fingerprintLabel = "fedhcp.ironcore.dev/fingerprint"
+	typeLabel        = "fedhcp.ironcore.dev/type"
+	rackLabel        = "fedhcp.ironcore.dev/rack"
+)
+
 type OnBoardingStrategy string
 
 const (
@@ -67,45 +122,106 @@ func parseArgs(args ...string) (string, error) {
 }
 
 func setup6(args ...string) (handler.Handler6, error) {
-	var err error
-	inventory, err = loadConfig(args...)
-	if err != nil {
+	live, err := setupLive("metal/v6", args...)
+	if err != nil || live == nil {
 		return nil, err
 	}
-	if inventory == nil || len(inventory.Entries) == 0 {
-		return nil, nil
-	}
 
-	return handler6, nil
+	return live.handler6, nil
 }
 
 func loadConfig(args ...string) (*Inventory, error) {
+	inventory, _, err := readConfig(args...)
+	return inventory, err
+}
+
+// readConfig loads the inventory and returns it along with the raw config data.
+func readConfig(args ...string) (*Inventory, []byte, error) {
 	path, err := parseArgs(args...)
 	if err != nil {
-		return nil, fmt.Errorf("invalid configuration: %v", err)
+		return nil, nil, &fedhcperrors.ConfigError{Err: err}
 	}
 
 	log.Debugf("Reading metal config file %s", path)
 	configData, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %v", err)
+		return nil, nil, fmt.Errorf("failed to read config file: %v", err)
 	}
 
+	inventory, err := parseConfig(configData)
+	if err != nil {
+		return nil, nil, err
+	}
+	return inventory, configData, nil
+}
+
+// parseConfig builds an inventory from the YAML config data. It returns nil
+// if the config holds no inventories.
+func parseConfig(configData []byte) (*Inventory, error) {
 	var config api.MetalConfig
-	if err = yaml.Unmarshal(configData, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %v", err)
+	if err := api.Unmarshal(configData, &config); err != nil {
+		return nil, err
 	}
 
-	inv := &Inventory{}
+	inv := &Inventory{
+		AuthoritativeIP:   config.AuthoritativeIP == nil || *config.AuthoritativeIP,
+		DeviceClassLabels: config.DeviceClassLabels,
+		ReportInterval:    config.ReportInterval,
+		RetryFile:         config.RetryFile,
+		log:               log,
+	}
+	if config.ReportInterval < 0 {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("reportInterval must not be negative, got %s", config.ReportInterval)}
+	}
+	if config.ObserveUntil != nil {
+		inv.ObserveUntil = *config.ObserveUntil
+	}
+	precedence, err := parseFamily(config.FamilyPrecedence)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("familyPrecedence: %w", err)}
+	}
+	inv.FamilyPrecedence = precedence
+	if inv.Links, err = links.New(config.Links); err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("links: %w", err)}
+	}
+	if inv.Sources, err = parseSources(config.Sources); err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("sources: %w", err)}
+	}
 	entries := make(map[string]string)
+	families := make(map[string]ipamv1alpha1.SubnetAddressType)
 	switch {
 	// static inventory list has precedence, always
 	case len(config.Inventories) > 0:
 		inv.Strategy = OnBoardingStrategyStatic
 		log.Debug("Using static list onboarding")
+		inv.Metadata = make(map[string]EndpointMetadata)
 		for _, i := range config.Inventories {
-			if i.MacAddress != "" && i.Name != "" {
-				entries[strings.ToLower(i.MacAddress)] = i.Name
+			if i.Name == "" {
+				continue
+			}
+			keys, err := hostKeys(i)
+			if err != nil {
+				return nil, &fedhcperrors.ConfigError{Err: err}
+			}
+			if len(keys) == 0 {
+				continue
+			}
+			metadata, err := endpointMetadata(i)
+			if err != nil {
+				return nil, &fedhcperrors.ConfigError{Err: err}
+			}
+			family, err := parseFamily(i.Family)
+			if err != nil {
+				return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("inventory %s: %w", i.Name, err)}
+			}
+			for _, key := range keys {
+				entries[key] = i.Name
+				if len(metadata.Labels) > 0 || len(metadata.Annotations) > 0 {
+					inv.Metadata[key] = metadata
+				}
+				if family != "" {
+					families[key] = family
+				}
 			}
 		}
 	case len(config.Filter.MacPrefix) > 0:
@@ -114,104 +230,257 @@ func loadConfig(args ...string) (*Inventory, error) {
 		if config.NamePrefix != "" {
 			namePrefix = config.NamePrefix
 		}
+		if config.NameTemplate != "" {
+			if err := validateNameTemplate(config.NameTemplate); err != nil {
+				return nil, &fedhcperrors.ConfigError{Err: err}
+			}
+			inv.NameTemplate = config.NameTemplate
+		}
+		family, err := parseFamily(config.Filter.Family)
+		if err != nil {
+			return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("filter: %w", err)}
+		}
 		log.Debugf("Using MAC address prefix filter onboarding with name prefix '%s'", namePrefix)
 		for _, i := range config.Filter.MacPrefix {
 			entries[strings.ToLower(i)] = namePrefix
+			if family != "" {
+				families[strings.ToLower(i)] = family
+			}
 		}
+	case len(inv.Sources) > 0:
+		// the hosts of the sources are onboarded like those of a static list
+		inv.Strategy = OnBoardingStrategyStatic
 	default:
 		log.Infof("No inventories loaded")
 		return nil, nil
 	}
 
 	inv.Entries = entries
+	inv.Families = families
 
-	log.Infof("Loaded metal config with %d inventories", len(entries))
+	log.Infof("Loaded metal config with %d inventories and %d sources", len(entries), len(inv.Sources))
 	return inv, nil
 }
 
+// parseFamily parses an address family, the empty string stands for both families.
+func parseFamily(family string) (ipamv1alpha1.SubnetAddressType, error) {
+	switch ipamv1alpha1.SubnetAddressType(family) {
+	case "", ipamv1alpha1.CIPv4SubnetType, ipamv1alpha1.CIPv6SubnetType:
+		return ipamv1alpha1.SubnetAddressType(family), nil
+	default:
+		return "", fmt.Errorf("invalid address family %s, must be %s or %s",
+			family, ipamv1alpha1.CIPv4SubnetType, ipamv1alpha1.CIPv6SubnetType)
+	}
+}
+
 func setup4(args ...string) (handler.Handler4, error) {
-	var err error
-	inventory, err = loadConfig(args...)
-	if err != nil {
+	live, err := setupLive("metal/v4", args...)
+	if err != nil || live == nil {
 		return nil, err
 	}
-	if inventory == nil || len(inventory.Entries) == 0 {
-		return nil, nil
-	}
 
-	return handler4, nil
+	return live.handler4, nil
 }
 
-func handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
-	log.Debugf("Received DHCPv6 request: %s", req.Summary())
+func (inventory *Inventory) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	printer.VerboseRequest(inventory.log, req)
 
 	if !req.IsRelay() {
-		log.Info("Received non-relay DHCPv6 request. Dropping.")
+		inventory.log.Info("Received non-relay DHCPv6 request. Dropping.")
 		return nil, true
 	}
 
-	relayMsg := req.(*dhcpv6.RelayMessage)
-	_, mac, err := eui64.ParseIP(relayMsg.PeerAddr)
+	mac, err := relay.ClientMAC(req)
 	if err != nil {
-		log.Errorf("Could not parse peer address %s: %s", relayMsg.PeerAddr.String(), err)
+		inventory.log.Errorf("Could not determine client MAC address: %s", err)
 		return nil, true
 	}
 
-	if err := ApplyEndpointForMACAddress(mac, ipamv1alpha1.CIPv6SubnetType); err != nil {
-		log.Errorf("Could not apply endpoint for mac %s: %s", mac.String(), err)
+	var labels map[string]string
+	if inventory.DeviceClassLabels {
+		result, err := fingerprint.Classify6(req)
+		if err != nil {
+			inventory.log.Errorf("Could not fingerprint request: %s", err)
+		} else {
+			labels = fingerprintLabels(result)
+		}
+	}
+
+	release, err := segment.Acquire(context.Background(), segment.Of6(req))
+	if err != nil {
+		inventory.log.Errorf("Could not acquire write slot: %s", err)
 		return resp, false
 	}
+	defer release()
 
-	log.Debugf("Sent DHCPv6 response: %s", resp.Summary())
+	duid := duid6(req)
+	if err := inventory.applyEndpoint(mac, duid, ipamv1alpha1.CIPv6SubnetType, labels); err != nil {
+		inventory.log.WithFields(fedhcperrors.Fields(err)).Errorf("Could not apply endpoint for mac %s: %s", mac.String(), err)
+		inventory.queueRetry(mac, duid, ipamv1alpha1.CIPv6SubnetType, labels, err)
+		return resp, false
+	}
+
+	printer.VerboseResponse(inventory.log, req, resp)
 	return resp, false
 }
 
-func handler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
-	log.Debugf("Received DHCPv4 request: %s", req.Summary())
+func (inventory *Inventory) handler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	printer.VerboseRequest(inventory.log, req)
 
 	mac := req.ClientHWAddr
 
-	if err := ApplyEndpointForMACAddress(mac, ipamv1alpha1.CIPv4SubnetType); err != nil {
-		log.Errorf("Could not apply peer address: %s", err)
+	var labels map[string]string
+	if inventory.DeviceClassLabels {
+		labels = fingerprintLabels(fingerprint.Classify4(req))
+	}
+
+	release, err := segment.Acquire(context.Background(), segment.Of4(req))
+	if err != nil {
+		inventory.log.Errorf("Could not acquire write slot: %s", err)
+		return resp, false
+	}
+	defer release()
+
+	duid := duid4(req)
+	if err := inventory.applyEndpoint(mac, duid, ipamv1alpha1.CIPv4SubnetType, labels); err != nil {
+		inventory.log.WithFields(fedhcperrors.Fields(err)).Errorf("Could not apply peer address: %s", err)
+		inventory.queueRetry(mac, duid, ipamv1alpha1.CIPv4SubnetType, labels, err)
 		return resp, false
 	}
 
-	log.Debugf("Sent DHCPv4 response: %s", resp.Summary())
+	printer.VerboseResponse(inventory.log, req, resp)
 	return resp, false
 }
 
-func ApplyEndpointForMACAddress(mac net.HardwareAddr, subnetFamily ipamv1alpha1.SubnetAddressType) error {
-	inventoryName := GetInventoryEntryMatchingMACAddress(mac)
-	if inventoryName == "" {
-		log.Print("Unknown inventory, not processing")
+// queueRetry queues the endpoint apply for a retry if the error is transient.
+func (inventory *Inventory) queueRetry(
+	mac net.HardwareAddr,
+	duid string,
+	subnetFamily ipamv1alpha1.SubnetAddressType,
+	labels map[string]string,
+	err error) {
+	if inventory.retry != nil && fedhcperrors.IsRetryable(err) {
+		inventory.retry.add(mac, duid, subnetFamily, labels)
+	}
+}
+
+func fingerprintLabels(result fingerprint.Result) map[string]string {
+	return map[string]string{
+		deviceClassLabel: string(result.Class),
+		fingerprintLabel: result.Hash,
+	}
+}
+
+func (inventory *Inventory) ApplyEndpointForMACAddress(
+	mac net.HardwareAddr,
+	subnetFamily ipamv1alpha1.SubnetAddressType,
+	labels map[string]string) error {
+	return inventory.applyEndpoint(mac, "", subnetFamily, labels)
+}
+
+// applyEndpoint applies the endpoint of the inventory matching the DUID, see
+// duid6 and duid4, or else the MAC address.
+func (inventory *Inventory) applyEndpoint(
+	mac net.HardwareAddr,
+	duid string,
+	subnetFamily ipamv1alpha1.SubnetAddressType,
+	labels map[string]string) error {
+	funnel.Record(funnel.Discovered, mac)
+	if inventory.knownUnknown(mac, duid) {
 		return nil
 	}
+	entry := inventory.matchEntry(mac, duid)
+	inventoryName := inventory.Entries[entry]
+	metadata := inventory.Metadata[entry]
+	strategy := inventory.Strategy
+	if inventoryName != "" {
+		markSeen(entry)
+		if !inventory.onboards(entry, subnetFamily) {
+			inventory.log.Debugf("Inventory %s is not onboarded from %s requests, not processing", inventoryName, subnetFamily)
+			return nil
+		}
+	} else {
+		host, err := inventory.lookupSources(mac, duid)
+		if err != nil {
+			// the client is not remembered as unknown, a failing source may know it
+			return fmt.Errorf("could not look up inventory sources for MAC address %s: %w", mac.String(), err)
+		}
+		if host == nil {
+			inventory.log.Printf("Unknown inventory %s, not processing for %s", mac.String(), unknownTTL)
+			inventory.rememberUnknown(mac, duid)
+			return nil
+		}
+		if host.family != "" && host.family != subnetFamily {
+			inventory.log.Debugf("Inventory %s is not onboarded from %s requests, not processing", host.name, subnetFamily)
+			return nil
+		}
+		inventoryName, metadata, strategy = host.name, host.metadata, OnBoardingStrategyStatic
+	}
+	funnel.Record(funnel.Filtered, mac)
 
 	ip, err := GetIPAMIPAddressForMACAddress(mac, subnetFamily)
 	if err != nil {
-		return fmt.Errorf("could not get IPAM IP for MAC address %s: %s", mac.String(), err)
+		return fmt.Errorf("could not get IPAM IP for MAC address %s: %w", mac.String(), err)
 	}
 
 	if ip != nil {
-		if err := ApplyEndpointForInventory(inventoryName, mac, ip); err != nil {
-			if errors.IsAlreadyExists(err) {
-				log.Debugf("Endpoint %s (%s) exists, nothing to do", mac.String(), ip.String())
+		funnel.Record(funnel.IPAllocated, mac)
+		if inventory.observing() {
+			inventory.observe(strategy, inventoryName, mac, ip)
+			return nil
+		}
+		if err := inventory.applyEndpointForInventory(strategy, inventoryName, mac, ip, labels, metadata); err != nil {
+			if fedhcperrors.IsUpToDate(err) || errors.IsAlreadyExists(err) {
+				inventory.log.Debugf("Endpoint %s (%s) exists, nothing to do", mac.String(), ip.String())
 			} else {
-				return fmt.Errorf("could not apply endpoint for inventory: %s", err)
+				return fmt.Errorf("could not apply endpoint for inventory: %w", err)
 			}
 		} else {
-			log.Infof("Successfully applied endpoint for inventory %s (%s)", inventoryName, mac.String())
+			inventory.log.Infof("Successfully applied endpoint for inventory %s (%s)", inventoryName, mac.String())
 		}
+		funnel.Record(funnel.EndpointCreated, mac)
+		inventory.link(mac)
 	} else {
-		log.Infof("Could not find IPAM IP for MAC address %s", mac.String())
+		inventory.log.Infof("Could not find IPAM IP for MAC address %s", mac.String())
 	}
 
 	return nil
 }
 
-func ApplyEndpointForInventory(name string, mac net.HardwareAddr, ip *netip.Addr) error {
+// link relates the endpoint of the MAC address to its IPAM IPs, if configured.
+// Failures are only logged, the endpoint is applied anyway.
+func (inventory *Inventory) link(mac net.HardwareAddr) {
+	cl := kubernetes.GetClient()
+	if inventory.Links == nil || cl == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := inventory.Links.Link(ctx, cl, mac); err != nil {
+		inventory.log.WithFields(fedhcperrors.Fields(err)).Warnf("Could not link endpoint %s to its IPs: %v", mac.String(), err)
+	}
+}
+
+func (inventory *Inventory) ApplyEndpointForInventory(
+	name string,
+	mac net.HardwareAddr,
+	ip *netip.Addr,
+	labels map[string]string) error {
+	return inventory.applyEndpointForInventory(inventory.Strategy, name, mac, ip, labels, inventory.Metadata[strings.ToLower(mac.String())])
+}
+
+// applyEndpointForInventory applies the endpoint with the onboarding strategy
+// and the metadata of the matching inventory of a static inventory list.
+func (inventory *Inventory) applyEndpointForInventory(
+	strategy OnBoardingStrategy,
+	name string,
+	mac net.HardwareAddr,
+	ip *netip.Addr,
+	labels map[string]string,
+	metadata EndpointMetadata) error {
 	if ip == nil {
-		log.Info("No IP address specified. Skipping.")
+		inventory.log.Info("No IP address specified. Skipping.")
 		return nil
 	}
 
@@ -220,48 +489,40 @@ func ApplyEndpointForInventory(name string, mac net.HardwareAddr, ip *netip.Addr
 
 	cl := kubernetes.GetClient()
 	if cl == nil {
-		return fmt.Errorf("kubernetes client not initialized")
+		return &fedhcperrors.K8sUnavailable{Err: fmt.Errorf("kubernetes client not initialized")}
 	}
 
-	switch inventory.Strategy {
+	switch strategy {
 	case OnBoardingStrategyStatic:
-		// we do know the real name, so CreateOrPatch is fine
-		endpoint := &metalv1alpha1.Endpoint{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: name,
-			},
-			Spec: metalv1alpha1.EndpointSpec{
-				MACAddress: mac.String(),
-				IP:         metalv1alpha1.MustParseIP(ip.String()),
-			},
-		}
-		if _, err := controllerutil.CreateOrPatch(ctx, cl, endpoint, nil); err != nil {
-			return fmt.Errorf("failed to apply endpoint: %v", err)
-		}
+		return inventory.applyStaticEndpoint(ctx, cl, name, mac, ip, labels, metadata)
 	case OnboardingStrategyDynamic:
-		// the (generated) name is unknown, so go for filtering
-		if existingEndpoint, _ := GetEndpointForMACAddress(mac); existingEndpoint != nil {
-			if existingEndpoint.Spec.IP.String() != ip.String() {
-				log.Debugf("Endpoint exists with different IP address, updating IP address %s to %s",
-					existingEndpoint.Spec.IP.String(), ip.String())
-
-				existingEndpointBase := existingEndpoint.DeepCopy()
-				existingEndpoint.Spec.IP = metalv1alpha1.MustParseIP(ip.String())
+		// endpoints created by older versions have a generated name, so go for filtering
+		existingEndpoint, err := GetEndpointForMACAddress(mac)
+		if err != nil {
+			// do not risk a duplicate endpoint if the lookup failed
+			return fmt.Errorf("failed to look up endpoint: %w", err)
+		}
+		if existingEndpoint != nil {
+			existingEndpointBase := existingEndpoint.DeepCopy()
+			inventory.reconcileEndpointIP(existingEndpoint, ip)
+			applyLabels(existingEndpoint, labels)
 
+			if existingEndpoint.Spec.IP.String() != existingEndpointBase.Spec.IP.String() ||
+				!maps.Equal(existingEndpoint.Labels, existingEndpointBase.Labels) {
 				if err := cl.Patch(ctx, existingEndpoint, client.MergeFrom(existingEndpointBase)); err != nil {
-					return fmt.Errorf("failed to patch endpoint: %v", err)
+					return fmt.Errorf("failed to patch endpoint: %w", fedhcperrors.FromK8s(err))
 				}
 			} else {
-				return errors.NewAlreadyExists(
-					schema.GroupResource{Group: metalv1alpha1.GroupVersion.Group, Resource: "Endpoints"},
-					existingEndpoint.Name,
-				)
+				return &fedhcperrors.UpToDate{Kind: "Endpoint", Name: existingEndpoint.Name}
 			}
 		} else {
-			log.Debugf("Endpoint %s (%s) does not exist, creating", mac.String(), ip.String())
+			inventory.log.Debugf("Endpoint %s (%s) does not exist, creating", mac.String(), ip.String())
+			// the name is derived from the MAC address, so concurrent replicas
+			// cannot create duplicate endpoints for the same machine
 			endpoint := &metalv1alpha1.Endpoint{
 				ObjectMeta: metav1.ObjectMeta{
-					GenerateName: name,
+					Name:   inventory.dynamicEndpointName(name, mac),
+					Labels: labels,
 				},
 				Spec: metalv1alpha1.EndpointSpec{
 					MACAddress: mac.String(),
@@ -269,78 +530,260 @@ func ApplyEndpointForInventory(name string, mac net.HardwareAddr, ip *netip.Addr
 				},
 			}
 			if err := cl.Create(ctx, endpoint); err != nil {
-				return fmt.Errorf("failed to create endpoint: %v", err)
+				if errors.IsAlreadyExists(err) {
+					inventory.log.Debugf("Endpoint %s has been created concurrently", endpoint.Name)
+					return err
+				}
+				return fmt.Errorf("failed to create endpoint: %w", fedhcperrors.FromK8s(err))
 			}
 		}
 	default:
-		return fmt.Errorf("unknown OnboardingStrategy %s", inventory.Strategy)
+		return fmt.Errorf("unknown OnboardingStrategy %s", strategy)
+	}
+
+	return nil
+}
+
+// applyStaticEndpoint creates or patches the endpoint of a known name, of a
+// static inventory list or an inventory source.
+func (inventory *Inventory) applyStaticEndpoint(
+	ctx context.Context,
+	cl client.Client,
+	name string,
+	mac net.HardwareAddr,
+	ip *netip.Addr,
+	labels map[string]string,
+	metadata EndpointMetadata) error {
+	// we do know the real name, so CreateOrPatch is fine
+	endpoint := &metalv1alpha1.Endpoint{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+	}
+	opResult, err := controllerutil.CreateOrPatch(ctx, cl, endpoint, func() error {
+		endpoint.Spec.MACAddress = mac.String()
+		inventory.reconcileEndpointIP(endpoint, ip)
+		applyLabels(endpoint, metadata.Labels)
+		applyLabels(endpoint, labels)
+		applyAnnotations(endpoint, metadata.Annotations)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply endpoint: %w", fedhcperrors.FromK8s(err))
+	}
+	if opResult == controllerutil.OperationResultNone {
+		return &fedhcperrors.UpToDate{Kind: "Endpoint", Name: endpoint.Name}
+	}
+	return nil
+}
+
+// dynamicEndpointName returns the name of the endpoint for mac. It is rendered
+// from the name template, if configured, and made of the inventory name prefix
+// and a hash of the MAC address otherwise.
+func (inventory *Inventory) dynamicEndpointName(prefix string, mac net.HardwareAddr) string {
+	if inventory.NameTemplate != "" {
+		return renderName(inventory.NameTemplate, mac)
 	}
+	return prefix + macHash(mac)
+}
 
+func macHash(mac net.HardwareAddr) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(mac.String())))
+	return hex.EncodeToString(sum[:])[:endpointNameHashLength]
+}
+
+// renderName replaces the placeholders of a name template:
+//   - {mac-nosep}: MAC address without separators, e.g. 001a2b3c4d5e
+//   - {mac-dash}: MAC address separated by dashes, e.g. 00-1a-2b-3c-4d-5e
+//   - {mac-hash}: hash of the MAC address, e.g. 3f2a9c01b7de
+func renderName(template string, mac net.HardwareAddr) string {
+	macString := strings.ToLower(mac.String())
+	return strings.NewReplacer(
+		"{mac-nosep}", strings.ReplaceAll(macString, ":", ""),
+		"{mac-dash}", strings.ReplaceAll(macString, ":", "-"),
+		"{mac-hash}", macHash(mac),
+	).Replace(template)
+}
+
+// validateNameTemplate makes sure a name template yields distinct and valid
+// names for all MAC addresses.
+func validateNameTemplate(template string) error {
+	if !strings.Contains(template, "{mac-nosep}") &&
+		!strings.Contains(template, "{mac-dash}") &&
+		!strings.Contains(template, "{mac-hash}") {
+		return fmt.Errorf("name template %s must contain one of {mac-nosep}, {mac-dash} or {mac-hash}", template)
+	}
+
+	sample := renderName(template, net.HardwareAddr{0, 0, 0, 0, 0, 0})
+	if errs := validation.IsDNS1123Subdomain(sample); len(errs) > 0 {
+		return fmt.Errorf("name template %s does not yield valid names: %s", template, strings.Join(errs, ", "))
+	}
 	return nil
 }
 
+// applyLabels sets the given labels on the endpoint, keeping all others.
+func applyLabels(endpoint *metalv1alpha1.Endpoint, labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+	if endpoint.Labels == nil {
+		endpoint.Labels = make(map[string]string, len(labels))
+	}
+	maps.Copy(endpoint.Labels, labels)
+}
+
+// applyAnnotations sets the given annotations on the endpoint, keeping all others.
+func applyAnnotations(endpoint *metalv1alpha1.Endpoint, annotations map[string]string) {
+	if len(annotations) == 0 {
+		return
+	}
+	if endpoint.Annotations == nil {
+		endpoint.Annotations = make(map[string]string, len(annotations))
+	}
+	maps.Copy(endpoint.Annotations, annotations)
+}
+
+// endpointMetadata collects and validates the labels and annotations of an inventory entry.
+func endpointMetadata(i api.Inventory) (EndpointMetadata, error) {
+	labels := maps.Clone(i.Labels)
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	if i.Type != "" {
+		labels[typeLabel] = i.Type
+	}
+	if i.Rack != "" {
+		labels[rackLabel] = i.Rack
+	}
+
+	for key, value := range labels {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return EndpointMetadata{}, fmt.Errorf("invalid label key %s of inventory %s: %s", key, i.Name, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return EndpointMetadata{}, fmt.Errorf("invalid value of label %s of inventory %s: %s", key, i.Name, strings.Join(errs, ", "))
+		}
+	}
+	for key := range i.Annotations {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return EndpointMetadata{}, fmt.Errorf("invalid annotation key %s of inventory %s: %s", key, i.Name, strings.Join(errs, ", "))
+		}
+	}
+
+	return EndpointMetadata{Labels: labels, Annotations: maps.Clone(i.Annotations)}, nil
+}
+
+// reconcileEndpointIP sets the IP address of the endpoint to ip, if the endpoint
+// has none yet or FeDHCP is authoritative for it. A drift is logged otherwise.
+// An address of the family taking precedence is never replaced by one of the
+// other family, so the endpoint doesn't flip when requests of both families race.
+func (inventory *Inventory) reconcileEndpointIP(endpoint *metalv1alpha1.Endpoint, ip *netip.Addr) {
+	if endpoint.Spec.IP.IsValid() && endpoint.Spec.IP.String() == ip.String() {
+		return
+	}
+
+	switch {
+	case !endpoint.Spec.IP.IsValid():
+		endpoint.Spec.IP = metalv1alpha1.MustParseIP(ip.String())
+	case inventory.FamilyPrecedence != "" &&
+		addressFamily(endpoint.Spec.IP.Addr) == inventory.FamilyPrecedence &&
+		addressFamily(*ip) != inventory.FamilyPrecedence:
+		inventory.log.Debugf("Endpoint %s keeps %s address %s, not replacing it with %s",
+			endpoint.Name, inventory.FamilyPrecedence, endpoint.Spec.IP.String(), ip.String())
+	case inventory.AuthoritativeIP:
+		inventory.log.Debugf("Endpoint exists with different IP address, updating IP address %s to %s",
+			endpoint.Spec.IP.String(), ip.String())
+		endpoint.Spec.IP = metalv1alpha1.MustParseIP(ip.String())
+	default:
+		inventory.log.Warnf("Endpoint %s has IP address %s, IPAM has %s; not authoritative, leaving it",
+			endpoint.Name, endpoint.Spec.IP.String(), ip.String())
+	}
+}
+
 func GetEndpointForMACAddress(mac net.HardwareAddr) (*metalv1alpha1.Endpoint, error) {
 	cl := kubernetes.GetClient()
 	if cl == nil {
-		return nil, fmt.Errorf("kubernetes client not initialized")
+		return nil, &fedhcperrors.K8sUnavailable{Err: fmt.Errorf("kubernetes client not initialized")}
 	}
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	epList := &metalv1alpha1.EndpointList{}
-	if err := cl.List(ctx, epList); err != nil {
-		return nil, fmt.Errorf("failed to list Endpoints: %v", err)
+	endpoints, err := kubernetes.EndpointsForMAC(ctx, mac)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Endpoints: %w", fedhcperrors.FromK8s(err))
 	}
+	if len(endpoints) == 0 {
+		return nil, nil
+	}
+	return &endpoints[0], nil
+}
 
-	for _, ep := range epList.Items {
-		if ep.Spec.MACAddress == mac.String() {
-			return &ep, nil
-		}
+func (inventory *Inventory) GetInventoryEntryMatchingMACAddress(mac net.HardwareAddr) string {
+	if entry := inventory.matchEntry(mac, ""); entry != "" {
+		return inventory.Entries[entry]
 	}
-	return nil, nil
+	return ""
 }
 
-func GetInventoryEntryMatchingMACAddress(mac net.HardwareAddr) string {
+// matchEntry returns the key of the entry matching the DUID or, if none does,
+// the MAC address or prefix of the entry matching mac, or the empty string if
+// none does. DUIDs are only matched by static inventory lists.
+func (inventory *Inventory) matchEntry(mac net.HardwareAddr, duid string) string {
 	switch inventory.Strategy {
 	case OnBoardingStrategyStatic:
-		inventoryName, ok := inventory.Entries[strings.ToLower(mac.String())]
-		if !ok {
-			log.Debugf("Unknown inventory MAC address: %s", mac.String())
-		} else {
-			return inventoryName
+		if _, ok := inventory.Entries[duid]; duid != "" && ok {
+			return duid
+		}
+		entry := strings.ToLower(mac.String())
+		if _, ok := inventory.Entries[entry]; ok {
+			return entry
 		}
+		inventory.log.Debugf("Unknown inventory MAC address: %s", mac.String())
 	case OnboardingStrategyDynamic:
 		for i := range inventory.Entries {
 			if strings.HasPrefix(strings.ToLower(mac.String()), strings.ToLower(i)) {
-				return inventory.Entries[i]
+				return i
 			}
 		}
 		// we don't onboard by default yet, might change in the future
-		log.Debugf("Inventory MAC address %s does not match any inventory MAC prefix", mac.String())
+		inventory.log.Debugf("Inventory MAC address %s does not match any inventory MAC prefix", mac.String())
 	default:
-		log.Debugf("Unknown Onboarding strategy %s", inventory.Strategy)
+		inventory.log.Debugf("Unknown Onboarding strategy %s", inventory.Strategy)
 	}
 
 	return ""
 }
 
+// onboards reports whether the entry is onboarded from requests of the
+// address family.
+func (inventory *Inventory) onboards(entry string, subnetFamily ipamv1alpha1.SubnetAddressType) bool {
+	family, ok := inventory.Families[entry]
+	return !ok || family == subnetFamily
+}
+
+func addressFamily(addr netip.Addr) ipamv1alpha1.SubnetAddressType {
+	if addr.Unmap().Is4() {
+		return ipamv1alpha1.CIPv4SubnetType
+	}
+	return ipamv1alpha1.CIPv6SubnetType
+}
+
 func GetIPAMIPAddressForMACAddress(mac net.HardwareAddr, subnetFamily ipamv1alpha1.SubnetAddressType) (*netip.Addr, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	cl := kubernetes.GetClient()
 	if cl == nil {
-		return nil, fmt.Errorf("kubernetes client not initialized")
+		return nil, &fedhcperrors.K8sUnavailable{Err: fmt.Errorf("kubernetes client not initialized")}
 	}
 
-	ips := &ipamv1alpha1.IPList{}
-	if err := cl.List(ctx, ips); err != nil {
-		return nil, fmt.Errorf("failed to list IPs: %v", err)
+	ips, err := kubernetes.IPsForMAC(ctx, "", mac)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list IPs: %w", fedhcperrors.FromK8s(err))
 	}
 
-	sanitizedMAC := strings.Replace(strings.ToLower(mac.String()), ":", "", -1)
-	for _, ip := range ips.Items {
-		if ip.Labels["mac"] == sanitizedMAC && ipFamilyMatches(ip, subnetFamily) {
+	for _, ip := range ips {
+		if ipFamilyMatches(ip, subnetFamily) {
 			return &ip.Status.Reserved.Net, nil
 		}
 	}
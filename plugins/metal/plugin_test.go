@@ -4,13 +4,22 @@
 package metal
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/ironcore-dev/fedhcp/internal/api"
-
-	"gopkg.in/yaml.v2"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/links"
+	"github.com/ironcore-dev/fedhcp/internal/testenv"
 
 	"github.com/insomniacslk/dhcp/dhcpv4"
 	"github.com/insomniacslk/dhcp/dhcpv6"
@@ -22,6 +31,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	. "sigs.k8s.io/controller-runtime/pkg/envtest/komega"
 )
 
@@ -119,7 +129,6 @@ var _ = Describe("Endpoint", func() {
 	})
 
 	It("Should return an empty inventory for an empty list", func() {
-		configFile := inventoryConfigFile
 		data := api.MetalConfig{
 			Inventories: []api.Inventory{
 				{},
@@ -128,23 +137,12 @@ var _ = Describe("Endpoint", func() {
 				MacPrefix: []string{},
 			},
 		}
-		configData, err := yaml.Marshal(data)
-		Expect(err).NotTo(HaveOccurred())
-
-		file, err := os.CreateTemp(GinkgoT().TempDir(), configFile)
-		Expect(err).NotTo(HaveOccurred())
-		defer func() {
-			_ = file.Close()
-		}()
-		Expect(os.WriteFile(file.Name(), configData, 0644)).To(Succeed())
-
-		i, err := loadConfig(file.Name())
+		i, err := loadConfig(testenv.WriteConfig(data))
 		Expect(err).NotTo(HaveOccurred())
 		Expect(i.Entries).To(BeEmpty())
 	})
 
 	It("Should return a valid inventory list with default name prefix for non-empty MAC address filter", func() {
-		configFile := inventoryConfigFile
 		data := api.MetalConfig{
 			Filter: api.Filter{
 				MacPrefix: []string{
@@ -152,17 +150,7 @@ var _ = Describe("Endpoint", func() {
 				},
 			},
 		}
-		configData, err := yaml.Marshal(data)
-		Expect(err).NotTo(HaveOccurred())
-
-		file, err := os.CreateTemp(GinkgoT().TempDir(), configFile)
-		Expect(err).NotTo(HaveOccurred())
-		defer func() {
-			_ = file.Close()
-		}()
-		Expect(os.WriteFile(file.Name(), configData, 0644)).To(Succeed())
-
-		i, err := loadConfig(file.Name())
+		i, err := loadConfig(testenv.WriteConfig(data))
 		Expect(err).NotTo(HaveOccurred())
 		Expect(i.Entries).To(HaveKey("aa:bb:cc:dd:ee:ff"))
 		pref := i.Entries["aa:bb:cc:dd:ee:ff"]
@@ -170,7 +158,6 @@ var _ = Describe("Endpoint", func() {
 	})
 
 	It("Should return an inventory list with custom name prefix for non-empty MAC address filter and set prefix", func() {
-		configFile := inventoryConfigFile
 		data := api.MetalConfig{
 			NamePrefix: "server-",
 			Filter: api.Filter{
@@ -179,25 +166,44 @@ var _ = Describe("Endpoint", func() {
 				},
 			},
 		}
-		configData, err := yaml.Marshal(data)
-		Expect(err).NotTo(HaveOccurred())
-
-		file, err := os.CreateTemp(GinkgoT().TempDir(), configFile)
-		Expect(err).NotTo(HaveOccurred())
-		defer func() {
-			_ = file.Close()
-		}()
-		Expect(os.WriteFile(file.Name(), configData, 0644)).To(Succeed())
-
-		i, err := loadConfig(file.Name())
+		i, err := loadConfig(testenv.WriteConfig(data))
 		Expect(err).NotTo(HaveOccurred())
 		Expect(i.Entries).To(HaveKey("aa:bb:cc:dd:ee:ff"))
 		pref := i.Entries["aa:bb:cc:dd:ee:ff"]
 		Expect(pref).To(HavePrefix("server-"))
 	})
 
+	It("Should render endpoint names from a name template for non-empty MAC address filter", func() {
+		data := api.MetalConfig{
+			NameTemplate: "compute-{mac-nosep}",
+			Filter: api.Filter{
+				MacPrefix: []string{
+					"aa:bb:cc:dd:ee:ff",
+				},
+			},
+		}
+		i, err := loadConfig(testenv.WriteConfig(data))
+		Expect(err).NotTo(HaveOccurred())
+		mac, _ := net.ParseMAC("AA:BB:CC:DD:EE:FF")
+		Expect(i.dynamicEndpointName(defaultNamePrefix, mac)).To(Equal("compute-aabbccddeeff"))
+	})
+
+	It("Should return error for a name template not yielding distinct valid names", func() {
+		for _, template := range []string{"compute", "Compute_{mac-nosep}"} {
+			data := api.MetalConfig{
+				NameTemplate: template,
+				Filter: api.Filter{
+					MacPrefix: []string{
+						"aa:bb:cc:dd:ee:ff",
+					},
+				},
+			}
+			_, err := loadConfig(testenv.WriteConfig(data))
+			Expect(err).To(HaveOccurred())
+		}
+	})
+
 	It("Should return a valid inventory list for a non-empty inventory section, precedence over MAC filter", func() {
-		configFile := inventoryConfigFile
 		data := api.MetalConfig{
 			NamePrefix: "server-",
 			Inventories: []api.Inventory{
@@ -212,17 +218,7 @@ var _ = Describe("Endpoint", func() {
 				},
 			},
 		}
-		configData, err := yaml.Marshal(data)
-		Expect(err).NotTo(HaveOccurred())
-
-		file, err := os.CreateTemp(GinkgoT().TempDir(), configFile)
-		Expect(err).NotTo(HaveOccurred())
-		defer func() {
-			_ = file.Close()
-		}()
-		Expect(os.WriteFile(file.Name(), configData, 0644)).To(Succeed())
-
-		i, err := loadConfig(file.Name())
+		i, err := loadConfig(testenv.WriteConfig(data))
 		Expect(err).NotTo(HaveOccurred())
 		Expect(i.Entries).To(HaveKeyWithValue("aa:bb:cc:dd:ee:ff", "compute-1"))
 	})
@@ -238,7 +234,7 @@ var _ = Describe("Endpoint", func() {
 
 		stub, _ := dhcpv6.NewMessage()
 		stub.MessageType = dhcpv6.MessageTypeReply
-		_, _ = handler6(relayedRequest, stub)
+		_, _ = inventory.handler6(relayedRequest, stub)
 
 		endpoint := &metalv1alpha1.Endpoint{
 			ObjectMeta: metav1.ObjectMeta{
@@ -261,7 +257,6 @@ var _ = Describe("Endpoint", func() {
 		req.MessageType = dhcpv6.MessageTypeRequest
 		relayedRequest, _ := dhcpv6.EncapsulateRelay(req, dhcpv6.MessageTypeRelayForward, net.IPv6loopback, linkLocalIPV6Addr)
 
-		configFile := inventoryConfigFile
 		data := api.MetalConfig{
 			NamePrefix:  "foobar-",
 			Inventories: []api.Inventory{},
@@ -269,28 +264,18 @@ var _ = Describe("Endpoint", func() {
 				MacPrefix: []string{machineWithIPAddressMACAddressPrefFilter},
 			},
 		}
-		configData, err := yaml.Marshal(data)
-		Expect(err).NotTo(HaveOccurred())
-
-		file, err := os.CreateTemp(GinkgoT().TempDir(), configFile)
-		Expect(err).NotTo(HaveOccurred())
-		defer func() {
-			_ = file.Close()
-		}()
-		Expect(os.WriteFile(file.Name(), configData, 0644)).To(Succeed())
-
-		inventory, err = loadConfig(file.Name())
+		inventory, err := loadConfig(testenv.WriteConfig(data))
 		Expect(err).NotTo(HaveOccurred())
 
 		stub, _ := dhcpv6.NewMessage()
 		stub.MessageType = dhcpv6.MessageTypeReply
-		_, _ = handler6(relayedRequest, stub)
+		_, _ = inventory.handler6(relayedRequest, stub)
 
 		epList := &metalv1alpha1.EndpointList{}
 		Eventually(ObjectList(epList)).Should(SatisfyAll(
 			HaveField("Items", HaveLen(1)),
 			HaveField("Items", ContainElement(SatisfyAll(
-				HaveField("ObjectMeta.Name", HavePrefix("foobar-")),
+				HaveField("ObjectMeta.Name", inventory.dynamicEndpointName("foobar-", mac)),
 				HaveField("Spec.MACAddress", machineWithIPAddressMACAddress),
 				HaveField("Spec.IP", metalv1alpha1.MustParseIP(linkLocalIPV6Addr.String())),
 			))),
@@ -304,6 +289,235 @@ var _ = Describe("Endpoint", func() {
 		DeferCleanup(k8sClient.Delete, endpoint)
 	})
 
+	It("Should repair the IP address of an existing static endpoint", func(ctx SpecContext) {
+		mac, _ := net.ParseMAC(machineWithIPAddressMACAddress)
+		ip := net.ParseIP(linkLocalIPV6Prefix)
+		linkLocalIPV6Addr, _ := eui64.ParseMAC(ip, mac)
+
+		endpoint := &metalv1alpha1.Endpoint{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: machineWithIPAddressName,
+			},
+			Spec: metalv1alpha1.EndpointSpec{
+				MACAddress: machineWithIPAddressMACAddress,
+				IP:         metalv1alpha1.MustParseIP("fe80::dead"),
+			},
+		}
+		Expect(k8sClient.Create(ctx, endpoint)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, endpoint)
+
+		req, _ := dhcpv6.NewMessage()
+		req.MessageType = dhcpv6.MessageTypeRequest
+		relayedRequest, _ := dhcpv6.EncapsulateRelay(req, dhcpv6.MessageTypeRelayForward, net.IPv6loopback, linkLocalIPV6Addr)
+
+		stub, _ := dhcpv6.NewMessage()
+		stub.MessageType = dhcpv6.MessageTypeReply
+		_, _ = inventory.handler6(relayedRequest, stub)
+
+		Eventually(Object(endpoint)).Should(SatisfyAll(
+			HaveField("Spec.MACAddress", machineWithIPAddressMACAddress),
+			HaveField("Spec.IP", metalv1alpha1.MustParseIP(linkLocalIPV6Addr.String()))))
+	})
+
+	It("Should keep the IP address of an existing static endpoint if not authoritative", func(ctx SpecContext) {
+		mac, _ := net.ParseMAC(machineWithIPAddressMACAddress)
+		ip := net.ParseIP(linkLocalIPV6Prefix)
+		linkLocalIPV6Addr, _ := eui64.ParseMAC(ip, mac)
+
+		endpoint := &metalv1alpha1.Endpoint{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: machineWithIPAddressName,
+			},
+			Spec: metalv1alpha1.EndpointSpec{
+				MACAddress: machineWithIPAddressMACAddress,
+				IP:         metalv1alpha1.MustParseIP("fe80::dead"),
+			},
+		}
+		Expect(k8sClient.Create(ctx, endpoint)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, endpoint)
+
+		nonAuthoritative := *inventory
+		nonAuthoritative.AuthoritativeIP = false
+
+		req, _ := dhcpv6.NewMessage()
+		req.MessageType = dhcpv6.MessageTypeRequest
+		relayedRequest, _ := dhcpv6.EncapsulateRelay(req, dhcpv6.MessageTypeRelayForward, net.IPv6loopback, linkLocalIPV6Addr)
+
+		stub, _ := dhcpv6.NewMessage()
+		stub.MessageType = dhcpv6.MessageTypeReply
+		_, _ = nonAuthoritative.handler6(relayedRequest, stub)
+
+		Consistently(Object(endpoint)).Should(
+			HaveField("Spec.IP", metalv1alpha1.MustParseIP("fe80::dead")))
+	})
+
+	It("Should label the endpoint with the fingerprinted device class", func(ctx SpecContext) {
+		mac, _ := net.ParseMAC(machineWithIPAddressMACAddress)
+		ip := net.ParseIP(linkLocalIPV6Prefix)
+		linkLocalIPV6Addr, _ := eui64.ParseMAC(ip, mac)
+
+		labeling := *inventory
+		labeling.DeviceClassLabels = true
+
+		req, _ := dhcpv6.NewMessage()
+		req.MessageType = dhcpv6.MessageTypeRequest
+		req.AddOption(&dhcpv6.OptVendorClass{EnterpriseNumber: 343, Data: [][]byte{[]byte("HTTPClient:Arch:00016")}})
+		relayedRequest, _ := dhcpv6.EncapsulateRelay(req, dhcpv6.MessageTypeRelayForward, net.IPv6loopback, linkLocalIPV6Addr)
+
+		stub, _ := dhcpv6.NewMessage()
+		stub.MessageType = dhcpv6.MessageTypeReply
+		_, _ = labeling.handler6(relayedRequest, stub)
+
+		endpoint := &metalv1alpha1.Endpoint{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: machineWithIPAddressName,
+			},
+		}
+		Eventually(Object(endpoint)).Should(SatisfyAll(
+			HaveField("Labels", HaveKeyWithValue(deviceClassLabel, "server-nic")),
+			HaveField("Labels", HaveKey(fingerprintLabel))))
+		DeferCleanup(k8sClient.Delete, endpoint)
+	})
+
+	It("Should pass inventory metadata to the endpoint of a static inventory", func(ctx SpecContext) {
+		mac, _ := net.ParseMAC(machineWithIPAddressMACAddress)
+		ip := net.ParseIP(linkLocalIPV6Prefix)
+		linkLocalIPV6Addr, _ := eui64.ParseMAC(ip, mac)
+
+		withMetadata := *inventory
+		withMetadata.Metadata = map[string]EndpointMetadata{
+			machineWithIPAddressMACAddress: {
+				Labels:      map[string]string{rackLabel: "rack-01", "team": "compute"},
+				Annotations: map[string]string{"example.org/serial": "SN-0815"},
+			},
+		}
+
+		req, _ := dhcpv6.NewMessage()
+		req.MessageType = dhcpv6.MessageTypeRequest
+		relayedRequest, _ := dhcpv6.EncapsulateRelay(req, dhcpv6.MessageTypeRelayForward, net.IPv6loopback, linkLocalIPV6Addr)
+
+		stub, _ := dhcpv6.NewMessage()
+		stub.MessageType = dhcpv6.MessageTypeReply
+		_, _ = withMetadata.handler6(relayedRequest, stub)
+
+		endpoint := &metalv1alpha1.Endpoint{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: machineWithIPAddressName,
+			},
+		}
+		Eventually(Object(endpoint)).Should(SatisfyAll(
+			HaveField("Labels", HaveKeyWithValue(rackLabel, "rack-01")),
+			HaveField("Labels", HaveKeyWithValue("team", "compute")),
+			HaveField("Annotations", HaveKeyWithValue("example.org/serial", "SN-0815"))))
+		DeferCleanup(k8sClient.Delete, endpoint)
+	})
+
+	It("Should create the endpoint of a machine known to an inventory source", func(ctx SpecContext) {
+		mac, _ := net.ParseMAC(machineWithIPAddressMACAddress)
+		hosts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"hosts": [{"name": "sourced-machine", "macAddress": "` + machineWithIPAddressMACAddress + `", "labels": {"team": "storage"}}]}`))
+		}))
+		DeferCleanup(hosts.Close)
+
+		sources, err := parseSources([]api.InventorySource{
+			{Name: "missing", File: "/nonexistent/hosts.yaml"},
+			{Name: "storage", URL: hosts.URL},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		sourced := *inventory
+		sourced.Entries = map[string]string{}
+		sourced.Sources = sources
+		sourced.unknown = newUnknownCache("metal/sources")
+
+		// the failing source is skipped, the one behind it knows the machine
+		Expect(sourced.applyEndpoint(mac, "", ipamv1alpha1.CIPv6SubnetType, nil)).To(Succeed())
+		endpoint := &metalv1alpha1.Endpoint{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "sourced-machine",
+			},
+		}
+		Eventually(Object(endpoint)).Should(SatisfyAll(
+			HaveField("Spec.MACAddress", machineWithIPAddressMACAddress),
+			HaveField("Labels", HaveKeyWithValue("team", "storage"))))
+		DeferCleanup(k8sClient.Delete, endpoint)
+
+		states := sourced.sourceStates()
+		Expect(states).To(HaveLen(2))
+		Expect(states[0]).To(SatisfyAll(HaveField("Healthy", BeFalse()), HaveField("Error", Not(BeEmpty()))))
+		Expect(states[1]).To(SatisfyAll(HaveField("Healthy", BeTrue()), HaveField("Hosts", 1)))
+
+		// an unknown machine is not remembered while a source fails
+		unknown, _ := net.ParseMAC(unknownMachineMACAddress)
+		Expect(sourced.applyEndpoint(unknown, "", ipamv1alpha1.CIPv6SubnetType, nil)).NotTo(Succeed())
+		Expect(sourced.knownUnknown(unknown, "")).To(BeFalse())
+	})
+
+	It("Should create the endpoint of a machine known as a Server", func(ctx SpecContext) {
+		mac, _ := net.ParseMAC(machineWithIPAddressMACAddress)
+		server := &metalv1alpha1.Server{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "server-source-machine",
+				Labels: map[string]string{"team": "compute"},
+			},
+			Spec: metalv1alpha1.ServerSpec{UUID: "38947555-7742-3448-3784-823347823834"},
+		}
+		Expect(k8sClient.Create(ctx, server)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, server)
+		Eventually(UpdateStatus(server, func() {
+			server.Status.NetworkInterfaces = []metalv1alpha1.NetworkInterface{{
+				Name:       "eth0",
+				IP:         metalv1alpha1.MustParseIP(privateIPV4Address),
+				MACAddress: machineWithIPAddressMACAddress,
+			}}
+		})).Should(Succeed())
+
+		sources, err := parseSources([]api.InventorySource{
+			{Name: "other", Servers: &api.ServerSource{LabelSelector: "team=storage"}},
+			{Name: "compute", Servers: &api.ServerSource{LabelSelector: "team=compute"}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		sourced := *inventory
+		sourced.Entries = map[string]string{}
+		sourced.Sources = sources
+
+		Expect(sourced.applyEndpoint(mac, "", ipamv1alpha1.CIPv4SubnetType, nil)).To(Succeed())
+		endpoint := &metalv1alpha1.Endpoint{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: server.Name,
+			},
+		}
+		Eventually(Object(endpoint)).Should(HaveField("Spec.MACAddress", machineWithIPAddressMACAddress))
+		DeferCleanup(k8sClient.Delete, endpoint)
+	})
+
+	It("Should return error for invalid inventory sources", func() {
+		for _, sources := range [][]api.InventorySource{
+			{{File: "hosts.yaml"}},
+			{{Name: "a", File: "hosts.yaml"}, {Name: "a", URL: "http://inventory.example.org"}},
+			{{Name: "a"}},
+			{{Name: "a", File: "hosts.yaml", URL: "http://inventory.example.org"}},
+			{{Name: "a", Servers: &api.ServerSource{LabelSelector: "team in"}}},
+			{{Name: "a", File: "hosts.yaml", Interval: -time.Second}},
+		} {
+			_, err := parseSources(sources)
+			Expect(err).To(HaveOccurred(), "sources %+v", sources)
+		}
+	})
+
+	It("Should return error for invalid inventory labels", func() {
+		data := api.MetalConfig{
+			Inventories: []api.Inventory{
+				{
+					Name:       "compute-1",
+					MacAddress: "aa:bb:cc:dd:ee:ff",
+					Rack:       "rack 01",
+				},
+			},
+		}
+		_, err := loadConfig(testenv.WriteConfig(data))
+		Expect(err).To(HaveOccurred())
+	})
+
 	It("Should not return an IP address for a known machine without IP address", func(ctx SpecContext) {
 		mac, _ := net.ParseMAC(machineWithoutIPAddressMACAddress)
 
@@ -325,7 +539,7 @@ var _ = Describe("Endpoint", func() {
 
 			stub, _ := dhcpv6.NewMessage()
 			stub.MessageType = dhcpv6.MessageTypeReply
-			_, _ = handler6(relayedRequest, stub)
+			_, _ = inventory.handler6(relayedRequest, stub)
 
 			endpoint := &metalv1alpha1.Endpoint{
 				ObjectMeta: metav1.ObjectMeta{
@@ -346,7 +560,7 @@ var _ = Describe("Endpoint", func() {
 
 		stub, _ := dhcpv6.NewMessage()
 		stub.MessageType = dhcpv6.MessageTypeReply
-		_, _ = handler6(relayedRequest, stub)
+		_, _ = inventory.handler6(relayedRequest, stub)
 
 		endpoint := &metalv1alpha1.Endpoint{
 			ObjectMeta: metav1.ObjectMeta{
@@ -356,13 +570,26 @@ var _ = Describe("Endpoint", func() {
 		Eventually(Get(endpoint)).Should(Satisfy(apierrors.IsNotFound))
 	})
 
+	It("Should remember unknown machines", func() {
+		mac, _ := net.ParseMAC(unknownMachineMACAddress)
+		remembering := *inventory
+		remembering.unknown = newUnknownCache("metal/test")
+
+		Expect(remembering.knownUnknown(mac, "")).To(BeFalse())
+		Expect(remembering.applyEndpoint(mac, "", ipamv1alpha1.CIPv6SubnetType, nil)).To(Succeed())
+		Expect(remembering.knownUnknown(mac, "")).To(BeTrue())
+
+		// other inventories, e.g. a replaced config, match the machine afresh
+		Expect(inventory.knownUnknown(mac, "")).To(BeFalse())
+	})
+
 	It("Should return and break plugin chain, if getting an IPv6 DHCP request directly (no relay)", func(ctx SpecContext) {
 		req, _ := dhcpv6.NewMessage()
 		req.MessageType = dhcpv6.MessageTypeRequest
 
 		stub, _ := dhcpv6.NewMessage()
 		stub.MessageType = dhcpv6.MessageTypeReply
-		resp, breakChain := handler6(req, stub)
+		resp, breakChain := inventory.handler6(req, stub)
 
 		Eventually(resp).Should(BeNil())
 		Eventually(breakChain).Should(BeTrue())
@@ -374,7 +601,7 @@ var _ = Describe("Endpoint", func() {
 		req, _ := dhcpv4.NewDiscovery(mac)
 		stub, _ := dhcpv4.NewReplyFromRequest(req)
 
-		_, _ = handler4(req, stub)
+		_, _ = inventory.handler4(req, stub)
 
 		endpoint := &metalv1alpha1.Endpoint{
 			ObjectMeta: metav1.ObjectMeta{
@@ -389,13 +616,175 @@ var _ = Describe("Endpoint", func() {
 		DeferCleanup(k8sClient.Delete, endpoint)
 	})
 
+	It("Should not create an endpoint for IPv4 DHCP request from an IPv6-only machine", func(ctx SpecContext) {
+		mac, _ := net.ParseMAC(machineWithIPAddressMACAddress)
+
+		ipv6Only := *inventory
+		ipv6Only.Families = map[string]ipamv1alpha1.SubnetAddressType{
+			machineWithIPAddressMACAddress: ipamv1alpha1.CIPv6SubnetType,
+		}
+
+		req, _ := dhcpv4.NewDiscovery(mac)
+		stub, _ := dhcpv4.NewReplyFromRequest(req)
+		_, _ = ipv6Only.handler4(req, stub)
+
+		endpoint := &metalv1alpha1.Endpoint{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: machineWithIPAddressName,
+			},
+		}
+		Consistently(Get(endpoint)).Should(Satisfy(apierrors.IsNotFound))
+	})
+
+	It("Should keep the IPv6 address of an existing endpoint on IPv4 DHCP request with IPv6 precedence", func(ctx SpecContext) {
+		mac, _ := net.ParseMAC(machineWithIPAddressMACAddress)
+		ip := net.ParseIP(linkLocalIPV6Prefix)
+		linkLocalIPV6Addr, _ := eui64.ParseMAC(ip, mac)
+
+		endpoint := &metalv1alpha1.Endpoint{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: machineWithIPAddressName,
+			},
+			Spec: metalv1alpha1.EndpointSpec{
+				MACAddress: machineWithIPAddressMACAddress,
+				IP:         metalv1alpha1.MustParseIP(linkLocalIPV6Addr.String()),
+			},
+		}
+		Expect(k8sClient.Create(ctx, endpoint)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, endpoint)
+
+		ipv6Precedence := *inventory
+		ipv6Precedence.FamilyPrecedence = ipamv1alpha1.CIPv6SubnetType
+
+		req, _ := dhcpv4.NewDiscovery(mac)
+		stub, _ := dhcpv4.NewReplyFromRequest(req)
+		_, _ = ipv6Precedence.handler4(req, stub)
+
+		Consistently(Object(endpoint)).Should(
+			HaveField("Spec.IP", metalv1alpha1.MustParseIP(linkLocalIPV6Addr.String())))
+	})
+
+	It("Should link the endpoint to its IPAM IPs", func(ctx SpecContext) {
+		mac, _ := net.ParseMAC(machineWithIPAddressMACAddress)
+		linkLocalIPV6Addr, _ := eui64.ParseMAC(net.ParseIP(linkLocalIPV6Prefix), mac)
+
+		req, _ := dhcpv6.NewMessage()
+		req.MessageType = dhcpv6.MessageTypeRequest
+		relayedRequest, _ := dhcpv6.EncapsulateRelay(req, dhcpv6.MessageTypeRelayForward, net.IPv6loopback, linkLocalIPV6Addr)
+		stub, _ := dhcpv6.NewMessage()
+		stub.MessageType = dhcpv6.MessageTypeReply
+
+		linked := *inventory
+		var err error
+		linked.Links, err = links.New(api.Links{Enabled: true, Owner: api.LinkOwnerEndpoint})
+		Expect(err).NotTo(HaveOccurred())
+		_, _ = linked.handler6(relayedRequest, stub)
+
+		endpoint := &metalv1alpha1.Endpoint{ObjectMeta: metav1.ObjectMeta{Name: machineWithIPAddressName}}
+		DeferCleanup(k8sClient.Delete, endpoint)
+		Eventually(Object(endpoint)).Should(HaveField("Labels", HaveKeyWithValue(links.Label, "112233445566")))
+
+		ips := &ipamv1alpha1.IPList{}
+		Expect(k8sClient.List(ctx, ips, client.InNamespace(ns.Name))).To(Succeed())
+		Expect(ips.Items).To(HaveLen(2))
+		for _, ip := range ips.Items {
+			Expect(ip.Labels).To(HaveKeyWithValue(links.Label, "112233445566"))
+			Expect(ip.OwnerReferences).To(ConsistOf(HaveField("Name", machineWithIPAddressName)))
+		}
+	})
+
+	It("Should parse the address families of the inventories", func() {
+		for _, tc := range []struct {
+			config api.MetalConfig
+			valid  bool
+		}{
+			{config: api.MetalConfig{
+				FamilyPrecedence: "IPv6",
+				Inventories:      []api.Inventory{{Name: "compute-1", MacAddress: "aa:bb:cc:dd:ee:ff", Family: "IPv6"}},
+			}, valid: true},
+			{config: api.MetalConfig{
+				Filter: api.Filter{MacPrefix: []string{"aa:bb:cc"}, Family: "IPv4"},
+			}, valid: true},
+			{config: api.MetalConfig{
+				Inventories: []api.Inventory{{Name: "compute-1", MacAddress: "aa:bb:cc:dd:ee:ff", Family: "ipv6"}},
+			}},
+			{config: api.MetalConfig{
+				FamilyPrecedence: "both",
+				Filter:           api.Filter{MacPrefix: []string{"aa:bb:cc"}},
+			}},
+		} {
+			configData, err := api.Marshal(tc.config)
+			Expect(err).NotTo(HaveOccurred())
+
+			i, err := parseConfig(configData)
+			if !tc.valid {
+				Expect(err).To(HaveOccurred())
+				continue
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(i.Families).To(HaveLen(1))
+		}
+	})
+
+	It("Should parse the DUIDs of the inventories", func() {
+		configData, err := api.Marshal(api.MetalConfig{
+			Inventories: []api.Inventory{
+				{Name: "dpu-1", DUID: "00:04:6f:0b:5a:8e:41:74:4c:95:9b:3c:21:6d:0e:44:1f:9a"},
+				{Name: "dpu-2", DUID: "0004-6f0b5a8e41744c959b3c216d0e441f9b", MacAddress: "AA:BB:CC:DD:EE:FF"},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		i, err := parseConfig(configData)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(i.Entries).To(Equal(map[string]string{
+			"duid:00046f0b5a8e41744c959b3c216d0e441f9a": "dpu-1",
+			"duid:00046f0b5a8e41744c959b3c216d0e441f9b": "dpu-2",
+			"aa:bb:cc:dd:ee:ff":                         "dpu-2",
+		}))
+
+		for _, duid := range []string{"00:04:zz", "00"} {
+			configData, err := api.Marshal(api.MetalConfig{Inventories: []api.Inventory{{Name: "dpu-1", DUID: duid}}})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = parseConfig(configData)
+			Expect(err).To(HaveOccurred())
+		}
+	})
+
+	It("Should create the endpoint of an inventory matched by DUID", func(ctx SpecContext) {
+		mac, _ := net.ParseMAC(machineWithIPAddressMACAddress)
+		ip := net.ParseIP(linkLocalIPV6Prefix)
+		linkLocalIPV6Addr, _ := eui64.ParseMAC(ip, mac)
+		duid := &dhcpv6.DUIDUUID{UUID: [16]byte{0x6f, 0x0b, 0x5a, 0x8e, 0x41, 0x74, 0x4c, 0x95, 0x9b, 0x3c, 0x21, 0x6d, 0x0e, 0x44, 0x1f, 0x9a}}
+
+		// the MAC address is randomized, so only the DUID is known
+		withDUID := *inventory
+		withDUID.Entries = map[string]string{duidKey(duid.ToBytes()): "dpu-1"}
+
+		req, _ := dhcpv6.NewMessage(dhcpv6.WithClientID(duid))
+		req.MessageType = dhcpv6.MessageTypeRequest
+		relayedRequest, _ := dhcpv6.EncapsulateRelay(req, dhcpv6.MessageTypeRelayForward, net.IPv6loopback, linkLocalIPV6Addr)
+
+		stub, _ := dhcpv6.NewMessage()
+		stub.MessageType = dhcpv6.MessageTypeReply
+		_, _ = withDUID.handler6(relayedRequest, stub)
+
+		endpoint := &metalv1alpha1.Endpoint{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "dpu-1",
+			},
+		}
+		Eventually(Object(endpoint)).Should(SatisfyAll(
+			HaveField("Spec.MACAddress", machineWithIPAddressMACAddress),
+			HaveField("Spec.IP", metalv1alpha1.MustParseIP(linkLocalIPV6Addr.String()))))
+		DeferCleanup(k8sClient.Delete, endpoint)
+	})
+
 	It("Should create an endpoint for IPv4 DHCP request from a known MAC prefix with IP address", func(ctx SpecContext) {
 		mac, _ := net.ParseMAC(machineWithIPAddressMACAddress)
 
 		req, _ := dhcpv4.NewDiscovery(mac)
 		stub, _ := dhcpv4.NewReplyFromRequest(req)
 
-		configFile := inventoryConfigFile
 		data := api.MetalConfig{
 			NamePrefix:  "",
 			Inventories: []api.Inventory{},
@@ -403,20 +792,10 @@ var _ = Describe("Endpoint", func() {
 				MacPrefix: []string{machineWithIPAddressMACAddressPrefFilter},
 			},
 		}
-		configData, err := yaml.Marshal(data)
-		Expect(err).NotTo(HaveOccurred())
-
-		file, err := os.CreateTemp(GinkgoT().TempDir(), configFile)
-		Expect(err).NotTo(HaveOccurred())
-		defer func() {
-			_ = file.Close()
-		}()
-		Expect(os.WriteFile(file.Name(), configData, 0644)).To(Succeed())
-
-		inventory, err = loadConfig(file.Name())
+		inventory, err := loadConfig(testenv.WriteConfig(data))
 		Expect(err).NotTo(HaveOccurred())
 
-		_, _ = handler4(req, stub)
+		_, _ = inventory.handler4(req, stub)
 
 		epList := &metalv1alpha1.EndpointList{}
 		Eventually(ObjectList(epList)).Should(SatisfyAll(
@@ -436,6 +815,42 @@ var _ = Describe("Endpoint", func() {
 		DeferCleanup(k8sClient.Delete, endpoint)
 	})
 
+	It("Should only record the endpoint of a known machine during the observation period", func(ctx SpecContext) {
+		mac, _ := net.ParseMAC(machineWithIPAddressMACAddress)
+
+		req, _ := dhcpv4.NewDiscovery(mac)
+		stub, _ := dhcpv4.NewReplyFromRequest(req)
+
+		observing := *inventory
+		observing.ObserveUntil = time.Now().Add(time.Hour)
+		_, _ = observing.handler4(req, stub)
+
+		endpoint := &metalv1alpha1.Endpoint{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: machineWithIPAddressName,
+			},
+		}
+		Consistently(Get(endpoint), "100ms").Should(Satisfy(apierrors.IsNotFound))
+
+		rec := httptest.NewRecorder()
+		serveObservations(rec, httptest.NewRequest(http.MethodGet, "/metal/observed", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		var report []observation
+		Expect(json.Unmarshal(rec.Body.Bytes(), &report)).To(Succeed())
+		Expect(report).To(ContainElement(SatisfyAll(
+			HaveField("MACAddress", machineWithIPAddressMACAddress),
+			HaveField("Endpoint", machineWithIPAddressName),
+			HaveField("IP", privateIPV4Address),
+		)))
+	})
+
+	It("Should parse the end of the observation period", func() {
+		inv, err := parseConfig([]byte("filter:\n  macPrefix: [\"aa:bb\"]\nobserveUntil: 2024-11-01T00:00:00Z\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inv.ObserveUntil).To(Equal(time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)))
+		Expect(inv.observing()).To(BeFalse())
+	})
+
 	It("Should not create an endpoint for IPv4 DHCP request from a known machine without IP address",
 		func(ctx SpecContext) {
 			mac, _ := net.ParseMAC(machineWithoutIPAddressMACAddress)
@@ -443,7 +858,7 @@ var _ = Describe("Endpoint", func() {
 			req, _ := dhcpv4.NewDiscovery(mac)
 			stub, _ := dhcpv4.NewReplyFromRequest(req)
 
-			_, _ = handler4(req, stub)
+			_, _ = inventory.handler4(req, stub)
 
 			endpoint := &metalv1alpha1.Endpoint{
 				ObjectMeta: metav1.ObjectMeta{
@@ -459,7 +874,7 @@ var _ = Describe("Endpoint", func() {
 		req, _ := dhcpv4.NewDiscovery(mac)
 		stub, _ := dhcpv4.NewReplyFromRequest(req)
 
-		_, _ = handler4(req, stub)
+		_, _ = inventory.handler4(req, stub)
 
 		endpoint := &metalv1alpha1.Endpoint{
 			ObjectMeta: metav1.ObjectMeta{
@@ -469,3 +884,285 @@ var _ = Describe("Endpoint", func() {
 		Eventually(Get(endpoint)).Should(Satisfy(apierrors.IsNotFound))
 	})
 })
+
+var _ = Describe("Live config", func() {
+	var live *liveInventory
+
+	marshal := func(config api.MetalConfig) []byte {
+		configData, err := api.Marshal(config)
+		Expect(err).NotTo(HaveOccurred())
+		return configData
+	}
+
+	initialConfig := api.MetalConfig{
+		Inventories: []api.Inventory{
+			{Name: "compute-1", MacAddress: "aa:bb:cc:dd:ee:01"},
+			{Name: "compute-2", MacAddress: "aa:bb:cc:dd:ee:02"},
+		},
+	}
+	newConfig := api.MetalConfig{
+		Inventories: []api.Inventory{
+			{Name: "compute-1", MacAddress: "aa:bb:cc:dd:ee:01", Rack: "r1"},
+			{Name: "compute-2b", MacAddress: "aa:bb:cc:dd:ee:02"},
+			{Name: "compute-3", MacAddress: "aa:bb:cc:dd:ee:03"},
+		},
+		AuthoritativeIP: new(bool),
+	}
+
+	BeforeEach(func() {
+		liveMu.Lock()
+		liveRegistry = nil
+		liveMu.Unlock()
+		var err error
+		live, err = setupLive("metal/v4", testenv.WriteConfig(initialConfig))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	put := func(query string, body []byte) (*httptest.ResponseRecorder, map[string]configDiff) {
+		rec := httptest.NewRecorder()
+		serveConfig(rec, httptest.NewRequest(http.MethodPut, "/metal/config"+query, bytes.NewReader(body)))
+		diffs := map[string]configDiff{}
+		if rec.Code == http.StatusOK {
+			Expect(json.Unmarshal(rec.Body.Bytes(), &diffs)).To(Succeed())
+		}
+		return rec, diffs
+	}
+
+	It("Should compute a diff without applying it on a dry run", func() {
+		rec, diffs := put("?dryRun=true", marshal(newConfig))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(diffs).To(HaveKey(live.name))
+
+		diff := diffs[live.name]
+		Expect(diff.Added).To(Equal(map[string]string{"aa:bb:cc:dd:ee:03": "compute-3"}))
+		Expect(diff.Removed).To(BeEmpty())
+		Expect(diff.Changed).To(Equal(map[string]string{"aa:bb:cc:dd:ee:02": "compute-2 -> compute-2b"}))
+		Expect(diff.Metadata).To(ConsistOf("aa:bb:cc:dd:ee:01"))
+		Expect(diff.Settings).To(ConsistOf("authoritativeIP: true -> false"))
+
+		Expect(live.current.Load().Entries).To(HaveLen(2))
+	})
+
+	It("Should apply a new config and roll it back", func() {
+		rec, _ := put("", marshal(newConfig))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(live.current.Load().Entries).To(HaveLen(3))
+		Expect(live.current.Load().AuthoritativeIP).To(BeFalse())
+
+		rec = httptest.NewRecorder()
+		serveRollback(rec, httptest.NewRequest(http.MethodPost, "/metal/config/rollback", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(live.current.Load().Entries).To(HaveLen(2))
+		Expect(live.current.Load().AuthoritativeIP).To(BeTrue())
+
+		rec = httptest.NewRecorder()
+		serveRollback(rec, httptest.NewRequest(http.MethodPost, "/metal/config/rollback", nil))
+		Expect(rec.Code).To(Equal(http.StatusConflict))
+	})
+
+	It("Should require the instance to replace with several instances running", func() {
+		other, err := setupLive("metal/v6", testenv.WriteConfig(initialConfig))
+		Expect(err).NotTo(HaveOccurred())
+
+		rec, diffs := put("?dryRun=true", marshal(newConfig))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(diffs).To(HaveKey(live.name))
+		Expect(diffs).To(HaveKey(other.name))
+
+		rec, _ = put("", marshal(newConfig))
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		Expect(live.current.Load().Entries).To(HaveLen(2))
+		Expect(other.current.Load().Entries).To(HaveLen(2))
+
+		rec, _ = put("?instance="+other.name, marshal(newConfig))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(live.current.Load().Entries).To(HaveLen(2))
+		Expect(other.current.Load().Entries).To(HaveLen(3))
+
+		rec = httptest.NewRecorder()
+		serveRollback(rec, httptest.NewRequest(http.MethodPost, "/metal/config/rollback", nil))
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		rec = httptest.NewRecorder()
+		serveRollback(rec, httptest.NewRequest(http.MethodPost, "/metal/config/rollback?instance="+other.name, nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(other.current.Load().Entries).To(HaveLen(2))
+	})
+
+	It("Should reject an invalid config and keep the running one", func() {
+		rec, _ := put("", []byte("hosts: foo"))
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+
+		rec, _ = put("", marshal(api.MetalConfig{}))
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+
+		rec, _ = put("?instance=foo", marshal(newConfig))
+		Expect(rec.Code).To(Equal(http.StatusNotFound))
+
+		Expect(live.current.Load().Entries).To(HaveLen(2))
+	})
+})
+
+var _ = Describe("Retry queue", func() {
+	mac := net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+	unavailable := &fedhcperrors.K8sUnavailable{Err: errors.New("connection refused")}
+
+	newQueue := func(path string, results ...error) (*retryQueue, *atomic.Int32) {
+		baseDelay, maxDelay, saveDelay := retryBaseDelay, retryMaxDelay, retrySaveDelay
+		retryBaseDelay, retryMaxDelay, retrySaveDelay = time.Millisecond, 10*time.Millisecond, time.Millisecond
+		DeferCleanup(func() {
+			retryBaseDelay, retryMaxDelay, retrySaveDelay = baseDelay, maxDelay, saveDelay
+		})
+
+		calls := &atomic.Int32{}
+		queue := newRetryQueue(func(m net.HardwareAddr, duid string, family ipamv1alpha1.SubnetAddressType, labels map[string]string) error {
+			defer GinkgoRecover()
+			Expect(m).To(Equal(mac))
+			Expect(family).To(Equal(ipamv1alpha1.CIPv4SubnetType))
+			Expect(labels).To(HaveKeyWithValue("foo", "bar"))
+			call := int(calls.Add(1))
+			if call > len(results) {
+				return nil
+			}
+			return results[call-1]
+		}, log, path)
+		DeferCleanup(queue.shutDown)
+		return queue, calls
+	}
+
+	It("Should retry a transient failure until the apply succeeds", func() {
+		queue, calls := newQueue("", unavailable, unavailable)
+		queue.add(mac, "", ipamv1alpha1.CIPv4SubnetType, map[string]string{"foo": "bar"})
+
+		Eventually(calls.Load).Should(BeNumerically("==", 3))
+		Eventually(queue.len).Should(BeZero())
+		Consistently(calls.Load, "50ms").Should(BeNumerically("==", 3))
+	})
+
+	It("Should give up on a terminal failure", func() {
+		queue, calls := newQueue("", &fedhcperrors.NoSubnetMatch{IP: net.IPv4zero})
+		queue.add(mac, "", ipamv1alpha1.CIPv4SubnetType, map[string]string{"foo": "bar"})
+
+		Eventually(queue.len).Should(BeZero())
+		Consistently(calls.Load, "50ms").Should(BeNumerically("==", 1))
+	})
+
+	It("Should give up after the maximum number of attempts", func() {
+		results := make([]error, 2*retryMaxAttempts)
+		for i := range results {
+			results[i] = unavailable
+		}
+		queue, calls := newQueue("", results...)
+		queue.add(mac, "", ipamv1alpha1.CIPv4SubnetType, map[string]string{"foo": "bar"})
+
+		Eventually(queue.len).Should(BeZero())
+		Consistently(calls.Load, "50ms").Should(BeNumerically("==", retryMaxAttempts))
+	})
+
+	It("Should restore the queued applies from the retry file after a restart", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "retries.json")
+		results := make([]error, 2*retryMaxAttempts)
+		for i := range results {
+			results[i] = unavailable
+		}
+		queue, _ := newQueue(path, results...)
+		queue.add(mac, "", ipamv1alpha1.CIPv4SubnetType, map[string]string{"foo": "bar"})
+		queue.shutDown()
+		Expect(os.ReadFile(path)).To(ContainSubstring(mac.String()))
+
+		restarted, calls := newQueue(path)
+		Expect(restarted.len()).To(Equal(1))
+		Eventually(calls.Load).Should(BeNumerically("==", 1))
+		Eventually(restarted.len).Should(BeZero())
+		Eventually(func() ([]byte, error) { return os.ReadFile(path) }).Should(MatchJSON("[]"))
+	})
+
+	It("Should write the retry file in the background and on shutdown", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "retries.json")
+		results := make([]error, 100)
+		for i := range results {
+			results[i] = unavailable
+		}
+		queue, _ := newQueue(path, results...)
+		retrySaveDelay = time.Hour
+		queue.add(mac, "", ipamv1alpha1.CIPv4SubnetType, map[string]string{"foo": "bar"})
+
+		Consistently(func() bool { _, err := os.Stat(path); return os.IsNotExist(err) }, "50ms").Should(BeTrue())
+		queue.shutDown()
+		Expect(os.ReadFile(path)).To(ContainSubstring(mac.String()))
+	})
+
+	It("Should give each instance its own retry file", func() {
+		Expect(retryPath("", "metal/v4#1")).To(BeEmpty())
+		Expect(retryPath("/var/lib/fedhcp/retries.json", "metal/v4#1")).To(Equal("/var/lib/fedhcp/retries.json.metal-v4-1"))
+		Expect(retryPath("/var/lib/fedhcp/retries.json", "metal/v6#1")).To(Equal("/var/lib/fedhcp/retries.json.metal-v6-1"))
+	})
+})
+
+var _ = Describe("Inventory report", func() {
+	ns := SetupTest()
+
+	It("Should report the inconsistencies between the config, IPAM and the Endpoints", func(ctx SpecContext) {
+		const (
+			seenMAC   = "aa:00:00:00:00:01"
+			unseenMAC = "aa:00:00:00:00:02"
+			orphanMAC = "bb:00:00:00:00:01"
+		)
+		reportConfig := testenv.WriteConfig(api.MetalConfig{
+			Inventories: []api.Inventory{
+				{Name: "report-seen", MacAddress: seenMAC},
+				{Name: "report-unseen", MacAddress: unseenMAC},
+			},
+		})
+		reportInventory, err := loadConfig(reportConfig)
+		Expect(err).NotTo(HaveOccurred())
+		markSeen(seenMAC)
+		DeferCleanup(seen.Delete, seenMAC)
+
+		addr, err := ipamv1alpha1.IPAddrFromString("10.0.0.1")
+		Expect(err).NotTo(HaveOccurred())
+		ip := &ipamv1alpha1.IP{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:    ns.Name,
+				GenerateName: "test-",
+				Labels:       map[string]string{"mac": sanitizeMAC(seenMAC)},
+			},
+			Spec: ipamv1alpha1.IPSpec{
+				Subnet: corev1.LocalObjectReference{Name: "foo"},
+				IP:     addr,
+			},
+		}
+		Expect(k8sClient.Create(ctx, ip)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ip)
+		Eventually(UpdateStatus(ip, func() {
+			ip.Status.Reserved = addr
+		})).Should(Succeed())
+
+		endpoint := &metalv1alpha1.Endpoint{
+			ObjectMeta: metav1.ObjectMeta{Name: "report-orphan"},
+			Spec: metalv1alpha1.EndpointSpec{
+				MACAddress: orphanMAC,
+				IP:         metalv1alpha1.MustParseIP("10.0.0.2"),
+			},
+		}
+		Expect(k8sClient.Create(ctx, endpoint)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, endpoint)
+
+		r, err := buildReport(ctx, []*Inventory{reportInventory})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Findings).To(ContainElements(
+			Finding{Kind: findingNeverSeen, Inventory: "report-unseen", Entry: unseenMAC},
+			Finding{Kind: findingMissingIP, Inventory: "report-unseen", Entry: unseenMAC},
+			Finding{Kind: findingMissingEndpoint, Inventory: "report-seen", Entry: seenMAC, IP: "10.0.0.1"},
+			Finding{Kind: findingOrphanedEndpoint, Entry: orphanMAC, Endpoint: "report-orphan"},
+			Finding{Kind: findingIPNotInIPAM, Entry: orphanMAC, Endpoint: "report-orphan", IP: "10.0.0.2"},
+		))
+		Expect(r.Findings).NotTo(ContainElement(Finding{Kind: findingNeverSeen, Inventory: "report-seen", Entry: seenMAC}))
+		Expect(reportState()).To(HaveKeyWithValue("counts", r.Counts))
+
+		By("building the report offline from the config file")
+		offline, err := BuildReport(ctx, k8sClient, reportConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(offline.Findings).To(ContainElement(Finding{Kind: findingMissingIP, Inventory: "report-unseen", Entry: unseenMAC}))
+		Expect(offline.Counts).NotTo(HaveKey(findingNeverSeen))
+	})
+})
@@ -0,0 +1,351 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package metal
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ironcore-dev/fedhcp/internal/cache"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/ironcore-dev/fedhcp/internal/metrics"
+	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
+	metalv1alpha1 "github.com/ironcore-dev/metal-operator/api/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// FindingKind tells which inconsistency between the config, IPAM and the
+// Endpoints a report has found.
+type FindingKind string
+
+const (
+	// findingNeverSeen is a host or prefix no request has matched since the start
+	findingNeverSeen FindingKind = "NeverSeen"
+	// findingMissingIP is a host without an IPAM IP labeled with its MAC address
+	findingMissingIP FindingKind = "MissingIP"
+	// findingMissingEndpoint is a host with an IPAM IP but without an Endpoint
+	findingMissingEndpoint FindingKind = "MissingEndpoint"
+	// findingMACMismatch is the Endpoint of a host carrying another MAC address
+	findingMACMismatch FindingKind = "MACMismatch"
+	// findingOrphanedEndpoint is an Endpoint matching no host or prefix
+	findingOrphanedEndpoint FindingKind = "OrphanedEndpoint"
+	// findingIPNotInIPAM is an Endpoint whose IP is no IPAM IP of its MAC address
+	findingIPNotInIPAM FindingKind = "IPNotInIPAM"
+)
+
+// Finding is a single inconsistency of a report.
+type Finding struct {
+	Kind      FindingKind `json:"kind"`
+	Inventory string      `json:"inventory,omitempty"`
+	// Entry is the MAC address, DUID or MAC prefix of the config
+	Entry    string `json:"entry,omitempty"`
+	Endpoint string `json:"endpoint,omitempty"`
+	IP       string `json:"ip,omitempty"`
+}
+
+// InventoryReport cross-checks the inventories of all instances against the
+// IPAM IPs and the Endpoints.
+type InventoryReport struct {
+	Generated time.Time           `json:"generated"`
+	Counts    map[FindingKind]int `json:"counts"`
+	Findings  []Finding           `json:"findings"`
+}
+
+// reportTick is the interval at which the periodic report checks whether it
+// is due, so that a changed reportInterval applies without a restart.
+const reportTick = time.Minute
+
+var (
+	// seen holds the time an entry was last matched by a request, keyed by
+	// the entry of the inventory
+	seen = cache.New[string, time.Time]("metal/seen", maxObservations, 0)
+
+	// reportMu guards the last report
+	reportMu   sync.Mutex
+	lastReport *InventoryReport
+
+	// reportFindings counts the findings of the report of all instances
+	reportFindings = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "metal",
+		Name:      "report_findings",
+		Help:      "Number of inconsistencies between the configs of all instances, IPAM and the Endpoints found by the last inventory report.",
+	}, []string{"kind"})
+)
+
+// markSeen notes that a request matched the entry.
+func markSeen(entry string) {
+	seen.Put(entry, time.Now())
+}
+
+// sanitizeMAC returns the MAC address as used by the mac label of IPAM IPs.
+func sanitizeMAC(mac string) string {
+	return strings.ReplaceAll(strings.ToLower(mac), ":", "")
+}
+
+// covers reports whether the endpoint belongs to an entry of the inventory,
+// by its MAC address or, for hosts given by DUID, by its name.
+func (inventory *Inventory) covers(endpoint *metalv1alpha1.Endpoint) bool {
+	mac := strings.ToLower(endpoint.Spec.MACAddress)
+	switch inventory.Strategy {
+	case OnBoardingStrategyStatic:
+		if _, ok := inventory.Entries[mac]; ok {
+			return true
+		}
+		for _, name := range inventory.Entries {
+			if name == endpoint.Name {
+				return true
+			}
+		}
+	case OnboardingStrategyDynamic:
+		for prefix := range inventory.Entries {
+			if strings.HasPrefix(mac, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// liveInventories returns the current inventories of all instances.
+func liveInventories() []*Inventory {
+	liveMu.Lock()
+	defer liveMu.Unlock()
+
+	inventories := make([]*Inventory, 0, len(liveRegistry))
+	for _, live := range liveRegistry {
+		inventories = append(inventories, live.current.Load())
+	}
+	return inventories
+}
+
+// buildReport cross-checks the inventories against the IPAM IPs and the
+// Endpoints, and keeps the report as the last one.
+func buildReport(ctx context.Context, inventories []*Inventory) (*InventoryReport, error) {
+	cl := kubernetes.GetClient()
+	if cl == nil {
+		return nil, &fedhcperrors.K8sUnavailable{Err: fmt.Errorf("kubernetes client not initialized")}
+	}
+	r, err := crossCheck(ctx, cl, inventories, true)
+	if err != nil {
+		return nil, err
+	}
+
+	reportFindings.Reset()
+	for kind, count := range r.Counts {
+		reportFindings.WithLabelValues(string(kind)).Set(float64(count))
+	}
+	reportMu.Lock()
+	lastReport = r
+	reportMu.Unlock()
+	return r, nil
+}
+
+// BuildReport cross-checks the metal configs at the paths against the IPAM
+// IPs and the Endpoints of the cluster of the client, outside of a running
+// instance, e.g. by fedhcpctl. Hosts never seen are not reported, as no
+// requests are served.
+func BuildReport(ctx context.Context, cl client.Client, paths ...string) (*InventoryReport, error) {
+	inventories := make([]*Inventory, 0, len(paths))
+	for _, path := range paths {
+		inventory, _, err := readConfig(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if inventory != nil {
+			inventories = append(inventories, inventory)
+		}
+	}
+	return crossCheck(ctx, cl, inventories, false)
+}
+
+// crossCheck cross-checks the inventories against the IPAM IPs and the
+// Endpoints, reporting the entries never matched by a request if withSeen is
+// set.
+func crossCheck(ctx context.Context, cl client.Client, inventories []*Inventory, withSeen bool) (*InventoryReport, error) {
+	ips := &ipamv1alpha1.IPList{}
+	if err := cl.List(ctx, ips); err != nil {
+		return nil, fmt.Errorf("failed to list IPs: %w", fedhcperrors.FromK8s(err))
+	}
+	endpoints := &metalv1alpha1.EndpointList{}
+	if err := cl.List(ctx, endpoints); err != nil {
+		return nil, fmt.Errorf("failed to list Endpoints: %w", fedhcperrors.FromK8s(err))
+	}
+
+	// IPAM IPs by the mac label, and Endpoints by name
+	ipsByMAC := make(map[string][]string)
+	for _, ip := range ips.Items {
+		if mac := ip.Labels["mac"]; mac != "" && ip.Status.Reserved != nil {
+			ipsByMAC[mac] = append(ipsByMAC[mac], ip.Status.Reserved.String())
+		}
+	}
+	endpointsByName := make(map[string]*metalv1alpha1.Endpoint, len(endpoints.Items))
+	for i := range endpoints.Items {
+		endpointsByName[endpoints.Items[i].Name] = &endpoints.Items[i]
+	}
+
+	r := &InventoryReport{Generated: time.Now(), Counts: make(map[FindingKind]int)}
+	add := func(f Finding) {
+		r.Findings = append(r.Findings, f)
+		r.Counts[f.Kind]++
+	}
+
+	for _, inventory := range inventories {
+		// the MAC address of a host given by DUID follows the client, see duid.go
+		withDUID := make(map[string]bool)
+		for entry, name := range inventory.Entries {
+			if strings.HasPrefix(entry, duidPrefix) {
+				withDUID[name] = true
+			}
+		}
+
+		for entry, name := range inventory.Entries {
+			if _, ok := seen.Get(entry); withSeen && !ok {
+				add(Finding{Kind: findingNeverSeen, Inventory: name, Entry: entry})
+			}
+			if inventory.Strategy != OnBoardingStrategyStatic {
+				continue
+			}
+
+			endpoint := endpointsByName[name]
+			if strings.HasPrefix(entry, duidPrefix) {
+				if endpoint == nil && !withMACEntry(inventory, name) {
+					add(Finding{Kind: findingMissingEndpoint, Inventory: name, Entry: entry})
+				}
+				continue
+			}
+			addrs := ipsByMAC[sanitizeMAC(entry)]
+			switch {
+			case len(addrs) == 0:
+				add(Finding{Kind: findingMissingIP, Inventory: name, Entry: entry})
+			case endpoint == nil:
+				add(Finding{Kind: findingMissingEndpoint, Inventory: name, Entry: entry, IP: strings.Join(addrs, ",")})
+			case !withDUID[name] && !strings.EqualFold(endpoint.Spec.MACAddress, entry):
+				add(Finding{Kind: findingMACMismatch, Inventory: name, Entry: entry, Endpoint: endpoint.Name})
+			}
+		}
+	}
+
+	for i := range endpoints.Items {
+		endpoint := &endpoints.Items[i]
+		covered := false
+		for _, inventory := range inventories {
+			if inventory.covers(endpoint) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			add(Finding{Kind: findingOrphanedEndpoint, Entry: endpoint.Spec.MACAddress, Endpoint: endpoint.Name})
+		}
+
+		if !endpoint.Spec.IP.IsValid() {
+			continue
+		}
+		if _, err := net.ParseMAC(endpoint.Spec.MACAddress); err != nil {
+			continue
+		}
+		ip := endpoint.Spec.IP.String()
+		if !slices.Contains(ipsByMAC[sanitizeMAC(endpoint.Spec.MACAddress)], ip) {
+			add(Finding{Kind: findingIPNotInIPAM, Entry: endpoint.Spec.MACAddress, Endpoint: endpoint.Name, IP: ip})
+		}
+	}
+
+	slices.SortFunc(r.Findings, func(a, b Finding) int {
+		return cmp.Or(cmp.Compare(a.Kind, b.Kind), cmp.Compare(a.Entry, b.Entry), cmp.Compare(a.Endpoint, b.Endpoint))
+	})
+	return r, nil
+}
+
+// withMACEntry reports whether the host is given by MAC address too, whose
+// checks then cover its Endpoint.
+func withMACEntry(inventory *Inventory, name string) bool {
+	for entry, n := range inventory.Entries {
+		if n == name && !strings.HasPrefix(entry, duidPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// reportInterval returns the shortest reportInterval of all instances, or 0 if
+// none configures one.
+func reportInterval(inventories []*Inventory) time.Duration {
+	var interval time.Duration
+	for _, inventory := range inventories {
+		if inventory.ReportInterval > 0 && (interval == 0 || inventory.ReportInterval < interval) {
+			interval = inventory.ReportInterval
+		}
+	}
+	return interval
+}
+
+// runReports builds a report whenever the reportInterval has passed and logs
+// its findings.
+func runReports() {
+	var last time.Time
+	for range time.Tick(reportTick) {
+		inventories := liveInventories()
+		interval := reportInterval(inventories)
+		if interval == 0 || time.Since(last) < interval {
+			continue
+		}
+		last = time.Now()
+
+		ctx, cancel := context.WithTimeout(context.Background(), reportTick)
+		r, err := buildReport(ctx, inventories)
+		cancel()
+		if err != nil {
+			log.WithFields(fedhcperrors.Fields(err)).Errorf("Could not build inventory report: %v", err)
+			continue
+		}
+		if len(r.Findings) == 0 {
+			log.Infof("Inventory report found no inconsistencies")
+			continue
+		}
+		log.Warnf("Inventory report found %d inconsistencies: %v", len(r.Findings), r.Counts)
+		for _, f := range r.Findings {
+			log.Debugf("Inventory report: %+v", f)
+		}
+	}
+}
+
+// serveReport builds and returns a report.
+func serveReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	report, err := buildReport(r.Context(), liveInventories())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, report)
+}
+
+// reportState returns the counts of the last report, see admin.State.
+func reportState() any {
+	reportMu.Lock()
+	defer reportMu.Unlock()
+
+	if lastReport == nil {
+		return nil
+	}
+	return map[string]any{
+		"generated": lastReport.Generated,
+		"counts":    lastReport.Counts,
+	}
+}
@@ -0,0 +1,282 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package metal
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// backoff of the retries per MAC address, replaced in tests
+var (
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 5 * time.Minute
+	// retrySaveDelay collects the changes of the queue into a single write of
+	// the retry file, replaced in tests
+	retrySaveDelay = time.Second
+)
+
+const (
+	retryMaxAttempts = 10
+	// retries of all MAC addresses are limited, so a recovering API server is not flooded
+	retryQPS   = 10
+	retryBurst = 100
+)
+
+type retryKey struct {
+	mac    string
+	duid   string
+	family ipamv1alpha1.SubnetAddressType
+}
+
+// retryEntry is a queued endpoint apply as persisted in the retry file.
+type retryEntry struct {
+	MAC    string                         `json:"mac"`
+	DUID   string                         `json:"duid,omitempty"`
+	Family ipamv1alpha1.SubnetAddressType `json:"family,omitempty"`
+	Labels map[string]string              `json:"labels,omitempty"`
+}
+
+// applyFunc applies the endpoint of a MAC address and DUID, see Inventory.applyEndpoint.
+type applyFunc func(mac net.HardwareAddr, duid string, family ipamv1alpha1.SubnetAddressType, labels map[string]string) error
+
+// retryQueue re-applies endpoints whose apply failed with a retryable error,
+// with an exponential backoff per MAC address, so onboarding doesn't depend
+// on the client retransmitting its request.
+type retryQueue struct {
+	queue workqueue.TypedRateLimitingInterface[retryKey]
+	apply applyFunc
+	log   *logrus.Entry
+	// path is the file the queued MAC addresses are persisted in, if set
+	path string
+	// changed is signalled when the retry file is to be written, see persist
+	changed chan struct{}
+	// done is closed on shutdown, persisted once the last write is done
+	done      chan struct{}
+	persisted chan struct{}
+	stop      sync.Once
+
+	mu sync.Mutex
+	// labels holds the latest labels per queued MAC address
+	labels map[retryKey]map[string]string
+}
+
+// retryPath returns the retry file of an instance, the configured file
+// suffixed with the instance, as the instances of both address families
+// share the config.
+func retryPath(file, instance string) string {
+	if file == "" {
+		return ""
+	}
+	return file + "." + strings.NewReplacer("/", "-", "#", "-").Replace(instance)
+}
+
+// newRetryQueue returns a queue retrying the applies with apply. With a path,
+// the queued applies are written to the file in the background once the
+// queue changed, and the ones written before a restart are queued again,
+// with a fresh backoff.
+func newRetryQueue(apply applyFunc, log *logrus.Entry, path string) *retryQueue {
+	limiter := workqueue.NewTypedMaxOfRateLimiter(
+		workqueue.NewTypedItemExponentialFailureRateLimiter[retryKey](retryBaseDelay, retryMaxDelay),
+		&workqueue.TypedBucketRateLimiter[retryKey]{Limiter: rate.NewLimiter(retryQPS, retryBurst)},
+	)
+	r := &retryQueue{
+		queue:     workqueue.NewTypedRateLimitingQueue(limiter),
+		apply:     apply,
+		log:       log,
+		path:      path,
+		changed:   make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		persisted: make(chan struct{}),
+		labels:    make(map[retryKey]map[string]string),
+	}
+	r.restore()
+	go r.run()
+	go r.persist()
+	return r
+}
+
+// restore queues the applies of the retry file.
+func (r *retryQueue) restore() {
+	if r.path == "" {
+		return
+	}
+	data, err := os.ReadFile(r.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	var entries []retryEntry
+	if err == nil {
+		err = json.Unmarshal(data, &entries)
+	}
+	if err != nil {
+		r.log.Errorf("Could not restore endpoint retries from %s, dropping them: %v", r.path, err)
+		return
+	}
+
+	for _, e := range entries {
+		key := retryKey{mac: e.MAC, duid: e.DUID, family: e.Family}
+		r.mu.Lock()
+		r.labels[key] = e.Labels
+		r.mu.Unlock()
+		r.queue.AddRateLimited(key)
+	}
+	if len(entries) > 0 {
+		r.log.Infof("Restored %d endpoint retries from %s", len(entries), r.path)
+	}
+}
+
+// save schedules a write of the retry file, so that requests do not wait for
+// the disk.
+func (r *retryQueue) save() {
+	if r.path == "" {
+		return
+	}
+	select {
+	case r.changed <- struct{}{}:
+	default:
+		// a write is pending already
+	}
+}
+
+// persist writes the retry file once retrySaveDelay after a change, and once
+// more on shutdown if a change is pending.
+func (r *retryQueue) persist() {
+	defer close(r.persisted)
+	if r.path == "" {
+		return
+	}
+	for {
+		select {
+		case <-r.changed:
+			select {
+			case <-time.After(retrySaveDelay):
+			case <-r.done:
+			case <-kubernetes.Context().Done():
+			}
+			r.write()
+		case <-r.done:
+			r.flush()
+			return
+		case <-kubernetes.Context().Done():
+			r.flush()
+			return
+		}
+	}
+}
+
+// flush writes the retry file if a change is pending.
+func (r *retryQueue) flush() {
+	select {
+	case <-r.changed:
+		r.write()
+	default:
+	}
+}
+
+// write replaces the retry file with the queued applies atomically.
+func (r *retryQueue) write() {
+	r.mu.Lock()
+	entries := make([]retryEntry, 0, len(r.labels))
+	for key, labels := range r.labels {
+		entries = append(entries, retryEntry{MAC: key.mac, DUID: key.duid, Family: key.family, Labels: labels})
+	}
+	r.mu.Unlock()
+	slices.SortFunc(entries, func(a, b retryEntry) int {
+		return strings.Compare(a.MAC+a.DUID+string(a.Family), b.MAC+b.DUID+string(b.Family))
+	})
+	data, err := json.Marshal(entries)
+	if err == nil {
+		tmp := r.path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o644); err == nil {
+			err = os.Rename(tmp, r.path)
+		}
+	}
+	if err != nil {
+		r.log.Errorf("Could not persist endpoint retries to %s: %v", r.path, err)
+	}
+}
+
+// add queues the MAC address for a retry after its backoff.
+func (r *retryQueue) add(mac net.HardwareAddr, duid string, family ipamv1alpha1.SubnetAddressType, labels map[string]string) {
+	key := retryKey{mac: mac.String(), duid: duid, family: family}
+	r.mu.Lock()
+	r.labels[key] = labels
+	r.save()
+	r.mu.Unlock()
+	r.queue.AddRateLimited(key)
+}
+
+func (r *retryQueue) run() {
+	for {
+		key, shutdown := r.queue.Get()
+		if shutdown {
+			return
+		}
+		r.process(key)
+		r.queue.Done(key)
+	}
+}
+
+func (r *retryQueue) process(key retryKey) {
+	mac, err := net.ParseMAC(key.mac)
+	if err != nil {
+		r.queue.Forget(key)
+		return
+	}
+	r.mu.Lock()
+	labels := r.labels[key]
+	r.mu.Unlock()
+
+	// the first retry has already been counted when the MAC address was added
+	attempt := r.queue.NumRequeues(key)
+	err = r.apply(mac, key.duid, key.family, labels)
+	switch {
+	case err == nil:
+		r.log.Infof("Applied endpoint for mac %s after %d retries", key.mac, attempt)
+	case !fedhcperrors.IsRetryable(err):
+		r.log.WithFields(fedhcperrors.Fields(err)).Errorf("Could not apply endpoint for mac %s, giving up: %s", key.mac, err)
+	case attempt >= retryMaxAttempts:
+		r.log.WithFields(fedhcperrors.Fields(err)).Errorf("Could not apply endpoint for mac %s after %d retries, giving up: %s",
+			key.mac, attempt, err)
+	default:
+		r.log.WithFields(fedhcperrors.Fields(err)).Warnf("Could not apply endpoint for mac %s, retrying: %s", key.mac, err)
+		r.queue.AddRateLimited(key)
+		return
+	}
+
+	r.queue.Forget(key)
+	r.mu.Lock()
+	delete(r.labels, key)
+	r.save()
+	r.mu.Unlock()
+}
+
+// len returns the number of MAC addresses waiting for a retry.
+func (r *retryQueue) len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.labels)
+}
+
+func (r *retryQueue) shutDown() {
+	r.stop.Do(func() {
+		r.queue.ShutDown()
+		close(r.done)
+	})
+	<-r.persisted
+}
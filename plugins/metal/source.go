@@ -0,0 +1,381 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package metal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/ironcore-dev/fedhcp/internal/metrics"
+	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// defaultSourceInterval is the interval the hosts of a file or URL are reloaded at
+	defaultSourceInterval = time.Minute
+	// defaultSourceTimeout bounds a reload or lookup of a source
+	defaultSourceTimeout = 10 * time.Second
+)
+
+var (
+	sourceHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "metal",
+		Name:      "inventory_source_healthy",
+		Help:      "Whether the last reload or lookup of an inventory source succeeded, per source.",
+	}, []string{"instance", "source"})
+	sourceHosts = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "metal",
+		Name:      "inventory_source_hosts",
+		Help:      "Number of MAC addresses and DUIDs of the hosts loaded from an inventory source, per file or URL source.",
+	}, []string{"instance", "source"})
+)
+
+// sourceHost is a host of an inventory source.
+type sourceHost struct {
+	name     string
+	metadata EndpointMetadata
+	// family restricts onboarding to the requests of one address family, both if empty
+	family ipamv1alpha1.SubnetAddressType
+}
+
+// inventorySource is an inventory besides the hosts and filter of the config.
+// The hosts of a source are onboarded like those of a static inventory list.
+type inventorySource interface {
+	// lookup returns the host of the DUID or else the MAC address, nil if the
+	// source knows neither
+	lookup(mac net.HardwareAddr, duid string) (*sourceHost, error)
+	state() sourceState
+	// setInstance sets the instance labeling the metrics of the source, it
+	// shall be called before the first lookup
+	setInstance(name string)
+}
+
+// sourceState is the health of an inventory source, see admin.State.
+type sourceState struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	// Error is the error of the last reload or lookup, if it failed
+	Error string `json:"error,omitempty"`
+	// LastSuccess is the time of the last successful reload or lookup
+	LastSuccess time.Time `json:"lastSuccess"`
+	// Hosts is the number of MAC addresses and DUIDs loaded, for file and URL sources
+	Hosts int `json:"hosts,omitempty"`
+}
+
+// health tracks the outcome of the reloads or lookups of a source.
+type health struct {
+	mu    sync.Mutex
+	state sourceState
+	// instance labels the metrics
+	instance string
+}
+
+func (h *health) report(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.state.Healthy = err == nil
+	h.state.Error = ""
+	if err != nil {
+		h.state.Error = err.Error()
+	} else {
+		h.state.LastSuccess = time.Now()
+	}
+	healthy := 0.0
+	if h.state.Healthy {
+		healthy = 1
+	}
+	sourceHealthy.WithLabelValues(h.instance, h.state.Name).Set(healthy)
+}
+
+func (h *health) get() sourceState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.state
+}
+
+// parseSources builds the inventory sources of the config.
+func parseSources(configs []api.InventorySource) ([]inventorySource, error) {
+	sources := make([]inventorySource, 0, len(configs))
+	names := make(map[string]bool, len(configs))
+	for _, c := range configs {
+		if c.Name == "" {
+			return nil, fmt.Errorf("source without name")
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("duplicate source %s", c.Name)
+		}
+		names[c.Name] = true
+		if c.Interval < 0 || c.Timeout < 0 {
+			return nil, fmt.Errorf("source %s: interval and timeout must not be negative", c.Name)
+		}
+		interval, timeout := c.Interval, c.Timeout
+		if interval == 0 {
+			interval = defaultSourceInterval
+		}
+		if timeout == 0 {
+			timeout = defaultSourceTimeout
+		}
+
+		var kinds int
+		var source inventorySource
+		if c.File != "" {
+			kinds++
+			path := c.File
+			source = newListSource(c.Name, interval, func(context.Context) ([]byte, error) {
+				return os.ReadFile(path)
+			}, timeout)
+		}
+		if c.URL != "" {
+			kinds++
+			source = newListSource(c.Name, interval, httpFetcher(c.URL), timeout)
+		}
+		if c.Servers != nil {
+			kinds++
+			selector, err := labels.Parse(c.Servers.LabelSelector)
+			if err != nil {
+				return nil, fmt.Errorf("source %s: invalid label selector: %w", c.Name, err)
+			}
+			source = &serverSource{selector: selector, timeout: timeout, health: &health{state: sourceState{Name: c.Name}}}
+		}
+		if kinds != 1 {
+			return nil, fmt.Errorf("source %s: exactly one of file, url and servers must be set", c.Name)
+		}
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+// hostKeys returns the keys an inventory is matched by: its MAC address and,
+// for clients randomizing their MAC address, its DUID.
+func hostKeys(i api.Inventory) ([]string, error) {
+	var keys []string
+	if i.MacAddress != "" {
+		keys = append(keys, strings.ToLower(i.MacAddress))
+	}
+	if i.DUID != "" {
+		duid, err := parseDUID(i.DUID)
+		if err != nil {
+			return nil, fmt.Errorf("inventory %s: %w", i.Name, err)
+		}
+		keys = append(keys, duid)
+	}
+	return keys, nil
+}
+
+// listSource is a source holding a list of hosts, like the config, which is
+// reloaded once it is older than the interval. Lookups use the hosts loaded
+// last while a reload runs, and keep them if a reload fails. Until a reload
+// succeeded, lookups fail with its error.
+type listSource struct {
+	fetch    func(ctx context.Context) ([]byte, error)
+	interval time.Duration
+	timeout  time.Duration
+	health   *health
+
+	mu        sync.Mutex
+	hosts     map[string]sourceHost
+	loaded    time.Time
+	reloading bool
+	// err is the error of the last reload, returned by lookups until a
+	// reload succeeded once
+	err error
+}
+
+func newListSource(name string, interval time.Duration, fetch func(ctx context.Context) ([]byte, error), timeout time.Duration) *listSource {
+	return &listSource{fetch: fetch, interval: interval, timeout: timeout, health: &health{state: sourceState{Name: name}}}
+}
+
+// httpFetcher returns a fetch of the body of the URL.
+func httpFetcher(url string) func(ctx context.Context) ([]byte, error) {
+	return func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = resp.Body.Close() }()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		return io.ReadAll(resp.Body)
+	}
+}
+
+// parseHosts parses a list of hosts, in YAML or JSON.
+func parseHosts(data []byte) (map[string]sourceHost, error) {
+	var list struct {
+		Hosts []api.Inventory `yaml:"hosts"`
+	}
+	if err := yaml.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse hosts: %w", err)
+	}
+	hosts := make(map[string]sourceHost)
+	for _, i := range list.Hosts {
+		if i.Name == "" {
+			continue
+		}
+		keys, err := hostKeys(i)
+		if err != nil {
+			return nil, err
+		}
+		metadata, err := endpointMetadata(i)
+		if err != nil {
+			return nil, err
+		}
+		family, err := parseFamily(i.Family)
+		if err != nil {
+			return nil, fmt.Errorf("inventory %s: %w", i.Name, err)
+		}
+		for _, key := range keys {
+			hosts[key] = sourceHost{name: i.Name, metadata: metadata, family: family}
+		}
+	}
+	return hosts, nil
+}
+
+// reload loads the hosts, keeping the ones loaded before if it fails.
+func (s *listSource) reload() {
+	ctx, cancel := context.WithTimeout(kubernetes.Context(), s.timeout)
+	defer cancel()
+	data, err := s.fetch(ctx)
+	var hosts map[string]sourceHost
+	if err == nil {
+		hosts, err = parseHosts(data)
+	}
+
+	s.mu.Lock()
+	s.reloading = false
+	s.loaded = time.Now()
+	if err == nil {
+		s.hosts = hosts
+	}
+	if s.hosts == nil {
+		s.err = err
+	}
+	n := len(s.hosts)
+	s.mu.Unlock()
+
+	s.health.mu.Lock()
+	s.health.state.Hosts = n
+	s.health.mu.Unlock()
+	sourceHosts.WithLabelValues(s.health.instance, s.health.state.Name).Set(float64(n))
+	if err != nil {
+		log.Errorf("Could not reload inventory source %s, keeping %d hosts: %v", s.health.state.Name, n, err)
+	}
+	s.health.report(err)
+}
+
+func (s *listSource) lookup(mac net.HardwareAddr, duid string) (*sourceHost, error) {
+	s.mu.Lock()
+	switch {
+	case s.loaded.IsZero():
+		// the first lookup waits for the hosts
+		s.mu.Unlock()
+		s.reload()
+		s.mu.Lock()
+	case !s.reloading && time.Since(s.loaded) >= s.interval:
+		s.reloading = true
+		go s.reload()
+	}
+	hosts, err := s.hosts, s.err
+	s.mu.Unlock()
+
+	if hosts == nil {
+		return nil, err
+	}
+	if host, ok := hosts[duid]; duid != "" && ok {
+		return &host, nil
+	}
+	if host, ok := hosts[strings.ToLower(mac.String())]; ok {
+		return &host, nil
+	}
+	return nil, nil
+}
+
+func (s *listSource) state() sourceState {
+	return s.health.get()
+}
+
+func (s *listSource) setInstance(name string) {
+	s.health.instance = name
+}
+
+// serverSource looks the clients up in the metal-operator Servers, which are
+// served from the informer cache. A host is named after its Server.
+type serverSource struct {
+	selector labels.Selector
+	timeout  time.Duration
+	health   *health
+}
+
+func (s *serverSource) lookup(mac net.HardwareAddr, _ string) (*sourceHost, error) {
+	ctx, cancel := context.WithTimeout(kubernetes.Context(), s.timeout)
+	defer cancel()
+	servers, err := kubernetes.ServersForMAC(ctx, mac)
+	s.health.report(err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up Servers: %w", fedhcperrors.FromK8s(err))
+	}
+	for _, server := range servers {
+		if s.selector.Matches(labels.Set(server.Labels)) {
+			return &sourceHost{name: server.Name}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *serverSource) state() sourceState {
+	return s.health.get()
+}
+
+func (s *serverSource) setInstance(name string) {
+	s.health.instance = name
+}
+
+// lookupSources returns the host of the first source knowing the client.
+// A failing source is skipped, so the ones behind it still onboard their
+// hosts, the error is returned if no source knows the client.
+func (inventory *Inventory) lookupSources(mac net.HardwareAddr, duid string) (*sourceHost, error) {
+	var errs []error
+	for _, source := range inventory.Sources {
+		host, err := source.lookup(mac, duid)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("source %s: %w", source.state().Name, err))
+			continue
+		}
+		if host != nil {
+			inventory.log.Debugf("Found inventory %s (%s) in source %s", host.name, mac, source.state().Name)
+			return host, nil
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// sourceStates returns the health of the sources of the inventory.
+func (inventory *Inventory) sourceStates() []sourceState {
+	states := make([]sourceState, 0, len(inventory.Sources))
+	for _, source := range inventory.Sources {
+		states = append(states, source.state())
+	}
+	return states
+}
@@ -4,40 +4,18 @@
 package metal
 
 import (
-	"fmt"
-	"os"
-	"path/filepath"
-	"runtime"
 	"testing"
-	"time"
 
-	"gopkg.in/yaml.v2"
-
-	"github.com/ironcore-dev/controller-utils/modutils"
 	"github.com/ironcore-dev/fedhcp/internal/api"
-	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
-	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
+	"github.com/ironcore-dev/fedhcp/internal/testenv"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes/scheme"
-	"k8s.io/client-go/rest"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/envtest"
-	. "sigs.k8s.io/controller-runtime/pkg/envtest/komega"
-	logf "sigs.k8s.io/controller-runtime/pkg/log"
-	"sigs.k8s.io/controller-runtime/pkg/log/zap"
-
-	metalv1alpha1 "github.com/ironcore-dev/metal-operator/api/v1alpha1"
-	//+kubebuilder:scaffold:imports
 )
 
 const (
-	pollingInterval                          = 50 * time.Millisecond
-	eventuallyTimeout                        = 3 * time.Second
-	consistentlyDuration                     = 1 * time.Second
 	machineWithIPAddressName                 = "machine-with-ip-address"
 	machineWithoutIPAddressName              = "machine-without-ip-address"
 	machineWithIPAddressMACAddress           = "11:22:33:44:55:66"
@@ -46,82 +24,27 @@ const (
 	machineWithIPAddressMACAddressPrefFilter = "11:22:33"
 	linkLocalIPV6Prefix                      = "fe80::"
 	privateIPV4Address                       = "192.168.47.11"
-	inventoryConfigFile                      = "config.yaml"
 )
 
 var (
-	cfg       *rest.Config
 	k8sClient client.Client
-	testEnv   *envtest.Environment
+	inventory *Inventory
 )
 
 func TestControllers(t *testing.T) {
-	SetDefaultConsistentlyPollingInterval(pollingInterval)
-	SetDefaultEventuallyPollingInterval(pollingInterval)
-	SetDefaultEventuallyTimeout(eventuallyTimeout)
-	SetDefaultConsistentlyDuration(consistentlyDuration)
-	RegisterFailHandler(Fail)
-
-	RunSpecs(t, "Controller Suite")
+	testenv.Run(t, "Controller Suite")
 }
 
 var _ = BeforeSuite(func() {
-	logf.SetLogger(zap.New(zap.WriteTo(GinkgoWriter), zap.UseDevMode(true)))
-
-	By("bootstrapping test environment")
-	testEnv = &envtest.Environment{
-		CRDDirectoryPaths: []string{
-			modutils.Dir("github.com/ironcore-dev/metal-operator", "config", "crd", "bases"),
-			modutils.Dir("github.com/ironcore-dev/ipam", "config", "crd", "bases"),
-		},
-		ErrorIfCRDPathMissing: true,
-
-		// The BinaryAssetsDirectory is only required if you want to run the tests directly
-		// without call the makefile target test. If not informed it will look for the
-		// default path defined in controller-runtime which is /usr/local/kubebuilder/.
-		// Note that you must have the required binaries setup under the bin directory to perform
-		// the tests directly. When we run make test it will be setup and used automatically.
-		BinaryAssetsDirectory: filepath.Join("..", "..", "bin", "k8s",
-			fmt.Sprintf("1.30.0-%s-%s", runtime.GOOS, runtime.GOARCH)),
-	}
-
-	var err error
-	// cfg is defined in this file globally.
-	cfg, err = testEnv.Start()
-	Expect(err).NotTo(HaveOccurred())
-	Expect(cfg).NotTo(BeNil())
-
-	DeferCleanup(testEnv.Stop)
-
-	Expect(ipamv1alpha1.AddToScheme(scheme.Scheme)).NotTo(HaveOccurred())
-	Expect(metalv1alpha1.AddToScheme(scheme.Scheme)).NotTo(HaveOccurred())
-
-	//+kubebuilder:scaffold:scheme
-
-	k8sClient, err = client.New(cfg, client.Options{Scheme: scheme.Scheme})
-	Expect(err).NotTo(HaveOccurred())
-	Expect(k8sClient).NotTo(BeNil())
-
-	// set komega client
-	SetClient(k8sClient)
-
-	// assign global k8s client in plugin
-	kubernetes.SetClient(&k8sClient)
+	k8sClient = testenv.Start(testenv.Options{
+		CRDModules: []string{testenv.MetalOperator, testenv.IPAM},
+	})
 })
 
 func SetupTest() *corev1.Namespace {
-	ns := &corev1.Namespace{}
+	ns := testenv.SetupNamespace()
 
-	BeforeEach(func(ctx SpecContext) {
-		*ns = corev1.Namespace{
-			ObjectMeta: metav1.ObjectMeta{
-				GenerateName: "test-",
-			},
-		}
-		Expect(k8sClient.Create(ctx, ns)).To(Succeed(), "failed to create test namespace")
-		DeferCleanup(k8sClient.Delete, ns)
-
-		configFile := inventoryConfigFile
+	BeforeEach(func() {
 		data := api.MetalConfig{
 			NamePrefix: "server-",
 			Inventories: []api.Inventory{
@@ -138,21 +61,14 @@ func SetupTest() *corev1.Namespace {
 				MacPrefix: []string{machineWithIPAddressMACAddressPrefFilter},
 			},
 		}
-		configData, err := yaml.Marshal(data)
-		Expect(err).NotTo(HaveOccurred())
-
-		file, err := os.CreateTemp(GinkgoT().TempDir(), configFile)
-		Expect(err).NotTo(HaveOccurred())
-		defer func() {
-			_ = file.Close()
-		}()
-		Expect(os.WriteFile(file.Name(), configData, 0644)).To(Succeed())
 
-		inventory, err = loadConfig(file.Name())
+		var err error
+		inventory, err = loadConfig(testenv.WriteConfig(data))
 		Expect(err).NotTo(HaveOccurred())
 		Expect(inventory.Entries).To(HaveKeyWithValue(machineWithIPAddressMACAddress, machineWithIPAddressName))
 		Expect(inventory.Entries).To(HaveKeyWithValue(machineWithoutIPAddressMACAddress, machineWithoutIPAddressName))
 		Expect(inventory.Strategy).To(Equal(OnBoardingStrategyStatic))
+		Expect(inventory.AuthoritativeIP).To(BeTrue())
 	})
 
 	return ns
@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package metal
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ironcore-dev/fedhcp/internal/cache"
+)
+
+// unknownTTL is the time a client matching no entry is remembered. Its
+// requests are ignored without a lookup meanwhile, and it is logged again
+// once the period is over.
+const unknownTTL = 5 * time.Minute
+
+// unknownCache remembers the clients matching no entry of an inventory. Each
+// inventory has its own, so a replaced config matches all clients afresh.
+type unknownCache = cache.Cache[string, struct{}]
+
+func newUnknownCache(name string) *unknownCache {
+	return cache.New[string, struct{}](name+"/unknown", maxObservations, unknownTTL)
+}
+
+func unknownKey(mac net.HardwareAddr, duid string) string {
+	return strings.ToLower(mac.String()) + "/" + duid
+}
+
+// knownUnknown reports whether the client has been found to match no entry
+// within the last unknownTTL.
+func (inventory *Inventory) knownUnknown(mac net.HardwareAddr, duid string) bool {
+	if inventory.unknown == nil {
+		return false
+	}
+	_, ok := inventory.unknown.Get(unknownKey(mac, duid))
+	return ok
+}
+
+// rememberUnknown remembers a client matching no entry.
+func (inventory *Inventory) rememberUnknown(mac net.HardwareAddr, duid string) {
+	if inventory.unknown != nil {
+		inventory.unknown.Put(unknownKey(mac, duid), struct{}{})
+	}
+}
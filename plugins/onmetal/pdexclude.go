@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package onmetal
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+// optPDExclude is the prefix exclude option (RFC 6603) of an IA prefix. It
+// holds the length of the excluded prefix and the bits following the
+// delegated prefix, the subnet ID, left-aligned and padded to full bytes.
+type optPDExclude struct {
+	PrefixLength uint8
+	SubnetID     []byte
+}
+
+// newPDExclude returns the option excluding a prefix from the delegated
+// prefix, which must contain it.
+func newPDExclude(delegated, excluded *net.IPNet) (*optPDExclude, error) {
+	delegatedLength, _ := delegated.Mask.Size()
+	excludedLength, _ := excluded.Mask.Size()
+	if excludedLength <= delegatedLength || !delegated.Contains(excluded.IP) {
+		return nil, fmt.Errorf("prefix %s is not within delegated prefix %s", excluded, delegated)
+	}
+
+	ip := excluded.IP.To16()
+	bits := excludedLength - delegatedLength
+	subnetID := make([]byte, (bits+7)/8)
+	for i := 0; i < bits; i++ {
+		bit := delegatedLength + i
+		if ip[bit/8]&(0x80>>(bit%8)) != 0 {
+			subnetID[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return &optPDExclude{PrefixLength: uint8(excludedLength), SubnetID: subnetID}, nil
+}
+
+func (op *optPDExclude) Code() dhcpv6.OptionCode {
+	return dhcpv6.OptionPDExclude
+}
+
+func (op *optPDExclude) ToBytes() []byte {
+	return append([]byte{op.PrefixLength}, op.SubnetID...)
+}
+
+func (op *optPDExclude) String() string {
+	return fmt.Sprintf("%s: {PrefixLength=%d SubnetID=%x}", op.Code(), op.PrefixLength, op.SubnetID)
+}
+
+func (op *optPDExclude) FromBytes(data []byte) error {
+	if len(data) < 2 {
+		return fmt.Errorf("prefix exclude option too short: %d bytes", len(data))
+	}
+	op.PrefixLength = data[0]
+	op.SubnetID = append([]byte(nil), data[1:]...)
+	return nil
+}
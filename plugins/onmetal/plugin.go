@@ -6,11 +6,14 @@ package onmetal
 import (
 	"fmt"
 	"net"
-	"os"
 	"time"
 
 	"github.com/ironcore-dev/fedhcp/internal/api"
-	"gopkg.in/yaml.v3"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/ironcore-dev/fedhcp/internal/printer"
+	"github.com/ironcore-dev/fedhcp/internal/tempaddr"
+	"github.com/sirupsen/logrus"
 
 	"github.com/coredhcp/coredhcp/handler"
 	"github.com/coredhcp/coredhcp/logger"
@@ -25,7 +28,18 @@ var Plugin = plugins.Plugin{
 	Setup6: setup6,
 }
 
-var prefixLength int
+// plugin holds the state of a single onmetal plugin instance. It is built
+// once in setup6 and never modified afterwards.
+type plugin struct {
+	prefixLength int
+	// excludeLength is the length of the prefix excluded from delegated prefixes, if not 0
+	excludeLength int
+	// temporaryAddresses enables leasing of IA_TA with the given lifetimes
+	temporaryAddresses bool
+	temporaryPreferred time.Duration
+	temporaryValid     time.Duration
+	log                *logrus.Entry
+}
 
 const (
 	preferredLifeTime         = 24 * time.Hour
@@ -45,18 +59,13 @@ func parseArgs(args ...string) (string, error) {
 func loadConfig(args ...string) (*api.OnMetalConfig, error) {
 	path, err := parseArgs(args...)
 	if err != nil {
-		return nil, fmt.Errorf("invalid configuration: %v", err)
+		return nil, &fedhcperrors.ConfigError{Err: err}
 	}
 
 	log.Debugf("Reading onmetal config file %s", path)
-	configData, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %v", err)
-	}
-
 	config := &api.OnMetalConfig{}
-	if err = yaml.Unmarshal(configData, config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %v", err)
+	if err := api.Load(path, config); err != nil {
+		return nil, err
 	}
 	return config, nil
 }
@@ -67,19 +76,38 @@ func setup6(args ...string) (handler.Handler6, error) {
 		return nil, err
 	}
 
-	prefixLength = onMetalConfig.PrefixDelegation.Length
+	prefixLength := onMetalConfig.PrefixDelegation.Length
 	if prefixLength < prefixDelegationLengthMin || prefixLength > prefixDelegationLengthMax {
 		return nil, fmt.Errorf("invalid prefix length: %d", prefixLength)
 	}
+	excludeLength := onMetalConfig.PrefixDelegation.ExcludeLength
+	if excludeLength != 0 && (excludeLength <= prefixLength || excludeLength > 128) {
+		return nil, &fedhcperrors.ConfigError{
+			Err: fmt.Errorf("invalid exclude length %d, must be longer than the prefix length %d and at most 128", excludeLength, prefixLength),
+		}
+	}
+
+	temporaryPreferred, temporaryValid, err := tempaddr.Lifetimes(onMetalConfig.TemporaryAddresses)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
 
-	return handler6, nil
+	p := &plugin{
+		prefixLength:       prefixLength,
+		excludeLength:      excludeLength,
+		temporaryAddresses: onMetalConfig.TemporaryAddresses.Enabled,
+		temporaryPreferred: temporaryPreferred,
+		temporaryValid:     temporaryValid,
+		log:                instance.Logger(log, "onmetal/v6"),
+	}
+	return p.handler6, nil
 }
 
-func handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
-	log.Debugf("Received DHCPv6 request: %s", req.Summary())
+func (p *plugin) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	printer.VerboseRequest(p.log, req)
 
 	if !req.IsRelay() {
-		log.Printf("Received non-relay DHCPv6 request. Dropping.")
+		p.log.Printf("Received non-relay DHCPv6 request. Dropping.")
 		return nil, true
 	}
 
@@ -91,12 +119,23 @@ func handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
 
 	m, err := req.GetInnerMessage()
 	if err != nil {
-		log.Errorf("BUG: could not decapsulate: %v", err)
+		p.log.Errorf("BUG: could not decapsulate: %v", err)
 		return nil, true
 	}
 
+	if iata := m.Options.OneIATA(); iata != nil && p.temporaryAddresses {
+		// temporary addresses reserve nothing, so any address on the link is kept
+		addr, err := tempaddr.Address(iata, ipaddr, nil)
+		if err != nil {
+			p.log.Errorf("Could not generate temporary address: %v", err)
+			return nil, true
+		}
+		resp.AddOption(tempaddr.Option(iata, addr, p.temporaryPreferred, p.temporaryValid))
+		p.log.Infof("Added temporary address %s", addr.String())
+	}
+
 	if m.Options.OneIANA() == nil {
-		log.Debug("No address requested")
+		p.log.Debug("No address requested")
 		return resp, false
 	}
 
@@ -111,12 +150,12 @@ func handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
 		}},
 	}
 	resp.AddOption(iana)
-	log.Infof("Added option IA prefix %s", iana.String())
+	p.log.Infof("Added option IA prefix %s", iana.String())
 
 	optIAPD := m.Options.OneIAPD()
 	T1 := preferredLifeTime
 	T2 := validLifeTime
-	var mask80 = net.CIDRMask(prefixLength, 128)
+	var mask80 = net.CIDRMask(p.prefixLength, 128)
 
 	if optIAPD != nil {
 		if optIAPD.T1 != 0 {
@@ -125,6 +164,21 @@ func handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
 		if optIAPD.T2 != 0 {
 			T2 = optIAPD.T2
 		}
+		prefix := &net.IPNet{
+			Mask: mask80,
+			IP:   ipaddr.Mask(mask80),
+		}
+		prefixOptions := dhcpv6.Options{}
+		// RFC 6603 only allows the exclusion if the client requested it
+		if p.excludeLength != 0 && m.IsOptionRequested(dhcpv6.OptionPDExclude) {
+			excludeMask := net.CIDRMask(p.excludeLength, 128)
+			exclude, err := newPDExclude(prefix, &net.IPNet{Mask: excludeMask, IP: ipaddr.Mask(excludeMask)})
+			if err != nil {
+				p.log.Errorf("Could not exclude prefix: %v", err)
+			} else {
+				prefixOptions = append(prefixOptions, exclude)
+			}
+		}
 		iapd := &dhcpv6.OptIAPD{
 			IaId: optIAPD.IaId,
 			T1:   T1,
@@ -132,18 +186,15 @@ func handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
 			Options: dhcpv6.PDOptions{Options: dhcpv6.Options{&dhcpv6.OptIAPrefix{
 				PreferredLifetime: preferredLifeTime,
 				ValidLifetime:     validLifeTime,
-				Prefix: &net.IPNet{
-					Mask: mask80,
-					IP:   ipaddr.Mask(mask80),
-				},
-				Options: dhcpv6.PrefixOptions{Options: dhcpv6.Options{}},
+				Prefix:            prefix,
+				Options:           dhcpv6.PrefixOptions{Options: prefixOptions},
 			}}},
 		}
 		resp.UpdateOption(iapd)
-		log.Infof("Added option IA prefix %s", iapd.String())
+		p.log.Infof("Added option IA prefix %s", iapd.String())
 	}
 
-	log.Debugf("Sent DHCPv6 response: %s", resp.Summary())
+	printer.VerboseResponse(p.log, req, resp)
 
 	return resp, false
 }
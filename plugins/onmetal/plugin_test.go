@@ -4,13 +4,16 @@
 package onmetal
 
 import (
+	"bytes"
 	"net"
-	"os"
 	"testing"
+	"time"
 
 	"github.com/ironcore-dev/fedhcp/internal/api"
-	"gopkg.in/yaml.v3"
+	"github.com/ironcore-dev/fedhcp/internal/api/apitest"
+	"github.com/ironcore-dev/fedhcp/internal/tempaddr"
 
+	"github.com/coredhcp/coredhcp/handler"
 	"github.com/insomniacslk/dhcp/dhcpv6"
 )
 
@@ -24,26 +27,18 @@ var (
 	expectedIAID = [4]byte{1, 2, 3, 4}
 )
 
-func Init6() {
+func Init6(t *testing.T) handler.Handler6 {
 	data := api.OnMetalConfig{
 		PrefixDelegation: api.PrefixDelegation{
 			Length: 80,
 		},
 	}
 
-	configData, _ := yaml.Marshal(data)
-
-	file, _ := os.CreateTemp("", "config.yaml")
-	defer func() {
-		_ = file.Close()
-		_ = os.Remove(file.Name())
-	}()
-	_ = os.WriteFile(file.Name(), configData, 0644)
-
-	_, err := setup6(file.Name())
+	h, err := setup6(apitest.WriteConfig(t, data))
 	if err != nil {
-		log.Fatal(err)
+		t.Fatal(err)
 	}
+	return h
 }
 
 /* parametrization */
@@ -66,7 +61,7 @@ func TestWrongNumberArgs(t *testing.T) {
 
 /* IPv6 */
 func TestIPAddressRequested6(t *testing.T) {
-	Init6()
+	handler6 := Init6(t)
 
 	req, err := dhcpv6.NewMessage()
 	if err != nil {
@@ -125,7 +120,7 @@ func TestIPAddressRequested6(t *testing.T) {
 }
 
 func TestIPAddressNotRequested6(t *testing.T) {
-	Init6()
+	handler6 := Init6(t)
 
 	req, err := dhcpv6.NewMessage()
 	if err != nil {
@@ -159,7 +154,7 @@ func TestIPAddressNotRequested6(t *testing.T) {
 }
 
 func TestNoRelayIPAddressRequested6(t *testing.T) {
-	Init6()
+	handler6 := Init6(t)
 
 	req, err := dhcpv6.NewMessage()
 	if err != nil {
@@ -186,7 +181,7 @@ func TestNoRelayIPAddressRequested6(t *testing.T) {
 
 }
 func TestPrefixDelegationRequested6(t *testing.T) {
-	Init6()
+	handler6 := Init6(t)
 
 	req, err := dhcpv6.NewMessage()
 	if err != nil {
@@ -251,7 +246,7 @@ func TestPrefixDelegationRequested6(t *testing.T) {
 	}
 }
 func TestPrefixDelegationNotRequested6(t *testing.T) {
-	Init6()
+	handler6 := Init6(t)
 
 	req, err := dhcpv6.NewMessage()
 	if err != nil {
@@ -287,6 +282,119 @@ func TestPrefixDelegationNotRequested6(t *testing.T) {
 	}
 }
 
+func TestTemporaryAddressRequested6(t *testing.T) {
+	data := api.OnMetalConfig{
+		PrefixDelegation: api.PrefixDelegation{
+			Length: 80,
+		},
+		TemporaryAddresses: api.TemporaryAddresses{
+			Enabled:           true,
+			PreferredLifetime: 30 * time.Minute,
+		},
+	}
+
+	handler6, err := setup6(apitest.WriteConfig(t, data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.MessageType = dhcpv6.MessageTypeRequest
+	req.AddOption(&dhcpv6.OptIATA{
+		IaId: expectedIAID,
+	})
+
+	linkAddr := net.ParseIP("2001:db8:1111:2222::1")
+	relayedRequest, err := dhcpv6.EncapsulateRelay(req, dhcpv6.MessageTypeRelayForward, linkAddr, net.IPv6loopback)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stub, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.MessageType = dhcpv6.MessageTypeReply
+
+	resp, stop := handler6(relayedRequest, stub)
+	if resp == nil {
+		t.Fatal("plugin did not return a message")
+	}
+	if stop {
+		t.Error("plugin interrupted processing, but it shouldn't have")
+	}
+
+	opts := resp.GetOption(dhcpv6.OptionIATA)
+	if len(opts) != optionEnabled {
+		t.Fatalf("Expected %d IATA option, got %d: %v", optionEnabled, len(opts), opts)
+	}
+
+	iata := resp.(*dhcpv6.Message).Options.OneIATA()
+	addr := iata.Options.OneAddress()
+	if iata.IaId != expectedIAID {
+		t.Errorf("expected IAID %d, got %d", expectedIAID, iata.IaId)
+	}
+	if addr.PreferredLifetime != 30*time.Minute {
+		t.Errorf("Expected preferred life time %s, got %s", 30*time.Minute, addr.PreferredLifetime)
+	}
+	if addr.ValidLifetime != tempaddr.DefaultValidLifetime {
+		t.Errorf("Expected valid life time %s, got %s", tempaddr.DefaultValidLifetime, addr.ValidLifetime)
+	}
+	if !addr.IPv6Addr.Mask(net.CIDRMask(64, 128)).Equal(linkAddr.Mask(net.CIDRMask(64, 128))) {
+		t.Errorf("expected temporary address on link %s, got %s", linkAddr, addr.IPv6Addr)
+	}
+
+	// a renewing client keeps its temporary address
+	req.UpdateOption(iata)
+	relayedRequest, err = dhcpv6.EncapsulateRelay(req, dhcpv6.MessageTypeRelayForward, linkAddr, net.IPv6loopback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.Options = dhcpv6.MessageOptions{}
+	resp, _ = handler6(relayedRequest, stub)
+	renewed := resp.(*dhcpv6.Message).Options.OneIATA().Options.OneAddress()
+	if !renewed.IPv6Addr.Equal(addr.IPv6Addr) {
+		t.Errorf("expected temporary address %s to be kept, got %s", addr.IPv6Addr, renewed.IPv6Addr)
+	}
+}
+
+func TestTemporaryAddressNotEnabled6(t *testing.T) {
+	handler6 := Init6(t)
+
+	req, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.MessageType = dhcpv6.MessageTypeRequest
+	req.AddOption(&dhcpv6.OptIATA{
+		IaId: expectedIAID,
+	})
+
+	relayedRequest, err := dhcpv6.EncapsulateRelay(req, dhcpv6.MessageTypeRelayForward, net.IPv6loopback, net.IPv6loopback)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stub, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.MessageType = dhcpv6.MessageTypeReply
+
+	resp, _ := handler6(relayedRequest, stub)
+	if resp == nil {
+		t.Fatal("plugin did not return a message")
+	}
+
+	opts := resp.GetOption(dhcpv6.OptionIATA)
+	if len(opts) != optionDisabled {
+		t.Fatalf("Expected %d IATA option, got %d: %v", optionDisabled, len(opts), opts)
+	}
+}
+
 func TestPrefixDelegationNotRequested7(t *testing.T) {
 	prefixDelegationLengthOutOfBounds := 128
 	data := api.OnMetalConfig{
@@ -295,17 +403,99 @@ func TestPrefixDelegationNotRequested7(t *testing.T) {
 		},
 	}
 
-	configData, _ := yaml.Marshal(data)
-
-	file, _ := os.CreateTemp("", "config.yaml")
-	defer func() {
-		_ = file.Close()
-		_ = os.Remove(file.Name())
-	}()
-	_ = os.WriteFile(file.Name(), configData, 0644)
-
-	_, err := setup6(file.Name())
+	_, err := setup6(apitest.WriteConfig(t, data))
 	if err == nil {
 		t.Fatal("no error occurred when providing wrong prefix delegation length, but it should have")
 	}
 }
+
+func setupPrefixDelegation(t *testing.T, pd api.PrefixDelegation) (handler.Handler6, error) {
+	return setup6(apitest.WriteConfig(t, api.OnMetalConfig{PrefixDelegation: pd}))
+}
+
+func TestWrongExcludeLength(t *testing.T) {
+	for _, excludeLength := range []int{56, 48, 129} {
+		if _, err := setupPrefixDelegation(t, api.PrefixDelegation{Length: 56, ExcludeLength: excludeLength}); err == nil {
+			t.Errorf("no error occurred when providing exclude length %d, but it should have", excludeLength)
+		}
+	}
+}
+
+func TestPDExclude(t *testing.T) {
+	for _, tc := range []struct {
+		delegated, excluded string
+		subnetID            []byte
+	}{
+		{"2001:db8::/56", "2001:db8:0:1::/64", []byte{0x01}},
+		{"2001:db8::/59", "2001:db8:0:1f::/64", []byte{0xf8}},
+		{"2001:db8::/48", "2001:db8:0:8001::/64", []byte{0x80, 0x01}},
+		{"2001:db8:1:2:3::/80", "2001:db8:1:2:3::1/128", []byte{0, 0, 0, 0, 0, 0x01}},
+	} {
+		_, delegated, _ := net.ParseCIDR(tc.delegated)
+		_, excluded, _ := net.ParseCIDR(tc.excluded)
+		opt, err := newPDExclude(delegated, excluded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		length, _ := excluded.Mask.Size()
+		expected := append([]byte{byte(length)}, tc.subnetID...)
+		if !bytes.Equal(opt.ToBytes(), expected) {
+			t.Errorf("excluding %s from %s: expected %x, got %x", tc.excluded, tc.delegated, expected, opt.ToBytes())
+		}
+	}
+
+	_, delegated, _ := net.ParseCIDR("2001:db8::/56")
+	_, excluded, _ := net.ParseCIDR("2001:db8:1::/64")
+	if _, err := newPDExclude(delegated, excluded); err == nil {
+		t.Error("no error occurred when excluding a prefix outside the delegated one, but it should have")
+	}
+}
+
+func TestPrefixDelegationExcluded6(t *testing.T) {
+	handler6, err := setupPrefixDelegation(t, api.PrefixDelegation{Length: 56, ExcludeLength: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, requested := range []bool{false, true} {
+		req, err := dhcpv6.NewMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.MessageType = dhcpv6.MessageTypeRequest
+		req.AddOption(&dhcpv6.OptIANA{IaId: expectedIAID})
+		req.AddOption(&dhcpv6.OptIAPD{IaId: expectedIAID})
+		if requested {
+			req.AddOption(dhcpv6.OptRequestedOption(dhcpv6.OptionPDExclude))
+		}
+		relayedRequest, err := dhcpv6.EncapsulateRelay(req, dhcpv6.MessageTypeRelayForward,
+			net.ParseIP("2001:db8:1111:2222:3333:4444:5555:6666"), net.IPv6loopback)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stub, err := dhcpv6.NewMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stub.MessageType = dhcpv6.MessageTypeReply
+
+		resp, _ := handler6(relayedRequest, stub)
+		prefix := resp.(*dhcpv6.Message).Options.OneIAPD().Options.Options[0].(*dhcpv6.OptIAPrefix)
+		if prefix.Prefix.String() != "2001:db8:1111:2200::/56" {
+			t.Errorf("expected prefix 2001:db8:1111:2200::/56, got %s", prefix.Prefix)
+		}
+		exclude := prefix.Options.GetOne(dhcpv6.OptionPDExclude)
+		if !requested {
+			if exclude != nil {
+				t.Errorf("expected no prefix exclusion without it being requested, got %s", exclude)
+			}
+			continue
+		}
+		if exclude == nil {
+			t.Fatal("expected a prefix exclusion, but it is missing")
+		}
+		if !bytes.Equal(exclude.ToBytes(), []byte{64, 0x22}) {
+			t.Errorf("expected the link prefix 2001:db8:1111:2222::/64 excluded, got %s", exclude)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package oob
+
+import (
+	"fmt"
+	"net"
+)
+
+// HintKind tells how the address of an AddressHint is used.
+type HintKind int
+
+const (
+	// HintNone means nothing is known about the client's network, the first
+	// OOB subnet of the address family is leased from.
+	HintNone HintKind = iota
+	// HintSubnet means the address, e.g. of the relay or the serving
+	// interface, selects the subnet to lease any free address from.
+	HintSubnet
+	// HintExact means the client asked for the address, it is leased from the
+	// subnet containing it.
+	HintExact
+)
+
+// AddressHint is what a request tells about the address to lease.
+type AddressHint struct {
+	Kind HintKind
+	IP   net.IP
+}
+
+// NoHint returns the hint of a request telling nothing about its network.
+func NoHint() AddressHint {
+	return AddressHint{Kind: HintNone}
+}
+
+// SubnetHint returns the hint selecting the subnet containing the address.
+func SubnetHint(ip net.IP) AddressHint {
+	return AddressHint{Kind: HintSubnet, IP: ip}
+}
+
+// ExactHint returns the hint requesting the address.
+func ExactHint(ip net.IP) AddressHint {
+	return AddressHint{Kind: HintExact, IP: ip}
+}
+
+func (h AddressHint) String() string {
+	switch h.Kind {
+	case HintSubnet:
+		return fmt.Sprintf("subnet of %s", h.IP)
+	case HintExact:
+		return fmt.Sprintf("exact %s", h.IP)
+	default:
+		return "none"
+	}
+}
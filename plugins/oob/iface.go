@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package oob
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+// interfaceIP returns the first global unicast address of the given family
+// configured on the named interface. It is used for subnet detection of
+// directly attached, i.e. non-relayed, clients.
+func interfaceIP(name string, ipv6 bool) (net.IP, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up interface %s: %w", name, err)
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list addresses of interface %s: %w", name, err)
+	}
+
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || !ipNet.IP.IsGlobalUnicast() {
+			continue
+		}
+		if (ipNet.IP.To4() == nil) == ipv6 {
+			return ipNet.IP, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no global unicast address of the requested family found on interface %s", name)
+}
+
+// macFromDUID extracts the client MAC address from a link-layer based DUID.
+// Directly attached clients do not come with a relay peer address, so the DUID
+// is the only place to take the MAC address from.
+func macFromDUID(duid dhcpv6.DUID) (net.HardwareAddr, error) {
+	switch d := duid.(type) {
+	case *dhcpv6.DUIDLL:
+		return d.LinkLayerAddr, nil
+	case *dhcpv6.DUIDLLT:
+		return d.LinkLayerAddr, nil
+	case nil:
+		return nil, fmt.Errorf("no client identifier present")
+	default:
+		return nil, fmt.Errorf("client identifier %s does not contain a link-layer address", duid)
+	}
+}
@@ -5,163 +5,347 @@ package oob
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"net"
-	"os"
 	"reflect"
+	"slices"
 	"strings"
+	"time"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/watch"
 
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/journal"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/ironcore-dev/fedhcp/internal/links"
+	"github.com/ironcore-dev/fedhcp/internal/subnets"
 	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
-	ipam "github.com/ironcore-dev/ipam/clientgo/ipam"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes/scheme"
-	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/client/config"
 )
 
 const (
 	origin = "fedhcp"
+	// temporaryExpiresAnnotation holds the time a temporary IP expires at, it
+	// is deleted once expired, see collectTemporaryIps
+	temporaryExpiresAnnotation = "fedhcp.ironcore.dev/temporary-expires"
 )
 
 type K8sClient struct {
-	Client        client.Client
-	Clientset     ipam.Clientset
-	Namespace     string
-	OobLabel      string
+	Client client.Client
+	// Watcher watches the IPs created by Client until IPAM reserved them
+	Watcher   client.WithWatch
+	Namespace string
+	// OobLabels are the labels of the IPs created, the equality-based labels
+	// of the subnet selector
+	OobLabels map[string]string
+	Subnets   *subnets.Selector
+	// Ctx is cancelled on server shutdown, the requests derive their contexts from it
 	Ctx           context.Context
 	EventRecorder record.EventRecorder
+	// Links relates the IPs to the Endpoint of their MAC address, nil if disabled
+	Links *links.Linker
 }
 
-func NewK8sClient(namespace string, oobLabel string) (*K8sClient, error) {
+func NewK8sClient(name, namespace string, subnetSelector labels.Selector, oobLabels map[string]string) (*K8sClient, error) {
+	selector, err := subnets.New(name, namespace, nil, subnetSelector.String())
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	// the clients of the server are used, so writes are dry-run when simulating
+	recorder, err := kubernetes.NewEventRecorder()
+	if err != nil {
+		return nil, err
+	}
 
-	if err := ipamv1alpha1.AddToScheme(scheme.Scheme); err != nil {
-		return nil, fmt.Errorf("unable to add registered types ipam to client scheme %w", err)
+	k8sClient := K8sClient{
+		Client:        kubernetes.GetClient(),
+		Watcher:       kubernetes.GetWatchClient(),
+		Namespace:     namespace,
+		OobLabels:     oobLabels,
+		Subnets:       selector,
+		Ctx:           kubernetes.Context(),
+		EventRecorder: recorder,
 	}
 
-	cfg := config.GetConfigOrDie()
-	cl, err := client.New(cfg, client.Options{})
+	return &k8sClient, nil
+}
+
+func (k K8sClient) getIp(
+	ctx context.Context,
+	hint AddressHint,
+	mac net.HardwareAddr,
+	subnetType ipamv1alpha1.SubnetAddressType) (*lease, error) {
+	var ipamIP *ipamv1alpha1.IP
+	var annotations, labels map[string]string
+	macKey := strings.ReplaceAll(mac.String(), ":", "")
+
+	oobSubnets, err := k.getOOBNetworks(ctx, subnetType)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create controller runtime client %w", err)
+		return nil, err
+	}
+	if len(oobSubnets) == 0 {
+		return nil, &fedhcperrors.ConfigError{Err: errors.New("No OOB subnets found")}
 	}
+	log.Debugf("%d OOB subnets found: %s", len(oobSubnets), strings.Join(oobSubnets, " "))
 
-	clientset, err := ipam.NewForConfig(cfg)
+	// select the first subnet matching, there can be only one
+	var subnet *ipamv1alpha1.Subnet
+	if hint.Kind == HintNone {
+		subnet, err = k.Subnets.First(ctx, subnetType)
+	} else {
+		subnet, err = k.Subnets.Match(ctx, hint.IP, subnetType)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to create IPAM clientset %w", err)
+		return nil, err
 	}
+	if subnet == nil {
+		return nil, &fedhcperrors.NoSubnetMatch{IP: hint.IP}
+	}
+	log.Debugf("Selecting subnet %s/%s", k.Namespace, subnet.Name)
+	annotations, labels = subnet.Annotations, subnet.Labels
 
-	corev1Client, err := corev1client.NewForConfig(cfg)
+	ipamIP, err = k.prepareCreateIpamIP(ctx, subnet.Name, mac)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create core client %w", err)
+		return nil, err
+	}
+	if ipamIP == nil {
+		ipamIP, err = k.doCreateIpamIP(ctx, subnet.Name, macKey, hint)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		log.Infof("Reserved IP %s (%s/%s) already exists in subnet %s", ipamIP.Status.Reserved.String(),
+			ipamIP.Namespace, ipamIP.Name, ipamIP.Spec.Subnet.Name)
+		k.applySubnetLabel(ctx, ipamIP)
 	}
 
-	broadcaster := record.NewBroadcaster()
+	if ipamIP.Status.Reserved != nil {
+		if err := k.Links.Link(ctx, k.Client, mac); err != nil {
+			// the lease is handed out anyway, the link is retried on the next request
+			log.WithFields(fedhcperrors.Fields(err)).Warnf("Could not link IP %s to the Endpoint of %s: %v", ipamIP.Name, mac.String(), err)
+		}
+		return &lease{ip: net.ParseIP(ipamIP.Status.Reserved.String()), subnet: subnet.Name, subnetAnnotations: annotations, subnetLabels: labels}, nil
+	} else {
+		return nil, &fedhcperrors.ReservationPending{Subnet: ipamIP.Spec.Subnet.Name, Name: ipamIP.Namespace + "/" + ipamIP.Name}
+	}
+}
 
-	// Leader id, needs to be unique
-	id, err := os.Hostname()
+// reserveTemporaryIp reserves a temporary address in IPAM until expires. The
+// IP object is flagged as temporary and carries no "mac" label, so it is never
+// handed out as the client's non-temporary address. Reserving an address
+// reserved before extends its expiry.
+func (k K8sClient) reserveTemporaryIp(ctx context.Context, ipaddr net.IP, mac net.HardwareAddr, expires time.Time) error {
+	macKey := strings.ReplaceAll(mac.String(), ":", "")
+	ip, err := ipamv1alpha1.IPAddrFromString(ipaddr.String())
 	if err != nil {
-		return nil, fmt.Errorf("failed to get hostname %w", err)
+		return fmt.Errorf("failed to parse IP %s: %w", ipaddr, err)
 	}
-	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: id})
-	broadcaster.StartRecordingToSink(&corev1client.EventSinkImpl{Interface: corev1Client.Events("")})
 
-	k8sClient := K8sClient{
-		Client:        cl,
-		Clientset:     *clientset,
-		Namespace:     namespace,
-		OobLabel:      oobLabel,
-		Ctx:           context.Background(),
-		EventRecorder: recorder,
+	existing, err := k.temporaryIps(ctx, mac)
+	if err != nil {
+		return err
+	}
+	for i := range existing {
+		if existing[i].Spec.IP != nil && existing[i].Spec.IP.Equal(ip) {
+			log.Debugf("Temporary IP %s (%s/%s) already reserved", ipaddr, existing[i].Namespace, existing[i].Name)
+			return k.extendTemporaryIp(ctx, &existing[i], expires)
+		}
 	}
 
-	return &k8sClient, nil
+	subnet, err := k.Subnets.Match(ctx, ipaddr, ipamv1alpha1.CIPv6SubnetType)
+	if err != nil {
+		return err
+	}
+	if subnet == nil {
+		return &fedhcperrors.NoSubnetMatch{IP: ipaddr}
+	}
+
+	ipamIP := &ipamv1alpha1.IP{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      temporaryIPName(macKey, ipaddr),
+			Namespace: k.Namespace,
+			Labels: k.withSubnetLabels(map[string]string{
+				"temporary-mac": macKey,
+				"temporary":     "true",
+				"origin":        origin,
+			}),
+			Annotations: map[string]string{
+				temporaryExpiresAnnotation: expires.UTC().Format(time.RFC3339),
+			},
+		},
+		Spec: ipamv1alpha1.IPSpec{
+			IP: ip,
+			Subnet: corev1.LocalObjectReference{
+				Name: subnet.Name,
+			},
+		},
+	}
+	tx := journal.Begin(journal.KindIP, k.Namespace)
+	defer tx.End()
+	tx.Label(ipamIP)
+	if err := k.Client.Create(ctx, ipamIP); apierrors.IsAlreadyExists(err) {
+		// reserved by an earlier, timed out attempt or another replica
+		log.Debugf("Temporary IP %s (%s/%s) already reserved", ipaddr, ipamIP.Namespace, ipamIP.Name)
+		existingIpamIP := &ipamv1alpha1.IP{}
+		if err := k.Client.Get(ctx, client.ObjectKeyFromObject(ipamIP), existingIpamIP); err != nil {
+			return fmt.Errorf("failed to get temporary IP %s: %w", ipaddr, fedhcperrors.FromK8s(err))
+		}
+		if err := sameOwner(existingIpamIP, ipamIP, "temporary-mac"); err != nil {
+			return err
+		}
+		return k.extendTemporaryIp(ctx, existingIpamIP, expires)
+	} else if err != nil {
+		return fmt.Errorf("failed to create temporary IP %s: %w", ipaddr, fedhcperrors.FromK8s(err))
+	}
+	if _, err := k.waitForCreation(ctx, ipamIP); err != nil {
+		return fmt.Errorf("failed to create temporary IP %s: %w", ipaddr, err)
+	}
+	log.Infof("Temporary IP %s (%s/%s) reserved in subnet %s until %s", ipaddr, ipamIP.Namespace, ipamIP.Name,
+		subnet.Name, expires.UTC().Format(time.RFC3339))
+	return nil
 }
 
-func (k K8sClient) getIp(
-	ipaddr net.IP,
-	mac net.HardwareAddr,
-	exactIP bool,
-	subnetType ipamv1alpha1.SubnetAddressType) (net.IP, error) {
-	var ipamIP *ipamv1alpha1.IP
+// extendTemporaryIp moves the expiry of a temporary IP to expires, unless it
+// expires later already. The IP is adopted, see journal.Adopt.
+func (k K8sClient) extendTemporaryIp(ctx context.Context, ipamIP *ipamv1alpha1.IP, expires time.Time) error {
+	if err := journal.Adopt(ctx, k.Client, ipamIP); err != nil {
+		return fedhcperrors.FromK8s(err)
+	}
+	if !temporaryExpiry(ipamIP, 0).Before(expires.Truncate(time.Second)) {
+		return nil
+	}
+	patch := client.MergeFrom(ipamIP.DeepCopy())
+	if ipamIP.Annotations == nil {
+		ipamIP.Annotations = make(map[string]string, 1)
+	}
+	ipamIP.Annotations[temporaryExpiresAnnotation] = expires.UTC().Format(time.RFC3339)
+	if err := k.Client.Patch(ctx, ipamIP, patch); err != nil {
+		return fmt.Errorf("failed to extend temporary IP %s/%s: %w", ipamIP.Namespace, ipamIP.Name, fedhcperrors.FromK8s(err))
+	}
+	return nil
+}
+
+// temporaryIps returns the temporary IPs of the MAC address.
+func (k K8sClient) temporaryIps(ctx context.Context, mac net.HardwareAddr) ([]ipamv1alpha1.IP, error) {
 	macKey := strings.ReplaceAll(mac.String(), ":", "")
+	ipList := &ipamv1alpha1.IPList{}
+	if err := k.Client.List(ctx, ipList, client.InNamespace(k.Namespace),
+		client.MatchingLabels{"temporary-mac": macKey}); err != nil {
+		return nil, fmt.Errorf("error listing temporary IPs with MAC %v: %w", macKey, fedhcperrors.FromK8s(err))
+	}
+	return ipList.Items, nil
+}
 
-	subnetNames := k.getOOBNetworks(subnetType)
-	if len(subnetNames) == 0 {
-		return nil, errors.New("No OOB subnets found")
-	} else {
-		log.Debugf("%d OOB subnets found: %s", len(subnetNames), strings.Join(subnetNames, " "))
-		subnetMatch := false
-		for _, subnetName := range subnetNames {
-			subnet, err := k.getMatchingSubnet(subnetName, ipaddr)
-			if err != nil {
-				return nil, err
-			}
-			if subnet == nil {
-				continue
-			}
-			log.Debugf("Selecting subnet %s/%s", k.Namespace, subnetName)
-			subnetMatch = true
+// temporaryReserved returns whether the temporary address is reserved for the
+// MAC address and not expired at now.
+func (k K8sClient) temporaryReserved(ctx context.Context, ipaddr net.IP, mac net.HardwareAddr, now time.Time) (bool, error) {
+	ips, err := k.temporaryIps(ctx, mac)
+	if err != nil {
+		return false, err
+	}
+	for i := range ips {
+		if ips[i].DeletionTimestamp == nil && ips[i].Spec.IP != nil &&
+			net.ParseIP(ips[i].Spec.IP.String()).Equal(ipaddr) && now.Before(temporaryExpiry(&ips[i], 0)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
 
-			ipamIP, err = k.prepareCreateIpamIP(subnetName, macKey)
-			if err != nil {
-				return nil, err
-			}
-			if ipamIP == nil {
-				ipamIP, err = k.doCreateIpamIP(subnetName, macKey, ipaddr, exactIP)
-				if err != nil {
-					return nil, err
-				}
-			} else {
-				log.Infof("Reserved IP %s (%s/%s) already exists in subnet %s", ipamIP.Status.Reserved.String(),
-					ipamIP.Namespace, ipamIP.Name, ipamIP.Spec.Subnet.Name)
-				k.applySubnetLabel(ipamIP)
-			}
-			// break at first subnet match, there can be only one
-			break
+// releaseTemporaryIps deletes the temporary IPs of the MAC address reserving
+// one of the addresses.
+func (k K8sClient) releaseTemporaryIps(ctx context.Context, mac net.HardwareAddr, addrs []net.IP) error {
+	ips, err := k.temporaryIps(ctx, mac)
+	if err != nil {
+		return err
+	}
+	for i := range ips {
+		if ips[i].Spec.IP == nil || !slices.ContainsFunc(addrs, net.ParseIP(ips[i].Spec.IP.String()).Equal) {
+			continue
 		}
-		if !subnetMatch {
-			return nil, errors.New(fmt.Sprintf("No matching subnet found for IP %s/%s", k.Namespace, ipaddr))
+		if err := k.Client.Delete(ctx, &ips[i]); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete temporary IP %s/%s: %w", ips[i].Namespace, ips[i].Name, fedhcperrors.FromK8s(err))
 		}
+		log.Infof("Temporary IP %s (%s/%s) released", ips[i].Spec.IP, ips[i].Namespace, ips[i].Name)
 	}
+	return nil
+}
 
-	if ipamIP.Status.Reserved != nil {
-		return net.ParseIP(ipamIP.Status.Reserved.String()), nil
-	} else {
-		return nil, errors.New("No reserved IP address found")
+// collectTemporaryIps deletes the temporary IPs expired at now and returns
+// their number. IPs without expiry, reserved by earlier versions, expire
+// valid after their creation.
+func (k K8sClient) collectTemporaryIps(ctx context.Context, now time.Time, valid time.Duration) (int, error) {
+	ipList := &ipamv1alpha1.IPList{}
+	if err := k.Client.List(ctx, ipList, client.InNamespace(k.Namespace),
+		client.MatchingLabels{"temporary": "true", "origin": origin}); err != nil {
+		return 0, fmt.Errorf("error listing temporary IPs: %w", fedhcperrors.FromK8s(err))
+	}
+	collected := 0
+	for i := range ipList.Items {
+		ipamIP := &ipList.Items[i]
+		if ipamIP.DeletionTimestamp != nil || now.Before(temporaryExpiry(ipamIP, valid)) {
+			continue
+		}
+		if err := k.Client.Delete(ctx, ipamIP); err != nil && !apierrors.IsNotFound(err) {
+			return collected, fmt.Errorf("failed to delete temporary IP %s/%s: %w", ipamIP.Namespace, ipamIP.Name, fedhcperrors.FromK8s(err))
+		}
+		log.Debugf("Expired temporary IP %s/%s deleted", ipamIP.Namespace, ipamIP.Name)
+		collected++
 	}
+	return collected, nil
 }
 
-func (k K8sClient) prepareCreateIpamIP(subnetName string, macKey string) (*ipamv1alpha1.IP, error) {
-	namespace := k.Namespace
-	fieldSelector := "metadata.namespace=" + namespace
-	// https://github.com/ironcore-dev/ipam/issues/307
-	// fieldSelector += ",spec.subnet.name=" + subnetName
-	labelSelector := "mac=" + macKey
-	//labelSelector += ",origin=" + origin
-	timeout := int64(5)
+// temporaryExpiry returns the time a temporary IP expires at, valid after its
+// creation if it carries no valid expiry.
+func temporaryExpiry(ipamIP *ipamv1alpha1.IP, valid time.Duration) time.Time {
+	if expires, err := time.Parse(time.RFC3339, ipamIP.Annotations[temporaryExpiresAnnotation]); err == nil {
+		return expires
+	}
+	return ipamIP.CreationTimestamp.Add(valid)
+}
+
+// ipsReserving returns the IPs in the namespace reserving the address, except
+// those being deleted.
+func (k K8sClient) ipsReserving(ctx context.Context, ipaddr net.IP) ([]ipamv1alpha1.IP, error) {
+	ipList := &ipamv1alpha1.IPList{}
+	if err := k.Client.List(ctx, ipList, client.InNamespace(k.Namespace)); err != nil {
+		return nil, fmt.Errorf("error listing IPs: %w", fedhcperrors.FromK8s(err))
+	}
+	var ips []ipamv1alpha1.IP
+	for _, ipamIP := range ipList.Items {
+		if ipamIP.DeletionTimestamp == nil && ipamIP.Status.Reserved != nil &&
+			net.ParseIP(ipamIP.Status.Reserved.String()).Equal(ipaddr) {
+			ips = append(ips, ipamIP)
+		}
+	}
+	return ips, nil
+}
 
-	ipList, err := k.Clientset.IpamV1alpha1().IPs(namespace).List(context.TODO(), metav1.ListOptions{
-		FieldSelector:  fieldSelector,
-		LabelSelector:  labelSelector,
-		TimeoutSeconds: &timeout,
-	})
+func (k K8sClient) prepareCreateIpamIP(ctx context.Context, subnetName string, mac net.HardwareAddr) (*ipamv1alpha1.IP, error) {
+	// https://github.com/ironcore-dev/ipam/issues/307
+	// the subnet is not selectable, so the IPs are filtered below
+	ips, err := kubernetes.IPsForMAC(ctx, k.Namespace, mac)
 	if err != nil {
-		return nil, fmt.Errorf("error listing IPs with MAC %v: %w", macKey, err)
+		return nil, fmt.Errorf("error listing IPs with MAC %v: %w", mac, fedhcperrors.FromK8s(err))
 	}
-	if len(ipList.Items) == 0 {
+	if len(ips) == 0 {
 		noop()
 	} else {
-		for _, existingIpamIP := range ipList.Items {
+		for _, existingIpamIP := range ips {
 			if existingIpamIP.Spec.Subnet.Name != subnetName {
 				// IP with that MAC is assigned to a different subnet (v4 vs v6?)
-				log.Debugf("IPAM IP with MAC %v and wrong subnet %s/%s found, ignoring", macKey,
+				log.Debugf("IPAM IP with MAC %v and wrong subnet %s/%s found, ignoring", mac,
 					existingIpamIP.Namespace, existingIpamIP.Spec.Subnet.Name)
 				continue
 			} else if existingIpamIP.Status.State == ipamv1alpha1.CFailedIPState {
@@ -169,12 +353,13 @@ func (k K8sClient) prepareCreateIpamIP(subnetName string, macKey string) (*ipamv
 					existingIpamIP.Name, existingIpamIP.Spec.Subnet.Name)
 				log.Debugf("Deleting old IP %s/%s:\n%v", existingIpamIP.Namespace, existingIpamIP.Name,
 					prettyFormat(existingIpamIP.Status))
-				err = k.Client.Delete(k.Ctx, &existingIpamIP)
+				err = k.Client.Delete(ctx, &existingIpamIP)
 				if err != nil {
-					return nil, fmt.Errorf("failed to delete IP %s/%s: %w", existingIpamIP.Namespace, existingIpamIP.Name, err)
+					return nil, fmt.Errorf("failed to delete IP %s/%s: %w", existingIpamIP.Namespace, existingIpamIP.Name,
+						fedhcperrors.FromK8s(err))
 				}
 
-				err = k.waitForDeletion(&existingIpamIP)
+				err = k.waitForDeletion(ctx, &existingIpamIP)
 				if err != nil {
 					return nil, fmt.Errorf("failed to delete IP %s/%s: %w", existingIpamIP.Namespace, existingIpamIP.Name, err)
 				}
@@ -183,7 +368,10 @@ func (k K8sClient) prepareCreateIpamIP(subnetName string, macKey string) (*ipamv
 				log.Debugf("Old IP %s/%s deleted from subnet %s", existingIpamIP.Namespace,
 					existingIpamIP.Name, existingIpamIP.Spec.Subnet.Name)
 			} else {
-				// IP already exists
+				// IP already exists, it is handed out again
+				if err := journal.Adopt(ctx, k.Client, &existingIpamIP); err != nil {
+					return nil, fedhcperrors.FromK8s(err)
+				}
 				return &existingIpamIP, nil
 			}
 		}
@@ -193,23 +381,20 @@ func (k K8sClient) prepareCreateIpamIP(subnetName string, macKey string) (*ipamv
 }
 
 func (k K8sClient) doCreateIpamIP(
+	ctx context.Context,
 	subnetName string,
 	macKey string,
-	ipaddr net.IP,
-	exactIP bool) (*ipamv1alpha1.IP, error) {
-	oobLabelKey := strings.Split(k.OobLabel, "=")[0]
-	oobLabelValue := strings.Split(k.OobLabel, "=")[1]
+	hint AddressHint) (*ipamv1alpha1.IP, error) {
 	var ipamIP *ipamv1alpha1.IP
-	if ipaddr.String() == UNKNOWN_IP || !exactIP {
+	if hint.Kind != HintExact {
 		ipamIP = &ipamv1alpha1.IP{
 			ObjectMeta: metav1.ObjectMeta{
-				GenerateName: macKey + "-" + origin + "-",
-				Namespace:    k.Namespace,
-				Labels: map[string]string{
-					"mac":       macKey,
-					"origin":    origin,
-					oobLabelKey: oobLabelValue,
-				},
+				Name:      ipName(macKey, subnetName),
+				Namespace: k.Namespace,
+				Labels: k.withSubnetLabels(map[string]string{
+					"mac":    macKey,
+					"origin": origin,
+				}),
 			},
 			Spec: ipamv1alpha1.IPSpec{
 				Subnet: corev1.LocalObjectReference{
@@ -218,16 +403,15 @@ func (k K8sClient) doCreateIpamIP(
 			},
 		}
 	} else {
-		ip, _ := ipamv1alpha1.IPAddrFromString(ipaddr.String())
+		ip, _ := ipamv1alpha1.IPAddrFromString(hint.IP.String())
 		ipamIP = &ipamv1alpha1.IP{
 			ObjectMeta: metav1.ObjectMeta{
-				GenerateName: macKey + "-" + origin + "-",
-				Namespace:    k.Namespace,
-				Labels: map[string]string{
-					"mac":       macKey,
-					"origin":    origin,
-					oobLabelKey: oobLabelValue,
-				},
+				Name:      ipName(macKey, subnetName),
+				Namespace: k.Namespace,
+				Labels: k.withSubnetLabels(map[string]string{
+					"mac":    macKey,
+					"origin": origin,
+				}),
 			},
 			Spec: ipamv1alpha1.IPSpec{
 				IP: ip,
@@ -238,14 +422,18 @@ func (k K8sClient) doCreateIpamIP(
 		}
 	}
 
-	err := k.Client.Create(k.Ctx, ipamIP)
+	// an IP created but not reported back before a crash is deleted on startup
+	tx := journal.Begin(journal.KindIP, k.Namespace)
+	defer tx.End()
+	tx.Label(ipamIP)
+	err := k.Client.Create(ctx, ipamIP)
 	if err != nil && !apierrors.IsAlreadyExists(err) {
-		return nil, fmt.Errorf("failed to create IP %s/%s: %w", ipamIP.Namespace, ipamIP.Name, err)
+		return nil, fmt.Errorf("failed to create IP %s/%s: %w", ipamIP.Namespace, ipamIP.Name, fedhcperrors.FromK8s(err))
 	} else if apierrors.IsAlreadyExists(err) {
-		// do not create IP, because the deletion is not yet ready
-		noop()
+		// created by an earlier, timed out attempt or another replica
+		return k.getCreatedIpamIP(ctx, ipamIP)
 	} else {
-		ipamIP, err = k.waitForCreation(ipamIP)
+		ipamIP, err = k.waitForCreation(ctx, ipamIP)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create IP %s/%s: %w", ipamIP.Namespace, ipamIP.Name, err)
 		} else {
@@ -255,154 +443,195 @@ func (k K8sClient) doCreateIpamIP(
 
 			// update IP attributes
 			createdIpamIP := ipamIP.DeepCopy()
-			err := k.Client.Get(k.Ctx, client.ObjectKeyFromObject(createdIpamIP), createdIpamIP)
+			err := k.Client.Get(ctx, client.ObjectKeyFromObject(createdIpamIP), createdIpamIP)
 			if err != nil && !apierrors.IsNotFound(err) {
-				return nil, fmt.Errorf("Failed to get IP %s/%s: %w", createdIpamIP.Namespace, createdIpamIP.Name, err)
+				return nil, fmt.Errorf("Failed to get IP %s/%s: %w", createdIpamIP.Namespace, createdIpamIP.Name,
+					fedhcperrors.FromK8s(err))
 			}
 			return createdIpamIP, nil
 		}
 	}
+}
 
-	return nil, nil
+// getCreatedIpamIP returns the IP of the same name as ipamIP, which already
+// exists, once it is reserved. It is only handed out if it was created by
+// FeDHCP for the same MAC address and subnet, i.e. by an earlier attempt or
+// another replica, and is then adopted, see journal.Adopt.
+func (k K8sClient) getCreatedIpamIP(ctx context.Context, ipamIP *ipamv1alpha1.IP) (*ipamv1alpha1.IP, error) {
+	existingIpamIP := &ipamv1alpha1.IP{}
+	if err := k.Client.Get(ctx, client.ObjectKeyFromObject(ipamIP), existingIpamIP); err != nil {
+		return nil, fmt.Errorf("failed to get IP %s/%s: %w", ipamIP.Namespace, ipamIP.Name, fedhcperrors.FromK8s(err))
+	}
+	if err := sameOwner(existingIpamIP, ipamIP, "mac"); err != nil {
+		return nil, err
+	}
+	if existingIpamIP.DeletionTimestamp != nil {
+		return nil, fmt.Errorf("IP %s/%s is being deleted", existingIpamIP.Namespace, existingIpamIP.Name)
+	}
+	if existingIpamIP.Status.State != ipamv1alpha1.CFinishedIPState {
+		createdIpamIP, err := k.waitForCreation(ctx, existingIpamIP)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create IP %s/%s: %w", existingIpamIP.Namespace, existingIpamIP.Name, err)
+		}
+		existingIpamIP = createdIpamIP
+	}
+	if err := journal.Adopt(ctx, k.Client, existingIpamIP); err != nil {
+		return nil, fedhcperrors.FromK8s(err)
+	}
+	log.Infof("IP %s (%s/%s) already created in subnet %s", existingIpamIP.Status.Reserved.String(),
+		existingIpamIP.Namespace, existingIpamIP.Name, existingIpamIP.Spec.Subnet.Name)
+	return existingIpamIP, nil
 }
 
-func (k K8sClient) waitForDeletion(ipamIP *ipamv1alpha1.IP) error {
+// sameOwner returns an error unless the existing IP, of the same name as
+// ipamIP, was created by FeDHCP for the MAC address in macLabel and the subnet
+// of ipamIP. The names are derived from both, so another owner is either a
+// hash collision or an IP not created by FeDHCP, which must not be handed out.
+func sameOwner(existing, ipamIP *ipamv1alpha1.IP, macLabel string) error {
+	if existing.Labels["origin"] != origin || existing.Labels[macLabel] != ipamIP.Labels[macLabel] ||
+		existing.Spec.Subnet.Name != ipamIP.Spec.Subnet.Name {
+		return fmt.Errorf("IP %s/%s already exists for %s %q in subnet %s, origin %q", existing.Namespace, existing.Name,
+			macLabel, existing.Labels[macLabel], existing.Spec.Subnet.Name, existing.Labels["origin"])
+	}
+	return nil
+}
+
+// ipName returns the name of the IP of a MAC address in a subnet. It is derived
+// from both, so that creating the IP again, when retrying after a timeout or on
+// another replica, hits the existing IP instead of adding a second one for the
+// MAC address.
+func ipName(macKey, subnetName string) string {
+	sum := sha256.Sum256([]byte(subnetName))
+	return macKey + "-" + origin + "-" + hex.EncodeToString(sum[:5])
+}
+
+// temporaryIPName returns the name of the IP of a temporary address of a MAC
+// address, derived from both like ipName.
+func temporaryIPName(macKey string, ipaddr net.IP) string {
+	sum := sha256.Sum256(ipaddr.To16())
+	return macKey + "-" + origin + "-ta-" + hex.EncodeToString(sum[:5])
+}
+
+func (k K8sClient) waitForDeletion(ctx context.Context, ipamIP *ipamv1alpha1.IP) error {
 	// Define the namespace and resource name (if you want to watch a specific resource)
 	namespace := ipamIP.Namespace
 	resourceName := ipamIP.Name
-	fieldSelector := "metadata.name=" + resourceName + ",metadata.namespace=" + namespace
 	timeout := int64(5)
 
 	// watch for deletion finished event
-	watcher, err := k.Clientset.IpamV1alpha1().IPs(namespace).Watch(context.TODO(), metav1.ListOptions{
-		FieldSelector:  fieldSelector,
-		TimeoutSeconds: &timeout,
-	})
+	watcher, err := k.Watcher.Watch(ctx, &ipamv1alpha1.IPList{}, client.InNamespace(namespace),
+		client.MatchingFields{"metadata.name": resourceName}, &client.ListOptions{Raw: &metav1.ListOptions{TimeoutSeconds: &timeout}})
 	if err != nil {
-		log.Errorf("Error watching for IP: %v", err)
+		return fmt.Errorf("error watching for IP: %w", fedhcperrors.FromK8s(err))
 	}
+	defer watcher.Stop()
 
 	log.Tracef("Watching for changes to IP %s/%s...", namespace, resourceName)
 
-	for event := range watcher.ResultChan() {
-		log.Tracef("Type: %s, Object: %v\n", event.Type, event.Object)
-		existingIpamIP := event.Object.(*ipamv1alpha1.IP)
-		if event.Type == watch.Deleted && reflect.DeepEqual(ipamIP.Spec, existingIpamIP.Spec) {
-			log.Infof("IP %s/%s deleted", existingIpamIP.Namespace, existingIpamIP.Name)
-			return nil
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("IP not deleted: %w", ctx.Err())
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return errors.New("Timeout reached, IP not deleted")
+			}
+			log.Tracef("Type: %s, Object: %v\n", event.Type, event.Object)
+			existingIpamIP, ok := event.Object.(*ipamv1alpha1.IP)
+			if ok && event.Type == watch.Deleted && existingIpamIP.Name == resourceName &&
+				reflect.DeepEqual(ipamIP.Spec, existingIpamIP.Spec) {
+				log.Infof("IP %s/%s deleted", existingIpamIP.Namespace, existingIpamIP.Name)
+				return nil
+			}
 		}
 	}
-	return errors.New("Timeout reached, IP not deleted")
 }
 
-func (k K8sClient) waitForCreation(ipamIP *ipamv1alpha1.IP) (*ipamv1alpha1.IP, error) {
+func (k K8sClient) waitForCreation(ctx context.Context, ipamIP *ipamv1alpha1.IP) (*ipamv1alpha1.IP, error) {
 	// Define the namespace and resource name (if you want to watch a specific resource)
 	namespace := ipamIP.Namespace
 	resourceName := ipamIP.Name
-	fieldSelector := "metadata.name=" + resourceName + ",metadata.namespace=" + namespace
 	timeout := int64(10)
 
 	// watch for creation finished event
-	watcher, err := k.Clientset.IpamV1alpha1().IPs(namespace).Watch(context.TODO(), metav1.ListOptions{
-		FieldSelector:  fieldSelector,
-		TimeoutSeconds: &timeout,
-	})
+	watcher, err := k.Watcher.Watch(ctx, &ipamv1alpha1.IPList{}, client.InNamespace(namespace),
+		client.MatchingFields{"metadata.name": resourceName}, &client.ListOptions{Raw: &metav1.ListOptions{TimeoutSeconds: &timeout}})
 	if err != nil {
-		log.Errorf("Error watching for IP: %v", err)
+		return nil, fmt.Errorf("error watching for IP: %w", fedhcperrors.FromK8s(err))
 	}
+	defer watcher.Stop()
 
 	log.Tracef("Watching for changes to IP %s/%s...", namespace, resourceName)
 
-	for event := range watcher.ResultChan() {
+	for {
+		var event watch.Event
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("IP not created: %w", ctx.Err())
+		case event, ok = <-watcher.ResultChan():
+			if !ok {
+				return nil, errors.New("Timeout reached, IP not created")
+			}
+		}
 		log.Tracef("Type: %s, Object: %v\n", event.Type, event.Object)
-		createdIpamIP := event.Object.(*ipamv1alpha1.IP)
-		if event.Type == watch.Added || event.Type == watch.Modified {
+		createdIpamIP, ok := event.Object.(*ipamv1alpha1.IP)
+		if ok && createdIpamIP.Name == resourceName && (event.Type == watch.Added || event.Type == watch.Modified) {
 			if createdIpamIP.Status.State == ipamv1alpha1.CFinishedIPState {
 				log.Debug("IP creation finished")
 				return createdIpamIP, nil
 			} else if createdIpamIP.Status.State == ipamv1alpha1.CProcessingIPState {
 				continue
 			} else if createdIpamIP.Status.State == ipamv1alpha1.CFailedIPState {
-				return nil, errors.New("Failed to create IP address")
+				return nil, &fedhcperrors.AllocationExhausted{
+					Subnet: createdIpamIP.Spec.Subnet.Name,
+					Err:    errors.New("Failed to create IP address"),
+				}
 			}
 		}
 	}
-	return nil, errors.New("Timeout reached, IP not created")
 }
 
-func (k K8sClient) getOOBNetworks(subnetType ipamv1alpha1.SubnetAddressType) []string {
-	timeout := int64(5)
-
-	subnetList, err := k.Clientset.IpamV1alpha1().Subnets(k.Namespace).List(context.TODO(), metav1.ListOptions{
-		LabelSelector:  k.OobLabel,
-		TimeoutSeconds: &timeout,
-	})
+// getOOBNetworks returns the names of the OOB subnets of the address type.
+func (k K8sClient) getOOBNetworks(ctx context.Context, subnetType ipamv1alpha1.SubnetAddressType) ([]string, error) {
+	subnetList, err := k.Subnets.List(ctx)
 	if err != nil {
-		log.Errorf("Error listing OOB subnets: %v", err)
+		return nil, fmt.Errorf("error listing OOB subnets: %w", err)
 	}
 
 	oobSubnetNames := []string{}
-	for _, subnet := range subnetList.Items {
+	for _, subnet := range subnetList {
 		if subnet.Status.Type == subnetType {
 			oobSubnetNames = append(oobSubnetNames, subnet.Name)
 		}
 	}
 
-	return oobSubnetNames
+	return oobSubnetNames, nil
 }
 
-func (k K8sClient) getMatchingSubnet(subnetName string, ipaddr net.IP) (*ipamv1alpha1.Subnet, error) {
-	subnet := &ipamv1alpha1.Subnet{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      subnetName,
-			Namespace: k.Namespace,
-		},
-	}
-	existingSubnet := subnet.DeepCopy()
-	err := k.Client.Get(k.Ctx, client.ObjectKeyFromObject(subnet), existingSubnet)
-	if err != nil && !apierrors.IsNotFound(err) {
-		return nil, fmt.Errorf("failed to get subnet %s/%s: %w", k.Namespace, subnetName, err)
-	}
-	if apierrors.IsNotFound(err) {
-		log.Debugf("Cannot select subnet %s/%s, does not exist", k.Namespace, subnetName)
-		return nil, nil
-	}
-	if !checkIPInCIDR(ipaddr, existingSubnet.Status.Reserved.String()) && ipaddr.String() != UNKNOWN_IP {
-		log.Debugf("Cannot select subnet %s/%s, CIDR mismatch", k.Namespace, subnetName)
-		return nil, nil
-	}
-
-	return subnet, nil
+// withSubnetLabels adds the subnet labels to the labels of an IP.
+func (k K8sClient) withSubnetLabels(ipLabels map[string]string) map[string]string {
+	maps.Copy(ipLabels, k.OobLabels)
+	return ipLabels
 }
 
-func (k K8sClient) applySubnetLabel(ipamIP *ipamv1alpha1.IP) {
-	oobLabelKey := strings.Split(k.OobLabel, "=")[0]
-	oobLabelValue := strings.Split(k.OobLabel, "=")[1]
-
+func (k K8sClient) applySubnetLabel(ctx context.Context, ipamIP *ipamv1alpha1.IP) {
 	log.Debugf("Current labels: %v", ipamIP.Labels)
 
-	_, exists := ipamIP.Labels[oobLabelKey]
-	if exists && ipamIP.Labels[oobLabelKey] == oobLabelValue {
-		log.Debug("Subnet label up-to-date")
-	} else {
-		if !exists {
-			ipamIP, err := k.Clientset.IpamV1alpha1().IPs(ipamIP.Namespace).Get(context.TODO(), ipamIP.Name, metav1.GetOptions{})
-			if err != nil {
-				log.Errorf("Error applying subnet label to IPAM IP %s: %v\n", ipamIP.Name, err)
-			} else {
-				if ipamIP.Labels == nil {
-					ipamIP.Labels = make(map[string]string)
-				}
-			}
-		}
+	if labels.SelectorFromSet(k.OobLabels).Matches(labels.Set(ipamIP.Labels)) {
+		log.Debug("Subnet labels up-to-date")
+		return
+	}
 
-		ipamIP.Labels[oobLabelKey] = oobLabelValue
-		_, err := k.Clientset.IpamV1alpha1().IPs(ipamIP.Namespace).Update(context.TODO(), ipamIP, metav1.UpdateOptions{})
-		if err != nil {
-			log.Errorf("Error applying label to IPAM IP %s: %v\n", ipamIP.Name, err)
-		} else {
-			log.Debugf("Subnet label applied to IPAM IP %s\n", ipamIP.Name)
-		}
+	if ipamIP.Labels == nil {
+		ipamIP.Labels = make(map[string]string, len(k.OobLabels))
+	}
+	maps.Copy(ipamIP.Labels, k.OobLabels)
+	err := k.Client.Update(ctx, ipamIP)
+	if err != nil {
+		log.Errorf("Error applying label to IPAM IP %s: %v\n", ipamIP.Name, err)
+	} else {
+		log.Debugf("Subnet label applied to IPAM IP %s\n", ipamIP.Name)
 	}
 }
 
@@ -417,16 +646,4 @@ func prettyFormat(ipSpec interface{}) string {
 	return string(jsonBytes)
 }
 
-func checkIPInCIDR(ip net.IP, cidrStr string) bool {
-	// Parse the CIDR string
-	_, cidrNet, err := net.ParseCIDR(cidrStr)
-	if err != nil {
-		log.Errorf("Error parsing CIDR: %v\n", err)
-		return false
-	}
-
-	// Check if the CIDR contains the IP
-	return cidrNet.Contains(ip)
-}
-
 func noop() {}
@@ -0,0 +1,152 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package oob
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes/fake"
+	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// newReplica returns a client of the oob subnet on the client of the server,
+// and a channel receiving a value whenever it starts watching an IP.
+func newReplica(t *testing.T) (*K8sClient, <-chan struct{}) {
+	k, err := NewK8sClient("oob/test", "oob", labels.SelectorFromSet(labels.Set{"subnet": "dhcp"}), map[string]string{"subnet": "dhcp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	watching := make(chan struct{}, 1)
+	k.Watcher = interceptor.NewClient(k.Watcher, interceptor.Funcs{
+		Watch: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) (watch.Interface, error) {
+			defer func() { watching <- struct{}{} }()
+			return c.Watch(ctx, list, opts...)
+		},
+	})
+	return k, watching
+}
+
+// reserveIP reserves the address for the IP of the name, like IPAM does.
+func reserveIP(t *testing.T, cl client.Client, name string, addr net.IP) {
+	reserved, _ := ipamv1alpha1.IPAddrFromString(addr.String())
+	ipamIP := &ipamv1alpha1.IP{}
+	if err := cl.Get(context.Background(), client.ObjectKey{Namespace: "oob", Name: name}, ipamIP); err != nil {
+		t.Error(err)
+		return
+	}
+	ipamIP.Status = ipamv1alpha1.IPStatus{State: ipamv1alpha1.CFinishedIPState, Reserved: reserved}
+	if err := cl.Status().Update(context.Background(), ipamIP); err != nil {
+		t.Error(err)
+	}
+}
+
+func newServerClient() client.Client {
+	var cl client.Client = fake.NewClient(fake.NewIPAM("oob").WithSubnet("oob", "192.168.2.0/24", map[string]string{"subnet": "dhcp"}))
+	kubernetes.SetClient(&cl)
+	return cl
+}
+
+// the IPs are created and watched with the clients of the server, so they are
+// in-memory or dry-run when simulating
+func TestK8sClientUsesServerClient(t *testing.T) {
+	cl := newServerClient()
+
+	// IPAM reserves the address in the client of the server once the IP is
+	// created and watched
+	k, watching := newReplica(t)
+	macKey := strings.ReplaceAll(clientMAC.String(), ":", "")
+	go func() {
+		<-watching
+		reserveIP(t, cl, ipName(macKey, "oob"), expectedLeaseIPv4)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ipamIP, err := k.doCreateIpamIP(ctx, "oob", macKey, NoHint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ipamIP.Status.Reserved == nil || ipamIP.Status.Reserved.String() != expectedLeaseIPv4.String() {
+		t.Errorf("expected %s to be reserved, got %v", expectedLeaseIPv4, ipamIP.Status.Reserved)
+	}
+}
+
+// two replicas serving the same client at once create a single IP and hand
+// out the same address
+func TestCreateIpamIPTwoReplicas(t *testing.T) {
+	cl := newServerClient()
+	first, firstWatching := newReplica(t)
+	second, secondWatching := newReplica(t)
+	macKey := strings.ReplaceAll(clientMAC.String(), ":", "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	results := make(chan *ipamv1alpha1.IP, 2)
+	create := func(k *K8sClient) {
+		ipamIP, err := k.doCreateIpamIP(ctx, "oob", macKey, NoHint())
+		if err != nil {
+			t.Error(err)
+		}
+		results <- ipamIP
+	}
+
+	// the second replica finds the IP created, but not yet reserved, by the first
+	go create(first)
+	<-firstWatching
+	go create(second)
+	<-secondWatching
+	reserveIP(t, cl, ipName(macKey, "oob"), expectedLeaseIPv4)
+
+	for range 2 {
+		ipamIP := <-results
+		if ipamIP == nil || ipamIP.Status.Reserved == nil || ipamIP.Status.Reserved.String() != expectedLeaseIPv4.String() {
+			t.Errorf("expected both replicas to hand out %s, got %v", expectedLeaseIPv4, ipamIP)
+		}
+	}
+	ips := &ipamv1alpha1.IPList{}
+	if err := cl.List(ctx, ips, client.InNamespace("oob"), client.MatchingLabels{"mac": macKey}); err != nil {
+		t.Fatal(err)
+	}
+	if len(ips.Items) != 1 {
+		t.Errorf("expected a single IP of %s, got %d", clientMAC, len(ips.Items))
+	}
+}
+
+// an IP of the same name is only handed out if it was created by FeDHCP for
+// the same MAC address
+func TestCreateIpamIPForeignOwner(t *testing.T) {
+	macKey := strings.ReplaceAll(clientMAC.String(), ":", "")
+	for _, foreign := range []map[string]string{
+		{"mac": "001a2b3c4d5f", "origin": origin},
+		{"mac": macKey},
+	} {
+		cl := newServerClient()
+		reserved, _ := ipamv1alpha1.IPAddrFromString(expectedLeaseIPv4.String())
+		if err := cl.Create(context.Background(), &ipamv1alpha1.IP{
+			ObjectMeta: metav1.ObjectMeta{Name: ipName(macKey, "oob"), Namespace: "oob", Labels: foreign},
+			Spec:       ipamv1alpha1.IPSpec{Subnet: corev1.LocalObjectReference{Name: "oob"}},
+			Status:     ipamv1alpha1.IPStatus{State: ipamv1alpha1.CFinishedIPState, Reserved: reserved},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		k, _ := newReplica(t)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if ipamIP, err := k.doCreateIpamIP(ctx, "oob", macKey, NoHint()); err == nil {
+			t.Errorf("expected the IP labeled %v not to be handed out, got %v", foreign, ipamIP.Status.Reserved)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package oob
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+)
+
+// defaultAllocate are the DHCPv4 message types an address is leased for unless
+// configured.
+var defaultAllocate = []dhcpv4.MessageType{dhcpv4.MessageTypeDiscover, dhcpv4.MessageTypeRequest}
+
+// clientMessageTypes are the DHCPv4 message types sent by clients, by name.
+var clientMessageTypes = map[string]dhcpv4.MessageType{
+	"DISCOVER": dhcpv4.MessageTypeDiscover,
+	"REQUEST":  dhcpv4.MessageTypeRequest,
+	"DECLINE":  dhcpv4.MessageTypeDecline,
+	"RELEASE":  dhcpv4.MessageTypeRelease,
+	"INFORM":   dhcpv4.MessageTypeInform,
+}
+
+// messageAction is what the plugin does with a DHCPv4 message of a type.
+type messageAction int
+
+const (
+	// actionPass passes the message on to the next plugins untouched
+	actionPass messageAction = iota
+	// actionAllocate leases an address
+	actionAllocate
+	// actionIgnore drops the message without a response
+	actionIgnore
+)
+
+// messageFilter decides by the message type whether a DHCPv4 message is
+// leased for, ignored or passed on.
+type messageFilter map[dhcpv4.MessageType]messageAction
+
+// parseMessageTypes returns the filter of the configured message types. The
+// names are case-insensitive, a type must not be both allocated for and ignored.
+func parseMessageTypes(c api.OOBMessageTypes) (messageFilter, error) {
+	filter := make(messageFilter)
+	if len(c.Allocate) == 0 {
+		for _, t := range defaultAllocate {
+			filter[t] = actionAllocate
+		}
+	}
+	for _, list := range []struct {
+		names  []string
+		action messageAction
+	}{{c.Allocate, actionAllocate}, {c.Ignore, actionIgnore}} {
+		for _, name := range list.names {
+			t, ok := clientMessageTypes[strings.ToUpper(name)]
+			if !ok {
+				return nil, fmt.Errorf("invalid DHCPv4 message type %s, should be one of DISCOVER, REQUEST, DECLINE, RELEASE and INFORM", name)
+			}
+			if action, ok := filter[t]; ok && action != list.action {
+				return nil, fmt.Errorf("DHCPv4 message type %s is both allocated for and ignored", t)
+			}
+			filter[t] = list.action
+		}
+	}
+	return filter, nil
+}
+
+// action returns what to do with a message of the type, messages of types
+// not configured are passed on.
+func (f messageFilter) action(t dhcpv4.MessageType) messageAction {
+	return f[t]
+}
@@ -0,0 +1,193 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package oob
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/rfc1035label"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/leasetimes"
+)
+
+// Subnet annotations overriding the options of the addresses leased from the subnet.
+const (
+	// dnsAnnotation holds comma separated DNS servers of both address families
+	dnsAnnotation = "fedhcp.ironcore.dev/dns"
+	// gatewayAnnotation holds the DHCPv4 router
+	gatewayAnnotation = "fedhcp.ironcore.dev/gateway"
+	// bootfileAnnotation holds the DHCPv4 boot file name or the DHCPv6 boot file URL
+	bootfileAnnotation = "fedhcp.ironcore.dev/bootfile"
+)
+
+// Subnet annotations overriding the configured lease times, holding durations like "12h".
+const (
+	leaseTimeAnnotation         = "fedhcp.ironcore.dev/lease-time"
+	preferredLifetimeAnnotation = "fedhcp.ironcore.dev/preferred-lifetime"
+	t1Annotation                = "fedhcp.ironcore.dev/t1"
+	t2Annotation                = "fedhcp.ironcore.dev/t2"
+)
+
+// subnetOptions are the options taken from the annotations of a subnet.
+type subnetOptions struct {
+	dns4     []net.IP
+	dns6     []net.IP
+	gateway  net.IP
+	bootfile string
+}
+
+// subnetOptions parses the option annotations of the subnet the address is
+// leased from. Invalid values are logged and skipped.
+func (p *plugin) subnetOptions(l *lease) subnetOptions {
+	var opts subnetOptions
+	if dns, ok := l.subnetAnnotations[dnsAnnotation]; ok {
+		for _, server := range strings.Split(dns, ",") {
+			ip := net.ParseIP(strings.TrimSpace(server))
+			switch {
+			case ip == nil:
+				p.log.Warningf("Ignoring invalid DNS server %q of subnet annotation %s", server, dnsAnnotation)
+			case ip.To4() != nil:
+				opts.dns4 = append(opts.dns4, ip)
+			default:
+				opts.dns6 = append(opts.dns6, ip)
+			}
+		}
+	}
+	if gateway, ok := l.subnetAnnotations[gatewayAnnotation]; ok {
+		if ip := net.ParseIP(strings.TrimSpace(gateway)); ip != nil && ip.To4() != nil {
+			opts.gateway = ip
+		} else {
+			p.log.Warningf("Ignoring invalid gateway %q of subnet annotation %s", gateway, gatewayAnnotation)
+		}
+	}
+	opts.bootfile = strings.TrimSpace(l.subnetAnnotations[bootfileAnnotation])
+	return opts
+}
+
+// subnetLeaseTimes returns the lease times of the subnet the address is leased
+// from, the annotations of the subnet take precedence over the configured lease
+// times. Invalid values are logged and skipped, lease times that are
+// inconsistent once overridden are ignored altogether. It reports false if
+// neither annotations nor lease times are configured.
+func (p *plugin) subnetLeaseTimes(l *lease) (api.LeaseTimes, bool) {
+	var times api.LeaseTimes
+	configured := p.leaseTimes != nil
+	if configured {
+		times = *p.leaseTimes
+	}
+
+	annotated := false
+	for _, a := range []struct {
+		annotation string
+		value      *time.Duration
+	}{
+		{leaseTimeAnnotation, &times.LeaseTime},
+		{preferredLifetimeAnnotation, &times.PreferredLifetime},
+		{t1Annotation, &times.T1},
+		{t2Annotation, &times.T2},
+	} {
+		value, ok := l.subnetAnnotations[a.annotation]
+		if !ok {
+			continue
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || d <= 0 {
+			p.log.Warningf("Ignoring invalid duration %q of subnet annotation %s", value, a.annotation)
+			continue
+		}
+		*a.value = d
+		annotated = true
+	}
+	if !annotated {
+		return times, configured
+	}
+
+	if err := leasetimes.Validate(times); err != nil {
+		p.log.Warningf("Ignoring lease times of subnet annotations: %v", err)
+		if configured {
+			return *p.leaseTimes, true
+		}
+		return api.LeaseTimes{}, false
+	}
+	return times, true
+}
+
+func (opts subnetOptions) apply4(req, resp *dhcpv4.DHCPv4) {
+	if len(opts.dns4) > 0 && req.IsOptionRequested(dhcpv4.OptionDomainNameServer) {
+		resp.UpdateOption(dhcpv4.OptDNS(opts.dns4...))
+	}
+	if opts.gateway != nil {
+		resp.UpdateOption(dhcpv4.OptRouter(opts.gateway))
+	}
+	if opts.bootfile != "" {
+		resp.BootFileName = opts.bootfile
+		resp.UpdateOption(dhcpv4.OptBootFileName(opts.bootfile))
+	}
+}
+
+func (opts subnetOptions) apply6(req *dhcpv6.Message, resp dhcpv6.DHCPv6) {
+	if len(opts.dns6) > 0 && req.IsOptionRequested(dhcpv6.OptionDNSRecursiveNameServer) {
+		resp.UpdateOption(dhcpv6.OptDNS(opts.dns6...))
+	}
+	if opts.bootfile != "" && req.IsOptionRequested(dhcpv6.OptionBootfileURL) {
+		resp.UpdateOption(dhcpv6.OptBootFileURL(opts.bootfile))
+	}
+}
+
+// dnsGroup are the DHCPv6 DNS options of the subnets carrying all of the labels.
+type dnsGroup struct {
+	subnetLabels map[string]string
+	servers      []net.IP
+	searchList   []string
+}
+
+func parseDNS(config []api.OOBDNS) ([]dnsGroup, error) {
+	var groups []dnsGroup
+	for _, c := range config {
+		group := dnsGroup{subnetLabels: c.SubnetLabels, searchList: c.SearchList}
+		for _, server := range c.Servers {
+			ip := net.ParseIP(server)
+			if ip == nil || ip.To4() != nil {
+				return nil, fmt.Errorf("invalid IPv6 DNS server %q", server)
+			}
+			group.servers = append(group.servers, ip)
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// matchDNS returns the first DNS group matching the labels of the subnet leased from.
+func (p *plugin) matchDNS(l *lease) *dnsGroup {
+	for i, group := range p.dns {
+		matches := true
+		for key, value := range group.subnetLabels {
+			if l.subnetLabels[key] != value {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return &p.dns[i]
+		}
+	}
+	return nil
+}
+
+func (group *dnsGroup) apply6(req *dhcpv6.Message, resp dhcpv6.DHCPv6) {
+	if group == nil {
+		return
+	}
+	if len(group.servers) > 0 && req.IsOptionRequested(dhcpv6.OptionDNSRecursiveNameServer) {
+		resp.UpdateOption(dhcpv6.OptDNS(group.servers...))
+	}
+	if len(group.searchList) > 0 && req.IsOptionRequested(dhcpv6.OptionDomainSearchList) {
+		resp.UpdateOption(dhcpv6.OptDomainSearchList(&rfc1035label.Labels{Labels: group.searchList}))
+	}
+}
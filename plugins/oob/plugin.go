@@ -4,14 +4,26 @@
 package oob
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
-	"os"
-	"strings"
 	"time"
 
+	"github.com/ironcore-dev/fedhcp/internal/allocation"
 	"github.com/ironcore-dev/fedhcp/internal/api"
-	"gopkg.in/yaml.v3"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/funnel"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/ironcore-dev/fedhcp/internal/leasetimes"
+	"github.com/ironcore-dev/fedhcp/internal/links"
+	"github.com/ironcore-dev/fedhcp/internal/metrics"
+	"github.com/ironcore-dev/fedhcp/internal/printer"
+	"github.com/ironcore-dev/fedhcp/internal/relay"
+	"github.com/ironcore-dev/fedhcp/internal/segment"
+	"github.com/ironcore-dev/fedhcp/internal/tempaddr"
+	"github.com/sirupsen/logrus"
 
 	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
 
@@ -20,8 +32,7 @@ import (
 	"github.com/coredhcp/coredhcp/plugins"
 	"github.com/insomniacslk/dhcp/dhcpv4"
 	"github.com/insomniacslk/dhcp/dhcpv6"
-
-	"github.com/mdlayher/netx/eui64"
+	"github.com/insomniacslk/dhcp/iana"
 )
 
 var log = logger.GetLogger("plugins/oob")
@@ -32,13 +43,61 @@ var Plugin = plugins.Plugin{
 	Setup6: setup6,
 }
 
-var (
-	k8sClient *K8sClient
-)
+// plugin holds the state of a single oob plugin instance. It is built once
+// in setup and never modified afterwards.
+type plugin struct {
+	k8sClient ipLeaser
+	// interfaceIP resolves the address of the serving interface, it is nil
+	// unless an interface is configured and directly attached clients are served.
+	interfaceIP func(ipv6 bool) (net.IP, error)
+	// temporaryAddresses enables leasing of IA_TA with the given lifetimes,
+	// temporaryPersist additionally reserves them in IPAM
+	temporaryAddresses bool
+	temporaryPersist   bool
+	temporaryPreferred time.Duration
+	temporaryValid     time.Duration
+	// temporaryLeases are the temporary addresses handed out, unless they are
+	// reserved in IPAM
+	temporaryLeases *tempaddr.Leases
+	// authoritative answers DHCPv4 Requests of unrecognized addresses with a NAK
+	authoritative bool
+	// messageTypes decide which DHCPv4 messages are leased for
+	messageTypes messageFilter
+	// serverUnicast is advertised in the Server Unicast option, clients then
+	// renew by unicast; nil if disabled
+	serverUnicast net.IP
+	// dns are the DHCPv6 DNS options per subnet labels
+	dns []dnsGroup
+	// leaseTimes are the defaults for subnets without lease time annotations,
+	// see subnetLeaseTimes
+	leaseTimes *api.LeaseTimes
+	// timeout bounds the kubernetes calls of a request
+	timeout time.Duration
+	log     *logrus.Entry
+}
 
-const (
-	UNKNOWN_IP = "0.0.0.0"
-)
+// lease is an IP address leased from an IPAM subnet.
+type lease struct {
+	ip net.IP
+	// subnet is the name of the subnet leased from
+	subnet string
+	// subnetAnnotations are the annotations of the subnet, see subnetOptions
+	// and subnetLeaseTimes
+	subnetAnnotations map[string]string
+	// subnetLabels are the labels of the subnet, see matchDNS
+	subnetLabels map[string]string
+}
+
+// ipLeaser leases an IP address for a MAC address from the subnet ipaddr belongs to.
+type ipLeaser interface {
+	getIp(ctx context.Context, hint AddressHint, mac net.HardwareAddr, subnetType ipamv1alpha1.SubnetAddressType) (*lease, error)
+	// reserveTemporaryIp reserves a temporary address for the MAC address until expires
+	reserveTemporaryIp(ctx context.Context, ipaddr net.IP, mac net.HardwareAddr, expires time.Time) error
+	// temporaryReserved returns whether a temporary address is reserved for the MAC address
+	temporaryReserved(ctx context.Context, ipaddr net.IP, mac net.HardwareAddr, now time.Time) (bool, error)
+	// releaseTemporaryIps releases temporary addresses of the MAC address
+	releaseTemporaryIps(ctx context.Context, mac net.HardwareAddr, addrs []net.IP) error
+}
 
 // args[0] = path to config file
 func parseArgs(args ...string) (string, error) {
@@ -51,78 +110,226 @@ func parseArgs(args ...string) (string, error) {
 func loadConfig(args ...string) (*api.OOBConfig, error) {
 	path, err := parseArgs(args...)
 	if err != nil {
-		return nil, fmt.Errorf("invalid configuration: %v", err)
+		return nil, &fedhcperrors.ConfigError{Err: err}
 	}
 
 	log.Debugf("Reading ipam config file %s", path)
-	configData, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %v", err)
-	}
-
 	config := &api.OOBConfig{}
-	if err = yaml.Unmarshal(configData, config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %v", err)
+	if err := api.Load(path, config); err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+	if config.LeaseTimes != nil {
+		if err := leasetimes.Validate(*config.LeaseTimes); err != nil {
+			return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("leaseTimes: %w", err)}
+		}
 	}
 
-	// TODO remove after https://github.com/ironcore-dev/FeDHCP/issues/221 is implemented
-	if !strings.Contains(config.SubnetLabel, "=") {
-		return nil, fmt.Errorf("invalid subnet label: %s, should be 'key=value'", config.SubnetLabel)
+	if _, _, err := subnetSelector(config); err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+	if _, err := parseMessageTypes(config.MessageTypes); err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+	if config.Timeout < 0 {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("timeout must not be negative, got %s", config.Timeout)}
+	}
+	if config.Timeout == 0 {
+		config.Timeout = kubernetes.DefaultTimeout
+	}
+	if config.Reservations.Interval < 0 {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("reservation interval must not be negative, got %s", config.Reservations.Interval)}
+	}
+	if config.Reservations.Interval == 0 {
+		config.Reservations.Interval = DefaultReservationInterval
 	}
 	return config, nil
 }
 
+// interfaceResolver returns a lookup of the serving interface's address, or nil
+// if no interface is configured.
+func interfaceResolver(name string) func(ipv6 bool) (net.IP, error) {
+	if name == "" {
+		return nil
+	}
+	return func(ipv6 bool) (net.IP, error) {
+		return interfaceIP(name, ipv6)
+	}
+}
+
 func setup6(args ...string) (handler.Handler6, error) {
 	oobConfig, err := loadConfig(args...)
 	if err != nil {
-		return nil, fmt.Errorf("invalid configuration: %v", err)
+		return nil, err
+	}
+
+	linker, err := links.New(oobConfig.Links)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("links: %w", err)}
 	}
 
-	k8sClient, err = NewK8sClient(oobConfig.Namespace, oobConfig.SubnetLabel)
+	selector, ipLabels, err := subnetSelector(oobConfig)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	name := instance.Next("oob/v6")
+	k8sClient, err := NewK8sClient(name, oobConfig.Namespace, selector, ipLabels)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create k8s client: %w", err)
 	}
+	k8sClient.Links = linker
 
-	log.Print("Loaded oob plugin for DHCPv6.")
-	return handler6, nil
+	temporaryPreferred, temporaryValid, err := tempaddr.Lifetimes(oobConfig.TemporaryAddresses)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+	dns, err := parseDNS(oobConfig.DNS)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+	serverUnicast, err := parseServerUnicast(oobConfig.ServerUnicast)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	p := &plugin{
+		k8sClient:          k8sClient,
+		interfaceIP:        interfaceResolver(oobConfig.Interface),
+		temporaryAddresses: oobConfig.TemporaryAddresses.Enabled,
+		temporaryPersist:   oobConfig.TemporaryAddresses.Persist,
+		temporaryPreferred: temporaryPreferred,
+		temporaryValid:     temporaryValid,
+		temporaryLeases:    tempaddr.NewLeases(),
+		serverUnicast:      serverUnicast,
+		dns:                dns,
+		leaseTimes:         oobConfig.LeaseTimes,
+		timeout:            oobConfig.Timeout,
+		log:                log.WithField("instance", name),
+	}
+	if err := reserve(oobConfig, k8sClient, true, name, p.log); err != nil {
+		return nil, err
+	}
+	if p.temporaryAddresses && p.temporaryPersist {
+		go collectTemporary(k8sClient.Ctx, k8sClient, p.temporaryPreferred, p.temporaryValid, p.log)
+	}
+	p.log.Print("Loaded oob plugin for DHCPv6.")
+	return p.handler6, nil
 }
 
-func handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
-	log.Debugf("received DHCPv6 packet: %s", req.Summary())
+func (p *plugin) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	printer.VerboseRequest(p.log, req)
 
-	if !req.IsRelay() {
-		log.Printf("Received non-relay DHCPv6 request. Dropping.")
+	m, err := req.GetInnerMessage()
+	if err != nil {
+		p.log.Errorf("BUG: could not decapsulate: %v", err)
 		return nil, true
 	}
 
-	relayMsg := req.(*dhcpv6.RelayMessage)
+	var ipaddr net.IP
+	var mac net.HardwareAddr
+	var hint AddressHint
+	if req.IsRelay() {
+		relayMsg := req.(*dhcpv6.RelayMessage)
+
+		mac, err = relay.ClientMAC(req)
+		if err != nil {
+			p.log.Errorf("Could not determine client MAC address: %s", err)
+			return nil, true
+		}
+
+		ipaddr = make(net.IP, len(relayMsg.LinkAddr))
+		copy(ipaddr, relayMsg.LinkAddr)
+		hint = SubnetHint(ipaddr)
+		p.log.Infof("Requested IP address from relay %s for mac %s", ipaddr.String(), mac.String())
+	} else if addr := unicastAddress(m); p.serverUnicast != nil && addr != nil {
+		mac, err = macFromDUID(m.Options.ClientID())
+		if err != nil {
+			p.log.Errorf("Could not determine MAC address of unicasting client: %s", err)
+			return nil, true
+		}
+
+		ipaddr, hint = addr, ExactHint(addr)
+		p.log.Infof("Requested IP address %s by unicast for mac %s", ipaddr.String(), mac.String())
+	} else {
+		if p.interfaceIP == nil {
+			p.log.Printf("Received non-relay DHCPv6 request. Dropping.")
+			return nil, true
+		}
+
+		mac, err = macFromDUID(m.Options.ClientID())
+		if err != nil {
+			p.log.Errorf("Could not determine MAC address of directly attached client: %s", err)
+			return nil, true
+		}
+
+		ipaddr, err = p.interfaceIP(true)
+		if err != nil {
+			p.log.Errorf("Could not determine subnet of directly attached client: %s", err)
+			return nil, true
+		}
+		hint = SubnetHint(ipaddr)
+		p.log.Infof("Requested IP address for directly attached mac %s on %s", mac.String(), ipaddr.String())
+	}
 
-	// Retrieve IPv6 prefix and MAC address from IPv6 address
-	_, mac, err := eui64.ParseIP(relayMsg.PeerAddr)
-	if err != nil {
-		log.Errorf("Could not parse peer address: %s", err)
-		return nil, true
+	if m.Type() == dhcpv6.MessageTypeRelease || m.Type() == dhcpv6.MessageTypeDecline {
+		p.releaseTemporary(m, mac)
+	}
+	if m.Type() == dhcpv6.MessageTypeRelease {
+		// IPs are kept on release, so the client gets the same address again
+		resp.AddOption(&dhcpv6.OptStatusCode{StatusCode: iana.StatusSuccess, StatusMessage: "released"})
+		return resp, false
 	}
 
-	ipaddr := make(net.IP, len(relayMsg.LinkAddr))
-	copy(ipaddr, relayMsg.LinkAddr)
+	if m.Type() == dhcpv6.MessageTypeSolicit {
+		allocation.Start(mac)
+	}
 
-	log.Infof("Requested IP address from relay %s for mac %s", ipaddr.String(), mac.String())
-	leaseIP, err := k8sClient.getIp(ipaddr, mac, false, ipamv1alpha1.CIPv6SubnetType)
+	ctx, cancel := p.requestContext()
+	defer cancel()
+	release, err := segment.Acquire(ctx, segment.Of6(req))
 	if err != nil {
-		log.Errorf("Could not get IPAM IP: %s", err)
+		p.log.Errorf("Could not acquire write slot: %s", err)
 		return nil, true
 	}
+	defer release()
 
-	var m *dhcpv6.Message
-	m, err = req.GetInnerMessage()
+	l, err := p.k8sClient.getIp(ctx, hint, mac, ipamv1alpha1.CIPv6SubnetType)
 	if err != nil {
-		log.Errorf("BUG: could not decapsulate: %v", err)
+		p.log.WithFields(fedhcperrors.Fields(err)).Errorf("Could not get IPAM IP: %s", err)
 		return nil, true
 	}
+	if p.serverUnicast != nil {
+		resp.UpdateOption(serverUnicastOption(p.serverUnicast))
+	}
+	funnel.Record(funnel.IPAllocated, mac)
+	// subnet annotations take precedence over the configured DNS options
+	p.matchDNS(l).apply6(m, resp)
+	p.subnetOptions(l).apply6(m, resp)
+
+	// declined temporary addresses are released above and not replaced
+	if iata := m.Options.OneIATA(); iata != nil && p.temporaryAddresses && m.Type() != dhcpv6.MessageTypeDecline {
+		addr, err := tempaddr.Address(iata, ipaddr, func(addr net.IP) bool {
+			return p.temporaryHandedOut(ctx, addr, mac)
+		})
+		if err != nil {
+			p.log.Errorf("Could not generate temporary address: %v", err)
+			return nil, true
+		}
+		expires := time.Now().Add(p.temporaryValid)
+		if p.temporaryPersist {
+			if err := p.k8sClient.reserveTemporaryIp(ctx, addr, mac, expires); err != nil {
+				p.log.WithFields(fedhcperrors.Fields(err)).Errorf("Could not reserve temporary IPAM IP: %s", err)
+				return nil, true
+			}
+		} else {
+			p.temporaryLeases.Add(mac.String(), addr, expires, time.Now())
+		}
+		resp.AddOption(tempaddr.Option(iata, addr, p.temporaryPreferred, p.temporaryValid))
+		p.log.Infof("Added temporary address %s for mac %s", addr.String(), mac.String())
+	}
 
 	if m.Options.OneIANA() == nil {
-		log.Debug("No address requested")
+		p.log.Debug("No address requested")
 		return resp, false
 	}
 
@@ -130,14 +337,20 @@ func handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
 		IaId: m.Options.OneIANA().IaId,
 		Options: dhcpv6.IdentityOptions{Options: []dhcpv6.Option{
 			&dhcpv6.OptIAAddress{
-				IPv6Addr:          leaseIP,
+				IPv6Addr:          l.ip,
 				PreferredLifetime: 24 * time.Hour,
 				ValidLifetime:     24 * time.Hour,
 			},
 		}},
 	})
+	allocation.Done(mac, l.subnet)
+	if reply, ok := resp.(*dhcpv6.Message); ok {
+		if times, ok := p.subnetLeaseTimes(l); ok {
+			leasetimes.Apply6(reply, times)
+		}
+	}
 
-	log.Debugf("Sent DHCPv6 response: %s", resp.Summary())
+	printer.VerboseResponse(p.log, req, resp)
 
 	return resp, false
 }
@@ -145,60 +358,198 @@ func handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
 func setup4(args ...string) (handler.Handler4, error) {
 	oobConfig, err := loadConfig(args...)
 	if err != nil {
-		return nil, fmt.Errorf("invalid configuration: %v", err)
+		return nil, err
 	}
 
-	k8sClient, err = NewK8sClient(oobConfig.Namespace, oobConfig.SubnetLabel)
+	linker, err := links.New(oobConfig.Links)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create k8s client: %w", err)
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("links: %w", err)}
+	}
+
+	selector, ipLabels, err := subnetSelector(oobConfig)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	messageTypes, err := parseMessageTypes(oobConfig.MessageTypes)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
 	}
 
-	log.Print("Loaded oob plugin for DHCPv4.")
-	return handler4, nil
+	name := instance.Next("oob/v4")
+	k8sClient, err := NewK8sClient(name, oobConfig.Namespace, selector, ipLabels)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create k8s client: %w", err)
+	}
+	k8sClient.Links = linker
+
+	p := &plugin{
+		k8sClient:     k8sClient,
+		interfaceIP:   interfaceResolver(oobConfig.Interface),
+		authoritative: oobConfig.Authoritative,
+		messageTypes:  messageTypes,
+		leaseTimes:    oobConfig.LeaseTimes,
+		timeout:       oobConfig.Timeout,
+		log:           log.WithField("instance", name),
+	}
+	if err := reserve(oobConfig, k8sClient, false, name, p.log); err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded oob plugin for DHCPv4 (authoritative: %t).", p.authoritative)
+	return p.handler4, nil
 }
 
-func handler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+func (p *plugin) handler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
 	mac := req.ClientHWAddr
 
-	log.Debugf("received DHCPv4 packet: %s", req.Summary())
-	log.Tracef("Message type: %s", req.MessageType().String())
+	printer.VerboseRequest(p.log, req)
+	p.log.Tracef("Message type: %s", req.MessageType().String())
 
-	var ipaddr net.IP
-	var exactIP bool
+	switch p.messageTypes.action(req.MessageType()) {
+	case actionIgnore:
+		p.log.Debugf("Ignoring %s of %s", req.MessageType(), mac)
+		return nil, true
+	case actionPass:
+		p.log.Debugf("Not leasing for %s of %s, passing it on", req.MessageType(), mac)
+		return resp, false
+	}
+
+	var hint AddressHint
 
 	serverIP := resp.ServerIPAddr
 	clientIP := req.ClientIPAddr
 	requestedIP := dhcpv4.GetIP(dhcpv4.OptionRequestedIPAddress, req.Options)
-	if clientIP != nil {
+	if isSpecified(clientIP) {
 		// ack requested address
-		exactIP = true
-		ipaddr = clientIP
-		log.Debugf("IP client: %v", ipaddr)
-	} else if requestedIP != nil {
+		hint = ExactHint(clientIP)
+		p.log.Debugf("IP client: %v", clientIP)
+	} else if isSpecified(requestedIP) {
 		// ack requested address
-		exactIP = true
-		ipaddr = requestedIP
-		log.Debugf("IP client: %v", ipaddr)
-	} else if serverIP != nil {
+		hint = ExactHint(requestedIP)
+		p.log.Debugf("IP client: %v", requestedIP)
+	} else if !isSpecified(req.GatewayIPAddr) && p.interfaceIP != nil {
+		// directly attached client, use serving interface address for subnet detection
+		interfaceIP, err := p.interfaceIP(false)
+		if err != nil {
+			p.log.Errorf("Could not determine subnet of directly attached client: %s", err)
+			return nil, true
+		}
+		hint = SubnetHint(interfaceIP)
+		p.log.Debugf("IP interface: %v", interfaceIP)
+	} else if isSpecified(serverIP) {
 		// no client information, use server address for subnet detection
-		exactIP = false
-		ipaddr = serverIP
-		log.Debugf("IP server: %v", ipaddr)
+		hint = SubnetHint(serverIP)
+		p.log.Debugf("IP server: %v", serverIP)
 	} else {
-		ipaddr = net.ParseIP(UNKNOWN_IP)
-		exactIP = false
+		hint = NoHint()
 	}
 
-	log.Debugf("IP: %v", ipaddr)
-	leaseIP, err := k8sClient.getIp(ipaddr, mac, exactIP, ipamv1alpha1.CIPv4SubnetType)
+	p.log.Debugf("Address hint: %s", hint)
+	if req.MessageType() == dhcpv4.MessageTypeDiscover {
+		allocation.Start(mac)
+	}
+	ctx, cancel := p.requestContext()
+	defer cancel()
+	release, err := segment.Acquire(ctx, segment.Of4(req))
 	if err != nil {
-		log.Errorf("Could not get IPAM IP: %s", err)
+		p.log.Errorf("Could not acquire write slot: %s", err)
 		return nil, true
 	}
+	defer release()
 
-	resp.YourIPAddr = leaseIP
+	l, err := p.k8sClient.getIp(ctx, hint, mac, ipamv1alpha1.CIPv4SubnetType)
+	var noSubnetMatch *fedhcperrors.NoSubnetMatch
+	if p.authoritative && req.MessageType() == dhcpv4.MessageTypeRequest && errors.As(err, &noSubnetMatch) {
+		p.log.Infof("Sending NAK to %s, requested address %s is on none of the subnets", mac, hint.IP)
+		return nak(req, resp, "requested address is not on any subnet"), true
+	}
+	if err != nil {
+		p.log.WithFields(fedhcperrors.Fields(err)).Errorf("Could not get IPAM IP: %s", err)
+		return nil, true
+	}
+	if p.authoritative && req.MessageType() == dhcpv4.MessageTypeRequest && hint.Kind == HintExact && !l.ip.Equal(hint.IP) {
+		p.log.Infof("Sending NAK to %s, requested address %s differs from leased address %s", mac, hint.IP, l.ip)
+		return nak(req, resp, "requested address is not leased to the client"), true
+	}
 
-	log.Debugf("Sent DHCPv4 response: %s", resp.Summary())
+	resp.YourIPAddr = l.ip
+	funnel.Record(funnel.IPAllocated, mac)
+	allocation.Done(mac, l.subnet)
+	p.subnetOptions(l).apply4(req, resp)
+	if times, ok := p.subnetLeaseTimes(l); ok {
+		leasetimes.Apply4(resp, times)
+	}
+
+	printer.VerboseResponse(p.log, req, resp)
 
 	return resp, false
 }
+
+// reserve starts reserving the addresses of the configured critical clients of
+// the address family in the background, until the server shuts down.
+func reserve(config *api.OOBConfig, k8sClient *K8sClient, ipv6 bool, name string, log *logrus.Entry) error {
+	reservations, err := parseReservations(config.Reservations.Clients, ipv6)
+	if err != nil {
+		return &fedhcperrors.ConfigError{Err: err}
+	}
+	if len(reservations) == 0 {
+		return nil
+	}
+
+	subnetType := ipamv1alpha1.CIPv4SubnetType
+	if ipv6 {
+		subnetType = ipamv1alpha1.CIPv6SubnetType
+	}
+	metrics.Register(reservationDrifts)
+	r := &reserver{
+		leaser:       k8sClient,
+		lister:       k8sClient,
+		recorder:     k8sClient.EventRecorder,
+		subnetType:   subnetType,
+		reservations: reservations,
+		interval:     config.Reservations.Interval,
+		timeout:      config.Timeout,
+		instance:     name,
+		log:          log,
+	}
+	log.Infof("Reserving the addresses of %d critical clients", len(reservations))
+	go r.run(k8sClient.Ctx)
+	return nil
+}
+
+// requestContext returns the context of the kubernetes calls of a request, it
+// is cancelled once the timeout has passed or the server shuts down.
+func (p *plugin) requestContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(kubernetes.Context(), p.timeout)
+}
+
+// nak turns resp into a DHCPNAK, keeping only the options RFC 2131 Section 4.3.2
+// allows in it.
+func nak(req, resp *dhcpv4.DHCPv4, message string) *dhcpv4.DHCPv4 {
+	serverID := resp.Options.Get(dhcpv4.OptionServerIdentifier)
+	clientID := req.Options.Get(dhcpv4.OptionClientIdentifier)
+
+	resp.Options = dhcpv4.Options{}
+	resp.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeNak))
+	resp.UpdateOption(dhcpv4.OptMessage(message))
+	if serverID != nil {
+		resp.UpdateOption(dhcpv4.OptGeneric(dhcpv4.OptionServerIdentifier, serverID))
+	}
+	if clientID != nil {
+		resp.UpdateOption(dhcpv4.OptGeneric(dhcpv4.OptionClientIdentifier, clientID))
+	}
+	resp.YourIPAddr = net.IPv4zero
+	resp.ClientIPAddr = net.IPv4zero
+	resp.ServerIPAddr = net.IPv4zero
+	resp.BootFileName = ""
+	resp.ServerHostName = ""
+	if isSpecified(req.GatewayIPAddr) {
+		// let the relay agent broadcast the NAK, the client might be on another network
+		resp.SetBroadcast()
+	}
+	return resp
+}
+
+func isSpecified(ip net.IP) bool {
+	return ip != nil && !ip.IsUnspecified()
+}
@@ -0,0 +1,899 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package oob
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/ironcore-dev/fedhcp/internal/tempaddr"
+	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var (
+	expectedIAID      = [4]byte{1, 2, 3, 4}
+	clientMAC         = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+	clientLinkLocal   = net.ParseIP("fe80::21a:2bff:fe3c:4d5e")
+	relayLinkAddr     = net.ParseIP("2001:db8:1::1")
+	interfaceAddr     = net.ParseIP("2001:db8:2::1")
+	expectedLeaseIPv6 = net.ParseIP("2001:db8:2::100")
+	relayAddr4        = net.IPv4(192, 168, 1, 1)
+	interfaceAddr4    = net.IPv4(192, 168, 2, 1)
+	requestedIPv4     = net.IPv4(192, 168, 2, 50)
+	expectedLeaseIPv4 = net.IPv4(192, 168, 2, 100)
+)
+
+// fakeLeaser records the address hint and MAC address it is asked to lease
+// for and always hands out expectedLeaseIPv4 or expectedLeaseIPv6.
+type fakeLeaser struct {
+	// deadline and ctxErr are the ones of the context leased with
+	deadline  time.Time
+	ctxErr    error
+	hint      *AddressHint
+	mac       net.HardwareAddr
+	temporary []net.IP
+	err       error
+	// annotations and labels are the ones of the subnet leased from
+	annotations map[string]string
+	labels      map[string]string
+}
+
+func (f *fakeLeaser) getIp(ctx context.Context, hint AddressHint, mac net.HardwareAddr, subnetType ipamv1alpha1.SubnetAddressType) (*lease, error) {
+	f.deadline, _ = ctx.Deadline()
+	f.ctxErr = ctx.Err()
+	f.hint = &hint
+	f.mac = mac
+	if f.err != nil {
+		return nil, f.err
+	}
+	if subnetType == ipamv1alpha1.CIPv4SubnetType {
+		return &lease{ip: expectedLeaseIPv4, subnetAnnotations: f.annotations, subnetLabels: f.labels}, nil
+	}
+	return &lease{ip: expectedLeaseIPv6, subnetAnnotations: f.annotations, subnetLabels: f.labels}, nil
+}
+
+func (f *fakeLeaser) reserveTemporaryIp(_ context.Context, ipaddr net.IP, _ net.HardwareAddr, _ time.Time) error {
+	if !slices.ContainsFunc(f.temporary, ipaddr.Equal) {
+		f.temporary = append(f.temporary, ipaddr)
+	}
+	return nil
+}
+
+func (f *fakeLeaser) temporaryReserved(_ context.Context, ipaddr net.IP, _ net.HardwareAddr, _ time.Time) (bool, error) {
+	return slices.ContainsFunc(f.temporary, ipaddr.Equal), nil
+}
+
+func (f *fakeLeaser) releaseTemporaryIps(_ context.Context, _ net.HardwareAddr, addrs []net.IP) error {
+	f.temporary = slices.DeleteFunc(f.temporary, func(ip net.IP) bool {
+		return slices.ContainsFunc(addrs, ip.Equal)
+	})
+	return nil
+}
+
+func newPlugin(leaser ipLeaser, withInterface bool) *plugin {
+	messageTypes, _ := parseMessageTypes(api.OOBMessageTypes{})
+	p := &plugin{
+		k8sClient:       leaser,
+		messageTypes:    messageTypes,
+		temporaryLeases: tempaddr.NewLeases(),
+		timeout:         kubernetes.DefaultTimeout,
+		log:             log,
+	}
+	if withInterface {
+		p.interfaceIP = func(ipv6 bool) (net.IP, error) {
+			if !ipv6 {
+				return interfaceAddr4, nil
+			}
+			return interfaceAddr, nil
+		}
+	}
+	return p
+}
+
+func newSolicit(t *testing.T) *dhcpv6.Message {
+	req, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.MessageType = dhcpv6.MessageTypeSolicit
+	req.AddOption(dhcpv6.OptClientID(&dhcpv6.DUIDLL{HWType: iana.HWTypeEthernet, LinkLayerAddr: clientMAC}))
+	req.AddOption(&dhcpv6.OptIANA{IaId: expectedIAID})
+	return req
+}
+
+func newStub(t *testing.T) *dhcpv6.Message {
+	stub, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.MessageType = dhcpv6.MessageTypeAdvertise
+	return stub
+}
+
+func ensureLease(t *testing.T, resp dhcpv6.DHCPv6) {
+	iana := resp.(*dhcpv6.Message).Options.OneIANA()
+	if iana == nil {
+		t.Fatal("no IANA option in response")
+	}
+	if iana.IaId != expectedIAID {
+		t.Errorf("expected IAID %d, got %d", expectedIAID, iana.IaId)
+	}
+	if addr := iana.Options.OneAddress(); addr == nil || !addr.IPv6Addr.Equal(expectedLeaseIPv6) {
+		t.Errorf("expected leased address %s, got %v", expectedLeaseIPv6, addr)
+	}
+}
+
+/* IPv6 */
+func TestRelayedSolicit6(t *testing.T) {
+	leaser := &fakeLeaser{}
+	p := newPlugin(leaser, false)
+
+	relayedRequest, err := dhcpv6.EncapsulateRelay(newSolicit(t), dhcpv6.MessageTypeRelayForward, relayLinkAddr, clientLinkLocal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, stop := p.handler6(relayedRequest, newStub(t))
+	if resp == nil {
+		t.Fatal("plugin did not return a message")
+	}
+	if stop {
+		t.Error("plugin interrupted processing, but it shouldn't have")
+	}
+	if leaser.hint.Kind != HintSubnet || !leaser.hint.IP.Equal(relayLinkAddr) {
+		t.Errorf("expected subnet detection by relay link address %s, got %s", relayLinkAddr, leaser.hint)
+	}
+	if leaser.mac.String() != clientMAC.String() {
+		t.Errorf("expected MAC address %s, got %s", clientMAC, leaser.mac)
+	}
+	ensureLease(t, resp)
+}
+
+func TestDirectSolicitWithoutInterface6(t *testing.T) {
+	leaser := &fakeLeaser{}
+	p := newPlugin(leaser, false)
+
+	resp, stop := p.handler6(newSolicit(t), newStub(t))
+	if resp != nil {
+		t.Error("plugin returned a message for a non-relayed request, but it shouldn't have")
+	}
+	if !stop {
+		t.Error("plugin did not interrupt processing, but it should have")
+	}
+	if leaser.hint != nil {
+		t.Error("plugin requested a lease for a non-relayed request, but it shouldn't have")
+	}
+}
+
+func TestDirectSolicitWithInterface6(t *testing.T) {
+	leaser := &fakeLeaser{}
+	p := newPlugin(leaser, true)
+
+	resp, stop := p.handler6(newSolicit(t), newStub(t))
+	if resp == nil {
+		t.Fatal("plugin did not return a message")
+	}
+	if stop {
+		t.Error("plugin interrupted processing, but it shouldn't have")
+	}
+	if leaser.hint.Kind != HintSubnet || !leaser.hint.IP.Equal(interfaceAddr) {
+		t.Errorf("expected subnet detection by interface address %s, got %s", interfaceAddr, leaser.hint)
+	}
+	if leaser.mac.String() != clientMAC.String() {
+		t.Errorf("expected MAC address %s, got %s", clientMAC, leaser.mac)
+	}
+	ensureLease(t, resp)
+}
+
+func TestDirectSolicitWithoutLinkLayerDUID6(t *testing.T) {
+	leaser := &fakeLeaser{}
+	p := newPlugin(leaser, true)
+
+	req := newSolicit(t)
+	req.UpdateOption(dhcpv6.OptClientID(&dhcpv6.DUIDUUID{UUID: [16]byte{1, 2, 3}}))
+
+	resp, stop := p.handler6(req, newStub(t))
+	if resp != nil || !stop {
+		t.Error("plugin did not drop a request without link-layer DUID, but it should have")
+	}
+}
+
+func newUnicast(t *testing.T, msgType dhcpv6.MessageType) *dhcpv6.Message {
+	req := newSolicit(t)
+	req.MessageType = msgType
+	req.UpdateOption(&dhcpv6.OptIANA{IaId: expectedIAID, Options: dhcpv6.IdentityOptions{Options: []dhcpv6.Option{
+		&dhcpv6.OptIAAddress{IPv6Addr: expectedLeaseIPv6},
+	}}})
+	return req
+}
+
+func TestUnicastRenew6(t *testing.T) {
+	serverUnicast := net.ParseIP("2001:db8::547")
+	leaser := &fakeLeaser{}
+	p := newPlugin(leaser, false)
+	p.serverUnicast = serverUnicast
+
+	resp, stop := p.handler6(newUnicast(t, dhcpv6.MessageTypeRenew), newStub(t))
+	if resp == nil || stop {
+		t.Fatal("plugin did not answer a unicast Renew")
+	}
+	if leaser.hint.Kind != HintExact || !leaser.hint.IP.Equal(expectedLeaseIPv6) {
+		t.Errorf("expected exact address %s, got %s", expectedLeaseIPv6, leaser.hint)
+	}
+	ensureLease(t, resp)
+	option := resp.GetOneOption(dhcpv6.OptionUnicast)
+	if option == nil || !net.IP(option.ToBytes()).Equal(serverUnicast) {
+		t.Errorf("expected server unicast option %s, got %v", serverUnicast, option)
+	}
+
+	// without the server unicast option, the client has to use the relay
+	leaser = &fakeLeaser{}
+	p = newPlugin(leaser, false)
+	resp, stop = p.handler6(newUnicast(t, dhcpv6.MessageTypeRenew), newStub(t))
+	if resp != nil || !stop || leaser.hint != nil {
+		t.Error("plugin did not drop a unicast Renew without server unicast, but it should have")
+	}
+}
+
+func TestRelease6(t *testing.T) {
+	leaser := &fakeLeaser{}
+	p := newPlugin(leaser, false)
+	p.serverUnicast = net.ParseIP("2001:db8::547")
+
+	resp, stop := p.handler6(newUnicast(t, dhcpv6.MessageTypeRelease), newStub(t))
+	if resp == nil || stop {
+		t.Fatal("plugin did not answer a unicast Release")
+	}
+	if leaser.hint != nil {
+		t.Error("plugin requested a lease for a Release, but it shouldn't have")
+	}
+	if iana := resp.(*dhcpv6.Message).Options.OneIANA(); iana != nil {
+		t.Errorf("expected no IA_NA in the reply to a Release, got %v", iana)
+	}
+	if status := resp.(*dhcpv6.Message).Options.Status(); status == nil || status.StatusCode != iana.StatusSuccess {
+		t.Errorf("expected status Success, got %v", status)
+	}
+}
+
+func TestParseServerUnicast(t *testing.T) {
+	if ip, err := parseServerUnicast(""); ip != nil || err != nil {
+		t.Errorf("expected no address, got %s, %v", ip, err)
+	}
+	if ip, err := parseServerUnicast("2001:db8::547"); err != nil || !ip.Equal(net.ParseIP("2001:db8::547")) {
+		t.Errorf("expected 2001:db8::547, got %s, %v", ip, err)
+	}
+	for _, invalid := range []string{"invalid", "192.168.2.1", "fe80::1", "ff02::1:2"} {
+		if _, err := parseServerUnicast(invalid); err == nil {
+			t.Errorf("expected an error for %s", invalid)
+		}
+	}
+}
+
+func TestTemporaryAddress6(t *testing.T) {
+	for _, persist := range []bool{false, true} {
+		leaser := &fakeLeaser{}
+		p := newPlugin(leaser, false)
+		p.temporaryAddresses = true
+		p.temporaryPersist = persist
+		p.temporaryPreferred = time.Hour
+		p.temporaryValid = 2 * time.Hour
+
+		req := newSolicit(t)
+		req.AddOption(&dhcpv6.OptIATA{IaId: expectedIAID})
+		relayedRequest, err := dhcpv6.EncapsulateRelay(req, dhcpv6.MessageTypeRelayForward, relayLinkAddr, clientLinkLocal)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, stop := p.handler6(relayedRequest, newStub(t))
+		if resp == nil {
+			t.Fatal("plugin did not return a message")
+		}
+		if stop {
+			t.Error("plugin interrupted processing, but it shouldn't have")
+		}
+		ensureLease(t, resp)
+
+		iata := resp.(*dhcpv6.Message).Options.OneIATA()
+		if iata == nil {
+			t.Fatal("no IATA option in response")
+		}
+		addr := iata.Options.OneAddress()
+		if addr == nil {
+			t.Fatal("no address in IATA option")
+		}
+		if !addr.IPv6Addr.Mask(net.CIDRMask(64, 128)).Equal(relayLinkAddr.Mask(net.CIDRMask(64, 128))) {
+			t.Errorf("expected temporary address on link %s, got %s", relayLinkAddr, addr.IPv6Addr)
+		}
+		if addr.IPv6Addr.Equal(expectedLeaseIPv6) {
+			t.Error("temporary address equals non-temporary address")
+		}
+		if addr.PreferredLifetime != time.Hour || addr.ValidLifetime != 2*time.Hour {
+			t.Errorf("expected temporary lifetimes 1h/2h, got %s/%s", addr.PreferredLifetime, addr.ValidLifetime)
+		}
+
+		if persist && (len(leaser.temporary) != 1 || !leaser.temporary[0].Equal(addr.IPv6Addr)) {
+			t.Errorf("expected temporary address %s to be reserved, got %v", addr.IPv6Addr, leaser.temporary)
+		}
+		if !persist && len(leaser.temporary) != 0 {
+			t.Errorf("expected no temporary address to be reserved, got %v", leaser.temporary)
+		}
+	}
+}
+
+// temporaryRequest returns a relayed request of the message type for the
+// temporary address, or any if addr is nil.
+func temporaryRequest(t *testing.T, msgType dhcpv6.MessageType, addr net.IP) dhcpv6.DHCPv6 {
+	req := newSolicit(t)
+	req.MessageType = msgType
+	iata := &dhcpv6.OptIATA{IaId: expectedIAID}
+	if addr != nil {
+		iata.Options.Add(&dhcpv6.OptIAAddress{IPv6Addr: addr})
+	}
+	req.AddOption(iata)
+	relayedRequest, err := dhcpv6.EncapsulateRelay(req, dhcpv6.MessageTypeRelayForward, relayLinkAddr, clientLinkLocal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return relayedRequest
+}
+
+// temporaryAddress returns the temporary address the plugin leases for req.
+func temporaryAddress(t *testing.T, p *plugin, req dhcpv6.DHCPv6) net.IP {
+	t.Helper()
+	resp, _ := p.handler6(req, newStub(t))
+	if resp == nil {
+		t.Fatal("plugin did not return a message")
+	}
+	iata := resp.(*dhcpv6.Message).Options.OneIATA()
+	if iata == nil || iata.Options.OneAddress() == nil {
+		t.Fatal("no temporary address in response")
+	}
+	return iata.Options.OneAddress().IPv6Addr
+}
+
+func TestTemporaryAddressHandedOut6(t *testing.T) {
+	squatted := net.ParseIP("2001:db8:1::dead")
+	for _, persist := range []bool{false, true} {
+		leaser := &fakeLeaser{}
+		p := newPlugin(leaser, false)
+		p.temporaryAddresses = true
+		p.temporaryPersist = persist
+		p.temporaryValid = 2 * time.Hour
+
+		// an address on the link the client made up is not handed out
+		addr := temporaryAddress(t, p, temporaryRequest(t, dhcpv6.MessageTypeSolicit, squatted))
+		if addr.Equal(squatted) {
+			t.Errorf("persist %t: expected the made up address %s to be replaced", persist, squatted)
+		}
+
+		// the address handed out is confirmed in the Request
+		confirmed := temporaryAddress(t, p, temporaryRequest(t, dhcpv6.MessageTypeRequest, addr))
+		if !confirmed.Equal(addr) {
+			t.Errorf("persist %t: expected the address %s to be kept, got %s", persist, addr, confirmed)
+		}
+		if persist && len(leaser.temporary) != 1 {
+			t.Errorf("expected only %s to be reserved, got %v", addr, leaser.temporary)
+		}
+	}
+}
+
+func TestTemporaryAddressRelease6(t *testing.T) {
+	for _, tc := range []struct {
+		msgType dhcpv6.MessageType
+		persist bool
+	}{
+		{dhcpv6.MessageTypeRelease, false},
+		{dhcpv6.MessageTypeRelease, true},
+		{dhcpv6.MessageTypeDecline, false},
+		{dhcpv6.MessageTypeDecline, true},
+	} {
+		leaser := &fakeLeaser{}
+		p := newPlugin(leaser, false)
+		p.temporaryAddresses = true
+		p.temporaryPersist = tc.persist
+		p.temporaryValid = 2 * time.Hour
+
+		addr := temporaryAddress(t, p, temporaryRequest(t, dhcpv6.MessageTypeSolicit, nil))
+		resp, _ := p.handler6(temporaryRequest(t, tc.msgType, addr), newStub(t))
+		if resp != nil && resp.(*dhcpv6.Message).Options.OneIATA() != nil {
+			t.Errorf("%s persist %t: expected no temporary address in the reply", tc.msgType, tc.persist)
+		}
+		if len(leaser.temporary) != 0 {
+			t.Errorf("%s persist %t: expected %s to be released, got %v", tc.msgType, tc.persist, addr, leaser.temporary)
+		}
+		if p.temporaryHandedOut(context.Background(), addr, clientMAC) {
+			t.Errorf("%s persist %t: expected %s not to be handed out anymore", tc.msgType, tc.persist, addr)
+		}
+	}
+}
+
+func TestTemporaryAddressDisabled6(t *testing.T) {
+	p := newPlugin(&fakeLeaser{}, false)
+
+	req := newSolicit(t)
+	req.AddOption(&dhcpv6.OptIATA{IaId: expectedIAID})
+	relayedRequest, err := dhcpv6.EncapsulateRelay(req, dhcpv6.MessageTypeRelayForward, relayLinkAddr, clientLinkLocal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, _ := p.handler6(relayedRequest, newStub(t))
+	if resp == nil {
+		t.Fatal("plugin did not return a message")
+	}
+	if resp.(*dhcpv6.Message).Options.OneIATA() != nil {
+		t.Error("plugin leased a temporary address, but it shouldn't have")
+	}
+}
+
+func newDiscover(t *testing.T, modifiers ...dhcpv4.Modifier) *dhcpv4.DHCPv4 {
+	req, err := dhcpv4.NewDiscovery(clientMAC, modifiers...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func newStub4(t *testing.T, req *dhcpv4.DHCPv4) *dhcpv4.DHCPv4 {
+	stub, err := dhcpv4.NewReplyFromRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stub
+}
+
+func TestSubnetOptions6(t *testing.T) {
+	leaser := &fakeLeaser{annotations: map[string]string{
+		dnsAnnotation:      "192.168.2.53, 2001:db8:2::53",
+		bootfileAnnotation: "http://[2001:db8:2::1]/boot.efi",
+	}}
+	p := newPlugin(leaser, false)
+
+	req := newSolicit(t)
+	req.AddOption(dhcpv6.OptRequestedOption(dhcpv6.OptionDNSRecursiveNameServer, dhcpv6.OptionBootfileURL))
+	relayedRequest, err := dhcpv6.EncapsulateRelay(req, dhcpv6.MessageTypeRelayForward, relayLinkAddr, clientLinkLocal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, _ := p.handler6(relayedRequest, newStub(t))
+	if resp == nil {
+		t.Fatal("plugin did not return a message")
+	}
+	ensureLease(t, resp)
+
+	options := resp.(*dhcpv6.Message).Options
+	if dns := options.DNS(); len(dns) != 1 || !dns[0].Equal(net.ParseIP("2001:db8:2::53")) {
+		t.Errorf("expected DNS server 2001:db8:2::53 of the subnet, got %v", dns)
+	}
+	if url := options.BootFileURL(); url != "http://[2001:db8:2::1]/boot.efi" {
+		t.Errorf("expected boot file URL of the subnet, got %q", url)
+	}
+}
+
+func TestDNS6(t *testing.T) {
+	dns, err := parseDNS([]api.OOBDNS{
+		{SubnetLabels: map[string]string{"site": "a"}, Servers: []string{"2001:db8:a::53"}, SearchList: []string{"oob.site-a.example.org"}},
+		{Servers: []string{"2001:db8::53"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		labels      map[string]string
+		annotations map[string]string
+		server      net.IP
+		searchList  []string
+	}{
+		{map[string]string{"site": "a", "subnet": "dhcp"}, nil, net.ParseIP("2001:db8:a::53"), []string{"oob.site-a.example.org"}},
+		{map[string]string{"site": "b"}, nil, net.ParseIP("2001:db8::53"), nil},
+		{map[string]string{"site": "a"}, map[string]string{dnsAnnotation: "2001:db8:b::53"}, net.ParseIP("2001:db8:b::53"), []string{"oob.site-a.example.org"}},
+	} {
+		p := newPlugin(&fakeLeaser{labels: tc.labels, annotations: tc.annotations}, false)
+		p.dns = dns
+
+		req := newSolicit(t)
+		req.AddOption(dhcpv6.OptRequestedOption(dhcpv6.OptionDNSRecursiveNameServer, dhcpv6.OptionDomainSearchList))
+		relayedRequest, err := dhcpv6.EncapsulateRelay(req, dhcpv6.MessageTypeRelayForward, relayLinkAddr, clientLinkLocal)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, _ := p.handler6(relayedRequest, newStub(t))
+		if resp == nil {
+			t.Fatal("plugin did not return a message")
+		}
+		options := resp.(*dhcpv6.Message).Options
+		if dns := options.DNS(); len(dns) != 1 || !dns[0].Equal(tc.server) {
+			t.Errorf("subnet %v: expected DNS server %s, got %v", tc.labels, tc.server, dns)
+		}
+		var searchList []string
+		if labels := options.DomainSearchList(); labels != nil {
+			searchList = labels.Labels
+		}
+		if !slices.Equal(searchList, tc.searchList) {
+			t.Errorf("subnet %v: expected search list %v, got %v", tc.labels, tc.searchList, searchList)
+		}
+	}
+}
+
+func TestSetupConfigError(t *testing.T) {
+	_, err := setup6(filepath.Join(t.TempDir(), "does-not-exist.yaml"))
+	var configErr *fedhcperrors.ConfigError
+	if !errors.As(err, &configErr) {
+		t.Fatalf("expected a config error, got %v", err)
+	}
+	if errors.As(configErr.Err, new(*fedhcperrors.ConfigError)) {
+		t.Errorf("expected the config error to be wrapped once, got %v", err)
+	}
+}
+
+func TestInvalidDNS6(t *testing.T) {
+	if _, err := parseDNS([]api.OOBDNS{{Servers: []string{"192.168.2.53"}}}); err == nil {
+		t.Error("no error occurred for an IPv4 DNS server, but it should have")
+	}
+}
+
+func TestSubnetLeaseTimes6(t *testing.T) {
+	for _, tc := range []struct {
+		annotations          map[string]string
+		configured           *api.LeaseTimes
+		valid, preferred, t1 time.Duration
+	}{
+		// the built-in lifetimes without annotations and configuration
+		{valid: 24 * time.Hour, preferred: 24 * time.Hour},
+		{configured: &api.LeaseTimes{LeaseTime: 2 * time.Hour}, valid: 2 * time.Hour, preferred: 2 * time.Hour, t1: time.Hour},
+		{
+			annotations: map[string]string{leaseTimeAnnotation: "4h", preferredLifetimeAnnotation: "2h"},
+			configured:  &api.LeaseTimes{LeaseTime: 2 * time.Hour},
+			valid:       4 * time.Hour, preferred: 2 * time.Hour, t1: time.Hour,
+		},
+	} {
+		p := newPlugin(&fakeLeaser{annotations: tc.annotations}, false)
+		p.leaseTimes = tc.configured
+
+		relayedRequest, err := dhcpv6.EncapsulateRelay(newSolicit(t), dhcpv6.MessageTypeRelayForward, relayLinkAddr, clientLinkLocal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, _ := p.handler6(relayedRequest, newStub(t))
+		if resp == nil {
+			t.Fatal("plugin did not return a message")
+		}
+		ensureLease(t, resp)
+
+		iana := resp.(*dhcpv6.Message).Options.OneIANA()
+		addr := iana.Options.OneAddress()
+		if addr.ValidLifetime != tc.valid || addr.PreferredLifetime != tc.preferred || iana.T1 != tc.t1 {
+			t.Errorf("annotations %v: expected lifetimes %s/%s and T1 %s, got %s/%s and %s", tc.annotations,
+				tc.valid, tc.preferred, tc.t1, addr.ValidLifetime, addr.PreferredLifetime, iana.T1)
+		}
+	}
+}
+
+/* IPv4 */
+func TestDirectDiscoverWithInterface4(t *testing.T) {
+	leaser := &fakeLeaser{}
+	p := newPlugin(leaser, true)
+
+	req := newDiscover(t)
+	resp, stop := p.handler4(req, newStub4(t, req))
+	if resp == nil {
+		t.Fatal("plugin did not return a message")
+	}
+	if stop {
+		t.Error("plugin interrupted processing, but it shouldn't have")
+	}
+	if leaser.hint.Kind != HintSubnet || !leaser.hint.IP.Equal(interfaceAddr4) {
+		t.Errorf("expected subnet detection by interface address %s, got %s", interfaceAddr4, leaser.hint)
+	}
+	if !resp.YourIPAddr.Equal(expectedLeaseIPv4) {
+		t.Errorf("expected leased address %s, got %s", expectedLeaseIPv4, resp.YourIPAddr)
+	}
+}
+
+func TestDirectRequestWithInterface4(t *testing.T) {
+	leaser := &fakeLeaser{}
+	p := newPlugin(leaser, true)
+
+	req := newDiscover(t, dhcpv4.WithOption(dhcpv4.OptRequestedIPAddress(requestedIPv4)))
+	resp, _ := p.handler4(req, newStub4(t, req))
+	if resp == nil {
+		t.Fatal("plugin did not return a message")
+	}
+	if leaser.hint.Kind != HintExact || !leaser.hint.IP.Equal(requestedIPv4) {
+		t.Errorf("expected exact request of %s, got %s", requestedIPv4, leaser.hint)
+	}
+}
+
+func TestRelayedDiscoverWithInterface4(t *testing.T) {
+	leaser := &fakeLeaser{}
+	p := newPlugin(leaser, true)
+
+	req := newDiscover(t, dhcpv4.WithGatewayIP(relayAddr4))
+	resp, _ := p.handler4(req, newStub4(t, req))
+	if resp == nil {
+		t.Fatal("plugin did not return a message")
+	}
+	if leaser.hint.IP.Equal(interfaceAddr4) {
+		t.Error("plugin used the interface address for a relayed request, but it shouldn't have")
+	}
+}
+
+func TestDirectDiscoverWithoutInterface4(t *testing.T) {
+	leaser := &fakeLeaser{}
+	p := newPlugin(leaser, false)
+
+	req := newDiscover(t)
+	resp, _ := p.handler4(req, newStub4(t, req))
+	if resp == nil {
+		t.Fatal("plugin did not return a message")
+	}
+	if leaser.hint.Kind != HintNone {
+		t.Errorf("expected no address hint without an interface configured, got %s", leaser.hint)
+	}
+}
+
+func TestRequestContext4(t *testing.T) {
+	leaser := &fakeLeaser{}
+	p := newPlugin(leaser, false)
+	p.timeout = time.Minute
+
+	req := newDiscover(t)
+	_, _ = p.handler4(req, newStub4(t, req))
+	if leaser.deadline.IsZero() || time.Until(leaser.deadline) > time.Minute {
+		t.Errorf("expected the lease to be bound by the timeout, got deadline %s", leaser.deadline)
+	}
+	if leaser.ctxErr != nil {
+		t.Errorf("expected the context to be live, got %v", leaser.ctxErr)
+	}
+
+	// shutdown interrupts the kubernetes calls of a request
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	kubernetes.SetContext(ctx)
+	defer kubernetes.SetContext(context.Background())
+	_, _ = p.handler4(req, newStub4(t, req))
+	if !errors.Is(leaser.ctxErr, context.Canceled) {
+		t.Errorf("expected the context to be canceled on shutdown, got %v", leaser.ctxErr)
+	}
+}
+
+func newRequest4(t *testing.T, requestedIP net.IP, modifiers ...dhcpv4.Modifier) *dhcpv4.DHCPv4 {
+	modifiers = append(modifiers,
+		dhcpv4.WithMessageType(dhcpv4.MessageTypeRequest),
+		dhcpv4.WithOption(dhcpv4.OptRequestedIPAddress(requestedIP)))
+	return newDiscover(t, modifiers...)
+}
+
+func ensureNak(t *testing.T, resp *dhcpv4.DHCPv4, stop bool) {
+	if resp == nil {
+		t.Fatal("plugin did not return a message")
+	}
+	if !stop {
+		t.Error("plugin did not interrupt processing after a NAK, but it should have")
+	}
+	if resp.MessageType() != dhcpv4.MessageTypeNak {
+		t.Errorf("expected NAK, got %s", resp.MessageType())
+	}
+	if !resp.YourIPAddr.IsUnspecified() {
+		t.Errorf("expected no address in NAK, got %s", resp.YourIPAddr)
+	}
+}
+
+func TestAuthoritativeUnknownSubnet4(t *testing.T) {
+	leaser := &fakeLeaser{err: &fedhcperrors.NoSubnetMatch{IP: requestedIPv4}}
+	p := newPlugin(leaser, false)
+	p.authoritative = true
+
+	req := newRequest4(t, requestedIPv4, dhcpv4.WithGatewayIP(relayAddr4))
+	resp, stop := p.handler4(req, newStub4(t, req))
+	ensureNak(t, resp, stop)
+	if !resp.IsBroadcast() {
+		t.Error("expected broadcast flag in relayed NAK")
+	}
+}
+
+func TestAuthoritativeForeignAddress4(t *testing.T) {
+	p := newPlugin(&fakeLeaser{}, false)
+	p.authoritative = true
+
+	req := newRequest4(t, requestedIPv4)
+	resp, stop := p.handler4(req, newStub4(t, req))
+	ensureNak(t, resp, stop)
+}
+
+func TestAuthoritativeLeasedAddress4(t *testing.T) {
+	p := newPlugin(&fakeLeaser{}, false)
+	p.authoritative = true
+
+	req := newRequest4(t, expectedLeaseIPv4)
+	resp, stop := p.handler4(req, newStub4(t, req))
+	if resp == nil || stop {
+		t.Fatal("plugin dropped a request of the leased address")
+	}
+	if resp.MessageType() == dhcpv4.MessageTypeNak {
+		t.Error("plugin sent a NAK for the leased address, but it shouldn't have")
+	}
+}
+
+func TestNonAuthoritativeUnknownSubnet4(t *testing.T) {
+	p := newPlugin(&fakeLeaser{err: &fedhcperrors.NoSubnetMatch{IP: requestedIPv4}}, false)
+
+	req := newRequest4(t, requestedIPv4)
+	resp, _ := p.handler4(req, newStub4(t, req))
+	if resp != nil {
+		t.Errorf("expected no response, got %s", resp.MessageType())
+	}
+}
+
+func TestSubnetOptions4(t *testing.T) {
+	leaser := &fakeLeaser{annotations: map[string]string{
+		dnsAnnotation:      "192.168.2.53,2001:db8:2::53,foo",
+		gatewayAnnotation:  "192.168.2.1",
+		bootfileAnnotation: "bmc.efi",
+	}}
+	p := newPlugin(leaser, true)
+
+	req := newDiscover(t, dhcpv4.WithRequestedOptions(dhcpv4.OptionDomainNameServer))
+	resp, _ := p.handler4(req, newStub4(t, req))
+	if resp == nil {
+		t.Fatal("plugin did not return a message")
+	}
+	if dns := resp.DNS(); len(dns) != 1 || !dns[0].Equal(net.IPv4(192, 168, 2, 53)) {
+		t.Errorf("expected DNS server 192.168.2.53 of the subnet, got %v", dns)
+	}
+	if routers := resp.Router(); len(routers) != 1 || !routers[0].Equal(net.IPv4(192, 168, 2, 1)) {
+		t.Errorf("expected gateway 192.168.2.1 of the subnet, got %v", routers)
+	}
+	if resp.BootFileName != "bmc.efi" || resp.BootFileNameOption() != "bmc.efi" {
+		t.Errorf("expected boot file bmc.efi of the subnet, got %q/%q", resp.BootFileName, resp.BootFileNameOption())
+	}
+}
+
+func TestNoSubnetOptions4(t *testing.T) {
+	p := newPlugin(&fakeLeaser{}, true)
+
+	req := newDiscover(t, dhcpv4.WithRequestedOptions(dhcpv4.OptionDomainNameServer))
+	resp, _ := p.handler4(req, newStub4(t, req))
+	if resp == nil {
+		t.Fatal("plugin did not return a message")
+	}
+	if resp.Options.Has(dhcpv4.OptionDomainNameServer) || resp.Options.Has(dhcpv4.OptionRouter) {
+		t.Errorf("expected no options without subnet annotations, got %s", resp.Summary())
+	}
+}
+
+func TestSubnetLeaseTimes4(t *testing.T) {
+	configured := &api.LeaseTimes{LeaseTime: time.Hour, T1: 30 * time.Minute}
+	for _, tc := range []struct {
+		annotations map[string]string
+		configured  *api.LeaseTimes
+		leaseTime   time.Duration
+		t1          time.Duration
+	}{
+		{},
+		{configured: configured, leaseTime: time.Hour, t1: 30 * time.Minute},
+		{annotations: map[string]string{leaseTimeAnnotation: "12h"}, leaseTime: 12 * time.Hour},
+		{
+			annotations: map[string]string{leaseTimeAnnotation: "12h", t1Annotation: "6h"},
+			configured:  configured,
+			leaseTime:   12 * time.Hour, t1: 6 * time.Hour,
+		},
+		// invalid durations are skipped
+		{annotations: map[string]string{leaseTimeAnnotation: "a day"}, configured: configured, leaseTime: time.Hour, t1: 30 * time.Minute},
+		// inconsistent lease times fall back to the configuration
+		{annotations: map[string]string{leaseTimeAnnotation: "10m"}, configured: configured, leaseTime: time.Hour, t1: 30 * time.Minute},
+		{annotations: map[string]string{t1Annotation: "2h"}},
+	} {
+		p := newPlugin(&fakeLeaser{annotations: tc.annotations}, true)
+		p.leaseTimes = tc.configured
+
+		req := newDiscover(t)
+		resp, _ := p.handler4(req, newStub4(t, req))
+		if resp == nil {
+			t.Fatal("plugin did not return a message")
+		}
+		if leaseTime := resp.IPAddressLeaseTime(0); leaseTime != tc.leaseTime {
+			t.Errorf("annotations %v: expected lease time %s, got %s", tc.annotations, tc.leaseTime, leaseTime)
+		}
+		if t1 := resp.IPAddressRenewalTime(0); t1 != tc.t1 {
+			t.Errorf("annotations %v: expected T1 %s, got %s", tc.annotations, tc.t1, t1)
+		}
+	}
+}
+
+func TestMessageTypes4(t *testing.T) {
+	custom := api.OOBMessageTypes{Allocate: []string{"discover", "REQUEST", "INFORM"}, Ignore: []string{"DECLINE"}}
+	for _, tc := range []struct {
+		config      api.OOBMessageTypes
+		messageType dhcpv4.MessageType
+		expected    messageAction
+	}{
+		{api.OOBMessageTypes{}, dhcpv4.MessageTypeDiscover, actionAllocate},
+		{api.OOBMessageTypes{}, dhcpv4.MessageTypeRequest, actionAllocate},
+		{api.OOBMessageTypes{}, dhcpv4.MessageTypeDecline, actionPass},
+		{api.OOBMessageTypes{}, dhcpv4.MessageTypeRelease, actionPass},
+		{api.OOBMessageTypes{}, dhcpv4.MessageTypeInform, actionPass},
+		{api.OOBMessageTypes{Ignore: []string{"INFORM"}}, dhcpv4.MessageTypeDiscover, actionAllocate},
+		{api.OOBMessageTypes{Ignore: []string{"INFORM"}}, dhcpv4.MessageTypeInform, actionIgnore},
+		{custom, dhcpv4.MessageTypeDiscover, actionAllocate},
+		{custom, dhcpv4.MessageTypeRequest, actionAllocate},
+		{custom, dhcpv4.MessageTypeDecline, actionIgnore},
+		{custom, dhcpv4.MessageTypeRelease, actionPass},
+		{custom, dhcpv4.MessageTypeInform, actionAllocate},
+	} {
+		leaser := &fakeLeaser{}
+		p := newPlugin(leaser, true)
+		var err error
+		if p.messageTypes, err = parseMessageTypes(tc.config); err != nil {
+			t.Fatal(err)
+		}
+
+		req := newDiscover(t, dhcpv4.WithMessageType(tc.messageType))
+		stub := newStub4(t, req)
+		resp, stop := p.handler4(req, stub)
+		switch tc.expected {
+		case actionAllocate:
+			if resp == nil || stop || !resp.YourIPAddr.Equal(expectedLeaseIPv4) {
+				t.Errorf("expected %s leased for %s with %+v, got %v (stop: %t)", expectedLeaseIPv4, tc.messageType, tc.config, resp, stop)
+			}
+		case actionIgnore:
+			if resp != nil || !stop || leaser.hint != nil {
+				t.Errorf("expected %s dropped with %+v, got %v (stop: %t)", tc.messageType, tc.config, resp, stop)
+			}
+		case actionPass:
+			if resp != stub || stop || leaser.hint != nil || !resp.YourIPAddr.IsUnspecified() {
+				t.Errorf("expected %s passed on untouched with %+v, got %v (stop: %t)", tc.messageType, tc.config, resp, stop)
+			}
+		}
+	}
+
+	for _, invalid := range []api.OOBMessageTypes{
+		{Allocate: []string{"OFFER"}},
+		{Ignore: []string{"SOLICIT"}},
+		{Ignore: []string{"REQUEST"}},
+		{Allocate: []string{"INFORM"}, Ignore: []string{"inform"}},
+	} {
+		if _, err := parseMessageTypes(invalid); err == nil {
+			t.Errorf("expected an error for %+v", invalid)
+		}
+	}
+}
+
+func TestIPName(t *testing.T) {
+	macKey := "001a2b3c4d5e"
+	name := ipName(macKey, "oob-v4")
+	if name != ipName(macKey, "oob-v4") {
+		t.Error("expected the same IP name for the same MAC address and subnet")
+	}
+	if name == ipName(macKey, "oob-v6") {
+		t.Error("expected different IP names for different subnets")
+	}
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		t.Errorf("invalid IP name %s: %v", name, errs)
+	}
+
+	temporary := temporaryIPName(macKey, expectedLeaseIPv6)
+	if temporary == temporaryIPName(macKey, net.ParseIP("2001:db8:2::101")) {
+		t.Error("expected different IP names for different temporary addresses")
+	}
+	if errs := validation.IsDNS1123Subdomain(temporary); len(errs) > 0 {
+		t.Errorf("invalid temporary IP name %s: %v", temporary, errs)
+	}
+}
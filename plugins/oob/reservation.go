@@ -0,0 +1,193 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package oob
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/metrics"
+	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// DefaultReservationInterval is the interval the reservations are checked for
+// drift at, unless configured.
+const DefaultReservationInterval = 5 * time.Minute
+
+// The reasons of a drift of a reservation.
+const (
+	// driftLost means no IP of the client reserves the address anymore, it is
+	// reserved again
+	driftLost = "lost"
+	// driftTaken means another IP reserves the address
+	driftTaken = "taken"
+	// driftMoved means the client got another address than the configured one
+	driftMoved = "moved"
+)
+
+var reservationDrifts = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metrics.Namespace,
+	Subsystem: "oob",
+	Name:      "reservation_drifts_total",
+	Help:      "Number of drifts of the addresses reserved for critical clients by reason (lost, taken, moved), per plugin instance.",
+}, []string{"instance", "reason"})
+
+// reservation is the address reserved for a critical client.
+type reservation struct {
+	mac net.HardwareAddr
+	// hint is the configured address, or no hint
+	hint AddressHint
+	// ip is the address reserved, nil until the first reservation succeeded
+	ip net.IP
+}
+
+// ipLister lists the IPs reserving an address.
+type ipLister interface {
+	ipsReserving(ctx context.Context, ipaddr net.IP) ([]ipamv1alpha1.IP, error)
+}
+
+// reserver reserves the addresses of critical clients of one address family
+// on startup and checks them for drift periodically.
+type reserver struct {
+	leaser       ipLeaser
+	lister       ipLister
+	recorder     record.EventRecorder
+	subnetType   ipamv1alpha1.SubnetAddressType
+	reservations []*reservation
+	interval     time.Duration
+	// timeout bounds the kubernetes calls per reservation
+	timeout  time.Duration
+	instance string
+	log      *logrus.Entry
+}
+
+// parseReservations returns the reservations of the clients for the address
+// family, the configured addresses of the other family are skipped.
+func parseReservations(clients []api.OOBReservation, ipv6 bool) ([]*reservation, error) {
+	reservations := make([]*reservation, 0, len(clients))
+	seen := make(map[string]bool, len(clients))
+	for _, client := range clients {
+		mac, err := net.ParseMAC(client.MAC)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reservation MAC address %s: %w", client.MAC, err)
+		}
+		if seen[mac.String()] {
+			return nil, fmt.Errorf("duplicate reservation of MAC address %s", mac)
+		}
+		seen[mac.String()] = true
+
+		r := &reservation{mac: mac, hint: NoHint()}
+		for _, address := range []struct {
+			value string
+			ipv6  bool
+		}{{client.IPv4, false}, {client.IPv6, true}} {
+			if address.value == "" {
+				continue
+			}
+			ip := net.ParseIP(address.value)
+			if ip == nil || (ip.To4() == nil) != address.ipv6 {
+				return nil, fmt.Errorf("invalid reservation address %s of MAC address %s", address.value, mac)
+			}
+			if address.ipv6 == ipv6 {
+				r.hint = ExactHint(ip)
+			}
+		}
+		reservations = append(reservations, r)
+	}
+	return reservations, nil
+}
+
+// run reserves the addresses and checks them every interval until ctx is
+// cancelled.
+func (r *reserver) run(ctx context.Context) {
+	for _, res := range r.reservations {
+		r.reserve(ctx, res)
+	}
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, res := range r.reservations {
+				r.check(ctx, res)
+			}
+		}
+	}
+}
+
+// reserve reserves the address of the client, the configured one if any,
+// otherwise the one reserved before, if any.
+func (r *reserver) reserve(ctx context.Context, res *reservation) {
+	hint := res.hint
+	if hint.Kind == HintNone && res.ip != nil {
+		hint = ExactHint(res.ip)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	lease, err := r.leaser.getIp(ctx, hint, res.mac, r.subnetType)
+	if err != nil {
+		r.log.WithFields(fedhcperrors.Fields(err)).Errorf("Could not reserve an address for %s, retrying in %s: %v", res.mac, r.interval, err)
+		return
+	}
+	if hint.Kind == HintExact && !lease.ip.Equal(hint.IP) {
+		r.drift(driftMoved, nil, "Reserved %s for %s instead of %s", lease.ip, res.mac, hint.IP)
+	} else {
+		r.log.Infof("Reserved %s for %s", lease.ip, res.mac)
+	}
+	res.ip = lease.ip
+}
+
+// check reserves the address of the client again if its IP is gone and
+// reports IPs of others reserving the same address.
+func (r *reserver) check(ctx context.Context, res *reservation) {
+	if res.ip == nil {
+		r.reserve(ctx, res)
+		return
+	}
+
+	listCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	ips, err := r.lister.ipsReserving(listCtx, res.ip)
+	cancel()
+	if err != nil {
+		r.log.WithFields(fedhcperrors.Fields(err)).Errorf("Could not check the reservation of %s for %s: %v", res.ip, res.mac, err)
+		return
+	}
+
+	macKey := strings.ReplaceAll(res.mac.String(), ":", "")
+	owned := false
+	for i := range ips {
+		if ips[i].Labels["mac"] == macKey {
+			owned = true
+			continue
+		}
+		r.drift(driftTaken, &ips[i], "Address %s reserved for %s is taken by IP %s/%s", res.ip, res.mac, ips[i].Namespace, ips[i].Name)
+	}
+	if !owned {
+		r.drift(driftLost, nil, "Address %s reserved for %s is no longer reserved, reserving it again", res.ip, res.mac)
+		r.reserve(ctx, res)
+	}
+}
+
+// drift reports a drift of a reservation, with an event on the IP involved, if any.
+func (r *reserver) drift(reason string, ipamIP *ipamv1alpha1.IP, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	r.log.Warn(message)
+	reservationDrifts.WithLabelValues(r.instance, reason).Inc()
+	if ipamIP != nil && r.recorder != nil {
+		r.recorder.Event(ipamIP, corev1.EventTypeWarning, "ReservationDrift", message)
+	}
+}
@@ -0,0 +1,127 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package oob
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// fakeLister returns the IPs it holds.
+type fakeLister struct {
+	ips []ipamv1alpha1.IP
+}
+
+func (f *fakeLister) ipsReserving(_ context.Context, _ net.IP) ([]ipamv1alpha1.IP, error) {
+	return f.ips, nil
+}
+
+func newIPAMIP(name, macKey string) ipamv1alpha1.IP {
+	return ipamv1alpha1.IP{ObjectMeta: metav1.ObjectMeta{
+		Name:      name,
+		Namespace: "oob-ns",
+		Labels:    map[string]string{"mac": macKey},
+	}}
+}
+
+func TestParseReservations(t *testing.T) {
+	clients := []api.OOBReservation{
+		{MAC: "00:1a:2b:3c:4d:5e", IPv4: "192.168.2.100"},
+		{MAC: "00:1a:2b:3c:4d:5f", IPv6: "2001:db8:2::100"},
+	}
+	reservations, err := parseReservations(clients, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(reservations) != 2 {
+		t.Fatalf("expected 2 reservations, got %d", len(reservations))
+	}
+	if hint := reservations[0].hint; hint.Kind != HintExact || !hint.IP.Equal(expectedLeaseIPv4) {
+		t.Errorf("expected exact hint %s, got %s", expectedLeaseIPv4, hint)
+	}
+	// the IPv6 address does not apply to DHCPv4
+	if hint := reservations[1].hint; hint.Kind != HintNone {
+		t.Errorf("expected no hint, got %s", hint)
+	}
+
+	for _, invalid := range [][]api.OOBReservation{
+		{{MAC: "invalid"}},
+		{{MAC: "00:1a:2b:3c:4d:5e"}, {MAC: "00-1A-2B-3C-4D-5E"}},
+		{{MAC: "00:1a:2b:3c:4d:5e", IPv4: "2001:db8:2::100"}},
+		{{MAC: "00:1a:2b:3c:4d:5e", IPv6: "192.168.2.100"}},
+	} {
+		if _, err := parseReservations(invalid, true); err == nil {
+			t.Errorf("expected an error for %v", invalid)
+		}
+	}
+}
+
+func TestReservationDrift(t *testing.T) {
+	leaser := &fakeLeaser{}
+	lister := &fakeLister{}
+	recorder := record.NewFakeRecorder(10)
+	r := &reserver{
+		leaser:       leaser,
+		lister:       lister,
+		recorder:     recorder,
+		subnetType:   ipamv1alpha1.CIPv4SubnetType,
+		reservations: []*reservation{{mac: clientMAC, hint: NoHint()}},
+		interval:     DefaultReservationInterval,
+		timeout:      DefaultReservationInterval,
+		instance:     "oob/v4-drift",
+		log:          log.WithField("instance", "oob/v4-drift"),
+	}
+	res := r.reservations[0]
+	ctx := context.Background()
+
+	r.reserve(ctx, res)
+	if !res.ip.Equal(expectedLeaseIPv4) {
+		t.Fatalf("expected %s reserved, got %s", expectedLeaseIPv4, res.ip)
+	}
+
+	// the IP of the client still reserves the address
+	lister.ips = []ipamv1alpha1.IP{newIPAMIP("own", "001a2b3c4d5e")}
+	leaser.hint = nil
+	r.check(ctx, res)
+	if leaser.hint != nil {
+		t.Errorf("expected no reservation, got one with hint %s", leaser.hint)
+	}
+
+	// the IP is gone, the address is reserved again
+	lister.ips = nil
+	r.check(ctx, res)
+	if leaser.hint == nil || leaser.hint.Kind != HintExact || !leaser.hint.IP.Equal(expectedLeaseIPv4) {
+		t.Errorf("expected a reservation of %s, got hint %v", expectedLeaseIPv4, leaser.hint)
+	}
+	if lost := testutil.ToFloat64(reservationDrifts.WithLabelValues(r.instance, driftLost)); lost != 1 {
+		t.Errorf("expected 1 lost reservation, got %v", lost)
+	}
+
+	// another IP reserves the address
+	lister.ips = []ipamv1alpha1.IP{newIPAMIP("own", "001a2b3c4d5e"), newIPAMIP("other", "001a2b3c4d5f")}
+	r.check(ctx, res)
+	if taken := testutil.ToFloat64(reservationDrifts.WithLabelValues(r.instance, driftTaken)); taken != 1 {
+		t.Errorf("expected 1 taken reservation, got %v", taken)
+	}
+	select {
+	case event := <-recorder.Events:
+		t.Logf("event: %s", event)
+	default:
+		t.Error("expected an event on the other IP")
+	}
+
+	// the configured address could not be reserved
+	res.hint = ExactHint(requestedIPv4)
+	r.reserve(ctx, res)
+	if moved := testutil.ToFloat64(reservationDrifts.WithLabelValues(r.instance, driftMoved)); moved != 1 {
+		t.Errorf("expected 1 moved reservation, got %v", moved)
+	}
+}
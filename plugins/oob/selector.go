@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package oob
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// subnetSelector returns the selector of the subnets, matching both the
+// subnetLabels and the subnetSelector of the config, and the labels of the
+// IPs created: the subnetLabels and the matchLabels of the subnetSelector.
+func subnetSelector(config *api.OOBConfig) (labels.Selector, map[string]string, error) {
+	ipLabels := maps.Clone(config.SubnetLabels)
+	if ipLabels == nil {
+		ipLabels = make(map[string]string)
+	}
+	selector := &metav1.LabelSelector{MatchLabels: ipLabels}
+	if s := config.SubnetSelector; s != nil {
+		for key, value := range s.MatchLabels {
+			if other, ok := ipLabels[key]; ok && other != value {
+				return nil, nil, fmt.Errorf("subnetSelector label %s=%s conflicts with subnetLabels %s=%s", key, value, key, other)
+			}
+			ipLabels[key] = value
+		}
+		for _, r := range s.MatchExpressions {
+			selector.MatchExpressions = append(selector.MatchExpressions, metav1.LabelSelectorRequirement{
+				Key:      r.Key,
+				Operator: metav1.LabelSelectorOperator(r.Operator),
+				Values:   r.Values,
+			})
+		}
+	}
+	if len(selector.MatchLabels) == 0 && len(selector.MatchExpressions) == 0 {
+		return nil, nil, errors.New("subnetLabels or subnetSelector must be configured")
+	}
+
+	parsed, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid subnetSelector: %w", err)
+	}
+	return parsed, ipLabels, nil
+}
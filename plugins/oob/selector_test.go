@@ -0,0 +1,80 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package oob
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestSubnetSelector(t *testing.T) {
+	config := &api.OOBConfig{
+		SubnetLabels: map[string]string{"subnet": "dhcp"},
+		SubnetSelector: &api.LabelSelector{
+			MatchLabels: map[string]string{"network": "oob"},
+			MatchExpressions: []api.LabelSelectorRequirement{
+				{Key: "site", Operator: "In", Values: []string{"a", "b"}},
+				{Key: "rack", Operator: "Exists"},
+				{Key: "retired", Operator: "DoesNotExist"},
+			},
+		},
+	}
+	selector, ipLabels, err := subnetSelector(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := map[string]string{"subnet": "dhcp", "network": "oob"}; !maps.Equal(ipLabels, expected) {
+		t.Errorf("expected IP labels %v, got %v", expected, ipLabels)
+	}
+	if len(config.SubnetLabels) != 1 {
+		t.Errorf("expected the subnetLabels of the config untouched, got %v", config.SubnetLabels)
+	}
+
+	for _, tc := range []struct {
+		labels  labels.Set
+		matches bool
+	}{
+		{labels.Set{"subnet": "dhcp", "network": "oob", "site": "a", "rack": "r1"}, true},
+		{labels.Set{"subnet": "dhcp", "network": "oob", "site": "c", "rack": "r1"}, false},
+		{labels.Set{"subnet": "dhcp", "network": "oob", "site": "b"}, false},
+		{labels.Set{"subnet": "dhcp", "network": "oob", "site": "b", "rack": "r1", "retired": "true"}, false},
+		{labels.Set{"network": "oob", "site": "a", "rack": "r1"}, false},
+	} {
+		if matches := selector.Matches(tc.labels); matches != tc.matches {
+			t.Errorf("expected match %t for %v, got %t", tc.matches, tc.labels, matches)
+		}
+	}
+
+	// the selector survives the round trip through the subnet selector string
+	if parsed, err := labels.Parse(selector.String()); err != nil || parsed.String() != selector.String() {
+		t.Errorf("expected %q to parse, got %v, %v", selector, parsed, err)
+	}
+
+	// expressions alone select the subnets, the IPs get no labels
+	selector, ipLabels, err = subnetSelector(&api.OOBConfig{SubnetSelector: &api.LabelSelector{
+		MatchExpressions: []api.LabelSelectorRequirement{{Key: "subnet", Operator: "NotIn", Values: []string{"inband"}}},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ipLabels) != 0 || !selector.Matches(labels.Set{"subnet": "dhcp"}) {
+		t.Errorf("expected a selector of subnets not in-band and no IP labels, got %s and %v", selector, ipLabels)
+	}
+
+	for _, invalid := range []*api.OOBConfig{
+		{},
+		{SubnetSelector: &api.LabelSelector{}},
+		{SubnetLabels: map[string]string{"subnet": "dhcp"}, SubnetSelector: &api.LabelSelector{MatchLabels: map[string]string{"subnet": "inband"}}},
+		{SubnetSelector: &api.LabelSelector{MatchExpressions: []api.LabelSelectorRequirement{{Key: "site", Operator: "In"}}}},
+		{SubnetSelector: &api.LabelSelector{MatchExpressions: []api.LabelSelectorRequirement{{Key: "site", Operator: "Exists", Values: []string{"a"}}}}},
+		{SubnetSelector: &api.LabelSelector{MatchExpressions: []api.LabelSelectorRequirement{{Key: "site", Operator: "Matches", Values: []string{"a"}}}}},
+	} {
+		if _, _, err := subnetSelector(invalid); err == nil {
+			t.Errorf("expected an error for %+v", invalid)
+		}
+	}
+}
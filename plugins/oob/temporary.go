@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package oob
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/sirupsen/logrus"
+)
+
+// temporaryCollector deletes the expired temporary addresses.
+type temporaryCollector interface {
+	collectTemporaryIps(ctx context.Context, now time.Time, valid time.Duration) (int, error)
+}
+
+// temporaryHandedOut returns whether the temporary address was handed out to
+// the MAC address and is still valid, so a client asking for it keeps it.
+// Addresses of others or made up by the client are not handed out.
+func (p *plugin) temporaryHandedOut(ctx context.Context, addr net.IP, mac net.HardwareAddr) bool {
+	if !p.temporaryPersist {
+		return p.temporaryLeases.Has(mac.String(), addr, time.Now())
+	}
+	reserved, err := p.k8sClient.temporaryReserved(ctx, addr, mac, time.Now())
+	if err != nil {
+		p.log.WithFields(fedhcperrors.Fields(err)).Errorf("Could not look up temporary address %s of %s: %v", addr, mac, err)
+		return false
+	}
+	return reserved
+}
+
+// releaseTemporary releases the temporary addresses of the IA_TA of a Release
+// or Decline.
+func (p *plugin) releaseTemporary(m *dhcpv6.Message, mac net.HardwareAddr) {
+	if !p.temporaryAddresses {
+		return
+	}
+	var addrs []net.IP
+	for _, iata := range m.Options.IATA() {
+		for _, opt := range iata.Options.Get(dhcpv6.OptionIAAddr) {
+			if addr, ok := opt.(*dhcpv6.OptIAAddress); ok {
+				addrs = append(addrs, addr.IPv6Addr)
+			}
+		}
+	}
+	if len(addrs) == 0 {
+		return
+	}
+
+	if !p.temporaryPersist {
+		for _, addr := range addrs {
+			p.temporaryLeases.Remove(mac.String(), addr)
+		}
+		return
+	}
+	ctx, cancel := p.requestContext()
+	defer cancel()
+	if err := p.k8sClient.releaseTemporaryIps(ctx, mac, addrs); err != nil {
+		// the addresses expire anyway, see collectTemporary
+		p.log.WithFields(fedhcperrors.Fields(err)).Errorf("Could not release temporary addresses of %s: %v", mac, err)
+	}
+}
+
+// collectTemporary deletes the expired temporary IPs every interval until ctx
+// is cancelled.
+func collectTemporary(ctx context.Context, collector temporaryCollector, interval, valid time.Duration, log *logrus.Entry) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			collectCtx, cancel := context.WithTimeout(ctx, kubernetes.DefaultTimeout)
+			collected, err := collector.collectTemporaryIps(collectCtx, time.Now(), valid)
+			cancel()
+			if err != nil {
+				log.WithFields(fedhcperrors.Fields(err)).Errorf("Could not delete expired temporary IPs: %v", err)
+			}
+			if collected > 0 {
+				log.Infof("Deleted %d expired temporary IPs", collected)
+			}
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package oob
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes/fake"
+	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const temporaryNamespace = "oob"
+
+var otherMAC = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5f}
+
+// objects seeds the fake client with the objects.
+type objects []client.Object
+
+func (o objects) Objects() []client.Object {
+	return o
+}
+
+// temporaryIP returns a temporary IP of the MAC address created at created,
+// expiring at expires unless zero.
+func temporaryIP(mac net.HardwareAddr, address string, created, expires time.Time) *ipamv1alpha1.IP {
+	macKey := strings.ReplaceAll(mac.String(), ":", "")
+	ip, _ := ipamv1alpha1.IPAddrFromString(address)
+	ipamIP := &ipamv1alpha1.IP{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         temporaryNamespace,
+			Name:              temporaryIPName(macKey, net.ParseIP(address)),
+			CreationTimestamp: metav1.NewTime(created),
+			Labels:            map[string]string{"temporary-mac": macKey, "temporary": "true", "origin": origin},
+		},
+		Spec: ipamv1alpha1.IPSpec{
+			Subnet: corev1.LocalObjectReference{Name: "oob"},
+			IP:     ip,
+		},
+	}
+	if !expires.IsZero() {
+		ipamIP.Annotations = map[string]string{temporaryExpiresAnnotation: expires.UTC().Format(time.RFC3339)}
+	}
+	return ipamIP
+}
+
+func temporaryClient(ips ...client.Object) (*K8sClient, client.Client) {
+	cl := fake.NewClient(objects(ips))
+	return &K8sClient{Client: cl, Namespace: temporaryNamespace}, cl
+}
+
+func TestCollectTemporaryIps(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	k, cl := temporaryClient(
+		temporaryIP(clientMAC, "2001:db8:1::1", now.Add(-3*time.Hour), now.Add(-time.Hour)),
+		temporaryIP(clientMAC, "2001:db8:1::2", now.Add(-3*time.Hour), now.Add(time.Hour)),
+		// reserved by an earlier version without expiry
+		temporaryIP(otherMAC, "2001:db8:1::3", now.Add(-3*time.Hour), time.Time{}),
+		temporaryIP(otherMAC, "2001:db8:1::4", now.Add(-time.Hour), time.Time{}),
+	)
+
+	collected, err := k.collectTemporaryIps(context.Background(), now, 2*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if collected != 2 {
+		t.Errorf("expected 2 expired temporary IPs to be deleted, got %d", collected)
+	}
+	ipList := &ipamv1alpha1.IPList{}
+	if err := cl.List(context.Background(), ipList); err != nil {
+		t.Fatal(err)
+	}
+	var kept []string
+	for _, ip := range ipList.Items {
+		kept = append(kept, ip.Spec.IP.String())
+	}
+	slices.Sort(kept)
+	if !slices.Equal(kept, []string{"2001:db8:1::2", "2001:db8:1::4"}) {
+		t.Errorf("expected the unexpired temporary IPs to be kept, got %v", kept)
+	}
+}
+
+func TestTemporaryReserved(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	k, _ := temporaryClient(
+		temporaryIP(clientMAC, "2001:db8:1::1", now, now.Add(time.Hour)),
+		temporaryIP(clientMAC, "2001:db8:1::2", now.Add(-3*time.Hour), now.Add(-time.Hour)),
+		temporaryIP(otherMAC, "2001:db8:1::3", now, now.Add(time.Hour)),
+	)
+
+	for _, tc := range []struct {
+		address  string
+		expected bool
+	}{
+		{"2001:db8:1::1", true},
+		// expired
+		{"2001:db8:1::2", false},
+		// reserved for another MAC address
+		{"2001:db8:1::3", false},
+		{"2001:db8:1::4", false},
+	} {
+		reserved, err := k.temporaryReserved(context.Background(), net.ParseIP(tc.address), clientMAC, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reserved != tc.expected {
+			t.Errorf("expected %s reserved %t, got %t", tc.address, tc.expected, reserved)
+		}
+	}
+}
+
+func TestExtendAndReleaseTemporaryIps(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	k, cl := temporaryClient(
+		temporaryIP(clientMAC, "2001:db8:1::1", now, now.Add(time.Hour)),
+		temporaryIP(otherMAC, "2001:db8:1::1", now, now.Add(time.Hour)),
+	)
+
+	// reserving the address again extends its expiry
+	expires := now.Add(2 * time.Hour)
+	if err := k.reserveTemporaryIp(context.Background(), net.ParseIP("2001:db8:1::1"), clientMAC, expires); err != nil {
+		t.Fatal(err)
+	}
+	ipamIP := temporaryIP(clientMAC, "2001:db8:1::1", now, time.Time{})
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(ipamIP), ipamIP); err != nil {
+		t.Fatal(err)
+	}
+	if got := temporaryExpiry(ipamIP, 0); !got.Equal(expires) {
+		t.Errorf("expected expiry %s, got %s", expires, got)
+	}
+
+	// only the addresses of the MAC address are released
+	if err := k.releaseTemporaryIps(context.Background(), clientMAC, []net.IP{net.ParseIP("2001:db8:1::1")}); err != nil {
+		t.Fatal(err)
+	}
+	ipList := &ipamv1alpha1.IPList{}
+	if err := cl.List(context.Background(), ipList); err != nil {
+		t.Fatal(err)
+	}
+	if len(ipList.Items) != 1 || ipList.Items[0].Labels["temporary-mac"] != "001a2b3c4d5f" {
+		t.Errorf("expected only the temporary IP of %s to be kept, got %v", otherMAC, ipList.Items)
+	}
+}
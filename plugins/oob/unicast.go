@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package oob
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+// parseServerUnicast parses the address clients may unicast to, nil if none
+// is configured.
+func parseServerUnicast(address string) (net.IP, error) {
+	if address == "" {
+		return nil, nil
+	}
+	ip := net.ParseIP(address)
+	if ip == nil || ip.To4() != nil || !ip.IsGlobalUnicast() {
+		return nil, fmt.Errorf("invalid server unicast address %s, should be a global IPv6 address", address)
+	}
+	return ip, nil
+}
+
+// serverUnicastOption returns the Server Unicast option (RFC 8415 Section
+// 21.12) carrying the address.
+func serverUnicastOption(ip net.IP) dhcpv6.Option {
+	return &dhcpv6.OptionGeneric{OptionCode: dhcpv6.OptionUnicast, OptionData: ip.To16()}
+}
+
+// unicastAddress returns the address a client renews by unicast, bypassing
+// the relay as allowed by the Server Unicast option: the first address of the
+// IA_NA of a Request, Renew or Release. It returns nil for other messages.
+func unicastAddress(m *dhcpv6.Message) net.IP {
+	switch m.MessageType {
+	case dhcpv6.MessageTypeRequest, dhcpv6.MessageTypeRenew, dhcpv6.MessageTypeRelease:
+	default:
+		return nil
+	}
+	iana := m.Options.OneIANA()
+	if iana == nil {
+		return nil
+	}
+	addr := iana.Options.OneAddress()
+	if addr == nil || addr.IPv6Addr.IsUnspecified() {
+		return nil
+	}
+	return addr.IPv6Addr
+}
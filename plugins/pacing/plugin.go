@@ -0,0 +1,211 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package pacing
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/ironcore-dev/fedhcp/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logger.GetLogger("plugins/pacing")
+
+var Plugin = plugins.Plugin{
+	Name:   "pacing",
+	Setup4: setup4,
+	Setup6: setup6,
+}
+
+var (
+	pacingActive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "pacing",
+		Name:      "active",
+		Help:      "Whether boot responses are currently paced, per plugin instance.",
+	}, []string{"instance"})
+	pacingPending = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "pacing",
+		Name:      "pending_responses",
+		Help:      "Number of boot responses currently held back, per plugin instance.",
+	}, []string{"instance"})
+	pacingDelayed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "pacing",
+		Name:      "delayed_responses_total",
+		Help:      "Number of boot responses which have been delayed, per plugin instance.",
+	}, []string{"instance"})
+)
+
+// plugin holds the state of a single pacing plugin instance. The config is
+// set once in setup and never modified afterwards, the clients of the current
+// window are guarded by mu.
+type plugin struct {
+	window    time.Duration
+	threshold int
+	name      string
+	log       *logrus.Entry
+	// sleep is replaced in tests
+	sleep func(time.Duration)
+
+	mu          sync.Mutex
+	windowStart time.Time
+	// clients holds the clients sent a boot response in the current window,
+	// so that retransmissions are counted once
+	clients map[string]struct{}
+}
+
+// args[0] = path to config file
+func parseArgs(args ...string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("exactly one argument must be passed to the pacing plugin, got %d", len(args))
+	}
+	return args[0], nil
+}
+
+func loadConfig(args ...string) (*api.PacingConfig, error) {
+	path, err := parseArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	log.Debugf("Reading config file %s", path)
+	config := &api.PacingConfig{}
+	if err := api.Load(path, config); err != nil {
+		return nil, err
+	}
+
+	if config.Window <= 0 {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("pacing window must be positive, got %s", config.Window)}
+	}
+	if config.Threshold < 0 {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("pacing threshold must not be negative, got %d", config.Threshold)}
+	}
+
+	return config, nil
+}
+
+func newPlugin(name string, args ...string) (*plugin, error) {
+	config, err := loadConfig(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.Register(pacingActive, pacingPending, pacingDelayed)
+	// the instance name labels the metrics, so the logger is built by hand
+	name = instance.Next(name)
+	return &plugin{
+		window:    config.Window,
+		threshold: config.Threshold,
+		name:      name,
+		log:       log.WithField("instance", name),
+		sleep:     time.Sleep,
+		clients:   make(map[string]struct{}),
+	}, nil
+}
+
+func setup6(args ...string) (handler.Handler6, error) {
+	p, err := newPlugin("pacing/v6", args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded pacing plugin for DHCPv6 with window %s and threshold %d.", p.window, p.threshold)
+	return p.handler6, nil
+}
+
+func setup4(args ...string) (handler.Handler4, error) {
+	p, err := newPlugin("pacing/v4", args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded pacing plugin for DHCPv4 with window %s and threshold %d.", p.window, p.threshold)
+	return p.handler4, nil
+}
+
+// paced counts the client of a boot response and reports whether the response
+// shall be delayed, i.e. whether more than threshold clients have been sent a
+// boot response in the current window. Retransmissions of a client within the
+// window are not counted again.
+func (p *plugin) paced(key []byte) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(p.windowStart) >= p.window {
+		p.windowStart = now
+		clear(p.clients)
+	}
+	p.clients[string(key)] = struct{}{}
+
+	active := len(p.clients) > p.threshold
+	if active {
+		pacingActive.WithLabelValues(p.name).Set(1)
+	} else {
+		pacingActive.WithLabelValues(p.name).Set(0)
+	}
+	return active
+}
+
+// delay returns the delay of a client within the window. It is derived from
+// the client's hash, so retransmissions get the same delay and the clients are
+// spread evenly over the window.
+func (p *plugin) delay(key []byte) time.Duration {
+	sum := sha256.Sum256(key)
+	return time.Duration(binary.BigEndian.Uint64(sum[:8]) % uint64(p.window))
+}
+
+func (p *plugin) wait(key []byte) {
+	if !p.paced(key) {
+		return
+	}
+
+	d := p.delay(key)
+	p.log.Debugf("Delaying boot response by %s", d)
+	pacingDelayed.WithLabelValues(p.name).Inc()
+	pacingPending.WithLabelValues(p.name).Inc()
+	defer pacingPending.WithLabelValues(p.name).Dec()
+	p.sleep(d)
+}
+
+func (p *plugin) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	if resp.GetOneOption(dhcpv6.OptionBootfileURL) == nil {
+		return resp, false
+	}
+
+	m, err := req.GetInnerMessage()
+	if err != nil {
+		p.log.Errorf("BUG: could not decapsulate: %v", err)
+		return nil, true
+	}
+	clientID := m.Options.ClientID()
+	if clientID == nil {
+		return resp, false
+	}
+
+	p.wait(clientID.ToBytes())
+	return resp, false
+}
+
+func (p *plugin) handler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	if resp.BootFileName == "" && resp.Options.Get(dhcpv4.OptionBootfileName) == nil {
+		return resp, false
+	}
+
+	p.wait(req.ClientHWAddr)
+	return resp, false
+}
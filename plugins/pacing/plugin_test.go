@@ -0,0 +1,165 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package pacing
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/api/apitest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const bootURL = "http://[2001:db8::1]/boot.efi"
+
+// Init returns a plugin recording its delays instead of sleeping.
+func Init(t *testing.T, config api.PacingConfig) (*plugin, *[]time.Duration) {
+	p, err := newPlugin("pacing/test", apitest.WriteConfig(t, config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	delays := &[]time.Duration{}
+	p.sleep = func(d time.Duration) {
+		*delays = append(*delays, d)
+	}
+	return p, delays
+}
+
+func newRequest4(t *testing.T, mac net.HardwareAddr, boot bool) (*dhcpv4.DHCPv4, *dhcpv4.DHCPv4) {
+	req, err := dhcpv4.NewDiscovery(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub, err := dhcpv4.NewReplyFromRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if boot {
+		stub.UpdateOption(dhcpv4.OptBootFileName(bootURL))
+	}
+	return req, stub
+}
+
+func TestWrongNumberArgs(t *testing.T) {
+	_, err := setup4()
+	if err == nil {
+		t.Fatal("no error occurred when not providing a configuration file path, but it should have")
+	}
+
+	_, err = setup6("foo", "bar")
+	if err == nil {
+		t.Fatal("no error occurred when providing wrong number of args (2), but it should have")
+	}
+}
+
+func TestWrongArgs(t *testing.T) {
+	for _, config := range []api.PacingConfig{
+		{},
+		{Window: -time.Second},
+		{Window: time.Second, Threshold: -1},
+	} {
+		if _, err := setup4(apitest.WriteConfig(t, config)); err == nil {
+			t.Fatalf("no error occurred for invalid config %+v, but it should have", config)
+		}
+	}
+}
+
+/* IPv6 */
+func TestBootResponsePaced6(t *testing.T) {
+	p, delays := Init(t, api.PacingConfig{Window: time.Minute})
+
+	req, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.MessageType = dhcpv6.MessageTypeSolicit
+	req.AddOption(dhcpv6.OptClientID(&dhcpv6.DUIDLL{HWType: iana.HWTypeEthernet, LinkLayerAddr: net.HardwareAddr{0, 1, 2, 3, 4, 5}}))
+	stub, err := dhcpv6.NewAdvertiseFromSolicit(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp, _ := p.handler6(req, stub); resp == nil {
+		t.Fatal("plugin did not return a message")
+	}
+	if len(*delays) != 0 {
+		t.Fatal("plugin delayed a response without boot options, but it shouldn't have")
+	}
+
+	stub.AddOption(dhcpv6.OptBootFileURL(bootURL))
+	resp, stop := p.handler6(req, stub)
+	if resp == nil || stop {
+		t.Fatal("plugin dropped a boot response, but it shouldn't have")
+	}
+	if len(*delays) != 1 || (*delays)[0] >= time.Minute {
+		t.Errorf("expected a single delay within the window, got %v", *delays)
+	}
+}
+
+/* IPv4 */
+func TestThreshold4(t *testing.T) {
+	p, delays := Init(t, api.PacingConfig{Window: time.Minute, Threshold: 2})
+
+	for i := byte(0); i < 5; i++ {
+		req, stub := newRequest4(t, net.HardwareAddr{0, 1, 2, 3, 4, i}, true)
+		if resp, _ := p.handler4(req, stub); resp == nil {
+			t.Fatal("plugin did not return a message")
+		}
+	}
+
+	if len(*delays) != 3 {
+		t.Errorf("expected 3 delayed responses above the threshold, got %d", len(*delays))
+	}
+	if active := testutil.ToFloat64(pacingActive.WithLabelValues(p.name)); active != 1 {
+		t.Errorf("expected pacing to be active, got %v", active)
+	}
+	if delayed := testutil.ToFloat64(pacingDelayed.WithLabelValues(p.name)); delayed != 3 {
+		t.Errorf("expected 3 delayed responses in metrics, got %v", delayed)
+	}
+	if pending := testutil.ToFloat64(pacingPending.WithLabelValues(p.name)); pending != 0 {
+		t.Errorf("expected no pending responses, got %v", pending)
+	}
+}
+
+func TestRetransmissionsCountedOnce4(t *testing.T) {
+	p, delays := Init(t, api.PacingConfig{Window: time.Minute, Threshold: 2})
+
+	for _, last := range []byte{0, 1, 0, 0, 1} {
+		req, stub := newRequest4(t, net.HardwareAddr{0, 1, 2, 3, 4, last}, true)
+		p.handler4(req, stub)
+	}
+	if len(*delays) != 0 {
+		t.Fatalf("expected the retransmissions of 2 clients not to be paced, got %d delays", len(*delays))
+	}
+
+	req, stub := newRequest4(t, net.HardwareAddr{0, 1, 2, 3, 4, 2}, true)
+	p.handler4(req, stub)
+	if len(*delays) != 1 {
+		t.Errorf("expected the response to a third client to be delayed, got %d delays", len(*delays))
+	}
+}
+
+func TestDelayStable4(t *testing.T) {
+	p, delays := Init(t, api.PacingConfig{Window: time.Minute})
+	mac := net.HardwareAddr{0, 1, 2, 3, 4, 5}
+
+	for i := 0; i < 2; i++ {
+		req, stub := newRequest4(t, mac, true)
+		p.handler4(req, stub)
+	}
+	req, stub := newRequest4(t, mac, false)
+	p.handler4(req, stub)
+
+	if len(*delays) != 2 {
+		t.Fatalf("expected 2 delayed boot responses, got %d", len(*delays))
+	}
+	if (*delays)[0] != (*delays)[1] {
+		t.Errorf("expected the same delay for retransmissions, got %v", *delays)
+	}
+}
@@ -0,0 +1,159 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package pxeboot
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+)
+
+const (
+	onieArgPrefix = "onie="
+
+	// onieVendorClassPrefix precedes the platform string in the vendor class ONIE sends
+	onieVendorClassPrefix = "onie_vendor:"
+	// onieUserClass is the user class ONIE sends
+	onieUserClass = "onie_dhcp_user_class"
+)
+
+// onieInstallers holds the installer URLs served to ONIE clients, by platform.
+type onieInstallers struct {
+	defaultURL string
+	urls       map[string]string
+}
+
+// parseONIEArgs parses the optional "onie=<path>" argument, loading the ONIE
+// configuration from the file, and returns the remaining arguments. The
+// configuration is nil if the argument is missing.
+func parseONIEArgs(args ...string) (*onieInstallers, []string, error) {
+	var path string
+	var rest []string
+	for _, arg := range args {
+		value, ok := strings.CutPrefix(arg, onieArgPrefix)
+		if !ok {
+			rest = append(rest, arg)
+			continue
+		}
+		if path != "" {
+			return nil, nil, fmt.Errorf("ONIE configuration given more than once")
+		}
+		if value == "" {
+			return nil, nil, fmt.Errorf("empty ONIE configuration path")
+		}
+		path = value
+	}
+	if path == "" {
+		return nil, rest, nil
+	}
+
+	log.Debugf("Reading ONIE config file %s", path)
+	config := &api.ONIEConfig{}
+	if err := api.Load(path, config); err != nil {
+		return nil, nil, err
+	}
+	o, err := newONIEInstallers(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return o, rest, nil
+}
+
+func newONIEInstallers(config *api.ONIEConfig) (*onieInstallers, error) {
+	if config.DefaultURL == "" && len(config.Models) == 0 {
+		return nil, fmt.Errorf("ONIE configuration needs a defaultURL or at least one model")
+	}
+	if config.DefaultURL != "" {
+		if err := parseInstallerURL(config.DefaultURL); err != nil {
+			return nil, err
+		}
+	}
+
+	o := &onieInstallers{defaultURL: config.DefaultURL, urls: make(map[string]string, len(config.Models))}
+	for _, model := range config.Models {
+		if model.Platform == "" {
+			return nil, fmt.Errorf("ONIE model without platform")
+		}
+		if _, ok := o.urls[model.Platform]; ok {
+			return nil, fmt.Errorf("duplicate ONIE platform %s", model.Platform)
+		}
+		if err := parseInstallerURL(model.URL); err != nil {
+			return nil, fmt.Errorf("ONIE platform %s: %w", model.Platform, err)
+		}
+		o.urls[model.Platform] = model.URL
+	}
+	return o, nil
+}
+
+// parseInstallerURL validates an installer URL, ONIE downloads installers by
+// HTTP, FTP or TFTP.
+func parseInstallerURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("invalid installer URL %s: %w", value, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "ftp", "tftp":
+	default:
+		return fmt.Errorf("invalid installer URL %s: scheme should be http, https, ftp or tftp", value)
+	}
+	if u.Host == "" || u.Path == "" {
+		return fmt.Errorf("invalid installer URL %s: host and path must be set", value)
+	}
+	return nil
+}
+
+// installerURL returns the installer URL of the platform, the default one if the
+// platform is not configured.
+func (o *onieInstallers) installerURL(platform string) string {
+	if u, ok := o.urls[platform]; ok {
+		return u
+	}
+	return o.defaultURL
+}
+
+// onieClass returns the platform of an ONIE client given its vendor and user
+// classes, the platform is empty if the client sent the user class only.
+func onieClass(vendorClasses, userClasses []string) (string, bool) {
+	for _, vc := range vendorClasses {
+		if platform, ok := strings.CutPrefix(vc, onieVendorClassPrefix); ok {
+			return platform, true
+		}
+	}
+	for _, uc := range userClasses {
+		if uc == onieUserClass {
+			return "", true
+		}
+	}
+	return "", false
+}
+
+// onieClass4 returns the platform of an ONIE client, which sends its vendor class
+// in option 60 and its user class in option 77.
+func onieClass4(req *dhcpv4.DHCPv4) (string, bool) {
+	var vendorClasses []string
+	if vc := req.ClassIdentifier(); vc != "" {
+		vendorClasses = append(vendorClasses, vc)
+	}
+	return onieClass(vendorClasses, req.UserClass())
+}
+
+// onieClass6 returns the platform of an ONIE client, which sends its vendor class
+// in option 16 and its user class in option 15.
+func onieClass6(msg *dhcpv6.Message) (string, bool) {
+	var vendorClasses, userClasses []string
+	for _, vc := range msg.Options.VendorClasses() {
+		for _, data := range vc.Data {
+			vendorClasses = append(vendorClasses, string(data))
+		}
+	}
+	for _, uc := range msg.Options.UserClasses() {
+		userClasses = append(userClasses, string(uc))
+	}
+	return onieClass(vendorClasses, userClasses)
+}
@@ -10,6 +10,12 @@
 // its value is also passed as OPT_BOOTFILE_PARAM (option 60), so it will be
 // duplicated between option 59 and 60.
 //
+// With the optional "onie=<path>" argument ONIE clients of bare-metal switches,
+// which send an "onie_vendor:<platform>" vendor class or the
+// "onie_dhcp_user_class" user class, are served the installer URL configured
+// for their platform, in the default-url option (option 114) for DHCPv4 and in
+// OPT_BOOTFILE_URL for DHCPv6.
+//
 // Example usage:
 //
 // server6:
@@ -29,6 +35,14 @@ import (
 	"github.com/coredhcp/coredhcp/logger"
 	"github.com/coredhcp/coredhcp/plugins"
 	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/admin"
+	"github.com/ironcore-dev/fedhcp/internal/bootoperator"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/funnel"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/ironcore-dev/fedhcp/internal/printer"
+	"github.com/ironcore-dev/fedhcp/internal/responsecache"
+	"github.com/sirupsen/logrus"
 )
 
 var log = logger.GetLogger("plugins/pxeboot")
@@ -40,10 +54,29 @@ var Plugin = plugins.Plugin{
 	Setup6: setup6,
 }
 
-var (
-	tftpOption, ipxeOption                                       dhcpv6.Option
+// plugin4 holds the state of a single DHCPv4 pxeboot plugin instance. It is
+// built once in setup4 and never modified afterwards.
+type plugin4 struct {
 	tftpBootFileOption, tftpServerNameOption, ipxeBootFileOption *dhcpv4.Option
-)
+	// bootOperator looks up client-specific iPXE URLs rendered by boot-operator, nil if disabled
+	bootOperator *bootoperator.Lookup
+	// onie holds the installer URLs of ONIE clients, nil if disabled
+	onie          *onieInstallers
+	responseCache *responsecache.Cache[[]dhcpv4.Option]
+	log           *logrus.Entry
+}
+
+// plugin6 holds the state of a single DHCPv6 pxeboot plugin instance. It is
+// built once in setup6 and never modified afterwards.
+type plugin6 struct {
+	tftpOption, ipxeOption dhcpv6.Option
+	// bootOperator looks up client-specific iPXE URLs rendered by boot-operator, nil if disabled
+	bootOperator *bootoperator.Lookup
+	// onie holds the installer URLs of ONIE clients, nil if disabled
+	onie          *onieInstallers
+	responseCache *responsecache.Cache[[]dhcpv6.Option]
+	log           *logrus.Entry
+}
 
 func parseArgs(args ...string) (*url.URL, *url.URL, error) {
 	if len(args) != 2 {
@@ -71,121 +104,245 @@ func parseArgs(args ...string) (*url.URL, *url.URL, error) {
 }
 
 func setup4(args ...string) (handler.Handler4, error) {
+	bootOperator, args, err := bootoperator.ParseArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+	onie, args, err := parseONIEArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
 	tftp, ipxe, err := parseArgs(args...)
 	if err != nil {
-		return nil, err
+		return nil, &fedhcperrors.ConfigError{Err: err}
 	}
 
 	opt1 := dhcpv4.OptBootFileName(tftp.Path[1:])
-	tftpBootFileOption = &opt1
-
 	opt2 := dhcpv4.OptTFTPServerName(tftp.Host)
-	tftpServerNameOption = &opt2
-
 	opt3 := dhcpv4.OptBootFileName(ipxe.String())
-	ipxeBootFileOption = &opt3
 
-	log.Printf("loaded PXEBOOT plugin for DHCPv4.")
-	return pxeBootHandler4, nil
+	name := instance.Next("pxeboot/v4")
+	p := &plugin4{
+		tftpBootFileOption:   &opt1,
+		tftpServerNameOption: &opt2,
+		ipxeBootFileOption:   &opt3,
+		bootOperator:         bootOperator,
+		onie:                 onie,
+		responseCache:        responsecache.New[[]dhcpv4.Option](name, responsecache.DefaultTTL),
+		log:                  log.WithField("instance", name),
+	}
+
+	// cached responses must not hold an iPXE URL boot-operator has changed
+	if bootOperator != nil {
+		if err := bootOperator.OnIPXEChange(p.responseCache.Clear); err != nil {
+			return nil, err
+		}
+	}
+
+	admin.State(name, func() any { return map[string]int{"responseCache": p.responseCache.Len()} })
+	p.log.Printf("loaded PXEBOOT plugin for DHCPv4.")
+	return p.pxeBootHandler4, nil
 }
 
-func pxeBootHandler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
-	log.Debugf("Received DHCPv4 request: %s", req.Summary())
+func (p *plugin4) pxeBootHandler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	printer.VerboseRequest(p.log, req)
 
-	if tftpBootFileOption == nil || tftpServerNameOption == nil || ipxeBootFileOption == nil {
+	if p.tftpBootFileOption == nil || p.tftpServerNameOption == nil || p.ipxeBootFileOption == nil {
 		// nothing to do
 		return resp, false
 	}
 
-	if req.IsOptionRequested(dhcpv4.OptionBootfileName) {
+	key := responsecache.Key4(req)
+	if opts, ok := p.responseCache.Get(key); ok {
+		for _, opt := range opts {
+			resp.Options.Update(opt)
+		}
+		// the retransmission is served the boot option again
+		if len(opts) > 0 {
+			funnel.Record(funnel.BootServed, req.ClientHWAddr)
+		}
+		printer.Verbose(p.log, req, "Sent DHCPv4 response (cached): %s", resp)
+		return resp, false
+	}
+
+	var added []dhcpv4.Option
+	if platform, ok := onieClass4(req); ok && p.onie != nil {
+		// ONIE reads the installer URL from the default-url option
+		if installerURL := p.onie.installerURL(platform); installerURL != "" {
+			opt := dhcpv4.OptGeneric(dhcpv4.OptionURL, []byte(installerURL))
+			resp.Options.Update(opt)
+			added = append(added, opt)
+			p.log.Debugf("Added ONIE installer URL %s for platform %q", installerURL, platform)
+			funnel.Record(funnel.BootServed, req.ClientHWAddr)
+		}
+	} else if req.IsOptionRequested(dhcpv4.OptionBootfileName) {
 		var opt, opt2 *dhcpv4.Option
 
 		// if iPXE request
 		if req.GetOneOption(dhcpv4.OptionUserClassInformation) != nil {
 			userClassInfo := req.GetOneOption(dhcpv4.OptionUserClassInformation)
-			log.Debugf("UserClassInformation: %s (%x)", string(userClassInfo), userClassInfo)
+			p.log.Debugf("UserClassInformation: %s (%x)", string(userClassInfo), userClassInfo)
 			if len(userClassInfo) >= 4 && string(userClassInfo[0:4]) == "iPXE" {
-				opt = ipxeBootFileOption
+				opt = p.ipxeBootFileOption
+				if ipxeURL := lookupIPXEURL(p.log, p.bootOperator, bootoperator.Identifiers4(req, resp)); ipxeURL != "" {
+					rendered := dhcpv4.OptBootFileName(ipxeURL)
+					opt = &rendered
+				}
 			}
 		} else
 		// if TFTP request
 		if req.GetOneOption(dhcpv4.OptionClassIdentifier) != nil {
 			classID := req.GetOneOption(dhcpv4.OptionClassIdentifier)
-			log.Debugf("ClassIdentifier: %s (%x)", string(classID), classID)
+			p.log.Debugf("ClassIdentifier: %s (%x)", string(classID), classID)
 			if len(classID) >= 19 && string(classID[0:19]) == "PXEClient:Arch:0000" {
-				opt = tftpBootFileOption
-				opt2 = tftpServerNameOption
+				opt = p.tftpBootFileOption
+				opt2 = p.tftpServerNameOption
 			}
 		}
 
 		if opt != nil {
 			resp.Options.Update(*opt)
-			log.Debugf("Added option %s", *opt)
+			added = append(added, *opt)
+			p.log.Debugf("Added option %s", *opt)
+			funnel.Record(funnel.BootServed, req.ClientHWAddr)
 		}
 		if opt2 != nil {
 			resp.Options.Update(*opt2)
-			log.Debugf("Added option %s", *opt2)
+			added = append(added, *opt2)
+			p.log.Debugf("Added option %s", *opt2)
 		}
 	}
+	p.responseCache.Put(key, added)
 
-	log.Debugf("Sent DHCPv4 response: %s", resp.Summary())
+	printer.VerboseResponse(p.log, req, resp)
 	return resp, false
 }
 
 func setup6(args ...string) (handler.Handler6, error) {
+	bootOperator, args, err := bootoperator.ParseArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+	onie, args, err := parseONIEArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
 	tftp, ipxe, err := parseArgs(args...)
 	if err != nil {
-		return nil, err
+		return nil, &fedhcperrors.ConfigError{Err: err}
 	}
 
-	tftpOption = dhcpv6.OptBootFileURL(tftp.String())
-	ipxeOption = dhcpv6.OptBootFileURL(ipxe.String())
+	name := instance.Next("pxeboot/v6")
+	p := &plugin6{
+		tftpOption:    dhcpv6.OptBootFileURL(tftp.String()),
+		ipxeOption:    dhcpv6.OptBootFileURL(ipxe.String()),
+		bootOperator:  bootOperator,
+		onie:          onie,
+		responseCache: responsecache.NewOptions6(name, responsecache.DefaultTTL),
+		log:           log.WithField("instance", name),
+	}
 
-	log.Printf("loaded PXEBOOT plugin for DHCPv6.")
-	return pxeBootHandler6, nil
+	// cached responses must not hold an iPXE URL boot-operator has changed
+	if bootOperator != nil {
+		if err := bootOperator.OnIPXEChange(p.responseCache.Clear); err != nil {
+			return nil, err
+		}
+	}
+
+	admin.State(name, func() any { return map[string]int{"responseCache": p.responseCache.Len()} })
+	p.log.Printf("loaded PXEBOOT plugin for DHCPv6.")
+	return p.pxeBootHandler6, nil
 }
 
-func pxeBootHandler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
-	log.Debugf("Received DHCPv6 request: %s", req.Summary())
+func (p *plugin6) pxeBootHandler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	printer.VerboseRequest(p.log, req)
 
-	if tftpOption == nil || ipxeOption == nil {
+	if p.tftpOption == nil || p.ipxeOption == nil {
 		// nothing to do
 		return resp, false
 	}
 	decap, err := req.GetInnerMessage()
 	if err != nil {
-		log.Errorf("Could not decapsulate request: %v", err)
+		p.log.Errorf("Could not decapsulate request: %v", err)
 		// drop the request, this is probably a critical error in the packet.
-		return nil, false
+		return nil, true
 	}
 
-	if decap.IsOptionRequested(dhcpv6.OptionBootfileURL) {
+	key, err := responsecache.Key6(req)
+	if err != nil {
+		p.log.Errorf("Could not derive cache key: %v", err)
+		return nil, true
+	}
+	if opts, ok := p.responseCache.Get(key); ok {
+		for _, opt := range opts {
+			resp.AddOption(opt)
+		}
+		// the retransmission is served the boot option again
+		if len(opts) > 0 {
+			funnel.Record6(funnel.BootServed, req)
+		}
+		printer.Verbose(p.log, req, "Sent DHCPv6 response (cached): %s", resp)
+		return resp, false
+	}
+
+	var added []dhcpv6.Option
+	if platform, ok := onieClass6(decap); ok && p.onie != nil {
+		if installerURL := p.onie.installerURL(platform); installerURL != "" {
+			opt := dhcpv6.OptBootFileURL(installerURL)
+			resp.AddOption(opt)
+			added = append(added, opt)
+			p.log.Debugf("Added ONIE installer URL %s for platform %q", installerURL, platform)
+			funnel.Record6(funnel.BootServed, req)
+		}
+	} else if decap.IsOptionRequested(dhcpv6.OptionBootfileURL) {
 		var opt *dhcpv6.Option
 
 		// if TFTP request
 		if decap.GetOneOption(dhcpv6.OptionClientArchType) != nil {
 			optBytes := decap.GetOneOption(dhcpv6.OptionClientArchType).ToBytes()
-			log.Debugf("ClientArchType: %s (%x)", string(optBytes), optBytes)
+			p.log.Debugf("ClientArchType: %s (%x)", string(optBytes), optBytes)
 			if len(optBytes) == 2 && optBytes[0] == 0 && optBytes[1] == byte(iana.EFI_X86_64) { // 0x07
-				opt = &tftpOption
+				opt = &p.tftpOption
 			}
 		}
 
 		// if iPXE request
 		if decap.GetOneOption(dhcpv6.OptionUserClass) != nil {
 			userClass := decap.GetOneOption(dhcpv6.OptionUserClass).ToBytes()
-			log.Debugf("UserClass: %s (%x)", string(userClass), userClass)
+			p.log.Debugf("UserClass: %s (%x)", string(userClass), userClass)
 			if len(userClass) >= 5 && string(userClass[2:6]) == "iPXE" {
-				opt = &ipxeOption
+				opt = &p.ipxeOption
+				if ipxeURL := lookupIPXEURL(p.log, p.bootOperator, bootoperator.Identifiers6(req, resp)); ipxeURL != "" {
+					rendered := dhcpv6.OptBootFileURL(ipxeURL)
+					opt = &rendered
+				}
 			}
 		}
 
 		if opt != nil {
 			resp.AddOption(*opt)
-			log.Debugf("Added option %s", ipxeOption)
+			added = append(added, *opt)
+			p.log.Debugf("Added option %s", *opt)
+			funnel.Record6(funnel.BootServed, req)
 		}
 	}
+	p.responseCache.Put(key, added)
 
-	log.Debugf("Sent DHCPv6 response: %s", resp.Summary())
+	printer.VerboseResponse(p.log, req, resp)
 	return resp, false
 }
+
+// lookupIPXEURL returns the iPXE URL boot-operator rendered for the client, the
+// empty string if the lookup is disabled or the client has none, so that the
+// configured URL is served.
+func lookupIPXEURL(l *logrus.Entry, bootOperator *bootoperator.Lookup, identifiers []string) string {
+	if bootOperator == nil {
+		return ""
+	}
+	ipxeURL, err := bootOperator.IPXEURL(identifiers...)
+	if err != nil {
+		l.Errorf("Failed to look up iPXE URL in boot-operator namespace %s: %v", bootOperator.Namespace(), err)
+		return ""
+	}
+	return ipxeURL
+}
@@ -8,35 +8,47 @@ import (
 	"net/url"
 	"testing"
 
+	"github.com/coredhcp/coredhcp/handler"
 	"github.com/insomniacslk/dhcp/dhcpv4"
 	"github.com/insomniacslk/dhcp/iana"
 
 	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/api/apitest"
+	"github.com/ironcore-dev/fedhcp/internal/funnel"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 const (
 	ipxePath = "http://[2001:db8::1]/boot.ipxe"
 	tftpPath = "tftp://[2001:db8::1]/boot.efi"
+
+	onieDefaultURL = "http://onie.example.com/onie-installer-x86_64.bin"
+	onieAccton     = "x86_64-accton_as7712_32x-r0"
+	onieAcctonURL  = "http://onie.example.com/accton/as7712/sonic-broadcom.bin"
+	onieUnknown    = "x86_64-unknown_switch-r0"
 )
 
 var (
 	numberOptsBootFileURL int
 )
 
-func Init4() {
-	_, err := setup4(tftpPath, ipxePath)
+func Init4() handler.Handler4 {
+	h, err := setup4(tftpPath, ipxePath)
 	if err != nil {
 		log.Fatal(err)
 	}
+	return h
 }
 
-func Init6(numOptBoot int) {
+func Init6(numOptBoot int) handler.Handler6 {
 	numberOptsBootFileURL = numOptBoot
 
-	_, err := setup6(tftpPath, ipxePath)
+	h, err := setup6(tftpPath, ipxePath)
 	if err != nil {
 		log.Fatal(err)
 	}
+	return h
 }
 
 /* parametrization */
@@ -58,56 +70,38 @@ func TestWrongArgs(t *testing.T) {
 	malformedIPXEPath := []string{"httpfoo://www.example.com", "https:/1.2.3"}
 
 	for _, wrongTFTP := range malformedTFTPPath {
-		_, err := setup4(wrongTFTP, ipxePath)
+		h4, err := setup4(wrongTFTP, ipxePath)
 		if err == nil {
 			t.Fatalf("no error occurred when providing wrong TFTP path %s, but it should have", wrongTFTP)
 		}
-		if tftpBootFileOption != nil {
-			t.Fatalf("TFTP boot file was set when providing wrong TFTP path %s, but it should be empty", wrongTFTP)
-		}
-		if tftpServerNameOption != nil {
-			t.Fatalf("TFTP server name was set when providing wrong TFTP path %s, but it should be empty", wrongTFTP)
-		}
-		if ipxeBootFileOption != nil {
-			t.Fatalf("IPXE boot file was set when providing wrong TFTP path %s, but it should be empty", wrongTFTP)
+		if h4 != nil {
+			t.Fatalf("handler was returned when providing wrong path %s, but it should be nil", wrongTFTP)
 		}
 
-		_, err = setup6(wrongTFTP, ipxePath)
+		h6, err := setup6(wrongTFTP, ipxePath)
 		if err == nil {
 			t.Fatalf("no error occurred when providing wrong TFTP path %s, but it should have", wrongTFTP)
 		}
-		if tftpOption != nil {
-			t.Fatalf("TFTP boot file was set when providing wrong TFTP path %s, but it should be empty", wrongTFTP)
-		}
-		if ipxeOption != nil {
-			t.Fatalf("IPXE boot file was set when providing wrong TFTP path %s, but it should be empty", wrongTFTP)
+		if h6 != nil {
+			t.Fatalf("handler was returned when providing wrong path %s, but it should be nil", wrongTFTP)
 		}
 	}
 
 	for _, wrongIPXE := range malformedIPXEPath {
-		_, err := setup4(tftpPath, wrongIPXE)
+		h4, err := setup4(tftpPath, wrongIPXE)
 		if err == nil {
 			t.Fatalf("no error occurred when providing wrong IPXE path %s, but it should have", wrongIPXE)
 		}
-		if tftpBootFileOption != nil {
-			t.Fatalf("TFTP boot file was set when providing wrong IPXE path %s, but it should be empty", wrongIPXE)
-		}
-		if tftpServerNameOption != nil {
-			t.Fatalf("TFTP server name set when providing wrong IPXE path %s, but it should be empty", wrongIPXE)
-		}
-		if ipxeBootFileOption != nil {
-			t.Fatalf("IPXE boot file was set when providing wrong IPXE path %s, but it should be empty", wrongIPXE)
+		if h4 != nil {
+			t.Fatalf("handler was returned when providing wrong path %s, but it should be nil", wrongIPXE)
 		}
 
-		_, err = setup6(tftpPath, wrongIPXE)
+		h6, err := setup6(tftpPath, wrongIPXE)
 		if err == nil {
 			t.Fatalf("no error occurred when providing wrong IPXE path %s, but it should have", wrongIPXE)
 		}
-		if tftpOption != nil {
-			t.Fatalf("TFTP boot file was set when providing wrong IPXE path %s, but it should be empty", wrongIPXE)
-		}
-		if ipxeOption != nil {
-			t.Fatalf("IPXE boot file was set when providing wrong IPXE path %s, but it should be empty", wrongIPXE)
+		if h6 != nil {
+			t.Fatalf("handler was returned when providing wrong path %s, but it should be nil", wrongIPXE)
 		}
 	}
 }
@@ -115,7 +109,7 @@ func TestWrongArgs(t *testing.T) {
 /* IPv6 */
 
 func TestPXERequested6(t *testing.T) {
-	Init6(1)
+	pxeBootHandler6 := Init6(1)
 
 	req, err := dhcpv6.NewMessage()
 	if err != nil {
@@ -157,7 +151,7 @@ func TestPXERequested6(t *testing.T) {
 }
 
 func TestTFTPRequested6(t *testing.T) {
-	Init6(1)
+	pxeBootHandler6 := Init6(1)
 
 	req, err := dhcpv6.NewMessage()
 	if err != nil {
@@ -194,7 +188,7 @@ func TestTFTPRequested6(t *testing.T) {
 }
 
 func TestWrongPXERequested6(t *testing.T) {
-	Init6(0)
+	pxeBootHandler6 := Init6(0)
 
 	req, err := dhcpv6.NewMessage()
 	if err != nil {
@@ -231,7 +225,7 @@ func TestWrongPXERequested6(t *testing.T) {
 }
 
 func TestWrongTFTPRequested6(t *testing.T) {
-	Init6(0)
+	pxeBootHandler6 := Init6(0)
 
 	req, err := dhcpv6.NewMessage()
 	if err != nil {
@@ -263,7 +257,7 @@ func TestWrongTFTPRequested6(t *testing.T) {
 }
 
 func TestPXENotRequested6(t *testing.T) {
-	Init6(0)
+	pxeBootHandler6 := Init6(0)
 
 	req, err := dhcpv6.NewMessage()
 	if err != nil {
@@ -293,7 +287,7 @@ func TestPXENotRequested6(t *testing.T) {
 }
 
 func TestTFTPNotRequested6(t *testing.T) {
-	Init6(0)
+	pxeBootHandler6 := Init6(0)
 
 	req, err := dhcpv6.NewMessage()
 	if err != nil {
@@ -325,7 +319,7 @@ func TestTFTPNotRequested6(t *testing.T) {
 /* IPV4 */
 
 func TestPXERequested4(t *testing.T) {
-	Init4()
+	pxeBootHandler4 := Init4()
 
 	req, err := dhcpv4.NewDiscovery(net.HardwareAddr{
 		0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
@@ -358,8 +352,35 @@ func TestPXERequested4(t *testing.T) {
 	}
 }
 
+func TestRetransmittedPXERequestRecorded4(t *testing.T) {
+	pxeBootHandler4 := Init4()
+	mac := net.HardwareAddr{0xaa, 0xbb, 0x02, 0xdd, 0xee, 0xff}
+	served := funnel.Events(funnel.BootServed, mac)
+	before := testutil.ToFloat64(served)
+
+	req, err := dhcpv4.NewDiscovery(mac, dhcpv4.WithRequestedOptions(dhcpv4.OptionBootfileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.UpdateOption(dhcpv4.OptUserClass("iPXE"))
+	for i := 0; i < 2; i++ {
+		stub, err := dhcpv4.NewReplyFromRequest(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp, _ := pxeBootHandler4(req, stub); dhcpv4.GetString(dhcpv4.OptionBootfileName, resp.Options) != ipxePath {
+			t.Fatalf("expected boot file name %s in response %d", ipxePath, i)
+		}
+	}
+
+	// the retransmission is answered from the cache and counted as well
+	if got := testutil.ToFloat64(served) - before; got != 2 {
+		t.Errorf("expected 2 boot served events, got %v", got)
+	}
+}
+
 func TestTFTPRequested4(t *testing.T) {
-	Init4()
+	pxeBootHandler4 := Init4()
 
 	req, err := dhcpv4.NewDiscovery(net.HardwareAddr{
 		0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
@@ -400,7 +421,7 @@ func TestTFTPRequested4(t *testing.T) {
 }
 
 func TestPXENotRequested4(t *testing.T) {
-	Init4()
+	pxeBootHandler4 := Init4()
 
 	req, err := dhcpv4.NewDiscovery(net.HardwareAddr{
 		0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
@@ -431,7 +452,7 @@ func TestPXENotRequested4(t *testing.T) {
 }
 
 func TestTFTPNotRequested4(t *testing.T) {
-	Init4()
+	pxeBootHandler4 := Init4()
 
 	req, err := dhcpv4.NewDiscovery(net.HardwareAddr{
 		0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
@@ -466,7 +487,7 @@ func TestTFTPNotRequested4(t *testing.T) {
 }
 
 func TestWrongPXERequested4(t *testing.T) {
-	Init4()
+	pxeBootHandler4 := Init4()
 
 	req, err := dhcpv4.NewDiscovery(net.HardwareAddr{
 		0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
@@ -500,7 +521,7 @@ func TestWrongPXERequested4(t *testing.T) {
 }
 
 func TestWrongTFTPRequested4(t *testing.T) {
-	Init4()
+	pxeBootHandler4 := Init4()
 
 	req, err := dhcpv4.NewDiscovery(net.HardwareAddr{
 		0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
@@ -536,3 +557,162 @@ func TestWrongTFTPRequested4(t *testing.T) {
 		t.Errorf("Found TFTP path %s, expected empty", bootFileName)
 	}
 }
+
+/* ONIE */
+
+var onieConfig = api.ONIEConfig{
+	DefaultURL: onieDefaultURL,
+	Models:     []api.ONIEModel{{Platform: onieAccton, URL: onieAcctonURL}},
+}
+
+func TestWrongONIEArgs(t *testing.T) {
+	for _, config := range []api.ONIEConfig{
+		{},
+		{DefaultURL: "onie-installer.bin"},
+		{DefaultURL: "nfs://onie.example.com/onie-installer.bin"},
+		{Models: []api.ONIEModel{{URL: onieAcctonURL}}},
+		{Models: []api.ONIEModel{{Platform: onieAccton, URL: "http://onie.example.com"}}},
+		{Models: []api.ONIEModel{{Platform: onieAccton, URL: onieAcctonURL}, {Platform: onieAccton, URL: onieDefaultURL}}},
+	} {
+		if _, err := setup4(tftpPath, ipxePath, "onie="+apitest.WriteConfig(t, config)); err == nil {
+			t.Fatalf("no error occurred when providing ONIE config %+v, but it should have", config)
+		}
+	}
+
+	path := apitest.WriteConfig(t, onieConfig)
+	if _, err := setup6(tftpPath, ipxePath, "onie="+path, "onie="+path); err == nil {
+		t.Fatal("no error occurred when providing the ONIE config twice, but it should have")
+	}
+}
+
+func TestONIE4(t *testing.T) {
+	pxeBootHandler4, err := setup4(tftpPath, ipxePath, "onie="+apitest.WriteConfig(t, onieConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		classID, userClass, installerURL string
+	}{
+		{"onie_vendor:" + onieAccton, "onie_dhcp_user_class", onieAcctonURL},
+		{"onie_vendor:" + onieUnknown, "", onieDefaultURL},
+		{"", "onie_dhcp_user_class", onieDefaultURL},
+		{"PXEClient:Arch:00007", "", ""},
+	} {
+		req, err := dhcpv4.NewDiscovery(net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.classID != "" {
+			req.UpdateOption(dhcpv4.OptClassIdentifier(tc.classID))
+		}
+		if tc.userClass != "" {
+			req.UpdateOption(dhcpv4.OptGeneric(dhcpv4.OptionUserClassInformation, []byte(tc.userClass)))
+		}
+		stub, err := dhcpv4.NewReplyFromRequest(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, stop := pxeBootHandler4(req, stub)
+		if stop {
+			t.Error("plugin interrupted processing, but it shouldn't have")
+		}
+		if value := resp.Options.Get(dhcpv4.OptionURL); string(value) != tc.installerURL {
+			t.Errorf("expected installer URL %q for %q/%q, got %q", tc.installerURL, tc.classID, tc.userClass, value)
+		}
+		if tc.installerURL != "" && resp.Options.Has(dhcpv4.OptionBootfileName) {
+			t.Errorf("expected no boot file name for ONIE client %q/%q", tc.classID, tc.userClass)
+		}
+	}
+}
+
+func TestONIENotConfigured4(t *testing.T) {
+	pxeBootHandler4 := Init4()
+
+	req, err := dhcpv4.NewDiscovery(net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.UpdateOption(dhcpv4.OptClassIdentifier("onie_vendor:" + onieAccton))
+	stub, err := dhcpv4.NewReplyFromRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, _ := pxeBootHandler4(req, stub)
+	if resp.Options.Has(dhcpv4.OptionURL) {
+		t.Error("expected no installer URL without ONIE configuration")
+	}
+}
+
+func TestONIE6(t *testing.T) {
+	pxeBootHandler6, err := setup6(tftpPath, ipxePath, "onie="+apitest.WriteConfig(t, onieConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		vendorClass, installerURL string
+	}{
+		{"onie_vendor:" + onieAccton, onieAcctonURL},
+		{"onie_vendor:" + onieUnknown, onieDefaultURL},
+		{"HTTPClient:Arch:00016", ""},
+	} {
+		req, err := dhcpv6.NewMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.MessageType = dhcpv6.MessageTypeSolicit
+		req.AddOption(&dhcpv6.OptVendorClass{EnterpriseNumber: 0, Data: [][]byte{[]byte(tc.vendorClass)}})
+
+		stub, err := dhcpv6.NewMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stub.MessageType = dhcpv6.MessageTypeAdvertise
+
+		resp, stop := pxeBootHandler6(req, stub)
+		if stop {
+			t.Error("plugin interrupted processing, but it shouldn't have")
+		}
+		if bootFileURL := resp.(*dhcpv6.Message).Options.BootFileURL(); bootFileURL != tc.installerURL {
+			t.Errorf("expected installer URL %q for %s, got %q", tc.installerURL, tc.vendorClass, bootFileURL)
+		}
+	}
+}
+
+// a relayed message without the client's message is dropped and stops the
+// chain, so that no later plugin answers it
+func TestMalformedRelay6(t *testing.T) {
+	pxeBootHandler6 := Init6(1)
+
+	req := &dhcpv6.RelayMessage{
+		MessageType: dhcpv6.MessageTypeRelayForward,
+		LinkAddr:    net.ParseIP("2001:db8:1::1"),
+		PeerAddr:    net.ParseIP("fe80::1"),
+	}
+	stub, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.MessageType = dhcpv6.MessageTypeReply
+
+	downstream := false
+	var resp dhcpv6.DHCPv6 = stub
+	for _, h := range []handler.Handler6{pxeBootHandler6, func(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+		downstream = true
+		return resp, false
+	}} {
+		var stop bool
+		if resp, stop = h(req, resp); stop {
+			break
+		}
+	}
+	if resp != nil {
+		t.Errorf("expected the malformed message to be dropped, got %v", resp)
+	}
+	if downstream {
+		t.Error("expected the chain to stop at the plugin, but the next plugin ran")
+	}
+}
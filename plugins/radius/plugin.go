@@ -0,0 +1,202 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package radius
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/ironcore-dev/fedhcp/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logger.GetLogger("plugins/radius")
+
+var Plugin = plugins.Plugin{
+	Name:   "radius",
+	Setup4: setup4,
+	Setup6: setup6,
+}
+
+const (
+	defaultPort          = "1812"
+	defaultTimeout       = 2 * time.Second
+	defaultNASIdentifier = "fedhcp"
+)
+
+var radiusRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metrics.Namespace,
+	Subsystem: "radius",
+	Name:      "requests_total",
+	Help:      "Number of RADIUS authentications by result (accept, reject, error), per plugin instance.",
+}, []string{"instance", "result"})
+
+// plugin holds the state of a single radius plugin instance.
+type plugin struct {
+	client   *radiusClient
+	failOpen bool
+	name     string
+	log      *logrus.Entry
+}
+
+// args[0] = path to config file
+func parseArgs(args ...string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("exactly one argument must be passed to the radius plugin, got %d", len(args))
+	}
+	return args[0], nil
+}
+
+func loadConfig(args ...string) (*api.RadiusConfig, error) {
+	path, err := parseArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	log.Debugf("Reading config file %s", path)
+	config := &api.RadiusConfig{}
+	if err := api.Load(path, config); err != nil {
+		return nil, err
+	}
+
+	if len(config.Servers) == 0 {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("at least one RADIUS server must be configured")}
+	}
+	if config.SecretFile == "" {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("a RADIUS secret file must be configured")}
+	}
+	if config.Timeout < 0 {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("RADIUS timeout must not be negative, got %s", config.Timeout)}
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultTimeout
+	}
+	switch config.FailurePolicy {
+	case "":
+		config.FailurePolicy = api.RadiusFailClosed
+	case api.RadiusFailClosed, api.RadiusFailOpen:
+	default:
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("unknown failure policy %s, should be %s or %s",
+			config.FailurePolicy, api.RadiusFailClosed, api.RadiusFailOpen)}
+	}
+	if config.NASIdentifier == "" {
+		config.NASIdentifier = defaultNASIdentifier
+	}
+
+	return config, nil
+}
+
+func newPlugin(name string, args ...string) (*plugin, error) {
+	config, err := loadConfig(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	servers := make([]string, 0, len(config.Servers))
+	for _, server := range config.Servers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(strings.Trim(server, "[]"), defaultPort)
+		}
+		servers = append(servers, server)
+	}
+
+	secret, err := os.ReadFile(config.SecretFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret file: %v", err)
+	}
+	secret = []byte(strings.TrimRight(string(secret), "\r\n"))
+	if len(secret) == 0 {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("RADIUS secret file %s is empty", config.SecretFile)}
+	}
+
+	metrics.Register(radiusRequests)
+	// the instance name labels the metrics, so the logger is built by hand
+	name = instance.Next(name)
+	return &plugin{
+		client: &radiusClient{
+			servers:       servers,
+			secret:        secret,
+			timeout:       config.Timeout,
+			nasIdentifier: config.NASIdentifier,
+		},
+		failOpen: config.FailurePolicy == api.RadiusFailOpen,
+		name:     name,
+		log:      log.WithField("instance", name),
+	}, nil
+}
+
+func setup6(args ...string) (handler.Handler6, error) {
+	p, err := newPlugin("radius/v6", args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded radius plugin for DHCPv6 with servers %s.", strings.Join(p.client.servers, ", "))
+	return p.handler6, nil
+}
+
+func setup4(args ...string) (handler.Handler4, error) {
+	p, err := newPlugin("radius/v4", args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded radius plugin for DHCPv4 with servers %s.", strings.Join(p.client.servers, ", "))
+	return p.handler4, nil
+}
+
+// allowed authenticates the MAC address and reports whether the chain shall continue.
+func (p *plugin) allowed(mac net.HardwareAddr) bool {
+	accepted, err := p.client.authenticate(mac)
+	switch {
+	case err != nil:
+		radiusRequests.WithLabelValues(p.name, "error").Inc()
+		p.log.Errorf("Could not authenticate %s, failing %s: %v", mac, failure(p.failOpen), err)
+		return p.failOpen
+	case !accepted:
+		radiusRequests.WithLabelValues(p.name, "reject").Inc()
+		p.log.Infof("RADIUS rejected %s, dropping", mac)
+		return false
+	default:
+		radiusRequests.WithLabelValues(p.name, "accept").Inc()
+		p.log.Debugf("RADIUS accepted %s", mac)
+		return true
+	}
+}
+
+func failure(failOpen bool) api.RadiusFailurePolicy {
+	if failOpen {
+		return api.RadiusFailOpen
+	}
+	return api.RadiusFailClosed
+}
+
+func (p *plugin) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	mac, err := dhcpv6.ExtractMAC(req)
+	if err != nil {
+		p.log.Errorf("Could not determine MAC address of %s: %v, dropping", req.Summary(), err)
+		return nil, true
+	}
+	if !p.allowed(mac) {
+		return nil, true
+	}
+	return resp, false
+}
+
+func (p *plugin) handler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	if !p.allowed(req.ClientHWAddr) {
+		return nil, true
+	}
+	return resp, false
+}
@@ -0,0 +1,239 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package radius
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/api/apitest"
+)
+
+const secret = "s3cr3t"
+
+var (
+	acceptedMAC = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+	rejectedMAC = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5f}
+)
+
+func writeConfig(t *testing.T, config api.RadiusConfig) string {
+	dir := t.TempDir()
+	if config.SecretFile == "" {
+		config.SecretFile = filepath.Join(dir, "secret")
+		_ = os.WriteFile(config.SecretFile, []byte(secret+"\n"), 0600)
+	}
+	return apitest.WriteConfig(t, config)
+}
+
+// serve answers Access-Requests on a local UDP socket, accepting only acceptedMAC.
+// It signs its answers with the given secret and returns the server address.
+func serve(t *testing.T, serverSecret string, answer bool) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	go func() {
+		buf := make([]byte, maxPacketLength)
+		for {
+			n, peer, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if !answer {
+				continue
+			}
+			if response := respond(t, buf[:n], []byte(serverSecret)); response != nil {
+				_, _ = conn.WriteTo(response, peer)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func respond(t *testing.T, request, secret []byte) []byte {
+	// verify the Message-Authenticator of the request
+	offset := findAttribute(request, attrMessageAuthenticator)
+	if offset < 0 {
+		t.Error("request without message authenticator")
+		return nil
+	}
+	check := bytes.Clone(request)
+	clear(check[offset : offset+md5.Size])
+	if !bytes.Equal(messageAuthenticator(check, secret), request[offset:offset+md5.Size]) {
+		return nil
+	}
+
+	// recover the password, which is a single block for a MAC address
+	user := string(attribute(request, attrUserName))
+	hidden := attribute(request, attrUserPassword)
+	hash := md5.Sum(append(bytes.Clone(secret), request[4:headerLength]...))
+	password := make([]byte, len(hidden))
+	for i := range hidden {
+		password[i] = hidden[i] ^ hash[i]
+	}
+	if string(bytes.TrimRight(password, "\x00")) != user {
+		t.Errorf("password does not match user name %s", user)
+	}
+
+	code := byte(codeAccessReject)
+	if user == strings.ReplaceAll(acceptedMAC.String(), ":", "") {
+		code = codeAccessAccept
+	}
+	response := bytes.NewBuffer([]byte{code, request[1], 0, 0})
+	response.Write(request[4:headerLength])
+	writeAttribute(response, attrMessageAuthenticator, make([]byte, md5.Size))
+	data := response.Bytes()
+	binary.BigEndian.PutUint16(data[2:4], uint16(len(data)))
+	copy(data[headerLength+2:], messageAuthenticator(data, secret))
+
+	sum := md5.New()
+	sum.Write(data)
+	sum.Write(secret)
+	copy(data[4:headerLength], sum.Sum(nil))
+	return data
+}
+
+func attribute(packet []byte, attrType byte) []byte {
+	offset := findAttribute(packet, attrType)
+	if offset < 0 {
+		return nil
+	}
+	return packet[offset : offset+int(packet[offset-1])-2]
+}
+
+func Init(t *testing.T, config api.RadiusConfig) *plugin {
+	if config.Timeout == 0 {
+		config.Timeout = 200 * time.Millisecond
+	}
+	p, err := newPlugin("radius/test", writeConfig(t, config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestWrongNumberArgs(t *testing.T) {
+	_, err := setup4()
+	if err == nil {
+		t.Fatal("no error occurred when not providing a configuration file path, but it should have")
+	}
+
+	_, err = setup6("foo", "bar")
+	if err == nil {
+		t.Fatal("no error occurred when providing wrong number of args (2), but it should have")
+	}
+}
+
+func TestWrongArgs(t *testing.T) {
+	for _, config := range []api.RadiusConfig{
+		{},
+		{Servers: []string{"127.0.0.1"}, SecretFile: "/does/not/exist"},
+		{Servers: []string{"127.0.0.1"}, Timeout: -time.Second},
+		{Servers: []string{"127.0.0.1"}, FailurePolicy: "ajar"},
+	} {
+		if _, err := setup4(writeConfig(t, config)); err == nil {
+			t.Fatalf("no error occurred for invalid config %+v, but it should have", config)
+		}
+	}
+}
+
+func TestDefaultPort(t *testing.T) {
+	p := Init(t, api.RadiusConfig{Servers: []string{"192.0.2.1", "[2001:db8::1]", "192.0.2.2:1645"}})
+
+	expected := []string{"192.0.2.1:1812", "[2001:db8::1]:1812", "192.0.2.2:1645"}
+	if strings.Join(p.client.servers, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected servers %v, got %v", expected, p.client.servers)
+	}
+}
+
+/* IPv6 */
+func TestAuthenticate6(t *testing.T) {
+	p := Init(t, api.RadiusConfig{Servers: []string{serve(t, secret, true)}})
+
+	for mac, expected := range map[string]bool{acceptedMAC.String(): true, rejectedMAC.String(): false} {
+		hwaddr, _ := net.ParseMAC(mac)
+		req, err := dhcpv6.NewMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.AddOption(dhcpv6.OptClientID(&dhcpv6.DUIDLL{HWType: iana.HWTypeEthernet, LinkLayerAddr: hwaddr}))
+		stub, err := dhcpv6.NewAdvertiseFromSolicit(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, stop := p.handler6(req, stub)
+		if (resp != nil) != expected || stop == expected {
+			t.Errorf("expected %s to be served: %t, got response %v and stop %t", mac, expected, resp, stop)
+		}
+	}
+}
+
+/* IPv4 */
+func request4(t *testing.T, mac net.HardwareAddr) (*dhcpv4.DHCPv4, *dhcpv4.DHCPv4) {
+	req, err := dhcpv4.NewDiscovery(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub, err := dhcpv4.NewReplyFromRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req, stub
+}
+
+func TestAuthenticate4(t *testing.T) {
+	// the first server does not answer, the second one decides
+	p := Init(t, api.RadiusConfig{Servers: []string{serve(t, secret, false), serve(t, secret, true)}})
+
+	resp, stop := p.handler4(request4(t, acceptedMAC))
+	if resp == nil || stop {
+		t.Error("expected the accepted client to be served")
+	}
+
+	resp, stop = p.handler4(request4(t, rejectedMAC))
+	if resp != nil || !stop {
+		t.Error("expected the rejected client to be dropped")
+	}
+}
+
+func TestFailurePolicy(t *testing.T) {
+	for policy, served := range map[api.RadiusFailurePolicy]bool{
+		"":                   false,
+		api.RadiusFailClosed: false,
+		api.RadiusFailOpen:   true,
+	} {
+		p := Init(t, api.RadiusConfig{
+			Servers:       []string{serve(t, secret, false)},
+			FailurePolicy: policy,
+		})
+
+		resp, _ := p.handler4(request4(t, acceptedMAC))
+		if (resp != nil) != served {
+			t.Errorf("expected client to be served with failure policy %q: %t", policy, served)
+		}
+	}
+}
+
+func TestWrongSecret(t *testing.T) {
+	// answers signed with another secret are ignored, so the server counts as not answering
+	p := Init(t, api.RadiusConfig{Servers: []string{serve(t, "other", true)}})
+
+	if _, err := p.client.authenticate(acceptedMAC); err == nil {
+		t.Error("expected an error for a server with another secret")
+	}
+}
@@ -0,0 +1,216 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package radius
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// RADIUS packet codes and attribute types, see RFC 2865 and RFC 3579.
+const (
+	codeAccessRequest = 1
+	codeAccessAccept  = 2
+	codeAccessReject  = 3
+
+	attrUserName             = 1
+	attrUserPassword         = 2
+	attrServiceType          = 6
+	attrCallingStationID     = 31
+	attrNASIdentifier        = 32
+	attrMessageAuthenticator = 80
+
+	serviceTypeCallCheck = 10
+
+	headerLength     = 20
+	maxPacketLength  = 4096
+	authenticatorLen = 16
+)
+
+var errNoAnswer = errors.New("no RADIUS server answered")
+
+// radiusClient authenticates MAC addresses the MAC Authentication Bypass way:
+// user name and password are the MAC address in lower case hex without separators.
+type radiusClient struct {
+	servers       []string
+	secret        []byte
+	timeout       time.Duration
+	nasIdentifier string
+}
+
+// authenticate asks the servers in order until one of them answers and reports
+// whether it accepted the MAC address. It fails with errNoAnswer if none answered.
+func (c *radiusClient) authenticate(mac net.HardwareAddr) (bool, error) {
+	var errs []error
+	for _, server := range c.servers {
+		accepted, err := c.exchange(server, mac)
+		if err == nil {
+			return accepted, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", server, err))
+	}
+	return false, fmt.Errorf("%w: %w", errNoAnswer, errors.Join(errs...))
+}
+
+func (c *radiusClient) exchange(server string, mac net.HardwareAddr) (bool, error) {
+	request, err := c.accessRequest(mac)
+	if err != nil {
+		return false, err
+	}
+
+	conn, err := net.Dial("udp", server)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	if err := conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return false, err
+	}
+	if _, err := conn.Write(request); err != nil {
+		return false, err
+	}
+
+	buf := make([]byte, maxPacketLength)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return false, err
+		}
+		code, err := c.verifyResponse(buf[:n], request)
+		if err != nil {
+			// not an answer to our request, keep waiting until the deadline
+			continue
+		}
+		switch code {
+		case codeAccessAccept:
+			return true, nil
+		case codeAccessReject:
+			return false, nil
+		default:
+			return false, fmt.Errorf("unexpected response code %d", code)
+		}
+	}
+}
+
+// accessRequest builds an Access-Request for the MAC address, protected by a
+// Message-Authenticator.
+func (c *radiusClient) accessRequest(mac net.HardwareAddr) ([]byte, error) {
+	header := make([]byte, headerLength)
+	header[0] = codeAccessRequest
+	if _, err := rand.Read(header[1:2]); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(header[4:headerLength]); err != nil {
+		return nil, err
+	}
+	authenticator := header[4:headerLength]
+
+	user := strings.ReplaceAll(mac.String(), ":", "")
+	packet := bytes.NewBuffer(header)
+	// the Message-Authenticator goes first, its value is filled in last
+	writeAttribute(packet, attrMessageAuthenticator, make([]byte, md5.Size))
+	writeAttribute(packet, attrUserName, []byte(user))
+	writeAttribute(packet, attrUserPassword, hidePassword([]byte(user), c.secret, authenticator))
+	writeAttribute(packet, attrServiceType, binary.BigEndian.AppendUint32(nil, serviceTypeCallCheck))
+	writeAttribute(packet, attrCallingStationID,
+		[]byte(strings.ToUpper(strings.ReplaceAll(mac.String(), ":", "-"))))
+	writeAttribute(packet, attrNASIdentifier, []byte(c.nasIdentifier))
+
+	data := packet.Bytes()
+	binary.BigEndian.PutUint16(data[2:4], uint16(len(data)))
+	copy(data[headerLength+2:], messageAuthenticator(data, c.secret))
+	return data, nil
+}
+
+// verifyResponse checks that the packet answers the request and returns its code.
+func (c *radiusClient) verifyResponse(response, request []byte) (byte, error) {
+	if len(response) < headerLength {
+		return 0, fmt.Errorf("response too short")
+	}
+	length := int(binary.BigEndian.Uint16(response[2:4]))
+	if length < headerLength || length > len(response) {
+		return 0, fmt.Errorf("invalid response length %d", length)
+	}
+	response = response[:length]
+	if response[1] != request[1] {
+		return 0, fmt.Errorf("response identifier %d does not match request %d", response[1], request[1])
+	}
+
+	// Response Authenticator = MD5(Code+ID+Length+RequestAuth+Attributes+Secret)
+	hash := md5.New()
+	hash.Write(response[:4])
+	hash.Write(request[4:headerLength])
+	hash.Write(response[headerLength:])
+	hash.Write(c.secret)
+	if !hmac.Equal(hash.Sum(nil), response[4:headerLength]) {
+		return 0, fmt.Errorf("invalid response authenticator")
+	}
+
+	// a Message-Authenticator is computed over the response carrying the request authenticator
+	if offset := findAttribute(response, attrMessageAuthenticator); offset >= 0 {
+		check := bytes.Clone(response)
+		copy(check[4:headerLength], request[4:headerLength])
+		received := bytes.Clone(check[offset : offset+md5.Size])
+		clear(check[offset : offset+md5.Size])
+		if !hmac.Equal(received, messageAuthenticator(check, c.secret)) {
+			return 0, fmt.Errorf("invalid message authenticator")
+		}
+	}
+	return response[0], nil
+}
+
+func writeAttribute(packet *bytes.Buffer, attrType byte, value []byte) {
+	packet.WriteByte(attrType)
+	packet.WriteByte(byte(len(value) + 2))
+	packet.Write(value)
+}
+
+// findAttribute returns the offset of the value of the first attribute of the
+// given type, or -1 if there is none.
+func findAttribute(packet []byte, attrType byte) int {
+	for offset := headerLength; offset+2 <= len(packet); {
+		length := int(packet[offset+1])
+		if length < 2 || offset+length > len(packet) {
+			return -1
+		}
+		if packet[offset] == attrType {
+			return offset + 2
+		}
+		offset += length
+	}
+	return -1
+}
+
+// messageAuthenticator computes the HMAC-MD5 of the packet, see RFC 3579, section 3.2.
+func messageAuthenticator(packet, secret []byte) []byte {
+	mac := hmac.New(md5.New, secret)
+	mac.Write(packet)
+	return mac.Sum(nil)
+}
+
+// hidePassword encrypts the User-Password, see RFC 2865, section 5.2.
+func hidePassword(password, secret, authenticator []byte) []byte {
+	padded := make([]byte, (len(password)+authenticatorLen-1)/authenticatorLen*authenticatorLen)
+	copy(padded, password)
+
+	previous := authenticator
+	for i := 0; i < len(padded); i += authenticatorLen {
+		hash := md5.Sum(append(bytes.Clone(secret), previous...))
+		for j := range authenticatorLen {
+			padded[i+j] ^= hash[j]
+		}
+		previous = padded[i : i+authenticatorLen]
+	}
+	return padded
+}
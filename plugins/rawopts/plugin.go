@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package rawopts
+
+import (
+	"fmt"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/ironcore-dev/fedhcp/internal/rawopts"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logger.GetLogger("plugins/rawopts")
+
+var Plugin = plugins.Plugin{
+	Name:   "rawopts",
+	Setup4: setup4,
+	Setup6: setup6,
+}
+
+type option struct {
+	rawopts.Option
+	// whenPresent is the code of the option a request has to carry, 0 for all requests
+	whenPresent uint16
+}
+
+// plugin holds the state of a single rawopts plugin instance. It is built
+// once in setup and never modified afterwards.
+type plugin struct {
+	options []option
+	log     *logrus.Entry
+}
+
+// args[0] = path to config file
+func parseArgs(args ...string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("exactly one argument must be passed to the rawopts plugin, got %d", len(args))
+	}
+	return args[0], nil
+}
+
+func loadConfig(args ...string) (*api.RawOptsConfig, error) {
+	path, err := parseArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	log.Debugf("Reading config file %s", path)
+	config := &api.RawOptsConfig{}
+	if err := api.Load(path, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// newPlugin parses the options, their codes have to be at most maxCode.
+func newPlugin(name string, maxCode uint16, args ...string) (*plugin, error) {
+	config, err := loadConfig(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(config.Options) == 0 {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("at least one option must be configured")}
+	}
+	p := &plugin{log: instance.Logger(log, name)}
+	for _, oc := range config.Options {
+		if oc.Code == 0 || oc.Code > maxCode {
+			return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("option code %d must be between 1 and %d", oc.Code, maxCode)}
+		}
+		if oc.WhenPresent > maxCode {
+			return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("option %d: whenPresent %d must be at most %d", oc.Code, oc.WhenPresent, maxCode)}
+		}
+		data, err := rawopts.Decode(oc.Hex, oc.Base64)
+		if err != nil {
+			return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("option %d: %w", oc.Code, err)}
+		}
+		p.options = append(p.options, option{
+			Option:      rawopts.Option{Code: oc.Code, Data: data},
+			whenPresent: oc.WhenPresent,
+		})
+	}
+	return p, nil
+}
+
+func setup6(args ...string) (handler.Handler6, error) {
+	p, err := newPlugin("rawopts/v6", 0xffff, args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded rawopts plugin for DHCPv6 with %d options.", len(p.options))
+	return p.handler6, nil
+}
+
+func setup4(args ...string) (handler.Handler4, error) {
+	p, err := newPlugin("rawopts/v4", rawopts.MaxCode4, args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded rawopts plugin for DHCPv4 with %d options.", len(p.options))
+	return p.handler4, nil
+}
+
+func (p *plugin) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	m, err := req.GetInnerMessage()
+	if err != nil {
+		p.log.Errorf("Could not decapsulate request: %v", err)
+		return resp, false
+	}
+
+	if unknown := rawopts.Unknown6(m); len(unknown) > 0 {
+		p.log.Debugf("Unknown options of %s: %v", req.Summary(), unknown)
+	}
+	for _, o := range p.options {
+		if o.whenPresent != 0 && !rawopts.Has6(m, o.whenPresent) {
+			continue
+		}
+		if err := rawopts.Add6(resp, o.Option); err != nil {
+			p.log.Errorf("Could not add option %d: %v", o.Code, err)
+			continue
+		}
+		p.log.Debugf("Added option %s for %s", o.Option, req.Summary())
+	}
+	return resp, false
+}
+
+func (p *plugin) handler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	if unknown := rawopts.Unknown4(req); len(unknown) > 0 {
+		p.log.Debugf("Unknown options of %s: %v", req.ClientHWAddr, unknown)
+	}
+	for _, o := range p.options {
+		if o.whenPresent != 0 && !rawopts.Has4(req, o.whenPresent) {
+			continue
+		}
+		if err := rawopts.Add4(resp, o.Option); err != nil {
+			p.log.Errorf("Could not add option %d: %v", o.Code, err)
+			continue
+		}
+		p.log.Debugf("Added option %s for %s", o.Option, req.ClientHWAddr)
+	}
+	return resp, false
+}
@@ -0,0 +1,125 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package rawopts
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/api/apitest"
+	"github.com/ironcore-dev/fedhcp/internal/rawopts"
+)
+
+var mac = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+
+var config = api.RawOptsConfig{Options: []api.RawOption{
+	{Code: 224, Hex: "0a0b"},
+	{Code: 225, Base64: "aGVsbG8=", WhenPresent: 224},
+}}
+
+func Init(t *testing.T, maxCode uint16) *plugin {
+	p, err := newPlugin("rawopts/test", maxCode, apitest.WriteConfig(t, config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestWrongNumberArgs(t *testing.T) {
+	_, err := setup4()
+	if err == nil {
+		t.Fatal("no error occurred when not providing a configuration file path, but it should have")
+	}
+
+	_, err = setup6("foo", "bar")
+	if err == nil {
+		t.Fatal("no error occurred when providing wrong number of args (2), but it should have")
+	}
+}
+
+func TestWrongArgs(t *testing.T) {
+	for _, config := range []api.RawOptsConfig{
+		{},
+		{Options: []api.RawOption{{Hex: "00"}}},
+		{Options: []api.RawOption{{Code: 224}}},
+		{Options: []api.RawOption{{Code: 224, Hex: "00", Base64: "AA=="}}},
+		{Options: []api.RawOption{{Code: 224, Hex: "xyz"}}},
+	} {
+		if _, err := setup6(apitest.WriteConfig(t, config)); err == nil {
+			t.Errorf("no error occurred for invalid config %+v, but it should have", config)
+		}
+	}
+
+	// codes not fitting the one byte codes of DHCPv4
+	for _, config := range []api.RawOptsConfig{
+		{Options: []api.RawOption{{Code: 255, Hex: "00"}}},
+		{Options: []api.RawOption{{Code: 224, Hex: "00", WhenPresent: 300}}},
+	} {
+		if _, err := setup6(apitest.WriteConfig(t, config)); err != nil {
+			t.Errorf("unexpected error for config valid in DHCPv6 %+v: %v", config, err)
+		}
+		if _, err := setup4(apitest.WriteConfig(t, config)); err == nil {
+			t.Errorf("no error occurred for config invalid in DHCPv4 %+v, but it should have", config)
+		}
+	}
+}
+
+/* IPv6 */
+func TestRawOpts6(t *testing.T) {
+	p := Init(t, 0xffff)
+
+	req, _ := dhcpv6.NewSolicit(mac)
+	resp, _ := dhcpv6.NewAdvertiseFromSolicit(req)
+	result, stop := p.handler6(req, resp)
+	if stop {
+		t.Fatal("plugin must not break the chain")
+	}
+	m := result.(*dhcpv6.Message)
+	if data := rawopts.Get6(m, 224); len(data) != 1 || !bytes.Equal(data[0], []byte{0x0a, 0x0b}) {
+		t.Errorf("expected option 224 with payload 0a0b, got %x", data)
+	}
+	if rawopts.Has6(m, 225) {
+		t.Error("expected no option 225 for a request without option 224")
+	}
+
+	req.AddOption(&dhcpv6.OptionGeneric{OptionCode: 224, OptionData: []byte{0x01}})
+	relayed, err := dhcpv6.EncapsulateRelay(req, dhcpv6.MessageTypeRelayForward, net.IPv6loopback, net.IPv6loopback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, _ = dhcpv6.NewAdvertiseFromSolicit(req)
+	result, _ = p.handler6(relayed, resp)
+	if data := rawopts.Get6(result.(*dhcpv6.Message), 225); len(data) != 1 || string(data[0]) != "hello" {
+		t.Errorf("expected option 225 with payload hello for a relayed request with option 224, got %q", data)
+	}
+}
+
+/* IPv4 */
+func TestRawOpts4(t *testing.T) {
+	p := Init(t, rawopts.MaxCode4)
+
+	req, _ := dhcpv4.NewDiscovery(mac)
+	resp, _ := dhcpv4.NewReplyFromRequest(req)
+	result, stop := p.handler4(req, resp)
+	if stop {
+		t.Fatal("plugin must not break the chain")
+	}
+	if data := rawopts.Get4(result, 224); !bytes.Equal(data, []byte{0x0a, 0x0b}) {
+		t.Errorf("expected option 224 with payload 0a0b, got %x", data)
+	}
+	if rawopts.Has4(result, 225) {
+		t.Error("expected no option 225 for a request without option 224")
+	}
+
+	req.UpdateOption(dhcpv4.OptGeneric(dhcpv4.GenericOptionCode(224), []byte{0x01}))
+	resp, _ = dhcpv4.NewReplyFromRequest(req)
+	result, _ = p.handler4(req, resp)
+	if data := rawopts.Get4(result, 225); string(data) != "hello" {
+		t.Errorf("expected option 225 with payload hello for a request with option 224, got %q", data)
+	}
+}
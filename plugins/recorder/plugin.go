@@ -0,0 +1,317 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/admin"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/cache"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/ironcore-dev/fedhcp/internal/journal"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/ironcore-dev/fedhcp/internal/subnetmatch"
+	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var log = logger.GetLogger("plugins/recorder")
+
+var Plugin = plugins.Plugin{
+	Name:   "recorder",
+	Setup4: setup4,
+	Setup6: setup6,
+}
+
+const (
+	origin        = "fedhcp"
+	recordedLabel = "fedhcp.ironcore.dev/recorded"
+
+	// maxRecorded bounds the remembered pairs, recordedTTL makes pairs forgotten
+	// e.g. after their IP was deleted get recorded again on renewal
+	maxRecorded = 65536
+	recordedTTL = time.Hour
+)
+
+// plugin holds the state of a single recorder plugin instance.
+type plugin struct {
+	namespace string
+	subnets   []string
+	labels    map[string]string
+	log       *logrus.Entry
+	// run runs the recording of a response, in the background unless replaced in tests
+	run func(func())
+
+	// recorded holds the MAC address and IP pairs already recorded, so renewals
+	// don't hit the kubernetes API
+	recorded *cache.Cache[string, struct{}]
+}
+
+// args[0] = path to config file
+func parseArgs(args ...string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("exactly one argument must be passed to the recorder plugin, got %d", len(args))
+	}
+	return args[0], nil
+}
+
+func loadConfig(args ...string) (*api.RecorderConfig, error) {
+	path, err := parseArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	log.Debugf("Reading config file %s", path)
+	config := &api.RecorderConfig{}
+	if err := api.Load(path, config); err != nil {
+		return nil, err
+	}
+
+	if config.Namespace == "" {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("namespace must be configured")}
+	}
+	if len(config.Subnets) == 0 {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("at least one subnet must be configured")}
+	}
+
+	return config, nil
+}
+
+func newPlugin(name string, args ...string) (*plugin, error) {
+	config, err := loadConfig(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	name = instance.Next(name)
+	p := &plugin{
+		namespace: config.Namespace,
+		subnets:   config.Subnets,
+		labels:    config.Labels,
+		log:       log.WithField("instance", name),
+		run:       func(f func()) { go f() },
+		recorded:  cache.New[string, struct{}](name+"/recorded", maxRecorded, recordedTTL),
+	}
+	admin.State(name, p.state)
+	return p, nil
+}
+
+func setup6(args ...string) (handler.Handler6, error) {
+	p, err := newPlugin("recorder/v6", args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded recorder plugin for DHCPv6 recording to subnets %s.", strings.Join(p.subnets, ", "))
+	return p.handler6, nil
+}
+
+func setup4(args ...string) (handler.Handler4, error) {
+	p, err := newPlugin("recorder/v4", args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded recorder plugin for DHCPv4 recording to subnets %s.", strings.Join(p.subnets, ", "))
+	return p.handler4, nil
+}
+
+func (p *plugin) state() any {
+	return map[string]int{"recorded": p.recorded.Len()}
+}
+
+// record reserves the address for the MAC address in the IPAM subnet containing
+// it, unless it is already reserved for the MAC address. The IPs recorded
+// before that it supersedes are released first, see stale.
+func (p *plugin) record(mac net.HardwareAddr, ipaddr net.IP, current []net.IP) error {
+	macKey := strings.ReplaceAll(mac.String(), ":", "")
+	key := recordedKey(macKey, ipaddr)
+	if _, ok := p.recorded.Get(key); ok {
+		return nil
+	}
+
+	cl := kubernetes.GetClient()
+	if cl == nil {
+		return &fedhcperrors.K8sUnavailable{Err: fmt.Errorf("kubernetes client not initialized")}
+	}
+	ctx := context.Background()
+
+	addr, ok := subnetmatch.Addr(ipaddr)
+	if !ok {
+		return fmt.Errorf("invalid IP address %s", ipaddr)
+	}
+	subnetName, err := p.matchingSubnet(ctx, cl, ipaddr)
+	if err != nil {
+		return err
+	}
+	if subnetName == "" {
+		p.log.Debugf("Address %s is on none of the subnets, not recording", ipaddr)
+		return nil
+	}
+
+	ips := &ipamv1alpha1.IPList{}
+	if err := cl.List(ctx, ips, client.InNamespace(p.namespace), client.MatchingLabels{"mac": macKey}); err != nil {
+		return fmt.Errorf("failed to list IPs with MAC %s: %w", macKey, fedhcperrors.FromK8s(err))
+	}
+	for _, ip := range ips.Items {
+		if ip.Spec.Subnet.Name == subnetName && ip.Spec.IP != nil && ip.Spec.IP.Net == addr &&
+			ip.Status.State != ipamv1alpha1.CFailedIPState {
+			p.recorded.Put(key, struct{}{})
+			return nil
+		}
+	}
+	if err := p.releaseStale(ctx, cl, macKey, subnetName, addr, current); err != nil {
+		return err
+	}
+
+	labels := map[string]string{
+		"mac":         macKey,
+		"origin":      origin,
+		recordedLabel: "true",
+	}
+	for k, v := range p.labels {
+		labels[k] = v
+	}
+	ip := &ipamv1alpha1.IP{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: macKey + "-" + origin + "-",
+			Namespace:    p.namespace,
+			Labels:       labels,
+		},
+		Spec: ipamv1alpha1.IPSpec{
+			IP:     &ipamv1alpha1.IPAddr{Net: addr},
+			Subnet: corev1.LocalObjectReference{Name: subnetName},
+		},
+	}
+	tx := journal.Begin(journal.KindIP, p.namespace)
+	defer tx.End()
+	tx.Label(ip)
+	if err := cl.Create(ctx, ip); err != nil {
+		return fmt.Errorf("failed to create IP %s: %w", ipaddr, fedhcperrors.FromK8s(err))
+	}
+	p.recorded.Put(key, struct{}{})
+	p.log.Infof("Recorded IP %s (%s/%s) for mac %s in subnet %s", ipaddr, ip.Namespace, ip.Name, mac, subnetName)
+	return nil
+}
+
+// releaseStale deletes the IPs recorded before that the address of the MAC
+// address in the subnet supersedes, see stale. Only recorded IPs are deleted,
+// never those of other allocators.
+func (p *plugin) releaseStale(ctx context.Context, cl client.Client, macKey, subnetName string, addr netip.Addr, current []net.IP) error {
+	ips := &ipamv1alpha1.IPList{}
+	if err := cl.List(ctx, ips, client.InNamespace(p.namespace), client.MatchingLabels{recordedLabel: "true"}); err != nil {
+		return fmt.Errorf("failed to list recorded IPs: %w", fedhcperrors.FromK8s(err))
+	}
+	for i := range ips.Items {
+		ip := &ips.Items[i]
+		if ip.Spec.Subnet.Name != subnetName || ip.Spec.IP == nil || !stale(ip, macKey, addr, current) {
+			continue
+		}
+		if err := cl.Delete(ctx, ip); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to release IP %s/%s: %w", ip.Namespace, ip.Name, fedhcperrors.FromK8s(err))
+		}
+		p.recorded.Delete(recordedKey(ip.Labels["mac"], net.IP(ip.Spec.IP.Net.AsSlice())))
+		p.log.Infof("Released IP %s (%s/%s) of mac %s superseded by %s of mac %s", ip.Spec.IP, ip.Namespace, ip.Name,
+			ip.Labels["mac"], addr, macKey)
+	}
+	return nil
+}
+
+// stale returns whether the recorded IP is superseded by the address of the MAC
+// address in its subnet, current holding all addresses acknowledged to the
+// MAC address: the IP is of the MAC address with none of the current addresses,
+// i.e. the client moved to another address, or it is of another MAC address
+// with the address, i.e. the address moved to another client. A failed IP of
+// the address is stale as well, so it is recorded anew.
+func stale(ip *ipamv1alpha1.IP, macKey string, addr netip.Addr, current []net.IP) bool {
+	if ip.Spec.IP.Net == addr {
+		return ip.Labels["mac"] != macKey || ip.Status.State == ipamv1alpha1.CFailedIPState
+	}
+	if ip.Labels["mac"] != macKey {
+		return false
+	}
+	return !slices.ContainsFunc(current, func(c net.IP) bool {
+		a, ok := subnetmatch.Addr(c)
+		return ok && a == ip.Spec.IP.Net
+	})
+}
+
+// recordedKey returns the key of the MAC address and address pair in the
+// remembered pairs.
+func recordedKey(macKey string, ipaddr net.IP) string {
+	return macKey + "/" + ipaddr.String()
+}
+
+// matchingSubnet returns the name of the configured subnet containing the address, if any.
+func (p *plugin) matchingSubnet(ctx context.Context, cl client.Client, ipaddr net.IP) (string, error) {
+	for _, name := range p.subnets {
+		subnet := &ipamv1alpha1.Subnet{}
+		if err := cl.Get(ctx, client.ObjectKey{Namespace: p.namespace, Name: name}, subnet); err != nil {
+			return "", fmt.Errorf("failed to get subnet %s/%s: %w", p.namespace, name, fedhcperrors.FromK8s(err))
+		}
+		if subnetmatch.Subnet(subnet, ipaddr) {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+func (p *plugin) recordAll(mac net.HardwareAddr, addresses []net.IP) {
+	p.run(func() {
+		for _, ipaddr := range addresses {
+			if err := p.record(mac, ipaddr, addresses); err != nil {
+				p.log.WithFields(fedhcperrors.Fields(err)).Errorf("Could not record IP %s for mac %s: %s", ipaddr, mac, err)
+			}
+		}
+	})
+}
+
+func (p *plugin) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	reply, ok := resp.(*dhcpv6.Message)
+	if !ok || reply.Type() != dhcpv6.MessageTypeReply {
+		return resp, false
+	}
+
+	var addresses []net.IP
+	for _, iana := range reply.Options.IANA() {
+		for _, addr := range iana.Options.Addresses() {
+			addresses = append(addresses, addr.IPv6Addr)
+		}
+	}
+	if len(addresses) == 0 {
+		return resp, false
+	}
+
+	mac, err := dhcpv6.ExtractMAC(req)
+	if err != nil {
+		p.log.Errorf("Could not determine MAC address of %s, not recording: %v", req.Summary(), err)
+		return resp, false
+	}
+	p.recordAll(mac, addresses)
+	return resp, false
+}
+
+func (p *plugin) handler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	if resp.MessageType() != dhcpv4.MessageTypeAck || resp.YourIPAddr.IsUnspecified() {
+		return resp, false
+	}
+
+	p.recordAll(req.ClientHWAddr, []net.IP{resp.YourIPAddr})
+	return resp, false
+}
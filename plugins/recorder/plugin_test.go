@@ -0,0 +1,287 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package recorder
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/api/apitest"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes/fake"
+	ipamv1alpha1 "github.com/ironcore-dev/ipam/api/ipam/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const namespace = "default"
+
+var mac = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+
+// Init returns a plugin recording synchronously to a fake client seeded with
+// an IPv4 and an IPv6 subnet.
+func Init(t *testing.T, sources ...fake.ObjectSource) (*plugin, client.Client) {
+	ipam := fake.NewIPAM(namespace).
+		WithSubnet("range4", "192.168.0.0/24", nil).
+		WithSubnet("range6", "2001:db8::/64", nil)
+	var cl client.Client = fake.NewClient(append(sources, ipam)...)
+	kubernetes.SetClient(&cl)
+	t.Cleanup(func() { kubernetes.SetClient(new(client.Client)) })
+
+	p, err := newPlugin("recorder/test", apitest.WriteConfig(t, api.RecorderConfig{
+		Namespace: namespace,
+		Subnets:   []string{"range4", "range6"},
+		Labels:    map[string]string{"team": "network"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.run = func(f func()) { f() }
+	return p, cl
+}
+
+func recordedIPs(t *testing.T, cl client.Client) []ipamv1alpha1.IP {
+	ips := &ipamv1alpha1.IPList{}
+	if err := cl.List(context.Background(), ips, client.InNamespace(namespace), client.MatchingLabels{recordedLabel: "true"}); err != nil {
+		t.Fatal(err)
+	}
+	return ips.Items
+}
+
+func TestWrongNumberArgs(t *testing.T) {
+	_, err := setup4()
+	if err == nil {
+		t.Fatal("no error occurred when not providing a configuration file path, but it should have")
+	}
+
+	_, err = setup6("foo", "bar")
+	if err == nil {
+		t.Fatal("no error occurred when providing wrong number of args (2), but it should have")
+	}
+}
+
+func TestWrongArgs(t *testing.T) {
+	for _, config := range []api.RecorderConfig{
+		{},
+		{Namespace: namespace},
+		{Subnets: []string{"range4"}},
+	} {
+		if _, err := setup4(apitest.WriteConfig(t, config)); err == nil {
+			t.Fatalf("no error occurred when providing config %+v, but it should have", config)
+		}
+	}
+
+	if _, err := setup4("/does/not/exist"); err == nil {
+		t.Fatal("no error occurred when providing a missing config file, but it should have")
+	}
+}
+
+/* IPv6 */
+func TestRecordReply6(t *testing.T) {
+	p, cl := Init(t)
+
+	req, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.MessageType = dhcpv6.MessageTypeRequest
+	req.AddOption(dhcpv6.OptClientID(&dhcpv6.DUIDLL{HWType: 1, LinkLayerAddr: mac}))
+	resp, err := dhcpv6.NewReplyFromMessage(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.AddOption(&dhcpv6.OptIANA{
+		IaId: [4]byte{0, 0, 0, 1},
+		Options: dhcpv6.IdentityOptions{Options: dhcpv6.Options{
+			&dhcpv6.OptIAAddress{IPv6Addr: net.ParseIP("2001:db8::10")},
+		}},
+	})
+
+	result, stop := p.handler6(req, resp)
+	if stop || result != resp {
+		t.Fatal("recorder must not change the response or stop the chain")
+	}
+
+	ips := recordedIPs(t, cl)
+	if len(ips) != 1 {
+		t.Fatalf("expected one recorded IP, got %d", len(ips))
+	}
+	if ips[0].Spec.IP.String() != "2001:db8::10" || ips[0].Spec.Subnet.Name != "range6" {
+		t.Errorf("unexpected IP %s in subnet %s", ips[0].Spec.IP, ips[0].Spec.Subnet.Name)
+	}
+	if ips[0].Labels["mac"] != "001a2b3c4d5e" || ips[0].Labels["team"] != "network" {
+		t.Errorf("unexpected labels %v", ips[0].Labels)
+	}
+}
+
+func TestNoRecordAdvertise6(t *testing.T) {
+	p, cl := Init(t)
+
+	req, err := dhcpv6.NewSolicit(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := dhcpv6.NewAdvertiseFromSolicit(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.AddOption(&dhcpv6.OptIANA{
+		Options: dhcpv6.IdentityOptions{Options: dhcpv6.Options{
+			&dhcpv6.OptIAAddress{IPv6Addr: net.ParseIP("2001:db8::10")},
+		}},
+	})
+
+	p.handler6(req, resp)
+	if ips := recordedIPs(t, cl); len(ips) != 0 {
+		t.Fatalf("advertised address must not be recorded, got %d IPs", len(ips))
+	}
+}
+
+/* IPv4 */
+func newAck(t *testing.T, yourIP string) (*dhcpv4.DHCPv4, *dhcpv4.DHCPv4) {
+	req, err := dhcpv4.NewDiscovery(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeRequest))
+	resp, err := dhcpv4.NewReplyFromRequest(req, dhcpv4.WithMessageType(dhcpv4.MessageTypeAck))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.YourIPAddr = net.ParseIP(yourIP)
+	return req, resp
+}
+
+func TestRecordAck4(t *testing.T) {
+	p, cl := Init(t)
+
+	req, resp := newAck(t, "192.168.0.42")
+	result, stop := p.handler4(req, resp)
+	if stop || result != resp {
+		t.Fatal("recorder must not change the response or stop the chain")
+	}
+	// a renewal is not recorded twice
+	p.handler4(req, resp)
+
+	ips := recordedIPs(t, cl)
+	if len(ips) != 1 {
+		t.Fatalf("expected one recorded IP, got %d", len(ips))
+	}
+	if ips[0].Spec.IP.String() != "192.168.0.42" || ips[0].Spec.Subnet.Name != "range4" {
+		t.Errorf("unexpected IP %s in subnet %s", ips[0].Spec.IP, ips[0].Spec.Subnet.Name)
+	}
+}
+
+func TestAlreadyReserved4(t *testing.T) {
+	p, cl := Init(t, fake.NewIPAM(namespace).WithIP("range4", "192.168.0.42", mac))
+
+	req, resp := newAck(t, "192.168.0.42")
+	p.handler4(req, resp)
+
+	if ips := recordedIPs(t, cl); len(ips) != 0 {
+		t.Fatalf("address already reserved for the MAC address must not be recorded, got %d IPs", len(ips))
+	}
+}
+
+func TestOutsideSubnets4(t *testing.T) {
+	p, cl := Init(t)
+
+	req, resp := newAck(t, "10.0.0.1")
+	p.handler4(req, resp)
+
+	if ips := recordedIPs(t, cl); len(ips) != 0 {
+		t.Fatalf("address outside of the subnets must not be recorded, got %d IPs", len(ips))
+	}
+}
+
+func TestNoRecordOffer4(t *testing.T) {
+	p, cl := Init(t)
+
+	req, resp := newAck(t, "192.168.0.42")
+	resp.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeOffer))
+	p.handler4(req, resp)
+
+	if ips := recordedIPs(t, cl); len(ips) != 0 {
+		t.Fatalf("offered address must not be recorded, got %d IPs", len(ips))
+	}
+}
+
+func TestMoved4(t *testing.T) {
+	other := net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5f}
+	// an IP of another allocator is never released
+	p, cl := Init(t, fake.NewIPAM(namespace).WithIP("range4", "192.168.0.41", mac))
+
+	req, resp := newAck(t, "192.168.0.42")
+	p.handler4(req, resp)
+	// the client moves to another address
+	req, resp = newAck(t, "192.168.0.43")
+	p.handler4(req, resp)
+	// the address moves to another client
+	req, resp = newAck(t, "192.168.0.43")
+	req.ClientHWAddr = other
+	p.handler4(req, resp)
+
+	ips := recordedIPs(t, cl)
+	if len(ips) != 1 || ips[0].Spec.IP.String() != "192.168.0.43" || ips[0].Labels["mac"] != "001a2b3c4d5f" {
+		t.Fatalf("expected only 192.168.0.43 recorded for %s, got %+v", other, ips)
+	}
+	all := &ipamv1alpha1.IPList{}
+	if err := cl.List(context.Background(), all, client.InNamespace(namespace)); err != nil {
+		t.Fatal(err)
+	}
+	if len(all.Items) != 2 {
+		t.Errorf("expected the IP of the other allocator to be kept, got %d IPs", len(all.Items))
+	}
+
+	// the first client returns to its first address, which is recorded again
+	req, resp = newAck(t, "192.168.0.42")
+	p.handler4(req, resp)
+	if ips := recordedIPs(t, cl); len(ips) != 2 {
+		t.Errorf("expected both clients recorded, got %d IPs", len(ips))
+	}
+}
+
+func TestMultipleAddresses6(t *testing.T) {
+	p, cl := Init(t)
+
+	req, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.MessageType = dhcpv6.MessageTypeRequest
+	req.AddOption(dhcpv6.OptClientID(&dhcpv6.DUIDLL{HWType: 1, LinkLayerAddr: mac}))
+	reply := func(addrs ...string) *dhcpv6.Message {
+		resp, err := dhcpv6.NewReplyFromMessage(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, addr := range addrs {
+			resp.AddOption(&dhcpv6.OptIANA{
+				IaId:    [4]byte{0, 0, 0, byte(i)},
+				Options: dhcpv6.IdentityOptions{Options: dhcpv6.Options{&dhcpv6.OptIAAddress{IPv6Addr: net.ParseIP(addr)}}},
+			})
+		}
+		return resp
+	}
+
+	// the addresses of the same reply don't release each other
+	p.handler6(req, reply("2001:db8::10", "2001:db8::11"))
+	if ips := recordedIPs(t, cl); len(ips) != 2 {
+		t.Fatalf("expected two recorded IPs, got %d", len(ips))
+	}
+	p.handler6(req, reply("2001:db8::11", "2001:db8::12"))
+	ips := recordedIPs(t, cl)
+	var addrs []string
+	for _, ip := range ips {
+		addrs = append(addrs, ip.Spec.IP.String())
+	}
+	slices.Sort(addrs)
+	if !slices.Equal(addrs, []string{"2001:db8::11", "2001:db8::12"}) {
+		t.Errorf("expected 2001:db8::10 to be released, got %v", addrs)
+	}
+}
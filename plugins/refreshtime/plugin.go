@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package refreshtime
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logger.GetLogger("plugins/refreshtime")
+
+var Plugin = plugins.Plugin{
+	Name:   "refreshtime",
+	Setup6: setup6,
+}
+
+// minimum is IRT_MINIMUM of RFC 8415, clients refresh no sooner anyway.
+const minimum = 600 * time.Second
+
+type plugin struct {
+	refreshTime time.Duration
+	log         *logrus.Entry
+}
+
+// args[0] = information refresh time, e.g. 6h
+func parseArgs(args ...string) (time.Duration, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("exactly one argument must be passed to the refreshtime plugin, got %d", len(args))
+	}
+	d, err := time.ParseDuration(args[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid information refresh time %s: %w", args[0], err)
+	}
+	if d < minimum {
+		return 0, fmt.Errorf("information refresh time %s is below the minimum of %s", d, minimum)
+	}
+	return d, nil
+}
+
+func setup6(args ...string) (handler.Handler6, error) {
+	refreshTime, err := parseArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	p := &plugin{
+		refreshTime: refreshTime,
+		log:         log.WithField("instance", instance.Next("refreshtime/v6")),
+	}
+	p.log.Printf("Loaded refreshtime plugin for DHCPv6 with %s.", p.refreshTime)
+	return p.handler6, nil
+}
+
+// handler6 adds the information refresh time to the replies to
+// Information-Requests, the only ones it is valid in.
+func (p *plugin) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	m, err := req.GetInnerMessage()
+	if err != nil {
+		p.log.Errorf("Could not decapsulate request: %v", err)
+		return resp, false
+	}
+	if m.MessageType != dhcpv6.MessageTypeInformationRequest {
+		return resp, false
+	}
+	reply, ok := resp.(*dhcpv6.Message)
+	if !ok || reply.MessageType != dhcpv6.MessageTypeReply {
+		return resp, false
+	}
+
+	reply.UpdateOption(dhcpv6.OptInformationRefreshTime(p.refreshTime))
+	return resp, false
+}
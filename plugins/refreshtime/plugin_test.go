@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package refreshtime
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+var mac = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+
+func Init(t *testing.T) handler.Handler6 {
+	h, err := setup6("6h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func request(t *testing.T, msgType dhcpv6.MessageType) (*dhcpv6.Message, *dhcpv6.Message) {
+	req, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.MessageType = msgType
+	req.AddOption(dhcpv6.OptClientID(&dhcpv6.DUIDLL{HWType: 1, LinkLayerAddr: mac}))
+	resp, err := dhcpv6.NewReplyFromMessage(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req, resp
+}
+
+func TestWrongNumberArgs(t *testing.T) {
+	if _, err := setup6(); err == nil {
+		t.Fatal("no error occurred when not providing a refresh time, but it should have")
+	}
+	if _, err := setup6("6h", "foo"); err == nil {
+		t.Fatal("no error occurred when providing wrong number of args (2), but it should have")
+	}
+}
+
+func TestWrongArgs(t *testing.T) {
+	for _, arg := range []string{"foo", "5m", "-1h"} {
+		if _, err := setup6(arg); err == nil {
+			t.Fatalf("no error occurred when providing refresh time %s, but it should have", arg)
+		}
+	}
+}
+
+func TestInformationRequest(t *testing.T) {
+	h := Init(t)
+
+	req, resp := request(t, dhcpv6.MessageTypeInformationRequest)
+	relayed, err := dhcpv6.EncapsulateRelay(req, dhcpv6.MessageTypeRelayForward, net.ParseIP("2001:db8::1"), net.ParseIP("fe80::1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, stop := h(relayed, resp)
+	if stop {
+		t.Fatal("refreshtime must not stop the chain")
+	}
+	if refreshTime := result.(*dhcpv6.Message).Options.InformationRefreshTime(0); refreshTime != 6*time.Hour {
+		t.Errorf("expected information refresh time 6h, got %s", refreshTime)
+	}
+}
+
+func TestStatefulRequest(t *testing.T) {
+	h := Init(t)
+
+	req, resp := request(t, dhcpv6.MessageTypeRequest)
+	result, _ := h(req, resp)
+	if result.(*dhcpv6.Message).GetOneOption(dhcpv6.OptionInformationRefreshTime) != nil {
+		t.Error("information refresh time must not be set in replies to stateful requests")
+	}
+}
@@ -0,0 +1,215 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package relayfilter
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/ironcore-dev/fedhcp/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logger.GetLogger("plugins/relayfilter")
+
+var Plugin = plugins.Plugin{
+	Name:   "relayfilter",
+	Setup4: setup4,
+	Setup6: setup6,
+}
+
+const (
+	// reasonRelay rejects a message relayed by an unknown relay agent
+	reasonRelay = "relay"
+	// reasonDirect rejects a message of a directly attached client
+	reasonDirect = "direct"
+)
+
+var rejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metrics.Namespace,
+	Subsystem: "relayfilter",
+	Name:      "rejected_total",
+	Help:      "Number of messages dropped for their source, per plugin instance and reason.",
+}, []string{"instance", "reason"})
+
+// plugin holds the state of a single relayfilter plugin instance. It is built
+// once in setup and never modified afterwards.
+type plugin struct {
+	relays []netip.Prefix
+	direct bool
+	name   string
+	log    *logrus.Entry
+}
+
+// args[0] = path to config file
+func parseArgs(args ...string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("exactly one argument must be passed to the relayfilter plugin, got %d", len(args))
+	}
+	return args[0], nil
+}
+
+func loadConfig(args ...string) (*api.RelayFilterConfig, error) {
+	path, err := parseArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	log.Debugf("Reading config file %s", path)
+	config := &api.RelayFilterConfig{}
+	if err := api.Load(path, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// parseRelays parses the addresses and prefixes of the relay agents, an
+// address is a prefix of its full length.
+func parseRelays(relays []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(relays))
+	for _, relay := range relays {
+		if addr, err := netip.ParseAddr(relay); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(relay)
+		if err != nil {
+			return nil, fmt.Errorf("invalid relay %s: %w", relay, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func newPlugin(name string, args ...string) (*plugin, error) {
+	config, err := loadConfig(args...)
+	if err != nil {
+		return nil, err
+	}
+	relays, err := parseRelays(config.Relays)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+	if len(relays) == 0 && !config.Direct {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("neither relays nor direct clients are accepted")}
+	}
+
+	metrics.Register(rejected)
+	// the instance name labels the metrics, so the logger is built by hand
+	name = instance.Next(name)
+	return &plugin{
+		relays: relays,
+		direct: config.Direct,
+		name:   name,
+		log:    log.WithField("instance", name),
+	}, nil
+}
+
+func setup6(args ...string) (handler.Handler6, error) {
+	p, err := newPlugin("relayfilter/v6", args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded relayfilter plugin for DHCPv6 with %d relays (direct: %t).", len(p.relays), p.direct)
+	return p.handler6, nil
+}
+
+func setup4(args ...string) (handler.Handler4, error) {
+	p, err := newPlugin("relayfilter/v4", args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded relayfilter plugin for DHCPv4 with %d relays (direct: %t).", len(p.relays), p.direct)
+	return p.handler4, nil
+}
+
+// accepted reports whether the address is one of a relay agent.
+func (p *plugin) accepted(ip net.IP) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range p.relays {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// reject drops a message for its source.
+func (p *plugin) reject(reason, format string, args ...any) {
+	rejected.WithLabelValues(p.name, reason).Inc()
+	p.log.Warnf(format, args...)
+}
+
+// relayAddresses returns the addresses of the relay agents a DHCPv6 message
+// carries: the link address of each relay, if given, and the peer address of
+// each relay but the one closest to the client, which is the address of the
+// next relay towards the client.
+func relayAddresses(req dhcpv6.DHCPv6) []net.IP {
+	var addrs []net.IP
+	for msg := req; msg != nil && msg.IsRelay(); {
+		relayMsg := msg.(*dhcpv6.RelayMessage)
+		if !relayMsg.LinkAddr.IsUnspecified() {
+			addrs = append(addrs, relayMsg.LinkAddr)
+		}
+		inner := relayMsg.Options.RelayMessage()
+		if inner != nil && inner.IsRelay() {
+			addrs = append(addrs, relayMsg.PeerAddr)
+		}
+		msg = inner
+	}
+	return addrs
+}
+
+func (p *plugin) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	if !req.IsRelay() {
+		if !p.direct {
+			p.reject(reasonDirect, "Dropping DHCPv6 message of directly attached client")
+			return nil, true
+		}
+		return resp, false
+	}
+
+	addrs := relayAddresses(req)
+	if len(addrs) == 0 {
+		p.reject(reasonRelay, "Dropping DHCPv6 message relayed without link address")
+		return nil, true
+	}
+	for _, addr := range addrs {
+		if !p.accepted(addr) {
+			p.reject(reasonRelay, "Dropping DHCPv6 message relayed by unknown relay agent %s", addr)
+			return nil, true
+		}
+	}
+	return resp, false
+}
+
+func (p *plugin) handler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	if req.GatewayIPAddr == nil || req.GatewayIPAddr.IsUnspecified() {
+		if !p.direct {
+			p.reject(reasonDirect, "Dropping DHCPv4 message of directly attached client %s", req.ClientHWAddr)
+			return nil, true
+		}
+		return resp, false
+	}
+
+	if !p.accepted(req.GatewayIPAddr) {
+		p.reject(reasonRelay, "Dropping DHCPv4 message relayed by unknown relay agent %s", req.GatewayIPAddr)
+		return nil, true
+	}
+	return resp, false
+}
@@ -0,0 +1,206 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package relayfilter
+
+import (
+	"net"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/api/apitest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var mac = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+
+func Init(t *testing.T, config api.RelayFilterConfig) *plugin {
+	p, err := newPlugin("relayfilter/test", apitest.WriteConfig(t, config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func newRequest4(t *testing.T, giaddr net.IP) (*dhcpv4.DHCPv4, *dhcpv4.DHCPv4) {
+	req, err := dhcpv4.NewDiscovery(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.GatewayIPAddr = giaddr
+	stub, err := dhcpv4.NewReplyFromRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req, stub
+}
+
+// newRequest6 relays a Solicit by relays, given from the client to the server
+// as link and peer address each.
+func newRequest6(t *testing.T, relays ...[2]net.IP) (dhcpv6.DHCPv6, dhcpv6.DHCPv6) {
+	msg, err := dhcpv6.NewSolicit(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub, err := dhcpv6.NewAdvertiseFromSolicit(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var req dhcpv6.DHCPv6 = msg
+	for _, relay := range relays {
+		req, err = dhcpv6.EncapsulateRelay(req, dhcpv6.MessageTypeRelayForward, relay[0], relay[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return req, stub
+}
+
+func TestWrongNumberArgs(t *testing.T) {
+	_, err := setup4()
+	if err == nil {
+		t.Fatal("no error occurred when not providing a configuration file path, but it should have")
+	}
+
+	_, err = setup6("foo", "bar")
+	if err == nil {
+		t.Fatal("no error occurred when providing wrong number of args (2), but it should have")
+	}
+}
+
+func TestWrongArgs(t *testing.T) {
+	for _, config := range []api.RelayFilterConfig{
+		{},
+		{Relays: []string{"not-an-address"}},
+		{Relays: []string{"10.0.0.0/33"}},
+	} {
+		if _, err := setup4(apitest.WriteConfig(t, config)); err == nil {
+			t.Fatalf("no error occurred for invalid config %+v, but it should have", config)
+		}
+	}
+}
+
+func TestParseRelays(t *testing.T) {
+	prefixes, err := parseRelays([]string{"10.0.0.1", "10.1.2.3/16", "2001:db8::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"10.0.0.1/32", "10.1.0.0/16", "2001:db8::1/128"}
+	for i, prefix := range prefixes {
+		if prefix.String() != expected[i] {
+			t.Errorf("expected prefix %s, got %s", expected[i], prefix)
+		}
+	}
+}
+
+/* IPv6 */
+func TestRelayed6(t *testing.T) {
+	p := Init(t, api.RelayFilterConfig{Relays: []string{"2001:db8:ff::/48"}})
+
+	for _, tc := range []struct {
+		name     string
+		relays   [][2]net.IP
+		rejected bool
+	}{
+		{
+			name:   "known relay",
+			relays: [][2]net.IP{{net.ParseIP("2001:db8:ff::1"), net.ParseIP("fe80::1")}},
+		},
+		{
+			name:     "unknown relay",
+			relays:   [][2]net.IP{{net.ParseIP("2001:db8:1::1"), net.ParseIP("fe80::1")}},
+			rejected: true,
+		},
+		{
+			name:     "no link address",
+			relays:   [][2]net.IP{{net.IPv6unspecified, net.ParseIP("fe80::1")}},
+			rejected: true,
+		},
+		{
+			name: "known relay chain",
+			relays: [][2]net.IP{
+				{net.IPv6unspecified, net.ParseIP("fe80::1")},
+				{net.ParseIP("2001:db8:ff:1::1"), net.ParseIP("2001:db8:ff::2")},
+			},
+		},
+		{
+			name: "spoofed inner relay",
+			relays: [][2]net.IP{
+				{net.ParseIP("2001:db8:ff::1"), net.ParseIP("fe80::1")},
+				{net.ParseIP("2001:db8:ff:1::1"), net.ParseIP("2001:db8:1::2")},
+			},
+			rejected: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, stub := newRequest6(t, tc.relays...)
+			resp, stop := p.handler6(req, stub)
+			if tc.rejected != (resp == nil) || tc.rejected != stop {
+				t.Errorf("expected rejected %t, got response %v and stop %t", tc.rejected, resp, stop)
+			}
+		})
+	}
+}
+
+func TestDirect6(t *testing.T) {
+	p := Init(t, api.RelayFilterConfig{Relays: []string{"2001:db8:ff::/48"}})
+	req, stub := newRequest6(t)
+	before := testutil.ToFloat64(rejected.WithLabelValues(p.name, reasonDirect))
+
+	resp, stop := p.handler6(req, stub)
+	if resp != nil || !stop {
+		t.Errorf("expected the message of a direct client to be dropped, got response %v and stop %t", resp, stop)
+	}
+	if got := testutil.ToFloat64(rejected.WithLabelValues(p.name, reasonDirect)); got != before+1 {
+		t.Errorf("expected rejected direct messages %v, got %v", before+1, got)
+	}
+
+	p = Init(t, api.RelayFilterConfig{Direct: true})
+	resp, stop = p.handler6(req, stub)
+	if resp != stub || stop {
+		t.Errorf("expected the message of a direct client to be passed on, got response %v and stop %t", resp, stop)
+	}
+}
+
+/* IPv4 */
+func TestRelayed4(t *testing.T) {
+	p := Init(t, api.RelayFilterConfig{Relays: []string{"10.0.0.0/8", "192.168.1.1"}})
+
+	for _, giaddr := range []string{"10.1.2.3", "192.168.1.1"} {
+		req, stub := newRequest4(t, net.ParseIP(giaddr))
+		resp, stop := p.handler4(req, stub)
+		if resp != stub || stop {
+			t.Errorf("expected the message relayed by %s to be passed on, got response %v and stop %t", giaddr, resp, stop)
+		}
+	}
+
+	before := testutil.ToFloat64(rejected.WithLabelValues(p.name, reasonRelay))
+	for _, giaddr := range []string{"192.168.1.2", "172.16.0.1"} {
+		req, stub := newRequest4(t, net.ParseIP(giaddr))
+		resp, stop := p.handler4(req, stub)
+		if resp != nil || !stop {
+			t.Errorf("expected the message relayed by %s to be dropped, got response %v and stop %t", giaddr, resp, stop)
+		}
+	}
+	if got := testutil.ToFloat64(rejected.WithLabelValues(p.name, reasonRelay)); got != before+2 {
+		t.Errorf("expected rejected relayed messages %v, got %v", before+2, got)
+	}
+}
+
+func TestDirect4(t *testing.T) {
+	p := Init(t, api.RelayFilterConfig{Relays: []string{"10.0.0.0/8"}})
+	req, stub := newRequest4(t, nil)
+	resp, stop := p.handler4(req, stub)
+	if resp != nil || !stop {
+		t.Errorf("expected the message of a direct client to be dropped, got response %v and stop %t", resp, stop)
+	}
+
+	p = Init(t, api.RelayFilterConfig{Relays: []string{"10.0.0.0/8"}, Direct: true})
+	resp, stop = p.handler4(req, stub)
+	if resp != stub || stop {
+		t.Errorf("expected the message of a direct client to be passed on, got response %v and stop %t", resp, stop)
+	}
+}
@@ -0,0 +1,187 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package script
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/ironcore-dev/fedhcp/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+var log = logger.GetLogger("plugins/script")
+
+var Plugin = plugins.Plugin{
+	Name:   "script",
+	Setup4: setup4,
+	Setup6: setup6,
+}
+
+const (
+	// maxSteps bounds the computation of a single script run
+	maxSteps = 1_000_000
+	// timeout bounds the time of a single script run
+	timeout = 100 * time.Millisecond
+)
+
+var errorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metrics.Namespace,
+	Subsystem: "script",
+	Name:      "errors_total",
+	Help:      "Number of script runs failed, leaving the response unchanged, per plugin instance.",
+}, []string{"instance"})
+
+// plugin holds the state of a single script plugin instance. It is built once
+// in setup and never modified afterwards; the script's globals are frozen.
+type plugin struct {
+	path string
+	// handle is the script's handle4 or handle6 function
+	handle starlark.Callable
+	name   string
+	log    *logrus.Entry
+}
+
+// args[0] = path to the Starlark script
+func parseArgs(args ...string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("exactly one argument must be passed to the script plugin, got %d", len(args))
+	}
+	return args[0], nil
+}
+
+// newThread returns a thread for a single run: loading modules is not
+// supported, print logs at debug level.
+func (p *plugin) newThread() *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: p.name,
+		Print: func(_ *starlark.Thread, msg string) {
+			p.log.Debug(msg)
+		},
+	}
+	thread.SetMaxExecutionSteps(maxSteps)
+	return thread
+}
+
+// newPlugin executes the script and looks up its function fn.
+func newPlugin(name, fn string, args ...string) (*plugin, error) {
+	path, err := parseArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	name = instance.Next(name)
+	p := &plugin{
+		path: path,
+		name: name,
+		log:  log.WithField("instance", name),
+	}
+	log.Debugf("Reading script %s", path)
+	globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, p.newThread(), path, nil, nil)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("failed to execute script %s: %w", path, err)}
+	}
+	handle, ok := globals[fn].(starlark.Callable)
+	if !ok {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("script %s defines no function %s", path, fn)}
+	}
+	p.handle = handle
+
+	metrics.Register(errorsTotal)
+	return p, nil
+}
+
+func setup6(args ...string) (handler.Handler6, error) {
+	p, err := newPlugin("script/v6", "handle6", args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded script plugin for DHCPv6 with %s.", p.path)
+	return p.handler6, nil
+}
+
+func setup4(args ...string) (handler.Handler4, error) {
+	p, err := newPlugin("script/v4", "handle4", args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded script plugin for DHCPv4 with %s.", p.path)
+	return p.handler4, nil
+}
+
+// run calls the script's function with the request and response, bounded by
+// maxSteps and timeout.
+func (p *plugin) run(req starlark.Value, resp *response, summary string) error {
+	thread := p.newThread()
+	timer := time.AfterFunc(timeout, func() {
+		thread.Cancel(fmt.Sprintf("timeout of %s exceeded", timeout))
+	})
+	defer timer.Stop()
+
+	if _, err := starlark.Call(thread, p.handle, starlark.Tuple{req, resp.value("response")}, nil); err != nil {
+		errorsTotal.WithLabelValues(p.name).Inc()
+		p.log.Errorf("Script failed for %s, leaving the response unchanged: %v", summary, err)
+		return err
+	}
+	return nil
+}
+
+// handler6 runs the script on a copy of the response, which replaces the
+// response if the script succeeds.
+func (p *plugin) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	m, err := req.GetInnerMessage()
+	if err != nil {
+		p.log.Errorf("Could not decapsulate request: %v", err)
+		return resp, false
+	}
+	if _, ok := resp.(*dhcpv6.Message); !ok {
+		p.log.Errorf("Unexpected response type %T", resp)
+		return resp, false
+	}
+	reply, err := dhcpv6.MessageFromBytes(resp.ToBytes())
+	if err != nil {
+		p.log.Errorf("Could not copy response: %v", err)
+		return resp, false
+	}
+
+	r := response6(reply)
+	if err := p.run(request6(req, m), r, req.Summary()); err != nil {
+		return resp, false
+	}
+	if r.dropped {
+		p.log.Debugf("Script dropped %s", req.Summary())
+		return nil, true
+	}
+	return reply, false
+}
+
+// handler4 runs the script on a copy of the response, which replaces the
+// response if the script succeeds.
+func (p *plugin) handler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	reply, err := dhcpv4.FromBytes(resp.ToBytes())
+	if err != nil {
+		p.log.Errorf("Could not copy response: %v", err)
+		return resp, false
+	}
+
+	r := response4(reply)
+	if err := p.run(request4(req), r, req.Summary()); err != nil {
+		return resp, false
+	}
+	if r.dropped {
+		p.log.Debugf("Script dropped request of %s", req.ClientHWAddr)
+		return nil, true
+	}
+	return reply, false
+}
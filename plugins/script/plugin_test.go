@@ -0,0 +1,174 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package script
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/rawopts"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var mac = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+
+const script = `
+def handle4(req, resp):
+    if req.vendor_class.startswith("SONiC"):
+        resp.set_option(225, "http://provision.example.com/sonic.json")
+    if 224 in req.options:
+        resp.del_option(225)
+    if req.hostname == "retired":
+        resp.drop()
+    if req.hostname == "broken":
+        resp.set_option(226, "partial")
+        fail("broken")
+
+def handle6(req, resp):
+    if 65000 in req.options:
+        resp.add_option(65001, req.options[65000])
+        resp.add_option(65001, "\x02")
+    for vc in req.vendor_classes:
+        if vc == "loop":
+            for i in range(1000000000):
+                pass
+`
+
+func writeScript(t *testing.T, src string) string {
+	path := filepath.Join(t.TempDir(), "script.star")
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func Init(t *testing.T, fn string) *plugin {
+	p, err := newPlugin("script/test", fn, writeScript(t, script))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestWrongNumberArgs(t *testing.T) {
+	_, err := setup4()
+	if err == nil {
+		t.Fatal("no error occurred when not providing a script path, but it should have")
+	}
+
+	_, err = setup6("foo", "bar")
+	if err == nil {
+		t.Fatal("no error occurred when providing wrong number of args (2), but it should have")
+	}
+}
+
+func TestWrongArgs(t *testing.T) {
+	for _, src := range []string{
+		"def handle4(req, resp)\n    pass\n",
+		"fail('at load')\n",
+		"load('other.star', 'x')\n",
+		"handle4 = 1\n",
+		"def handle6(req, resp):\n    pass\n",
+	} {
+		if _, err := setup4(writeScript(t, src)); err == nil {
+			t.Errorf("no error occurred for invalid script %q, but it should have", src)
+		}
+	}
+
+	if _, err := setup4(filepath.Join(t.TempDir(), "missing.star")); err == nil {
+		t.Error("no error occurred for a missing script, but it should have")
+	}
+}
+
+/* IPv6 */
+func TestScript6(t *testing.T) {
+	p := Init(t, "handle6")
+
+	req, _ := dhcpv6.NewSolicit(mac)
+	req.AddOption(&dhcpv6.OptionGeneric{OptionCode: 65000, OptionData: []byte{0x01}})
+	relayed, err := dhcpv6.EncapsulateRelay(req, dhcpv6.MessageTypeRelayForward, net.IPv6loopback, net.IPv6loopback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, _ := dhcpv6.NewAdvertiseFromSolicit(req)
+
+	result, stop := p.handler6(relayed, resp)
+	if stop {
+		t.Fatal("plugin must not break the chain")
+	}
+	data := rawopts.Get6(result.(*dhcpv6.Message), 65001)
+	if len(data) != 2 || !bytes.Equal(data[0], []byte{0x01}) || !bytes.Equal(data[1], []byte{0x02}) {
+		t.Errorf("expected options 65001 with payloads 01 and 02, got %x", data)
+	}
+	if rawopts.Has6(resp, 65001) {
+		t.Error("the original response must not be modified")
+	}
+}
+
+func TestScript6Bounded(t *testing.T) {
+	p := Init(t, "handle6")
+	before := testutil.ToFloat64(errorsTotal.WithLabelValues(p.name))
+
+	req, _ := dhcpv6.NewSolicit(mac)
+	req.AddOption(&dhcpv6.OptVendorClass{EnterpriseNumber: 1, Data: [][]byte{[]byte("loop")}})
+	resp, _ := dhcpv6.NewAdvertiseFromSolicit(req)
+
+	result, stop := p.handler6(req, resp)
+	if result != resp || stop {
+		t.Errorf("expected the response of a runaway script to be passed on unchanged, got %v and stop %t", result, stop)
+	}
+	if got := testutil.ToFloat64(errorsTotal.WithLabelValues(p.name)); got != before+1 {
+		t.Errorf("expected script errors %v, got %v", before+1, got)
+	}
+}
+
+/* IPv4 */
+func TestScript4(t *testing.T) {
+	p := Init(t, "handle4")
+
+	req, _ := dhcpv4.NewDiscovery(mac, dhcpv4.WithOption(dhcpv4.OptClassIdentifier("SONiC-ZTP")))
+	resp, _ := dhcpv4.NewReplyFromRequest(req)
+	result, stop := p.handler4(req, resp)
+	if stop {
+		t.Fatal("plugin must not break the chain")
+	}
+	if data := rawopts.Get4(result, 225); string(data) != "http://provision.example.com/sonic.json" {
+		t.Errorf("expected option 225 with the provisioning URL, got %q", data)
+	}
+
+	req.UpdateOption(dhcpv4.OptGeneric(dhcpv4.GenericOptionCode(224), []byte{0x01}))
+	result, _ = p.handler4(req, resp)
+	if rawopts.Has4(result, 225) {
+		t.Error("expected option 225 to be deleted for a request with option 224")
+	}
+}
+
+func TestScript4Drop(t *testing.T) {
+	p := Init(t, "handle4")
+
+	req, _ := dhcpv4.NewDiscovery(mac, dhcpv4.WithOption(dhcpv4.OptHostName("retired")))
+	resp, _ := dhcpv4.NewReplyFromRequest(req)
+	if result, stop := p.handler4(req, resp); result != nil || !stop {
+		t.Errorf("expected the request to be dropped, got %v and stop %t", result, stop)
+	}
+}
+
+func TestScript4Failure(t *testing.T) {
+	p := Init(t, "handle4")
+
+	req, _ := dhcpv4.NewDiscovery(mac, dhcpv4.WithOption(dhcpv4.OptHostName("broken")))
+	resp, _ := dhcpv4.NewReplyFromRequest(req)
+	result, stop := p.handler4(req, resp)
+	if result != resp || stop {
+		t.Errorf("expected the response to be passed on unchanged, got %v and stop %t", result, stop)
+	}
+	if rawopts.Has4(result, 226) {
+		t.Error("expected the changes of a failed script to be discarded")
+	}
+}
@@ -0,0 +1,226 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package script
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/rawopts"
+	"github.com/ironcore-dev/fedhcp/internal/relay"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// payload unpacks an option payload given as string or bytes.
+type payload []byte
+
+func (p *payload) Unpack(v starlark.Value) error {
+	switch v := v.(type) {
+	case starlark.String:
+		*p = []byte(v)
+	case starlark.Bytes:
+		*p = []byte(v)
+	default:
+		return fmt.Errorf("got %s, want string or bytes", v.Type())
+	}
+	return nil
+}
+
+// optionsDict returns the options as a dict from code to payload.
+func optionsDict(options []rawopts.Option) *starlark.Dict {
+	d := starlark.NewDict(len(options))
+	for _, o := range options {
+		// DHCPv6 options may repeat, the first one is kept
+		if _, found, _ := d.Get(starlark.MakeInt(int(o.Code))); !found {
+			_ = d.SetKey(starlark.MakeInt(int(o.Code)), starlark.Bytes(o.Data))
+		}
+	}
+	d.Freeze()
+	return d
+}
+
+func stringOrEmpty(ip net.IP) starlark.String {
+	if ip == nil || ip.IsUnspecified() {
+		return ""
+	}
+	return starlark.String(ip.String())
+}
+
+// request4 returns the read-only view of a DHCPv4 request scripts get.
+func request4(req *dhcpv4.DHCPv4) starlark.Value {
+	options := make([]rawopts.Option, 0, len(req.Options))
+	for code, data := range req.Options {
+		options = append(options, rawopts.Option{Code: uint16(code), Data: data})
+	}
+	return starlarkstruct.FromStringDict(starlark.String("request4"), starlark.StringDict{
+		"mac":          starlark.String(req.ClientHWAddr.String()),
+		"message_type": starlark.String(req.MessageType().String()),
+		"vendor_class": starlark.String(req.ClassIdentifier()),
+		"hostname":     starlark.String(req.HostName()),
+		"relay":        stringOrEmpty(req.GatewayIPAddr),
+		"options":      optionsDict(options),
+	})
+}
+
+// request6 returns the read-only view of a DHCPv6 request scripts get, of its
+// inner message if relayed.
+func request6(req dhcpv6.DHCPv6, m *dhcpv6.Message) starlark.Value {
+	var mac, relayAddr starlark.String
+	if req.IsRelay() {
+		if clientMAC, err := relay.ClientMAC(req); err == nil {
+			mac = starlark.String(clientMAC.String())
+		}
+		if inner, err := dhcpv6.DecapsulateRelayIndex(req, -1); err == nil {
+			relayAddr = stringOrEmpty(inner.(*dhcpv6.RelayMessage).LinkAddr)
+		}
+	}
+
+	var classes []starlark.Value
+	for _, vc := range m.Options.VendorClasses() {
+		for _, data := range vc.Data {
+			classes = append(classes, starlark.String(data))
+		}
+	}
+	var duid starlark.String
+	if clientID := m.Options.ClientID(); clientID != nil {
+		duid = starlark.String(fmt.Sprintf("%x", clientID.ToBytes()))
+	}
+
+	options := make([]rawopts.Option, 0, len(m.Options.Options))
+	for _, o := range m.Options.Options {
+		options = append(options, rawopts.Option{Code: uint16(o.Code()), Data: o.ToBytes()})
+	}
+	vendorClasses := starlark.NewList(classes)
+	vendorClasses.Freeze()
+	return starlarkstruct.FromStringDict(starlark.String("request6"), starlark.StringDict{
+		"mac":            mac,
+		"message_type":   starlark.String(m.MessageType.String()),
+		"duid":           duid,
+		"vendor_classes": vendorClasses,
+		"relay":          relayAddr,
+		"options":        optionsDict(options),
+	})
+}
+
+// response is the view of a response scripts modify, backed by functions of
+// the address family.
+type response struct {
+	get     func(code uint16) []byte
+	set     func(o rawopts.Option) error
+	add     func(o rawopts.Option) error
+	del     func(code uint16)
+	dropped bool
+}
+
+// value returns the response as struct of builtins.
+func (r *response) value(name string) starlark.Value {
+	optionArgs := func(b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (rawopts.Option, error) {
+		var code int
+		var data payload
+		if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &code, &data); err != nil {
+			return rawopts.Option{}, err
+		}
+		if code < 1 || code > 0xffff {
+			return rawopts.Option{}, fmt.Errorf("%s: invalid option code %d", b.Name(), code)
+		}
+		return rawopts.Option{Code: uint16(code), Data: data}, nil
+	}
+	codeArg := func(b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (uint16, error) {
+		var code int
+		if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &code); err != nil {
+			return 0, err
+		}
+		if code < 1 || code > 0xffff {
+			return 0, fmt.Errorf("%s: invalid option code %d", b.Name(), code)
+		}
+		return uint16(code), nil
+	}
+
+	return starlarkstruct.FromStringDict(starlark.String(name), starlark.StringDict{
+		"option": starlark.NewBuiltin("option", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			code, err := codeArg(b, args, kwargs)
+			if err != nil {
+				return nil, err
+			}
+			if data := r.get(code); data != nil {
+				return starlark.Bytes(data), nil
+			}
+			return starlark.None, nil
+		}),
+		"set_option": starlark.NewBuiltin("set_option", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			o, err := optionArgs(b, args, kwargs)
+			if err != nil {
+				return nil, err
+			}
+			return starlark.None, r.set(o)
+		}),
+		"add_option": starlark.NewBuiltin("add_option", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			o, err := optionArgs(b, args, kwargs)
+			if err != nil {
+				return nil, err
+			}
+			return starlark.None, r.add(o)
+		}),
+		"del_option": starlark.NewBuiltin("del_option", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			code, err := codeArg(b, args, kwargs)
+			if err != nil {
+				return nil, err
+			}
+			r.del(code)
+			return starlark.None, nil
+		}),
+		"drop": starlark.NewBuiltin("drop", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 0); err != nil {
+				return nil, err
+			}
+			r.dropped = true
+			return starlark.None, nil
+		}),
+	})
+}
+
+// response4 returns the view of a DHCPv4 response.
+func response4(resp *dhcpv4.DHCPv4) *response {
+	return &response{
+		get: func(code uint16) []byte {
+			return rawopts.Get4(resp, code)
+		},
+		set: func(o rawopts.Option) error {
+			return rawopts.Add4(resp, o)
+		},
+		add: func(o rawopts.Option) error {
+			return rawopts.Add4(resp, o)
+		},
+		del: func(code uint16) {
+			if code <= rawopts.MaxCode4 {
+				resp.Options.Del(dhcpv4.GenericOptionCode(code))
+			}
+		},
+	}
+}
+
+// response6 returns the view of a DHCPv6 response.
+func response6(resp *dhcpv6.Message) *response {
+	return &response{
+		get: func(code uint16) []byte {
+			if data := rawopts.Get6(resp, code); len(data) > 0 {
+				return data[0]
+			}
+			return nil
+		},
+		set: func(o rawopts.Option) error {
+			resp.Options.Del(dhcpv6.OptionCode(o.Code))
+			return rawopts.Add6(resp, o)
+		},
+		add: func(o rawopts.Option) error {
+			return rawopts.Add6(resp, o)
+		},
+		del: func(code uint16) {
+			resp.Options.Del(dhcpv6.OptionCode(code))
+		},
+	}
+}
@@ -0,0 +1,214 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package serverduid
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logger.GetLogger("plugins/serverduid")
+
+var Plugin = plugins.Plugin{
+	Name:   "serverduid",
+	Setup6: setup6,
+}
+
+// plugin holds the state of a single serverduid plugin instance. It is built
+// once in setup6 and never modified afterwards.
+type plugin struct {
+	duid dhcpv6.DUID
+	log  *logrus.Entry
+}
+
+// args[0] = path to config file
+func parseArgs(args ...string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("exactly one argument must be passed to the serverduid plugin, got %d", len(args))
+	}
+	return args[0], nil
+}
+
+func loadConfig(args ...string) (*api.ServerDUIDConfig, error) {
+	path, err := parseArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	log.Debugf("Reading config file %s", path)
+	config := &api.ServerDUIDConfig{}
+	if err := api.Load(path, config); err != nil {
+		return nil, err
+	}
+
+	switch config.Type {
+	case "":
+		config.Type = api.DUIDTypeLL
+	case api.DUIDTypeLL, api.DUIDTypeUUID:
+	default:
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("unknown DUID type %s", config.Type)}
+	}
+
+	return config, nil
+}
+
+func newStore(config *api.ServerDUIDConfig) (store, error) {
+	switch config.Store {
+	case api.DUIDStoreFile, "":
+		if config.Path == "" {
+			return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("no DUID file path configured")}
+		}
+		return &fileStore{path: config.Path}, nil
+	case api.DUIDStoreConfigMap:
+		if config.Namespace == "" || config.Name == "" {
+			return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("no DUID ConfigMap namespace and name configured")}
+		}
+		return newConfigMapStore(config.Namespace, config.Name)
+	default:
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("unknown DUID store %s", config.Store)}
+	}
+}
+
+func setup6(args ...string) (handler.Handler6, error) {
+	config, err := loadConfig(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := newStore(config)
+	if err != nil {
+		return nil, err
+	}
+
+	duid, err := loadOrGenerate(s, config)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &plugin{
+		duid: duid,
+		log:  instance.Logger(log, "serverduid/v6"),
+	}
+	p.log.Printf("Loaded serverduid plugin for DHCPv6 with server DUID %s.", duid)
+	return p.handler6, nil
+}
+
+// loadOrGenerate returns the stored DUID, or generates and stores a new one.
+func loadOrGenerate(s store, config *api.ServerDUIDConfig) (dhcpv6.DUID, error) {
+	stored, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	if stored == "" {
+		duid, err := generate(config)
+		if err != nil {
+			return nil, err
+		}
+		if stored, err = s.save(encode(duid.ToBytes())); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := hex.DecodeString(stored)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stored DUID %s: %w", stored, err)
+	}
+	duid, err := dhcpv6.DUIDFromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stored DUID %s: %w", stored, err)
+	}
+	return duid, nil
+}
+
+func generate(config *api.ServerDUIDConfig) (dhcpv6.DUID, error) {
+	switch config.Type {
+	case api.DUIDTypeUUID:
+		var uuid [16]byte
+		if _, err := rand.Read(uuid[:]); err != nil {
+			return nil, fmt.Errorf("failed to generate UUID: %w", err)
+		}
+		// RFC 4122 version 4, variant 1
+		uuid[6] = uuid[6]&0x0f | 0x40
+		uuid[8] = uuid[8]&0x3f | 0x80
+		return &dhcpv6.DUIDUUID{UUID: uuid}, nil
+	default:
+		mac, err := linkLayerAddress(config.Interface)
+		if err != nil {
+			return nil, err
+		}
+		return &dhcpv6.DUIDLL{HWType: iana.HWTypeEthernet, LinkLayerAddr: mac}, nil
+	}
+}
+
+// linkLayerAddress returns the MAC address of the given interface, or a random
+// locally administered one, if no interface is given.
+func linkLayerAddress(name string) (net.HardwareAddr, error) {
+	if name != "" {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up interface %s: %w", name, err)
+		}
+		if len(iface.HardwareAddr) == 0 {
+			return nil, fmt.Errorf("interface %s has no link-layer address", name)
+		}
+		return iface.HardwareAddr, nil
+	}
+
+	mac := make(net.HardwareAddr, 6)
+	if _, err := rand.Read(mac); err != nil {
+		return nil, fmt.Errorf("failed to generate MAC address: %w", err)
+	}
+	// unicast, locally administered
+	mac[0] = mac[0]&0xfe | 0x02
+	return mac, nil
+}
+
+// requiresServerID reports whether clients must address messages of the given
+// type to a particular server, see RFC 8415 Section 16.
+func requiresServerID(t dhcpv6.MessageType) bool {
+	switch t {
+	case dhcpv6.MessageTypeRequest, dhcpv6.MessageTypeRenew,
+		dhcpv6.MessageTypeDecline, dhcpv6.MessageTypeRelease:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *plugin) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	m, err := req.GetInnerMessage()
+	if err != nil {
+		p.log.Errorf("BUG: could not decapsulate: %v", err)
+		return nil, true
+	}
+
+	serverID := m.Options.ServerID()
+	switch {
+	case requiresServerID(m.Type()) && serverID == nil:
+		p.log.Infof("Dropping %s without server identifier", m.Type())
+		return nil, true
+	case m.Type() == dhcpv6.MessageTypeSolicit && serverID != nil:
+		p.log.Infof("Dropping %s with server identifier", m.Type())
+		return nil, true
+	case serverID != nil && !serverID.Equal(p.duid):
+		p.log.Debugf("Dropping %s aimed at server %s", m.Type(), serverID)
+		return nil, true
+	}
+
+	resp.UpdateOption(dhcpv6.OptServerID(p.duid))
+	return resp, false
+}
@@ -0,0 +1,200 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package serverduid
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/api/apitest"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes/fake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func Init6(t *testing.T, config api.ServerDUIDConfig) handler.Handler6 {
+	h, err := setup6(apitest.WriteConfig(t, config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func newMessage(t *testing.T, messageType dhcpv6.MessageType, serverID dhcpv6.DUID) (*dhcpv6.RelayMessage, *dhcpv6.Message) {
+	req, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.MessageType = messageType
+	if serverID != nil {
+		req.AddOption(dhcpv6.OptServerID(serverID))
+	}
+
+	relayedRequest, err := dhcpv6.EncapsulateRelay(req, dhcpv6.MessageTypeRelayForward, net.IPv6loopback, net.IPv6loopback)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stub, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return relayedRequest, stub
+}
+
+func TestWrongNumberArgs(t *testing.T) {
+	_, err := setup6()
+	if err == nil {
+		t.Fatal("no error occurred when not providing a configuration file path, but it should have")
+	}
+
+	_, err = setup6("foo", "bar")
+	if err == nil {
+		t.Fatal("no error occurred when providing wrong number of args (2), but it should have")
+	}
+}
+
+func TestWrongConfig(t *testing.T) {
+	dir := t.TempDir()
+	for _, config := range []api.ServerDUIDConfig{
+		{Type: "foo", Path: filepath.Join(dir, "duid")},
+		{Store: "foo"},
+		{Store: api.DUIDStoreFile},
+		{Store: api.DUIDStoreConfigMap, Name: "duid"},
+	} {
+		if _, err := setup6(apitest.WriteConfig(t, config)); err == nil {
+			t.Fatalf("no error occurred for invalid config %+v, but it should have", config)
+		}
+	}
+}
+
+func TestDUIDPersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "duid")
+	for _, duidType := range []api.DUIDType{api.DUIDTypeLL, api.DUIDTypeUUID} {
+		_ = os.Remove(path)
+		config := &api.ServerDUIDConfig{Type: duidType, Store: api.DUIDStoreFile, Path: path}
+		s := &fileStore{path: path}
+
+		first, err := loadOrGenerate(s, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := loadOrGenerate(s, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !first.Equal(second) {
+			t.Errorf("DUID changed from %s to %s", first, second)
+		}
+
+		switch duidType {
+		case api.DUIDTypeLL:
+			if _, ok := first.(*dhcpv6.DUIDLL); !ok {
+				t.Errorf("expected DUID-LL, got %s", first)
+			}
+		case api.DUIDTypeUUID:
+			if _, ok := first.(*dhcpv6.DUIDUUID); !ok {
+				t.Errorf("expected DUID-UUID, got %s", first)
+			}
+		}
+	}
+}
+
+func TestStoredDUIDUsed(t *testing.T) {
+	stored := &dhcpv6.DUIDLL{HWType: iana.HWTypeEthernet, LinkLayerAddr: net.HardwareAddr{0x02, 0, 0, 0, 0, 0x01}}
+	path := filepath.Join(t.TempDir(), "duid")
+	_ = os.WriteFile(path, []byte(encode(stored.ToBytes())+"\n"), 0644)
+
+	h := Init6(t, api.ServerDUIDConfig{Store: api.DUIDStoreFile, Path: path})
+	req, stub := newMessage(t, dhcpv6.MessageTypeRequest, stored)
+
+	resp, stop := h(req, stub)
+	if resp == nil || stop {
+		t.Fatal("request aimed at this server has been dropped")
+	}
+	serverID := resp.(*dhcpv6.Message).Options.ServerID()
+	if serverID == nil || !serverID.Equal(stored) {
+		t.Errorf("expected server identifier %s, got %s", stored, serverID)
+	}
+}
+
+func TestServerIDValidated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "duid")
+	h := Init6(t, api.ServerDUIDConfig{Store: api.DUIDStoreFile, Path: path})
+	duid, err := loadOrGenerate(&fileStore{path: path}, &api.ServerDUIDConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := &dhcpv6.DUIDLL{HWType: iana.HWTypeEthernet, LinkLayerAddr: net.HardwareAddr{0x02, 0, 0, 0, 0, 0xff}}
+
+	for _, tc := range []struct {
+		messageType dhcpv6.MessageType
+		serverID    dhcpv6.DUID
+		served      bool
+	}{
+		{dhcpv6.MessageTypeSolicit, nil, true},
+		{dhcpv6.MessageTypeSolicit, duid, false},
+		{dhcpv6.MessageTypeRequest, duid, true},
+		{dhcpv6.MessageTypeRequest, nil, false},
+		{dhcpv6.MessageTypeRequest, other, false},
+		{dhcpv6.MessageTypeRenew, duid, true},
+		{dhcpv6.MessageTypeRenew, other, false},
+		{dhcpv6.MessageTypeRebind, nil, true},
+		{dhcpv6.MessageTypeInformationRequest, nil, true},
+		{dhcpv6.MessageTypeInformationRequest, other, false},
+	} {
+		req, stub := newMessage(t, tc.messageType, tc.serverID)
+		resp, stop := h(req, stub)
+		if served := resp != nil && !stop; served != tc.served {
+			t.Errorf("%s with server identifier %v: expected served %t, got %t", tc.messageType, tc.serverID, tc.served, served)
+			continue
+		}
+		if resp != nil {
+			serverID := resp.(*dhcpv6.Message).Options.ServerID()
+			if serverID == nil || !serverID.Equal(duid) {
+				t.Errorf("expected server identifier %s, got %s", duid, serverID)
+			}
+		}
+	}
+}
+
+type configMaps []client.Object
+
+func (c configMaps) Objects() []client.Object { return c }
+
+func TestConfigMapWithoutDUID(t *testing.T) {
+	cl := fake.NewClient(configMaps{&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "fedhcp", Name: "duid"},
+		Data:       map[string]string{"unrelated": "kept"},
+	}})
+	s := &configMapStore{client: cl, namespace: "fedhcp", name: "duid"}
+
+	first, err := loadOrGenerate(s, &api.ServerDUIDConfig{})
+	if err != nil {
+		t.Fatalf("unexpected error for a ConfigMap without DUID: %v", err)
+	}
+	second, err := loadOrGenerate(s, &api.ServerDUIDConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.Equal(second) {
+		t.Errorf("DUID changed from %s to %s", first, second)
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := cl.Get(context.Background(), client.ObjectKey{Namespace: "fedhcp", Name: "duid"}, cm); err != nil {
+		t.Fatal(err)
+	}
+	if cm.Data[configMapKey] != encode(first.ToBytes()) || cm.Data["unrelated"] != "kept" {
+		t.Errorf("expected the DUID added to the ConfigMap, got %v", cm.Data)
+	}
+}
@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package serverduid
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const configMapKey = "duid"
+
+// store persists the hex encoded server DUID. load returns "" if no DUID
+// has been stored yet; save stores the DUID unless another one has been
+// stored concurrently, in which case that one is returned.
+type store interface {
+	load() (string, error)
+	save(duid string) (string, error)
+}
+
+type fileStore struct {
+	path string
+}
+
+func (s *fileStore) load() (string, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read DUID file %s: %w", s.path, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (s *fileStore) save(duid string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory of DUID file %s: %w", s.path, err)
+	}
+	if err := os.WriteFile(s.path, []byte(duid+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("failed to write DUID file %s: %w", s.path, err)
+	}
+	return duid, nil
+}
+
+// configMapStore keeps the DUID in a ConfigMap, so all replicas share it.
+type configMapStore struct {
+	client    client.Client
+	namespace string
+	name      string
+}
+
+// newConfigMapStore returns a store using the client of the server, so the
+// ConfigMap is not written when simulating.
+func newConfigMapStore(namespace, name string) (*configMapStore, error) {
+	cl := kubernetes.GetClient()
+	if cl == nil {
+		return nil, fmt.Errorf("kubernetes client not initialized")
+	}
+	return &configMapStore{client: cl, namespace: namespace, name: name}, nil
+}
+
+func (s *configMapStore) load() (string, error) {
+	cm := &corev1.ConfigMap{}
+	err := s.client.Get(context.Background(), client.ObjectKey{Namespace: s.namespace, Name: s.name}, cm)
+	if apierrors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get ConfigMap %s/%s: %w", s.namespace, s.name, fedhcperrors.FromK8s(err))
+	}
+	return cm.Data[configMapKey], nil
+}
+
+func (s *configMapStore) save(duid string) (string, error) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: s.namespace,
+			Name:      s.name,
+		},
+		Data: map[string]string{configMapKey: duid},
+	}
+	err := s.client.Create(context.Background(), cm)
+	if apierrors.IsAlreadyExists(err) {
+		// another replica has been faster, or the ConfigMap has been created
+		// without DUID
+		return s.addKey(duid)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to create ConfigMap %s/%s: %w", s.namespace, s.name, fedhcperrors.FromK8s(err))
+	}
+	return duid, nil
+}
+
+// addKey adds the DUID to the existing ConfigMap unless it holds one, which
+// is returned then. The ConfigMap is patched with optimistic locking, so that
+// a DUID added concurrently is kept.
+func (s *configMapStore) addKey(duid string) (string, error) {
+	stored := ""
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm := &corev1.ConfigMap{}
+		if err := s.client.Get(context.Background(), client.ObjectKey{Namespace: s.namespace, Name: s.name}, cm); err != nil {
+			return err
+		}
+		if stored = cm.Data[configMapKey]; stored != "" {
+			return nil
+		}
+		base := cm.DeepCopy()
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[configMapKey] = duid
+		stored = duid
+		return s.client.Patch(context.Background(), cm, client.MergeFromWithOptions(base, client.MergeFromWithOptimisticLock{}))
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to add DUID to ConfigMap %s/%s: %w", s.namespace, s.name, fedhcperrors.FromK8s(err))
+	}
+	return stored, nil
+}
+
+func encode(data []byte) string {
+	return hex.EncodeToString(data)
+}
@@ -0,0 +1,309 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package syslog
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/ironcore-dev/fedhcp/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logger.GetLogger("plugins/syslog")
+
+var Plugin = plugins.Plugin{
+	Name:   "syslog",
+	Setup4: setup4,
+	Setup6: setup6,
+}
+
+const (
+	defaultProtocol = "udp"
+	defaultFacility = "local0"
+	defaultAppName  = "fedhcp"
+	// severityInfo is the severity of all messages
+	severityInfo = 6
+	// sdID identifies the structured data, 32473 is the private enterprise number reserved for documentation
+	sdID     = "dhcp@32473"
+	nilValue = "-"
+)
+
+var facilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"daemon":   3,
+	"auth":     4,
+	"authpriv": 10,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+var syslogMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metrics.Namespace,
+	Subsystem: "syslog",
+	Name:      "messages_total",
+	Help:      "Number of syslog messages by result (sent, failed, dropped), per plugin instance.",
+}, []string{"instance", "result"})
+
+// plugin holds the state of a single syslog plugin instance.
+type plugin struct {
+	facility int
+	hostname string
+	appName  string
+	procID   string
+	sender   *sender
+	name     string
+	log      *logrus.Entry
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// transaction is the content of a message: the response type as MSGID, the
+// parameters of the structured data and a human readable text.
+type transaction struct {
+	msgID  string
+	params [][2]string
+	text   string
+}
+
+// args[0] = path to config file
+func parseArgs(args ...string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("exactly one argument must be passed to the syslog plugin, got %d", len(args))
+	}
+	return args[0], nil
+}
+
+func loadConfig(args ...string) (*api.SyslogConfig, error) {
+	path, err := parseArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	log.Debugf("Reading config file %s", path)
+	config := &api.SyslogConfig{}
+	if err := api.Load(path, config); err != nil {
+		return nil, err
+	}
+
+	if _, _, err := net.SplitHostPort(config.Address); err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("invalid collector address %q: %v", config.Address, err)}
+	}
+	switch config.Protocol {
+	case "":
+		config.Protocol = defaultProtocol
+	case "udp", "tcp":
+	default:
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("unknown protocol %s, should be udp or tcp", config.Protocol)}
+	}
+	if config.Facility == "" {
+		config.Facility = defaultFacility
+	}
+	if _, ok := facilities[config.Facility]; !ok {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("unknown facility %s", config.Facility)}
+	}
+	if config.AppName == "" {
+		config.AppName = defaultAppName
+	}
+
+	return config, nil
+}
+
+func newPlugin(name string, args ...string) (*plugin, error) {
+	config, err := loadConfig(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = nilValue
+	}
+
+	metrics.Register(syslogMessages)
+	// the instance name labels the metrics, so the logger is built by hand
+	name = instance.Next(name)
+	p := &plugin{
+		facility: facilities[config.Facility],
+		hostname: hostname,
+		appName:  config.AppName,
+		procID:   strconv.Itoa(os.Getpid()),
+		name:     name,
+		log:      log.WithField("instance", name),
+		now:      time.Now,
+	}
+	p.sender = newSender(config.Protocol, config.Address, p.log, func(result string) {
+		syslogMessages.WithLabelValues(name, result).Inc()
+	})
+	return p, nil
+}
+
+func setup6(args ...string) (handler.Handler6, error) {
+	p, err := newPlugin("syslog/v6", args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded syslog plugin for DHCPv6 sending to %s.", p.sender.address)
+	return p.handler6, nil
+}
+
+func setup4(args ...string) (handler.Handler4, error) {
+	p, err := newPlugin("syslog/v4", args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded syslog plugin for DHCPv4 sending to %s.", p.sender.address)
+	return p.handler4, nil
+}
+
+// format renders the transaction as RFC 5424 message.
+func (p *plugin) format(t transaction) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %s %s [%s", p.facility*8+severityInfo,
+		p.now().UTC().Format("2006-01-02T15:04:05.000000Z07:00"), p.hostname, p.appName, p.procID, t.msgID, sdID)
+	for _, param := range t.params {
+		fmt.Fprintf(&b, ` %s="%s"`, param[0], escape(param[1]))
+	}
+	b.WriteString("] ")
+	b.WriteString(t.text)
+	return []byte(b.String())
+}
+
+// escape escapes a structured data parameter value, see RFC 5424, section 6.3.3.
+func escape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
+
+func (p *plugin) send(t transaction) {
+	if !p.sender.enqueue(p.format(t)) {
+		syslogMessages.WithLabelValues(p.name, "dropped").Inc()
+		p.log.Warning("Syslog queue is full, dropping message")
+	}
+}
+
+func optionCodes[T any](options map[uint8]T) string {
+	codes := make([]int, 0, len(options))
+	for code := range options {
+		codes = append(codes, int(code))
+	}
+	sort.Ints(codes)
+	return joinInts(codes)
+}
+
+func joinInts(values []int) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = strconv.Itoa(v)
+	}
+	return strings.Join(s, ",")
+}
+
+func orNil(s string) string {
+	if s == "" {
+		return nilValue
+	}
+	return s
+}
+
+func (p *plugin) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	msg, err := req.GetInnerMessage()
+	if err != nil {
+		p.log.Errorf("Could not decapsulate request: %v", err)
+		return resp, false
+	}
+	reply, ok := resp.(*dhcpv6.Message)
+	if !ok {
+		p.log.Errorf("Unexpected response %s", resp.Summary())
+		return resp, false
+	}
+
+	mac := ""
+	if hwaddr, err := dhcpv6.ExtractMAC(req); err == nil {
+		mac = hwaddr.String()
+	}
+	duid := ""
+	if clientID := msg.Options.ClientID(); clientID != nil {
+		duid = clientID.String()
+	}
+	var addresses []string
+	for _, iana := range reply.Options.OneIANA().Options.Addresses() {
+		addresses = append(addresses, iana.IPv6Addr.String())
+	}
+	var prefixes []string
+	if iapd := reply.Options.OneIAPD(); iapd != nil {
+		for _, prefix := range iapd.Options.Prefixes() {
+			prefixes = append(prefixes, prefix.Prefix.String())
+		}
+	}
+	codes := make([]int, 0, len(reply.Options.Options))
+	for _, option := range reply.Options.Options {
+		codes = append(codes, int(option.Code()))
+	}
+	sort.Ints(codes)
+
+	relay := ""
+	if req.IsRelay() {
+		relay = req.(*dhcpv6.RelayMessage).LinkAddr.String()
+	}
+
+	p.send(transaction{
+		msgID: reply.Type().String(),
+		params: [][2]string{
+			{"mac", orNil(mac)},
+			{"duid", orNil(duid)},
+			{"ip", orNil(strings.Join(addresses, ","))},
+			{"prefix", orNil(strings.Join(prefixes, ","))},
+			{"request", msg.Type().String()},
+			{"relay", orNil(relay)},
+			{"options", orNil(joinInts(codes))},
+		},
+		text: fmt.Sprintf("%s %s to %s", reply.Type(), orNil(strings.Join(addresses, ",")), orNil(mac)),
+	})
+	return resp, false
+}
+
+func (p *plugin) handler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	ip := ""
+	if !resp.YourIPAddr.IsUnspecified() {
+		ip = resp.YourIPAddr.String()
+	}
+	relay := ""
+	if !req.GatewayIPAddr.IsUnspecified() {
+		relay = req.GatewayIPAddr.String()
+	}
+
+	p.send(transaction{
+		msgID: "DHCP" + resp.MessageType().String(),
+		params: [][2]string{
+			{"mac", req.ClientHWAddr.String()},
+			{"ip", orNil(ip)},
+			{"request", "DHCP" + req.MessageType().String()},
+			{"relay", orNil(relay)},
+			{"options", orNil(optionCodes(resp.Options))},
+		},
+		text: fmt.Sprintf("DHCP%s %s to %s", resp.MessageType(), orNil(ip), req.ClientHWAddr),
+	})
+	return resp, false
+}
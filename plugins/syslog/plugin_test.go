@@ -0,0 +1,193 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package syslog
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/api/apitest"
+)
+
+var mac = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+
+func Init(t *testing.T, config api.SyslogConfig) *plugin {
+	p, err := newPlugin("syslog/test", apitest.WriteConfig(t, config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.hostname = "fedhcp-0"
+	p.procID = "1"
+	p.now = func() time.Time { return time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC) }
+	return p
+}
+
+// collectUDP returns the address of a UDP collector and a function receiving the next message.
+func collectUDP(t *testing.T) (string, func() string) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn.LocalAddr().String(), func() string {
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		buf := make([]byte, 2048)
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("no syslog message received: %v", err)
+		}
+		return string(buf[:n])
+	}
+}
+
+func TestWrongNumberArgs(t *testing.T) {
+	_, err := setup4()
+	if err == nil {
+		t.Fatal("no error occurred when not providing a configuration file path, but it should have")
+	}
+
+	_, err = setup6("foo", "bar")
+	if err == nil {
+		t.Fatal("no error occurred when providing wrong number of args (2), but it should have")
+	}
+}
+
+func TestWrongArgs(t *testing.T) {
+	for _, config := range []api.SyslogConfig{
+		{},
+		{Address: "siem.example.org"},
+		{Address: "siem.example.org:514", Protocol: "tls"},
+		{Address: "siem.example.org:514", Facility: "local9"},
+	} {
+		if _, err := setup4(apitest.WriteConfig(t, config)); err == nil {
+			t.Fatalf("no error occurred for invalid config %+v, but it should have", config)
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	if escaped := escape(`a"b\c]d`); escaped != `a\"b\\c\]d` {
+		t.Errorf("unexpected escaped value %s", escaped)
+	}
+}
+
+/* IPv6 */
+func TestTransaction6(t *testing.T) {
+	address, receive := collectUDP(t)
+	p := Init(t, api.SyslogConfig{Address: address})
+
+	msg, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.MessageType = dhcpv6.MessageTypeRequest
+	msg.AddOption(dhcpv6.OptClientID(&dhcpv6.DUIDLL{HWType: iana.HWTypeEthernet, LinkLayerAddr: mac}))
+	req, err := dhcpv6.EncapsulateRelay(msg, dhcpv6.MessageTypeRelayForward,
+		net.ParseIP("2001:db8::1"), net.ParseIP("fe80::21a:2bff:fe3c:4d5e"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub, err := dhcpv6.NewReplyFromMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.AddOption(&dhcpv6.OptIANA{Options: dhcpv6.IdentityOptions{Options: []dhcpv6.Option{
+		&dhcpv6.OptIAAddress{IPv6Addr: net.ParseIP("2001:db8::10")},
+	}}})
+
+	resp, stop := p.handler6(req, stub)
+	if resp != stub || stop {
+		t.Error("expected the response to be passed on unchanged")
+	}
+
+	line := receive()
+	for _, expected := range []string{
+		"<134>1 2024-10-01T12:00:00.000000Z fedhcp-0 fedhcp 1 REPLY [dhcp@32473 ",
+		`mac="00:1a:2b:3c:4d:5e"`,
+		`ip="2001:db8::10"`,
+		`request="REQUEST"`,
+		`relay="2001:db8::1"`,
+		"] REPLY 2001:db8::10 to 00:1a:2b:3c:4d:5e",
+	} {
+		if !strings.Contains(line, expected) {
+			t.Errorf("expected %q in %s", expected, line)
+		}
+	}
+}
+
+/* IPv4 */
+func TestTransaction4(t *testing.T) {
+	address, receive := collectUDP(t)
+	p := Init(t, api.SyslogConfig{Address: address, Facility: "daemon", AppName: "dhcp"})
+
+	req, err := dhcpv4.NewDiscovery(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub, err := dhcpv4.NewReplyFromRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeOffer))
+	stub.YourIPAddr = net.IPv4(192, 0, 2, 10)
+
+	resp, stop := p.handler4(req, stub)
+	if resp != stub || stop {
+		t.Error("expected the response to be passed on unchanged")
+	}
+
+	expected := `<30>1 2024-10-01T12:00:00.000000Z fedhcp-0 dhcp 1 DHCPOFFER [dhcp@32473 mac="00:1a:2b:3c:4d:5e" ` +
+		`ip="192.0.2.10" request="DHCPDISCOVER" relay="-" options="53"] DHCPOFFER 192.0.2.10 to 00:1a:2b:3c:4d:5e`
+	if line := receive(); line != expected {
+		t.Errorf("expected %s, got %s", expected, line)
+	}
+}
+
+func TestTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	p := Init(t, api.SyslogConfig{Address: listener.Addr().String(), Protocol: "tcp"})
+
+	req, _ := dhcpv4.NewDiscovery(mac)
+	stub, _ := dhcpv4.NewReplyFromRequest(req)
+	p.handler4(req, stub)
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	// octet counting: the length, a space and the message
+	reader := bufio.NewReader(conn)
+	length, err := reader.ReadString(' ')
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(length))
+	if err != nil {
+		t.Fatalf("invalid frame length %q", length)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(reader, msg); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(msg), "<134>1 ") || !strings.HasSuffix(string(msg), "to 00:1a:2b:3c:4d:5e") {
+		t.Errorf("unexpected message %s", msg)
+	}
+}
@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package syslog
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	queueLength = 1024
+	dialTimeout = 5 * time.Second
+)
+
+// sender delivers messages to the collector in the background, so a slow or
+// unreachable collector never delays DHCP responses. Messages exceeding the
+// queue are dropped.
+type sender struct {
+	network string
+	address string
+	queue   chan []byte
+	log     *logrus.Entry
+	// sent is called with the result of every message, "sent" or "failed"
+	sent func(result string)
+
+	conn net.Conn
+}
+
+func newSender(network, address string, log *logrus.Entry, sent func(string)) *sender {
+	s := &sender{
+		network: network,
+		address: address,
+		queue:   make(chan []byte, queueLength),
+		log:     log,
+		sent:    sent,
+	}
+	go s.run()
+	return s
+}
+
+// enqueue hands a message to the sender and reports whether it was accepted.
+func (s *sender) enqueue(msg []byte) bool {
+	select {
+	case s.queue <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *sender) run() {
+	for msg := range s.queue {
+		// a stale TCP connection is only noticed when writing, so retry once on a new one
+		err := s.write(msg)
+		if err != nil {
+			err = s.write(msg)
+		}
+		if err != nil {
+			s.log.Errorf("Failed to send syslog message to %s: %v", s.address, err)
+			s.sent("failed")
+			continue
+		}
+		s.sent("sent")
+	}
+}
+
+func (s *sender) write(msg []byte) error {
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.network, s.address, dialTimeout)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	frame := msg
+	if s.network == "tcp" {
+		// octet counting framing, see RFC 6587, section 3.4.1
+		frame = append([]byte(fmt.Sprintf("%d ", len(msg))), msg...)
+	}
+	if _, err := s.conn.Write(frame); err != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
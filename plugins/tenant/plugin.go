@@ -0,0 +1,423 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+// Package tenant serves isolated environments, e.g. prod and lab, from one
+// deployment. Each tenant owns the networks behind its relay agents, or the
+// directly attached clients, and has a plugin chain and a kubernetes namespace
+// of its own. A client is only ever handled by the chain of its tenant, the
+// messages of clients of no tenant are dropped.
+package tenant
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/coredhcp/coredhcp/config"
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/bootoperator"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/ironcore-dev/fedhcp/internal/metrics"
+	"github.com/ironcore-dev/fedhcp/internal/sideeffects"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+var log = logger.GetLogger("plugins/tenant")
+
+const pluginName = "tenant"
+
+var Plugin = plugins.Plugin{
+	Name:   pluginName,
+	Setup4: setup4,
+	Setup6: setup6,
+}
+
+// unmatched labels the messages of clients of no tenant.
+const unmatched = ""
+
+var messages = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metrics.Namespace,
+	Subsystem: "tenant",
+	Name:      "messages_total",
+	Help:      "Number of messages handled per tenant, messages of clients of no tenant are counted with an empty tenant and dropped.",
+}, []string{"instance", "tenant"})
+
+// namespacedPlugins are the plugins whose config, the first argument, names
+// the kubernetes namespace they write to.
+var namespacedPlugins = sets.New("ipam", "oob", "bootparams", "dnsendpoint", "recorder", "serverduid")
+
+// localPlugins are the plugins with side effects outside of kubernetes, e.g.
+// writing files, which need no namespace. Any other plugin with side effects
+// writes cluster-scoped objects, e.g. the Endpoints of metal, and cannot be
+// isolated per tenant.
+var localPlugins = sets.New("syslog", "capture")
+
+// tenant is a tenant and the coredhcp config of its chains.
+type tenant struct {
+	name   string
+	relays []netip.Prefix
+	direct bool
+	// conf is the coredhcp config of the chain
+	conf *config.Config
+}
+
+// plugin holds the tenants of a plugin instance. It is built once in setup and
+// never modified afterwards.
+type plugin struct {
+	tenants []tenant
+	name    string
+	log     *logrus.Entry
+}
+
+// plugin6 runs the DHCPv6 chains of the tenants.
+type plugin6 struct {
+	*plugin
+	handlers [][]handler.Handler6
+}
+
+// plugin4 runs the DHCPv4 chains of the tenants.
+type plugin4 struct {
+	*plugin
+	handlers [][]handler.Handler4
+}
+
+// args[0] = path to config file
+func parseArgs(args ...string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("exactly one argument must be passed to the tenant plugin, got %d", len(args))
+	}
+	return args[0], nil
+}
+
+// parseRelays parses the addresses and prefixes of the relay agents, an
+// address is a prefix of its full length.
+func parseRelays(relays []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(relays))
+	for _, relay := range relays {
+		if addr, err := netip.ParseAddr(relay); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(relay)
+		if err != nil {
+			return nil, fmt.Errorf("invalid relay %s: %w", relay, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// checkChain ensures a tenant's chain holds no tenant plugin, that its
+// namespaced plugins and boot-operator lookups use the tenant's namespace and
+// that it holds no plugin writing cluster-scoped objects.
+func checkChain(t api.Tenant, conf *config.Config) error {
+	for _, server := range []*config.ServerConfig{conf.Server4, conf.Server6} {
+		if server == nil {
+			continue
+		}
+		for _, p := range server.Plugins {
+			if p.Name == pluginName {
+				return fmt.Errorf("tenant %s: config must not contain the tenant plugin", t.Name)
+			}
+			if sideeffects.Has(p.Name) && !namespacedPlugins.Has(p.Name) && !localPlugins.Has(p.Name) {
+				return fmt.Errorf("tenant %s: plugin %s writes cluster-scoped objects, which are not isolated per tenant", t.Name, p.Name)
+			}
+			for _, arg := range p.Args {
+				if namespace, ok := strings.CutPrefix(arg, bootoperator.ArgPrefix); ok && namespace != t.Namespace {
+					return fmt.Errorf("tenant %s: plugin %s looks up boot configurations in namespace %s, should be %s", t.Name, p.Name, namespace, t.Namespace)
+				}
+			}
+			if !namespacedPlugins.Has(p.Name) || len(p.Args) == 0 {
+				continue
+			}
+			data, err := os.ReadFile(p.Args[0])
+			if err != nil {
+				return fmt.Errorf("tenant %s: failed to read config of plugin %s: %w", t.Name, p.Name, err)
+			}
+			var namespaced struct {
+				Namespace string `yaml:"namespace"`
+				// Store is the DUID store of serverduid, a file has no namespace
+				Store api.DUIDStoreType `yaml:"store"`
+			}
+			if err := yaml.Unmarshal(data, &namespaced); err != nil {
+				return fmt.Errorf("tenant %s: failed to parse config of plugin %s: %w", t.Name, p.Name, err)
+			}
+			if p.Name == "serverduid" && namespaced.Store != api.DUIDStoreConfigMap {
+				continue
+			}
+			if namespaced.Namespace != t.Namespace {
+				return fmt.Errorf("tenant %s: plugin %s uses namespace %q, should be %s", t.Name, p.Name, namespaced.Namespace, t.Namespace)
+			}
+		}
+	}
+	return nil
+}
+
+// parseTenants validates the tenants and loads the configs of their chains.
+// Tenants must not share relays, namespaces or the directly attached clients.
+func parseTenants(configs []api.Tenant) ([]tenant, error) {
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("at least one tenant must be configured")
+	}
+	tenants := make([]tenant, 0, len(configs))
+	names, namespaces := sets.New[string](), sets.New[string]()
+	direct := ""
+	for _, tc := range configs {
+		switch {
+		case tc.Name == "":
+			return nil, fmt.Errorf("tenant name must be configured")
+		case names.Has(tc.Name):
+			return nil, fmt.Errorf("tenant %s configured more than once", tc.Name)
+		case tc.Namespace == "":
+			return nil, fmt.Errorf("tenant %s: namespace must be configured", tc.Name)
+		case namespaces.Has(tc.Namespace):
+			return nil, fmt.Errorf("tenant %s: namespace %s is used by another tenant", tc.Name, tc.Namespace)
+		case tc.Config == "":
+			return nil, fmt.Errorf("tenant %s: config must be configured", tc.Name)
+		case len(tc.Relays) == 0 && !tc.Direct:
+			return nil, fmt.Errorf("tenant %s: neither relays nor direct clients are configured", tc.Name)
+		case tc.Direct && direct != "":
+			return nil, fmt.Errorf("tenant %s: directly attached clients are assigned to tenant %s already", tc.Name, direct)
+		}
+		names.Insert(tc.Name)
+		namespaces.Insert(tc.Namespace)
+		if tc.Direct {
+			direct = tc.Name
+		}
+
+		relays, err := parseRelays(tc.Relays)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", tc.Name, err)
+		}
+		for _, other := range tenants {
+			for _, prefix := range relays {
+				for _, otherPrefix := range other.relays {
+					if prefix.Overlaps(otherPrefix) {
+						return nil, fmt.Errorf("tenant %s: relays %s overlap with relays %s of tenant %s", tc.Name, prefix, otherPrefix, other.name)
+					}
+				}
+			}
+		}
+
+		conf, err := config.Load(tc.Config)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: failed to load config: %w", tc.Name, err)
+		}
+		if err := checkChain(tc, conf); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, tenant{name: tc.Name, relays: relays, direct: tc.Direct, conf: conf})
+	}
+	return tenants, nil
+}
+
+func newPlugin(name string, args ...string) (*plugin, error) {
+	path, err := parseArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	log.Debugf("Reading tenant config file %s", path)
+	conf := &api.TenantConfig{}
+	if err := api.Load(path, conf); err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+	tenants, err := parseTenants(conf.Tenants)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	metrics.Register(messages)
+	name = instance.Next(name)
+	return &plugin{
+		tenants: tenants,
+		name:    name,
+		log:     log.WithField("instance", name),
+	}, nil
+}
+
+func setup6(args ...string) (handler.Handler6, error) {
+	base, err := newPlugin("tenant/v6", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &plugin6{plugin: base}
+	for _, t := range base.tenants {
+		var handlers []handler.Handler6
+		if t.conf.Server6 != nil {
+			// load the DHCPv6 chain only
+			chain := *t.conf
+			chain.Server4 = nil
+			if _, handlers, err = plugins.LoadPlugins(&chain); err != nil {
+				return nil, fmt.Errorf("tenant %s: failed to load DHCPv6 plugins: %w", t.name, err)
+			}
+		} else {
+			p.log.Warnf("Tenant %s has no DHCPv6 server, its DHCPv6 clients are dropped", t.name)
+		}
+		p.handlers = append(p.handlers, handlers)
+	}
+	p.log.Printf("Loaded tenant plugin for DHCPv6 with %d tenants.", len(p.tenants))
+	return p.handler6, nil
+}
+
+func setup4(args ...string) (handler.Handler4, error) {
+	base, err := newPlugin("tenant/v4", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &plugin4{plugin: base}
+	for _, t := range base.tenants {
+		var handlers []handler.Handler4
+		if t.conf.Server4 != nil {
+			// load the DHCPv4 chain only
+			chain := *t.conf
+			chain.Server6 = nil
+			if handlers, _, err = plugins.LoadPlugins(&chain); err != nil {
+				return nil, fmt.Errorf("tenant %s: failed to load DHCPv4 plugins: %w", t.name, err)
+			}
+		} else {
+			p.log.Warnf("Tenant %s has no DHCPv4 server, its DHCPv4 clients are dropped", t.name)
+		}
+		p.handlers = append(p.handlers, handlers)
+	}
+	p.log.Printf("Loaded tenant plugin for DHCPv4 with %d tenants.", len(p.tenants))
+	return p.handler4, nil
+}
+
+// of returns the index of the tenant of the relay agent address, or of the
+// directly attached clients if relay is nil, -1 if none.
+func (p *plugin) of(relay net.IP) int {
+	if relay == nil {
+		for i, t := range p.tenants {
+			if t.direct {
+				return i
+			}
+		}
+		return -1
+	}
+	addr, ok := netip.AddrFromSlice(relay)
+	if !ok {
+		return -1
+	}
+	addr = addr.Unmap()
+	for i, t := range p.tenants {
+		for _, prefix := range t.relays {
+			if prefix.Contains(addr) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// count counts a message of the tenant, or of no tenant if i is -1.
+func (p *plugin) count(i int) {
+	name := unmatched
+	if i >= 0 {
+		name = p.tenants[i].name
+	}
+	messages.WithLabelValues(p.name, name).Inc()
+}
+
+// dropped logs a message of a client of no tenant.
+func (p *plugin) dropped(family string, relay net.IP) {
+	if relay == nil {
+		p.log.Debugf("Dropping %s message of directly attached client, no tenant serves them", family)
+		return
+	}
+	p.log.Debugf("Dropping %s message relayed by %s of no tenant", family, relay)
+}
+
+// errNoLinkAddress is returned for messages of a relay identifying the
+// client's link by an Interface-ID only, RFC 8415 section 19.1.1.
+var errNoLinkAddress = errors.New("relay sent no link address")
+
+// relay6 returns the link address of the relay closest to the client, nil for
+// directly attached clients. A relay sending the unspecified address instead
+// cannot be told apart from the relays of other tenants.
+func relay6(req dhcpv6.DHCPv6) (net.IP, error) {
+	if !req.IsRelay() {
+		return nil, nil
+	}
+	inner, err := dhcpv6.DecapsulateRelayIndex(req, -1)
+	if err != nil {
+		return nil, err
+	}
+	linkAddr := inner.(*dhcpv6.RelayMessage).LinkAddr
+	if linkAddr == nil || linkAddr.IsUnspecified() {
+		return nil, errNoLinkAddress
+	}
+	return linkAddr, nil
+}
+
+// handler6 runs the chain of the client's tenant. The main chain always stops
+// here, so the entries after the tenant plugin never see the tenants' clients.
+func (p *plugin6) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	relay, err := relay6(req)
+	if errors.Is(err, errNoLinkAddress) {
+		// neither a direct client nor one of a known relay, so of no tenant
+		p.count(-1)
+		p.log.Warnf("Dropping DHCPv6 message of a relay sending no link address, it matches no tenant")
+		return nil, true
+	}
+	if err != nil {
+		p.log.Errorf("Could not decapsulate relayed message: %v", err)
+		return nil, true
+	}
+	i := p.of(relay)
+	p.count(i)
+	if i < 0 {
+		p.dropped("DHCPv6", relay)
+		return nil, true
+	}
+
+	for _, h := range p.handlers[i] {
+		var stop bool
+		if resp, stop = h(req, resp); stop {
+			break
+		}
+	}
+	if len(p.handlers[i]) == 0 {
+		resp = nil
+	}
+	return resp, true
+}
+
+// handler4 runs the chain of the client's tenant, see handler6.
+func (p *plugin4) handler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	var relay net.IP
+	if req.GatewayIPAddr != nil && !req.GatewayIPAddr.IsUnspecified() {
+		relay = req.GatewayIPAddr
+	}
+	i := p.of(relay)
+	p.count(i)
+	if i < 0 {
+		p.dropped("DHCPv4", relay)
+		return nil, true
+	}
+
+	for _, h := range p.handlers[i] {
+		var stop bool
+		if resp, stop = h(req, resp); stop {
+			break
+		}
+	}
+	if len(p.handlers[i]) == 0 {
+		resp = nil
+	}
+	return resp, true
+}
@@ -0,0 +1,257 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package tenant
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var (
+	clientMAC = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+	prodIP    = net.IPv4(10, 1, 0, 100)
+	labIP     = net.IPv4(10, 2, 0, 100)
+)
+
+// leasePlugin leases the address given as argument, or adds it as boot file
+// URL for DHCPv6.
+var leasePlugin = plugins.Plugin{
+	Name: "tenanttest",
+	Setup4: func(args ...string) (handler.Handler4, error) {
+		ip := net.ParseIP(args[0])
+		return func(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+			resp.YourIPAddr = ip
+			return resp, false
+		}, nil
+	},
+	Setup6: func(args ...string) (handler.Handler6, error) {
+		return func(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+			resp.AddOption(dhcpv6.OptBootFileURL(args[0]))
+			return resp, false
+		}, nil
+	},
+}
+
+func init() {
+	_ = plugins.RegisterPlugin(&leasePlugin)
+}
+
+func writeFile(t *testing.T, name, data string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func chainConfig(t *testing.T, ip net.IP) string {
+	return writeFile(t, "chain.yaml", `
+server4:
+  plugins:
+    - tenanttest: `+ip.String()+`
+server6:
+  plugins:
+    - tenanttest: `+ip.String()+`
+`)
+}
+
+// tenantConfig returns a config of the tenants prod, behind the relays of
+// 10.1.0.0/16 and 2001:db8:1::/48, and lab, behind 10.2.0.0/16 and serving
+// the directly attached clients.
+func tenantConfig(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "tenant_config.yaml")
+	if err := api.WriteFile(path, &api.TenantConfig{Tenants: []api.Tenant{
+		{Name: "prod", Relays: []string{"10.1.0.0/16", "2001:db8:1::/48"}, Namespace: "prod", Config: chainConfig(t, prodIP)},
+		{Name: "lab", Relays: []string{"10.2.0.1"}, Direct: true, Namespace: "lab", Config: chainConfig(t, labIP)},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestWrongArgs(t *testing.T) {
+	if _, err := setup4(); err == nil {
+		t.Fatal("no error occurred when not providing a configuration file path, but it should have")
+	}
+	if _, err := setup6("foo", "bar"); err == nil {
+		t.Fatal("no error occurred when providing wrong number of args (2), but it should have")
+	}
+}
+
+func TestParseTenants(t *testing.T) {
+	chain := chainConfig(t, prodIP)
+	ipam := writeFile(t, "ipam_config.yaml", "namespace: lab\nsubnets:\n  - dhcp\n")
+	foreign := writeFile(t, "foreign.yaml", "server6:\n  plugins:\n    - ipam: "+ipam+"\n")
+	nested := writeFile(t, "nested.yaml", "server6:\n  plugins:\n    - tenant: "+chain+"\n")
+	unnamespaced := writeFile(t, "unnamespaced.yaml", "server6:\n  plugins:\n    - ipam: "+writeFile(t, "ipam.yaml", "subnets:\n  - dhcp\n")+"\n")
+	bootOperator := writeFile(t, "bootoperator.yaml", "server6:\n  plugins:\n    - httpboot: https://boot.example.org/default.uki bootoperator=lab\n")
+	clusterScoped := writeFile(t, "metal.yaml", "server6:\n  plugins:\n    - metal: metal_config.yaml\n")
+	duidFile := writeFile(t, "duidfile.yaml", "server6:\n  plugins:\n    - serverduid: "+
+		writeFile(t, "serverduid_file.yaml", "type: ll\nstore: file\npath: /var/lib/fedhcp/duid\n")+"\n")
+	duidConfigMap := writeFile(t, "duidconfigmap.yaml", "server6:\n  plugins:\n    - serverduid: "+
+		writeFile(t, "serverduid_configmap.yaml", "type: ll\nstore: configmap\nnamespace: prod\nname: fedhcp-duid\n")+"\n")
+
+	for _, invalid := range [][]api.Tenant{
+		nil,
+		{{Relays: []string{"10.1.0.0/16"}, Namespace: "prod", Config: chain}},
+		{{Name: "prod", Relays: []string{"10.1.0.0/16"}, Config: chain}},
+		{{Name: "prod", Relays: []string{"10.1.0.0/16"}, Namespace: "prod"}},
+		{{Name: "prod", Namespace: "prod", Config: chain}},
+		{{Name: "prod", Relays: []string{"10.1.0.0/33"}, Namespace: "prod", Config: chain}},
+		{{Name: "prod", Relays: []string{"10.1.0.0/16"}, Namespace: "prod", Config: "does-not-exist.yaml"}},
+		// tenants must not share names, namespaces, relays or direct clients
+		{{Name: "prod", Direct: true, Namespace: "prod", Config: chain}, {Name: "prod", Direct: true, Namespace: "lab", Config: chain}},
+		{{Name: "prod", Direct: true, Namespace: "prod", Config: chain}, {Name: "lab", Relays: []string{"10.2.0.0/16"}, Namespace: "prod", Config: chain}},
+		{{Name: "prod", Relays: []string{"10.0.0.0/8"}, Namespace: "prod", Config: chain}, {Name: "lab", Relays: []string{"10.2.0.1"}, Namespace: "lab", Config: chain}},
+		{{Name: "prod", Direct: true, Namespace: "prod", Config: chain}, {Name: "lab", Direct: true, Namespace: "lab", Config: chain}},
+		// the chain of a tenant must stay in its namespace and not nest tenants
+		{{Name: "prod", Direct: true, Namespace: "prod", Config: foreign}},
+		{{Name: "prod", Direct: true, Namespace: "prod", Config: nested}},
+		{{Name: "prod", Direct: true, Namespace: "prod", Config: unnamespaced}},
+		{{Name: "prod", Direct: true, Namespace: "prod", Config: bootOperator}},
+		{{Name: "lab", Direct: true, Namespace: "lab", Config: duidConfigMap}},
+		// cluster-scoped objects cannot be isolated
+		{{Name: "prod", Direct: true, Namespace: "prod", Config: clusterScoped}},
+	} {
+		if _, err := parseTenants(invalid); err == nil {
+			t.Errorf("expected an error for %+v", invalid)
+		}
+	}
+
+	tenants, err := parseTenants([]api.Tenant{
+		{Name: "lab", Direct: true, Namespace: "lab", Config: foreign},
+		{Name: "prod", Relays: []string{"10.1.0.0/16"}, Namespace: "prod", Config: chain},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tenants) != 2 || !tenants[0].direct {
+		t.Errorf("expected the tenant lab serving direct clients and prod, got %+v", tenants)
+	}
+	if _, err := parseTenants([]api.Tenant{{Name: "lab", Direct: true, Namespace: "lab", Config: bootOperator}}); err != nil {
+		t.Errorf("unexpected error for a boot-operator lookup in the tenant's namespace: %v", err)
+	}
+	// the DUID of a file store is not kept in kubernetes, so it has no namespace
+	for _, config := range []string{duidFile, duidConfigMap} {
+		if _, err := parseTenants([]api.Tenant{{Name: "prod", Direct: true, Namespace: "prod", Config: config}}); err != nil {
+			t.Errorf("unexpected error for the DUID store of %s: %v", config, err)
+		}
+	}
+}
+
+/* IPv6 */
+func newRequest6(t *testing.T) *dhcpv6.Message {
+	req, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.MessageType = dhcpv6.MessageTypeSolicit
+	req.AddOption(dhcpv6.OptClientID(&dhcpv6.DUIDLL{HWType: iana.HWTypeEthernet, LinkLayerAddr: clientMAC}))
+	return req
+}
+
+func TestTenants6(t *testing.T) {
+	h, err := setup6(tenantConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		relay    net.IP
+		expected net.IP
+	}{
+		{net.ParseIP("2001:db8:1::1"), prodIP},
+		{nil, labIP},
+		{net.ParseIP("2001:db8:3::1"), nil},
+		// a relay identifying the link by an Interface-ID only is of no tenant
+		{net.IPv6unspecified, nil},
+	} {
+		msg := newRequest6(t)
+		var req dhcpv6.DHCPv6 = msg
+		if tc.relay != nil {
+			if req, err = dhcpv6.EncapsulateRelay(msg, dhcpv6.MessageTypeRelayForward, tc.relay, net.ParseIP("fe80::1")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		stub, err := dhcpv6.NewAdvertiseFromSolicit(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, stop := h(req, stub)
+		if !stop {
+			t.Errorf("expected the main chain to stop for relay %s", tc.relay)
+		}
+		if tc.expected == nil {
+			if resp != nil {
+				t.Errorf("expected the message relayed by %s to be dropped, got %v", tc.relay, resp)
+			}
+			continue
+		}
+		if resp == nil {
+			t.Fatalf("expected a response for relay %s", tc.relay)
+		}
+		opts := resp.(*dhcpv6.Message).Options.Get(dhcpv6.OptionBootfileURL)
+		if len(opts) != 1 || opts[0].String() != dhcpv6.OptBootFileURL(tc.expected.String()).String() {
+			t.Errorf("expected the chain of the tenant of %s only, got %v", tc.expected, opts)
+		}
+	}
+	if dropped := testutil.ToFloat64(messages.WithLabelValues("tenant/v6#1", unmatched)); dropped != 2 {
+		t.Errorf("expected 2 messages of no tenant, got %v", dropped)
+	}
+}
+
+/* IPv4 */
+func TestTenants4(t *testing.T) {
+	h, err := setup4(tenantConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		relay    net.IP
+		expected net.IP
+	}{
+		{net.IPv4(10, 1, 2, 1), prodIP},
+		{net.IPv4(10, 2, 0, 1), labIP},
+		{nil, labIP},
+		{net.IPv4(10, 2, 0, 2), nil},
+	} {
+		req, err := dhcpv4.NewDiscovery(clientMAC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.relay != nil {
+			req.GatewayIPAddr = tc.relay
+		}
+		stub, err := dhcpv4.NewReplyFromRequest(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, stop := h(req, stub)
+		if !stop {
+			t.Errorf("expected the main chain to stop for relay %s", tc.relay)
+		}
+		switch {
+		case tc.expected == nil && resp != nil:
+			t.Errorf("expected the message relayed by %s to be dropped, got %s", tc.relay, resp.YourIPAddr)
+		case tc.expected != nil && (resp == nil || !resp.YourIPAddr.Equal(tc.expected)):
+			t.Errorf("expected %s leased for relay %s, got %v", tc.expected, tc.relay, resp)
+		}
+	}
+	if prod := testutil.ToFloat64(messages.WithLabelValues("tenant/v4#1", "prod")); prod != 1 {
+		t.Errorf("expected 1 message of tenant prod, got %v", prod)
+	}
+}
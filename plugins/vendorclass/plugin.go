@@ -0,0 +1,133 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package vendorclass
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/ironcore-dev/fedhcp/internal/printer"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logger.GetLogger("plugins/vendorclass")
+
+var Plugin = plugins.Plugin{
+	Name:   "vendorclass",
+	Setup6: setup6,
+}
+
+// plugin holds the state of a single vendorclass plugin instance. It is built
+// once in setup6 and never modified afterwards.
+type plugin struct {
+	allow             []string
+	deny              []string
+	allowUnclassified bool
+	log               *logrus.Entry
+}
+
+// args[0] = path to config file
+func parseArgs(args ...string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("exactly one argument must be passed to the vendorclass plugin, got %d", len(args))
+	}
+	return args[0], nil
+}
+
+func loadConfig(args ...string) (*api.VendorClassConfig, error) {
+	path, err := parseArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	log.Debugf("Reading vendorclass config file %s", path)
+	config := &api.VendorClassConfig{}
+	if err := api.Load(path, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func setup6(args ...string) (handler.Handler6, error) {
+	vendorClassConfig, err := loadConfig(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(vendorClassConfig.Allow) == 0 && len(vendorClassConfig.Deny) == 0 {
+		return nil, fmt.Errorf("at least one allowed or denied vendor class must be configured")
+	}
+
+	p := &plugin{
+		allow:             vendorClassConfig.Allow,
+		deny:              vendorClassConfig.Deny,
+		allowUnclassified: vendorClassConfig.AllowUnclassified,
+		log:               instance.Logger(log, "vendorclass/v6"),
+	}
+
+	p.log.Infof("Loaded vendorclass plugin for DHCPv6 with %d allowed and %d denied vendor classes",
+		len(p.allow), len(p.deny))
+	return p.handler6, nil
+}
+
+func (p *plugin) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	printer.VerboseRequest(p.log, req)
+
+	m, err := req.GetInnerMessage()
+	if err != nil {
+		p.log.Errorf("Could not decapsulate request: %v", err)
+		return nil, true
+	}
+
+	var classes []string
+	for _, vc := range m.Options.VendorClasses() {
+		for _, data := range vc.Data {
+			classes = append(classes, string(data))
+		}
+	}
+
+	if len(classes) == 0 {
+		if p.allowUnclassified {
+			return resp, false
+		}
+		p.log.Infof("Dropping request without vendor class: %s", req.Summary())
+		return nil, true
+	}
+
+	for _, class := range classes {
+		if matchesAny(class, p.deny) {
+			p.log.Infof("Dropping request with denied vendor class %q", class)
+			return nil, true
+		}
+	}
+
+	if len(p.allow) == 0 {
+		return resp, false
+	}
+	for _, class := range classes {
+		if matchesAny(class, p.allow) {
+			p.log.Debugf("Vendor class %q allowed", class)
+			return resp, false
+		}
+	}
+
+	p.log.Infof("Dropping request with vendor class(es) %q, none is allowed", classes)
+	return nil, true
+}
+
+func matchesAny(class string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(class, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package vendorclass
+
+import (
+	"net"
+	"testing"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/api/apitest"
+)
+
+func Init6(t *testing.T, config api.VendorClassConfig) (handler.Handler6, error) {
+	return setup6(apitest.WriteConfig(t, config))
+}
+
+func newRequest(t *testing.T, vendorClasses ...string) dhcpv6.DHCPv6 {
+	req, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.MessageType = dhcpv6.MessageTypeSolicit
+	for _, vc := range vendorClasses {
+		req.AddOption(&dhcpv6.OptVendorClass{EnterpriseNumber: 1337, Data: [][]byte{[]byte(vc)}})
+	}
+
+	relayedRequest, err := dhcpv6.EncapsulateRelay(req, dhcpv6.MessageTypeRelayForward, net.IPv6loopback, net.IPv6loopback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return relayedRequest
+}
+
+func newStub(t *testing.T) dhcpv6.DHCPv6 {
+	stub, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.MessageType = dhcpv6.MessageTypeAdvertise
+	return stub
+}
+
+/* parametrization */
+func TestWrongNumberArgs(t *testing.T) {
+	_, err := setup6()
+	if err == nil {
+		t.Fatal("no error occurred when not providing a configuration file path, but it should have")
+	}
+
+	_, err = setup6("non-existing.yaml")
+	if err == nil {
+		t.Fatal("no error occurred when providing non existing configuration path, but it should have")
+	}
+
+	_, err = setup6("foo", "bar")
+	if err == nil {
+		t.Fatal("no error occurred when providing wrong number of args (2), but it should have")
+	}
+}
+
+func TestEmptyConfig(t *testing.T) {
+	_, err := Init6(t, api.VendorClassConfig{})
+	if err == nil {
+		t.Fatal("no error occurred when providing an empty configuration, but it should have")
+	}
+}
+
+/* IPv6 */
+func TestAllowedVendorClass6(t *testing.T) {
+	handler6, err := Init6(t, api.VendorClassConfig{Allow: []string{"HTTPClient", "SONiC-ZTP"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, vc := range []string{"HTTPClient", "HTTPClient:Arch:00016", "SONiC-ZTP"} {
+		resp, stop := handler6(newRequest(t, vc), newStub(t))
+		if resp == nil {
+			t.Fatalf("plugin dropped request with allowed vendor class %s", vc)
+		}
+		if stop {
+			t.Errorf("plugin interrupted processing for allowed vendor class %s, but it shouldn't have", vc)
+		}
+	}
+}
+
+func TestNotAllowedVendorClass6(t *testing.T) {
+	handler6, err := Init6(t, api.VendorClassConfig{Allow: []string{"HTTPClient"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, stop := handler6(newRequest(t, "PXEClient:Arch:00007"), newStub(t))
+	if resp != nil {
+		t.Error("plugin returned a message for a not allowed vendor class, but it shouldn't have")
+	}
+	if !stop {
+		t.Error("plugin did not interrupt processing for a not allowed vendor class, but it should have")
+	}
+}
+
+func TestDeniedVendorClass6(t *testing.T) {
+	handler6, err := Init6(t, api.VendorClassConfig{
+		Allow: []string{"HTTPClient"},
+		Deny:  []string{"HTTPClient:Arch:00010"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, stop := handler6(newRequest(t, "HTTPClient:Arch:00010"), newStub(t))
+	if resp != nil || !stop {
+		t.Error("plugin did not drop a request with a denied vendor class, but it should have")
+	}
+
+	resp, stop = handler6(newRequest(t, "HTTPClient:Arch:00016"), newStub(t))
+	if resp == nil || stop {
+		t.Error("plugin dropped a request with an allowed vendor class, but it shouldn't have")
+	}
+}
+
+func TestUnclassified6(t *testing.T) {
+	handler6, err := Init6(t, api.VendorClassConfig{Deny: []string{"PXEClient"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, stop := handler6(newRequest(t), newStub(t))
+	if resp != nil || !stop {
+		t.Error("plugin did not drop a request without vendor class, but it should have")
+	}
+
+	resp, stop = handler6(newRequest(t, "HTTPClient"), newStub(t))
+	if resp == nil || stop {
+		t.Error("plugin dropped a request with a not denied vendor class, but it shouldn't have")
+	}
+
+	handler6, err = Init6(t, api.VendorClassConfig{Deny: []string{"PXEClient"}, AllowUnclassified: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, stop = handler6(newRequest(t), newStub(t))
+	if resp == nil || stop {
+		t.Error("plugin dropped a request without vendor class, but it shouldn't have")
+	}
+}
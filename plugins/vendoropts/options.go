@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package vendoropts
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// vendorData are the vendor-specific suboptions of an enterprise.
+type vendorData struct {
+	enterpriseNumber uint32
+	data             []byte
+}
+
+// viVendorSpecific is the DHCPv4 V-I Vendor-Specific Information option
+// (option 125, RFC 3925, section 4), which the dhcpv4 package does not implement.
+type viVendorSpecific []vendorData
+
+// ToBytes encodes the enterprise number, data length and suboptions of each enterprise.
+func (v viVendorSpecific) ToBytes() []byte {
+	var buf []byte
+	for _, vd := range v {
+		buf = binary.BigEndian.AppendUint32(buf, vd.enterpriseNumber)
+		buf = append(buf, byte(len(vd.data)))
+		buf = append(buf, vd.data...)
+	}
+	return buf
+}
+
+func (v viVendorSpecific) String() string {
+	enterprises := make([]string, 0, len(v))
+	for _, vd := range v {
+		enterprises = append(enterprises, fmt.Sprintf("%d: %x", vd.enterpriseNumber, vd.data))
+	}
+	return strings.Join(enterprises, ", ")
+}
+
+// parseVIVendorSpecific decodes option 125 as sent by a client.
+func parseVIVendorSpecific(data []byte) (viVendorSpecific, error) {
+	var v viVendorSpecific
+	for len(data) > 0 {
+		if len(data) < 5 {
+			return nil, fmt.Errorf("truncated enterprise header of %d bytes", len(data))
+		}
+		n := int(data[4])
+		if len(data) < 5+n {
+			return nil, fmt.Errorf("enterprise data of %d bytes exceeds the option", n)
+		}
+		v = append(v, vendorData{enterpriseNumber: binary.BigEndian.Uint32(data), data: data[5 : 5+n]})
+		data = data[5+n:]
+	}
+	return v, nil
+}
+
+// encodeSubOptions4 encodes DHCPv4 vendor suboptions, each with a one byte code
+// and length, which have to fit the one byte data length of the enterprise.
+func encodeSubOptions4(options []subOption) ([]byte, error) {
+	var buf []byte
+	for _, o := range options {
+		if o.code > math.MaxUint8 {
+			return nil, fmt.Errorf("suboption code %d exceeds %d", o.code, math.MaxUint8)
+		}
+		if len(o.data) > math.MaxUint8 {
+			return nil, fmt.Errorf("suboption %d of %d bytes exceeds %d bytes", o.code, len(o.data), math.MaxUint8)
+		}
+		buf = append(buf, byte(o.code), byte(len(o.data)))
+		buf = append(buf, o.data...)
+	}
+	if len(buf) > math.MaxUint8 {
+		return nil, fmt.Errorf("suboptions of %d bytes exceed %d bytes", len(buf), math.MaxUint8)
+	}
+	return buf, nil
+}
+
+// vendorClassData splits the vendor-class-data of option 124 into its
+// length-prefixed instances (RFC 3925, section 3). Data not following that
+// format is taken as a single instance.
+func vendorClassData(data []byte) []string {
+	var classes []string
+	for rest := data; len(rest) > 0; {
+		n := int(rest[0])
+		if n == 0 || len(rest) < 1+n {
+			return []string{string(data)}
+		}
+		classes = append(classes, string(rest[1:1+n]))
+		rest = rest[1+n:]
+	}
+	return classes
+}
@@ -0,0 +1,238 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package vendoropts
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logger.GetLogger("plugins/vendoropts")
+
+var Plugin = plugins.Plugin{
+	Name:   "vendoropts",
+	Setup4: setup4,
+	Setup6: setup6,
+}
+
+type subOption struct {
+	code uint16
+	data []byte
+}
+
+// enterprise is the parsed configuration of a vendor.
+type enterprise struct {
+	number        uint32
+	vendorClasses []string
+	options       []subOption
+	// options4 are the options encoded for option 125, set in setup4
+	options4 []byte
+}
+
+// plugin holds the state of a single vendoropts plugin instance. It is built
+// once in setup and never modified afterwards.
+type plugin struct {
+	enterprises []*enterprise
+	log         *logrus.Entry
+}
+
+// args[0] = path to config file
+func parseArgs(args ...string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("exactly one argument must be passed to the vendoropts plugin, got %d", len(args))
+	}
+	return args[0], nil
+}
+
+func loadConfig(args ...string) (*api.VendorOptsConfig, error) {
+	path, err := parseArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	log.Debugf("Reading config file %s", path)
+	config := &api.VendorOptsConfig{}
+	if err := api.Load(path, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func parseSubOption(config api.VendorSubOption) (subOption, error) {
+	o := subOption{code: config.Code}
+	switch {
+	case config.Code == 0:
+		return o, fmt.Errorf("suboption code must be positive")
+	case config.Value != "" && config.Hex != "":
+		return o, fmt.Errorf("suboption %d must have either a value or hex, not both", config.Code)
+	case config.Hex != "":
+		data, err := hex.DecodeString(config.Hex)
+		if err != nil {
+			return o, fmt.Errorf("invalid hex of suboption %d: %w", config.Code, err)
+		}
+		o.data = data
+	default:
+		o.data = []byte(config.Value)
+	}
+	return o, nil
+}
+
+func newPlugin(name string, args ...string) (*plugin, error) {
+	config, err := loadConfig(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(config.Enterprises) == 0 {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("at least one enterprise must be configured")}
+	}
+	p := &plugin{log: instance.Logger(log, name)}
+	for _, ec := range config.Enterprises {
+		if ec.EnterpriseNumber == 0 {
+			return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("enterpriseNumber must be configured")}
+		}
+		if len(ec.Options) == 0 {
+			return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("enterprise %d: at least one option must be configured", ec.EnterpriseNumber)}
+		}
+		e := &enterprise{number: ec.EnterpriseNumber, vendorClasses: ec.VendorClasses}
+		for _, oc := range ec.Options {
+			o, err := parseSubOption(oc)
+			if err != nil {
+				return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("enterprise %d: %w", ec.EnterpriseNumber, err)}
+			}
+			e.options = append(e.options, o)
+		}
+		p.enterprises = append(p.enterprises, e)
+	}
+	return p, nil
+}
+
+func setup6(args ...string) (handler.Handler6, error) {
+	p, err := newPlugin("vendoropts/v6", args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded vendoropts plugin for DHCPv6 with %d enterprises.", len(p.enterprises))
+	return p.handler6, nil
+}
+
+func setup4(args ...string) (handler.Handler4, error) {
+	p, err := newPlugin("vendoropts/v4", args...)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.encode4(); err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded vendoropts plugin for DHCPv4 with %d enterprises.", len(p.enterprises))
+	return p.handler4, nil
+}
+
+// encode4 encodes the options of all enterprises for option 125.
+func (p *plugin) encode4() error {
+	for _, e := range p.enterprises {
+		options4, err := encodeSubOptions4(e.options)
+		if err != nil {
+			return &fedhcperrors.ConfigError{Err: fmt.Errorf("enterprise %d: %w", e.number, err)}
+		}
+		e.options4 = options4
+	}
+	return nil
+}
+
+// matches reports whether a client matches the enterprise: by its vendor
+// classes if prefixes are configured, otherwise by identifying with the
+// enterprise in a vendor class or, if identified is set, vendor options.
+func (e *enterprise) matches(classes []string, identified bool) bool {
+	if len(e.vendorClasses) == 0 {
+		return identified || len(classes) > 0
+	}
+	for _, class := range classes {
+		for _, prefix := range e.vendorClasses {
+			if strings.HasPrefix(class, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *plugin) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	m, err := req.GetInnerMessage()
+	if err != nil {
+		p.log.Errorf("Could not decapsulate request: %v", err)
+		return resp, false
+	}
+
+	identified := make(map[uint32]bool)
+	for _, vo := range m.Options.VendorOpts() {
+		identified[vo.EnterpriseNumber] = true
+	}
+	for _, e := range p.enterprises {
+		var classes []string
+		for _, data := range m.Options.VendorClass(e.number) {
+			classes = append(classes, string(data))
+		}
+		if !e.matches(classes, identified[e.number]) {
+			continue
+		}
+
+		opts := &dhcpv6.OptVendorOpts{EnterpriseNumber: e.number}
+		for _, o := range e.options {
+			opts.VendorOpts.Add(&dhcpv6.OptionGeneric{OptionCode: dhcpv6.OptionCode(o.code), OptionData: o.data})
+		}
+		resp.AddOption(opts)
+		p.log.Debugf("Added vendor options of enterprise %d for %s", e.number, req.Summary())
+	}
+	return resp, false
+}
+
+func (p *plugin) handler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	identified := make(map[uint32]bool)
+	if data := req.Options.Get(dhcpv4.OptionVendorIdentifyingVendorSpecific); data != nil {
+		vivso, err := parseVIVendorSpecific(data)
+		if err != nil {
+			p.log.Debugf("Ignoring malformed V-I vendor-specific information of %s: %v", req.ClientHWAddr, err)
+		}
+		for _, vd := range vivso {
+			identified[vd.enterpriseNumber] = true
+		}
+	}
+
+	var vivso viVendorSpecific
+	for _, e := range p.enterprises {
+		var classes []string
+		for _, id := range req.VIVC() {
+			if uint32(id.EntID) == e.number {
+				classes = append(classes, vendorClassData(id.Data)...)
+			}
+		}
+		if len(e.vendorClasses) > 0 {
+			if class := req.ClassIdentifier(); class != "" {
+				classes = append(classes, class)
+			}
+		}
+		if !e.matches(classes, identified[e.number]) {
+			continue
+		}
+		vivso = append(vivso, vendorData{enterpriseNumber: e.number, data: e.options4})
+	}
+
+	if len(vivso) > 0 {
+		resp.UpdateOption(dhcpv4.Option{Code: dhcpv4.OptionVendorIdentifyingVendorSpecific, Value: vivso})
+		p.log.Debugf("Added V-I vendor-specific information %s for %s", vivso, req.ClientHWAddr)
+	}
+	return resp, false
+}
@@ -0,0 +1,221 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package vendoropts
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/api/apitest"
+)
+
+const (
+	switchVendor = 30065
+	nicVendor    = 4413
+)
+
+var (
+	mac = net.HardwareAddr{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+
+	config = api.VendorOptsConfig{
+		Enterprises: []api.VendorEnterprise{
+			{
+				EnterpriseNumber: switchVendor,
+				VendorClasses:    []string{"SONiC"},
+				Options: []api.VendorSubOption{
+					{Code: 1, Value: "http://ztp.example.com/ztp.json"},
+				},
+			},
+			{
+				EnterpriseNumber: nicVendor,
+				Options: []api.VendorSubOption{
+					{Code: 2, Hex: "0a0b"},
+				},
+			},
+		},
+	}
+)
+
+func Init4(t *testing.T) *plugin {
+	p := Init6(t)
+	if err := p.encode4(); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func Init6(t *testing.T) *plugin {
+	p, err := newPlugin("vendoropts/test", apitest.WriteConfig(t, config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestWrongNumberArgs(t *testing.T) {
+	_, err := setup6()
+	if err == nil {
+		t.Fatal("no error occurred when not providing a configuration file path, but it should have")
+	}
+
+	_, err = setup4("foo", "bar")
+	if err == nil {
+		t.Fatal("no error occurred when providing wrong number of args (2), but it should have")
+	}
+}
+
+func TestWrongArgs(t *testing.T) {
+	withOptions := func(options ...api.VendorSubOption) api.VendorOptsConfig {
+		return api.VendorOptsConfig{Enterprises: []api.VendorEnterprise{{EnterpriseNumber: nicVendor, Options: options}}}
+	}
+
+	for _, config := range []api.VendorOptsConfig{
+		{},
+		{Enterprises: []api.VendorEnterprise{{Options: []api.VendorSubOption{{Code: 1, Value: "foo"}}}}},
+		withOptions(),
+		withOptions(api.VendorSubOption{Value: "foo"}),
+		withOptions(api.VendorSubOption{Code: 1, Value: "foo", Hex: "00"}),
+		withOptions(api.VendorSubOption{Code: 1, Hex: "xyz"}),
+	} {
+		if _, err := setup6(apitest.WriteConfig(t, config)); err == nil {
+			t.Errorf("no error occurred for invalid config %+v, but it should have", config)
+		}
+	}
+
+	// suboptions not fitting the one byte codes and lengths of DHCPv4
+	for _, config := range []api.VendorOptsConfig{
+		withOptions(api.VendorSubOption{Code: 256, Value: "foo"}),
+		withOptions(api.VendorSubOption{Code: 1, Hex: string(bytes.Repeat([]byte("00"), 256))}),
+		withOptions(api.VendorSubOption{Code: 1, Hex: string(bytes.Repeat([]byte("00"), 200))},
+			api.VendorSubOption{Code: 2, Hex: string(bytes.Repeat([]byte("00"), 100))}),
+	} {
+		if _, err := setup6(apitest.WriteConfig(t, config)); err != nil {
+			t.Errorf("unexpected error for config valid in DHCPv6 %+v: %v", config, err)
+		}
+		if _, err := setup4(apitest.WriteConfig(t, config)); err == nil {
+			t.Errorf("no error occurred for config invalid in DHCPv4 %+v, but it should have", config)
+		}
+	}
+}
+
+func TestVendorClassData(t *testing.T) {
+	if classes := vendorClassData([]byte("\x05SONiC\x03foo")); len(classes) != 2 || classes[0] != "SONiC" || classes[1] != "foo" {
+		t.Errorf("expected length-prefixed instances SONiC and foo, got %q", classes)
+	}
+	if classes := vendorClassData([]byte("SONiC")); len(classes) != 1 || classes[0] != "SONiC" {
+		t.Errorf("expected unprefixed data to be a single instance, got %q", classes)
+	}
+}
+
+func TestParseVIVendorSpecific(t *testing.T) {
+	option := viVendorSpecific{
+		{enterpriseNumber: nicVendor, data: []byte{2, 2, 0x0a, 0x0b}},
+		{enterpriseNumber: switchVendor, data: []byte{1, 1, 'x'}},
+	}
+	parsed, err := parseVIVendorSpecific(option.ToBytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.String() != option.String() {
+		t.Errorf("expected %s, got %s", option, parsed)
+	}
+
+	if _, err := parseVIVendorSpecific(option.ToBytes()[:7]); err == nil {
+		t.Error("no error occurred for truncated option, but it should have")
+	}
+}
+
+/* IPv6 */
+func TestVendorOpts6(t *testing.T) {
+	p := Init6(t)
+
+	req, _ := dhcpv6.NewSolicit(mac)
+	req.AddOption(&dhcpv6.OptVendorClass{EnterpriseNumber: switchVendor, Data: [][]byte{[]byte("SONiC-ZTP")}})
+	req.AddOption(&dhcpv6.OptVendorClass{EnterpriseNumber: nicVendor, Data: [][]byte{[]byte("any")}})
+	resp, _ := dhcpv6.NewAdvertiseFromSolicit(req)
+
+	result, stop := p.handler6(req, resp)
+	if stop {
+		t.Fatal("plugin must not break the chain")
+	}
+	opts := result.(*dhcpv6.Message).Options.VendorOpts()
+	if len(opts) != 2 {
+		t.Fatalf("expected vendor options of 2 enterprises, got %d", len(opts))
+	}
+	if opts[0].EnterpriseNumber != switchVendor || string(opts[0].VendorOpts.GetOne(1).ToBytes()) != "http://ztp.example.com/ztp.json" {
+		t.Errorf("unexpected vendor options %s", opts[0])
+	}
+	if opts[1].EnterpriseNumber != nicVendor || !bytes.Equal(opts[1].VendorOpts.GetOne(2).ToBytes(), []byte{0x0a, 0x0b}) {
+		t.Errorf("unexpected vendor options %s", opts[1])
+	}
+}
+
+func TestVendorOpts6NoMatch(t *testing.T) {
+	p := Init6(t)
+
+	req, _ := dhcpv6.NewSolicit(mac)
+	req.AddOption(&dhcpv6.OptVendorClass{EnterpriseNumber: switchVendor, Data: [][]byte{[]byte("ONIE")}})
+	resp, _ := dhcpv6.NewAdvertiseFromSolicit(req)
+
+	result, _ := p.handler6(req, resp)
+	if opts := result.(*dhcpv6.Message).Options.VendorOpts(); len(opts) != 0 {
+		t.Errorf("expected no vendor options, got %v", opts)
+	}
+}
+
+/* IPv4 */
+func TestVendorOpts4(t *testing.T) {
+	p := Init4(t)
+
+	req, _ := dhcpv4.NewDiscovery(mac, dhcpv4.WithOption(dhcpv4.OptClassIdentifier("SONiC-ZTP")))
+	// the NIC identifies in its own V-I vendor-specific information
+	req.UpdateOption(dhcpv4.Option{
+		Code:  dhcpv4.OptionVendorIdentifyingVendorSpecific,
+		Value: viVendorSpecific{{enterpriseNumber: nicVendor}},
+	})
+	resp, _ := dhcpv4.NewReplyFromRequest(req)
+
+	result, stop := p.handler4(req, resp)
+	if stop {
+		t.Fatal("plugin must not break the chain")
+	}
+	parsed, err := parseVIVendorSpecific(result.Options.Get(dhcpv4.OptionVendorIdentifyingVendorSpecific))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 2 || parsed[0].enterpriseNumber != switchVendor || parsed[1].enterpriseNumber != nicVendor {
+		t.Fatalf("expected V-I vendor-specific information of 2 enterprises, got %s", parsed)
+	}
+	if !bytes.Equal(parsed[1].data, []byte{2, 2, 0x0a, 0x0b}) {
+		t.Errorf("unexpected suboptions %x", parsed[1].data)
+	}
+}
+
+func TestVendorOpts4VIVC(t *testing.T) {
+	p := Init4(t)
+
+	req, _ := dhcpv4.NewDiscovery(mac, dhcpv4.WithOption(dhcpv4.OptVIVC(dhcpv4.VIVCIdentifier{
+		EntID: iana.EnterpriseID(switchVendor),
+		Data:  []byte("\x05SONiC"),
+	})))
+	resp, _ := dhcpv4.NewReplyFromRequest(req)
+
+	result, _ := p.handler4(req, resp)
+	parsed, _ := parseVIVendorSpecific(result.Options.Get(dhcpv4.OptionVendorIdentifyingVendorSpecific))
+	if len(parsed) != 1 || parsed[0].enterpriseNumber != switchVendor {
+		t.Fatalf("expected V-I vendor-specific information of the switch vendor, got %s", parsed)
+	}
+
+	req, _ = dhcpv4.NewDiscovery(mac)
+	resp, _ = dhcpv4.NewReplyFromRequest(req)
+	result, _ = p.handler4(req, resp)
+	if result.Options.Has(dhcpv4.OptionVendorIdentifyingVendorSpecific) {
+		t.Error("expected no V-I vendor-specific information for an unidentified client")
+	}
+}
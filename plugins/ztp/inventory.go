@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package ztp
+
+import (
+	"cmp"
+	"encoding/json"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ironcore-dev/fedhcp/internal/admin"
+)
+
+var (
+	// registry holds the plugin instances whose switches are exported
+	registryMu sync.Mutex
+	registry   []*plugin
+	// registerInventory registers the inventory endpoint with the first instance
+	registerInventory sync.Once
+)
+
+// sighting is the DHCP state of a switch as last seen by an instance.
+type sighting struct {
+	sw       sw
+	ip       net.IP
+	lastSeen time.Time
+}
+
+// inventoryDocument is the switch inventory served under /ztp/inventory.
+type inventoryDocument struct {
+	Switches []switchState `json:"switches"`
+}
+
+// switchState is a switch of the inventory, merged over the instances.
+type switchState struct {
+	Name       string `json:"name"`
+	MACAddress string `json:"macAddress"`
+	Mode       string `json:"mode"`
+	URL        string `json:"url"`
+	// ManagementIPs are the addresses last handed out to the switch, per family
+	ManagementIPs []string `json:"managementIPs,omitempty"`
+	// LastSeen is the time of the last request of the switch, unset if none was seen
+	LastSeen *time.Time `json:"lastSeen,omitempty"`
+}
+
+// register adds the instance to the exported inventory.
+func (p *plugin) register() {
+	registryMu.Lock()
+	registry = append(registry, p)
+	registryMu.Unlock()
+	registerInventory.Do(func() {
+		admin.Handle("/ztp/inventory", http.HandlerFunc(serveInventory))
+	})
+}
+
+// see records a request of the switch, with the address handed out to it if
+// already set by the plugins before.
+func (p *plugin) see(mac net.HardwareAddr, s sw, ip net.IP) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	seen := p.seen[mac.String()]
+	seen.sw, seen.lastSeen = s, time.Now()
+	if ip != nil && !ip.IsUnspecified() {
+		seen.ip = ip
+	}
+	p.seen[mac.String()] = seen
+}
+
+// inventory returns the configured switches and those seen by the instance,
+// which includes the switches of ConfigMaps.
+func (p *plugin) inventory(switches map[string]*switchState) {
+	for mac, s := range p.switches {
+		merge(switches, mac, s)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for mac, seen := range p.seen {
+		state := merge(switches, mac, seen.sw)
+		if seen.ip != nil && !slices.Contains(state.ManagementIPs, seen.ip.String()) {
+			state.ManagementIPs = append(state.ManagementIPs, seen.ip.String())
+		}
+		if state.LastSeen == nil || seen.lastSeen.After(*state.LastSeen) {
+			state.LastSeen = &seen.lastSeen
+		}
+	}
+}
+
+func merge(switches map[string]*switchState, mac string, s sw) *switchState {
+	state, ok := switches[mac]
+	if !ok {
+		state = &switchState{MACAddress: mac}
+		switches[mac] = state
+	}
+	state.Name, state.Mode, state.URL = s.name, s.mode, s.url
+	return state
+}
+
+// serveInventory returns the switches of all instances with their management
+// addresses and the time they were last seen, ordered by MAC address. It is
+// rendered on each request, so it reflects the latest requests and ConfigMaps.
+func serveInventory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switches := make(map[string]*switchState)
+	registryMu.Lock()
+	for _, p := range registry {
+		p.inventory(switches)
+	}
+	registryMu.Unlock()
+
+	document := inventoryDocument{Switches: make([]switchState, 0, len(switches))}
+	for _, state := range switches {
+		slices.Sort(state.ManagementIPs)
+		document.Switches = append(document.Switches, *state)
+	}
+	slices.SortFunc(document.Switches, func(a, b switchState) int { return cmp.Compare(a.MACAddress, b.MACAddress) })
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(document)
+}
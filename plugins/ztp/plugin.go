@@ -0,0 +1,367 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package ztp
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	fedhcperrors "github.com/ironcore-dev/fedhcp/internal/errors"
+	"github.com/ironcore-dev/fedhcp/internal/instance"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/ironcore-dev/fedhcp/internal/rawopts"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var log = logger.GetLogger("plugins/ztp")
+
+var Plugin = plugins.Plugin{
+	Name:   "ztp",
+	Setup4: setup4,
+	Setup6: setup6,
+}
+
+const (
+	modeSONiC  = "sonic"
+	modeONIE   = "onie"
+	modeScript = "script"
+
+	// optionSONiCZTPURL is the private option SONiC ZTP reads the ZTP JSON URL from
+	optionSONiCZTPURL = 239
+	// optionSONiCGraphURL is the private option SONiC reads the graph service URL from
+	optionSONiCGraphURL = 225
+
+	// optionSZTPRedirect4 and optionSZTPRedirect6 carry the SZTP bootstrap
+	// server URIs, see RFC 8572, section 8.
+	optionSZTPRedirect4 = 143
+	optionSZTPRedirect6 = 136
+
+	// maxServerHostName and maxBootFileName are the sizes of the sname and file
+	// header fields of DHCPv4, including the terminating zero
+	maxServerHostName = 64
+	maxBootFileName   = 128
+
+	// lookupTimeout bounds the lookup of the ConfigMap of a switch
+	lookupTimeout = 5 * time.Second
+)
+
+// sw is the parsed configuration of a switch.
+type sw struct {
+	name     string
+	mode     string
+	url      string
+	graphURL string
+	// tftpServer and bootFile are derived from the URL in script mode
+	tftpServer string
+	bootFile   string
+	// nextServer is the TFTP server in script mode if given by its IPv4 address
+	nextServer net.IP
+	// bootstrapServers is the encoded SZTP redirect option, nil if not configured
+	bootstrapServers []byte
+}
+
+// plugin holds the state of a single ztp plugin instance. Its switches are
+// built once in setup and never modified afterwards.
+type plugin struct {
+	// switches maps MAC addresses to switches
+	switches map[string]sw
+	// namespace holds the ConfigMaps of the switches not in the config, if set
+	namespace string
+	log       *logrus.Entry
+
+	mu sync.Mutex
+	// seen maps MAC addresses to the switches requests were seen of, see inventory
+	seen map[string]sighting
+}
+
+// args[0] = path to config file
+func parseArgs(args ...string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("exactly one argument must be passed to the ztp plugin, got %d", len(args))
+	}
+	return args[0], nil
+}
+
+func loadConfig(args ...string) (*api.ZTPConfig, error) {
+	path, err := parseArgs(args...)
+	if err != nil {
+		return nil, &fedhcperrors.ConfigError{Err: err}
+	}
+
+	log.Debugf("Reading config file %s", path)
+	config := &api.ZTPConfig{}
+	if err := api.Load(path, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func parseURL(name, value string) (*url.URL, error) {
+	u, err := url.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %s: %w", name, value, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid %s %s: scheme and host must be set", name, value)
+	}
+	return u, nil
+}
+
+func parseSwitch(config api.ZTPSwitch) (sw, error) {
+	s := sw{name: config.Name, mode: config.Mode, url: config.URL, graphURL: config.GraphURL}
+	switch config.Mode {
+	case modeSONiC, modeONIE, modeScript:
+	default:
+		return s, fmt.Errorf("unknown mode %q, should be %s, %s or %s", config.Mode, modeSONiC, modeONIE, modeScript)
+	}
+	if config.GraphURL != "" && config.Mode != modeSONiC {
+		return s, fmt.Errorf("graphURL is supported in %s mode only", modeSONiC)
+	}
+	u, err := parseURL("url", config.URL)
+	if err != nil {
+		return s, err
+	}
+	if config.GraphURL != "" {
+		if _, err := parseURL("graphURL", config.GraphURL); err != nil {
+			return s, err
+		}
+	}
+	if config.Mode == modeScript {
+		s.tftpServer, s.bootFile, s.nextServer = bootFile(u)
+	}
+	if len(config.BootstrapServers) > 0 {
+		if s.bootstrapServers, err = encodeBootstrapServers(config.BootstrapServers); err != nil {
+			return s, err
+		}
+	}
+	return s, nil
+}
+
+// bootFile derives the TFTP server name and the boot file from the script URL.
+// The boot file is the path for a TFTP URL and the URL itself otherwise, as
+// the ZTP of most NOSes fetches it by HTTP if given as URL. A TFTP server given
+// by its IPv4 address is also returned as next server.
+func bootFile(u *url.URL) (string, string, net.IP) {
+	file := u.String()
+	if u.Scheme == "tftp" {
+		file = strings.TrimPrefix(u.Path, "/")
+	}
+	return u.Hostname(), file, net.ParseIP(u.Hostname()).To4()
+}
+
+// encodeBootstrapServers encodes the URIs as SZTP redirect option, each
+// preceded by its length in two bytes, see RFC 8572, section 8.
+func encodeBootstrapServers(uris []string) ([]byte, error) {
+	var data []byte
+	for _, uri := range uris {
+		u, err := parseURL("bootstrap server", uri)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme != "https" {
+			return nil, fmt.Errorf("invalid bootstrap server %s: must be an HTTPS URI", uri)
+		}
+		if len(uri) > math.MaxUint16 {
+			return nil, fmt.Errorf("invalid bootstrap server %s: too long", uri)
+		}
+		data = binary.BigEndian.AppendUint16(data, uint16(len(uri)))
+		data = append(data, uri...)
+	}
+	// the option length is a single byte in DHCPv4
+	if len(data) > math.MaxUint8 {
+		return nil, fmt.Errorf("bootstrap servers exceed %d bytes", math.MaxUint8)
+	}
+	return data, nil
+}
+
+func newPlugin(name string, args ...string) (*plugin, error) {
+	config, err := loadConfig(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(config.Switches) == 0 && config.Namespace == "" {
+		return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("at least one switch or a namespace must be configured")}
+	}
+	p := &plugin{
+		switches:  make(map[string]sw, len(config.Switches)),
+		namespace: config.Namespace,
+		log:       instance.Logger(log, name),
+		seen:      make(map[string]sighting),
+	}
+	for _, config := range config.Switches {
+		mac, err := net.ParseMAC(config.MACAddress)
+		if err != nil {
+			return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("invalid MAC address %s: %w", config.MACAddress, err)}
+		}
+		if _, ok := p.switches[mac.String()]; ok {
+			return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("duplicate switch with MAC address %s", mac)}
+		}
+		if config.Name == "" {
+			config.Name = mac.String()
+		}
+		s, err := parseSwitch(config)
+		if err != nil {
+			return nil, &fedhcperrors.ConfigError{Err: fmt.Errorf("switch %s: %w", config.Name, err)}
+		}
+		p.switches[mac.String()] = s
+	}
+	p.register()
+	return p, nil
+}
+
+// lookup returns the switch of the MAC address from the config or else from
+// its ConfigMap, which is read from the informer cache, so that switches are
+// added without rolling out the config.
+func (p *plugin) lookup(mac net.HardwareAddr) (sw, bool) {
+	if s, ok := p.switches[mac.String()]; ok || p.namespace == "" {
+		return s, ok
+	}
+
+	ctx, cancel := context.WithTimeout(kubernetes.Context(), lookupTimeout)
+	defer cancel()
+	configMaps, err := kubernetes.ConfigMapsForMAC(ctx, p.namespace, mac)
+	if err != nil {
+		p.log.Warningf("Could not look up the ConfigMap of %s: %v", mac, fedhcperrors.FromK8s(err))
+		return sw{}, false
+	}
+	switch len(configMaps) {
+	case 0:
+		return sw{}, false
+	case 1:
+	default:
+		p.log.Warningf("Ignoring %d ConfigMaps labeled %s for %s", len(configMaps), kubernetes.MACLabel, mac)
+		return sw{}, false
+	}
+	s, err := parseSwitch(switchConfig(configMaps[0]))
+	if err != nil {
+		p.log.Warningf("Ignoring invalid switch ConfigMap %s/%s: %v", p.namespace, configMaps[0].Name, err)
+		return sw{}, false
+	}
+	return s, true
+}
+
+// switchConfig returns the switch of a ConfigMap, which is named after it and
+// lists its bootstrap servers separated by whitespace.
+func switchConfig(configMap corev1.ConfigMap) api.ZTPSwitch {
+	return api.ZTPSwitch{
+		Name:             configMap.Name,
+		Mode:             configMap.Data["mode"],
+		URL:              configMap.Data["url"],
+		GraphURL:         configMap.Data["graphURL"],
+		BootstrapServers: strings.Fields(configMap.Data["bootstrapServers"]),
+	}
+}
+
+func setup6(args ...string) (handler.Handler6, error) {
+	p, err := newPlugin("ztp/v6", args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded ztp plugin for DHCPv6 with %d switches.", len(p.switches))
+	return p.handler6, nil
+}
+
+func setup4(args ...string) (handler.Handler4, error) {
+	p, err := newPlugin("ztp/v4", args...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Printf("Loaded ztp plugin for DHCPv4 with %d switches.", len(p.switches))
+	return p.handler4, nil
+}
+
+func (p *plugin) handler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	reply, ok := resp.(*dhcpv6.Message)
+	if !ok {
+		p.log.Errorf("Unexpected response type %T", resp)
+		return resp, false
+	}
+	mac, err := dhcpv6.ExtractMAC(req)
+	if err != nil {
+		p.log.Debugf("Could not determine client MAC address of %s: %v", req.Summary(), err)
+		return resp, false
+	}
+	s, ok := p.lookup(mac)
+	if !ok {
+		return resp, false
+	}
+
+	// all modes read the boot file URL in DHCPv6, there is no TFTP server name
+	reply.UpdateOption(dhcpv6.OptBootFileURL(s.url))
+	if s.mode == modeSONiC {
+		reply.Options.Del(optionSONiCZTPURL)
+		if err := rawopts.Add6(reply, rawopts.Option{Code: optionSONiCZTPURL, Data: []byte(s.url)}); err != nil {
+			p.log.Errorf("Could not add ZTP JSON URL: %v", err)
+		}
+	}
+	if s.bootstrapServers != nil {
+		reply.Options.Del(optionSZTPRedirect6)
+		if err := rawopts.Add6(reply, rawopts.Option{Code: optionSZTPRedirect6, Data: s.bootstrapServers}); err != nil {
+			p.log.Errorf("Could not add SZTP bootstrap servers: %v", err)
+		}
+	}
+	var ip net.IP
+	if iana := reply.Options.OneIANA(); iana != nil {
+		if address := iana.Options.OneAddress(); address != nil {
+			ip = address.IPv6Addr
+		}
+	}
+	p.see(mac, s, ip)
+	p.log.Debugf("Added %s ZTP options of %s for %s", s.mode, s.name, mac)
+	return reply, false
+}
+
+func (p *plugin) handler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	s, ok := p.lookup(req.ClientHWAddr)
+	if !ok {
+		return resp, false
+	}
+
+	switch s.mode {
+	case modeSONiC:
+		resp.UpdateOption(dhcpv4.OptBootFileName(s.url))
+		resp.UpdateOption(dhcpv4.OptGeneric(dhcpv4.GenericOptionCode(optionSONiCZTPURL), []byte(s.url)))
+		if s.graphURL != "" {
+			resp.UpdateOption(dhcpv4.OptGeneric(dhcpv4.GenericOptionCode(optionSONiCGraphURL), []byte(s.graphURL)))
+		}
+	case modeONIE:
+		// ONIE reads the installer URL from the default-url option
+		resp.UpdateOption(dhcpv4.OptGeneric(dhcpv4.OptionURL, []byte(s.url)))
+	case modeScript:
+		// the ZTP reads the options or, if it predates them, the header fields,
+		// which are only set if the values fit
+		resp.UpdateOption(dhcpv4.OptTFTPServerName(s.tftpServer))
+		resp.UpdateOption(dhcpv4.OptBootFileName(s.bootFile))
+		if len(s.tftpServer) < maxServerHostName {
+			resp.ServerHostName = s.tftpServer
+		}
+		if len(s.bootFile) < maxBootFileName {
+			resp.BootFileName = s.bootFile
+		}
+		if s.nextServer != nil {
+			resp.ServerIPAddr = s.nextServer
+		}
+	}
+	if s.bootstrapServers != nil {
+		resp.UpdateOption(dhcpv4.OptGeneric(dhcpv4.GenericOptionCode(optionSZTPRedirect4), s.bootstrapServers))
+	}
+	p.see(req.ClientHWAddr, s, resp.YourIPAddr)
+	p.log.Debugf("Added %s ZTP options of %s for %s", s.mode, s.name, req.ClientHWAddr)
+	return resp, false
+}
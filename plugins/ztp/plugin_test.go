@@ -0,0 +1,372 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: MIT
+
+package ztp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/ironcore-dev/fedhcp/internal/api"
+	"github.com/ironcore-dev/fedhcp/internal/api/apitest"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes"
+	"github.com/ironcore-dev/fedhcp/internal/kubernetes/fake"
+	"github.com/ironcore-dev/fedhcp/internal/rawopts"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	ztpURL       = "http://ztp.example.com/leaf-1/ztp.json"
+	graphURL     = "http://graph.example.com/leaf-1/minigraph.xml"
+	installerURL = "http://ztp.example.com/onie/sonic-installer.bin"
+	scriptURL    = "tftp://192.168.0.10/ztp/border-1.py"
+	bootstrapURL = "https://sztp.example.com/restconf"
+)
+
+var (
+	sonicMAC   = net.HardwareAddr{0x04, 0x3f, 0x72, 0x00, 0x00, 0x01}
+	onieMAC    = net.HardwareAddr{0x04, 0x3f, 0x72, 0x00, 0x00, 0x02}
+	unknownMAC = net.HardwareAddr{0x04, 0x3f, 0x72, 0x00, 0x00, 0x03}
+	scriptMAC  = net.HardwareAddr{0x04, 0x3f, 0x72, 0x00, 0x00, 0x04}
+
+	config = api.ZTPConfig{
+		Switches: []api.ZTPSwitch{
+			{Name: "leaf-1", MACAddress: sonicMAC.String(), Mode: "sonic", URL: ztpURL, GraphURL: graphURL},
+			{Name: "spine-1", MACAddress: onieMAC.String(), Mode: "onie", URL: installerURL},
+			{Name: "border-1", MACAddress: scriptMAC.String(), Mode: "script", URL: scriptURL, BootstrapServers: []string{bootstrapURL}},
+		},
+	}
+)
+
+func TestWrongNumberArgs(t *testing.T) {
+	_, err := setup4()
+	if err == nil {
+		t.Fatal("no error occurred when not providing a configuration file path, but it should have")
+	}
+
+	_, err = setup6("foo", "bar")
+	if err == nil {
+		t.Fatal("no error occurred when providing wrong number of args (2), but it should have")
+	}
+}
+
+func TestWrongArgs(t *testing.T) {
+	for _, config := range []api.ZTPConfig{
+		{},
+		{Switches: []api.ZTPSwitch{{MACAddress: "foo", Mode: "sonic", URL: ztpURL}}},
+		{Switches: []api.ZTPSwitch{{MACAddress: sonicMAC.String(), Mode: "eos", URL: ztpURL}}},
+		{Switches: []api.ZTPSwitch{{MACAddress: sonicMAC.String(), Mode: "sonic", URL: "ztp.json"}}},
+		{Switches: []api.ZTPSwitch{{MACAddress: onieMAC.String(), Mode: "onie", URL: installerURL, GraphURL: graphURL}}},
+		{Switches: []api.ZTPSwitch{{MACAddress: scriptMAC.String(), Mode: "script", URL: scriptURL, GraphURL: graphURL}}},
+		{Switches: []api.ZTPSwitch{{MACAddress: scriptMAC.String(), Mode: "script", URL: scriptURL, BootstrapServers: []string{"http://sztp.example.com"}}}},
+		{Switches: []api.ZTPSwitch{{MACAddress: scriptMAC.String(), Mode: "script", URL: scriptURL, BootstrapServers: []string{"https://" + strings.Repeat("a", 255)}}}},
+		{Switches: []api.ZTPSwitch{
+			{MACAddress: sonicMAC.String(), Mode: "sonic", URL: ztpURL},
+			{MACAddress: "04-3F-72-00-00-01", Mode: "onie", URL: installerURL},
+		}},
+	} {
+		if _, err := setup4(apitest.WriteConfig(t, config)); err == nil {
+			t.Fatalf("no error occurred when providing config %+v, but it should have", config)
+		}
+	}
+}
+
+/* IPv6 */
+func newReply6(t *testing.T, mac net.HardwareAddr) (*dhcpv6.Message, *dhcpv6.Message) {
+	req, err := dhcpv6.NewSolicit(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := dhcpv6.NewAdvertiseFromSolicit(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req, resp
+}
+
+func TestZTP6(t *testing.T) {
+	handler, err := setup6(apitest.WriteConfig(t, config))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		mac              net.HardwareAddr
+		bootFileURL      string
+		expectZTPJSONURL bool
+	}{
+		{sonicMAC, ztpURL, true},
+		{onieMAC, installerURL, false},
+		{scriptMAC, scriptURL, false},
+		{unknownMAC, "", false},
+	} {
+		req, resp := newReply6(t, tc.mac)
+		result, stop := handler(req, resp)
+		if stop {
+			t.Fatal("ztp must not stop the chain")
+		}
+
+		reply := result.(*dhcpv6.Message)
+		if url := reply.Options.BootFileURL(); url != tc.bootFileURL {
+			t.Errorf("expected boot file URL %q for %s, got %q", tc.bootFileURL, tc.mac, url)
+		}
+		if values := rawopts.Get6(reply, optionSONiCZTPURL); tc.expectZTPJSONURL != (len(values) == 1 && string(values[0]) == ztpURL) {
+			t.Errorf("unexpected ZTP JSON URL %q for %s", values, tc.mac)
+		}
+		if values := rawopts.Get6(reply, optionSZTPRedirect6); (tc.mac.String() == scriptMAC.String()) != (len(values) == 1) {
+			t.Errorf("unexpected SZTP bootstrap servers %q for %s", values, tc.mac)
+		}
+	}
+}
+
+/* IPv4 */
+func newReply4(t *testing.T, mac net.HardwareAddr) (*dhcpv4.DHCPv4, *dhcpv4.DHCPv4) {
+	req, err := dhcpv4.NewDiscovery(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := dhcpv4.NewReplyFromRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req, resp
+}
+
+func TestSONiC4(t *testing.T) {
+	handler, err := setup4(apitest.WriteConfig(t, config))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, resp := newReply4(t, sonicMAC)
+	result, stop := handler(req, resp)
+	if stop {
+		t.Fatal("ztp must not stop the chain")
+	}
+	if bootfile := result.BootFileNameOption(); bootfile != ztpURL {
+		t.Errorf("expected boot file name %s, got %s", ztpURL, bootfile)
+	}
+	if value := rawopts.Get4(result, optionSONiCZTPURL); string(value) != ztpURL {
+		t.Errorf("expected ZTP JSON URL %s, got %q", ztpURL, value)
+	}
+	if value := rawopts.Get4(result, optionSONiCGraphURL); string(value) != graphURL {
+		t.Errorf("expected graph URL %s, got %q", graphURL, value)
+	}
+	if result.Options.Has(dhcpv4.OptionURL) {
+		t.Error("expected no ONIE installer URL for a SONiC switch")
+	}
+}
+
+func TestONIE4(t *testing.T) {
+	handler, err := setup4(apitest.WriteConfig(t, config))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, resp := newReply4(t, onieMAC)
+	result, _ := handler(req, resp)
+	if value := result.Options.Get(dhcpv4.OptionURL); string(value) != installerURL {
+		t.Errorf("expected installer URL %s, got %q", installerURL, value)
+	}
+	if result.Options.Has(dhcpv4.OptionBootfileName) || rawopts.Has4(result, optionSONiCZTPURL) {
+		t.Error("expected no SONiC options for an ONIE switch")
+	}
+
+	req, resp = newReply4(t, unknownMAC)
+	result, _ = handler(req, resp)
+	if result.Options.Has(dhcpv4.OptionURL) || result.Options.Has(dhcpv4.OptionBootfileName) {
+		t.Error("expected no ZTP options for an unknown client")
+	}
+}
+
+func TestScript4(t *testing.T) {
+	handler, err := setup4(apitest.WriteConfig(t, config))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, resp := newReply4(t, scriptMAC)
+	result, _ := handler(req, resp)
+	if server := result.TFTPServerName(); server != "192.168.0.10" {
+		t.Errorf("expected TFTP server name 192.168.0.10, got %s", server)
+	}
+	if bootfile := result.BootFileNameOption(); bootfile != "ztp/border-1.py" {
+		t.Errorf("expected boot file name ztp/border-1.py, got %s", bootfile)
+	}
+	if result.BootFileName != "ztp/border-1.py" || result.ServerHostName != "192.168.0.10" || !result.ServerIPAddr.Equal(net.IPv4(192, 168, 0, 10)) {
+		t.Errorf("expected the header fields to be set, got file %q, sname %q, siaddr %s", result.BootFileName, result.ServerHostName, result.ServerIPAddr)
+	}
+	expected := append([]byte{0, byte(len(bootstrapURL))}, bootstrapURL...)
+	if value := rawopts.Get4(result, optionSZTPRedirect4); !bytes.Equal(value, expected) {
+		t.Errorf("expected SZTP bootstrap servers %q, got %q", expected, value)
+	}
+	if result.Options.Has(dhcpv4.OptionURL) || rawopts.Has4(result, optionSONiCZTPURL) {
+		t.Error("expected no SONiC or ONIE options for a script switch")
+	}
+}
+
+func TestBootFile(t *testing.T) {
+	for _, tc := range []struct {
+		url, server, file string
+		next              net.IP
+	}{
+		{"tftp://192.168.0.10/ztp/border-1.py", "192.168.0.10", "ztp/border-1.py", net.IPv4(192, 168, 0, 10)},
+		{"tftp://tftp.example.com:69/border-1.py", "tftp.example.com", "border-1.py", nil},
+		{"http://ztp.example.com:8080/border-1.py", "ztp.example.com", "http://ztp.example.com:8080/border-1.py", nil},
+	} {
+		u, _ := url.Parse(tc.url)
+		server, file, next := bootFile(u)
+		if server != tc.server || file != tc.file || !next.Equal(tc.next) {
+			t.Errorf("expected %s, %s and %s for %s, got %s, %s and %s", tc.server, tc.file, tc.next, tc.url, server, file, next)
+		}
+	}
+}
+
+// initConfigMaps sets a fake client holding the ConfigMaps of switches in the
+// namespace "switches", keyed by their MAC address.
+func initConfigMaps(t *testing.T, data map[string]map[string]string) {
+	var cl client.Client = fake.NewClient()
+	for mac, data := range data {
+		key := strings.ReplaceAll(mac, ":", "")
+		configMap := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "switches", Name: "switch-" + key, Labels: map[string]string{kubernetes.MACLabel: key}},
+			Data:       data,
+		}
+		if err := cl.Create(context.Background(), configMap); err != nil {
+			t.Fatal(err)
+		}
+	}
+	kubernetes.SetClient(&cl)
+	t.Cleanup(func() { kubernetes.SetClient(new(client.Client)) })
+}
+
+func TestConfigMaps(t *testing.T) {
+	initConfigMaps(t, map[string]map[string]string{
+		// the switch of the config takes precedence
+		sonicMAC.String():   {"mode": "onie", "url": installerURL},
+		unknownMAC.String(): {"mode": "sonic", "url": ztpURL, "graphURL": graphURL},
+		scriptMAC.String():  {"mode": "script", "url": "script.py"},
+	})
+	handler, err := setup4(apitest.WriteConfig(t, api.ZTPConfig{Switches: config.Switches[:1], Namespace: "switches"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, resp := newReply4(t, unknownMAC)
+	result, _ := handler(req, resp)
+	if value := rawopts.Get4(result, optionSONiCZTPURL); string(value) != ztpURL {
+		t.Errorf("expected ZTP JSON URL %s from the ConfigMap, got %q", ztpURL, value)
+	}
+	if value := rawopts.Get4(result, optionSONiCGraphURL); string(value) != graphURL {
+		t.Errorf("expected graph URL %s from the ConfigMap, got %q", graphURL, value)
+	}
+
+	req, resp = newReply4(t, sonicMAC)
+	result, _ = handler(req, resp)
+	if value := rawopts.Get4(result, optionSONiCZTPURL); string(value) != ztpURL || result.Options.Has(dhcpv4.OptionURL) {
+		t.Errorf("expected the switch of the config to take precedence, got %v", result.Options)
+	}
+
+	// the invalid URL of the ConfigMap is ignored, like a switch without ConfigMap
+	for _, mac := range []net.HardwareAddr{scriptMAC, onieMAC} {
+		req, resp = newReply4(t, mac)
+		result, _ = handler(req, resp)
+		if result.Options.Has(dhcpv4.OptionBootfileName) || result.Options.Has(dhcpv4.OptionURL) {
+			t.Errorf("expected no ZTP options for %s, got %v", mac, result.Options)
+		}
+	}
+}
+
+func TestConfigMaps6(t *testing.T) {
+	initConfigMaps(t, map[string]map[string]string{
+		scriptMAC.String(): {"mode": "script", "url": scriptURL, "bootstrapServers": bootstrapURL + "\n" + bootstrapURL + "/2"},
+	})
+	handler, err := setup6(apitest.WriteConfig(t, api.ZTPConfig{Namespace: "switches"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, resp := newReply6(t, scriptMAC)
+	result, _ := handler(req, resp)
+	reply := result.(*dhcpv6.Message)
+	if url := reply.Options.BootFileURL(); url != scriptURL {
+		t.Errorf("expected boot file URL %s, got %q", scriptURL, url)
+	}
+	expected, _ := encodeBootstrapServers([]string{bootstrapURL, bootstrapURL + "/2"})
+	if values := rawopts.Get6(reply, optionSZTPRedirect6); len(values) != 1 || !bytes.Equal(values[0], expected) {
+		t.Errorf("expected SZTP bootstrap servers %q, got %q", expected, values)
+	}
+}
+
+func TestInventory(t *testing.T) {
+	registryMu.Lock()
+	registered := registry
+	registry = nil
+	registryMu.Unlock()
+	t.Cleanup(func() {
+		registryMu.Lock()
+		registry = registered
+		registryMu.Unlock()
+	})
+	initConfigMaps(t, map[string]map[string]string{
+		unknownMAC.String(): {"mode": "sonic", "url": ztpURL},
+	})
+	path := apitest.WriteConfig(t, api.ZTPConfig{Switches: config.Switches, Namespace: "switches"})
+	handler4, err := setup4(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler6, err := setup6(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req4, resp4 := newReply4(t, sonicMAC)
+	resp4.YourIPAddr = net.IPv4(192, 168, 0, 21)
+	handler4(req4, resp4)
+	req6, resp6 := newReply6(t, sonicMAC)
+	resp6.AddOption(&dhcpv6.OptIANA{Options: dhcpv6.IdentityOptions{Options: dhcpv6.Options{
+		&dhcpv6.OptIAAddress{IPv6Addr: net.ParseIP("2001:db8::21")},
+	}}})
+	handler6(req6, resp6)
+	req4, resp4 = newReply4(t, unknownMAC)
+	handler4(req4, resp4)
+
+	rec := httptest.NewRecorder()
+	serveInventory(rec, httptest.NewRequest(http.MethodGet, "/ztp/inventory", nil))
+	var document inventoryDocument
+	if err := json.Unmarshal(rec.Body.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+	if len(document.Switches) != 4 {
+		t.Fatalf("expected the 3 configured switches and the one of the ConfigMap, got %+v", document.Switches)
+	}
+	for _, s := range document.Switches {
+		switch s.MACAddress {
+		case sonicMAC.String():
+			if s.Name != "leaf-1" || s.URL != ztpURL || s.LastSeen == nil ||
+				len(s.ManagementIPs) != 2 || s.ManagementIPs[0] != "192.168.0.21" || s.ManagementIPs[1] != "2001:db8::21" {
+				t.Errorf("unexpected state of the seen switch %+v", s)
+			}
+		case unknownMAC.String():
+			if s.Name != "switch-043f72000003" || s.Mode != "sonic" || s.LastSeen == nil || len(s.ManagementIPs) != 0 {
+				t.Errorf("unexpected state of the switch of the ConfigMap %+v", s)
+			}
+		default:
+			if s.LastSeen != nil || len(s.ManagementIPs) != 0 {
+				t.Errorf("expected switch %s not to be seen, got %+v", s.MACAddress, s)
+			}
+		}
+	}
+}